@@ -0,0 +1,285 @@
+// Package advisor provides a dry-run index compatibility checker for generated filters.
+package advisor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Index describes a collection index by name and ordered key specification.
+type Index struct {
+	Name string
+	Keys bson.D
+}
+
+// Report is the result of checking a filter against a set of indexes.
+type Report struct {
+	// CanUseIndex reports whether every part of the filter can be served by an existing index
+	CanUseIndex bool
+	// UsableIndexes lists the names of indexes the filter can use
+	UsableIndexes []string
+	// Warnings describes predicates that cannot use an index efficiently
+	Warnings []string
+	// SuggestedIndexes holds index key specifications that would serve the unindexed parts of the filter
+	SuggestedIndexes []bson.D
+}
+
+// predicateKind classifies how a field predicate interacts with a B-tree index.
+type predicateKind int
+
+const (
+	// predicateEquality is an exact match or $in
+	predicateEquality predicateKind = iota
+	// predicateRange is a bounded comparison or an anchored regex
+	predicateRange
+	// predicateUnindexable is a negation, unanchored or case-insensitive regex
+	predicateUnindexable
+)
+
+// predicate is a single field condition from a conjunction.
+type predicate struct {
+	field string
+	kind  predicateKind
+}
+
+// Analyze checks a filter against the given indexes and reports index usability,
+// inefficient predicates and suggested index specifications.
+func Analyze(filter bson.M, indexes []Index) *Report {
+	a := &analyzer{indexes: indexes, usable: map[string]bool{}, report: &Report{}}
+	a.report.CanUseIndex = a.conjunction(filter)
+
+	for name := range a.usable {
+		a.report.UsableIndexes = append(a.report.UsableIndexes, name)
+	}
+	sort.Strings(a.report.UsableIndexes)
+
+	return a.report
+}
+
+// AnalyzeCollection lists the indexes of a live collection and analyzes the filter against them.
+func AnalyzeCollection(ctx context.Context, coll *mongo.Collection, filter bson.M) (*Report, error) {
+	indexes, err := ListIndexes(ctx, coll)
+	if err != nil {
+		return nil, err
+	}
+	return Analyze(filter, indexes), nil
+}
+
+// ListIndexes lists the indexes of a live collection.
+func ListIndexes(ctx context.Context, coll *mongo.Collection) ([]Index, error) {
+	specs, err := coll.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %v", err)
+	}
+
+	indexes := make([]Index, 0, len(specs))
+	for _, spec := range specs {
+		var keys bson.D
+		if err := bson.Unmarshal(spec.KeysDocument, &keys); err != nil {
+			return nil, fmt.Errorf("failed to decode index %s: %v", spec.Name, err)
+		}
+		indexes = append(indexes, Index{Name: spec.Name, Keys: keys})
+	}
+	return indexes, nil
+}
+
+// TextIndex returns the name of the first text index, or "" when there is none.
+func TextIndex(indexes []Index) string {
+	for _, index := range indexes {
+		for _, key := range index.Keys {
+			if key.Value == "text" {
+				return index.Name
+			}
+		}
+	}
+	return ""
+}
+
+// analyzer accumulates findings while walking a filter.
+type analyzer struct {
+	indexes []Index
+	usable  map[string]bool
+	report  *Report
+}
+
+// conjunction analyzes an implicit-AND filter document and reports whether an index can serve it.
+func (a *analyzer) conjunction(filter bson.M) bool {
+	var predicates []predicate
+	var orGroups [][]bson.M
+	usesText := false
+
+	a.collect(filter, &predicates, &orGroups, &usesText)
+
+	if usesText {
+		textIndex := a.findTextIndex()
+		if textIndex == "" {
+			a.warn("$text search requires a text index, none exists")
+			a.suggest(bson.D{{Key: "$**", Value: "text"}})
+			return false
+		}
+		// A $text query always runs on the text index
+		a.usable[textIndex] = true
+		return true
+	}
+
+	if len(predicates) == 0 && len(orGroups) == 0 {
+		// An empty filter is a collection scan by definition
+		return len(filter) == 0
+	}
+
+	if name := a.findIndex(predicates); name != "" {
+		a.usable[name] = true
+		return true
+	}
+
+	// Without a usable index on the conjunction, each $or needs every branch indexed
+	for _, branches := range orGroups {
+		allIndexed := true
+		for _, branch := range branches {
+			if !a.conjunction(branch) {
+				allIndexed = false
+			}
+		}
+		if allIndexed {
+			return true
+		}
+	}
+
+	if keys := suggestKeys(predicates); len(keys) > 0 {
+		a.suggest(keys)
+	}
+	return false
+}
+
+// collect gathers the predicates of a conjunction, descending into $and and recording $or groups.
+func (a *analyzer) collect(filter bson.M, predicates *[]predicate, orGroups *[][]bson.M, usesText *bool) {
+	for _, key := range sortedKeys(filter) {
+		value := filter[key]
+		switch key {
+		case "$and":
+			for _, sub := range bsonfilter.Clauses(value) {
+				a.collect(sub, predicates, orGroups, usesText)
+			}
+		case "$or":
+			*orGroups = append(*orGroups, bsonfilter.Clauses(value))
+		case "$nor":
+			a.warn("$nor cannot use an index efficiently")
+		case "$text":
+			*usesText = true
+		default:
+			if strings.HasPrefix(key, "$") {
+				continue
+			}
+			*predicates = append(*predicates, predicate{field: key, kind: a.classify(key, value)})
+		}
+	}
+}
+
+// classify determines the predicate kind of a field value, warning about inefficient patterns.
+func (a *analyzer) classify(field string, value interface{}) predicateKind {
+	switch v := value.(type) {
+	case bson.Regex:
+		return a.classifyRegex(field, v.Pattern, v.Options)
+	case bson.M:
+		if pattern, ok := v["$regex"].(string); ok {
+			options, _ := v["$options"].(string)
+			return a.classifyRegex(field, pattern, options)
+		}
+		for _, negation := range []string{"$ne", "$not", "$nin"} {
+			if _, ok := v[negation]; ok {
+				a.warn(fmt.Sprintf("negation on %s (%s) cannot use an index efficiently", field, negation))
+				return predicateUnindexable
+			}
+		}
+		for _, op := range []string{"$gt", "$gte", "$lt", "$lte", "$exists"} {
+			if _, ok := v[op]; ok {
+				return predicateRange
+			}
+		}
+	}
+	return predicateEquality
+}
+
+// classifyRegex flags leading-wildcard and case-insensitive regexes, which cannot use index bounds.
+func (a *analyzer) classifyRegex(field, pattern, options string) predicateKind {
+	if !strings.HasPrefix(pattern, "^") || strings.HasPrefix(pattern, "^.*") {
+		a.warn(fmt.Sprintf("leading-wildcard regex on %s cannot use an index efficiently: %s", field, pattern))
+		return predicateUnindexable
+	}
+	if strings.Contains(options, "i") {
+		a.warn(fmt.Sprintf("case-insensitive regex on %s cannot use an index efficiently; consider a case-insensitive collation index", field))
+		return predicateUnindexable
+	}
+	return predicateRange
+}
+
+// findIndex returns the name of an index whose leading key matches an index-friendly predicate.
+func (a *analyzer) findIndex(predicates []predicate) string {
+	for _, index := range a.indexes {
+		if len(index.Keys) == 0 {
+			continue
+		}
+		for _, p := range predicates {
+			if p.kind != predicateUnindexable && p.field == index.Keys[0].Key {
+				return index.Name
+			}
+		}
+	}
+	return ""
+}
+
+// findTextIndex returns the name of the first text index, if any.
+func (a *analyzer) findTextIndex() string {
+	return TextIndex(a.indexes)
+}
+
+// warn records a warning once.
+func (a *analyzer) warn(message string) {
+	for _, existing := range a.report.Warnings {
+		if existing == message {
+			return
+		}
+	}
+	a.report.Warnings = append(a.report.Warnings, message)
+}
+
+// suggest records a suggested index specification once.
+func (a *analyzer) suggest(keys bson.D) {
+	for _, existing := range a.report.SuggestedIndexes {
+		if fmt.Sprint(existing) == fmt.Sprint(keys) {
+			return
+		}
+	}
+	a.report.SuggestedIndexes = append(a.report.SuggestedIndexes, keys)
+}
+
+// suggestKeys builds an index specification following the equality-before-range rule.
+func suggestKeys(predicates []predicate) bson.D {
+	var keys bson.D
+	seen := map[string]bool{}
+	for _, kind := range []predicateKind{predicateEquality, predicateRange} {
+		for _, p := range predicates {
+			if p.kind == kind && !seen[p.field] {
+				seen[p.field] = true
+				keys = append(keys, bson.E{Key: p.field, Value: 1})
+			}
+		}
+	}
+	return keys
+}
+
+// sortedKeys returns the keys of a document in sorted order for deterministic reports.
+func sortedKeys(doc bson.M) []string {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,194 @@
+package advisor_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kyle-williams-1/bsonic"
+	"github.com/kyle-williams-1/bsonic/advisor"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// parse generates a filter from a Lucene query using "name" as the default field
+func parse(t *testing.T, query string) bson.M {
+	t.Helper()
+	filter, err := bsonic.ParseWithDefaults([]string{"name"}, query)
+	if err != nil {
+		t.Fatalf("Failed to parse query %q: %v", query, err)
+	}
+	return filter
+}
+
+// TestAnalyzeIndexUsage tests detection of usable indexes
+func TestAnalyzeIndexUsage(t *testing.T) {
+	indexes := []advisor.Index{
+		{Name: "_id_", Keys: bson.D{{Key: "_id", Value: 1}}},
+		{Name: "role_1_age_1", Keys: bson.D{{Key: "role", Value: 1}, {Key: "age", Value: 1}}},
+		{Name: "email_1", Keys: bson.D{{Key: "email", Value: 1}}},
+	}
+
+	tests := []struct {
+		query       string
+		canUseIndex bool
+		usable      []string
+		desc        string
+	}{
+		{"role:admin", true, []string{"role_1_age_1"}, "equality on leading key"},
+		{"role:admin AND age:>18", true, []string{"role_1_age_1"}, "compound index prefix"},
+		{"age:>18", false, nil, "non-leading key only"},
+		{"email:john*", true, []string{"email_1"}, "anchored prefix regex"},
+		{"role:admin OR email:john@example.com", true, []string{"email_1", "role_1_age_1"}, "every OR branch indexed"},
+		{"role:admin OR status:active", false, []string{"role_1_age_1"}, "one OR branch unindexed"},
+		{"", true, nil, "empty filter"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			report := advisor.Analyze(parse(t, test.query), indexes)
+			if report.CanUseIndex != test.canUseIndex {
+				t.Fatalf("Expected CanUseIndex %v, got %+v", test.canUseIndex, report)
+			}
+			if strings.Join(report.UsableIndexes, ",") != strings.Join(test.usable, ",") {
+				t.Fatalf("Expected usable indexes %v, got %v", test.usable, report.UsableIndexes)
+			}
+		})
+	}
+}
+
+// TestAnalyzeWarnings tests flagging of predicates that cannot use an index efficiently
+func TestAnalyzeWarnings(t *testing.T) {
+	indexes := []advisor.Index{{Name: "email_1", Keys: bson.D{{Key: "email", Value: 1}}}}
+
+	tests := []struct {
+		filter  bson.M
+		warning string
+		desc    string
+	}{
+		{bson.M{"email": bson.M{"$regex": ".*@example\\.com$"}}, "leading-wildcard regex on email", "unanchored regex"},
+		{bson.M{"email": bson.M{"$regex": "^.*@example"}}, "leading-wildcard regex on email", "anchored dot-star regex"},
+		{bson.M{"email": bson.Regex{Pattern: "example"}}, "leading-wildcard regex on email", "bson.Regex value"},
+		{bson.M{"email": bson.M{"$regex": "^john$", "$options": "i"}}, "case-insensitive regex on email", "case-insensitive regex"},
+		{bson.M{"email": bson.M{"$ne": "x"}}, "negation on email ($ne)", "negation"},
+		{bson.M{"$text": bson.M{"$search": "john"}}, "$text search requires a text index", "unindexed $text"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			report := advisor.Analyze(test.filter, indexes)
+			if report.CanUseIndex {
+				t.Fatalf("Expected CanUseIndex false, got %+v", report)
+			}
+			found := false
+			for _, warning := range report.Warnings {
+				if strings.Contains(warning, test.warning) {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatalf("Expected warning containing %q, got %v", test.warning, report.Warnings)
+			}
+		})
+	}
+
+	t.Run("IndexedText", func(t *testing.T) {
+		textIndexes := []advisor.Index{{Name: "content_text", Keys: bson.D{{Key: "title", Value: "text"}, {Key: "body", Value: "text"}}}}
+		report := advisor.Analyze(bson.M{"$text": bson.M{"$search": "john"}}, textIndexes)
+		if !report.CanUseIndex || len(report.UsableIndexes) != 1 || report.UsableIndexes[0] != "content_text" {
+			t.Fatalf("Expected text index to be usable, got %+v", report)
+		}
+		if len(report.Warnings) != 0 {
+			t.Fatalf("Expected no warnings, got %v", report.Warnings)
+		}
+	})
+}
+
+// TestAnalyzeSuggestions tests suggested index specifications
+func TestAnalyzeSuggestions(t *testing.T) {
+	t.Run("EqualityBeforeRange", func(t *testing.T) {
+		report := advisor.Analyze(parse(t, "age:>18 AND status:active AND role:admin"), nil)
+		if len(report.SuggestedIndexes) != 1 {
+			t.Fatalf("Expected one suggestion, got %+v", report.SuggestedIndexes)
+		}
+
+		expected := bson.D{{Key: "role", Value: 1}, {Key: "status", Value: 1}, {Key: "age", Value: 1}}
+		suggestion := report.SuggestedIndexes[0]
+		if len(suggestion) != len(expected) {
+			t.Fatalf("Expected %v, got %v", expected, suggestion)
+		}
+		for i := range expected {
+			if suggestion[i] != expected[i] {
+				t.Fatalf("Expected %v, got %v", expected, suggestion)
+			}
+		}
+	})
+
+	t.Run("UnindexedOrBranch", func(t *testing.T) {
+		indexes := []advisor.Index{{Name: "role_1", Keys: bson.D{{Key: "role", Value: 1}}}}
+		report := advisor.Analyze(parse(t, "role:admin OR status:active"), indexes)
+		if len(report.SuggestedIndexes) != 1 || report.SuggestedIndexes[0][0].Key != "status" {
+			t.Fatalf("Expected suggestion on status, got %+v", report.SuggestedIndexes)
+		}
+	})
+
+	t.Run("NoSuggestionForUnindexablePredicates", func(t *testing.T) {
+		report := advisor.Analyze(parse(t, "NOT status:active"), nil)
+		if len(report.SuggestedIndexes) != 0 {
+			t.Fatalf("Expected no suggestions, got %+v", report.SuggestedIndexes)
+		}
+	})
+}
+
+func TestTextIndex(t *testing.T) {
+	indexes := []advisor.Index{
+		{Name: "_id_", Keys: bson.D{{Key: "_id", Value: 1}}},
+		{Name: "title_text_body_text", Keys: bson.D{{Key: "title", Value: "text"}, {Key: "body", Value: "text"}}},
+	}
+	if name := advisor.TextIndex(indexes); name != "title_text_body_text" {
+		t.Errorf("Expected the text index, got %q", name)
+	}
+	if name := advisor.TextIndex(indexes[:1]); name != "" {
+		t.Errorf("Expected no text index, got %q", name)
+	}
+}
+
+func TestAnalyzeShardKey(t *testing.T) {
+	hashed := bson.D{{Key: "tenant_id", Value: "hashed"}}
+	compound := bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: 1}}
+
+	tests := []struct {
+		name     string
+		query    string
+		shardKey bson.D
+		targeted bool
+		warning  string
+	}{
+		{"Equality", "tenant_id:acme AND status:active", hashed, true, ""},
+		{"In", "(tenant_id:acme OR tenant_id:globex) AND status:active", hashed, true, ""},
+		{"CompoundPrefix", "tenant_id:acme AND created_at:>2024-01-01", compound, true, ""},
+		{"EveryOrBranch", "(tenant_id:acme AND role:admin) OR (tenant_id:globex AND role:owner)", hashed, true, ""},
+		{"Missing", "status:active", hashed, false, "no equality condition on shard key field tenant_id"},
+		{"SecondFieldOnly", "created_at:>2024-01-01", compound, false, "no equality condition on shard key field tenant_id"},
+		{"Range", "tenant_id:[1 TO 5]", compound, false, "not an equality match"},
+		{"Wildcard", "tenant_id:acme*", hashed, false, "not an equality match"},
+		{"Negation", "NOT tenant_id:acme", hashed, false, "not an equality match"},
+		{"OrBranchMissing", "tenant_id:acme OR status:active", hashed, false, "an $or branch has no equality condition"},
+		{"NoShardKey", "tenant_id:acme", nil, false, "no shard key given"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := advisor.AnalyzeShardKey(parse(t, tt.query), tt.shardKey)
+			if report.Targeted != tt.targeted {
+				t.Errorf("Expected targeted %v, got %v (%v)", tt.targeted, report.Targeted, report.Warnings)
+			}
+			if tt.warning == "" {
+				if len(report.Warnings) != 0 {
+					t.Errorf("Expected no warnings, got %v", report.Warnings)
+				}
+				return
+			}
+			if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], tt.warning) {
+				t.Errorf("Expected a warning containing %q, got %v", tt.warning, report.Warnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package advisor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ShardReport is the result of checking a filter against a sharded collection's shard key.
+type ShardReport struct {
+	// Targeted reports whether mongos can route the query to the shards owning the matching shard key values,
+	// rather than broadcasting it to every shard
+	Targeted bool
+	// Warnings explains why an untargeted query is broadcast to every shard
+	Warnings []string
+}
+
+// AnalyzeShardKey checks whether a filter can target shards given the collection's shard key, such as
+// bson.D{{Key: "tenant_id", Value: "hashed"}}. A query is targeted when every way it can match pins the first
+// shard key field with an equality or $in condition; otherwise it is a scatter-gather query sent to every shard.
+func AnalyzeShardKey(filter bson.M, shardKey bson.D) *ShardReport {
+	report := &ShardReport{}
+	if len(shardKey) == 0 {
+		report.Warnings = append(report.Warnings, "no shard key given")
+		return report
+	}
+
+	field := shardKey[0].Key
+	report.Targeted = pinsShardKey(filter, field)
+	if report.Targeted {
+		return report
+	}
+
+	switch {
+	case hasOrWithoutShardKey(filter, field):
+		report.Warnings = append(report.Warnings, fmt.Sprintf("an $or branch has no equality condition on shard key field %s, so the query is sent to every shard", field))
+	case mentionsField(filter, field):
+		report.Warnings = append(report.Warnings, fmt.Sprintf("the condition on shard key field %s is not an equality match, so the query is sent to every shard", field))
+	default:
+		report.Warnings = append(report.Warnings, fmt.Sprintf("no equality condition on shard key field %s, so the query is sent to every shard", field))
+	}
+	return report
+}
+
+// pinsShardKey reports whether every document matching a filter must have one of a fixed set of values in field
+func pinsShardKey(filter bson.M, field string) bool {
+	if value, ok := filter[field]; ok && isEqualityCondition(value) {
+		return true
+	}
+	for _, sub := range bsonfilter.Clauses(filter["$and"]) {
+		if pinsShardKey(sub, field) {
+			return true
+		}
+	}
+	if branches := bsonfilter.Clauses(filter["$or"]); len(branches) > 0 {
+		for _, branch := range branches {
+			if !pinsShardKey(branch, field) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isEqualityCondition reports whether a field condition matches a fixed set of values: a literal, $eq or $in
+func isEqualityCondition(value interface{}) bool {
+	switch v := value.(type) {
+	case bson.Regex:
+		return false
+	case bson.M:
+		if _, ok := v["$eq"]; ok {
+			return true
+		}
+		if _, ok := v["$in"]; ok {
+			return true
+		}
+		// An embedded document without operators is an exact match
+		for key := range v {
+			if strings.HasPrefix(key, "$") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// hasOrWithoutShardKey reports whether a filter has an $or where some branches pin field and others do not
+func hasOrWithoutShardKey(filter bson.M, field string) bool {
+	pinned, unpinned := false, false
+	for _, branch := range bsonfilter.Clauses(filter["$or"]) {
+		if pinsShardKey(branch, field) {
+			pinned = true
+		} else {
+			unpinned = true
+		}
+	}
+	if pinned && unpinned {
+		return true
+	}
+	for _, sub := range bsonfilter.Clauses(filter["$and"]) {
+		if hasOrWithoutShardKey(sub, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// mentionsField reports whether a filter has any condition on field, descending into logical operators
+func mentionsField(filter bson.M, field string) bool {
+	for key, value := range filter {
+		if key == field {
+			return true
+		}
+		if strings.HasPrefix(key, "$") {
+			for _, sub := range bsonfilter.Clauses(value) {
+				if mentionsField(sub, field) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package bsonic
+
+// auditedOperators are the operators the formatters emit, including the pipeline stages and aggregation
+// expressions of the search, score and lookup stages, and the query operators accepted as MQL input.
+// Server-side JavaScript operators such as $where, $function and $accumulator are intentionally absent.
+var auditedOperators = map[string]bool{
+	"$and": true, "$or": true, "$nor": true, "$not": true,
+	"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true,
+	"$in": true, "$nin": true, "$exists": true, "$type": true,
+	"$regex": true, "$options": true, "$elemMatch": true, "$size": true, "$all": true, "$mod": true,
+	"$text": true, "$search": true, "$language": true, "$caseSensitive": true, "$diacriticSensitive": true,
+	"$meta": true, "$lookup": true, "$addFields": true,
+	"$add": true, "$cond": true, "$convert": true, "$regexMatch": true,
+}
+
+// auditOperators rejects a result using an operator outside auditedOperators anywhere in its filter, sort,
+// projection or stages, when the operator audit is enabled.
+func (p *Parser) auditOperators(result *ParseResult) error {
+	if !p.Config.OperatorAudit {
+		return nil
+	}
+
+	var found string
+	visit := func(operator string) {
+		if found == "" && !auditedOperators[operator] {
+			found = operator
+		}
+	}
+	walkOperators(result.Filter, visit)
+	walkOperators(result.Sort, visit)
+	walkOperators(result.Projection, visit)
+	walkOperators(result.SearchStage, visit)
+	walkOperators(result.ScoreStage, visit)
+	walkOperators(result.TextScoreProjection, visit)
+	walkOperators(result.TextScoreSort, visit)
+	walkOperators(result.LookupStages, visit)
+
+	if found != "" {
+		return unsupportedf("operator audit failed: %s is not an approved operator", found)
+	}
+	return nil
+}
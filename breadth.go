@@ -0,0 +1,177 @@
+package bsonic
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Breadth classifies how much of a collection a filter can match, so deletes and updates cannot touch
+// most or all of a collection by accident.
+type Breadth string
+
+const (
+	// BreadthEmpty is a filter without conditions besides the soft delete condition, which matches every document
+	BreadthEmpty Breadth = "empty"
+	// BreadthUnselective is a filter narrowed only by the configured unselective fields, the soft delete field,
+	// negations such as $ne and $nin, $exists and $type checks and regexes matching any string, such as the .*
+	// of name:*, which usually match large parts of a collection
+	BreadthUnselective Breadth = "unselective"
+	// BreadthSelective is a filter with at least one condition that narrows it to specific documents
+	BreadthSelective Breadth = "selective"
+)
+
+// breadthRanks orders the breadths from the broadest to the narrowest
+var breadthRanks = map[Breadth]int{BreadthEmpty: 0, BreadthUnselective: 1, BreadthSelective: 2}
+
+// ErrBroadFilter is matched, together with ErrLimitExceeded, by errors for filters too broad for a delete or
+// update. errors.As finds the *BreadthError with the filter's breadth.
+var ErrBroadFilter = errors.New("filter too broad")
+
+// BreadthError reports a filter too broad for a delete or update without an override.
+type BreadthError struct {
+	// Breadth is the filter's breadth
+	Breadth Breadth
+	// Allowed is the broadest breadth that was allowed
+	Allowed Breadth
+}
+
+func (e *BreadthError) Error() string {
+	return fmt.Sprintf("filter is %s, but only %s filters are allowed without an override", e.Breadth, e.Allowed)
+}
+
+// Is reports whether target is ErrBroadFilter.
+func (e *BreadthError) Is(target error) bool {
+	return target == ErrBroadFilter
+}
+
+// Breadth classifies a filter. The conditions ANDed together are as selective as the most selective of them, and
+// the branches of an $or are as selective as the least selective of them, since the $or matches at least as much.
+// When the parser's config provider fails, every filter is BreadthEmpty.
+func (p *Parser) Breadth(filter bson.M) Breadth {
+	p, err := p.current()
+	if err != nil {
+		return BreadthEmpty
+	}
+	return p.breadth(filter)
+}
+
+// CheckBreadth returns an error matching ErrBroadFilter and ErrLimitExceeded when a filter is broader than allowed,
+// such as an empty filter when allowed is BreadthUnselective. The delete and update helpers check their filters
+// with BreadthSelective unless overridden with WithAllowedBreadth.
+func (p *Parser) CheckBreadth(filter bson.M, allowed Breadth) error {
+	p, err := p.current()
+	if err != nil {
+		return err
+	}
+	if breadth := p.breadth(filter); breadthRanks[breadth] < breadthRanks[allowed] {
+		return &Error{Kind: ErrLimitExceeded, Err: &BreadthError{Breadth: breadth, Allowed: allowed}}
+	}
+	return nil
+}
+
+// breadth classifies the conditions of a filter document, which are ANDed together
+func (p *Parser) breadth(filter bson.M) Breadth {
+	result := BreadthEmpty
+	for key, value := range filter {
+		var breadth Breadth
+		switch key {
+		case "$and":
+			breadth = BreadthEmpty
+			for _, sub := range bsonfilter.Clauses(value) {
+				breadth = narrowest(breadth, p.breadth(sub))
+			}
+		case "$or":
+			branches := bsonfilter.Clauses(value)
+			breadth = BreadthSelective
+			for _, sub := range branches {
+				breadth = broadest(breadth, p.breadth(sub))
+			}
+			if len(branches) == 0 {
+				breadth = BreadthEmpty
+			}
+		case "$nor":
+			breadth = BreadthUnselective
+		default:
+			breadth = p.conditionBreadth(key, value)
+		}
+		result = narrowest(result, breadth)
+	}
+	return result
+}
+
+// conditionBreadth classifies a field condition, or a top-level operator such as $text, which is selective
+func (p *Parser) conditionBreadth(field string, condition interface{}) Breadth {
+	if strings.HasPrefix(field, "$") {
+		return BreadthSelective
+	}
+	if field == p.Config.SoftDeleteField && condition == nil {
+		// The soft delete condition is part of every query, so it does not narrow one
+		return BreadthEmpty
+	}
+	if field == p.Config.SoftDeleteField || slices.Contains(p.Config.UnselectiveFields, field) ||
+		slices.Contains(p.Config.UnselectiveFields, config.SchemaPath(field)) {
+		return BreadthUnselective
+	}
+	if regex, ok := condition.(bson.Regex); ok && matchesAnyString(regex.Pattern) {
+		return BreadthUnselective
+	}
+	if doc, ok := condition.(bson.M); ok && (isNegation(doc) || isMatchAll(doc)) {
+		return BreadthUnselective
+	}
+	return BreadthSelective
+}
+
+// isNegation reports whether a condition only excludes values or checks for the field or its type, as
+// {"$ne": "x"}, {"$exists": true} or {"$type": "string"} do
+func isNegation(condition bson.M) bool {
+	for operator := range condition {
+		switch operator {
+		case "$ne", "$nin", "$not", "$exists", "$type":
+		default:
+			return false
+		}
+	}
+	return len(condition) > 0
+}
+
+// isMatchAll reports whether a condition is a regex matching any string, as {"$regex": ".*"} does
+func isMatchAll(condition bson.M) bool {
+	pattern, ok := condition["$regex"].(string)
+	if !ok {
+		return false
+	}
+	for operator := range condition {
+		if operator != "$regex" && operator != "$options" {
+			return false
+		}
+	}
+	return matchesAnyString(pattern)
+}
+
+// matchesAnyString reports whether a regex pattern matches any string, such as an empty pattern, .* or ^.*$
+func matchesAnyString(pattern string) bool {
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "^"), "$")
+	return pattern == "" || pattern == ".*"
+}
+
+// narrowest returns the more selective of two breadths
+func narrowest(a, b Breadth) Breadth {
+	if breadthRanks[b] > breadthRanks[a] {
+		return b
+	}
+	return a
+}
+
+// broadest returns the less selective of two breadths
+func broadest(a, b Breadth) Breadth {
+	if breadthRanks[b] < breadthRanks[a] {
+		return b
+	}
+	return a
+}
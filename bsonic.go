@@ -2,25 +2,37 @@
 package bsonic
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"strings"
+	"sync/atomic"
 
 	"github.com/kyle-williams-1/bsonic/config"
 	"github.com/kyle-williams-1/bsonic/formatter"
 	"github.com/kyle-williams-1/bsonic/formatter/mongo"
 	"github.com/kyle-williams-1/bsonic/language"
 	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"github.com/kyle-williams-1/bsonic/language/mql"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"golang.org/x/text/unicode/norm"
 )
 
 // Parser represents a query parser for the selected language and MongoDB formatter.
 type Parser struct {
-	// Config holds the language and formatter configuration
+	// Config holds the language and formatter configuration, a frozen snapshot of the config the parser was created with
 	Config *config.Config
 	// Language parser instance
 	languageParser language.Parser
 	// Formatter instance (generic)
 	formatter formatter.Formatter[bson.M]
+	// provider supplies the config per request for parsers created with NewWithProvider
+	provider config.Provider
+	// state caches the parser built for the provider's current config
+	state atomic.Pointer[providerState]
+	// access limits the fields and operators of a parse run with ParseWithPermissions
+	access *access
+	// includeDeleted leaves out the soft delete condition for a parse run with ParseIncludingDeleted
+	includeDeleted bool
 }
 
 // NewParser creates a parser based on the language type.
@@ -28,8 +40,20 @@ func NewParser(langType config.LanguageType) (language.Parser, error) {
 	switch langType {
 	case config.LanguageLucene:
 		return lucene.New(), nil
+	case config.LanguageMQL:
+		return mql.New(), nil
 	default:
-		return nil, fmt.Errorf("unsupported language type: %s", langType)
+		return nil, unsupportedf("unsupported language type: %s", langType)
+	}
+}
+
+// NewParserWithConfig creates a parser based on the language type with config options.
+func NewParserWithConfig(langType config.LanguageType, cfg *config.Config) (language.Parser, error) {
+	switch langType {
+	case config.LanguageLucene:
+		return lucene.New().WithLowercaseOperators(cfg.LowercaseOperators), nil
+	default:
+		return NewParser(langType)
 	}
 }
 
@@ -39,7 +63,7 @@ func NewFormatter(formatterType config.FormatterType) (formatter.Formatter[bson.
 	case config.FormatterMongo:
 		return mongo.New(), nil
 	default:
-		return nil, fmt.Errorf("unsupported formatter type: %s", formatterType)
+		return nil, unsupportedf("unsupported formatter type: %s", formatterType)
 	}
 }
 
@@ -47,12 +71,42 @@ func NewFormatter(formatterType config.FormatterType) (formatter.Formatter[bson.
 func NewFormatterWithConfig(formatterType config.FormatterType, cfg *config.Config) (formatter.Formatter[bson.M], error) {
 	switch formatterType {
 	case config.FormatterMongo:
-		return mongo.NewWithOptions(cfg.ReplaceIDWithMongoID, cfg.AutoConvertIDToObjectID), nil
+		return mongo.NewWithOptions(cfg.ReplaceIDWithMongoID, cfg.AutoConvertIDToObjectID).
+			WithTextSearchOptions(mongo.TextSearchOptions{
+				Language:           cfg.TextLanguage,
+				CaseSensitive:      cfg.TextCaseSensitive,
+				DiacriticSensitive: cfg.TextDiacriticSensitive,
+			}).
+			WithTextSearchStrategy(cfg.TextSearchStrategy).
+			WithAtlasSearchIndex(cfg.AtlasSearchIndex).
+			WithMultiWordMode(cfg.MultiWordMode).
+			WithTextTokenizer(cfg.TextTokenizer).
+			WithSubqueryResolver(cfg.SubqueryResolver).
+			WithLegacyTextCompat(cfg.LegacyText()).
+			WithLogicalNormalization(cfg.NormalizedLogic()).
+			WithFieldTypes(withDeprecatedNames(cfg.FieldTypes, cfg.DeprecatedFields)).
+			WithBoolCoercion(cfg.BoolCoercion, withDeprecatedNames(cfg.FieldBoolCoercion, cfg.DeprecatedFields)).
+			WithAccentInsensitive(cfg.AccentInsensitive, enumFieldNames(withDeprecatedNames(cfg.EnumFields, cfg.DeprecatedFields))...).
+			WithDurationUnit(cfg.DurationUnit).
+			WithCurrencyConverter(cfg.CurrencyConverter).
+			WithNumberSeparators(cfg.DecimalSeparator, cfg.ThousandsSeparator, cfg.StrictNumbers).
+			WithExplicitEquality(cfg.ExplicitEquality).
+			WithValueCoercers(withDeprecatedNames(cfg.FieldCoercers, cfg.DeprecatedFields), cfg.TypeCoercers), nil
 	default:
-		return nil, fmt.Errorf("unsupported formatter type: %s", formatterType)
+		return nil, unsupportedf("unsupported formatter type: %s", formatterType)
 	}
 }
 
+// enumFieldNames returns the names of the enum fields, whose values are matched exactly so they can be
+// validated against the allowed values
+func enumFieldNames(fields map[string][]string) []string {
+	names := make([]string, 0, len(fields))
+	for field := range fields {
+		names = append(names, field)
+	}
+	return names
+}
+
 // NewMongoFormatter creates a MongoDB BSON formatter with proper typing.
 func NewMongoFormatter() formatter.Formatter[bson.M] {
 	return mongo.New()
@@ -60,7 +114,7 @@ func NewMongoFormatter() formatter.Formatter[bson.M] {
 
 // New creates a new parser instance with default configuration.
 func New() *Parser {
-	cfg := config.Default()
+	cfg := config.Default().Freeze()
 	languageParser, _ := NewParser(cfg.Language)
 	formatter, _ := NewFormatter(cfg.Formatter)
 
@@ -72,8 +126,18 @@ func New() *Parser {
 }
 
 // NewWithConfig creates a new parser with custom configuration.
+// The parser uses a frozen snapshot of cfg, so later changes to cfg do not affect it; see config.Config.Validate
+// to check the config for contradictions first.
 func NewWithConfig(cfg *config.Config) (*Parser, error) {
-	languageParser, err := NewParser(cfg.Language)
+	if err := cfg.Err(); err != nil {
+		return nil, &Error{Kind: ErrUnsupported, Err: err}
+	}
+	cfg = cfg.Freeze()
+	if cfg.OutputVersion < 0 || cfg.OutputVersion > config.LatestOutputVersion {
+		return nil, unsupportedf("unsupported output version: %d", cfg.OutputVersion)
+	}
+
+	languageParser, err := NewParserWithConfig(cfg.Language, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -102,7 +166,7 @@ func Parse(query string) (bson.M, error) {
 // For unstructured queries, the free text is searched across all provided defaultFields using regex.
 func ParseWithDefaults(defaultFields []string, query string) (bson.M, error) {
 	if len(defaultFields) == 0 {
-		return nil, fmt.Errorf("default fields cannot be empty")
+		return nil, unsupportedf("default fields cannot be empty")
 	}
 
 	// Create a parser with default fields configured
@@ -116,29 +180,98 @@ func ParseWithDefaults(defaultFields []string, query string) (bson.M, error) {
 }
 
 // Parse converts a query string into a BSON document.
+// Trailing directives (sort, limit, fields) are validated but only returned by ParseDetailed.
 func (p *Parser) Parse(query string) (bson.M, error) {
-	if strings.TrimSpace(query) == "" {
-		return bson.M{}, nil
+	return p.ParseContext(context.Background(), query)
+}
+
+// ParseContext is like Parse, but records its trace spans under the span in ctx.
+func (p *Parser) ParseContext(ctx context.Context, query string) (bson.M, error) {
+	result, err := p.ParseDetailedContext(ctx, query)
+	if err != nil {
+		return nil, err
 	}
+	return result.Filter, nil
+}
 
-	// Parse the query and let the formatter handle it
-	ast, err := p.languageParser.Parse(query)
+// ParseDetailed converts a query string into a complete find specification,
+// including the filter and any sort, limit and projection directives.
+// Errors are classified as an *Error; see ErrSyntax and the other categories.
+func (p *Parser) ParseDetailed(query string) (*ParseResult, error) {
+	return p.ParseDetailedContext(context.Background(), query)
+}
+
+// ParseDetailedContext is like ParseDetailed, but records its trace spans under the span in ctx.
+func (p *Parser) ParseDetailedContext(ctx context.Context, query string) (*ParseResult, error) {
+	p, err := p.current()
 	if err != nil {
 		return nil, err
 	}
+	return p.instrument(ctx, query, func(ctx context.Context) (*ParseResult, error) {
+		p := p.withSubqueries(ctx)
+		return guard(func() (*ParseResult, error) {
+			return p.parseDetailed(ctx, query, p.Config.DefaultFields, p.formatDefault)
+		})
+	})
+}
+
+// Capabilities reports the language features the parser's formatter supports with its configuration, so
+// frontends can hide syntax such as boosts or IN_QUERY that would fail with ErrUnsupportedByFormatter.
+func (p *Parser) Capabilities() (formatter.Capabilities, error) {
+	p, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	return p.formatter.Capabilities(), nil
+}
+
+// FormatAST formats an already parsed query, such as a *lucene.ParticipleQuery decoded from JSON,
+// into a complete find specification, as ParseDetailed does for a query string.
+func (p *Parser) FormatAST(ast interface{}) (*ParseResult, error) {
+	p, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	return guard(func() (*ParseResult, error) {
+		p := p.withSubqueries(context.Background())
+		return p.formatResult(ast, p.formatDefault)
+	})
+}
+
+// format converts an AST into BSON using the configured default fields.
+func (p *Parser) format(ast interface{}) (bson.M, error) {
+	result, err := p.formatDefault(ast)
+	if err != nil {
+		return nil, err
+	}
+	return result.Filter, nil
+}
+
+// formatDefault formats an AST using the configured default fields.
+func (p *Parser) formatDefault(ast interface{}) (*formatter.Result[bson.M], error) {
+	// MQL filters are already structured and never need default fields
+	if p.Config.Language == config.LanguageMQL {
+		return p.formatter.FormatResult(ast, formatter.Options{})
+	}
 
 	// Check if we have default fields configured
 	if len(p.Config.DefaultFields) > 0 {
 		// Use default fields for free text queries
-		mongoFormatter, ok := p.formatter.(*mongo.MongoFormatter)
-		if !ok {
-			return nil, fmt.Errorf("formatter is not a MongoFormatter")
-		}
-		return mongoFormatter.FormatWithDefaults(ast, p.Config.DefaultFields)
+		return p.formatter.FormatResult(ast, p.formatOptions(p.Config.DefaultFields))
+	}
+
+	// $text and Atlas Search do not need default fields for free text
+	if p.Config.LegacyText() || p.Config.TextSearchStrategy == config.StrategyTextIndex || p.Config.TextSearchStrategy == config.StrategyAtlasSearch {
+		return p.formatter.FormatResult(ast, formatter.Options{})
 	}
 
 	// If no default fields are configured, return an error
-	return nil, fmt.Errorf("no default fields are configured. Use ParseWithDefaults() or configure default fields in the parser config")
+	return nil, unsupportedf("no default fields are configured. Use ParseWithDefaults() or configure default fields in the parser config")
+}
+
+// formatOptions returns the formatter options for searching free text in the given default fields.
+func (p *Parser) formatOptions(defaultFields []string) formatter.Options {
+	return formatter.Options{DefaultFields: defaultFields, FieldWeights: p.Config.DefaultFieldWeights}
 }
 
 // ParseWithDefaults converts a query string into a BSON document using the provided default fields for unstructured queries.
@@ -146,25 +279,140 @@ func (p *Parser) Parse(query string) (bson.M, error) {
 // For unstructured queries, the free text is searched across all provided defaultFields using regex.
 func (p *Parser) ParseWithDefaults(defaultFields []string, query string) (bson.M, error) {
 	if len(defaultFields) == 0 {
-		return nil, fmt.Errorf("default fields cannot be empty")
+		return nil, unsupportedf("default fields cannot be empty")
+	}
+
+	p, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+
+	// Always use default fields for ParseWithDefaults
+	result, err := p.instrument(context.Background(), query, func(ctx context.Context) (*ParseResult, error) {
+		p := p.withSubqueries(ctx)
+		return guard(func() (*ParseResult, error) {
+			return p.parseDetailed(ctx, query, defaultFields, func(ast interface{}) (*formatter.Result[bson.M], error) {
+				return p.formatter.FormatResult(ast, p.formatOptions(defaultFields))
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
+	return result.Filter, nil
+}
+
+// formatFunc formats a parsed query, such as with the configured or given default fields.
+type formatFunc func(ast interface{}) (*formatter.Result[bson.M], error)
 
+// parseDetailed parses a query and formats it into a ParseResult, recording each phase as a trace span.
+func (p *Parser) parseDetailed(ctx context.Context, query string, defaultFields []string, format formatFunc) (*ParseResult, error) {
 	if strings.TrimSpace(query) == "" {
-		return bson.M{}, nil
+		return p.emptyResult(), nil
+	}
+	if err := p.checkQueryLength(query); err != nil {
+		return nil, err
 	}
 
-	// Parse the query and let the formatter handle it with default fields
-	ast, err := p.languageParser.Parse(query)
+	// Parse the query and let the formatter handle it
+	var ast interface{}
+	err := p.phase(ctx, "bsonic.parse.language", func() (err error) {
+		ast, err = p.parseLanguage(query)
+		return err
+	})
 	if err != nil {
+		return p.recover(query, defaultFields, format, err)
+	}
+
+	var result *ParseResult
+	err = p.phase(ctx, "bsonic.parse.format", func() (err error) {
+		result, err = p.formatResult(ast, format)
+		return err
+	})
+	if err != nil {
+		return p.recover(query, defaultFields, format, err)
+	}
+	return result, nil
+}
+
+// parseLanguage normalizes a query and parses it with the configured language.
+func (p *Parser) parseLanguage(query string) (interface{}, error) {
+	return p.languageParser.Parse(p.normalize(query))
+}
+
+// normalize returns a query in Unicode NFC, so composed and decomposed forms of the same text, such as café
+// written with a combining accent, parse identically. Lucene queries also have their curly quotes, full-width
+// colons and non-breaking spaces replaced with ASCII, as pasted from documents and chat apps.
+func (p *Parser) normalize(query string) string {
+	query = norm.NFC.String(query)
+	if p.Config.Language == config.LanguageLucene {
+		query = lucene.NormalizePunctuation(query)
+	}
+	return query
+}
+
+// formatResult formats a parsed query with the given function and collects the formatter's filter,
+// directives, highlights, stages and warnings, validating every referenced field.
+// With the Atlas Search strategy, the first pre-stage is the $search stage compiling free text;
+// with weighted default fields, the first post-stage is a relevance score stage.
+func (p *Parser) formatResult(ast interface{}, format formatFunc) (*ParseResult, error) {
+	formatted, err := format(ast)
+	if err != nil {
+		return nil, err
+	}
+	result := &ParseResult{Intent: IntentFind, Filter: formatted.Filter}
+	if spec, ok := formatted.Metadata[mongo.MetadataFindSpec].(*mongo.FindSpec); ok {
+		result.Collection = spec.Collection
+		result.Intent = spec.Intent
+		result.DistinctField = spec.DistinctField
+		result.Sort = spec.Sort
+		result.Limit = spec.Limit
+		result.Projection = spec.Projection
+		result.Options = spec.Options
+	}
+	if err := p.checkQueryOptions(result.Options); err != nil {
+		return nil, err
+	}
+	result.Highlights, _ = formatted.Metadata[mongo.MetadataHighlights].([]Highlight)
+	if len(formatted.PreStages) > 0 {
+		result.SearchStage = formatted.PreStages[0]
+	}
+	if len(formatted.PostStages) > 0 {
+		result.ScoreStage = formatted.PostStages[0]
+	}
+	for _, warning := range formatted.Warnings {
+		result.Warnings = append(result.Warnings, Warning{Err: errors.New(warning)})
+	}
+	p.renameDeprecatedFields(result)
+
+	if err := p.validateFields(result.Filter); err != nil {
+		return nil, err
+	}
+	if err := p.resolveConflicts(result); err != nil {
 		return nil, err
 	}
+	if p.Config.TextScore && hasTextSearch(result.Filter) {
+		result.TextScoreProjection = bson.M{TextScoreField: bson.M{"$meta": "textScore"}}
+		result.TextScoreSort = bson.D{{Key: TextScoreField, Value: bson.M{"$meta": "textScore"}}}
+	}
 
-	// Create a temporary formatter with the default fields
-	mongoFormatter, ok := p.formatter.(*mongo.MongoFormatter)
-	if !ok {
-		return nil, fmt.Errorf("formatter is not a MongoFormatter")
+	if err := p.validateResultFields(result); err != nil {
+		return nil, err
+	}
+	if err := p.applyAccess(result); err != nil {
+		return nil, err
+	}
+	if err := p.checkPolicy(result); err != nil {
+		return nil, err
 	}
 
-	// Always use default fields for ParseWithDefaults
-	return mongoFormatter.FormatWithDefaults(ast, defaultFields)
+	if !result.Options.IncludeDeleted {
+		result.Filter = p.applySoftDelete(result.Filter)
+	}
+	p.expandTimeBuckets(result.Filter)
+	p.applyForeignRefs(result)
+	if err := p.auditOperators(result); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
@@ -1,6 +1,8 @@
 package bsonic
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"testing"
 
@@ -105,6 +107,23 @@ func TestConfigMethods(t *testing.T) {
 	})
 }
 
+// TestConfigSnapshot tests that changing a config after creating a parser does not affect the parser
+func TestConfigSnapshot(t *testing.T) {
+	cfg := config.Default().WithDefaultFields([]string{"name"})
+	parser, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+	if !parser.Config.Frozen() {
+		t.Error("Expected the parser config to be frozen")
+	}
+
+	cfg.WithAllowedFields([]string{"title"})
+	if _, err := parser.Parse("name:john"); err != nil {
+		t.Errorf("Expected the parser to ignore later config changes, got: %v", err)
+	}
+}
+
 // TestErrorHandling tests additional error handling scenarios
 func TestErrorHandling(t *testing.T) {
 	// Test NewParser with unsupported language
@@ -142,6 +161,31 @@ func TestErrorHandling(t *testing.T) {
 	})
 }
 
+// TestGuard tests that panics are recovered and errors are classified
+func TestGuard(t *testing.T) {
+	t.Run("RecoversPanic", func(t *testing.T) {
+		_, err := guard(func() (bool, error) {
+			panic("boom")
+		})
+		if !errors.Is(err, ErrSyntax) || !strings.Contains(err.Error(), "boom") {
+			t.Fatalf("Expected recovered syntax error, got: %v", err)
+		}
+	})
+
+	t.Run("ClassifiesOnce", func(t *testing.T) {
+		_, err := guard(func() (bool, error) {
+			return false, unsupportedf("not supported")
+		})
+		var classified *Error
+		if !errors.As(err, &classified) || classified.Kind != ErrUnsupported {
+			t.Fatalf("Expected unsupported error, got: %v", err)
+		}
+		if classified.Err.Error() != "not supported" {
+			t.Fatalf("Expected error not to be wrapped twice, got: %v", classified.Err)
+		}
+	})
+}
+
 // TestEdgeCases tests additional edge cases for better coverage
 func TestEdgeCases(t *testing.T) {
 	// Test parser with no default fields configured
@@ -195,3 +239,62 @@ func TestEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+// TestCollectionHelpers tests the Find and Count helpers without a live collection
+func TestCollectionHelpers(t *testing.T) {
+	t.Run("InvalidQueryFailsBeforeExecution", func(t *testing.T) {
+		parser, _ := NewWithConfig(config.Default().WithDefaultFields([]string{"name"}))
+		if _, err := parser.Find(context.Background(), nil, "name:john AND"); err == nil {
+			t.Fatal("Find should return error for invalid query")
+		}
+		if _, err := parser.Count(context.Background(), nil, "name:john AND"); err == nil {
+			t.Fatal("Count should return error for invalid query")
+		}
+	})
+
+	t.Run("EffectiveLimit", func(t *testing.T) {
+		tests := []struct {
+			queryLimit int64
+			opts       []FindOption
+			expected   int64
+		}{
+			{0, nil, 0},
+			{10, nil, 10},
+			{0, []FindOption{WithDefaultLimit(20)}, 20},
+			{10, []FindOption{WithDefaultLimit(20)}, 10},
+			{0, []FindOption{WithMaxLimit(100)}, 100},
+			{500, []FindOption{WithMaxLimit(100)}, 100},
+			{50, []FindOption{WithDefaultLimit(20), WithMaxLimit(100)}, 50},
+		}
+
+		for _, test := range tests {
+			if limit := effectiveLimit(test.queryLimit, test.opts); limit != test.expected {
+				t.Fatalf("effectiveLimit(%d) expected %d, got %d", test.queryLimit, test.expected, limit)
+			}
+		}
+	})
+
+	t.Run("BroadMutationsFailBeforeExecution", func(t *testing.T) {
+		cfg := config.Default().WithDefaultFields([]string{"name"}).WithUnselectiveFields("status")
+		parser, _ := NewWithConfig(cfg)
+		ctx := context.Background()
+
+		if _, err := parser.DeleteMany(ctx, nil, ""); !errors.Is(err, ErrBroadFilter) || !errors.Is(err, ErrLimitExceeded) {
+			t.Fatalf("DeleteMany should refuse an empty query, got: %v", err)
+		}
+		for _, query := range []string{"*", "name:*"} {
+			if _, err := parser.DeleteMany(ctx, nil, query); !errors.Is(err, ErrBroadFilter) {
+				t.Fatalf("DeleteMany should refuse the match-all query %q, got: %v", query, err)
+			}
+		}
+		if _, err := parser.UpdateMany(ctx, nil, "status:stale", "SET status:archived"); !errors.Is(err, ErrBroadFilter) {
+			t.Fatalf("UpdateMany should refuse an unselective query, got: %v", err)
+		}
+		if _, err := parser.DeleteMany(ctx, nil, "status:stale | limit:10", WithAllowedBreadth(BreadthEmpty)); !errors.Is(err, ErrUnsupported) {
+			t.Fatalf("DeleteMany should refuse a limited query, got: %v", err)
+		}
+		if _, err := parser.UpdateMany(ctx, nil, "name:john", "SET"); !errors.Is(err, ErrSyntax) {
+			t.Fatalf("UpdateMany should refuse an invalid update, got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package bsonictest
+
+import (
+	"testing"
+
+	"github.com/kyle-williams-1/bsonic"
+	"github.com/kyle-williams-1/bsonic/bsonutil"
+	"github.com/kyle-williams-1/bsonic/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Option configures AssertQuery.
+type Option func(*assertOptions)
+
+type assertOptions struct {
+	parser        *bsonic.Parser
+	defaultFields []string
+}
+
+// WithParser parses the query with parser, so the assertion covers a service's config. Without it, queries are
+// parsed with the default config, searching free text in the fields of WithDefaultFields or, without them,
+// compiling it to a $text search.
+func WithParser(parser *bsonic.Parser) Option {
+	return func(o *assertOptions) {
+		o.parser = parser
+	}
+}
+
+// WithDefaultFields searches the free text of the query in fields, as ParseWithDefaults does.
+func WithDefaultFields(fields ...string) Option {
+	return func(o *assertOptions) {
+		o.defaultFields = fields
+	}
+}
+
+// parse parses a query with the configured parser and default fields
+func (o *assertOptions) parse(query string) (bson.M, error) {
+	switch {
+	case o.parser != nil && o.defaultFields != nil:
+		return o.parser.ParseWithDefaults(o.defaultFields, query)
+	case o.parser != nil:
+		return o.parser.Parse(query)
+	case o.defaultFields != nil:
+		return bsonic.ParseWithDefaults(o.defaultFields, query)
+	}
+
+	parser, err := bsonic.NewWithConfig(config.Default().WithTextSearchStrategy(config.StrategyTextIndex))
+	if err != nil {
+		return nil, err
+	}
+	return parser.Parse(query)
+}
+
+// AssertQuery parses a query and fails the test unless its filter equals the filter written as Extended JSON,
+// without a server, for concise compatibility tests of the queries a service relies on:
+//
+//	bsonictest.AssertQuery(t, "age:>=18", `{"age": {"$gte": 18}}`, bsonictest.WithParser(parser))
+//
+// Both sides are compared as BSON: documents regardless of key order, numbers by value regardless of type,
+// {"$regex": ..., "$options": ...} the same as a regex, and the clauses of $and, $or and $nor regardless of order.
+func AssertQuery(t testing.TB, query, expectedExtJSON string, opts ...Option) {
+	t.Helper()
+	options := &assertOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	filter, err := options.parse(query)
+	if err != nil {
+		t.Fatalf("Parse(%q) should not return error, got: %v", query, err)
+	}
+
+	var expected bson.Raw
+	if err := bson.UnmarshalExtJSON([]byte(expectedExtJSON), false, &expected); err != nil {
+		t.Fatalf("invalid expected Extended JSON %s: %v", expectedExtJSON, err)
+	}
+	actual, err := bson.Marshal(filter)
+	if err != nil {
+		t.Fatalf("cannot marshal the filter of %q: %v", query, err)
+	}
+
+	if !bsonutil.EqualRaw(actual, expected) {
+		got, _ := bson.MarshalExtJSON(filter, false, false)
+		t.Errorf("Parse(%q):\n  got      %s\n  expected %s", query, got, expected.String())
+	}
+}
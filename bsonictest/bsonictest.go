@@ -0,0 +1,145 @@
+// Package bsonictest runs table-driven compatibility tests of bsonic queries against a real MongoDB server,
+// started in a container with testcontainers-go or reached through MONGODB_URI. Each case pairs a query with
+// an equivalent filter written directly against the driver, so downstream projects can check that queries
+// mean what they say for their own schema and data.
+package bsonictest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/testcontainers/testcontainers-go/modules/mongodb"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// DefaultImage is the MongoDB image StartMongo runs when no image is given
+const DefaultImage = "mongo:7.0"
+
+// Server is a MongoDB server for tests.
+type Server struct {
+	// URI is the connection string of the server
+	URI string
+	// Client is connected to the server
+	Client    *mongo.Client
+	container *mongodb.MongoDBContainer
+}
+
+// StartMongo connects to the server at MONGODB_URI when it is set, and otherwise starts a MongoDB
+// container from image, or DefaultImage when image is empty, which needs a running Docker daemon.
+// Call Stop when done to disconnect and remove the container.
+func StartMongo(ctx context.Context, image string) (*Server, error) {
+	server := &Server{URI: os.Getenv("MONGODB_URI")}
+	if server.URI == "" {
+		if image == "" {
+			image = DefaultImage
+		}
+		container, err := mongodb.Run(ctx, image)
+		if err != nil {
+			return nil, fmt.Errorf("cannot start MongoDB container: %w", err)
+		}
+		server.container = container
+		if server.URI, err = container.ConnectionString(ctx); err != nil {
+			return nil, errors.Join(err, server.Stop(ctx))
+		}
+	}
+
+	client, err := mongo.Connect(options.Client().ApplyURI(server.URI))
+	if err != nil {
+		return nil, errors.Join(err, server.Stop(ctx))
+	}
+	server.Client = client
+	if err := client.Ping(ctx, nil); err != nil {
+		return nil, errors.Join(fmt.Errorf("cannot reach MongoDB at %s: %w", server.URI, err), server.Stop(ctx))
+	}
+	return server, nil
+}
+
+// Stop disconnects from the server and removes its container, if StartMongo started one
+func (s *Server) Stop(ctx context.Context) error {
+	var errs []error
+	if s.Client != nil {
+		errs = append(errs, s.Client.Disconnect(ctx))
+	}
+	if s.container != nil {
+		errs = append(errs, s.container.Terminate(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// Fixture is the seed data of one collection.
+type Fixture struct {
+	Documents []bson.D `bson:"documents"`
+	Indexes   []bson.D `bson:"indexes"`
+}
+
+// Seed loads every <collection>.json file in fsys into the collection of that name. A file holds relaxed
+// Extended JSON with the collection's "documents" and the key documents of its "indexes":
+//
+//	{"documents": [{"name": "John", "created_at": {"$date": "2023-01-15T10:30:00Z"}}], "indexes": [{"name": 1}]}
+//
+// Collections are dropped before they are loaded, so seeding is repeatable; never point it at real data.
+func Seed(ctx context.Context, db *mongo.Database, fsys fs.FS) error {
+	fixtures, err := ReadFixtures(fsys)
+	if err != nil {
+		return err
+	}
+	for name, f := range fixtures {
+		coll := db.Collection(name)
+		if err := coll.Drop(ctx); err != nil {
+			return fmt.Errorf("cannot drop %s: %w", name, err)
+		}
+		if len(f.Documents) > 0 {
+			if _, err := coll.InsertMany(ctx, f.Documents); err != nil {
+				return fmt.Errorf("cannot seed %s: %w", name, err)
+			}
+		}
+		for _, keys := range f.Indexes {
+			if _, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys}); err != nil {
+				return fmt.Errorf("cannot index %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Cleanup drops the collections of the fixture files in fsys, undoing Seed
+func Cleanup(ctx context.Context, db *mongo.Database, fsys fs.FS) error {
+	fixtures, err := ReadFixtures(fsys)
+	if err != nil {
+		return err
+	}
+	for name := range fixtures {
+		if err := db.Collection(name).Drop(ctx); err != nil {
+			return fmt.Errorf("cannot drop %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ReadFixtures reads the fixture files in fsys, in the format Seed loads, by collection name
+func ReadFixtures(fsys fs.FS) (map[string]Fixture, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	fixtures := make(map[string]Fixture, len(files))
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var f Fixture
+		if err := bson.UnmarshalExtJSON(data, false, &f); err != nil {
+			return nil, fmt.Errorf("invalid fixture %s: %w", file, err)
+		}
+		fixtures[strings.TrimSuffix(path.Base(file), ".json")] = f
+	}
+	return fixtures, nil
+}
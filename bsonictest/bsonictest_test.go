@@ -0,0 +1,170 @@
+package bsonictest
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/kyle-williams-1/bsonic"
+	"github.com/kyle-williams-1/bsonic/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// TestReadFixtures tests reading documents and indexes from Extended JSON fixture files
+func TestReadFixtures(t *testing.T) {
+	fsys := fstest.MapFS{
+		"users.json": {Data: []byte(`{"documents": [{"name": "John", "age": 30, "created_at": {"$date": "2023-01-15T10:30:00Z"}}], "indexes": [{"name": 1}]}`)},
+		"README.md":  {Data: []byte("not a fixture")},
+	}
+	fixtures, err := ReadFixtures(fsys)
+	if err != nil {
+		t.Fatalf("ReadFixtures should not return error, got: %v", err)
+	}
+	users, ok := fixtures["users"]
+	if len(fixtures) != 1 || !ok {
+		t.Fatalf("Expected only the users fixture, got %v", fixtures)
+	}
+
+	expected := bson.D{
+		{Key: "name", Value: "John"},
+		{Key: "age", Value: int32(30)},
+		{Key: "created_at", Value: bson.NewDateTimeFromTime(time.Date(2023, 1, 15, 10, 30, 0, 0, time.UTC))},
+	}
+	if len(users.Documents) != 1 || !reflect.DeepEqual(users.Documents[0], expected) {
+		t.Errorf("Expected %v, got %v", expected, users.Documents)
+	}
+	if !reflect.DeepEqual(users.Indexes, []bson.D{{{Key: "name", Value: int32(1)}}}) {
+		t.Errorf("Unexpected indexes: %v", users.Indexes)
+	}
+
+	if _, err := ReadFixtures(fstest.MapFS{"bad.json": {Data: []byte("{")}}); err == nil {
+		t.Error("Expected error for an invalid fixture")
+	}
+}
+
+// TestSemanticCases tests the queries and filters generated for each type of sampled value
+func TestSemanticCases(t *testing.T) {
+	created := time.Date(2023, 1, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		field   string
+		value   interface{}
+		queries []string
+	}{
+		{"name", "John Doe", []string{`name:"John Doe"`, `NOT name:"John Doe"`, "name:Joh*"}},
+		{"email", "j.doe@example.com", []string{`email:"j.doe@example.com"`, `NOT email:"j.doe@example.com"`, "email:j*"}},
+		{"role", "-", []string{`role:"-"`, `NOT role:"-"`}},
+		{"age", int32(30), []string{"age:30", "NOT age:30", "age:[30 TO 30]", "age:>=30", "age:<=30"}},
+		{"active", true, []string{"active:true", "NOT active:true"}},
+		{"created_at", created, []string{
+			"created_at:2023-01-15T10:30:00Z",
+			"NOT created_at:2023-01-15T10:30:00Z",
+			"created_at:[2023-01-15T10:30:00Z TO 2023-01-15T10:30:00Z]",
+			"created_at:[2023-01-15T10:30:00Z TO *]",
+			"created_at:[* TO 2023-01-15T10:30:00Z]",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			cases, err := semanticCases(tt.field, tt.value)
+			if err != nil {
+				t.Fatalf("semanticCases should not return error, got: %v", err)
+			}
+			var queries []string
+			for _, c := range cases {
+				queries = append(queries, c.Query)
+			}
+			if !reflect.DeepEqual(queries, tt.queries) {
+				t.Errorf("Expected queries %q, got %q", tt.queries, queries)
+			}
+		})
+	}
+
+	cases, _ := semanticCases("name", "John Doe")
+	if want := (bson.M{"name": bson.M{"$regex": "^Joh"}}); !reflect.DeepEqual(cases[2].Want, want) {
+		t.Errorf("Expected the wildcard case to want %v, got %v", want, cases[2].Want)
+	}
+	if cases[0].AllowEmpty || !cases[1].AllowEmpty {
+		t.Error("Expected only the negation to allow matching nothing")
+	}
+}
+
+// recordingT records the failures of an assertion instead of failing the test
+type recordingT struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingT) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// assertFailures runs AssertQuery and returns its failures
+func assertFailures(query, expected string, opts ...Option) []string {
+	r := &recordingT{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		AssertQuery(r, query, expected, opts...)
+	}()
+	<-done
+	return r.failures
+}
+
+// TestAssertQuery tests comparing parsed filters with Extended JSON
+func TestAssertQuery(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(config.Default().WithDefaultFields([]string{"name"}))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	passing := []struct {
+		query    string
+		expected string
+		opts     []Option
+	}{
+		{"age:>=18", `{"age": {"$gte": 18}}`, nil},
+		{"age:[18 TO 30]", `{"age": {"$lte": {"$numberLong": "30"}, "$gte": 18.0}}`, nil},
+		{"name:jo*", `{"name": {"$regex": "^jo.*"}}`, nil},
+		{"name:jo*", `{"name": {"$regularExpression": {"pattern": "^jo.*", "options": ""}}}`, nil},
+		{"john", `{"$text": {"$search": "john"}}`, nil},
+		{"created_at:2024-01-15", `{"created_at": {"$date": "2024-01-15T00:00:00Z"}}`, nil},
+		{"role:admin OR role:user OR age:30", `{"$or": [{"age": 30}, {"role": "user"}, {"role": "admin"}]}`, nil},
+		{"john", `{"name": {"$regex": "^john$", "$options": "i"}}`, []Option{WithParser(parser)}},
+		{"john", `{"email": {"$regex": "^john$", "$options": "i"}}`, []Option{WithDefaultFields("email")}},
+	}
+	for _, tt := range passing {
+		if failures := assertFailures(tt.query, tt.expected, tt.opts...); len(failures) > 0 {
+			t.Errorf("Expected %q to equal %s, got failures %v", tt.query, tt.expected, failures)
+		}
+	}
+
+	failing := []struct {
+		query    string
+		expected string
+		want     string
+	}{
+		{"age:>=18", `{"age": {"$gt": 18}}`, `got      {"age":{"$gte":`},
+		{"age:18", `{"age": "18"}`, "expected"},
+		{"name:jo*", `{"name": {"$regex": "^jo.*", "$options": "i"}}`, "expected"},
+		{"name:john AND age:18", `{"name": "john"}`, "expected"},
+		{"tags:[a TO", `{}`, "should not return error"},
+		{"name:john", `{"name": `, "invalid expected Extended JSON"},
+	}
+	for _, tt := range failing {
+		failures := assertFailures(tt.query, tt.expected)
+		if len(failures) != 1 || !strings.Contains(failures[0], tt.want) {
+			t.Errorf("Expected %q against %s to fail with %q, got %v", tt.query, tt.expected, tt.want, failures)
+		}
+	}
+}
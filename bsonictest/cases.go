@@ -0,0 +1,220 @@
+package bsonictest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/kyle-williams-1/bsonic"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Case is a query and an equivalent filter written directly against the driver. The case passes when the
+// query matches exactly the documents the filter matches.
+type Case struct {
+	// Name names the subtest; it defaults to the query
+	Name  string
+	Query string
+	// Want is the filter the query must be equivalent to
+	Want bson.M
+	// WantErr, when set, is the error kind the query must fail with, such as bsonic.ErrSyntax, and Want is ignored
+	WantErr error
+	// AllowEmpty accepts a Want that matches no documents, which otherwise fails the case because it checks nothing
+	AllowEmpty bool
+}
+
+// Run runs each case as a subtest, executing the query with parser.Find and Want with the driver, and
+// reports the documents only one of them matched by _id
+func Run(t *testing.T, parser *bsonic.Parser, coll *mongo.Collection, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		name := c.Name
+		if name == "" {
+			name = c.Query
+		}
+		t.Run(name, func(t *testing.T) {
+			ctx := t.Context()
+			cursor, err := parser.Find(ctx, coll, c.Query)
+			if c.WantErr != nil {
+				if !errors.Is(err, c.WantErr) {
+					t.Fatalf("Find(%q): expected %v, got %v", c.Query, c.WantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Find(%q) should not return error, got: %v", c.Query, err)
+			}
+			got, err := matchedIDs(ctx, cursor)
+			if err != nil {
+				t.Fatalf("Find(%q) failed: %v", c.Query, err)
+			}
+
+			cursor, err = coll.Find(ctx, c.Want)
+			if err != nil {
+				t.Fatalf("Find(%v) should not return error, got: %v", c.Want, err)
+			}
+			want, err := matchedIDs(ctx, cursor)
+			if err != nil {
+				t.Fatalf("Find(%v) failed: %v", c.Want, err)
+			}
+
+			if len(want) == 0 && !c.AllowEmpty {
+				t.Errorf("%v matches no documents, so the case checks nothing", c.Want)
+			}
+			if missing, extra := difference(want, got), difference(got, want); len(missing) > 0 || len(extra) > 0 {
+				filter, _ := parser.Parse(c.Query)
+				t.Errorf("%s: generated filter %v\n  missing %v\n  extra %v\n  expected the documents matching %v",
+					c.Query, filter, missing, extra, c.Want)
+			}
+		})
+	}
+}
+
+// matchedIDs returns the _id of every document in a cursor as Extended JSON, so any _id type compares
+func matchedIDs(ctx context.Context, cursor *mongo.Cursor) (map[string]bool, error) {
+	defer cursor.Close(ctx)
+	ids := map[string]bool{}
+	for cursor.Next(ctx) {
+		id, err := cursor.Current.LookupErr("_id")
+		if err != nil {
+			return nil, fmt.Errorf("document without _id: %w", err)
+		}
+		ids[id.String()] = true
+	}
+	return ids, cursor.Err()
+}
+
+// difference returns the sorted ids in a but not in b
+func difference(a, b map[string]bool) []string {
+	var ids []string
+	for id := range a {
+		if !b[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Semantics samples a value of each field from the collection and returns cases asserting how bsonic
+// queries behave for it: equality and negation for every field, ranges and inclusive comparisons for
+// numbers and dates, and prefix wildcards for strings, plus AND and OR of the first field with each other
+// field. Arrays are sampled by their first element. Each query is built with bsonic's query builder, so the
+// cases run with any parser whose config does not change the meaning of plain field queries, for example
+// with field type coercion or aliases.
+func Semantics(ctx context.Context, coll *mongo.Collection, fields ...string) ([]Case, error) {
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		value, err := sample(ctx, coll, field)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	var cases []Case
+	for i, field := range fields {
+		fieldCases, err := semanticCases(field, values[i])
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, fieldCases...)
+	}
+	for i := 1; i < len(fields); i++ {
+		first, other := bsonic.Field(fields[0]).Eq(values[0]), bsonic.Field(fields[i]).Eq(values[i])
+		firstWant, otherWant := bson.M{fields[0]: values[0]}, bson.M{fields[i]: values[i]}
+		cases = append(cases,
+			Case{Query: first.And(other).String(), Want: bson.M{"$and": bson.A{firstWant, otherWant}}, AllowEmpty: true},
+			Case{Query: first.Or(other).String(), Want: bson.M{"$or": bson.A{firstWant, otherWant}}},
+		)
+	}
+	return cases, nil
+}
+
+// sample returns a value of a field from a document where it is set, converted to the Go type the
+// query builder takes
+func sample(ctx context.Context, coll *mongo.Collection, field string) (interface{}, error) {
+	doc, err := coll.FindOne(ctx, bson.M{field: bson.M{"$exists": true, "$ne": nil}}).Raw()
+	if err != nil {
+		return nil, fmt.Errorf("cannot sample %s: %w", field, err)
+	}
+	value, err := doc.LookupErr(strings.Split(field, ".")...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot sample %s: %w", field, err)
+	}
+	if array, ok := value.ArrayOK(); ok {
+		elements, err := array.Values()
+		if err != nil || len(elements) == 0 {
+			return nil, fmt.Errorf("cannot sample %s: the sampled array is empty", field)
+		}
+		value = elements[0]
+	}
+
+	switch value.Type {
+	case bson.TypeString:
+		return value.StringValue(), nil
+	case bson.TypeInt32:
+		return value.Int32(), nil
+	case bson.TypeInt64:
+		return value.Int64(), nil
+	case bson.TypeDouble:
+		return value.Double(), nil
+	case bson.TypeBoolean:
+		return value.Boolean(), nil
+	case bson.TypeDateTime:
+		return value.Time().UTC(), nil
+	case bson.TypeObjectID:
+		return value.ObjectID(), nil
+	}
+	return nil, fmt.Errorf("cannot sample %s: values of type %s are not supported", field, value.Type)
+}
+
+// semanticCases returns the cases for a single field and a sampled value
+func semanticCases(field string, value interface{}) ([]Case, error) {
+	f := bsonic.Field(field)
+	eq := f.Eq(value)
+	if err := eq.Err(); err != nil {
+		return nil, err
+	}
+	cases := []Case{
+		{Query: eq.String(), Want: bson.M{field: value}},
+		{Query: bsonic.Not(eq).String(), Want: bson.M{field: bson.M{"$ne": value}}, AllowEmpty: true},
+	}
+
+	switch v := value.(type) {
+	case string:
+		if prefix := wildcardPrefix(v); prefix != "" {
+			cases = append(cases, Case{
+				Query: f.Wildcard(prefix + "*").String(),
+				Want:  bson.M{field: bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}},
+			})
+		}
+	case int32, int64, float64, time.Time:
+		cases = append(cases,
+			Case{Query: f.Between(value, value).String(), Want: bson.M{field: bson.M{"$gte": value, "$lte": value}}},
+			Case{Query: f.Gte(value).String(), Want: bson.M{field: bson.M{"$gte": value}}},
+			Case{Query: f.Lte(value).String(), Want: bson.M{field: bson.M{"$lte": value}}},
+		)
+	}
+	return cases, nil
+}
+
+// wildcardPrefix returns up to the first three letters and digits of a string, stopping at any other
+// character, for a prefix wildcard that matches the string
+func wildcardPrefix(s string) string {
+	var b strings.Builder
+	for i, r := range []rune(s) {
+		if i == 3 || !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
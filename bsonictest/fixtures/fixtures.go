@@ -0,0 +1,82 @@
+// Package fixtures is the sample dataset bsonic's integration tests and examples run against: users,
+// products and orders with nested documents, arrays, dates and indexes. Downstream projects can load it to
+// try queries against known data, or compare their own results with bsonic's.
+package fixtures
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"testing"
+
+	"github.com/kyle-williams-1/bsonic/bsonictest"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Collection names of the dataset
+const (
+	Users    = "users"
+	Products = "products"
+	Orders   = "orders"
+)
+
+//go:embed data/*.json
+var data embed.FS
+
+// FS returns the dataset as one <collection>.json file per collection, in the format bsonictest.Seed loads
+func FS() fs.FS {
+	fsys, err := fs.Sub(data, "data")
+	if err != nil {
+		panic(err)
+	}
+	return fsys
+}
+
+// Collections returns the names of the dataset's collections, sorted
+func Collections() []string {
+	names, _ := fs.Glob(data, "data/*.json")
+	for i, name := range names {
+		names[i] = name[len("data/") : len(name)-len(".json")]
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Documents returns the documents of a collection of the dataset, for checking query results without a server
+func Documents(collection string) ([]bson.D, error) {
+	fixtures, err := bsonictest.ReadFixtures(FS())
+	if err != nil {
+		return nil, err
+	}
+	fixture, ok := fixtures[collection]
+	if !ok {
+		return nil, fmt.Errorf("no fixture collection %q", collection)
+	}
+	return fixture.Documents, nil
+}
+
+// Load seeds db with the dataset, replacing any collections of the same names
+func Load(ctx context.Context, db *mongo.Database) error {
+	return bsonictest.Seed(ctx, db, FS())
+}
+
+// Cleanup drops the dataset's collections from db
+func Cleanup(ctx context.Context, db *mongo.Database) error {
+	return bsonictest.Cleanup(ctx, db, FS())
+}
+
+// Setup loads the dataset into db for a test and drops it again when the test and its subtests finish
+func Setup(t testing.TB, db *mongo.Database) {
+	t.Helper()
+	if err := Load(t.Context(), db); err != nil {
+		t.Fatalf("cannot load fixtures: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := Cleanup(context.Background(), db); err != nil {
+			t.Errorf("cannot clean up fixtures: %v", err)
+		}
+	})
+}
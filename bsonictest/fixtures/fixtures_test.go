@@ -0,0 +1,36 @@
+package fixtures
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestCollections tests that every fixture file is a collection of the dataset
+func TestCollections(t *testing.T) {
+	expected := []string{Orders, Products, Users}
+	if collections := Collections(); !reflect.DeepEqual(collections, expected) {
+		t.Errorf("Expected %v, got %v", expected, collections)
+	}
+}
+
+// TestDocuments tests reading the documents of a collection
+func TestDocuments(t *testing.T) {
+	counts := map[string]int{Users: 5, Products: 3, Orders: 2}
+	for collection, count := range counts {
+		docs, err := Documents(collection)
+		if err != nil {
+			t.Fatalf("Documents(%s) should not return error, got: %v", collection, err)
+		}
+		if len(docs) != count {
+			t.Errorf("Expected %d %s, got %d", count, collection, len(docs))
+		}
+	}
+
+	users, _ := Documents(Users)
+	if name := users[0][1]; name.Key != "name" || name.Value != "John Doe" {
+		t.Errorf("Expected John Doe first, got %v", users[0])
+	}
+	if _, err := Documents("missing"); err == nil {
+		t.Error("Expected error for an unknown collection")
+	}
+}
@@ -0,0 +1,106 @@
+// Package bsonutil compares BSON values the way tests of parsed queries need to: documents regardless of the
+// order of their keys, and the clauses of $and, $or and $nor regardless of their order, which does not change
+// what a filter matches.
+package bsonutil
+
+import (
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Equal reports whether two values built in Go, such as parsed filters, are equal. Documents (bson.M) are equal
+// when they hold the same keys with equal values, and the clauses of $and, $or and $nor are compared regardless
+// of order. Times are compared with time.Time.Equal. Other arrays, ordered documents (bson.D) and all other
+// values must match exactly, including their types, so an int does not equal a float64.
+func Equal(a, b interface{}) bool {
+	return equal("", a, b)
+}
+
+// equal compares two values held under key
+func equal(key string, a, b interface{}) bool {
+	switch av := a.(type) {
+	case time.Time:
+		bv, ok := b.(time.Time)
+		return ok && av.Equal(bv)
+	case bson.M:
+		bv, ok := b.(bson.M)
+		return ok && equalMaps(av, bv)
+	case bson.D:
+		bv, ok := b.(bson.D)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if av[i].Key != bv[i].Key || !equal(av[i].Key, av[i].Value, bv[i].Value) {
+				return false
+			}
+		}
+		return true
+	case []bson.M:
+		bv, ok := b.([]bson.M)
+		return ok && equalSlices(key, av, bv)
+	case bson.A:
+		bv, ok := b.(bson.A)
+		return ok && equalSlices(key, av, bv)
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		return ok && equalSlices(key, av, bv)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// equalMaps reports whether two documents hold the same keys with equal values
+func equalMaps(a, b bson.M) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		other, ok := b[key]
+		if !ok || !equal(key, value, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalSlices compares two arrays held under key, in order unless they are the clauses of a logical operator
+func equalSlices[T any](key string, a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	if isLogical(key) {
+		return equalUnordered(len(a), func(i, j int) bool { return equal("", a[i], b[j]) })
+	}
+	for i := range a {
+		if !equal("", a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalUnordered reports whether each of n values of one array equals a distinct one of n values of another,
+// as compared by eq
+func equalUnordered(n int, eq func(i, j int) bool) bool {
+	matched := make([]bool, n)
+	for i := 0; i < n; i++ {
+		found := false
+		for j := 0; j < n; j++ {
+			if !matched[j] && eq(i, j) {
+				matched[j], found = true, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// isLogical reports whether key is an operator whose clauses can be in any order
+func isLogical(key string) bool {
+	return key == "$and" || key == "$or" || key == "$nor"
+}
@@ -0,0 +1,80 @@
+package bsonutil
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// TestEqual tests comparing values built in Go
+func TestEqual(t *testing.T) {
+	created := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		a, b  interface{}
+		equal bool
+	}{
+		{"Documents", bson.M{"name": "john", "age": 30}, bson.M{"age": 30, "name": "john"}, true},
+		{"MissingKey", bson.M{"name": "john"}, bson.M{"name": "john", "age": 30}, false},
+		{"NumberTypes", bson.M{"age": 30}, bson.M{"age": 30.0}, false},
+		{"Times", created, created.In(time.FixedZone("EST", -5*3600)), true},
+		{"OrUnordered", bson.M{"$or": []bson.M{{"a": 1}, {"b": 2}}}, bson.M{"$or": []bson.M{{"b": 2}, {"a": 1}}}, true},
+		{"AndUnordered", bson.M{"$and": bson.A{bson.M{"a": 1}, bson.M{"b": 2}}}, bson.M{"$and": bson.A{bson.M{"b": 2}, bson.M{"a": 1}}}, true},
+		{"NorNested", bson.M{"$nor": []bson.M{{"$or": []bson.M{{"a": 1}, {"b": 2}}}, {"c": 3}}},
+			bson.M{"$nor": []bson.M{{"c": 3}, {"$or": []bson.M{{"b": 2}, {"a": 1}}}}}, true},
+		{"OrDuplicates", bson.M{"$or": []bson.M{{"a": 1}, {"a": 1}}}, bson.M{"$or": []bson.M{{"a": 1}, {"b": 2}}}, false},
+		{"InOrdered", bson.M{"a": bson.M{"$in": []interface{}{1, 2}}}, bson.M{"a": bson.M{"$in": []interface{}{2, 1}}}, false},
+		{"ArrayTypes", []bson.M{{"a": 1}}, bson.A{bson.M{"a": 1}}, false},
+		{"SortOrdered", bson.D{{Key: "a", Value: 1}, {Key: "b", Value: -1}}, bson.D{{Key: "b", Value: -1}, {Key: "a", Value: 1}}, false},
+		{"Regex", bson.M{"a": bson.Regex{Pattern: "^jo", Options: "i"}}, bson.M{"a": bson.Regex{Pattern: "^jo", Options: "i"}}, true},
+		{"Strings", []string{"a", "b"}, []string{"a", "b"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Equal(tt.a, tt.b); got != tt.equal {
+				t.Errorf("Equal(%v, %v) = %v, expected %v", tt.a, tt.b, got, tt.equal)
+			}
+			if got := Equal(tt.b, tt.a); got != tt.equal {
+				t.Errorf("Equal(%v, %v) = %v, expected %v", tt.b, tt.a, got, tt.equal)
+			}
+		})
+	}
+}
+
+// TestEqualRaw tests comparing marshaled documents with documents decoded from Extended JSON
+func TestEqualRaw(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   bson.M
+		extJSON  string
+		expected bool
+	}{
+		{"Numbers", bson.M{"age": bson.M{"$gte": 18.0, "$lte": int64(30)}}, `{"age": {"$lte": 30, "$gte": 18}}`, true},
+		{"Regex", bson.M{"name": bson.M{"$regex": "^jo", "$options": "mi"}}, `{"name": {"$regularExpression": {"pattern": "^jo", "options": "im"}}}`, true},
+		{"RegexPattern", bson.M{"name": bson.M{"$regex": "^jo"}}, `{"name": {"$regex": "^ja"}}`, false},
+		{"Dates", bson.M{"at": time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)}, `{"at": {"$date": "2024-01-15T00:00:00Z"}}`, true},
+		{"OrUnordered", bson.M{"$or": []bson.M{{"a": "x"}, {"b": "y"}}}, `{"$or": [{"b": "y"}, {"a": "x"}]}`, true},
+		{"InOrdered", bson.M{"a": bson.M{"$in": bson.A{"x", "y"}}}, `{"a": {"$in": ["y", "x"]}}`, false},
+		{"Types", bson.M{"age": "18"}, `{"age": 18}`, false},
+		{"ExtraKey", bson.M{"a": "x", "b": "y"}, `{"a": "x"}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := bson.Marshal(tt.filter)
+			if err != nil {
+				t.Fatalf("Marshal should not return error, got: %v", err)
+			}
+			var expected bson.Raw
+			if err := bson.UnmarshalExtJSON([]byte(tt.extJSON), false, &expected); err != nil {
+				t.Fatalf("UnmarshalExtJSON should not return error, got: %v", err)
+			}
+			if got := EqualRaw(actual, expected); got != tt.expected {
+				t.Errorf("EqualRaw(%v, %s) = %v, expected %v", tt.filter, tt.extJSON, got, tt.expected)
+			}
+			if got := EqualRaw(expected, actual); got != tt.expected {
+				t.Errorf("EqualRaw(%s, %v) = %v, expected %v", tt.extJSON, tt.filter, got, tt.expected)
+			}
+		})
+	}
+}
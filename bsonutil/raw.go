@@ -0,0 +1,116 @@
+package bsonutil
+
+import (
+	"bytes"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// EqualRaw reports whether two marshaled documents are equal, such as a parsed filter and one decoded from
+// Extended JSON. Documents are compared regardless of key order and the clauses of $and, $or and $nor regardless
+// of order, like Equal. Since Extended JSON does not say whether 18 is an int32 or a double, numbers are compared
+// by value regardless of type, and a {"$regex": ..., "$options": ...} document equals the regex it describes.
+func EqualRaw(a, b bson.Raw) bool {
+	aElements, err := a.Elements()
+	if err != nil {
+		return false
+	}
+	bElements, err := b.Elements()
+	if err != nil || len(aElements) != len(bElements) {
+		return false
+	}
+
+	for _, element := range aElements {
+		other, err := b.LookupErr(element.Key())
+		if err != nil || !equalValues(element.Key(), element.Value(), other) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalValues reports whether two values under key are equal
+func equalValues(key string, a, b bson.RawValue) bool {
+	if aPattern, aOptions, ok := regexValue(a); ok {
+		bPattern, bOptions, ok := regexValue(b)
+		return ok && aPattern == bPattern && sortedOptions(aOptions) == sortedOptions(bOptions)
+	}
+	if aNumber, ok := numberValue(a); ok {
+		bNumber, ok := numberValue(b)
+		return ok && aNumber == bNumber
+	}
+	if a.Type != b.Type {
+		return false
+	}
+
+	switch a.Type {
+	case bson.TypeEmbeddedDocument:
+		return EqualRaw(a.Document(), b.Document())
+	case bson.TypeArray:
+		aValues, aErr := a.Array().Values()
+		bValues, bErr := b.Array().Values()
+		if aErr != nil || bErr != nil || len(aValues) != len(bValues) {
+			return false
+		}
+		if isLogical(key) {
+			return equalUnordered(len(aValues), func(i, j int) bool { return equalValues("", aValues[i], bValues[j]) })
+		}
+		for i := range aValues {
+			if !equalValues("", aValues[i], bValues[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return bytes.Equal(a.Value, b.Value)
+}
+
+// regexValue returns the pattern and options of a regex, or of a {"$regex": ..., "$options": ...} document
+func regexValue(v bson.RawValue) (pattern, options string, ok bool) {
+	switch v.Type {
+	case bson.TypeRegex:
+		pattern, options = v.Regex()
+		return pattern, options, true
+	case bson.TypeEmbeddedDocument:
+		elements, err := v.Document().Elements()
+		if err != nil || len(elements) == 0 || len(elements) > 2 {
+			return "", "", false
+		}
+		for _, element := range elements {
+			value, isString := element.Value().StringValueOK()
+			switch {
+			case !isString:
+				return "", "", false
+			case element.Key() == "$regex":
+				pattern, ok = value, true
+			case element.Key() == "$options":
+				options = value
+			default:
+				return "", "", false
+			}
+		}
+		return pattern, options, ok
+	}
+	return "", "", false
+}
+
+// sortedOptions returns regex options in order, since their order does not change the regex
+func sortedOptions(options string) string {
+	b := []byte(options)
+	slices.Sort(b)
+	return string(b)
+}
+
+// numberValue returns the value of an int32, int64 or double
+func numberValue(v bson.RawValue) (float64, bool) {
+	switch v.Type {
+	case bson.TypeInt32:
+		return float64(v.Int32()), true
+	case bson.TypeInt64:
+		return float64(v.Int64()), true
+	case bson.TypeDouble:
+		return v.Double(), true
+	}
+	return 0, false
+}
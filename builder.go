@@ -0,0 +1,347 @@
+package bsonic
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Clause is a query condition built programmatically, such as
+//
+//	bsonic.Field("age").Gte(18).And(bsonic.Field("role").Eq("admin"))
+//
+// Clauses build the same AST as the equivalent query string, so they format to the same BSON and can be
+// combined with parsed user input from Raw. An invalid value makes the whole clause invalid; the error
+// is returned by Parser.Build.
+type Clause struct {
+	expr *lucene.ParticipleExpression
+	err  error
+}
+
+// FieldRef builds clauses on a single field. Create one with Field.
+type FieldRef struct {
+	name string
+	err  error
+}
+
+// wildcardPattern matches wildcard patterns the query syntax can express without quoting
+var wildcardPattern = regexp.MustCompile(`^[^\s:()\[\]"'\\/|<>][^\s:()\[\]"'\\|]*$`)
+
+// Field starts a clause on the named field.
+func Field(name string) *FieldRef {
+	// Other characters are escaped when the clause is written as a query string
+	if name == "" || strings.ContainsAny(name, "\r\n") {
+		return &FieldRef{name: name, err: fmt.Errorf("invalid field name %q", name)}
+	}
+	return &FieldRef{name: name}
+}
+
+// Eq matches documents where the field equals value. Strings are matched literally, never as
+// wildcards, ranges or numbers; numbers, booleans, times and ObjectIDs are matched as those types.
+func (f *FieldRef) Eq(value interface{}) *Clause {
+	if s, ok := value.(string); ok {
+		return f.clause(&lucene.ParticipleValue{String: &s}, nil)
+	}
+	if t, ok := value.(time.Time); ok {
+		formatted := t.UTC().Format(time.RFC3339Nano)
+		return f.clause(&lucene.ParticipleValue{DateTime: &formatted}, nil)
+	}
+	term, err := builderTerm(value)
+	return f.clause(&lucene.ParticipleValue{TextTerms: []string{term}}, err)
+}
+
+// In matches documents where the field equals any of values, as Eq does for each value.
+func (f *FieldRef) In(values ...interface{}) *Clause {
+	if len(values) == 0 {
+		return &Clause{err: fmt.Errorf("In on field %s needs at least one value", f.name)}
+	}
+	clause := f.Eq(values[0])
+	for _, value := range values[1:] {
+		clause = clause.Or(f.Eq(value))
+	}
+	return clause
+}
+
+// Gt matches documents where the field is greater than a number or time.
+func (f *FieldRef) Gt(value interface{}) *Clause {
+	return f.compare(">", value)
+}
+
+// Gte matches documents where the field is greater than or equal to a number or time.
+func (f *FieldRef) Gte(value interface{}) *Clause {
+	return f.compare(">=", value)
+}
+
+// Lt matches documents where the field is less than a number or time.
+func (f *FieldRef) Lt(value interface{}) *Clause {
+	return f.compare("<", value)
+}
+
+// Lte matches documents where the field is less than or equal to a number or time.
+func (f *FieldRef) Lte(value interface{}) *Clause {
+	return f.compare("<=", value)
+}
+
+// Between matches documents where the field is within an inclusive range of numbers or times,
+// written [low TO high]. A nil bound leaves that side of the range open.
+func (f *FieldRef) Between(low, high interface{}) *Clause {
+	bounds := make([]string, 2)
+	for i, value := range []interface{}{low, high} {
+		if value == nil {
+			bounds[i] = "*"
+			continue
+		}
+		bound, err := builderBound(value)
+		if err != nil {
+			return f.unsupported(err)
+		}
+		bounds[i] = bound
+	}
+	bracketed := "[" + bounds[0] + " TO " + bounds[1] + "]"
+	return f.clause(&lucene.ParticipleValue{Bracketed: &bracketed}, nil)
+}
+
+// Wildcard matches documents where the field matches a pattern with * and ? wildcards, such as john*.
+func (f *FieldRef) Wildcard(pattern string) *Clause {
+	if !wildcardPattern.MatchString(pattern) {
+		return &Clause{err: fmt.Errorf("invalid wildcard pattern %q for field %s", pattern, f.name)}
+	}
+	return f.clause(&lucene.ParticipleValue{TextTerms: []string{pattern}}, nil)
+}
+
+// Regex matches documents where the whole field value matches a regular expression.
+func (f *FieldRef) Regex(pattern string) *Clause {
+	if _, err := regexp.Compile(pattern); err != nil {
+		return &Clause{err: fmt.Errorf("invalid regex for field %s: %w", f.name, err)}
+	}
+	regex := "/" + escapeSlashes(pattern) + "/"
+	return f.clause(&lucene.ParticipleValue{Regex: &regex}, nil)
+}
+
+// compare builds a comparison. Times with a time of day cannot be written after a comparison
+// operator, so inclusive comparisons on them are built as open ranges instead.
+func (f *FieldRef) compare(operator string, value interface{}) *Clause {
+	bound, err := builderBound(value)
+	if err != nil {
+		return f.unsupported(err)
+	}
+	if strings.Contains(bound, ":") {
+		switch operator {
+		case ">=":
+			return f.Between(value, nil)
+		case "<=":
+			return f.Between(nil, value)
+		}
+	}
+	term := operator + bound
+	return f.clause(&lucene.ParticipleValue{TextTerms: []string{term}}, nil)
+}
+
+func (f *FieldRef) clause(value *lucene.ParticipleValue, err error) *Clause {
+	if f.err != nil {
+		return &Clause{err: f.err}
+	}
+	if err != nil {
+		return f.unsupported(err)
+	}
+	return operandClause(&lucene.ParticipleOperand{
+		Term: &lucene.ParticipleTerm{FieldValue: &lucene.ParticipleFieldValue{Field: f.name, Value: value}},
+	})
+}
+
+// unsupported returns an invalid clause for a value the query syntax cannot express
+func (f *FieldRef) unsupported(err error) *Clause {
+	if f.err != nil {
+		return &Clause{err: f.err}
+	}
+	return &Clause{err: unsupportedf("field %s: %v", f.name, err)}
+}
+
+// Text matches free text across the default fields, as a quoted phrase.
+func Text(text string) *Clause {
+	return operandClause(&lucene.ParticipleOperand{
+		Term: &lucene.ParticipleTerm{FreeText: &lucene.ParticipleFreeText{
+			QuotedValue: &lucene.ParticipleQuotedValue{String: &text},
+		}},
+	})
+}
+
+// Raw parses a query string, such as user input, into a clause that can be combined with built ones.
+// Intent prefixes and directives are not allowed.
+func Raw(query string) *Clause {
+	if strings.TrimSpace(query) == "" {
+		return &Clause{err: fmt.Errorf("empty query")}
+	}
+
+	ast, err := guard(func() (interface{}, error) {
+		return lucene.New().Parse(lucene.NormalizePunctuation(norm.NFC.String(query)))
+	})
+	if err != nil {
+		return &Clause{err: err}
+	}
+	q := ast.(*lucene.ParticipleQuery)
+	if len(q.Options) > 0 || q.Collection != "" || q.Intent != nil || len(q.Directives) > 0 {
+		return &Clause{err: unsupportedf("clauses cannot have query options, routing or intent prefixes or directives: %s", query)}
+	}
+	return &Clause{expr: q.Expression}
+}
+
+// Not negates a clause.
+func Not(c *Clause) *Clause {
+	if c.err != nil {
+		return c
+	}
+
+	operand := &lucene.ParticipleOperand{Term: &lucene.ParticipleTerm{Group: &lucene.ParticipleGroup{Expression: c.expr}}}
+	if len(c.expr.Or) == 1 && len(c.expr.Or[0].And) == 1 {
+		operand = c.expr.Or[0].And[0]
+	}
+	return operandClause(&lucene.ParticipleOperand{Not: operand})
+}
+
+// And combines the clause with others using AND.
+func (c *Clause) And(others ...*Clause) *Clause {
+	return c.combine(others, andExpressions)
+}
+
+// Or combines the clause with others using OR.
+func (c *Clause) Or(others ...*Clause) *Clause {
+	return c.combine(others, orExpressions)
+}
+
+func (c *Clause) combine(others []*Clause, join func([]*lucene.ParticipleExpression) *lucene.ParticipleExpression) *Clause {
+	expressions := []*lucene.ParticipleExpression{c.expr}
+	for _, clause := range append([]*Clause{c}, others...) {
+		if clause.err != nil {
+			return &Clause{err: clause.err}
+		}
+		if clause != c {
+			expressions = append(expressions, clause.expr)
+		}
+	}
+	return &Clause{expr: join(expressions)}
+}
+
+// Err returns the error that made the clause invalid, if any.
+func (c *Clause) Err() error {
+	return c.err
+}
+
+// AST returns the clause as a parsed query, as Parse would produce for its query string.
+func (c *Clause) AST() (*lucene.ParticipleQuery, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &lucene.ParticipleQuery{Expression: c.expr}, nil
+}
+
+// String returns the clause as a query string, or "" if it is invalid. Exclusive comparisons on
+// times with a time of day have no query string form and are written as they are stored.
+func (c *Clause) String() string {
+	if c.err != nil {
+		return ""
+	}
+	return lucene.Unparse(&lucene.ParticipleQuery{Expression: c.expr})
+}
+
+// Build formats a clause into a complete find specification, as ParseDetailed does for a query string.
+func (p *Parser) Build(c *Clause) (*ParseResult, error) {
+	p, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	return guard(func() (*ParseResult, error) {
+		ast, err := c.AST()
+		if err != nil {
+			return nil, err
+		}
+		p := p.withSubqueries(context.Background())
+		return p.formatResult(ast, p.formatDefault)
+	})
+}
+
+func operandClause(operand *lucene.ParticipleOperand) *Clause {
+	return &Clause{expr: &lucene.ParticipleExpression{Or: []*lucene.ParticipleAndExpression{
+		{And: []*lucene.ParticipleOperand{operand}},
+	}}}
+}
+
+// builderTerm formats a number, boolean or ObjectID as an unquoted query term
+func builderTerm(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case bool:
+		return strconv.FormatBool(v), nil
+	case bson.ObjectID:
+		return v.Hex(), nil
+	}
+	return builderNumber(value)
+}
+
+// builderBound formats a number or time as a comparison or range bound
+func builderBound(value interface{}) (string, error) {
+	if t, ok := value.(time.Time); ok {
+		t = t.UTC()
+		if t.Equal(t.Truncate(24 * time.Hour)) {
+			return t.Format("2006-01-02"), nil
+		}
+		return t.Format(time.RFC3339Nano), nil
+	}
+	return builderNumber(value)
+}
+
+func builderNumber(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported value type %T", value)
+}
+
+// escapeSlashes escapes the unescaped forward slashes in a regex so it can be written between slashes
+func escapeSlashes(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			b.WriteByte('\\')
+			if i+1 < len(pattern) {
+				i++
+				b.WriteByte(pattern[i])
+			}
+			continue
+		case '/':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(pattern[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,235 @@
+package bsonic
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	mongodriver "go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// FindOption configures the Find and Count collection helpers.
+type FindOption func(*findOptions)
+
+// findOptions holds the settings applied by FindOption functions.
+type findOptions struct {
+	defaultLimit int64
+	maxLimit     int64
+}
+
+// WithDefaultLimit sets the limit used when the query has no limit directive.
+func WithDefaultLimit(limit int64) FindOption {
+	return func(o *findOptions) {
+		o.defaultLimit = limit
+	}
+}
+
+// WithMaxLimit caps the number of documents a query may request, including queries without a limit directive.
+func WithMaxLimit(limit int64) FindOption {
+	return func(o *findOptions) {
+		o.maxLimit = limit
+	}
+}
+
+// Find parses a query with the default parser and executes it against a collection.
+func Find(ctx context.Context, coll *mongodriver.Collection, query string, opts ...FindOption) (*mongodriver.Cursor, error) {
+	return New().Find(ctx, coll, query, opts...)
+}
+
+// Count parses a query with the default parser and counts the matching documents in a collection.
+func Count(ctx context.Context, coll *mongodriver.Collection, query string, opts ...FindOption) (int64, error) {
+	return New().Count(ctx, coll, query, opts...)
+}
+
+// Find parses and validates a query, applies its sort, projection and limit, and executes it against a collection.
+// The config's maximum limit, if any, caps the documents returned unless an option sets another maximum.
+func (p *Parser) Find(ctx context.Context, coll *mongodriver.Collection, query string, opts ...FindOption) (*mongodriver.Cursor, error) {
+	p, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	if p.Config.MaxLimit > 0 {
+		opts = append([]FindOption{WithMaxLimit(p.Config.MaxLimit)}, opts...)
+	}
+	result, err := p.ParseDetailedContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// $search and $lookup stages only exist in aggregations
+	if result.needsPipeline() {
+		withLimit := *result
+		withLimit.Limit = effectiveLimit(result.Limit, opts)
+		return coll.Aggregate(ctx, withLimit.Pipeline())
+	}
+
+	sort, projection := result.Sort, result.Projection
+	if len(result.TextScoreSort) > 0 {
+		sort = scoreSort(result.TextScoreSort, result.Sort, TextScoreField)
+		projection = withProjection(result.Projection, result.TextScoreProjection)
+	}
+
+	findOpts := options.Find()
+	if len(sort) > 0 {
+		findOpts.SetSort(sort)
+	}
+	if len(projection) > 0 {
+		findOpts.SetProjection(projection)
+	}
+	if limit := effectiveLimit(result.Limit, opts); limit > 0 {
+		findOpts.SetLimit(limit)
+	}
+
+	return coll.Find(ctx, result.Filter, findOpts)
+}
+
+// Count parses and validates a query and counts the matching documents in a collection, honoring its limit.
+// The config's maximum limit, if any, caps the count unless an option sets another maximum, as it does for Find.
+func (p *Parser) Count(ctx context.Context, coll *mongodriver.Collection, query string, opts ...FindOption) (int64, error) {
+	p, err := p.current()
+	if err != nil {
+		return 0, err
+	}
+	if p.Config.MaxLimit > 0 {
+		opts = append([]FindOption{WithMaxLimit(p.Config.MaxLimit)}, opts...)
+	}
+	result, err := p.ParseDetailedContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	if result.needsPipeline() {
+		return countPipeline(ctx, coll, result, effectiveLimit(result.Limit, opts))
+	}
+
+	countOpts := options.Count()
+	if limit := effectiveLimit(result.Limit, opts); limit > 0 {
+		countOpts.SetLimit(limit)
+	}
+
+	return coll.CountDocuments(ctx, result.Filter, countOpts)
+}
+
+// countPipeline counts the documents matched by a result that needs an aggregation pipeline.
+func countPipeline(ctx context.Context, coll *mongodriver.Collection, result *ParseResult, limit int64) (int64, error) {
+	var pipeline []bson.M
+	if len(result.SearchStage) > 0 {
+		pipeline = append(pipeline, result.SearchStage)
+	}
+	pipeline = append(pipeline, result.matchStages()...)
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+	pipeline = append(pipeline, bson.M{"$count": "count"})
+
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var counts []struct {
+		Count int64 `bson:"count"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return 0, err
+	}
+	if len(counts) == 0 {
+		return 0, nil
+	}
+	return counts[0].Count, nil
+}
+
+// effectiveLimit resolves the limit from the query directive, the default limit and the maximum limit.
+func effectiveLimit(queryLimit int64, opts []FindOption) int64 {
+	o := &findOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	limit := queryLimit
+	if limit == 0 {
+		limit = o.defaultLimit
+	}
+	if o.maxLimit > 0 && (limit == 0 || limit > o.maxLimit) {
+		limit = o.maxLimit
+	}
+	return limit
+}
+
+// MutationOption configures the DeleteMany and UpdateMany collection helpers.
+type MutationOption func(*mutationOptions)
+
+// mutationOptions holds the settings applied by MutationOption functions.
+type mutationOptions struct {
+	allowedBreadth Breadth
+}
+
+// WithAllowedBreadth sets the broadest filter a delete or update may run with, overriding the default of
+// BreadthSelective. BreadthUnselective allows filters narrowed only by unselective fields, and BreadthEmpty
+// allows any filter, including one matching the whole collection.
+func WithAllowedBreadth(breadth Breadth) MutationOption {
+	return func(o *mutationOptions) {
+		o.allowedBreadth = breadth
+	}
+}
+
+// DeleteMany parses a query with the default parser and deletes the matching documents from a collection.
+func DeleteMany(ctx context.Context, coll *mongodriver.Collection, query string, opts ...MutationOption) (*mongodriver.DeleteResult, error) {
+	return New().DeleteMany(ctx, coll, query, opts...)
+}
+
+// UpdateMany parses a query and an update expression with the default parser and updates the matching documents
+// in a collection.
+func UpdateMany(ctx context.Context, coll *mongodriver.Collection, query, update string, opts ...MutationOption) (*mongodriver.UpdateResult, error) {
+	return New().UpdateMany(ctx, coll, query, update, opts...)
+}
+
+// DeleteMany parses and validates a query and deletes the matching documents from a collection. Filters broader
+// than BreadthSelective, such as an empty query, are refused with ErrBroadFilter unless WithAllowedBreadth allows them.
+func (p *Parser) DeleteMany(ctx context.Context, coll *mongodriver.Collection, query string, opts ...MutationOption) (*mongodriver.DeleteResult, error) {
+	filter, err := p.mutationFilter(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	return coll.DeleteMany(ctx, filter)
+}
+
+// UpdateMany parses and validates a query and an update expression, in the form accepted by ParseUpdate, and
+// updates the matching documents in a collection. Filters broader than BreadthSelective are refused with
+// ErrBroadFilter unless WithAllowedBreadth allows them.
+func (p *Parser) UpdateMany(ctx context.Context, coll *mongodriver.Collection, query, update string, opts ...MutationOption) (*mongodriver.UpdateResult, error) {
+	filter, err := p.mutationFilter(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := p.ParseUpdate(update)
+	if err != nil {
+		return nil, err
+	}
+	return coll.UpdateMany(ctx, filter, doc)
+}
+
+// mutationFilter parses the query of a delete or update and checks that its filter is narrow enough.
+// Queries needing an aggregation pipeline or with a limit cannot be expressed as a delete or update filter.
+func (p *Parser) mutationFilter(ctx context.Context, query string, opts []MutationOption) (bson.M, error) {
+	o := &mutationOptions{allowedBreadth: BreadthSelective}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	result, err := p.ParseDetailedContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if result.needsPipeline() {
+		return nil, unsupportedf("cannot delete or update with a query that needs an aggregation pipeline: %s", query)
+	}
+	if result.Limit > 0 {
+		return nil, unsupportedf("cannot delete or update with a limited query: %s", query)
+	}
+	if err := p.CheckBreadth(result.Filter, o.allowedBreadth); err != nil {
+		return nil, err
+	}
+	return result.Filter, nil
+}
@@ -0,0 +1,183 @@
+package bsonic
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"github.com/kyle-williams-1/bsonic/language/mql"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// And combines queries with AND using the default parser and converts them into a single BSON document.
+func And(queries ...string) (bson.M, error) {
+	return New().And(queries...)
+}
+
+// Or combines queries with OR using the default parser and converts them into a single BSON document.
+func Or(queries ...string) (bson.M, error) {
+	return New().Or(queries...)
+}
+
+// AndBSON parses a query with the default parser and ANDs the result with an extra BSON filter.
+func AndBSON(query string, extra bson.M) (bson.M, error) {
+	return New().AndBSON(query, extra)
+}
+
+// And combines queries with AND and converts them into a single BSON document.
+// Queries are combined as parsed expressions rather than strings, so simple field
+// conditions merge into one document instead of nesting under $and. Empty queries are ignored.
+// The combined query is validated and rewritten like a parsed query, such as by the field allowlist and policy.
+func (p *Parser) And(queries ...string) (bson.M, error) {
+	return p.combineQueries(queries, false)
+}
+
+// Or combines queries with OR and converts them into a single BSON document.
+// Queries that are themselves OR expressions are flattened into a single $or. Empty queries are ignored.
+func (p *Parser) Or(queries ...string) (bson.M, error) {
+	return p.combineQueries(queries, true)
+}
+
+// combineQueries combines queries with AND or OR and returns the filter of the result
+func (p *Parser) combineQueries(queries []string, or bool) (bson.M, error) {
+	p, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	result, err := guard(func() (*ParseResult, error) {
+		return p.withSubqueries(context.Background()).combine(queries, or)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Filter, nil
+}
+
+// AndBSON parses a query and ANDs the result with an extra BSON filter, such as a tenant or
+// visibility condition. The documents are merged directly when their keys do not overlap.
+// The extra filter is trusted and is not checked against the field allowlist.
+func (p *Parser) AndBSON(query string, extra bson.M) (bson.M, error) {
+	filter, err := p.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return andFilters(filter, extra), nil
+}
+
+// combine parses each query and joins the parsed expressions with AND or OR, then formats the combined
+// query the way parseDetailed formats a single one.
+func (p *Parser) combine(queries []string, or bool) (*ParseResult, error) {
+	var expressions []*lucene.ParticipleExpression
+	var filters []bson.M
+
+	for _, query := range queries {
+		if strings.TrimSpace(query) == "" {
+			continue
+		}
+		if err := p.checkQueryLength(query); err != nil {
+			return nil, err
+		}
+
+		ast, err := p.parseLanguage(query)
+		if err != nil {
+			return nil, err
+		}
+
+		switch q := ast.(type) {
+		case *lucene.ParticipleQuery:
+			if len(q.Options) > 0 || q.Collection != "" || q.Intent != nil || len(q.Directives) > 0 {
+				return nil, unsupportedf("cannot combine queries with query options, routing or intent prefixes or directives: %s", query)
+			}
+			if q.Expression != nil {
+				expressions = append(expressions, q.Expression)
+			}
+		case *mql.Query:
+			filters = append(filters, q.Filter)
+		default:
+			return nil, unsupportedf("cannot combine %T queries", ast)
+		}
+	}
+
+	// MQL filters are already BSON and are combined as documents
+	if len(filters) > 0 {
+		return p.formatResult(&mql.Query{Filter: combineFilters(filters, or)}, p.formatDefault)
+	}
+
+	if len(expressions) == 0 {
+		return p.emptyResult(), nil
+	}
+
+	var combined *lucene.ParticipleExpression
+	if or {
+		combined = orExpressions(expressions)
+	} else {
+		combined = andExpressions(expressions)
+	}
+	return p.formatResult(&lucene.ParticipleQuery{Expression: combined}, p.formatDefault)
+}
+
+// combineFilters joins already-formatted filters with AND or OR.
+func combineFilters(filters []bson.M, or bool) bson.M {
+	if or {
+		if len(filters) == 1 {
+			return filters[0]
+		}
+		return bson.M{"$or": filters}
+	}
+
+	filter := bson.M{}
+	for _, f := range filters {
+		filter = andFilters(filter, f)
+	}
+	return filter
+}
+
+// andExpressions joins expressions with AND, splicing in the operands of expressions without OR
+// and grouping the rest so operator precedence is preserved.
+func andExpressions(expressions []*lucene.ParticipleExpression) *lucene.ParticipleExpression {
+	and := &lucene.ParticipleAndExpression{}
+	for _, expr := range expressions {
+		if len(expr.Or) == 1 {
+			and.And = append(and.And, expr.Or[0].And...)
+			continue
+		}
+		and.And = append(and.And, &lucene.ParticipleOperand{
+			Term: &lucene.ParticipleTerm{Group: &lucene.ParticipleGroup{Expression: expr}},
+		})
+	}
+	return &lucene.ParticipleExpression{Or: []*lucene.ParticipleAndExpression{and}}
+}
+
+// orExpressions joins expressions with OR, splicing in the branches of each expression.
+func orExpressions(expressions []*lucene.ParticipleExpression) *lucene.ParticipleExpression {
+	combined := &lucene.ParticipleExpression{}
+	for _, expr := range expressions {
+		combined.Or = append(combined.Or, expr.Or...)
+	}
+	return combined
+}
+
+// andFilters ANDs two filter documents, merging them when no top-level key overlaps.
+func andFilters(filter, extra bson.M) bson.M {
+	if len(filter) == 0 {
+		return extra
+	}
+	if len(extra) == 0 {
+		return filter
+	}
+
+	for key := range extra {
+		if _, exists := filter[key]; exists {
+			return bson.M{"$and": []bson.M{filter, extra}}
+		}
+	}
+
+	merged := bson.M{}
+	for key, value := range filter {
+		merged[key] = value
+	}
+	for key, value := range extra {
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,81 @@
+package bsonic
+
+import (
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Complexity scores how expensive a parsed query is to run, for rate limiters that charge expensive searches
+// more quota than cheap ones. It encodes to JSON with stable lower camel case keys.
+type Complexity struct {
+	// Clauses is the number of field conditions, including those nested under logical operators
+	Clauses int `json:"clauses"`
+	// RegexClauses is the number of wildcard and regex conditions
+	RegexClauses int `json:"regexClauses"`
+	// LeadingWildcards is the number of regexes without literal text at their start, which cannot use index bounds
+	LeadingWildcards int `json:"leadingWildcards"`
+	// Depth is how deeply the logical operators of the filter nest, 0 for a filter without them
+	Depth int `json:"depth"`
+	// PathDepth is the number of segments of the longest field path
+	PathDepth int `json:"pathDepth"`
+	// TextSearch reports whether the query runs a $text or Atlas Search full-text search
+	TextSearch bool `json:"textSearch"`
+	// Lookups is the number of $lookup stages joining foreign references
+	Lookups int `json:"lookups"`
+	// Cost combines the other scores into a single number of tokens, at least 1, to charge for the query
+	Cost int `json:"cost"`
+}
+
+// Complexity cost weights: a regex costs more than an exact condition, and a leading wildcard, which scans the
+// whole index or collection, costs more still
+const (
+	regexCost           = 2
+	leadingWildcardCost = 10
+	depthCost           = 1
+	textSearchCost      = 5
+	lookupCost          = 5
+)
+
+// Complexity returns the complexity score of the result's filter and lookups. Its Cost is
+// 1 + Clauses + 2×RegexClauses + 10×LeadingWildcards + Depth + 5×Lookups, plus 5 for a full-text search.
+func (r *ParseResult) Complexity() Complexity {
+	c := Complexity{
+		Clauses:    clauseCount(r.Filter),
+		Depth:      logicalDepth(r.Filter),
+		TextSearch: hasTextSearch(r.Filter) || len(r.SearchStage) > 0,
+		Lookups:    len(r.LookupStages),
+	}
+	walkRegexes(r.Filter, func(field, pattern string) {
+		c.RegexClauses++
+		if isLeadingWildcard(pattern) {
+			c.LeadingWildcards++
+		}
+	})
+	_ = walkFilterFields(r.Filter, func(field string) error {
+		c.PathDepth = max(c.PathDepth, strings.Count(field, ".")+1)
+		return nil
+	})
+
+	c.Cost = 1 + c.Clauses + regexCost*c.RegexClauses + leadingWildcardCost*c.LeadingWildcards +
+		depthCost*c.Depth + lookupCost*c.Lookups
+	if c.TextSearch {
+		c.Cost += textSearchCost
+	}
+	return c
+}
+
+// logicalDepth returns how deeply the $and, $or and $nor operators of a filter nest
+func logicalDepth(filter bson.M) int {
+	depth := 0
+	for key, value := range filter {
+		if !strings.HasPrefix(key, "$") {
+			continue
+		}
+		for _, sub := range bsonfilter.Clauses(value) {
+			depth = max(depth, 1+logicalDepth(sub))
+		}
+	}
+	return depth
+}
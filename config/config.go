@@ -1,12 +1,26 @@
 // Package config provides configuration for language and formatter selection.
 package config
 
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/kyle-williams-1/bsonic/metrics"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.opentelemetry.io/otel/trace"
+)
+
 // LanguageType represents the type of query language to use.
 type LanguageType string
 
 const (
 	// LanguageLucene represents Lucene-style query syntax
 	LanguageLucene LanguageType = "lucene"
+	// LanguageMQL represents raw MongoDB filter documents written as JSON or extended JSON
+	LanguageMQL LanguageType = "mql"
 )
 
 // FormatterType represents the type of output formatter to use.
@@ -17,13 +31,235 @@ const (
 	FormatterMongo FormatterType = "mongo"
 )
 
+// TextSearchStrategy represents how free text is compiled.
+type TextSearchStrategy string
+
+const (
+	// StrategyRegexFields searches free text with case-insensitive regexes across the default fields
+	StrategyRegexFields TextSearchStrategy = "regex_fields"
+	// StrategyTextIndex searches free text with a $text query against the collection's text index
+	StrategyTextIndex TextSearchStrategy = "text_index"
+	// StrategyAtlasSearch moves free text into an Atlas Search $search aggregation stage
+	StrategyAtlasSearch TextSearchStrategy = "atlas_search"
+)
+
+// MultiWordMode represents how unquoted multiword free text such as `John Doe` is matched.
+type MultiWordMode string
+
+const (
+	// MultiWordAny matches documents containing any of the words
+	MultiWordAny MultiWordMode = "any"
+	// MultiWordAll matches documents containing every word
+	MultiWordAll MultiWordMode = "all"
+	// MultiWordPhrase matches the words together as a single phrase, like quoted text
+	MultiWordPhrase MultiWordMode = "phrase"
+)
+
+// FieldType is the BSON type a field is stored as, used to coerce query values to match.
+type FieldType string
+
+const (
+	// FieldTypeString keeps values as strings, even when they look like numbers, dates or booleans
+	FieldTypeString FieldType = "string"
+	// FieldTypeNumber converts numeric values to numbers
+	FieldTypeNumber FieldType = "number"
+	// FieldTypeDate converts date values to dates
+	FieldTypeDate FieldType = "date"
+	// FieldTypeObjectID converts 24-character hex values to ObjectIDs
+	FieldTypeObjectID FieldType = "objectId"
+	// FieldTypeBool converts true and false to booleans
+	FieldTypeBool FieldType = "bool"
+	// FieldTypeUUID converts canonical UUID text to a BSON UUID (binary subtype 4)
+	FieldTypeUUID FieldType = "uuid"
+	// FieldTypeIP converts IP addresses to binary in network byte order, 4 bytes for IPv4 and 16 for IPv6,
+	// and CIDR prefixes such as 10.0.0.0/8 to the range of addresses they cover
+	FieldTypeIP FieldType = "ip"
+	// FieldTypeIPNumber converts IPv4 addresses to their 32-bit integer value and IPv4 CIDR prefixes to the
+	// range of values they cover
+	FieldTypeIPNumber FieldType = "ipNumber"
+	// FieldTypeIPString keeps IPv4 addresses as dotted text and converts IPv4 CIDR prefixes to an anchored
+	// regex matching the addresses they cover
+	FieldTypeIPString FieldType = "ipString"
+	// FieldTypePhone keeps phone numbers as text, like FieldTypeString, for a coercer such as PhoneCoercer to normalize
+	FieldTypePhone FieldType = "phone"
+	// FieldTypeEmail lowercases email addresses, and matches partial addresses such as @example.com by domain
+	// and john@ by local part
+	FieldTypeEmail FieldType = "email"
+)
+
+// BoolCoercion is the policy for converting true and false query values to booleans.
+type BoolCoercion string
+
+const (
+	// BoolCoercionAlways converts true and false to booleans on every field unless it is typed otherwise
+	BoolCoercionAlways BoolCoercion = "always"
+	// BoolCoercionSchema converts true and false to booleans only on fields typed FieldTypeBool,
+	// so username:true matches the user literally named "true"
+	BoolCoercionSchema BoolCoercion = "schema"
+)
+
+// ConflictPolicy is the policy for a field ANDed with conflicting equality conditions, such as age:18 AND age:65,
+// which no document with a single value in the field matches.
+type ConflictPolicy string
+
+const (
+	// ConflictKeep keeps every condition, so the query matches nothing unless the field holds an array
+	ConflictKeep ConflictPolicy = "keep"
+	// ConflictError rejects the query with a *bsonic.ConflictError
+	ConflictError ConflictPolicy = "error"
+	// ConflictLastWins keeps only the last condition on the field, as assigning the field twice would
+	ConflictLastWins ConflictPolicy = "last_wins"
+	// ConflictWarn keeps every condition and reports the contradiction in the parse result's warnings
+	ConflictWarn ConflictPolicy = "warn"
+)
+
+// Output versions pin the shape of generated BSON. Each version is documented in the README.
+const (
+	// OutputVersion1 is the output before the grammar rewrite: free text compiles to $text,
+	// and name:John Doe matches name:John AND a $text search for Doe
+	OutputVersion1 = 1
+	// OutputVersion2 compiles free text with the text search strategy,
+	// and name:John Doe matches name:John OR Doe across the default fields
+	OutputVersion2 = 2
+	// OutputVersion3 gives filters minimal logical structure: nested $and and $or are flattened, ORed equalities
+	// on one field become $in, comparisons on one field merge into one range, and clauses keep their source order
+	OutputVersion3 = 3
+	// LatestOutputVersion is the output version used when none is set
+	LatestOutputVersion = OutputVersion3
+)
+
+// Query options a query sets for itself with @ prefixes, such as @case_sensitive name:john.
+const (
+	// QueryOptionIncludeDeleted is @include_deleted, matching soft-deleted documents too
+	QueryOptionIncludeDeleted = "include_deleted"
+	// QueryOptionCaseSensitive is @case_sensitive, matching values, wildcards and free text with their case
+	QueryOptionCaseSensitive = "case_sensitive"
+	// QueryOptionLimit is @limit:N, limiting the documents returned
+	QueryOptionLimit = "limit"
+)
+
+// DefaultQueryOptions are the query options allowed when none are configured. @include_deleted is left out,
+// since it lets any user see soft-deleted documents.
+var DefaultQueryOptions = []string{QueryOptionCaseSensitive, QueryOptionLimit}
+
+// SubqueryResolver executes the inner query of an IN_QUERY(collection WHERE ...) reference
+// and returns the IDs it matched. ctx is the context of the parse the subquery belongs to.
+type SubqueryResolver func(ctx context.Context, collection string, filter bson.M) ([]interface{}, error)
+
+// ForeignRef declares a field that references documents in another collection, such as an author ID pointing at users.
+type ForeignRef struct {
+	// From is the referenced collection
+	From string
+	// LocalField is the field holding the reference; empty uses the declared field name
+	LocalField string
+	// ForeignField is the referenced field in From; empty uses "_id"
+	ForeignField string
+}
+
+// TimeBucket declares the bucket boundary fields of a time field in a manually bucketed time-series collection,
+// where each document holds a bucket of measurements and records the earliest and latest of their times.
+type TimeBucket struct {
+	// Min is the field holding the earliest time in a bucket; empty uses control.min.<field>
+	Min string
+	// Max is the field holding the latest time in a bucket; empty uses control.max.<field>
+	Max string
+}
+
+// CurrencyConverter converts a money amount in a currency, identified by its ISO 4217 code, to the number stored in documents.
+// The currency is empty when a literal has neither a symbol nor a code.
+type CurrencyConverter func(amount float64, currency string) (float64, error)
+
+// StripCurrency is a CurrencyConverter that drops the currency and keeps the amount unchanged.
+func StripCurrency(amount float64, currency string) (float64, error) {
+	return amount, nil
+}
+
+// ValueCoercer normalizes the values a query compares a field with before they are emitted, such as
+// uppercasing SKUs or stripping phone number formatting. It is given the field as written in the filter and
+// a value after detection and type coercion, such as a string, float64 or time.Time. An error fails the query.
+type ValueCoercer interface {
+	Coerce(field string, value interface{}) (interface{}, error)
+}
+
+// ValueCoercerFunc adapts a function to a ValueCoercer.
+type ValueCoercerFunc func(field string, value interface{}) (interface{}, error)
+
+// Coerce calls fn(field, value).
+func (fn ValueCoercerFunc) Coerce(field string, value interface{}) (interface{}, error) {
+	return fn(field, value)
+}
+
+// AnyOf is a value a ValueCoercer returns to match any of several values, such as the formats a phone number
+// may be stored in. An equality condition becomes $in and a negated one $nin, and $in and $nin lists include
+// every value. Comparisons use the first value.
+type AnyOf []interface{}
+
+// Weighted maps default fields to their relevance weight for ranked free text results.
+type Weighted map[string]int
+
 // Config represents the configuration for a parser.
 type Config struct {
 	Language                LanguageType
 	Formatter               FormatterType
 	DefaultFields           []string
+	DefaultFieldWeights     Weighted
 	ReplaceIDWithMongoID    bool
 	AutoConvertIDToObjectID bool
+	AllowedFields           []string
+	TextLanguage            string
+	TextCaseSensitive       bool
+	TextDiacriticSensitive  bool
+	TextScore               bool
+	TextSearchStrategy      TextSearchStrategy
+	AtlasSearchIndex        string
+	MultiWordMode           MultiWordMode
+	TextTokenizer           func(string) []string
+	SubqueryResolver        SubqueryResolver
+	ForeignRefs             map[string]ForeignRef
+	TimeBuckets             map[string]TimeBucket
+	Logger                  *slog.Logger
+	LogQueries              bool
+	TracerProvider          trace.TracerProvider
+	Metrics                 metrics.Metrics
+	UsageRecorder           metrics.UsageRecorder
+	LegacyTextCompat        bool
+	OutputVersion           int
+	FieldTypes              map[string]FieldType
+	ArrayFields             []string
+	EnumFields              map[string][]string
+	RejectEnumWildcards     bool
+	BoolCoercion            BoolCoercion
+	FieldBoolCoercion       map[string]BoolCoercion
+	AccentInsensitive       bool
+	DurationUnit            time.Duration
+	CurrencyConverter       CurrencyConverter
+	DecimalSeparator        string
+	ThousandsSeparator      string
+	StrictNumbers           bool
+	LenientErrors           bool
+	LowercaseOperators      bool
+	Policy                  Policy
+	MaxQueryLength          int
+	MaxClauses              int
+	MaxLimit                int64
+	MaxPathDepth            int
+	MaxRegexClauses         int
+	RejectLeadingWildcards  bool
+	ForbiddenOperators      []string
+	OperatorAudit           bool
+	ExplicitEquality        bool
+	FieldCoercers           map[string]ValueCoercer
+	TypeCoercers            map[FieldType]ValueCoercer
+	SoftDeleteField         string
+	UnselectiveFields       []string
+	DeprecatedFields        map[string]string
+	ConflictPolicy          ConflictPolicy
+	AllowedQueryOptions     []string
+
+	// err is the first error recorded by a With method that validates its input, reported by Err
+	err error
+	// frozen marks a snapshot returned by Freeze, which With methods copy instead of changing
+	frozen bool
 }
 
 // Default returns the default configuration with Lucene language and MongoDB formatter.
@@ -34,35 +270,599 @@ func Default() *Config {
 		DefaultFields:           []string{},
 		ReplaceIDWithMongoID:    true,
 		AutoConvertIDToObjectID: true,
+		AllowedFields:           []string{},
+		TextSearchStrategy:      StrategyRegexFields,
+		MultiWordMode:           MultiWordAny,
+		BoolCoercion:            BoolCoercionAlways,
+		ConflictPolicy:          ConflictKeep,
 	}
 }
 
 // WithLanguage sets the language type and returns the config.
 func (c *Config) WithLanguage(lang LanguageType) *Config {
+	c = c.mutable()
 	c.Language = lang
 	return c
 }
 
 // WithFormatter sets the formatter type and returns the config.
 func (c *Config) WithFormatter(formatter FormatterType) *Config {
+	c = c.mutable()
 	c.Formatter = formatter
 	return c
 }
 
 // WithDefaultFields sets the default fields for unstructured queries and returns the config.
 func (c *Config) WithDefaultFields(fields []string) *Config {
+	c = c.mutable()
+	c.DefaultFields = fields
+	return c
+}
+
+// WithWeightedDefaultFields sets the default fields with relevance weights and returns the config.
+// Fields are searched in order of descending weight; the weights score ranked results.
+func (c *Config) WithWeightedDefaultFields(weights Weighted) *Config {
+	c = c.mutable()
+	fields := make([]string, 0, len(weights))
+	for field := range weights {
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if weights[fields[i]] != weights[fields[j]] {
+			return weights[fields[i]] > weights[fields[j]]
+		}
+		return fields[i] < fields[j]
+	})
+
 	c.DefaultFields = fields
+	c.DefaultFieldWeights = weights
 	return c
 }
 
 // WithReplaceIDWithMongoID sets whether to replace "id" field names with "_id" and returns the config.
 func (c *Config) WithReplaceIDWithMongoID(enabled bool) *Config {
+	c = c.mutable()
 	c.ReplaceIDWithMongoID = enabled
 	return c
 }
 
 // WithAutoConvertIDToObjectID sets whether to automatically convert string values to bson.ObjectID for "_id" fields and returns the config.
 func (c *Config) WithAutoConvertIDToObjectID(enabled bool) *Config {
+	c = c.mutable()
 	c.AutoConvertIDToObjectID = enabled
 	return c
 }
+
+// WithAllowedFields restricts the fields a query may reference and returns the config.
+// A field is allowed when it matches an entry exactly or is nested beneath one (e.g. "user" allows "user.name").
+// An empty list allows every field.
+func (c *Config) WithAllowedFields(fields []string) *Config {
+	c = c.mutable()
+	c.AllowedFields = fields
+	return c
+}
+
+// WithTextLanguage sets the $language used for $text searches and returns the config.
+func (c *Config) WithTextLanguage(language string) *Config {
+	c = c.mutable()
+	c.TextLanguage = language
+	return c
+}
+
+// WithTextCaseSensitive sets $caseSensitive for $text searches and returns the config.
+func (c *Config) WithTextCaseSensitive(enabled bool) *Config {
+	c = c.mutable()
+	c.TextCaseSensitive = enabled
+	return c
+}
+
+// WithTextDiacriticSensitive sets $diacriticSensitive for $text searches and returns the config.
+func (c *Config) WithTextDiacriticSensitive(enabled bool) *Config {
+	c = c.mutable()
+	c.TextDiacriticSensitive = enabled
+	return c
+}
+
+// WithTextScore sets whether ParseDetailed returns textScore projection and sort fragments for queries
+// whose filter has a $text search, so results can be ordered by relevance, and returns the config.
+func (c *Config) WithTextScore(enabled bool) *Config {
+	c = c.mutable()
+	c.TextScore = enabled
+	return c
+}
+
+// WithTextSearchStrategy sets how free text is compiled and returns the config.
+func (c *Config) WithTextSearchStrategy(strategy TextSearchStrategy) *Config {
+	c = c.mutable()
+	c.TextSearchStrategy = strategy
+	return c
+}
+
+// WithAtlasSearchIndex sets the Atlas Search index name used by StrategyAtlasSearch and returns the config.
+func (c *Config) WithAtlasSearchIndex(index string) *Config {
+	c = c.mutable()
+	c.AtlasSearchIndex = index
+	return c
+}
+
+// WithMultiWordMode sets how unquoted multiword free text is matched and returns the config.
+func (c *Config) WithMultiWordMode(mode MultiWordMode) *Config {
+	c = c.mutable()
+	c.MultiWordMode = mode
+	return c
+}
+
+// WithTextTokenizer sets a function that splits unquoted free text into search terms and returns the config.
+// It can lowercase, stem or drop stop words before regex, $text or Atlas Search clauses are built.
+// Quoted phrases and regexes are left as written.
+func (c *Config) WithTextTokenizer(tokenizer func(string) []string) *Config {
+	c = c.mutable()
+	c.TextTokenizer = tokenizer
+	return c
+}
+
+// WithSubqueryResolver sets the resolver that runs IN_QUERY subqueries and returns the config.
+// Without a resolver, queries using IN_QUERY fail to format.
+func (c *Config) WithSubqueryResolver(resolver SubqueryResolver) *Config {
+	c = c.mutable()
+	c.SubqueryResolver = resolver
+	return c
+}
+
+// WithForeignRefs declares foreign-reference fields and returns the config.
+// Queries on a dotted path beneath a declared field (e.g. author.name) are matched against
+// the referenced documents through $lookup stages in ParseResult.Pipeline.
+func (c *Config) WithForeignRefs(refs map[string]ForeignRef) *Config {
+	c = c.mutable()
+	c.ForeignRefs = refs
+	return c
+}
+
+// WithTimeBuckets declares the bucketed time fields of a time-series collection and returns the config.
+// Range and equality clauses on a declared field also constrain the bucket boundary fields, so only
+// buckets whose time range overlaps the clause are scanned: created:>=2024-01-01 adds control.max.created >= 2024-01-01.
+func (c *Config) WithTimeBuckets(buckets map[string]TimeBucket) *Config {
+	c = c.mutable()
+	c.TimeBuckets = buckets
+	return c
+}
+
+// WithLogger sets the handler that receives a debug record for every parse and returns the config.
+// Records carry the query's length, fingerprint and shape, the number of clauses produced and the duration,
+// but not the query itself; see WithQueryLogging. A nil handler disables logging.
+func (c *Config) WithLogger(handler slog.Handler) *Config {
+	c = c.mutable()
+	c.Logger = nil
+	if handler != nil {
+		c.Logger = slog.New(handler)
+	}
+	return c
+}
+
+// WithQueryLogging sets whether log records carry the raw query and error message, and failed parse spans
+// the error message, and returns the config.
+// Both may hold personal data such as names and email addresses searched for, so they are left out by default.
+func (c *Config) WithQueryLogging(enabled bool) *Config {
+	c = c.mutable()
+	c.LogQueries = enabled
+	return c
+}
+
+// WithTracerProvider sets the OpenTelemetry tracer provider used for parse and format spans and returns the config.
+// Without one, the global tracer provider is used.
+func (c *Config) WithTracerProvider(provider trace.TracerProvider) *Config {
+	c = c.mutable()
+	c.TracerProvider = provider
+	return c
+}
+
+// WithMetrics sets the metrics that record the outcome of every parse and returns the config.
+// See the metrics/prometheus package for a Prometheus adapter.
+func (c *Config) WithMetrics(m metrics.Metrics) *Config {
+	c = c.mutable()
+	c.Metrics = m
+	return c
+}
+
+// WithUsageRecorder sets the recorder of the fields and operators every successful parse uses and returns the
+// config. Recording is off by default; metrics.NewUsageCollector aggregates the usage for dumping.
+func (c *Config) WithUsageRecorder(r metrics.UsageRecorder) *Config {
+	c = c.mutable()
+	c.UsageRecorder = r
+	return c
+}
+
+// WithLegacyTextCompat sets whether free text is compiled to $text the way it was before the grammar rewrite and returns the config.
+// When enabled, name:John Doe matches name:John AND a $text search for Doe, instead of name:John OR Doe across the default fields,
+// and all free text is a $text search regardless of the text search strategy, so existing deployments can upgrade without behavior changes.
+func (c *Config) WithLegacyTextCompat(enabled bool) *Config {
+	c = c.mutable()
+	c.LegacyTextCompat = enabled
+	return c
+}
+
+// WithOutputVersion pins the generated BSON to a documented output version and returns the config,
+// so upgrading the library does not change query behavior until the version is raised.
+// Zero uses LatestOutputVersion; see the migrate package to compare versions over a query corpus.
+func (c *Config) WithOutputVersion(version int) *Config {
+	c = c.mutable()
+	c.OutputVersion = version
+	return c
+}
+
+// LegacyText reports whether free text is compiled the way it was before the grammar rewrite,
+// either through WithLegacyTextCompat or by pinning OutputVersion1.
+func (c *Config) LegacyText() bool {
+	return c.LegacyTextCompat || c.OutputVersion == OutputVersion1
+}
+
+// NormalizedLogic reports whether filters are given minimal logical structure, as from OutputVersion3 on.
+func (c *Config) NormalizedLogic() bool {
+	return c.OutputVersion == 0 || c.OutputVersion >= OutputVersion3
+}
+
+// WithFieldTypes sets the stored type of fields and returns the config.
+// Values for typed fields are coerced to that type instead of being detected from their text,
+// so zip:02134 stays a string when zip is a FieldTypeString field. See the schema package to infer types from a collection.
+func (c *Config) WithFieldTypes(types map[string]FieldType) *Config {
+	c = c.mutable()
+	c.FieldTypes = types
+	return c
+}
+
+// WithArrayFields declares the fields holding arrays and returns the config. Once any are declared, a query path
+// indexing a typed field, such as name.0 when name is a FieldTypeString field, is rejected as a syntax error unless
+// the field is one of them. WithJSONSchema declares the arrays of its schema.
+func (c *Config) WithArrayFields(fields ...string) *Config {
+	c = c.mutable()
+	c.ArrayFields = fields
+	return c
+}
+
+// WithEnumField restricts a field to a fixed set of values and returns the config.
+// Queries comparing the field to any other value are rejected with an error listing the allowed values.
+func (c *Config) WithEnumField(field string, values ...string) *Config {
+	c = c.mutable()
+	enums := make(map[string][]string, len(c.EnumFields)+1)
+	for name, allowed := range c.EnumFields {
+		enums[name] = allowed
+	}
+	enums[field] = values
+	c.EnumFields = enums
+	return c
+}
+
+// WithRejectEnumWildcards sets whether wildcard and regex patterns are rejected on enum fields and returns the config.
+// By default they are allowed, so status:act* still matches active.
+func (c *Config) WithRejectEnumWildcards(enabled bool) *Config {
+	c = c.mutable()
+	c.RejectEnumWildcards = enabled
+	return c
+}
+
+// WithBoolCoercion sets when true and false are converted to booleans and returns the config.
+// Fields typed with WithFieldTypes always follow their type; WithFieldBoolCoercion overrides the policy per field.
+func (c *Config) WithBoolCoercion(policy BoolCoercion) *Config {
+	c = c.mutable()
+	c.BoolCoercion = policy
+	return c
+}
+
+// WithFieldBoolCoercion sets the boolean coercion policy of a single field, overriding WithBoolCoercion, and returns the config.
+func (c *Config) WithFieldBoolCoercion(field string, policy BoolCoercion) *Config {
+	c = c.mutable()
+	policies := make(map[string]BoolCoercion, len(c.FieldBoolCoercion)+1)
+	for name, existing := range c.FieldBoolCoercion {
+		policies[name] = existing
+	}
+	policies[field] = policy
+	c.FieldBoolCoercion = policies
+	return c
+}
+
+// WithAccentInsensitive sets whether text matches regardless of accents and returns the config, so cafe matches café
+// and café matches cafe. Free text, wildcard and string field values compile to regexes with a character class for
+// every accented letter; $text searches use WithTextDiacriticSensitive instead.
+func (c *Config) WithAccentInsensitive(enabled bool) *Config {
+	c = c.mutable()
+	c.AccentInsensitive = enabled
+	return c
+}
+
+// WithDurationUnit enables duration literals such as 30s, 90m and 1h30m and returns the config.
+// They are converted to a number of units, so with time.Second timeout:>30s becomes {"timeout": {"$gt": 30}},
+// for collections that store durations numerically. Zero, the default, leaves them as strings.
+func (c *Config) WithDurationUnit(unit time.Duration) *Config {
+	c = c.mutable()
+	c.DurationUnit = unit
+	return c
+}
+
+// WithCurrencyConverter enables money literals such as $10.50, price:>"$10.50" and 10.50USD and returns the config.
+// The currency symbol or ISO 4217 code is stripped and the amount converted with converter; use StripCurrency
+// to keep amounts as written. Nil, the default, leaves money literals as strings.
+func (c *Config) WithCurrencyConverter(converter CurrencyConverter) *Config {
+	c = c.mutable()
+	c.CurrencyConverter = converter
+	return c
+}
+
+// WithNumberSeparators sets the decimal and thousands separators numbers are written with and returns the config,
+// so with "," and "." price:1.234,56 becomes {"price": 1234.56}. Digits may be grouped in threes with the thousands
+// separator, which may be empty. Numbers that do not use the separators are still read in standard notation.
+// An empty decimal separator, the default, reads numbers in standard notation only.
+func (c *Config) WithNumberSeparators(decimal, thousands string) *Config {
+	c = c.mutable()
+	c.DecimalSeparator = decimal
+	c.ThousandsSeparator = thousands
+	return c
+}
+
+// WithStrictNumbers sets whether numbers that read differently with the number separators and in standard
+// notation are rejected and returns the config. With "," and "." as the separators, price:1.234 could be 1234
+// or 1.234; it is read as 1234 by default, and fails with an ErrSyntax error in strict mode.
+func (c *Config) WithStrictNumbers(strict bool) *Config {
+	c = c.mutable()
+	c.StrictNumbers = strict
+	return c
+}
+
+// WithLenientErrors sets whether clauses that fail to parse are dropped instead of failing the whole query,
+// and returns the config. Each dropped clause is reported in ParseResult.Warnings, so log search UIs can run
+// the rest of a query while the user is still typing. Disallowed fields and exceeded limits still fail the query.
+func (c *Config) WithLenientErrors(enabled bool) *Config {
+	c = c.mutable()
+	c.LenientErrors = enabled
+	return c
+}
+
+// WithLowercaseOperators sets whether the lowercase words and, or and not are read as the AND, OR and NOT
+// operators and returns the config. Users often type operators in lowercase and get free text matching "and"
+// instead; with this enabled, a lowercase operator word needs quotes or a backslash, as in "rock and roll" or
+// rock \and roll, to be searched for. Disabled by default.
+func (c *Config) WithLowercaseOperators(enabled bool) *Config {
+	c = c.mutable()
+	c.LowercaseOperators = enabled
+	return c
+}
+
+// WithJSONSchema adds the field types described by a JSON Schema, OpenAPI schema component or MongoDB
+// $jsonSchema validator to FieldTypes, and its array fields to ArrayFields, and returns the config.
+// An invalid schema is reported by Err, and by NewWithConfig. See JSONSchemaFieldTypes for how schema
+// types and formats are mapped.
+func (c *Config) WithJSONSchema(raw []byte) *Config {
+	c = c.mutable()
+	types, err := JSONSchemaFieldTypes(raw)
+	if err != nil {
+		c.setErr(err)
+		return c
+	}
+	arrays, err := JSONSchemaArrayFields(raw)
+	if err != nil {
+		c.setErr(err)
+		return c
+	}
+	for _, field := range c.ArrayFields {
+		if !slices.Contains(arrays, field) {
+			arrays = append(arrays, field)
+		}
+	}
+	c.ArrayFields = arrays
+
+	merged := make(map[string]FieldType, len(c.FieldTypes)+len(types))
+	for field, fieldType := range c.FieldTypes {
+		merged[field] = fieldType
+	}
+	for field, fieldType := range types {
+		merged[field] = fieldType
+	}
+	c.FieldTypes = merged
+	return c
+}
+
+// WithMaxQueryLength sets the longest query, in bytes, the parser accepts and returns the config. Zero means no maximum.
+func (c *Config) WithMaxQueryLength(length int) *Config {
+	c = c.mutable()
+	c.MaxQueryLength = length
+	return c
+}
+
+// WithMaxClauses sets the most field conditions a query's filter may have, including those
+// generated for free text across the default fields, and returns the config. Zero means no maximum.
+func (c *Config) WithMaxClauses(clauses int) *Config {
+	c = c.mutable()
+	c.MaxClauses = clauses
+	return c
+}
+
+// WithMaxLimit sets the largest limit directive a query may have and returns the config. Zero means no maximum.
+// Parser.Find also applies it to queries without a limit directive.
+func (c *Config) WithMaxLimit(limit int64) *Config {
+	c = c.mutable()
+	c.MaxLimit = limit
+	return c
+}
+
+// WithMaxPathDepth sets the most dot-separated segments a field path may have, such as 3 for a.b.c, and returns
+// the config. It applies to filter, sort, projection and distinct fields. Zero means no maximum.
+func (c *Config) WithMaxPathDepth(depth int) *Config {
+	c = c.mutable()
+	c.MaxPathDepth = depth
+	return c
+}
+
+// WithMaxRegexClauses sets the most regex conditions a query's filter may have, including those generated
+// for wildcards and for free text across the default fields, and returns the config. Zero means no maximum.
+func (c *Config) WithMaxRegexClauses(clauses int) *Config {
+	c = c.mutable()
+	c.MaxRegexClauses = clauses
+	return c
+}
+
+// WithRejectLeadingWildcards sets whether patterns without literal text at the start, such as name:*son,
+// name:?ohn or name:/.*son/, are rejected and returns the config. Such patterns cannot use index bounds,
+// so MongoDB scans every index key or document to match them.
+func (c *Config) WithRejectLeadingWildcards(reject bool) *Config {
+	c = c.mutable()
+	c.RejectLeadingWildcards = reject
+	return c
+}
+
+// WithForbiddenOperators sets the MongoDB operators a query's filter may not use, such as $regex, and returns the config.
+func (c *Config) WithForbiddenOperators(operators ...string) *Config {
+	c = c.mutable()
+	c.ForbiddenOperators = operators
+	return c
+}
+
+// WithExplicitEquality sets whether equality conditions are written with $eq, as in {"status": {"$eq": "active"}},
+// instead of bare values such as {"status": "active"}, and returns the config. Matching is unchanged; the
+// explicit form suits middleware that inspects filters for operators.
+func (c *Config) WithExplicitEquality(enabled bool) *Config {
+	c = c.mutable()
+	c.ExplicitEquality = enabled
+	return c
+}
+
+// WithCoercer sets the value coercer of a field and returns the config. Equality, comparison, range and
+// $in values for the field are passed through it before the filter is emitted, overriding any coercer of
+// the field's type. Values matched by regex, such as wildcards, are not coerced. Nil removes the coercer.
+func (c *Config) WithCoercer(field string, coercer ValueCoercer) *Config {
+	c = c.mutable()
+	c.FieldCoercers = withCoercer(c.FieldCoercers, field, coercer)
+	return c
+}
+
+// WithTypeCoercer sets the value coercer of the fields typed fieldType with WithFieldTypes and returns the
+// config. Fields with their own coercer from WithCoercer use that instead. Nil removes the coercer.
+func (c *Config) WithTypeCoercer(fieldType FieldType, coercer ValueCoercer) *Config {
+	c = c.mutable()
+	c.TypeCoercers = withCoercer(c.TypeCoercers, fieldType, coercer)
+	return c
+}
+
+// withCoercer returns a copy of coercers with key set to coercer, or removed when coercer is nil
+func withCoercer[K comparable](coercers map[K]ValueCoercer, key K, coercer ValueCoercer) map[K]ValueCoercer {
+	updated := make(map[K]ValueCoercer, len(coercers)+1)
+	for name, existing := range coercers {
+		updated[name] = existing
+	}
+	if coercer == nil {
+		delete(updated, key)
+	} else {
+		updated[key] = coercer
+	}
+	return updated
+}
+
+// WithPhoneFields flags fields as phone numbers and returns the config. The fields are typed FieldTypePhone,
+// and values of every phone field are normalized to E.164 with PhoneCoercer(opts).
+func (c *Config) WithPhoneFields(opts PhoneOptions, fields ...string) *Config {
+	c = c.mutable()
+	types := make(map[string]FieldType, len(c.FieldTypes)+len(fields))
+	for field, fieldType := range c.FieldTypes {
+		types[field] = fieldType
+	}
+	for _, field := range fields {
+		types[field] = FieldTypePhone
+	}
+	c.FieldTypes = types
+	return c.WithTypeCoercer(FieldTypePhone, PhoneCoercer(opts))
+}
+
+// WithEmailFields types fields FieldTypeEmail and returns the config, so email:@example.com matches every
+// address at example.com, email:john@ every address starting with john@, and full addresses are lowercased.
+func (c *Config) WithEmailFields(fields ...string) *Config {
+	c = c.mutable()
+	types := make(map[string]FieldType, len(c.FieldTypes)+len(fields))
+	for field, fieldType := range c.FieldTypes {
+		types[field] = fieldType
+	}
+	for _, field := range fields {
+		types[field] = FieldTypeEmail
+	}
+	c.FieldTypes = types
+	return c
+}
+
+// WithSoftDeleteField sets the field marking soft-deleted documents, such as deleted_at, and returns the config.
+// Every query is ANDed with {field: null}, matching documents where the field is null or missing, unless the
+// query requires a condition on the field that only deleted documents meet, as deleted_at:TYPE(date) does to find
+// them. Conditions under OR or NOT never lift it. Empty, the default, disables the condition.
+func (c *Config) WithSoftDeleteField(field string) *Config {
+	c = c.mutable()
+	c.SoftDeleteField = field
+	return c
+}
+
+// WithUnselectiveFields sets the fields that match large parts of a collection, such as status or active, and
+// returns the config. A filter narrowed only by them, the soft delete field and negations is unselective, so the
+// delete and update helpers refuse it without an explicit override.
+func (c *Config) WithUnselectiveFields(fields ...string) *Config {
+	c = c.mutable()
+	c.UnselectiveFields = fields
+	return c
+}
+
+// WithDeprecatedField renames a field, and the fields nested beneath it, to its replacement in every parsed query
+// and returns the config, so saved queries using an old field name keep working after a schema change. Each
+// deprecated field a query uses is reported in ParseResult.Warnings, for telemetry on who still uses it. The
+// replacement's allowlist, type and enum settings apply to the renamed field.
+func (c *Config) WithDeprecatedField(field, replacement string) *Config {
+	c = c.mutable()
+	deprecated := make(map[string]string, len(c.DeprecatedFields)+1)
+	for name, renamed := range c.DeprecatedFields {
+		deprecated[name] = renamed
+	}
+	deprecated[field] = replacement
+	c.DeprecatedFields = deprecated
+	return c
+}
+
+// WithConflictPolicy sets how a field ANDed with conflicting equality conditions, such as age:18 AND age:65, is
+// handled and returns the config. The default, ConflictKeep, keeps both conditions. Declared array fields, and the
+// fields nested beneath them, are never treated as conflicting, since tags:a AND tags:b matches arrays holding both.
+func (c *Config) WithConflictPolicy(policy ConflictPolicy) *Config {
+	c = c.mutable()
+	c.ConflictPolicy = policy
+	return c
+}
+
+// WithAllowedQueryOptions sets the query options a query may set for itself, such as config.QueryOptionIncludeDeleted,
+// and returns the config. Without a call, DefaultQueryOptions are allowed; with no options, none are. Under
+// PolicyStrictAPI and in parses scoped by roles, @include_deleted is rejected even when allowed here.
+func (c *Config) WithAllowedQueryOptions(options ...string) *Config {
+	c = c.mutable()
+	c.AllowedQueryOptions = append([]string{}, options...)
+	return c
+}
+
+// QueryOptionAllowed reports whether a query may set the named query option, such as "include_deleted".
+func (c *Config) QueryOptionAllowed(option string) bool {
+	allowed := c.AllowedQueryOptions
+	if allowed == nil {
+		allowed = DefaultQueryOptions
+	}
+	return slices.Contains(allowed, option)
+}
+
+// WithOperatorAudit enables or disables the operator audit and returns the config. When enabled, every parse
+// result is scanned for operators outside the set the formatters are known to emit and rejected if it has any,
+// guarding against a formatter bug sending server-side JavaScript such as $where or $function to the server.
+func (c *Config) WithOperatorAudit(enabled bool) *Config {
+	c = c.mutable()
+	c.OperatorAudit = enabled
+	return c
+}
+
+// Err returns the first error recorded while building the config, such as an invalid schema passed to WithJSONSchema.
+func (c *Config) Err() error {
+	return c.err
+}
+
+// setErr records err unless an earlier error was already recorded.
+func (c *Config) setErr(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
@@ -1,7 +1,20 @@
 package config
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/kyle-williams-1/bsonic/metrics"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 // TestLanguageTypeConstants tests that the LanguageType constants are defined correctly
@@ -212,3 +225,1165 @@ func TestConfigDefaultValues(t *testing.T) {
 		t.Errorf("Expected default AutoConvertIDToObjectID true, got %v", config.AutoConvertIDToObjectID)
 	}
 }
+
+// TestConfigWithAllowedFields tests the WithAllowedFields fluent method
+func TestConfigWithAllowedFields(t *testing.T) {
+	config := Default()
+
+	if len(config.AllowedFields) != 0 {
+		t.Errorf("Expected default allowed fields to be empty, got %v", config.AllowedFields)
+	}
+
+	fields := []string{"name", "profile"}
+	result := config.WithAllowedFields(fields)
+	if result != config {
+		t.Error("Expected WithAllowedFields to return the same config instance")
+	}
+
+	if len(config.AllowedFields) != 2 || config.AllowedFields[0] != "name" || config.AllowedFields[1] != "profile" {
+		t.Errorf("Expected allowed fields %v, got %v", fields, config.AllowedFields)
+	}
+}
+
+// TestConfigTextSearchOptions tests the $text option fluent methods
+func TestConfigTextSearchOptions(t *testing.T) {
+	config := Default()
+
+	if config.TextLanguage != "" || config.TextCaseSensitive || config.TextDiacriticSensitive {
+		t.Errorf("Expected text search options to be unset by default, got %+v", config)
+	}
+
+	result := config.WithTextLanguage("fr").WithTextCaseSensitive(true).WithTextDiacriticSensitive(true)
+	if result != config {
+		t.Error("Expected text search methods to return the same config instance")
+	}
+
+	if config.TextLanguage != "fr" || !config.TextCaseSensitive || !config.TextDiacriticSensitive {
+		t.Errorf("Expected text search options to be set, got %+v", config)
+	}
+}
+
+// TestConfigWithTextSearchStrategy tests the text search strategy fluent methods
+func TestConfigWithTextSearchStrategy(t *testing.T) {
+	config := Default()
+
+	if config.TextSearchStrategy != StrategyRegexFields {
+		t.Errorf("Expected default text search strategy %s, got %s", StrategyRegexFields, config.TextSearchStrategy)
+	}
+
+	result := config.WithTextSearchStrategy(StrategyAtlasSearch).WithAtlasSearchIndex("products")
+	if result != config {
+		t.Error("Expected text search strategy methods to return the same config instance")
+	}
+
+	if config.TextSearchStrategy != StrategyAtlasSearch || config.AtlasSearchIndex != "products" {
+		t.Errorf("Expected Atlas Search strategy with index products, got %+v", config)
+	}
+}
+
+// TestConfigWithWeightedDefaultFields tests that weighted default fields are ordered by descending weight
+func TestConfigWithWeightedDefaultFields(t *testing.T) {
+	config := Default()
+
+	result := config.WithWeightedDefaultFields(Weighted{"body": 1, "title": 3, "summary": 1})
+	if result != config {
+		t.Error("Expected WithWeightedDefaultFields to return the same config instance")
+	}
+
+	expected := []string{"title", "body", "summary"}
+	if len(config.DefaultFields) != len(expected) {
+		t.Fatalf("Expected default fields %v, got %v", expected, config.DefaultFields)
+	}
+	for i, field := range expected {
+		if config.DefaultFields[i] != field {
+			t.Errorf("Expected default fields %v, got %v", expected, config.DefaultFields)
+			break
+		}
+	}
+
+	if config.DefaultFieldWeights["title"] != 3 {
+		t.Errorf("Expected title weight 3, got %d", config.DefaultFieldWeights["title"])
+	}
+}
+
+// TestConfigWithMultiWordMode tests the multiword free text mode fluent method
+func TestConfigWithMultiWordMode(t *testing.T) {
+	config := Default()
+
+	if config.MultiWordMode != MultiWordAny {
+		t.Errorf("Expected default multiword mode %s, got %s", MultiWordAny, config.MultiWordMode)
+	}
+
+	result := config.WithMultiWordMode(MultiWordAll)
+	if result != config {
+		t.Error("Expected WithMultiWordMode to return the same config instance")
+	}
+
+	if config.MultiWordMode != MultiWordAll {
+		t.Errorf("Expected multiword mode %s, got %s", MultiWordAll, config.MultiWordMode)
+	}
+}
+
+// TestConfigWithTextTokenizer tests the free text tokenizer fluent method
+func TestConfigWithTextTokenizer(t *testing.T) {
+	config := Default()
+
+	if config.TextTokenizer != nil {
+		t.Error("Expected no tokenizer by default")
+	}
+
+	result := config.WithTextTokenizer(strings.Fields)
+	if result != config {
+		t.Error("Expected WithTextTokenizer to return the same config instance")
+	}
+
+	if config.TextTokenizer == nil {
+		t.Error("Expected tokenizer to be set")
+	}
+}
+
+// TestConfigWithSubqueryResolver tests the IN_QUERY resolver fluent method
+func TestConfigWithSubqueryResolver(t *testing.T) {
+	config := Default()
+
+	if config.SubqueryResolver != nil {
+		t.Error("Expected no subquery resolver by default")
+	}
+
+	result := config.WithSubqueryResolver(func(_ context.Context, collection string, filter bson.M) ([]interface{}, error) {
+		return nil, nil
+	})
+	if result != config {
+		t.Error("Expected WithSubqueryResolver to return the same config instance")
+	}
+
+	if config.SubqueryResolver == nil {
+		t.Error("Expected subquery resolver to be set")
+	}
+}
+
+// TestConfigWithForeignRefs tests the foreign reference fluent method
+func TestConfigWithForeignRefs(t *testing.T) {
+	config := Default()
+
+	refs := map[string]ForeignRef{"author": {From: "users"}}
+	result := config.WithForeignRefs(refs)
+	if result != config {
+		t.Error("Expected WithForeignRefs to return the same config instance")
+	}
+
+	if config.ForeignRefs["author"].From != "users" {
+		t.Errorf("Expected author to reference users, got %+v", config.ForeignRefs)
+	}
+}
+
+// TestConfigWithLogger tests the logger fluent method
+func TestConfigWithLogger(t *testing.T) {
+	config := Default()
+
+	result := config.WithLogger(slog.DiscardHandler)
+	if result != config {
+		t.Error("Expected WithLogger to return the same config instance")
+	}
+	if config.Logger == nil {
+		t.Error("Expected logger to be set")
+	}
+
+	config.WithLogger(nil)
+	if config.Logger != nil {
+		t.Error("Expected nil handler to disable logging")
+	}
+
+	if config.LogQueries {
+		t.Error("Expected raw queries to be left out of logs by default")
+	}
+	if !config.WithQueryLogging(true).LogQueries {
+		t.Error("Expected WithQueryLogging to enable raw query logging")
+	}
+}
+
+// TestConfigWithTracerProvider tests the tracer provider fluent method
+func TestConfigWithTracerProvider(t *testing.T) {
+	config := Default()
+
+	provider := noop.NewTracerProvider()
+	result := config.WithTracerProvider(provider)
+	if result != config {
+		t.Error("Expected WithTracerProvider to return the same config instance")
+	}
+	if config.TracerProvider == nil {
+		t.Error("Expected tracer provider to be set")
+	}
+}
+
+// nopMetrics is a Metrics implementation that records nothing
+type nopMetrics struct{}
+
+func (nopMetrics) ParseCompleted(time.Duration, int) {}
+
+func (nopMetrics) ParseFailed(time.Duration, string) {}
+
+// TestConfigWithMetrics tests the metrics fluent method
+func TestConfigWithMetrics(t *testing.T) {
+	config := Default()
+
+	result := config.WithMetrics(nopMetrics{})
+	if result != config {
+		t.Error("Expected WithMetrics to return the same config instance")
+	}
+	if config.Metrics == nil {
+		t.Error("Expected metrics to be set")
+	}
+}
+
+// TestConfigWithUsageRecorder tests the usage recorder fluent method
+func TestConfigWithUsageRecorder(t *testing.T) {
+	config := Default()
+	if config.UsageRecorder != nil {
+		t.Error("Expected no usage recorder by default")
+	}
+
+	result := config.WithUsageRecorder(metrics.NewUsageCollector())
+	if result != config {
+		t.Error("Expected WithUsageRecorder to return the same config instance")
+	}
+	if config.UsageRecorder == nil {
+		t.Error("Expected the usage recorder to be set")
+	}
+}
+
+// TestConfigWithLegacyTextCompat tests the legacy text compatibility fluent method
+func TestConfigWithLegacyTextCompat(t *testing.T) {
+	config := Default()
+
+	result := config.WithLegacyTextCompat(true)
+	if result != config {
+		t.Error("Expected WithLegacyTextCompat to return the same config instance")
+	}
+	if !config.LegacyTextCompat {
+		t.Error("Expected legacy text compatibility to be enabled")
+	}
+}
+
+// TestConfigWithOutputVersion tests the output version fluent method
+func TestConfigWithOutputVersion(t *testing.T) {
+	config := Default()
+	if config.LegacyText() {
+		t.Error("Expected the default output version not to use legacy text")
+	}
+
+	result := config.WithOutputVersion(OutputVersion1)
+	if result != config {
+		t.Error("Expected WithOutputVersion to return the same config instance")
+	}
+	if !config.LegacyText() {
+		t.Error("Expected output version 1 to use legacy text")
+	}
+	if config.NormalizedLogic() || Default().WithOutputVersion(OutputVersion2).NormalizedLogic() {
+		t.Error("Expected output versions 1 and 2 not to normalize logical structure")
+	}
+	if !Default().NormalizedLogic() || !Default().WithOutputVersion(OutputVersion3).NormalizedLogic() {
+		t.Error("Expected the default and output version 3 to normalize logical structure")
+	}
+}
+
+// TestConfigWithFieldTypes tests the field types fluent method
+func TestConfigWithFieldTypes(t *testing.T) {
+	config := Default()
+
+	types := map[string]FieldType{"zip": FieldTypeString}
+	result := config.WithFieldTypes(types)
+	if result != config {
+		t.Error("Expected WithFieldTypes to return the same config instance")
+	}
+	if config.FieldTypes["zip"] != FieldTypeString {
+		t.Errorf("Expected zip to be a string field, got %v", config.FieldTypes)
+	}
+}
+
+func TestConfigWithJSONSchema(t *testing.T) {
+	schema := []byte(`{
+		"type": "object",
+		"properties": {
+			"zip": {"type": "string"},
+			"age": {"type": "integer"},
+			"active": {"type": ["boolean", "null"]},
+			"created_at": {"type": "string", "format": "date-time"},
+			"session": {"type": "string", "format": "uuid"},
+			"mixed": {"type": ["string", "number"]},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"address": {"type": "object", "properties": {"city": {"type": "string"}}},
+			"ref": {"$ref": "#/components/schemas/Ref"}
+		}
+	}`)
+
+	config := Default().WithFieldTypes(map[string]FieldType{"legacy_id": FieldTypeString, "zip": FieldTypeNumber})
+	result := config.WithJSONSchema(schema)
+	if result != config {
+		t.Error("Expected WithJSONSchema to return the same config instance")
+	}
+	if err := config.Err(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := map[string]FieldType{
+		"legacy_id":    FieldTypeString,
+		"zip":          FieldTypeString,
+		"age":          FieldTypeNumber,
+		"active":       FieldTypeBool,
+		"created_at":   FieldTypeDate,
+		"session":      FieldTypeUUID,
+		"tags":         FieldTypeString,
+		"address.city": FieldTypeString,
+	}
+	if len(config.FieldTypes) != len(expected) {
+		t.Errorf("Expected %v, got %v", expected, config.FieldTypes)
+	}
+	for field, fieldType := range expected {
+		if config.FieldTypes[field] != fieldType {
+			t.Errorf("Expected %s to be %q, got %q", field, fieldType, config.FieldTypes[field])
+		}
+	}
+	if !reflect.DeepEqual(config.ArrayFields, []string{"tags"}) {
+		t.Errorf("Expected tags to be an array field, got %v", config.ArrayFields)
+	}
+}
+
+func TestConfigWithArrayFields(t *testing.T) {
+	schema := []byte(`{"properties": {
+		"items": {"bsonType": "array", "items": {"properties": {"sizes": {"items": {"type": "number"}}}}},
+		"name": {"type": "string"}
+	}}`)
+
+	config := Default().WithArrayFields("legacy", "items").WithJSONSchema(schema)
+	if err := config.Err(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if expected := []string{"items", "items.sizes", "legacy"}; !reflect.DeepEqual(config.ArrayFields, expected) {
+		t.Errorf("Expected %v, got %v", expected, config.ArrayFields)
+	}
+
+	paths := map[string]string{
+		"items.0.price":   "items.price",
+		"matrix.0.12":     "matrix",
+		"items.01.price":  "items.01.price",
+		"0.name":          "0.name",
+		"items.-1.price":  "items.-1.price",
+		"profile.address": "profile.address",
+	}
+	for field, expected := range paths {
+		if got := SchemaPath(field); got != expected {
+			t.Errorf("SchemaPath(%q): expected %q, got %q", field, expected, got)
+		}
+	}
+}
+
+func TestConfigWithJSONSchemaMongoValidator(t *testing.T) {
+	schema := []byte(`{"$jsonSchema": {
+		"bsonType": "object",
+		"properties": {
+			"_id": {"bsonType": "objectId"},
+			"price": {"bsonType": "decimal"},
+			"published": {"bsonType": "date"},
+			"author": {"allOf": [{"bsonType": "object", "properties": {"id": {"bsonType": "objectId"}}}]}
+		}
+	}}`)
+
+	config := Default().WithJSONSchema(schema)
+	if err := config.Err(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := map[string]FieldType{
+		"_id":       FieldTypeObjectID,
+		"price":     FieldTypeNumber,
+		"published": FieldTypeDate,
+		"author.id": FieldTypeObjectID,
+	}
+	for field, fieldType := range expected {
+		if config.FieldTypes[field] != fieldType {
+			t.Errorf("Expected %s to be %q, got %q", field, fieldType, config.FieldTypes[field])
+		}
+	}
+}
+
+func TestConfigWithJSONSchemaInvalid(t *testing.T) {
+	for _, raw := range []string{`{`, `{"properties": {"age": {"type": 5}}}`} {
+		config := Default().WithJSONSchema([]byte(raw))
+		if config.Err() == nil {
+			t.Errorf("Expected an error for %s", raw)
+		}
+		if config.FieldTypes != nil {
+			t.Errorf("Expected no field types for %s, got %v", raw, config.FieldTypes)
+		}
+	}
+}
+
+func TestConfigWithEnumField(t *testing.T) {
+	config := Default()
+
+	result := config.WithEnumField("status", "active", "closed").WithEnumField("priority", "low", "high")
+	if result != config {
+		t.Error("Expected WithEnumField to return the same config instance")
+	}
+	if len(config.EnumFields) != 2 || len(config.EnumFields["status"]) != 2 || config.EnumFields["priority"][1] != "high" {
+		t.Errorf("Expected status and priority enums, got %v", config.EnumFields)
+	}
+}
+
+func TestConfigWithRejectEnumWildcards(t *testing.T) {
+	config := Default()
+	if config.RejectEnumWildcards {
+		t.Error("Expected enum wildcards to be allowed by default")
+	}
+
+	result := config.WithRejectEnumWildcards(true)
+	if result != config {
+		t.Error("Expected WithRejectEnumWildcards to return the same config instance")
+	}
+	if !config.RejectEnumWildcards {
+		t.Error("Expected enum wildcards to be rejected")
+	}
+}
+
+func TestConfigWithBoolCoercion(t *testing.T) {
+	config := Default()
+	if config.BoolCoercion != BoolCoercionAlways {
+		t.Errorf("Expected default bool coercion to be always, got %q", config.BoolCoercion)
+	}
+
+	result := config.WithBoolCoercion(BoolCoercionSchema).WithFieldBoolCoercion("active", BoolCoercionAlways)
+	if result != config {
+		t.Error("Expected WithBoolCoercion to return the same config instance")
+	}
+	if config.BoolCoercion != BoolCoercionSchema {
+		t.Errorf("Expected bool coercion to be schema, got %q", config.BoolCoercion)
+	}
+	if config.FieldBoolCoercion["active"] != BoolCoercionAlways {
+		t.Errorf("Expected active to coerce booleans, got %v", config.FieldBoolCoercion)
+	}
+}
+
+func TestConfigWithAccentInsensitive(t *testing.T) {
+	config := Default()
+	if config.AccentInsensitive {
+		t.Error("Expected accent-insensitive matching to be disabled by default")
+	}
+
+	result := config.WithAccentInsensitive(true)
+	if result != config {
+		t.Error("Expected WithAccentInsensitive to return the same config instance")
+	}
+	if !config.AccentInsensitive {
+		t.Error("Expected accent-insensitive matching to be enabled")
+	}
+}
+
+func TestConfigWithDurationUnit(t *testing.T) {
+	config := Default()
+	if config.DurationUnit != 0 {
+		t.Errorf("Expected duration literals to be disabled by default, got %v", config.DurationUnit)
+	}
+
+	result := config.WithDurationUnit(time.Millisecond)
+	if result != config {
+		t.Error("Expected WithDurationUnit to return the same config instance")
+	}
+	if config.DurationUnit != time.Millisecond {
+		t.Errorf("Expected duration unit to be milliseconds, got %v", config.DurationUnit)
+	}
+}
+
+func TestConfigWithCurrencyConverter(t *testing.T) {
+	config := Default()
+	if config.CurrencyConverter != nil {
+		t.Error("Expected money literals to be disabled by default")
+	}
+
+	result := config.WithCurrencyConverter(StripCurrency)
+	if result != config {
+		t.Error("Expected WithCurrencyConverter to return the same config instance")
+	}
+	if amount, err := config.CurrencyConverter(10.5, "USD"); err != nil || amount != 10.5 {
+		t.Errorf("Expected StripCurrency to keep the amount, got %v, %v", amount, err)
+	}
+}
+
+func TestConfigWithLenientErrors(t *testing.T) {
+	config := Default()
+	if config.LenientErrors {
+		t.Error("Expected lenient errors to be disabled by default")
+	}
+
+	result := config.WithLenientErrors(true)
+	if result != config {
+		t.Error("Expected WithLenientErrors to return the same config instance")
+	}
+	if !config.LenientErrors {
+		t.Error("Expected lenient errors to be enabled")
+	}
+}
+
+func TestConfigWithLowercaseOperators(t *testing.T) {
+	config := Default()
+	if config.LowercaseOperators {
+		t.Error("Expected lowercase operators to be disabled by default")
+	}
+
+	result := config.WithLowercaseOperators(true)
+	if result != config {
+		t.Error("Expected WithLowercaseOperators to return the same config instance")
+	}
+	if !config.LowercaseOperators {
+		t.Error("Expected lowercase operators to be enabled")
+	}
+}
+
+// TestConfigValidate tests that Validate reports contradictions and invalid values
+func TestConfigValidate(t *testing.T) {
+	if err := Default().WithDefaultFields([]string{"name"}).Validate(); err != nil {
+		t.Errorf("Expected a consistent config to be valid, got: %v", err)
+	}
+	if err := Default().WithTextSearchStrategy(StrategyTextIndex).Validate(); err != nil {
+		t.Errorf("Expected the text index strategy to be valid without default fields, got: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		config   *Config
+		expected []string
+	}{
+		{"RegexStrategyWithoutDefaultFields", Default(), []string{`text search strategy "regex_fields" needs default fields`}},
+		{"DefaultFieldNotAllowed", Default().WithDefaultFields([]string{"name", "bio"}).WithAllowedFields([]string{"name"}),
+			[]string{"default field bio is not in the allowed fields"}},
+		{"EnumFieldNotAllowed", Default().WithDefaultFields([]string{"name"}).WithAllowedFields([]string{"name", "user"}).
+			WithEnumField("user.role", "admin").WithEnumField("status", "active"),
+			[]string{"enum field status is not in the allowed fields"}},
+		{"LegacyWithOutputVersion2", Default().WithDefaultFields([]string{"name"}).WithLegacyTextCompat(true).WithOutputVersion(OutputVersion2),
+			[]string{"legacy text compatibility contradicts output version 2"}},
+		{"InvalidValues", Default().WithLanguage("sql").WithTextSearchStrategy("vector").WithMultiWordMode("most").
+			WithOutputVersion(9).WithBoolCoercion("never"),
+			[]string{`unsupported language: "sql"`, `unsupported text search strategy: "vector"`, `unsupported multiword mode: "most"`,
+				"unsupported output version: 9", `unsupported bool coercion: "never"`}},
+		{"InvalidFields", Default().WithWeightedDefaultFields(Weighted{"title": 0}).
+			WithFieldTypes(map[string]FieldType{"age": "integer", "status": FieldTypeNumber}).WithEnumField("status").
+			WithForeignRefs(map[string]ForeignRef{"author": {}}),
+			[]string{"default field title has a weight of 0", `field age has unsupported type "integer"`, "enum field status allows no values",
+				`enum field status is typed "number"`, "foreign reference author has no collection"}},
+		{"RecordedError", Default().WithDefaultFields([]string{"name"}).WithJSONSchema([]byte("{")), []string{"schema"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if err == nil {
+				t.Fatal("Expected Validate to return an error")
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("Expected error to contain %q, got: %v", expected, err)
+				}
+			}
+		})
+	}
+}
+
+// TestConfigFreeze tests that a frozen config is an independent snapshot that With methods copy
+func TestConfigFreeze(t *testing.T) {
+	fields := []string{"name"}
+	config := Default().WithDefaultFields(fields).WithEnumField("status", "active")
+	if config.Frozen() {
+		t.Error("Expected a new config not to be frozen")
+	}
+
+	frozen := config.Freeze()
+	if !frozen.Frozen() || frozen == config {
+		t.Fatal("Expected Freeze to return a frozen copy")
+	}
+	if frozen.Freeze() != frozen {
+		t.Error("Expected freezing a frozen config to return it")
+	}
+
+	fields[0] = "title"
+	config.WithEnumField("status", "inactive").WithAllowedFields([]string{"name"})
+	if frozen.DefaultFields[0] != "name" || frozen.EnumFields["status"][0] != "active" || len(frozen.AllowedFields) != 0 {
+		t.Errorf("Expected the snapshot not to change with the original config, got %+v", frozen)
+	}
+
+	changed := frozen.WithMultiWordMode(MultiWordAll)
+	if changed == frozen || changed.Frozen() {
+		t.Fatal("Expected a With method on a frozen config to return an unfrozen copy")
+	}
+	if frozen.MultiWordMode != MultiWordAny || changed.MultiWordMode != MultiWordAll {
+		t.Errorf("Expected only the copy to change, got %q and %q", frozen.MultiWordMode, changed.MultiWordMode)
+	}
+	if changed.DefaultFields[0] != "name" {
+		t.Errorf("Expected the copy to keep the snapshot's settings, got %v", changed.DefaultFields)
+	}
+}
+
+// TestFileProvider tests that a FileProvider reloads a changed file and keeps the last valid config
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowed.txt")
+	version := 0
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		// Make the change visible even on file systems with coarse modification times
+		version++
+		later := time.Now().Add(time.Duration(version) * time.Minute)
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load := func(data []byte) (*Config, error) {
+		if len(data) == 0 {
+			return nil, errors.New("empty allowlist")
+		}
+		return Default().WithAllowedFields(strings.Fields(string(data))), nil
+	}
+	waitFor := func(condition func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !condition() {
+			if time.Now().After(deadline) {
+				t.Fatal("Timed out waiting for the provider to reload")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	if _, err := NewFileProvider(path, load); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+
+	write("name")
+	reloads := make(chan error, 10)
+	provider, err := NewFileProvider(path, load, WithReloadInterval(10*time.Millisecond), WithReloadHook(func(_ *Config, err error) {
+		reloads <- err
+	}))
+	if err != nil {
+		t.Fatalf("NewFileProvider should not return error, got: %v", err)
+	}
+	defer provider.Close()
+
+	first := provider.Config()
+	if !first.Frozen() || len(first.AllowedFields) != 1 || first.AllowedFields[0] != "name" {
+		t.Fatalf("Expected a frozen config allowing name, got %+v", first)
+	}
+	if provider.Config() != first {
+		t.Error("Expected the same config until the file changes")
+	}
+
+	write("name email")
+	waitFor(func() bool { return len(provider.Config().AllowedFields) == 2 })
+	if err := <-reloads; err != nil {
+		t.Errorf("Expected the reload to succeed, got: %v", err)
+	}
+
+	write("")
+	if err := <-reloads; err == nil {
+		t.Error("Expected the reload hook to report the invalid file")
+	}
+	if provider.Err() == nil || len(provider.Config().AllowedFields) != 2 {
+		t.Errorf("Expected the previous config to be kept with an error, got %v and %+v", provider.Err(), provider.Config())
+	}
+
+	if err := provider.Close(); err != nil {
+		t.Errorf("Close should not return error, got: %v", err)
+	}
+	if provider.Config() == nil {
+		t.Error("Expected the last config to stay available after Close")
+	}
+}
+
+func TestFromYAML(t *testing.T) {
+	dir := t.TempDir()
+	schema := `{"properties": {"age": {"type": "integer"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "schema.json"), []byte(schema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "bsonic.yaml")
+	content := `language: lucene
+formatter: mongo
+default_fields: [name, email]
+allowed_fields: [name, email, status, age, created]
+text_search_strategy: text_index
+text_case_sensitive: true
+output_version: 2
+field_types:
+  created: date
+json_schema: schema.json
+enum_fields:
+  status: [active, inactive]
+duration_unit: 1s
+`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := FromYAML(path)
+	if err != nil {
+		t.Fatalf("FromYAML should not return error, got: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.DefaultFields, []string{"name", "email"}) {
+		t.Errorf("Expected default fields [name email], got %v", cfg.DefaultFields)
+	}
+	if cfg.TextSearchStrategy != StrategyTextIndex || !cfg.TextCaseSensitive || cfg.OutputVersion != 2 {
+		t.Errorf("Expected text settings and output version to be loaded, got %+v", cfg)
+	}
+	if cfg.FieldTypes["created"] != FieldType("date") || cfg.FieldTypes["age"] == "" {
+		t.Errorf("Expected field types from the file and the schema, got %v", cfg.FieldTypes)
+	}
+	if !reflect.DeepEqual(cfg.EnumFields["status"], []string{"active", "inactive"}) {
+		t.Errorf("Expected status enum values, got %v", cfg.EnumFields)
+	}
+	if cfg.DurationUnit != time.Second {
+		t.Errorf("Expected a one second duration unit, got %v", cfg.DurationUnit)
+	}
+	if !cfg.ReplaceIDWithMongoID {
+		t.Error("Expected unset settings to keep their defaults")
+	}
+
+	if cfg, err := ParseYAML([]byte("default_fields: [name]")); err != nil || cfg.Language != LanguageLucene || cfg.Formatter != FormatterMongo {
+		t.Errorf("Expected a minimal document to keep the default language and formatter, got %v, %v", cfg, err)
+	}
+	if _, err := ParseYAML(nil); err == nil {
+		t.Error("Expected an empty document to fail validation without default fields")
+	}
+
+	for name, content := range map[string]string{
+		"UnknownKey":      "default_feilds: [name]",
+		"InvalidLanguage": "language: sql",
+		"InvalidDuration": "duration_unit: soon",
+		"NotAllowed":      "default_fields: [name]\nallowed_fields: [email]",
+		"MissingSchema":   "json_schema: missing.json",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseYAML([]byte(content)); err == nil {
+				t.Errorf("Expected an error for %q", content)
+			}
+		})
+	}
+
+	if _, err := FromYAML(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("BSONIC_DEFAULT_FIELDS", "name, email")
+	t.Setenv("BSONIC_WEIGHTED_DEFAULT_FIELDS", "name=3,email=1")
+	t.Setenv("BSONIC_REPLACE_ID_WITH_MONGO_ID", "false")
+	t.Setenv("BSONIC_OUTPUT_VERSION", "2")
+	t.Setenv("BSONIC_FIELD_TYPES", "age=number")
+	t.Setenv("BSONIC_ENUM_FIELDS", "status=active,inactive;role=admin,user")
+
+	cfg, err := FromEnv("BSONIC")
+	if err != nil {
+		t.Fatalf("FromEnv should not return error, got: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.DefaultFields, []string{"name", "email"}) {
+		t.Errorf("Expected default fields [name email], got %v", cfg.DefaultFields)
+	}
+	if cfg.DefaultFieldWeights["name"] != 3 || cfg.ReplaceIDWithMongoID || cfg.OutputVersion != 2 {
+		t.Errorf("Expected weights, id replacement and output version to be loaded, got %+v", cfg)
+	}
+	if cfg.FieldTypes["age"] != FieldType("number") {
+		t.Errorf("Expected age to be a number field, got %v", cfg.FieldTypes)
+	}
+	if !reflect.DeepEqual(cfg.EnumFields["role"], []string{"admin", "user"}) {
+		t.Errorf("Expected role enum values, got %v", cfg.EnumFields)
+	}
+
+	t.Setenv("OTHER_TEXT_SEARCH_STRATEGY", "text_index")
+	if cfg, err := FromEnv("OTHER_"); err != nil || len(cfg.DefaultFields) != 0 || !cfg.ReplaceIDWithMongoID {
+		t.Errorf("Expected only variables with the prefix to be read, got %v, %v", cfg, err)
+	}
+
+	t.Setenv("BSONIC_OUTPUT_VERSION", "two")
+	if _, err := FromEnv("BSONIC"); err == nil || !strings.Contains(err.Error(), "BSONIC_OUTPUT_VERSION") {
+		t.Errorf("Expected an error naming the variable, got %v", err)
+	}
+}
+
+func TestConfigPolicy(t *testing.T) {
+	strict := Default().WithLenientErrors(true).WithPolicy(PolicyStrictAPI)
+	if strict.Policy != PolicyStrictAPI || strict.MaxQueryLength != 512 || strict.MaxClauses != 16 || strict.MaxLimit != 100 {
+		t.Errorf("Expected the strict API limits, got %+v", strict)
+	}
+	if !reflect.DeepEqual(strict.ForbiddenOperators, []string{"$regex"}) {
+		t.Errorf("Expected $regex to be forbidden, got %v", strict.ForbiddenOperators)
+	}
+	if strict.BoolCoercion != BoolCoercionSchema || !strict.RejectEnumWildcards || strict.LenientErrors {
+		t.Errorf("Expected the strict API coercion settings to replace earlier ones, got %+v", strict)
+	}
+
+	analyst := Default().WithPolicy(PolicyAnalyst).WithMaxLimit(500)
+	if !analyst.LenientErrors || len(analyst.ForbiddenOperators) != 0 || analyst.MaxLimit != 500 {
+		t.Errorf("Expected analyst settings with an overridden limit, got %+v", analyst)
+	}
+
+	internal := Default().WithPolicy(PolicyStrictAPI).WithPolicy(PolicyInternal)
+	if internal.MaxQueryLength != 0 || internal.MaxClauses != 0 || internal.MaxLimit != 0 || internal.ForbiddenOperators != nil {
+		t.Errorf("Expected the internal policy to lift every limit, got %+v", internal)
+	}
+
+	if err := Default().WithPolicy("lax").Err(); err == nil || !strings.Contains(err.Error(), "unknown policy") {
+		t.Errorf("Expected an unknown policy error, got %v", err)
+	}
+
+	invalid := Default().WithDefaultFields([]string{"name"}).
+		WithMaxQueryLength(-1).
+		WithMaxClauses(-1).
+		WithMaxLimit(-1).
+		WithForbiddenOperators("regex")
+	err := invalid.Validate()
+	for _, expected := range []string{"maximum query length", "maximum clauses", "maximum limit", `forbidden operator "regex"`} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected a validation error containing %q, got %v", expected, err)
+		}
+	}
+
+	loaded, err := ParseYAML([]byte("policy: strict_api\ndefault_fields: [name]\nmax_limit: 20"))
+	if err != nil {
+		t.Fatalf("ParseYAML should not return error, got: %v", err)
+	}
+	if loaded.Policy != PolicyStrictAPI || loaded.MaxLimit != 20 || loaded.MaxClauses != 16 {
+		t.Errorf("Expected the policy with an overridden limit, got %+v", loaded)
+	}
+}
+
+func TestConfigOperatorAudit(t *testing.T) {
+	if Default().OperatorAudit {
+		t.Error("Expected the operator audit to be disabled by default")
+	}
+	if !Default().WithOperatorAudit(true).OperatorAudit {
+		t.Error("Expected WithOperatorAudit(true) to enable the operator audit")
+	}
+
+	loaded, err := ParseYAML([]byte("default_fields: [name]\noperator_audit: true"))
+	if err != nil {
+		t.Fatalf("ParseYAML should not return error, got: %v", err)
+	}
+	if !loaded.OperatorAudit {
+		t.Error("Expected operator_audit to enable the operator audit")
+	}
+}
+
+func TestConfigMaxPathDepth(t *testing.T) {
+	if Default().MaxPathDepth != 0 {
+		t.Error("Expected no maximum path depth by default")
+	}
+	if Default().WithMaxPathDepth(4).MaxPathDepth != 4 {
+		t.Error("Expected WithMaxPathDepth to set the maximum path depth")
+	}
+
+	err := Default().WithDefaultFields([]string{"name"}).WithMaxPathDepth(-1).Validate()
+	if err == nil || !strings.Contains(err.Error(), "maximum path depth") {
+		t.Errorf("Expected a negative path depth validation error, got %v", err)
+	}
+
+	loaded, err := ParseYAML([]byte("default_fields: [name]\nmax_path_depth: 3"))
+	if err != nil {
+		t.Fatalf("ParseYAML should not return error, got: %v", err)
+	}
+	if loaded.MaxPathDepth != 3 {
+		t.Errorf("Expected max_path_depth to set the maximum path depth, got %d", loaded.MaxPathDepth)
+	}
+}
+
+func TestConfigRegexPolicies(t *testing.T) {
+	if Default().MaxRegexClauses != 0 || Default().RejectLeadingWildcards {
+		t.Error("Expected no regex policies by default")
+	}
+	c := Default().WithMaxRegexClauses(3).WithRejectLeadingWildcards(true)
+	if c.MaxRegexClauses != 3 || !c.RejectLeadingWildcards {
+		t.Errorf("Expected the regex policies to be set, got %d and %v", c.MaxRegexClauses, c.RejectLeadingWildcards)
+	}
+
+	err := Default().WithDefaultFields([]string{"name"}).WithMaxRegexClauses(-1).Validate()
+	if err == nil || !strings.Contains(err.Error(), "maximum regex clauses") {
+		t.Errorf("Expected a negative regex clause validation error, got %v", err)
+	}
+
+	loaded, err := ParseYAML([]byte("default_fields: [name]\nmax_regex_clauses: 2\nreject_leading_wildcards: true"))
+	if err != nil {
+		t.Fatalf("ParseYAML should not return error, got: %v", err)
+	}
+	if loaded.MaxRegexClauses != 2 || !loaded.RejectLeadingWildcards {
+		t.Errorf("Expected the regex policies to load, got %d and %v", loaded.MaxRegexClauses, loaded.RejectLeadingWildcards)
+	}
+}
+
+func TestConfigNumberSeparators(t *testing.T) {
+	if Default().DecimalSeparator != "" || Default().ThousandsSeparator != "" || Default().StrictNumbers {
+		t.Error("Expected standard number notation by default")
+	}
+	c := Default().WithNumberSeparators(",", ".").WithStrictNumbers(true)
+	if c.DecimalSeparator != "," || c.ThousandsSeparator != "." || !c.StrictNumbers {
+		t.Errorf("Expected the number separators to be set, got %q, %q and %v", c.DecimalSeparator, c.ThousandsSeparator, c.StrictNumbers)
+	}
+
+	invalid := []struct {
+		config *Config
+		msg    string
+	}{
+		{Default().WithNumberSeparators(",,", "."), "decimal separator must be a single character"},
+		{Default().WithNumberSeparators(",", "0"), "thousands separator must be a single character"},
+		{Default().WithNumberSeparators("-", ""), "decimal separator must be a single character"},
+		{Default().WithNumberSeparators("", "."), "needs a decimal separator"},
+		{Default().WithNumberSeparators(",", ","), "must differ"},
+		{Default().WithStrictNumbers(true), "strict numbers need a decimal separator"},
+	}
+	for _, tt := range invalid {
+		err := tt.config.WithDefaultFields([]string{"name"}).Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("Expected a validation error containing %q, got %v", tt.msg, err)
+		}
+	}
+	if err := Default().WithDefaultFields([]string{"name"}).WithNumberSeparators(",", "").Validate(); err != nil {
+		t.Errorf("Expected a decimal separator without thousands separator to be valid, got %v", err)
+	}
+
+	loaded, err := ParseYAML([]byte("default_fields: [name]\ndecimal_separator: \",\"\nthousands_separator: \".\"\nstrict_numbers: true"))
+	if err != nil {
+		t.Fatalf("ParseYAML should not return error, got: %v", err)
+	}
+	if loaded.DecimalSeparator != "," || loaded.ThousandsSeparator != "." || !loaded.StrictNumbers {
+		t.Errorf("Expected the number separators to load, got %q, %q and %v", loaded.DecimalSeparator, loaded.ThousandsSeparator, loaded.StrictNumbers)
+	}
+
+	t.Setenv("BSONIC_DEFAULT_FIELDS", "name")
+	t.Setenv("BSONIC_DECIMAL_SEPARATOR", ",")
+	t.Setenv("BSONIC_THOUSANDS_SEPARATOR", ".")
+	fromEnv, err := FromEnv("BSONIC_")
+	if err != nil {
+		t.Fatalf("FromEnv should not return error, got: %v", err)
+	}
+	if fromEnv.DecimalSeparator != "," || fromEnv.ThousandsSeparator != "." {
+		t.Errorf("Expected the number separators to load from the environment, got %q and %q", fromEnv.DecimalSeparator, fromEnv.ThousandsSeparator)
+	}
+}
+
+func TestConfigCoercers(t *testing.T) {
+	upper := ValueCoercerFunc(func(field string, value interface{}) (interface{}, error) { return value, nil })
+	c := Default().WithCoercer("sku", upper).WithTypeCoercer(FieldTypeString, upper)
+	if c.FieldCoercers["sku"] == nil || c.TypeCoercers[FieldTypeString] == nil {
+		t.Errorf("Expected the coercers to be set, got %v and %v", c.FieldCoercers, c.TypeCoercers)
+	}
+	if c.WithCoercer("sku", nil); c.FieldCoercers["sku"] != nil {
+		t.Error("Expected WithCoercer(field, nil) to remove the coercer")
+	}
+
+	frozen := Default().WithCoercer("sku", upper).Freeze()
+	if updated := frozen.WithCoercer("phone", upper); updated == frozen || len(frozen.FieldCoercers) != 1 {
+		t.Error("Expected WithCoercer to leave a frozen config unchanged")
+	}
+
+	err := Default().WithDefaultFields([]string{"name"}).WithTypeCoercer("money", upper).Validate()
+	if err == nil || !strings.Contains(err.Error(), `value coercer for unsupported type "money"`) {
+		t.Errorf("Expected a validation error for the unsupported type, got %v", err)
+	}
+}
+
+func TestConfigPhoneCoercer(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  PhoneOptions
+		value interface{}
+		want  interface{}
+	}{
+		{"Formatted", PhoneOptions{CountryCode: "1"}, "(555) 123-4567", "+15551234567"},
+		{"Dotted", PhoneOptions{CountryCode: "1"}, "555.123.4567", "+15551234567"},
+		{"WithCountryCode", PhoneOptions{CountryCode: "1"}, "1-555-123-4567", "+15551234567"},
+		{"DetectedNumber", PhoneOptions{CountryCode: "1"}, float64(5551234567), "+15551234567"},
+		{"TrunkPrefix", PhoneOptions{CountryCode: "44"}, "020 7946 0958", "+442079460958"},
+		{"InternationalPrefix", PhoneOptions{CountryCode: "1"}, "0044 20 7946 0958", "+442079460958"},
+		{"Plus", PhoneOptions{}, "+44 (0)20 7946 0958", "+442079460958"},
+		{"NationalWithoutCountryCode", PhoneOptions{}, "020 7946 0958", "020 7946 0958"},
+		{"NotAPhoneNumber", PhoneOptions{CountryCode: "1"}, "call me", "call me"},
+		{"TooShort", PhoneOptions{CountryCode: "1"}, "12", "12"},
+		{"TooLong", PhoneOptions{CountryCode: "1"}, "+1234567890123456", "+1234567890123456"},
+		{"Formats", PhoneOptions{CountryCode: "44", Formats: true}, "020 7946 0958",
+			AnyOf{"+442079460958", "442079460958", "00442079460958", "2079460958", "02079460958"}},
+		{"NorthAmericanFormats", PhoneOptions{CountryCode: "1", Formats: true}, "5551234567",
+			AnyOf{"+15551234567", "15551234567", "0015551234567", "5551234567", "(555) 123-4567", "555-123-4567",
+				"555.123.4567", "555 123 4567", "+1 555-123-4567", "+1 (555) 123-4567"}},
+		{"ForeignFormats", PhoneOptions{CountryCode: "1", Formats: true}, "+442079460958",
+			AnyOf{"+442079460958", "442079460958", "00442079460958"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PhoneCoercer(tt.opts).Coerce("phone", tt.value)
+			if err != nil {
+				t.Fatalf("Coerce should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Coerce(%v): expected %v, got %v", tt.value, tt.want, got)
+			}
+		})
+	}
+
+	c := Default().WithFieldTypes(map[string]FieldType{"name": FieldTypeString}).WithPhoneFields(PhoneOptions{CountryCode: "1"}, "phone", "contacts.phone")
+	if c.FieldTypes["name"] != FieldTypeString || c.FieldTypes["phone"] != FieldTypePhone || c.FieldTypes["contacts.phone"] != FieldTypePhone {
+		t.Errorf("Expected the phone fields to be typed, got %v", c.FieldTypes)
+	}
+	if c.TypeCoercers[FieldTypePhone] == nil {
+		t.Error("Expected WithPhoneFields to set the phone coercer")
+	}
+}
+
+func TestConfigEmailFields(t *testing.T) {
+	c := Default().WithFieldTypes(map[string]FieldType{"name": FieldTypeString}).WithEmailFields("email", "contacts.email")
+	if c.FieldTypes["name"] != FieldTypeString || c.FieldTypes["email"] != FieldTypeEmail || c.FieldTypes["contacts.email"] != FieldTypeEmail {
+		t.Errorf("Expected the email fields to be typed, got %v", c.FieldTypes)
+	}
+	if err := c.WithDefaultFields([]string{"name"}).Validate(); err != nil {
+		t.Errorf("Expected email fields to be valid, got %v", err)
+	}
+}
+
+func TestConfigSoftDeleteField(t *testing.T) {
+	if Default().SoftDeleteField != "" {
+		t.Error("Expected no soft delete field by default")
+	}
+	if Default().WithSoftDeleteField("deleted_at").SoftDeleteField != "deleted_at" {
+		t.Error("Expected WithSoftDeleteField to set the soft delete field")
+	}
+
+	loaded, err := ParseYAML([]byte("default_fields: [name]\nsoft_delete_field: deleted_at"))
+	if err != nil {
+		t.Fatalf("ParseYAML should not return error, got: %v", err)
+	}
+	if loaded.SoftDeleteField != "deleted_at" {
+		t.Errorf("Expected the soft delete field to load, got %q", loaded.SoftDeleteField)
+	}
+}
+
+func TestConfigUnselectiveFields(t *testing.T) {
+	if len(Default().UnselectiveFields) != 0 {
+		t.Error("Expected no unselective fields by default")
+	}
+
+	base := Default().WithUnselectiveFields("status", "active")
+	frozen := base.Freeze()
+	base.UnselectiveFields[0] = "role"
+	if frozen.UnselectiveFields[0] != "status" {
+		t.Errorf("Expected the frozen unselective fields to be copied, got %v", frozen.UnselectiveFields)
+	}
+
+	loaded, err := ParseYAML([]byte("default_fields: [name]\nunselective_fields: [status, active]"))
+	if err != nil {
+		t.Fatalf("ParseYAML should not return error, got: %v", err)
+	}
+	if len(loaded.UnselectiveFields) != 2 || loaded.UnselectiveFields[1] != "active" {
+		t.Errorf("Expected the unselective fields to load, got %v", loaded.UnselectiveFields)
+	}
+}
+
+func TestConfigWithDeprecatedField(t *testing.T) {
+	if len(Default().DeprecatedFields) != 0 {
+		t.Error("Expected no deprecated fields by default")
+	}
+
+	cfg := Default().WithDeprecatedField("username", "user.name").WithDeprecatedField("mail", "email")
+	if len(cfg.DeprecatedFields) != 2 || cfg.DeprecatedFields["username"] != "user.name" || cfg.DeprecatedFields["mail"] != "email" {
+		t.Errorf("Expected both renames, got %v", cfg.DeprecatedFields)
+	}
+	frozen := cfg.Freeze()
+	cfg.DeprecatedFields["mail"] = "contact.email"
+	if frozen.DeprecatedFields["mail"] != "email" {
+		t.Errorf("Expected the frozen deprecated fields to be copied, got %v", frozen.DeprecatedFields)
+	}
+
+	invalid := []struct {
+		cfg  *Config
+		want string
+	}{
+		{Default().WithDeprecatedField("username", ""), "deprecated field username has no replacement"},
+		{Default().WithDeprecatedField("username", "username"), "deprecated field username is renamed to itself"},
+		{Default().WithAllowedFields([]string{"name"}).WithDefaultFields([]string{"name"}).WithDeprecatedField("username", "user.name"),
+			"deprecated field username is renamed to user.name, which is not in the allowed fields"},
+	}
+	for _, tt := range invalid {
+		if err := tt.cfg.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Expected %q, got: %v", tt.want, err)
+		}
+	}
+
+	loaded, err := ParseYAML([]byte("default_fields: [name]\ndeprecated_fields:\n  username: user.name"))
+	if err != nil {
+		t.Fatalf("ParseYAML should not return error, got: %v", err)
+	}
+	if loaded.DeprecatedFields["username"] != "user.name" {
+		t.Errorf("Expected the deprecated fields to load, got %v", loaded.DeprecatedFields)
+	}
+}
+
+func TestConfigWithConflictPolicy(t *testing.T) {
+	if Default().ConflictPolicy != ConflictKeep {
+		t.Errorf("Expected conflicting conditions to be kept by default, got %q", Default().ConflictPolicy)
+	}
+	if policy := Default().WithConflictPolicy(ConflictLastWins).ConflictPolicy; policy != ConflictLastWins {
+		t.Errorf("Expected WithConflictPolicy to set the policy, got %q", policy)
+	}
+
+	err := Default().WithDefaultFields([]string{"name"}).WithConflictPolicy("first_wins").Validate()
+	if err == nil || !strings.Contains(err.Error(), `unsupported conflict policy: "first_wins"`) {
+		t.Errorf("Expected an unsupported conflict policy error, got: %v", err)
+	}
+
+	loaded, err := ParseYAML([]byte("default_fields: [name]\nconflict_policy: error"))
+	if err != nil {
+		t.Fatalf("ParseYAML should not return error, got: %v", err)
+	}
+	if loaded.ConflictPolicy != ConflictError {
+		t.Errorf("Expected the conflict policy to load, got %q", loaded.ConflictPolicy)
+	}
+}
+
+func TestConfigExplicitEquality(t *testing.T) {
+	if Default().ExplicitEquality {
+		t.Error("Expected explicit equality to be disabled by default")
+	}
+	if !Default().WithExplicitEquality(true).ExplicitEquality {
+		t.Error("Expected WithExplicitEquality(true) to enable explicit equality")
+	}
+
+	loaded, err := ParseYAML([]byte("default_fields: [name]\nexplicit_equality: true"))
+	if err != nil {
+		t.Fatalf("ParseYAML should not return error, got: %v", err)
+	}
+	if !loaded.ExplicitEquality {
+		t.Error("Expected explicit_equality to enable explicit equality")
+	}
+}
+
+func TestConfigWithAllowedQueryOptions(t *testing.T) {
+	if Default().QueryOptionAllowed(QueryOptionIncludeDeleted) || !Default().QueryOptionAllowed(QueryOptionLimit) {
+		t.Error("Expected every query option but include_deleted to be allowed by default")
+	}
+	cfg := Default().WithAllowedQueryOptions(QueryOptionIncludeDeleted)
+	if !cfg.QueryOptionAllowed(QueryOptionIncludeDeleted) || cfg.QueryOptionAllowed(QueryOptionLimit) {
+		t.Errorf("Expected only include_deleted to be allowed, got %v", cfg.AllowedQueryOptions)
+	}
+	if Default().WithAllowedQueryOptions().QueryOptionAllowed(QueryOptionLimit) {
+		t.Error("Expected no query options to be allowed after WithAllowedQueryOptions()")
+	}
+
+	err := Default().WithDefaultFields([]string{"name"}).WithAllowedQueryOptions("archived").Validate()
+	if err == nil || !strings.Contains(err.Error(), `unknown query option: "archived"`) {
+		t.Errorf("Expected an unknown query option error, got: %v", err)
+	}
+
+	loaded, err := ParseYAML([]byte("default_fields: [name]\nallowed_query_options: [include_deleted, limit]"))
+	if err != nil {
+		t.Fatalf("ParseYAML should not return error, got: %v", err)
+	}
+	if !loaded.QueryOptionAllowed(QueryOptionIncludeDeleted) || loaded.QueryOptionAllowed(QueryOptionCaseSensitive) {
+		t.Errorf("Expected the allowed query options to load, got %v", loaded.AllowedQueryOptions)
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+// Freeze returns an immutable snapshot of the config, which the parser takes when it is created, so
+// changing the config afterwards cannot race with queries being parsed. With methods called on a
+// frozen config leave it unchanged and return a modified copy instead. Freezing a frozen config returns it.
+//
+// Maps and slices are copied; functions, the logger, tracer provider and metrics are shared.
+func (c *Config) Freeze() *Config {
+	if c.frozen {
+		return c
+	}
+	snapshot := c.clone()
+	snapshot.frozen = true
+	return snapshot
+}
+
+// Frozen reports whether the config is a snapshot returned by Freeze.
+func (c *Config) Frozen() bool {
+	return c.frozen
+}
+
+// mutable returns the config for a With method to change: the config itself, or a copy when it is frozen.
+func (c *Config) mutable() *Config {
+	if !c.frozen {
+		return c
+	}
+	return c.clone()
+}
+
+// clone returns an unfrozen deep copy of the config's maps and slices.
+func (c *Config) clone() *Config {
+	copied := *c
+	copied.frozen = false
+	copied.DefaultFields = cloneSlice(c.DefaultFields)
+	copied.AllowedFields = cloneSlice(c.AllowedFields)
+	copied.DefaultFieldWeights = cloneMap(c.DefaultFieldWeights)
+	copied.ForeignRefs = cloneMap(c.ForeignRefs)
+	copied.TimeBuckets = cloneMap(c.TimeBuckets)
+	copied.ForbiddenOperators = cloneSlice(c.ForbiddenOperators)
+	copied.AllowedQueryOptions = cloneSlice(c.AllowedQueryOptions)
+	copied.FieldTypes = cloneMap(c.FieldTypes)
+	copied.ArrayFields = cloneSlice(c.ArrayFields)
+	copied.UnselectiveFields = cloneSlice(c.UnselectiveFields)
+	copied.DeprecatedFields = cloneMap(c.DeprecatedFields)
+	copied.FieldBoolCoercion = cloneMap(c.FieldBoolCoercion)
+	copied.FieldCoercers = cloneMap(c.FieldCoercers)
+	copied.TypeCoercers = cloneMap(c.TypeCoercers)
+	if c.EnumFields != nil {
+		copied.EnumFields = make(map[string][]string, len(c.EnumFields))
+		for field, values := range c.EnumFields {
+			copied.EnumFields[field] = cloneSlice(values)
+		}
+	}
+	return &copied
+}
+
+func cloneSlice[T any](s []T) []T {
+	if s == nil {
+		return nil
+	}
+	return append(make([]T, 0, len(s)), s...)
+}
+
+func cloneMap[M ~map[K]V, K comparable, V any](m M) M {
+	if m == nil {
+		return nil
+	}
+	copied := make(M, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
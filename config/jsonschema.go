@@ -0,0 +1,185 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// jsonSchema is the subset of a JSON Schema, OpenAPI schema object or MongoDB $jsonSchema validator
+// used to derive field types.
+type jsonSchema struct {
+	Type       schemaTypes            `json:"type"`
+	BSONType   schemaTypes            `json:"bsonType"`
+	Format     string                 `json:"format"`
+	Properties map[string]*jsonSchema `json:"properties"`
+	Items      *jsonSchema            `json:"items"`
+	AllOf      []*jsonSchema          `json:"allOf"`
+	JSONSchema *jsonSchema            `json:"$jsonSchema"`
+}
+
+// schemaTypes is a type keyword, which may be a single type name or a list of them.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings: %s", data)
+	}
+	*t = list
+	return nil
+}
+
+// single returns the only type other than null, or "" when there is none or the type is ambiguous.
+func (t schemaTypes) single() string {
+	found := ""
+	for _, name := range t {
+		if name == "null" {
+			continue
+		}
+		if found != "" {
+			return ""
+		}
+		found = name
+	}
+	return found
+}
+
+// JSONSchemaFieldTypes returns the field types described by a JSON Schema, OpenAPI schema component
+// or MongoDB $jsonSchema validator. Nested object properties are keyed by their dotted path and
+// arrays take the type of their items, matching how fields are written in queries.
+//
+// JSON types map as follows: string to FieldTypeString, or FieldTypeDate with format date-time or date
+// and FieldTypeUUID with format uuid; integer and number to FieldTypeNumber; boolean to FieldTypeBool.
+// MongoDB bsonType names such as objectId, date, int, long, double and decimal are mapped to the
+// matching type. Properties whose type is missing, a $ref, or ambiguous (such as ["string", "number"])
+// are left untyped.
+func JSONSchemaFieldTypes(raw []byte) (map[string]FieldType, error) {
+	var schema jsonSchema
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+
+	if schema.JSONSchema != nil {
+		schema = *schema.JSONSchema
+	}
+
+	types := make(map[string]FieldType)
+	collectSchemaTypes(&schema, "", types)
+	return types, nil
+}
+
+// JSONSchemaArrayFields returns the dotted paths of the array fields described by a JSON Schema, OpenAPI schema
+// component or MongoDB $jsonSchema validator, in sorted order. A property is an array when its type or bsonType
+// is array or it has items.
+func JSONSchemaArrayFields(raw []byte) ([]string, error) {
+	var schema jsonSchema
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+
+	if schema.JSONSchema != nil {
+		schema = *schema.JSONSchema
+	}
+
+	arrays := make(map[string]bool)
+	collectSchemaArrays(&schema, "", arrays)
+	return sortedKeys(arrays), nil
+}
+
+// collectSchemaArrays records the path of the schema if it is an array, then descends like collectSchemaTypes.
+func collectSchemaArrays(schema *jsonSchema, path string, arrays map[string]bool) {
+	if schema == nil {
+		return
+	}
+
+	if path != "" && (schema.Items != nil || schema.Type.single() == "array" || schema.BSONType.single() == "array") {
+		arrays[path] = true
+	}
+
+	for name, property := range schema.Properties {
+		child := name
+		if path != "" {
+			child = path + "." + name
+		}
+		collectSchemaArrays(property, child, arrays)
+	}
+	collectSchemaArrays(schema.Items, path, arrays)
+	for _, member := range schema.AllOf {
+		collectSchemaArrays(member, path, arrays)
+	}
+}
+
+// collectSchemaTypes records the type of the schema at path, then descends into its properties, items and allOf members.
+func collectSchemaTypes(schema *jsonSchema, path string, types map[string]FieldType) {
+	if schema == nil {
+		return
+	}
+
+	if path != "" {
+		if fieldType, ok := schemaFieldType(schema); ok {
+			types[path] = fieldType
+		}
+	}
+
+	for name, property := range schema.Properties {
+		child := name
+		if path != "" {
+			child = path + "." + name
+		}
+		collectSchemaTypes(property, child, types)
+	}
+
+	// Array fields are queried by element value, so they take the type of their items
+	collectSchemaTypes(schema.Items, path, types)
+
+	for _, member := range schema.AllOf {
+		collectSchemaTypes(member, path, types)
+	}
+}
+
+// schemaFieldType maps a schema's bsonType, or its type and format, to a FieldType.
+func schemaFieldType(schema *jsonSchema) (FieldType, bool) {
+	switch schema.BSONType.single() {
+	case "string":
+		return stringFieldType(schema.Format), true
+	case "int", "long", "double", "decimal", "number":
+		return FieldTypeNumber, true
+	case "date", "timestamp":
+		return FieldTypeDate, true
+	case "objectId":
+		return FieldTypeObjectID, true
+	case "bool":
+		return FieldTypeBool, true
+	case "binData":
+		if schema.Format == "uuid" {
+			return FieldTypeUUID, true
+		}
+	}
+
+	switch schema.Type.single() {
+	case "string":
+		return stringFieldType(schema.Format), true
+	case "integer", "number":
+		return FieldTypeNumber, true
+	case "boolean":
+		return FieldTypeBool, true
+	}
+	return "", false
+}
+
+// stringFieldType maps the format of a string schema to a FieldType.
+func stringFieldType(format string) FieldType {
+	switch format {
+	case "date-time", "date":
+		return FieldTypeDate
+	case "uuid":
+		return FieldTypeUUID
+	}
+	return FieldTypeString
+}
@@ -0,0 +1,364 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// fileConfig is the settings a Config can be loaded with from YAML or environment variables.
+// Unset settings keep the values of Default.
+type fileConfig struct {
+	Language                string              `yaml:"language"`
+	Formatter               string              `yaml:"formatter"`
+	DefaultFields           []string            `yaml:"default_fields"`
+	WeightedDefaultFields   map[string]int      `yaml:"weighted_default_fields"`
+	AllowedFields           []string            `yaml:"allowed_fields"`
+	ReplaceIDWithMongoID    *bool               `yaml:"replace_id_with_mongo_id"`
+	AutoConvertIDToObjectID *bool               `yaml:"auto_convert_id_to_object_id"`
+	TextSearchStrategy      string              `yaml:"text_search_strategy"`
+	AtlasSearchIndex        string              `yaml:"atlas_search_index"`
+	TextLanguage            string              `yaml:"text_language"`
+	TextCaseSensitive       *bool               `yaml:"text_case_sensitive"`
+	TextDiacriticSensitive  *bool               `yaml:"text_diacritic_sensitive"`
+	TextScore               *bool               `yaml:"text_score"`
+	LogQueries              *bool               `yaml:"log_queries"`
+	MultiWordMode           string              `yaml:"multi_word_mode"`
+	LegacyTextCompat        *bool               `yaml:"legacy_text_compat"`
+	OutputVersion           *int                `yaml:"output_version"`
+	FieldTypes              map[string]string   `yaml:"field_types"`
+	JSONSchema              string              `yaml:"json_schema"`
+	ArrayFields             []string            `yaml:"array_fields"`
+	EnumFields              map[string][]string `yaml:"enum_fields"`
+	RejectEnumWildcards     *bool               `yaml:"reject_enum_wildcards"`
+	BoolCoercion            string              `yaml:"bool_coercion"`
+	FieldBoolCoercion       map[string]string   `yaml:"field_bool_coercion"`
+	AccentInsensitive       *bool               `yaml:"accent_insensitive"`
+	DurationUnit            string              `yaml:"duration_unit"`
+	DecimalSeparator        string              `yaml:"decimal_separator"`
+	ThousandsSeparator      string              `yaml:"thousands_separator"`
+	StrictNumbers           *bool               `yaml:"strict_numbers"`
+	LenientErrors           *bool               `yaml:"lenient_errors"`
+	LowercaseOperators      *bool               `yaml:"lowercase_operators"`
+	Policy                  string              `yaml:"policy"`
+	MaxQueryLength          *int                `yaml:"max_query_length"`
+	MaxClauses              *int                `yaml:"max_clauses"`
+	MaxLimit                *int                `yaml:"max_limit"`
+	MaxPathDepth            *int                `yaml:"max_path_depth"`
+	MaxRegexClauses         *int                `yaml:"max_regex_clauses"`
+	RejectLeadingWildcards  *bool               `yaml:"reject_leading_wildcards"`
+	ForbiddenOperators      []string            `yaml:"forbidden_operators"`
+	OperatorAudit           *bool               `yaml:"operator_audit"`
+	ExplicitEquality        *bool               `yaml:"explicit_equality"`
+	SoftDeleteField         string              `yaml:"soft_delete_field"`
+	UnselectiveFields       []string            `yaml:"unselective_fields"`
+	DeprecatedFields        map[string]string   `yaml:"deprecated_fields"`
+	ConflictPolicy          string              `yaml:"conflict_policy"`
+	AllowedQueryOptions     []string            `yaml:"allowed_query_options"`
+}
+
+// FromYAML builds a config from a YAML file, starting from Default. Keys are the snake_case names of the With
+// methods, such as default_fields, allowed_fields, text_search_strategy and field_types; unknown keys are rejected.
+// A json_schema path is read relative to the YAML file. The config is validated with Validate.
+//
+//	language: lucene
+//	default_fields: [name, email]
+//	allowed_fields: [name, email, status]
+//	enum_fields:
+//	  status: [active, inactive]
+func FromYAML(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseYAML(data, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseYAML builds a config from YAML as FromYAML does, reading a json_schema path relative to the working
+// directory. It can be used as the load function of a FileProvider.
+func ParseYAML(data []byte) (*Config, error) {
+	return parseYAML(data, "")
+}
+
+func parseYAML(data []byte, dir string) (*Config, error) {
+	var fc fileConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if fc.JSONSchema != "" && dir != "" && !filepath.IsAbs(fc.JSONSchema) {
+		fc.JSONSchema = filepath.Join(dir, fc.JSONSchema)
+	}
+	return fc.build()
+}
+
+// FromEnv builds a config from environment variables named after the FromYAML keys in upper case with
+// the given prefix, such as BSONIC_DEFAULT_FIELDS for the prefix BSONIC, starting from Default.
+// Lists are comma-separated, maps are comma-separated key=value pairs, and enum fields separate fields
+// with semicolons: BSONIC_ENUM_FIELDS="status=active,inactive;role=admin,user". The config is validated with Validate.
+func FromEnv(prefix string) (*Config, error) {
+	prefix = strings.TrimSuffix(prefix, "_") + "_"
+
+	var fc fileConfig
+	v := reflect.ValueOf(&fc).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := prefix + strings.ToUpper(v.Type().Field(i).Tag.Get("yaml"))
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setEnvField(v.Field(i), raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return fc.build()
+}
+
+// setEnvField parses an environment variable into a fileConfig field.
+func setEnvField(field reflect.Value, raw string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(strings.TrimSpace(raw))
+	case *bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(&b))
+	case *int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(&n))
+	case []string:
+		field.Set(reflect.ValueOf(splitList(raw, ",")))
+	case map[string]string:
+		pairs, err := splitPairs(raw, ",")
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(pairs))
+	case map[string]int:
+		pairs, err := splitPairs(raw, ",")
+		if err != nil {
+			return err
+		}
+		weights := make(map[string]int, len(pairs))
+		for key, value := range pairs {
+			if weights[key], err = strconv.Atoi(value); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		field.Set(reflect.ValueOf(weights))
+	case map[string][]string:
+		pairs, err := splitPairs(raw, ";")
+		if err != nil {
+			return err
+		}
+		lists := make(map[string][]string, len(pairs))
+		for key, value := range pairs {
+			lists[key] = splitList(value, ",")
+		}
+		field.Set(reflect.ValueOf(lists))
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// splitList splits a separated list, trimming spaces and dropping empty entries.
+func splitList(raw, sep string) []string {
+	list := []string{}
+	for _, entry := range strings.Split(raw, sep) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// splitPairs splits a separated list of key=value pairs.
+func splitPairs(raw, sep string) (map[string]string, error) {
+	pairs := map[string]string{}
+	for _, entry := range splitList(raw, sep) {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected key=value, got %q", entry)
+		}
+		pairs[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return pairs, nil
+}
+
+// build applies the settings to a default config and validates it.
+func (fc *fileConfig) build() (*Config, error) {
+	c := Default()
+	// The policy goes first, so the settings it bundles can be overridden individually
+	if fc.Policy != "" {
+		c.WithPolicy(Policy(fc.Policy))
+	}
+	if fc.Language != "" {
+		c.WithLanguage(LanguageType(fc.Language))
+	}
+	if fc.Formatter != "" {
+		c.WithFormatter(FormatterType(fc.Formatter))
+	}
+	if fc.DefaultFields != nil {
+		c.WithDefaultFields(fc.DefaultFields)
+	}
+	if fc.WeightedDefaultFields != nil {
+		c.WithWeightedDefaultFields(Weighted(fc.WeightedDefaultFields))
+	}
+	if fc.AllowedFields != nil {
+		c.WithAllowedFields(fc.AllowedFields)
+	}
+	if fc.ReplaceIDWithMongoID != nil {
+		c.WithReplaceIDWithMongoID(*fc.ReplaceIDWithMongoID)
+	}
+	if fc.AutoConvertIDToObjectID != nil {
+		c.WithAutoConvertIDToObjectID(*fc.AutoConvertIDToObjectID)
+	}
+	if fc.TextSearchStrategy != "" {
+		c.WithTextSearchStrategy(TextSearchStrategy(fc.TextSearchStrategy))
+	}
+	if fc.AtlasSearchIndex != "" {
+		c.WithAtlasSearchIndex(fc.AtlasSearchIndex)
+	}
+	if fc.TextLanguage != "" {
+		c.WithTextLanguage(fc.TextLanguage)
+	}
+	if fc.TextCaseSensitive != nil {
+		c.WithTextCaseSensitive(*fc.TextCaseSensitive)
+	}
+	if fc.TextDiacriticSensitive != nil {
+		c.WithTextDiacriticSensitive(*fc.TextDiacriticSensitive)
+	}
+	if fc.TextScore != nil {
+		c.WithTextScore(*fc.TextScore)
+	}
+	if fc.LogQueries != nil {
+		c.WithQueryLogging(*fc.LogQueries)
+	}
+	if fc.MultiWordMode != "" {
+		c.WithMultiWordMode(MultiWordMode(fc.MultiWordMode))
+	}
+	if fc.LegacyTextCompat != nil {
+		c.WithLegacyTextCompat(*fc.LegacyTextCompat)
+	}
+	if fc.OutputVersion != nil {
+		c.WithOutputVersion(*fc.OutputVersion)
+	}
+	if fc.FieldTypes != nil {
+		types := make(map[string]FieldType, len(fc.FieldTypes))
+		for field, fieldType := range fc.FieldTypes {
+			types[field] = FieldType(fieldType)
+		}
+		c.WithFieldTypes(types)
+	}
+	if fc.ArrayFields != nil {
+		c.WithArrayFields(fc.ArrayFields...)
+	}
+	if fc.JSONSchema != "" {
+		raw, err := os.ReadFile(fc.JSONSchema)
+		if err != nil {
+			return nil, err
+		}
+		c.WithJSONSchema(raw)
+	}
+	for field, values := range fc.EnumFields {
+		c.WithEnumField(field, values...)
+	}
+	if fc.RejectEnumWildcards != nil {
+		c.WithRejectEnumWildcards(*fc.RejectEnumWildcards)
+	}
+	if fc.BoolCoercion != "" {
+		c.WithBoolCoercion(BoolCoercion(fc.BoolCoercion))
+	}
+	for field, policy := range fc.FieldBoolCoercion {
+		c.WithFieldBoolCoercion(field, BoolCoercion(policy))
+	}
+	if fc.AccentInsensitive != nil {
+		c.WithAccentInsensitive(*fc.AccentInsensitive)
+	}
+	if fc.DurationUnit != "" {
+		unit, err := time.ParseDuration(fc.DurationUnit)
+		if err != nil {
+			return nil, fmt.Errorf("duration_unit: %w", err)
+		}
+		c.WithDurationUnit(unit)
+	}
+	if fc.DecimalSeparator != "" || fc.ThousandsSeparator != "" {
+		c.WithNumberSeparators(fc.DecimalSeparator, fc.ThousandsSeparator)
+	}
+	if fc.StrictNumbers != nil {
+		c.WithStrictNumbers(*fc.StrictNumbers)
+	}
+	if fc.LenientErrors != nil {
+		c.WithLenientErrors(*fc.LenientErrors)
+	}
+	if fc.LowercaseOperators != nil {
+		c.WithLowercaseOperators(*fc.LowercaseOperators)
+	}
+	if fc.MaxQueryLength != nil {
+		c.WithMaxQueryLength(*fc.MaxQueryLength)
+	}
+	if fc.MaxClauses != nil {
+		c.WithMaxClauses(*fc.MaxClauses)
+	}
+	if fc.MaxLimit != nil {
+		c.WithMaxLimit(int64(*fc.MaxLimit))
+	}
+	if fc.MaxPathDepth != nil {
+		c.WithMaxPathDepth(*fc.MaxPathDepth)
+	}
+	if fc.MaxRegexClauses != nil {
+		c.WithMaxRegexClauses(*fc.MaxRegexClauses)
+	}
+	if fc.RejectLeadingWildcards != nil {
+		c.WithRejectLeadingWildcards(*fc.RejectLeadingWildcards)
+	}
+	if fc.ForbiddenOperators != nil {
+		c.WithForbiddenOperators(fc.ForbiddenOperators...)
+	}
+	if fc.OperatorAudit != nil {
+		c.WithOperatorAudit(*fc.OperatorAudit)
+	}
+	if fc.ExplicitEquality != nil {
+		c.WithExplicitEquality(*fc.ExplicitEquality)
+	}
+	if fc.SoftDeleteField != "" {
+		c.WithSoftDeleteField(fc.SoftDeleteField)
+	}
+	if fc.UnselectiveFields != nil {
+		c.WithUnselectiveFields(fc.UnselectiveFields...)
+	}
+	for field, replacement := range fc.DeprecatedFields {
+		c.WithDeprecatedField(field, replacement)
+	}
+	if fc.ConflictPolicy != "" {
+		c.WithConflictPolicy(ConflictPolicy(fc.ConflictPolicy))
+	}
+	if fc.AllowedQueryOptions != nil {
+		c.WithAllowedQueryOptions(fc.AllowedQueryOptions...)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
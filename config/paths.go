@@ -0,0 +1,35 @@
+package config
+
+import "strings"
+
+// SchemaPath returns a field path without its array index segments, so items.0.price becomes items.price.
+// Field types, enum values, bool coercion policies and allowed fields configured for items.price then apply
+// to items.0.price as well. Only canonical indexes such as 0 and 12 are removed: MongoDB reads 01 as a field name.
+func SchemaPath(field string) string {
+	if !strings.ContainsAny(field, "0123456789") {
+		return field
+	}
+
+	parts := strings.Split(field, ".")
+	kept := parts[:0]
+	for i, part := range parts {
+		if i > 0 && IsArrayIndex(part) {
+			continue
+		}
+		kept = append(kept, part)
+	}
+	return strings.Join(kept, ".")
+}
+
+// IsArrayIndex reports whether a field path segment is an array index: a non-negative integer without leading zeros.
+func IsArrayIndex(segment string) bool {
+	if segment == "" || (len(segment) > 1 && segment[0] == '0') {
+		return false
+	}
+	for _, r := range segment {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PhoneOptions configures PhoneCoercer.
+type PhoneOptions struct {
+	// CountryCode is the calling code of numbers written without one, such as "1" for the US or "44" for the UK.
+	// A leading trunk 0 is dropped from them, so with "44" 020 7946 0958 becomes +442079460958. When empty,
+	// only numbers written with a + or 00 international prefix are normalized.
+	CountryCode string
+	// Formats matches the common formats of a number as well as E.164, with an $in, for collections that store
+	// phone numbers as they were typed
+	Formats bool
+}
+
+// PhoneCoercer returns a ValueCoercer that normalizes phone numbers written with spaces, dashes, dots, slashes
+// and parentheses, such as (555) 123-4567, 555.123.4567 or +44 20 7946 0958, to E.164, such as +15551234567.
+// Values that are not phone numbers, or too short or long for one, are left unchanged.
+func PhoneCoercer(opts PhoneOptions) ValueCoercer {
+	return ValueCoercerFunc(func(field string, value interface{}) (interface{}, error) {
+		text, ok := phoneText(value)
+		if !ok {
+			return value, nil
+		}
+		number, ok := parsePhone(text, opts.CountryCode)
+		if !ok {
+			return value, nil
+		}
+		if !opts.Formats {
+			return "+" + number, nil
+		}
+		return phoneFormats(number, opts.CountryCode), nil
+	})
+}
+
+// phoneText returns the text of a phone number value, which may have been detected as a number
+func phoneText(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		if v < 0 || v != math.Trunc(v) || v >= 1e15 {
+			return "", false
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int32:
+		return strconv.FormatInt(int64(v), 10), v >= 0
+	case int64:
+		return strconv.FormatInt(v, 10), v >= 0
+	}
+	return "", false
+}
+
+// parsePhone returns the digits of a phone number in international form, without the leading +
+func parsePhone(text, countryCode string) (string, bool) {
+	text = strings.TrimSpace(text)
+	international := strings.HasPrefix(text, "+")
+	if international || strings.HasPrefix(text, "00") {
+		// The trunk 0 of +44 (0)20 7946 0958 is only dialled within the country
+		text = strings.Replace(text, "(0)", "", 1)
+	}
+	var b strings.Builder
+	for _, r := range strings.TrimPrefix(text, "+") {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '/' || r == '(' || r == ')':
+		default:
+			return "", false
+		}
+	}
+
+	digits := b.String()
+	switch {
+	case international:
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	case countryCode == "":
+		return "", false
+	case strings.HasPrefix(digits, "0"):
+		digits = countryCode + digits[1:]
+	case strings.HasPrefix(digits, countryCode) && len(digits) > 10:
+		// Already international, such as 15551234567 or a number detected from +15551234567
+	default:
+		digits = countryCode + digits
+	}
+
+	// E.164 numbers have at most 15 digits; shorter ones than 7 are extensions or other codes
+	if len(digits) < 7 || len(digits) > 15 || digits[0] == '0' {
+		return "", false
+	}
+	return digits, true
+}
+
+// phoneFormats returns E.164 and the other common formats of an international number: its digits alone and
+// with a 00 prefix, and for numbers with countryCode, the national number with and without a trunk 0, or the
+// North American formats such as (555) 123-4567 and 555-123-4567.
+func phoneFormats(number, countryCode string) AnyOf {
+	formats := AnyOf{"+" + number, number, "00" + number}
+	national, ok := strings.CutPrefix(number, countryCode)
+	if countryCode == "" || !ok {
+		return formats
+	}
+
+	if countryCode == "1" && len(national) == 10 {
+		area, exchange, line := national[:3], national[3:6], national[6:]
+		return append(formats,
+			national,
+			"("+area+") "+exchange+"-"+line,
+			area+"-"+exchange+"-"+line,
+			area+"."+exchange+"."+line,
+			area+" "+exchange+" "+line,
+			"+1 "+area+"-"+exchange+"-"+line,
+			"+1 ("+area+") "+exchange+"-"+line,
+		)
+	}
+	return append(formats, national, "0"+national)
+}
@@ -0,0 +1,77 @@
+package config
+
+import "fmt"
+
+// Policy names a built-in profile bundling query limits, forbidden operators and coercion settings for a kind of caller.
+type Policy string
+
+const (
+	// PolicyStrictAPI suits public APIs taking queries from untrusted users: short queries with few clauses,
+	// small limits, no $regex scans, booleans coerced only on boolean-typed fields and enum wildcards rejected
+	PolicyStrictAPI Policy = "strict_api"
+	// PolicyAnalyst suits dashboards and ad-hoc exploration: generous limits, every operator, and lenient
+	// errors so a mistyped clause is dropped with a warning instead of failing the query
+	PolicyAnalyst Policy = "analyst"
+	// PolicyInternal suits trusted service-to-service queries: no limits, every operator and strict errors
+	PolicyInternal Policy = "internal"
+)
+
+// policySettings are the settings a policy applies
+type policySettings struct {
+	maxQueryLength      int
+	maxClauses          int
+	maxLimit            int64
+	forbiddenOperators  []string
+	boolCoercion        BoolCoercion
+	rejectEnumWildcards bool
+	lenientErrors       bool
+}
+
+// policies holds the settings of the built-in policies
+var policies = map[Policy]policySettings{
+	PolicyStrictAPI: {
+		maxQueryLength:      512,
+		maxClauses:          16,
+		maxLimit:            100,
+		forbiddenOperators:  []string{"$regex"},
+		boolCoercion:        BoolCoercionSchema,
+		rejectEnumWildcards: true,
+	},
+	PolicyAnalyst: {
+		maxQueryLength: 4096,
+		maxClauses:     100,
+		maxLimit:       10000,
+		boolCoercion:   BoolCoercionAlways,
+		lenientErrors:  true,
+	},
+	PolicyInternal: {
+		boolCoercion: BoolCoercionAlways,
+	},
+}
+
+// WithPolicy applies a built-in policy profile and returns the config. It replaces the query length, clause
+// and limit maximums, the forbidden operators, the bool coercion policy and the enum wildcard and lenient
+// error settings; With methods called afterwards override individual settings. An unknown policy is recorded by Err.
+//
+//	| Policy          | Max length | Max clauses | Max limit | Forbidden | Bool coercion | Enum wildcards | Lenient |
+//	| PolicyStrictAPI | 512        | 16          | 100       | $regex    | schema        | rejected       | no      |
+//	| PolicyAnalyst   | 4096       | 100         | 10000     | none      | always        | allowed        | yes     |
+//	| PolicyInternal  | none       | none        | none      | none      | always        | allowed        | no      |
+func (c *Config) WithPolicy(policy Policy) *Config {
+	c = c.mutable()
+	settings, ok := policies[policy]
+	if !ok {
+		c.setErr(fmt.Errorf("unknown policy: %q", policy))
+		return c
+	}
+
+	c.Policy = policy
+	c.MaxQueryLength = settings.maxQueryLength
+	c.MaxClauses = settings.maxClauses
+	c.MaxLimit = settings.maxLimit
+	c.ForbiddenOperators = cloneSlice(settings.forbiddenOperators)
+	c.BoolCoercion = settings.boolCoercion
+	c.RejectEnumWildcards = settings.rejectEnumWildcards
+	c.LenientErrors = settings.lenientErrors
+	return c
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Provider supplies the current config to a parser created with bsonic.NewWithProvider, which consults
+// it on every request, so settings such as the field allowlist can change without restarting the service.
+// Config must be safe for concurrent use and should return the same pointer until the config changes,
+// since parsers rebuild their formatter whenever the pointer differs.
+type Provider interface {
+	Config() *Config
+}
+
+// ProviderFunc adapts a function to the Provider interface.
+type ProviderFunc func() *Config
+
+// Config calls f.
+func (f ProviderFunc) Config() *Config {
+	return f()
+}
+
+// DefaultReloadInterval is how often a FileProvider checks its file for changes unless WithReloadInterval is used.
+const DefaultReloadInterval = 5 * time.Second
+
+// FileProvider is a Provider that reloads its config from a file whenever the file changes.
+// A file that fails to load or holds an invalid config is reported by Err and the previous
+// config is kept, so a bad edit cannot take the query service down.
+type FileProvider struct {
+	path     string
+	load     func(data []byte) (*Config, error)
+	interval time.Duration
+	onReload func(*Config, error)
+
+	mu      sync.RWMutex
+	config  *Config
+	data    []byte
+	modTime time.Time
+	err     error
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// FileProviderOption configures a FileProvider.
+type FileProviderOption func(*FileProvider)
+
+// WithReloadInterval sets how often the file is checked for changes.
+func WithReloadInterval(interval time.Duration) FileProviderOption {
+	return func(p *FileProvider) {
+		p.interval = interval
+	}
+}
+
+// WithReloadHook sets a function called after every attempt to reload a changed file,
+// with the new config or the error that kept the previous one.
+func WithReloadHook(hook func(*Config, error)) FileProviderOption {
+	return func(p *FileProvider) {
+		p.onReload = hook
+	}
+}
+
+// NewFileProvider loads a config from the file at path with load and watches the file for changes
+// until Close is called. The initial load must succeed.
+func NewFileProvider(path string, load func(data []byte) (*Config, error), opts ...FileProviderOption) (*FileProvider, error) {
+	p := &FileProvider{
+		path:     path,
+		load:     load,
+		interval: DefaultReloadInterval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.interval <= 0 {
+		return nil, fmt.Errorf("reload interval must be positive: %s", p.interval)
+	}
+
+	if err := p.reload(); err != nil {
+		return nil, err
+	}
+	go p.watch()
+	return p, nil
+}
+
+// Config returns the last config loaded successfully, frozen.
+func (p *FileProvider) Config() *Config {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.config
+}
+
+// Err returns the error from the last reload, or nil if it succeeded.
+func (p *FileProvider) Err() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.err
+}
+
+// Close stops watching the file. The last config stays available.
+func (p *FileProvider) Close() error {
+	p.once.Do(func() {
+		close(p.stop)
+		<-p.done
+	})
+	return nil
+}
+
+// watch checks the file for changes every interval until Close is called.
+func (p *FileProvider) watch() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.check()
+		}
+	}
+}
+
+// check reloads the file if its modification time or contents changed since the last load.
+func (p *FileProvider) check() {
+	info, err := os.Stat(p.path)
+	if err == nil {
+		p.mu.RLock()
+		unchanged := info.ModTime().Equal(p.modTime)
+		p.mu.RUnlock()
+		if unchanged {
+			return
+		}
+	}
+
+	err = p.reload()
+	if p.onReload != nil {
+		p.onReload(p.Config(), err)
+	}
+}
+
+// reload reads and loads the file, keeping the previous config if the file is unchanged or invalid.
+func (p *FileProvider) reload() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return p.fail(err)
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return p.fail(err)
+	}
+
+	p.mu.RLock()
+	unchanged := p.config != nil && bytes.Equal(data, p.data)
+	p.mu.RUnlock()
+	if unchanged {
+		p.mu.Lock()
+		p.modTime, p.err = info.ModTime(), nil
+		p.mu.Unlock()
+		return nil
+	}
+
+	cfg, err := p.load(data)
+	if err == nil && cfg == nil {
+		err = fmt.Errorf("loading %s returned no config", p.path)
+	}
+	if err == nil {
+		err = cfg.Err()
+	}
+	if err != nil {
+		// Remember the invalid version so it is not reloaded until the file changes again
+		p.mu.Lock()
+		p.modTime = info.ModTime()
+		p.mu.Unlock()
+		return p.fail(fmt.Errorf("loading %s: %w", p.path, err))
+	}
+
+	p.mu.Lock()
+	p.config, p.data, p.modTime, p.err = cfg.Freeze(), data, info.ModTime(), nil
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *FileProvider) fail(err error) error {
+	p.mu.Lock()
+	p.err = err
+	p.mu.Unlock()
+	return err
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Validate reports contradictions and invalid values in the config, such as default fields outside the
+// field allowlist, or a regex text search strategy without default fields. All problems are joined into
+// a single error; nil means the config is consistent. The error recorded by Err, if any, is included.
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.err != nil {
+		errs = append(errs, c.err)
+	}
+
+	switch c.Language {
+	case LanguageLucene, LanguageMQL:
+	default:
+		add("unsupported language: %q", c.Language)
+	}
+	if c.Formatter != FormatterMongo {
+		add("unsupported formatter: %q", c.Formatter)
+	}
+	if c.OutputVersion < 0 || c.OutputVersion > LatestOutputVersion {
+		add("unsupported output version: %d", c.OutputVersion)
+	}
+	if c.LegacyTextCompat && c.OutputVersion >= OutputVersion2 {
+		add("legacy text compatibility contradicts output version %d", c.OutputVersion)
+	}
+
+	switch c.TextSearchStrategy {
+	case StrategyRegexFields:
+		if c.Language == LanguageLucene && !c.LegacyText() && len(c.DefaultFields) == 0 {
+			add("text search strategy %q needs default fields", c.TextSearchStrategy)
+		}
+	case StrategyTextIndex, StrategyAtlasSearch, "":
+	default:
+		add("unsupported text search strategy: %q", c.TextSearchStrategy)
+	}
+	switch c.MultiWordMode {
+	case MultiWordAny, MultiWordAll, MultiWordPhrase, "":
+	default:
+		add("unsupported multiword mode: %q", c.MultiWordMode)
+	}
+
+	if len(c.AllowedFields) > 0 {
+		for _, field := range c.DefaultFields {
+			if !allowedField(field, c.AllowedFields) {
+				add("default field %s is not in the allowed fields", field)
+			}
+		}
+		for _, field := range sortedKeys(c.EnumFields) {
+			if !allowedField(field, c.AllowedFields) {
+				add("enum field %s is not in the allowed fields", field)
+			}
+		}
+	}
+	for _, field := range sortedKeys(c.DefaultFieldWeights) {
+		if c.DefaultFieldWeights[field] <= 0 {
+			add("default field %s has a weight of %d; weights must be positive", field, c.DefaultFieldWeights[field])
+		}
+	}
+
+	for _, field := range sortedKeys(c.FieldTypes) {
+		if !validFieldType(c.FieldTypes[field]) {
+			add("field %s has unsupported type %q", field, c.FieldTypes[field])
+		}
+	}
+	for _, fieldType := range sortedKeys(c.TypeCoercers) {
+		if !validFieldType(fieldType) {
+			add("value coercer for unsupported type %q", fieldType)
+		}
+	}
+	for _, field := range sortedKeys(c.EnumFields) {
+		if len(c.EnumFields[field]) == 0 {
+			add("enum field %s allows no values", field)
+		}
+		if fieldType, ok := c.FieldTypes[field]; ok && fieldType != FieldTypeString {
+			add("enum field %s is typed %q; enum values are strings", field, fieldType)
+		}
+	}
+
+	if !validBoolCoercion(c.BoolCoercion) {
+		add("unsupported bool coercion: %q", c.BoolCoercion)
+	}
+	for _, field := range sortedKeys(c.FieldBoolCoercion) {
+		if !validBoolCoercion(c.FieldBoolCoercion[field]) {
+			add("field %s has unsupported bool coercion %q", field, c.FieldBoolCoercion[field])
+		}
+	}
+	switch c.ConflictPolicy {
+	case ConflictKeep, ConflictError, ConflictLastWins, ConflictWarn, "":
+	default:
+		add("unsupported conflict policy: %q", c.ConflictPolicy)
+	}
+
+	for _, field := range sortedKeys(c.ForeignRefs) {
+		if c.ForeignRefs[field].From == "" {
+			add("foreign reference %s has no collection", field)
+		}
+	}
+	if c.DurationUnit < 0 {
+		add("duration unit must not be negative: %s", c.DurationUnit)
+	}
+	if c.DecimalSeparator != "" && !validNumberSeparator(c.DecimalSeparator) {
+		add("decimal separator must be a single character other than a digit or sign: %q", c.DecimalSeparator)
+	}
+	if c.ThousandsSeparator != "" && !validNumberSeparator(c.ThousandsSeparator) {
+		add("thousands separator must be a single character other than a digit or sign: %q", c.ThousandsSeparator)
+	}
+	if c.DecimalSeparator == "" && c.ThousandsSeparator != "" {
+		add("thousands separator %q needs a decimal separator", c.ThousandsSeparator)
+	}
+	if c.DecimalSeparator != "" && c.DecimalSeparator == c.ThousandsSeparator {
+		add("decimal and thousands separators must differ: %q", c.DecimalSeparator)
+	}
+	if c.StrictNumbers && c.DecimalSeparator == "" {
+		add("strict numbers need a decimal separator")
+	}
+
+	if c.MaxQueryLength < 0 {
+		add("maximum query length must not be negative: %d", c.MaxQueryLength)
+	}
+	if c.MaxClauses < 0 {
+		add("maximum clauses must not be negative: %d", c.MaxClauses)
+	}
+	if c.MaxLimit < 0 {
+		add("maximum limit must not be negative: %d", c.MaxLimit)
+	}
+	if c.MaxPathDepth < 0 {
+		add("maximum path depth must not be negative: %d", c.MaxPathDepth)
+	}
+	if c.MaxRegexClauses < 0 {
+		add("maximum regex clauses must not be negative: %d", c.MaxRegexClauses)
+	}
+	for _, field := range sortedKeys(c.DeprecatedFields) {
+		replacement := c.DeprecatedFields[field]
+		switch {
+		case replacement == "":
+			add("deprecated field %s has no replacement", field)
+		case replacement == field:
+			add("deprecated field %s is renamed to itself", field)
+		case len(c.AllowedFields) > 0 && !allowedField(replacement, c.AllowedFields):
+			add("deprecated field %s is renamed to %s, which is not in the allowed fields", field, replacement)
+		}
+	}
+	for _, operator := range c.ForbiddenOperators {
+		if !strings.HasPrefix(operator, "$") {
+			add("forbidden operator %q must start with $", operator)
+		}
+	}
+	for _, option := range c.AllowedQueryOptions {
+		switch option {
+		case QueryOptionIncludeDeleted, QueryOptionCaseSensitive, QueryOptionLimit:
+		default:
+			add("unknown query option: %q", option)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validNumberSeparator reports whether a number separator is a single character that cannot be part of a digit sequence
+func validNumberSeparator(separator string) bool {
+	r, size := utf8.DecodeRuneInString(separator)
+	return size == len(separator) && r != utf8.RuneError && !unicode.IsDigit(r) && r != '+' && r != '-'
+}
+
+func validFieldType(fieldType FieldType) bool {
+	switch fieldType {
+	case FieldTypeString, FieldTypeNumber, FieldTypeDate, FieldTypeObjectID, FieldTypeBool, FieldTypeUUID, FieldTypeIP,
+		FieldTypeIPNumber, FieldTypeIPString, FieldTypePhone, FieldTypeEmail:
+		return true
+	}
+	return false
+}
+
+func validBoolCoercion(policy BoolCoercion) bool {
+	return policy == BoolCoercionAlways || policy == BoolCoercionSchema || policy == ""
+}
+
+// allowedField reports whether field matches an allowed field or is nested beneath one, as the parser's allowlist does.
+func allowedField(field string, allowedFields []string) bool {
+	for _, allowed := range allowedFields {
+		if field == allowed || strings.HasPrefix(field, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of a map in order, so errors are reported deterministically.
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,186 @@
+package bsonic
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/bsonutil"
+	"github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ErrConflictingField is matched by the errors and warnings for a field ANDed with conflicting equality conditions,
+// reported under the ConflictError and ConflictWarn policies. errors.As finds the *ConflictError.
+var ErrConflictingField = errors.New("conflicting field conditions")
+
+// ConflictError reports a field ANDed with equality conditions on different values, such as age:18 AND age:65,
+// which no document with a single value in the field matches.
+type ConflictError struct {
+	Field string
+	// Values are the distinct values the field is compared with, in query order
+	Values []interface{}
+}
+
+func (e *ConflictError) Error() string {
+	values := make([]string, len(e.Values))
+	for i, value := range e.Values {
+		if s, ok := value.(string); ok {
+			values[i] = strconv.Quote(s)
+		} else {
+			values[i] = fmt.Sprint(value)
+		}
+	}
+	last := len(values) - 1
+	return fmt.Sprintf("field %s cannot equal %s and %s at once", e.Field, strings.Join(values[:last], ", "), values[last])
+}
+
+// Is reports whether target is ErrConflictingField.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflictingField
+}
+
+// resolveConflicts applies the configured conflict policy to the fields a result's filter ANDs with conflicting
+// equality conditions: the first conflict is returned as an error, every conflict is added to the warnings, or the
+// last condition on each field is kept.
+func (p *Parser) resolveConflicts(result *ParseResult) error {
+	policy := p.Config.ConflictPolicy
+	if policy == "" || policy == config.ConflictKeep {
+		return nil
+	}
+
+	var conflicts []*ConflictError
+	result.Filter = p.resolveFilterConflicts(result.Filter, policy == config.ConflictLastWins, &conflicts)
+	switch policy {
+	case config.ConflictError:
+		if len(conflicts) > 0 {
+			return &Error{Kind: ErrSyntax, Err: conflicts[0]}
+		}
+	case config.ConflictWarn:
+		for _, conflict := range conflicts {
+			result.Warnings = append(result.Warnings, Warning{Err: conflict})
+		}
+	}
+	return nil
+}
+
+// resolveFilterConflicts collects the conflicts of a filter document, whose own fields are ANDed with its $and
+// clauses, and of the filters nested in its logical operators. With lastWins, only the last condition on a
+// conflicting field is kept.
+func (p *Parser) resolveFilterConflicts(filter bson.M, lastWins bool, conflicts *[]*ConflictError) bson.M {
+	for _, operator := range []string{"$and", "$or", "$nor"} {
+		clauses := slices.Clone(bsonfilter.Clauses(filter[operator]))
+		if clauses == nil {
+			continue
+		}
+		for i, clause := range clauses {
+			clauses[i] = p.resolveFilterConflicts(clause, lastWins, conflicts)
+		}
+		filter[operator] = clauses
+	}
+
+	// The document itself holds the first conditions, followed by its $and clauses in order
+	clauses := append([]bson.M{filter}, bsonfilter.Clauses(filter["$and"])...)
+	var fields []string
+	values := map[string][]interface{}{}
+	holders := map[string][]bson.M{}
+	for _, clause := range clauses {
+		for _, field := range sortedKeys(clause) {
+			value, ok := equalityValue(clause[field])
+			if strings.HasPrefix(field, "$") || !ok {
+				continue
+			}
+			if _, seen := holders[field]; !seen {
+				fields = append(fields, field)
+			}
+			holders[field] = append(holders[field], clause)
+			if !slices.ContainsFunc(values[field], func(v interface{}) bool { return bsonutil.Equal(v, value) }) {
+				values[field] = append(values[field], value)
+			}
+		}
+	}
+
+	resolved := false
+	for _, field := range fields {
+		if len(values[field]) < 2 || p.isArrayPath(field) {
+			continue
+		}
+		*conflicts = append(*conflicts, &ConflictError{Field: field, Values: values[field]})
+		if lastWins {
+			for _, holder := range holders[field][:len(holders[field])-1] {
+				delete(holder, field)
+			}
+			resolved = true
+		}
+	}
+	if resolved {
+		return dropEmptyClauses(filter)
+	}
+	return filter
+}
+
+// dropEmptyClauses removes the $and clauses left empty by resolving conflicts, merging a single remaining clause
+// into the document when none of its fields collide with the document's own
+func dropEmptyClauses(filter bson.M) bson.M {
+	var remaining []bson.M
+	for _, clause := range bsonfilter.Clauses(filter["$and"]) {
+		if len(clause) > 0 {
+			remaining = append(remaining, clause)
+		}
+	}
+	delete(filter, "$and")
+
+	if len(remaining) == 1 {
+		collides := false
+		for field := range remaining[0] {
+			if _, ok := filter[field]; ok {
+				collides = true
+			}
+		}
+		if !collides {
+			for field, value := range remaining[0] {
+				filter[field] = value
+			}
+			return filter
+		}
+	}
+	if len(remaining) > 0 {
+		filter["$and"] = remaining
+	}
+	return filter
+}
+
+// equalityValue returns the value a field condition matches exactly, and false for operator conditions and regexes
+func equalityValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case bson.M:
+		if eq, ok := v["$eq"]; ok && len(v) == 1 {
+			return eq, true
+		}
+		if isOperatorDoc(v) {
+			return nil, false
+		}
+	case bson.D:
+		if len(v) > 0 && strings.HasPrefix(v[0].Key, "$") {
+			return nil, false
+		}
+	case bson.Regex:
+		return nil, false
+	}
+	return value, true
+}
+
+// isArrayPath reports whether a field is a declared array field or nested beneath one, where several equality
+// conditions can match different elements
+func (p *Parser) isArrayPath(field string) bool {
+	schemaPath := config.SchemaPath(field)
+	for _, array := range p.Config.ArrayFields {
+		if schemaPath == array || strings.HasPrefix(schemaPath, array+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package bsonic
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ErrDeprecatedField is matched by the warnings for deprecated fields a query used. errors.As finds the
+// *DeprecatedFieldError with the field and its replacement.
+var ErrDeprecatedField = errors.New("deprecated field")
+
+// DeprecatedFieldError reports a deprecated field a query used, which was renamed to its replacement.
+type DeprecatedFieldError struct {
+	// Field is the deprecated field, as configured with WithDeprecatedField
+	Field string
+	// Replacement is the field it was renamed to
+	Replacement string
+}
+
+func (e *DeprecatedFieldError) Error() string {
+	return fmt.Sprintf("field %s is deprecated, use %s", e.Field, e.Replacement)
+}
+
+// Is reports whether target is ErrDeprecatedField.
+func (e *DeprecatedFieldError) Is(target error) bool {
+	return target == ErrDeprecatedField
+}
+
+// renameDeprecatedFields renames the deprecated fields of a result's filter, sort, projection, distinct field and
+// highlights to their replacements, adding a warning for each deprecated field the query used.
+func (p *Parser) renameDeprecatedFields(result *ParseResult) {
+	if len(p.Config.DeprecatedFields) == 0 {
+		return
+	}
+
+	used := map[string]bool{}
+	rename := func(field string) string {
+		deprecated, renamed := p.renameField(field)
+		if deprecated != "" {
+			used[deprecated] = true
+		}
+		return renamed
+	}
+
+	result.Filter = renameFilterFields(result.Filter, rename)
+	if result.DistinctField != "" {
+		result.DistinctField = rename(result.DistinctField)
+	}
+	for i, key := range result.Sort {
+		result.Sort[i].Key = rename(key.Key)
+	}
+	if len(result.Projection) > 0 {
+		projection := make(bson.M, len(result.Projection))
+		for field, value := range result.Projection {
+			projection[rename(field)] = value
+		}
+		result.Projection = projection
+	}
+	for i, highlight := range result.Highlights {
+		if highlight.Field != "" {
+			result.Highlights[i].Field = rename(highlight.Field)
+		}
+	}
+
+	deprecated := make([]string, 0, len(used))
+	for field := range used {
+		deprecated = append(deprecated, field)
+	}
+	slices.Sort(deprecated)
+	for _, field := range deprecated {
+		result.Warnings = append(result.Warnings, Warning{
+			Err: &DeprecatedFieldError{Field: field, Replacement: p.Config.DeprecatedFields[field]},
+		})
+	}
+}
+
+// renameField returns a field renamed to the replacement of the deprecated field it is or is nested beneath,
+// and that deprecated field, or the field unchanged and "" when it is not deprecated. The longest deprecated
+// field matching wins, so user.name can be renamed separately from user.
+func (p *Parser) renameField(field string) (deprecated, renamed string) {
+	renamed = field
+	for name, replacement := range p.Config.DeprecatedFields {
+		if len(name) <= len(deprecated) {
+			continue
+		}
+		if field == name || strings.HasPrefix(field, name+".") {
+			deprecated, renamed = name, replacement+field[len(name):]
+		}
+	}
+	return deprecated, renamed
+}
+
+// withDeprecatedNames returns per-field settings, such as field types, with the deprecated names of their fields
+// added, so the formatter treats a deprecated field like its replacement before the field is renamed.
+func withDeprecatedNames[V any](settings map[string]V, deprecated map[string]string) map[string]V {
+	if len(settings) == 0 || len(deprecated) == 0 {
+		return settings
+	}
+
+	aliased := make(map[string]V, len(settings))
+	for field, value := range settings {
+		aliased[field] = value
+	}
+	for name, replacement := range deprecated {
+		for field, value := range settings {
+			if field == replacement || strings.HasPrefix(field, replacement+".") {
+				if _, ok := aliased[name+field[len(replacement):]]; !ok {
+					aliased[name+field[len(replacement):]] = value
+				}
+			}
+		}
+	}
+	return aliased
+}
@@ -0,0 +1,325 @@
+package bsonic
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ChangeKind is how a part of a query changed between two versions.
+type ChangeKind string
+
+const (
+	// ChangeAdded is a part present only in the second query
+	ChangeAdded ChangeKind = "added"
+	// ChangeRemoved is a part present only in the first query
+	ChangeRemoved ChangeKind = "removed"
+	// ChangeModified is a part present in both queries with a different value
+	ChangeModified ChangeKind = "modified"
+)
+
+// ChangeTarget is the part of a query a Change applies to.
+type ChangeTarget string
+
+const (
+	// TargetClause is a field:value or free text clause
+	TargetClause ChangeTarget = "clause"
+	// TargetLogic is how the clauses are combined with AND, OR, NOT and parentheses
+	TargetLogic ChangeTarget = "logic"
+	// TargetDirective is a sort, limit or fields directive
+	TargetDirective ChangeTarget = "directive"
+	// TargetIntent is a COUNT or DISTINCT prefix
+	TargetIntent ChangeTarget = "intent"
+	// TargetRoute is an in:, collection: or index: routing prefix
+	TargetRoute ChangeTarget = "route"
+	// TargetOption is a query option such as @include_deleted
+	TargetOption ChangeTarget = "option"
+)
+
+// Change describes one difference between two queries.
+type Change struct {
+	Kind   ChangeKind
+	Target ChangeTarget
+	// Field is the field of a clause or the name of a directive or query option; it is empty for free text, logic, intents and routes
+	Field string
+	// Before and After are the part as written in each query, normalized; Before is empty when added and After when removed.
+	// For logic changes they are the whole expressions.
+	Before string
+	After  string
+}
+
+// diffClause is a field or free text clause with the NOT operators that apply to it
+type diffClause struct {
+	field string
+	text  string
+}
+
+// Diff describes the clauses, logic, directives, query options, intent and route added, removed or modified between two Lucene queries,
+// for audit trails of saved query edits. Clauses are compared by their parsed form, so whitespace
+// and clause order do not count as changes. A clause whose value or negation changed on the same field is modified.
+func Diff(q1, q2 string) ([]Change, error) {
+	return guard(func() ([]Change, error) {
+		before, err := parseForDiff(q1)
+		if err != nil {
+			return nil, err
+		}
+		after, err := parseForDiff(q2)
+		if err != nil {
+			return nil, err
+		}
+
+		var changes []Change
+		changes = append(changes, diffOptions(before.Options, after.Options)...)
+		changes = append(changes, diffPrefix(TargetRoute, unparseRoute(before), unparseRoute(after))...)
+		changes = append(changes, diffPrefix(TargetIntent, unparseIntent(before), unparseIntent(after))...)
+		changes = append(changes, diffClauses(collectClauses(before.Expression), collectClauses(after.Expression))...)
+		if logicChanged(before.Expression, after.Expression) {
+			changes = append(changes, Change{
+				Kind:   ChangeModified,
+				Target: TargetLogic,
+				Before: unparseExpression(before.Expression),
+				After:  unparseExpression(after.Expression),
+			})
+		}
+		changes = append(changes, diffDirectives(before.Directives, after.Directives)...)
+		return changes, nil
+	})
+}
+
+// parseForDiff parses a query into a Lucene AST
+func parseForDiff(query string) (*lucene.ParticipleQuery, error) {
+	if strings.TrimSpace(query) == "" {
+		return &lucene.ParticipleQuery{}, nil
+	}
+	ast, err := lucene.New().Parse(lucene.NormalizePunctuation(norm.NFC.String(query)))
+	if err != nil {
+		return nil, err
+	}
+	return ast.(*lucene.ParticipleQuery), nil
+}
+
+// diffClauses matches identical clauses, then pairs the remaining clauses on the same field as modifications
+func diffClauses(before, after []diffClause) []Change {
+	matched := make([]bool, len(after))
+	var unmatched []diffClause
+	for _, clause := range before {
+		if i := indexOfClause(after, matched, func(c diffClause) bool { return c == clause }); i >= 0 {
+			matched[i] = true
+			continue
+		}
+		unmatched = append(unmatched, clause)
+	}
+
+	var changes []Change
+	for _, clause := range unmatched {
+		if i := indexOfClause(after, matched, func(c diffClause) bool { return c.field == clause.field }); i >= 0 {
+			matched[i] = true
+			changes = append(changes, Change{Kind: ChangeModified, Target: TargetClause, Field: clause.field, Before: clause.text, After: after[i].text})
+			continue
+		}
+		changes = append(changes, Change{Kind: ChangeRemoved, Target: TargetClause, Field: clause.field, Before: clause.text})
+	}
+	for i, clause := range after {
+		if !matched[i] {
+			changes = append(changes, Change{Kind: ChangeAdded, Target: TargetClause, Field: clause.field, After: clause.text})
+		}
+	}
+	return changes
+}
+
+// indexOfClause returns the index of the first unmatched clause satisfying match, or -1
+func indexOfClause(clauses []diffClause, matched []bool, match func(diffClause) bool) int {
+	for i, clause := range clauses {
+		if !matched[i] && match(clause) {
+			return i
+		}
+	}
+	return -1
+}
+
+// collectClauses returns the field and free text clauses of an expression in source order
+func collectClauses(expr *lucene.ParticipleExpression) []diffClause {
+	var clauses []diffClause
+	var walk func(expr *lucene.ParticipleExpression)
+	walk = func(expr *lucene.ParticipleExpression) {
+		for _, andExpr := range expr.Or {
+			for _, operand := range andExpr.And {
+				nots := 0
+				for operand.Not != nil {
+					nots++
+					operand = operand.Not
+				}
+				if operand.Term.Group != nil {
+					walk(operand.Term.Group.Expression)
+					continue
+				}
+
+				clause := diffClause{text: strings.Repeat("NOT ", nots) + unparseOperand(operand)}
+				if operand.Term.FieldValue != nil {
+					clause.field = operand.Term.FieldValue.Field
+				}
+				clauses = append(clauses, clause)
+			}
+		}
+	}
+	if expr != nil {
+		walk(expr)
+	}
+	return clauses
+}
+
+// andRun matches clauses joined by AND in a shape
+var andRun = regexp.MustCompile(`_( AND _)+`)
+
+// logicChanged reports whether the logical structure of two expressions differs. When clauses were added
+// or removed, clauses joined by AND count as one, so adding role:admin AND to a query is not a logic change,
+// and neither is adding the first clause to an empty query.
+func logicChanged(before, after *lucene.ParticipleExpression) bool {
+	if before == nil || after == nil {
+		return false
+	}
+	b, a := shape(before), shape(after)
+	if len(collectClauses(before)) != len(collectClauses(after)) {
+		b, a = andRun.ReplaceAllString(b, "_"), andRun.ReplaceAllString(a, "_")
+	}
+	return b != a
+}
+
+// shape returns the logical structure of an expression with every clause replaced by a placeholder,
+// so it only differs between queries when operators, negations or grouping changed
+func shape(expr *lucene.ParticipleExpression) string {
+	if expr == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	for i, andExpr := range expr.Or {
+		if i > 0 {
+			b.WriteString(" OR ")
+		}
+		for j, operand := range andExpr.And {
+			if j > 0 {
+				b.WriteString(" AND ")
+			}
+			// NOT before a clause belongs to the clause, so only NOT before a group is part of the shape
+			nots := 0
+			for operand.Not != nil {
+				nots++
+				operand = operand.Not
+			}
+			if operand.Term.Group != nil {
+				b.WriteString(strings.Repeat("NOT ", nots) + "(" + shape(operand.Term.Group.Expression) + ")")
+			} else {
+				b.WriteString("_")
+			}
+		}
+	}
+	return b.String()
+}
+
+// diffDirectives compares directives by name
+func diffDirectives(before, after []*lucene.ParticipleDirective) []Change {
+	return diffNamed(TargetDirective, directiveParts(before), directiveParts(after))
+}
+
+// diffOptions compares query options by name
+func diffOptions(before, after []*lucene.ParticipleOption) []Change {
+	return diffNamed(TargetOption, optionParts(before), optionParts(after))
+}
+
+// namedPart is a directive or query option: its name and the part as written
+type namedPart struct {
+	name string
+	text string
+}
+
+// directiveParts returns directives as named parts, such as limit:10
+func directiveParts(directives []*lucene.ParticipleDirective) []namedPart {
+	parts := make([]namedPart, len(directives))
+	for i, d := range directives {
+		parts[i] = namedPart{name: d.Name, text: d.Name + ":" + d.Value}
+	}
+	return parts
+}
+
+// optionParts returns query options as named parts, such as @include_deleted or @limit:10
+func optionParts(options []*lucene.ParticipleOption) []namedPart {
+	parts := make([]namedPart, len(options))
+	for i, o := range options {
+		parts[i] = namedPart{name: o.Name, text: lucene.Unparse(&lucene.ParticipleQuery{Options: []*lucene.ParticipleOption{o}})}
+	}
+	return parts
+}
+
+// diffNamed compares directives or query options by name
+func diffNamed(target ChangeTarget, before, after []namedPart) []Change {
+	afterTexts := map[string]string{}
+	for _, part := range after {
+		afterTexts[part.name] = part.text
+	}
+	beforeTexts := map[string]string{}
+
+	var changes []Change
+	for _, part := range before {
+		beforeTexts[part.name] = part.text
+		text, ok := afterTexts[part.name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: ChangeRemoved, Target: target, Field: part.name, Before: part.text})
+		case text != part.text:
+			changes = append(changes, Change{Kind: ChangeModified, Target: target, Field: part.name, Before: part.text, After: text})
+		}
+	}
+	for _, part := range after {
+		if _, ok := beforeTexts[part.name]; !ok {
+			changes = append(changes, Change{Kind: ChangeAdded, Target: target, Field: part.name, After: part.text})
+		}
+	}
+	return changes
+}
+
+// diffPrefix compares the routing or intent prefixes of two queries, given as written
+func diffPrefix(target ChangeTarget, b, a string) []Change {
+	switch {
+	case b == a:
+		return nil
+	case b == "":
+		return []Change{{Kind: ChangeAdded, Target: target, After: a}}
+	case a == "":
+		return []Change{{Kind: ChangeRemoved, Target: target, Before: b}}
+	}
+	return []Change{{Kind: ChangeModified, Target: target, Before: b, After: a}}
+}
+
+// unparseRoute returns the routing prefix of a query, or "" when it has none
+func unparseRoute(q *lucene.ParticipleQuery) string {
+	if q.Collection == "" {
+		return ""
+	}
+	return "in:" + lucene.EscapeField(q.Collection)
+}
+
+// unparseIntent returns the intent prefix of a query, or "" when it has none
+func unparseIntent(q *lucene.ParticipleQuery) string {
+	if q.Intent == nil {
+		return ""
+	}
+	return lucene.Unparse(&lucene.ParticipleQuery{Intent: q.Intent})
+}
+
+// unparseExpression returns the normalized text of an expression
+func unparseExpression(expr *lucene.ParticipleExpression) string {
+	if expr == nil {
+		return ""
+	}
+	return lucene.Unparse(&lucene.ParticipleQuery{Expression: expr})
+}
+
+// unparseOperand returns the normalized text of a single operand
+func unparseOperand(operand *lucene.ParticipleOperand) string {
+	return unparseExpression(&lucene.ParticipleExpression{
+		Or: []*lucene.ParticipleAndExpression{{And: []*lucene.ParticipleOperand{operand}}},
+	})
+}
@@ -0,0 +1,143 @@
+package bsonic
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/formatter"
+	"github.com/kyle-williams-1/bsonic/formatter/mongo"
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"github.com/kyle-williams-1/bsonic/language/mql"
+)
+
+// Error categories returned by the parser. Every error from Parse, ParseDetailed, ParseWithDefaults,
+// Explain and the query combination helpers is an *Error matching exactly one of them with errors.Is,
+// except subquery resolver failures, which are returned as a *mongo.ResolverError.
+var (
+	// ErrSyntax is matched by errors for malformed queries and invalid values or directives, including *EnumError
+	// and *ConflictError
+	ErrSyntax = errors.New("syntax error")
+	// ErrUnsupported is matched by errors for queries or configurations the parser cannot express
+	ErrUnsupported = errors.New("unsupported query")
+	// ErrLimitExceeded is matched by errors for queries exceeding a safety limit, such as the maximum nesting depth,
+	// and for filters too broad for the delete and update helpers
+	ErrLimitExceeded = errors.New("query limit exceeded")
+	// ErrDisallowedField is matched by errors for fields outside the configured allowlist
+	ErrDisallowedField = errors.New("field not allowed")
+)
+
+// ErrUnsupportedByFormatter is matched, together with ErrUnsupported, by errors for language features the
+// formatter does not support with its configuration, such as boosts. errors.As finds the *formatter.FeatureError
+// naming the feature; Parser.Capabilities lists the supported features up front.
+var ErrUnsupportedByFormatter = formatter.ErrUnsupportedByFormatter
+
+// Error is a parser error classified by category. Its message is the message of the underlying error.
+type Error struct {
+	// Kind is the category: ErrSyntax, ErrUnsupported, ErrLimitExceeded or ErrDisallowedField
+	Kind error
+	// Err is the underlying error
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns both the category and the underlying error, so errors.Is and errors.As match either.
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// FieldError reports a field rejected by the configured allowlist.
+type FieldError struct {
+	Field string
+	// Suggestions are the known fields closest to Field, nearest first, when any is close enough to be a likely typo
+	Suggestions []string
+}
+
+func (e *FieldError) Error() string {
+	msg := "field not allowed: " + e.Field
+	if len(e.Suggestions) > 0 {
+		quoted := make([]string, len(e.Suggestions))
+		for i, suggestion := range e.Suggestions {
+			quoted[i] = strconv.Quote(suggestion)
+		}
+		msg += fmt.Sprintf(" (did you mean %s?)", strings.Join(quoted, " or "))
+	}
+	return msg
+}
+
+// Is reports whether target is ErrDisallowedField.
+func (e *FieldError) Is(target error) bool {
+	return target == ErrDisallowedField
+}
+
+// EnumError reports a value, or a wildcard when they are rejected, that an enum field does not allow.
+type EnumError struct {
+	Field string
+	// Value is the rejected value, or the pattern when Wildcard is set
+	Value string
+	// Allowed lists the values the field allows
+	Allowed []string
+	// Wildcard reports whether the value was rejected for being a pattern
+	Wildcard bool
+	// Suggestion is the allowed value closest to Value, if any is close enough to be a likely typo
+	Suggestion string
+}
+
+func (e *EnumError) Error() string {
+	allowed := "allowed values are " + strings.Join(e.Allowed, ", ")
+	if e.Wildcard {
+		return fmt.Sprintf("wildcards are not allowed on field %s: %s", e.Field, allowed)
+	}
+
+	msg := fmt.Sprintf("invalid value %q for field %s: %s", e.Value, e.Field, allowed)
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(" (did you mean %q?)", e.Suggestion)
+	}
+	return msg
+}
+
+// unsupportedf returns an *Error of kind ErrUnsupported with a formatted message.
+func unsupportedf(format string, args ...interface{}) error {
+	return &Error{Kind: ErrUnsupported, Err: fmt.Errorf(format, args...)}
+}
+
+// classify wraps an error in an *Error with its category, leaving nil, already classified
+// and subquery resolver errors unchanged.
+func classify(err error) error {
+	var classified *Error
+	var resolverErr *mongo.ResolverError
+	if err == nil || errors.As(err, &classified) || errors.As(err, &resolverErr) {
+		return err
+	}
+
+	kind := ErrSyntax
+	switch {
+	case errors.Is(err, ErrDisallowedField):
+		kind = ErrDisallowedField
+	case errors.Is(err, lucene.ErrNestingDepth):
+		kind = ErrLimitExceeded
+	case errors.Is(err, mql.ErrUnsupportedOperator), errors.Is(err, mongo.ErrUnsupported):
+		kind = ErrUnsupported
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// guard runs fn, classifying the error it returns and converting a panic into an ErrSyntax error,
+// so untrusted input can never crash the caller.
+func guard[T any](fn func() (T, error)) (result T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			var zero T
+			result = zero
+			// Panics can only be triggered by input the parser failed to reject
+			err = &Error{Kind: ErrSyntax, Err: fmt.Errorf("failed to parse query: %v", r)}
+		}
+	}()
+
+	result, err = fn()
+	return result, classify(err)
+}
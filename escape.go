@@ -0,0 +1,19 @@
+package bsonic
+
+import "github.com/kyle-williams-1/bsonic/language/lucene"
+
+// EscapeValue quotes an untrusted value for splicing into a query string after a field name or as
+// free text, such as "role:" + bsonic.EscapeValue(input). The value is matched literally: it can never
+// add clauses or operators, and is never read as a wildcard, range, regex, number, date or boolean.
+// Curly quotes and other typographic punctuation are written as \u escapes, so they stay literal too.
+func EscapeValue(value string) string {
+	return lucene.QuoteValue(value)
+}
+
+// EscapeField escapes an untrusted field name for splicing into a query string before a colon,
+// such as bsonic.EscapeField(input) + ":active", so it can never add clauses or operators.
+// Field names containing line breaks cannot be escaped; the field allowlist should still be used
+// to restrict which fields may be queried.
+func EscapeField(name string) string {
+	return lucene.EscapeField(name)
+}
@@ -0,0 +1,80 @@
+package bsonic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/formatter/mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ExplainClause maps a single input clause to the BSON fragment it produced.
+type ExplainClause = mongo.ExplainClause
+
+// Explanation describes how a query was converted: the final filter and
+// every input clause with its source span and BSON fragment.
+type Explanation struct {
+	Query   string
+	Filter  bson.M
+	Clauses []ExplainClause
+}
+
+// Explain parses a query and returns the final filter together with a mapping of each
+// input clause to the BSON fragment it produced, to answer "why did this match" questions. The filter is the one
+// ParseDetailed returns, with deprecated fields renamed, conflicts resolved, access rules, policies and the soft
+// delete condition applied, and fragments use the renamed fields. Clause spans and texts refer to the normalized
+// query, with curly quotes and other typographic punctuation replaced by ASCII.
+func (p *Parser) Explain(query string) (*Explanation, error) {
+	p, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	return guard(func() (*Explanation, error) {
+		// The filter and the clause fragments are formatted separately, so they share the subquery resolutions
+		return p.withSubqueries(context.Background()).explain(query)
+	})
+}
+
+// explain builds the Explanation for a query without recovering from panics.
+func (p *Parser) explain(query string) (*Explanation, error) {
+	if strings.TrimSpace(query) == "" {
+		return &Explanation{Query: query, Filter: p.emptyResult().Filter}, nil
+	}
+	if err := p.checkQueryLength(query); err != nil {
+		return nil, err
+	}
+
+	ast, err := p.parseLanguage(query)
+	if err != nil {
+		return nil, err
+	}
+	result, err := p.formatResult(ast, p.formatDefault)
+	if err != nil {
+		return nil, err
+	}
+
+	mongoFormatter, ok := p.formatter.(*mongo.MongoFormatter)
+	if !ok {
+		return nil, fmt.Errorf("formatter is not a MongoFormatter")
+	}
+	clauses, err := mongoFormatter.ExplainClauses(ast, p.Config.DefaultFields)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clause spans refer to the normalized query, which may differ in length from the query given
+	normalized := p.normalize(query)
+	rename := func(field string) string {
+		_, renamed := p.renameField(field)
+		return renamed
+	}
+	for i := range clauses {
+		clauses[i].Text = normalized[clauses[i].Start:clauses[i].End]
+		if len(p.Config.DeprecatedFields) > 0 {
+			clauses[i].BSON = renameFilterFields(clauses[i].BSON, rename)
+		}
+	}
+
+	return &Explanation{Query: query, Filter: result.Filter, Clauses: clauses}, nil
+}
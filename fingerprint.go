@@ -0,0 +1,218 @@
+package bsonic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Fingerprint parses a query with the default parser and returns the hash of its shape; see Parser.Fingerprint.
+func Fingerprint(query string) (string, error) {
+	return New().Fingerprint(query)
+}
+
+// Fingerprint parses a query and returns a stable hash of its shape: the formatted filter, sort and projection
+// with every literal value replaced by a placeholder of its type, as MongoDB's query shape hashes do. Queries
+// differing only in their values, such as name:john and name:jane, share a fingerprint, so metrics can be
+// aggregated by query shape. Since the shape is taken from the formatted query, clause order, whitespace and
+// equivalent syntax do not change it.
+func (p *Parser) Fingerprint(query string) (string, error) {
+	result, err := p.ParseDetailed(query)
+	if err != nil {
+		return "", err
+	}
+	return result.Fingerprint(), nil
+}
+
+// Fingerprint returns the hash of the result's shape, for results that are already parsed; see Parser.Fingerprint.
+func (r *ParseResult) Fingerprint() string {
+	sum := sha256.Sum256([]byte(r.Shape()))
+	return hex.EncodeToString(sum[:])
+}
+
+// Shape returns the shape the fingerprint hashes, a canonical JSON-like rendering of the result's collection,
+// intent, filter, sort, projection and limit with literal values replaced by placeholders such as ?string,
+// ?number and ?array<?string>, for logging next to the fingerprint.
+func (r *ParseResult) Shape() string {
+	var b strings.Builder
+	b.WriteString("{collection:")
+	b.WriteString(strconv.Quote(r.Collection))
+	b.WriteString(",intent:")
+	b.WriteString(strconv.Quote(string(r.Intent)))
+	if r.DistinctField != "" {
+		b.WriteString(",distinct:")
+		b.WriteString(strconv.Quote(r.DistinctField))
+	}
+	b.WriteString(",filter:")
+	b.WriteString(filterShape(r.Filter))
+	if len(r.SearchStage) > 0 {
+		b.WriteString(",search:")
+		b.WriteString(filterShape(r.SearchStage))
+	}
+	if len(r.Sort) > 0 {
+		// Sort directions are part of the shape, since they change the index a query can use
+		b.WriteString(",sort:")
+		b.WriteString(documentShape(r.Sort, literalShape))
+	}
+	if len(r.Projection) > 0 {
+		b.WriteString(",projection:")
+		b.WriteString(documentShape(sortedDoc(r.Projection), literalShape))
+	}
+	if r.Limit > 0 {
+		b.WriteString(",limit:?number")
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// filterShape renders a filter document with its values replaced by placeholders. The clauses of $and, $or and
+// $nor are sorted by their shape, since their order does not change what the filter matches.
+func filterShape(filter bson.M) string {
+	doc := make(bson.D, 0, len(filter))
+	for _, key := range sortedKeys(filter) {
+		doc = append(doc, bson.E{Key: key, Value: filter[key]})
+	}
+	return documentShape(doc, valueShape)
+}
+
+// documentShape renders a document's keys in order, with each value rendered by shape
+func documentShape(doc bson.D, shape func(key string, value interface{}) string) string {
+	parts := make([]string, len(doc))
+	for i, elem := range doc {
+		parts[i] = strconv.Quote(elem.Key) + ":" + shape(elem.Key, elem.Value)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// valueShape renders a filter value: logical operator clauses and operator documents keep their keys,
+// while literals, including embedded documents matched exactly, become placeholders
+func valueShape(key string, value interface{}) string {
+	switch key {
+	case "$and", "$or", "$nor":
+		clauses := bsonfilter.Clauses(value)
+		shapes := make([]string, len(clauses))
+		for i, clause := range clauses {
+			shapes[i] = filterShape(clause)
+		}
+		slices.Sort(shapes)
+		return "[" + strings.Join(shapes, ",") + "]"
+	case "$elemMatch":
+		// Element matches hold a filter on the fields of the array elements
+		if doc, ok := value.(bson.M); ok {
+			return filterShape(doc)
+		}
+	}
+
+	switch v := value.(type) {
+	case bson.M:
+		if isOperatorDoc(v) {
+			return filterShape(v)
+		}
+	case bson.D:
+		doc := bson.M{}
+		for _, elem := range v {
+			doc[elem.Key] = elem.Value
+		}
+		if isOperatorDoc(doc) {
+			return filterShape(doc)
+		}
+	}
+	return placeholder(value)
+}
+
+// placeholder returns the placeholder of a literal value's type, such as ?string or ?array<?number>
+func placeholder(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "?null"
+	case string:
+		return "?string"
+	case bool:
+		return "?bool"
+	case int, int32, int64, float32, float64, bson.Decimal128:
+		return "?number"
+	case time.Time, bson.DateTime:
+		return "?date"
+	case bson.ObjectID:
+		return "?objectId"
+	case bson.Regex:
+		return "?regex"
+	case bson.M, bson.D:
+		return "?object"
+	case []interface{}:
+		return arrayPlaceholder(v)
+	case bson.A:
+		return arrayPlaceholder(v)
+	case []string:
+		return "?array<?string>"
+	case []bson.M:
+		return "?array<?object>"
+	}
+	return "?"
+}
+
+// arrayPlaceholder returns ?array<T> for an array of values of a single type T, and ?array<> otherwise
+func arrayPlaceholder(values []interface{}) string {
+	var element string
+	for i, value := range values {
+		shape := placeholder(value)
+		if i > 0 && shape != element {
+			return "?array<>"
+		}
+		element = shape
+	}
+	return "?array<" + element + ">"
+}
+
+// isOperatorDoc reports whether every key of a document is an operator, so it is a condition rather than a literal
+func isOperatorDoc(doc bson.M) bool {
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return len(doc) > 0
+}
+
+// sortedKeys returns the keys of a document in order
+func sortedKeys(doc bson.M) []string {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// sortedDoc returns a document's elements ordered by key
+func sortedDoc(doc bson.M) bson.D {
+	sorted := make(bson.D, 0, len(doc))
+	for _, key := range sortedKeys(doc) {
+		sorted = append(sorted, bson.E{Key: key, Value: doc[key]})
+	}
+	return sorted
+}
+
+// literalShape keeps the values of sort and projection documents, which are directions and inclusion flags
+// rather than literals
+func literalShape(_ string, value interface{}) string {
+	switch v := value.(type) {
+	case int:
+		return strconv.Itoa(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return placeholder(value)
+}
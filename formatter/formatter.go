@@ -1,13 +1,169 @@
 // Package formatter provides interfaces for query result formatters.
 package formatter
 
-import "go.mongodb.org/mongo-driver/v2/bson"
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
 
 // Formatter represents a query result formatter for a specific output type.
 type Formatter[T any] interface {
+	// FormatResult formats a parsed query into its filter and everything else the query needs
+	FormatResult(ast interface{}, opts Options) (*Result[T], error)
+	// Capabilities reports the language features the formatter supports with its configuration
+	Capabilities() Capabilities
+}
+
+// Options are the per-query inputs of FormatResult.
+type Options struct {
+	// DefaultFields are the fields free text is searched in. Without them, free text is formatted for a
+	// search index, such as a $text query, or rejected.
+	DefaultFields []string
+	// FieldWeights are the relevance weights of the default fields, for formatters that rank free text matches
+	FieldWeights map[string]int
+}
+
+// Result is a formatted query: the filter plus the pipeline stages, warnings and metadata a formatter
+// produced for it. Formatters leave the fields they have nothing for empty.
+type Result[T any] struct {
+	// Filter matches the documents the query selects
+	Filter T
+	// PreStages run before the filter in an aggregation pipeline, such as an Atlas Search $search stage,
+	// which must be the first stage
+	PreStages []T
+	// PostStages run after the filter, such as a stage ranking the matches by relevance
+	PostStages []T
+	// Warnings describe parts of the query the formatter accepted but may not have formatted as intended
+	Warnings []string
+	// Metadata holds formatter-specific results under the keys the formatter documents, such as sort and
+	// projection directives
+	Metadata map[string]interface{}
+}
+
+// LegacyFormatter is the Formatter interface before Result, returning bare filters.
+type LegacyFormatter[T any] interface {
 	Format(ast interface{}) (T, error)
 	FormatWithDefaults(ast interface{}, defaultFields []string) (T, error)
 }
 
+// FromLegacy adapts a LegacyFormatter to Formatter. Its results only hold a filter, formatted with
+// FormatWithDefaults when there are default fields and with Format otherwise. Its capabilities come from
+// a Capabilities method when f has one, and are empty otherwise.
+func FromLegacy[T any](f LegacyFormatter[T]) Formatter[T] {
+	return legacyAdapter[T]{f}
+}
+
+type legacyAdapter[T any] struct {
+	formatter LegacyFormatter[T]
+}
+
+func (a legacyAdapter[T]) FormatResult(ast interface{}, opts Options) (*Result[T], error) {
+	var filter T
+	var err error
+	if len(opts.DefaultFields) == 0 {
+		filter, err = a.formatter.Format(ast)
+	} else {
+		filter, err = a.formatter.FormatWithDefaults(ast, opts.DefaultFields)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Result[T]{Filter: filter}, nil
+}
+
+func (a legacyAdapter[T]) Capabilities() Capabilities {
+	if f, ok := a.formatter.(interface{ Capabilities() Capabilities }); ok {
+		return f.Capabilities()
+	}
+	return Capabilities{}
+}
+
+// ToLegacy adapts a Formatter to LegacyFormatter, for code written against the bare filter methods.
+// Everything in a Result besides the filter is dropped.
+func ToLegacy[T any](f Formatter[T]) LegacyFormatter[T] {
+	return filterAdapter[T]{f}
+}
+
+type filterAdapter[T any] struct {
+	formatter Formatter[T]
+}
+
+func (a filterAdapter[T]) Format(ast interface{}) (T, error) {
+	return a.filter(ast, Options{})
+}
+
+func (a filterAdapter[T]) FormatWithDefaults(ast interface{}, defaultFields []string) (T, error) {
+	return a.filter(ast, Options{DefaultFields: defaultFields})
+}
+
+func (a filterAdapter[T]) filter(ast interface{}, opts Options) (T, error) {
+	result, err := a.formatter.FormatResult(ast, opts)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result.Filter, nil
+}
+
 // Type aliases for formatter types
 type MongoFormatter = Formatter[bson.M]
+
+// Feature is a query language feature that a formatter may not support, or only with some configurations.
+type Feature string
+
+const (
+	// FeatureBoost is a relevance boost such as name:john^2
+	FeatureBoost Feature = "boost"
+	// FeatureFuzzy is a fuzzy term such as name:jon~1
+	FeatureFuzzy Feature = "fuzzy"
+	// FeatureProximity is a phrase proximity search such as "john smith"~3
+	FeatureProximity Feature = "proximity"
+	// FeatureSubquery is a reference to the results of another query, such as IN_QUERY(users WHERE role:admin)
+	FeatureSubquery Feature = "subquery"
+	// FeatureRegexFreeText is a /pattern/ free text regex
+	FeatureRegexFreeText Feature = "regex_free_text"
+	// FeatureFreeTextOr is free text combined with other clauses by OR, as in john OR status:active
+	FeatureFreeTextOr Feature = "free_text_or"
+	// FeatureNegatedFreeText is free text negated together with other clauses, as in NOT (john AND status:active)
+	FeatureNegatedFreeText Feature = "negated_free_text"
+	// FeatureMultiWordValues is an unquoted field value followed by free text, as in name:John Doe
+	FeatureMultiWordValues Feature = "multi_word_values"
+)
+
+// Features returns every Feature a formatter reports in its Capabilities.
+func Features() []Feature {
+	return []Feature{
+		FeatureBoost, FeatureFuzzy, FeatureProximity, FeatureSubquery, FeatureRegexFreeText,
+		FeatureFreeTextOr, FeatureNegatedFreeText, FeatureMultiWordValues,
+	}
+}
+
+// Capabilities maps each Feature to whether a formatter supports it with its configuration, so frontends can
+// hide syntax that would fail. Features missing from the map are not supported.
+type Capabilities map[Feature]bool
+
+// Supports reports whether the feature is supported.
+func (c Capabilities) Supports(feature Feature) bool {
+	return c[feature]
+}
+
+// ErrUnsupportedByFormatter is matched by errors for language features the formatter does not support with
+// its configuration. They are *FeatureError values naming the feature.
+var ErrUnsupportedByFormatter = errors.New("feature not supported by formatter")
+
+// FeatureError reports a query using a language feature the formatter does not support with its configuration.
+type FeatureError struct {
+	Feature Feature
+	// Message explains what is not supported and how to write the query instead
+	Message string
+}
+
+func (e *FeatureError) Error() string {
+	return e.Message
+}
+
+// Is reports whether target is ErrUnsupportedByFormatter.
+func (e *FeatureError) Is(target error) bool {
+	return target == ErrUnsupportedByFormatter
+}
@@ -0,0 +1,156 @@
+package mongo
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"golang.org/x/text/unicode/norm"
+)
+
+// accentVariants maps each ASCII letter to the precomposed Latin letters that decompose to it plus
+// combining marks, such as e to éèêë, so accent-insensitive regexes can match any of them.
+var accentVariants = buildAccentVariants()
+
+// buildAccentVariants collects the accented forms of ASCII letters from the Latin-1 Supplement
+// and Latin Extended-A blocks
+func buildAccentVariants() map[rune][]rune {
+	variants := map[rune][]rune{}
+	for r := rune(0x00C0); r <= 0x017F; r++ {
+		if base, ok := accentBase(r); ok {
+			variants[base] = append(variants[base], r)
+		}
+	}
+	return variants
+}
+
+// accentBase returns the ASCII letter a precomposed letter decomposes to, if it is an accented ASCII letter
+func accentBase(r rune) (rune, bool) {
+	decomposed := []rune(norm.NFD.String(string(r)))
+	if len(decomposed) < 2 || decomposed[0] > unicode.MaxASCII || !unicode.IsLetter(decomposed[0]) {
+		return 0, false
+	}
+	for _, mark := range decomposed[1:] {
+		if !unicode.Is(unicode.Mn, mark) {
+			return 0, false
+		}
+	}
+	return decomposed[0], true
+}
+
+// WithAccentInsensitive sets whether generated regexes and string values match regardless of accents
+// and returns the formatter, so cafe matches café and café matches cafe. Values of exactFields, such as
+// enum fields whose values are validated against a fixed list, are still matched exactly.
+func (f *MongoFormatter) WithAccentInsensitive(enabled bool, exactFields ...string) *MongoFormatter {
+	f.accentInsensitive = enabled
+	f.accentExactFields = nil
+	if len(exactFields) > 0 {
+		f.accentExactFields = make(map[string]bool, len(exactFields))
+		for _, field := range exactFields {
+			f.accentExactFields[field] = true
+		}
+	}
+	return f
+}
+
+// foldAccents replaces every letter of a regex pattern that has accented forms with a character class
+// of all of them, when accent-insensitive matching is enabled. Patterns must only contain escaped
+// punctuation, never escape sequences such as \w, so letters are always literal.
+func (f *MongoFormatter) foldAccents(pattern string) string {
+	if !f.accentInsensitive {
+		return pattern
+	}
+
+	var b strings.Builder
+	for _, r := range pattern {
+		base := r
+		if accented, ok := accentBase(r); ok {
+			base = accented
+		}
+
+		variants, ok := accentVariants[base]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteRune('[')
+		b.WriteRune(base)
+		b.WriteString(string(variants))
+		b.WriteRune(']')
+	}
+	return b.String()
+}
+
+// accentFolded is a plain string value to be matched regardless of accents. It stays an equality
+// while the filter's logical structure is normalized, so f:a OR f:b still becomes $in, and is
+// written out as an anchored regex by foldValues.
+type accentFolded struct {
+	pattern string
+}
+
+// accentInsensitiveValue marks a plain string field value to be matched regardless of accents,
+// leaving other values, exact fields and strings without foldable letters unchanged.
+func (f *MongoFormatter) accentInsensitiveValue(field string, value interface{}) interface{} {
+	str, ok := value.(string)
+	if !ok || !f.accentInsensitive || f.accentExactFields[field] || f.accentExactFields[config.SchemaPath(field)] {
+		return value
+	}
+
+	escaped := f.escapeRegex(str)
+	pattern := f.foldAccents(escaped)
+	if pattern == escaped {
+		return value
+	}
+	return accentFolded{pattern: "^" + pattern + "$"}
+}
+
+// foldValues writes each accent-folded value in a filter as a regex: an equality becomes $regex,
+// $ne becomes $not with $regex, and $in and $nin elements become regexes.
+func foldValues(filter bson.M) bson.M {
+	result := make(bson.M, len(filter))
+	for key, value := range filter {
+		switch v := value.(type) {
+		case []bson.M:
+			result[key] = mapClauses(v, foldValues)
+		default:
+			result[key] = foldCondition(value)
+		}
+	}
+	return result
+}
+
+// foldCondition writes the accent-folded values of a single field condition as regexes
+func foldCondition(condition interface{}) interface{} {
+	switch v := condition.(type) {
+	case accentFolded:
+		return bson.M{"$regex": v.pattern}
+	case bson.M:
+		result := make(bson.M, len(v))
+		for op, operand := range v {
+			switch o := operand.(type) {
+			case accentFolded:
+				if op == "$ne" {
+					result["$not"] = bson.M{"$regex": o.pattern}
+				} else {
+					result[op] = bson.Regex{Pattern: o.pattern}
+				}
+			case []interface{}:
+				values := make([]interface{}, len(o))
+				for i, element := range o {
+					if folded, ok := element.(accentFolded); ok {
+						element = bson.Regex{Pattern: folded.pattern}
+					}
+					values[i] = element
+				}
+				result[op] = values
+			case []bson.M:
+				result[op] = mapClauses(o, foldValues)
+			default:
+				result[op] = foldCondition(operand)
+			}
+		}
+		return result
+	}
+	return condition
+}
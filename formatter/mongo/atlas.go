@@ -0,0 +1,285 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/formatter"
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"github.com/kyle-williams-1/bsonic/language/mql"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// WithAtlasSearchIndex sets the Atlas Search index named in $search stages and returns the formatter.
+// An empty name uses the "default" index.
+func (f *MongoFormatter) WithAtlasSearchIndex(index string) *MongoFormatter {
+	f.atlasSearchIndex = index
+	return f
+}
+
+// FormatSearchStage builds an Atlas Search $search aggregation stage from the free text of a parsed query.
+// Free text is searched across the default fields, or every indexed field when none are given.
+// It returns nil when the query has no free text.
+func (f *MongoFormatter) FormatSearchStage(ast interface{}, defaultFields []string) (bson.M, error) {
+	// MQL filters have no free text
+	if _, ok := ast.(*mql.Query); ok {
+		return nil, nil
+	}
+
+	participleQuery, ok := ast.(*lucene.ParticipleQuery)
+	if !ok {
+		return nil, fmt.Errorf("expected *lucene.ParticipleQuery AST, got %T", ast)
+	}
+
+	if participleQuery.Expression == nil {
+		return nil, nil
+	}
+
+	var must, mustNot []bson.M
+	if err := f.searchExpression(participleQuery.Expression, defaultFields, false, &must, &mustNot); err != nil {
+		return nil, err
+	}
+
+	if len(must) == 0 && len(mustNot) == 0 {
+		return nil, nil
+	}
+
+	search := bson.M{}
+	if f.atlasSearchIndex != "" {
+		search["index"] = f.atlasSearchIndex
+	}
+
+	if len(must) == 1 && len(mustNot) == 0 {
+		// A single positive clause needs no compound wrapper
+		for operator, body := range must[0] {
+			search[operator] = body
+		}
+	} else {
+		compound := bson.M{}
+		if len(must) > 0 {
+			compound["must"] = must
+		}
+		if len(mustNot) > 0 {
+			compound["mustNot"] = mustNot
+		}
+		search["compound"] = compound
+	}
+
+	return bson.M{"$search": search}, nil
+}
+
+// searchExpression collects Atlas Search clauses from an expression.
+// Free text must be ANDed with the rest of the query, since $search runs before the $match filter.
+func (f *MongoFormatter) searchExpression(expr *lucene.ParticipleExpression, defaultFields []string, negated bool, must, mustNot *[]bson.M) error {
+	if len(expr.Or) > 1 {
+		if !hasFreeText(expr) {
+			return nil
+		}
+		// Free text ORed only with free text, as in ("John Doe" OR "Jane Smith"), is a single should clause
+		clause, ok, err := f.searchAlternatives(expr, defaultFields)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return unsupportedFeaturef(formatter.FeatureFreeTextOr, "free text cannot be combined with OR when using Atlas Search")
+		}
+		if clause == nil {
+			return nil
+		}
+		if negated {
+			*mustNot = append(*mustNot, clause)
+		} else {
+			*must = append(*must, clause)
+		}
+		return nil
+	}
+
+	for _, operand := range expr.Or[0].And {
+		if err := f.searchOperand(operand, defaultFields, negated, must, mustNot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchOperand collects Atlas Search clauses from an operand, flipping between must and mustNot for NOT
+func (f *MongoFormatter) searchOperand(operand *lucene.ParticipleOperand, defaultFields []string, negated bool, must, mustNot *[]bson.M) error {
+	if operand.Not != nil {
+		return f.searchOperand(operand.Not, defaultFields, !negated, must, mustNot)
+	}
+
+	term := operand.Term
+	switch {
+	case term.FieldValue != nil && term.FieldValue.Nested != nil:
+		expr, err := term.FieldValue.ExpandNested()
+		if err != nil {
+			return err
+		}
+		return f.searchOperand(&lucene.ParticipleOperand{Term: &lucene.ParticipleTerm{Group: &lucene.ParticipleGroup{Expression: expr}}},
+			defaultFields, negated, must, mustNot)
+	case term.FieldValue != nil:
+		// "name:john doe" means name:john OR doe, which cannot be split across $search and $match
+		if _, freeText := term.FieldValue.SplitIntoFieldAndText(); freeText != nil {
+			return unsupportedFeaturef(formatter.FeatureMultiWordValues, "field value %s:%s contains free text; quote the value when using Atlas Search",
+				term.FieldValue.Field, strings.Join(term.FieldValue.Value.TextTerms, " "))
+		}
+	case term.FreeText != nil:
+		clause, err := f.searchClause(term.FreeText, defaultFields)
+		if err != nil {
+			return err
+		}
+		if clause == nil {
+			return nil
+		}
+		if negated {
+			*mustNot = append(*mustNot, clause)
+		} else {
+			*must = append(*must, clause)
+		}
+	case term.Group != nil:
+		group := term.Group.Expression
+		// NOT (a AND b) cannot be split into independent search and filter negations
+		if negated && len(group.Or) == 1 && operandCount(group) > 1 && hasFreeText(group) {
+			return unsupportedFeaturef(formatter.FeatureNegatedFreeText, "free text cannot be negated together with other clauses when using Atlas Search")
+		}
+		return f.searchExpression(group, defaultFields, negated, must, mustNot)
+	}
+	return nil
+}
+
+// searchAlternatives converts an expression made only of free text, such as ("John Doe" OR "Jane Smith"), to a
+// compound clause matching any of its OR branches, keeping each phrase whole. It reports false when the expression
+// holds anything other than free text, which cannot be ORed across the $search stage and the $match filter, and
+// returns a nil clause when the tokenizer drops every word.
+func (f *MongoFormatter) searchAlternatives(expr *lucene.ParticipleExpression, defaultFields []string) (bson.M, bool, error) {
+	var should []bson.M
+	for _, andExpr := range expr.Or {
+		var must, mustNot []bson.M
+		for _, operand := range andExpr.And {
+			negated := false
+			for operand.Not != nil {
+				operand, negated = operand.Not, !negated
+			}
+
+			var clause bson.M
+			var err error
+			switch term := operand.Term; {
+			case term.FreeText != nil && term.Modifier == nil:
+				clause, err = f.searchClause(term.FreeText, defaultFields)
+			case term.Group != nil && term.Modifier == nil:
+				var ok bool
+				clause, ok, err = f.searchAlternatives(term.Group.Expression, defaultFields)
+				if !ok {
+					return nil, false, err
+				}
+			default:
+				return nil, false, nil
+			}
+			if err != nil {
+				return nil, false, err
+			}
+			if clause == nil {
+				continue
+			}
+			if negated {
+				mustNot = append(mustNot, clause)
+			} else {
+				must = append(must, clause)
+			}
+		}
+
+		switch {
+		case len(must) == 1 && len(mustNot) == 0:
+			should = append(should, must[0])
+		case len(must) > 0 || len(mustNot) > 0:
+			compound := bson.M{}
+			if len(must) > 0 {
+				compound["must"] = must
+			}
+			if len(mustNot) > 0 {
+				compound["mustNot"] = mustNot
+			}
+			should = append(should, bson.M{"compound": compound})
+		}
+	}
+
+	switch len(should) {
+	case 0:
+		return nil, true, nil
+	case 1:
+		return should[0], true, nil
+	}
+	return bson.M{"compound": bson.M{"should": should, "minimumShouldMatch": 1}}, true, nil
+}
+
+// searchClause converts free text to an Atlas Search operator: phrase for quoted values, regex for /regex/ and text otherwise.
+// It returns nil when the tokenizer drops every word.
+func (f *MongoFormatter) searchClause(ft *lucene.ParticipleFreeText, defaultFields []string) (bson.M, error) {
+	var path interface{} = bson.M{"wildcard": "*"}
+	if len(defaultFields) == 1 {
+		path = defaultFields[0]
+	} else if len(defaultFields) > 1 {
+		path = defaultFields
+	}
+
+	switch {
+	case ft.QuotedValue != nil:
+		return bson.M{"phrase": bson.M{"query": ft.QuotedValue.Text(), "path": path}}, nil
+	case ft.UnquotedValue != nil:
+		words := f.freeTextWords(ft.UnquotedValue)
+		if len(words) == 0 {
+			// Every word was dropped by the tokenizer
+			return nil, nil
+		}
+		query := strings.Join(words, " ")
+		switch f.multiWordMode {
+		case config.MultiWordPhrase:
+			return bson.M{"phrase": bson.M{"query": query, "path": path}}, nil
+		case config.MultiWordAll:
+			return bson.M{"text": bson.M{"query": query, "path": path, "matchCriteria": "all"}}, nil
+		}
+		return bson.M{"text": bson.M{"query": query, "path": path}}, nil
+	case ft.RegexValue != nil:
+		pattern := (*ft.RegexValue)[1 : len(*ft.RegexValue)-1]
+		return bson.M{"regex": bson.M{"query": pattern, "path": path, "allowAnalyzedField": true}}, nil
+	}
+	return nil, errors.New("empty free text")
+}
+
+// hasFreeText reports whether an expression contains free text at any depth
+func hasFreeText(expr *lucene.ParticipleExpression) bool {
+	for _, andExpr := range expr.Or {
+		for _, operand := range andExpr.And {
+			for operand.Not != nil {
+				operand = operand.Not
+			}
+			term := operand.Term
+			if term.FreeText != nil {
+				return true
+			}
+			if term.FieldValue != nil {
+				if _, freeText := term.FieldValue.SplitIntoFieldAndText(); freeText != nil {
+					return true
+				}
+			}
+			if term.Group != nil && hasFreeText(term.Group.Expression) {
+				return true
+			}
+			if nested := nestedExpression(term); nested != nil && hasFreeText(nested) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// operandCount returns the number of operands across all branches of an expression
+func operandCount(expr *lucene.ParticipleExpression) int {
+	count := 0
+	for _, andExpr := range expr.Or {
+		count += len(andExpr.And)
+	}
+	return count
+}
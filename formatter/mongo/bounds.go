@@ -0,0 +1,161 @@
+package mongo
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// boundOperators are the comparison operators that bound a range, mapped to whether they bound it from below
+var boundOperators = map[string]bool{"$gt": true, "$gte": true, "$lt": false, "$lte": false}
+
+// mergeBoundsInto merges a single-field range condition, such as {age: {$lt: 65}}, into an existing range
+// on the same field in directFields or conditions, so age:>=18 AND age:<65 becomes {age: {$gte: 18, $lt: 65}}.
+// It reports whether the condition was merged, and returns an error when the merged range cannot match anything.
+func (f *MongoFormatter) mergeBoundsInto(directFields bson.M, conditions []bson.M, condition bson.M) (bool, error) {
+	if len(condition) != 1 {
+		return false, nil
+	}
+
+	for field, value := range condition {
+		bounds, ok := rangeBounds(value)
+		if !ok {
+			return false, nil
+		}
+
+		if existing, ok := rangeBounds(directFields[field]); ok {
+			merged, ok, err := mergeBounds(field, existing, bounds)
+			if ok {
+				directFields[field] = merged
+			}
+			return ok, err
+		}
+		for _, c := range conditions {
+			if len(c) != 1 {
+				continue
+			}
+			if existing, ok := rangeBounds(c[field]); ok {
+				merged, ok, err := mergeBounds(field, existing, bounds)
+				if ok {
+					c[field] = merged
+				}
+				return ok, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// rangeBounds returns a condition value made up only of range operators
+func rangeBounds(value interface{}) (bson.M, bool) {
+	bounds, ok := value.(bson.M)
+	if !ok || len(bounds) == 0 {
+		return nil, false
+	}
+	for op := range bounds {
+		if _, ok := boundOperators[op]; !ok {
+			return nil, false
+		}
+	}
+	return bounds, true
+}
+
+// mergeBounds intersects two ranges, keeping the tighter lower and upper bound. It reports false
+// when the bounds are of incomparable types, and an error when the intersection is empty.
+func mergeBounds(field string, a, b bson.M) (bson.M, bool, error) {
+	merged := bson.M{}
+	for _, bounds := range []bson.M{a, b} {
+		for op, value := range bounds {
+			lower := boundOperators[op]
+			current, currentValue, found := boundOf(merged, lower)
+			if !found {
+				merged[op] = value
+				continue
+			}
+
+			cmp, ok := compareBounds(value, currentValue)
+			if !ok {
+				return nil, false, nil
+			}
+			// The tighter bound is the greater lower bound or the smaller upper bound; on a tie the exclusive one wins
+			tighter := (lower && cmp > 0) || (!lower && cmp < 0) || (cmp == 0 && (op == "$gt" || op == "$lt"))
+			if tighter {
+				delete(merged, current)
+				merged[op] = value
+			}
+		}
+	}
+
+	lowerOp, lowerValue, hasLower := boundOf(merged, true)
+	upperOp, upperValue, hasUpper := boundOf(merged, false)
+	if !hasLower || !hasUpper {
+		return merged, true, nil
+	}
+
+	cmp, ok := compareBounds(lowerValue, upperValue)
+	if !ok {
+		return nil, false, nil
+	}
+	if cmp > 0 || (cmp == 0 && (lowerOp == "$gt" || upperOp == "$lt")) {
+		return nil, false, fmt.Errorf("impossible range on field %s: no value is %s %s and %s %s",
+			field, boundSymbol(lowerOp), formatBound(lowerValue), boundSymbol(upperOp), formatBound(upperValue))
+	}
+	return merged, true, nil
+}
+
+// boundOf returns the lower or upper bound of a range, if it has one
+func boundOf(bounds bson.M, lower bool) (string, interface{}, bool) {
+	for op, value := range bounds {
+		if boundOperators[op] == lower {
+			return op, value, true
+		}
+	}
+	return "", nil, false
+}
+
+// compareBounds compares two bound values of the same kind, reporting false if they cannot be compared
+func compareBounds(a, b interface{}) (int, bool) {
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case time.Time:
+		y, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		return x.Compare(y), true
+	}
+	return 0, false
+}
+
+// boundSymbol returns the query syntax for a range operator
+func boundSymbol(op string) string {
+	switch op {
+	case "$gt":
+		return ">"
+	case "$gte":
+		return ">="
+	case "$lt":
+		return "<"
+	}
+	return "<="
+}
+
+// formatBound formats a bound value for an error message
+func formatBound(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,51 @@
+package mongo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// bsonTypeAliases maps the lower-cased $type aliases MongoDB accepts to their canonical spelling
+var bsonTypeAliases = map[string]string{}
+
+func init() {
+	for _, alias := range []string{
+		"double", "string", "object", "array", "binData", "undefined", "objectId", "bool", "date", "null",
+		"regex", "dbPointer", "javascript", "symbol", "javascriptWithScope", "int", "timestamp", "long",
+		"decimal", "minKey", "maxKey", "number",
+	} {
+		bsonTypeAliases[strings.ToLower(alias)] = alias
+	}
+}
+
+// bsonTypeNumbers are the BSON type numbers MongoDB accepts for $type
+var bsonTypeNumbers = map[int32]bool{
+	1: true, 2: true, 3: true, 4: true, 5: true, 6: true, 7: true, 8: true, 9: true, 10: true, 11: true,
+	12: true, 13: true, 14: true, 15: true, 16: true, 17: true, 18: true, 19: true, -1: true, 127: true,
+}
+
+// parseTypeCheck converts the type names of field:TYPE(...) into a $type condition. Aliases are matched
+// case-insensitively, as in TYPE(objectid), and numbers are BSON type numbers, as in TYPE(2).
+func parseTypeCheck(value *lucene.ParticipleValue) (bson.M, error) {
+	var types []interface{}
+	for _, name := range value.TypeNames() {
+		if alias, ok := bsonTypeAliases[strings.ToLower(name)]; ok {
+			types = append(types, alias)
+			continue
+		}
+		number, err := strconv.ParseInt(name, 10, 32)
+		if err != nil || !bsonTypeNumbers[int32(number)] {
+			return nil, fmt.Errorf("unknown BSON type: %s", name)
+		}
+		types = append(types, int32(number))
+	}
+
+	if len(types) == 1 {
+		return bson.M{"$type": types[0]}, nil
+	}
+	return bson.M{"$type": bson.A(types)}, nil
+}
@@ -0,0 +1,55 @@
+package mongo
+
+import (
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/formatter"
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+)
+
+// Capabilities reports the language features the formatter supports with its configuration. MongoDB filters
+// match without scoring, so boosts, fuzzy terms and phrase proximity are never supported; IN_QUERY needs a
+// subquery resolver, regex free text needs a strategy other than $text, and $text and Atlas Search limit how
+// free text combines with other clauses.
+func (f *MongoFormatter) Capabilities() formatter.Capabilities {
+	atlas := f.textStrategy == config.StrategyAtlasSearch && !f.legacyTextCompat
+	textIndex := f.textStrategy == config.StrategyTextIndex || f.legacyTextCompat
+	return formatter.Capabilities{
+		formatter.FeatureBoost:           false,
+		formatter.FeatureFuzzy:           false,
+		formatter.FeatureProximity:       false,
+		formatter.FeatureSubquery:        f.subqueryResolver != nil,
+		formatter.FeatureRegexFreeText:   f.textStrategy != config.StrategyTextIndex && !f.legacyTextCompat,
+		formatter.FeatureFreeTextOr:      !atlas,
+		formatter.FeatureNegatedFreeText: !atlas && !textIndex,
+		formatter.FeatureMultiWordValues: !atlas,
+	}
+}
+
+// checkModifier rejects a boost, fuzziness or proximity modifier such as ^2 or ~1 on a term
+func checkModifier(term *lucene.ParticipleTerm) error {
+	if term.Modifier == nil {
+		return nil
+	}
+
+	modifier := *term.Modifier
+	switch {
+	case strings.HasPrefix(modifier, "^"):
+		return unsupportedFeaturef(formatter.FeatureBoost,
+			"boost %s is not supported: MongoDB filters do not score matches; remove it, or rank free text with weighted default fields", modifier)
+	case isPhrase(term):
+		return unsupportedFeaturef(formatter.FeatureProximity,
+			"phrase proximity %s is not supported; remove it to search for the exact phrase", modifier)
+	}
+	return unsupportedFeaturef(formatter.FeatureFuzzy,
+		"fuzzy search %s is not supported; remove it, or match variations with a wildcard such as jo*", modifier)
+}
+
+// isPhrase reports whether a term is quoted free text or a quoted field value
+func isPhrase(term *lucene.ParticipleTerm) bool {
+	if term.FreeText != nil {
+		return term.FreeText.QuotedValue != nil
+	}
+	return term.FieldValue != nil && term.FieldValue.Value != nil && term.FieldValue.Value.IsQuoted()
+}
@@ -0,0 +1,53 @@
+package mongo
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// parseCast converts the value of a cast such as int(42), date("2023-01-15") or str(true) to the cast's type.
+// Casts replace value detection and field type coercion, so a value that does not convert is an error
+// rather than a string.
+func (f *MongoFormatter) parseCast(value *lucene.ParticipleValue) (interface{}, error) {
+	name, text, _ := value.CastValue()
+	switch name {
+	case "int":
+		if n, err := strconv.ParseInt(text, 10, 32); err == nil {
+			return int32(n), nil
+		}
+	case "long":
+		if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return n, nil
+		}
+	case "double":
+		if n, err := f.parseNumber(text); err == nil {
+			return n, nil
+		}
+	case "decimal":
+		if d, err := bson.ParseDecimal128(text); err == nil {
+			return d, nil
+		}
+	case "str", "string":
+		return text, nil
+	case "bool":
+		if b, err := strconv.ParseBool(text); err == nil {
+			return b, nil
+		}
+	case "date":
+		if date, err := f.parseDate(text); err == nil {
+			return date, nil
+		}
+	case "oid", "objectId":
+		if objectID, err := bson.ObjectIDFromHex(text); err == nil {
+			return objectID, nil
+		}
+	case "uuid":
+		if uuid, ok := parseUUID(text); ok {
+			return uuid, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot cast %q to %s", text, name)
+}
@@ -0,0 +1,207 @@
+package mongo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// WithValueCoercers sets the value coercers of fields and of field types, used to normalize query values
+// before the filter is emitted, and returns the formatter.
+func (f *MongoFormatter) WithValueCoercers(fields map[string]config.ValueCoercer, types map[config.FieldType]config.ValueCoercer) *MongoFormatter {
+	f.fieldCoercers = fields
+	f.typeCoercers = types
+	return f
+}
+
+// valueCoercer returns the coercer of a field, or of its path without array indexes, falling back to the
+// coercer of the field's type. It returns nil when the field has none.
+func (f *MongoFormatter) valueCoercer(field string) config.ValueCoercer {
+	if coercer, ok := f.fieldCoercers[field]; ok {
+		return coercer
+	}
+	if coercer, ok := f.fieldCoercers[config.SchemaPath(field)]; ok {
+		return coercer
+	}
+	if fieldType, ok := f.fieldType(field); ok {
+		return f.typeCoercers[fieldType]
+	}
+	return nil
+}
+
+// coerceValues returns a filter with the values of every field condition passed through the field's coercer,
+// descending into $and, $or and $nor clauses.
+func (f *MongoFormatter) coerceValues(filter bson.M) (bson.M, error) {
+	if len(f.fieldCoercers) == 0 && len(f.typeCoercers) == 0 {
+		return filter, nil
+	}
+
+	result := make(bson.M, len(filter))
+	for key, value := range filter {
+		switch {
+		case key == "$and" || key == "$or" || key == "$nor":
+			clauses, err := f.coerceClauses(value)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = clauses
+		case strings.HasPrefix(key, "$"):
+			result[key] = value
+		default:
+			coercer := f.valueCoercer(key)
+			if coercer == nil {
+				result[key] = value
+				continue
+			}
+			condition, err := coerceCondition(key, value, coercer)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = condition
+		}
+	}
+	return result, nil
+}
+
+// coerceClauses applies coerceValues to the filter documents of a logical operator
+func (f *MongoFormatter) coerceClauses(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case []bson.M:
+		clauses := make([]bson.M, len(v))
+		for i, clause := range v {
+			coerced, err := f.coerceValues(clause)
+			if err != nil {
+				return nil, err
+			}
+			clauses[i] = coerced
+		}
+		return clauses, nil
+	case bson.A:
+		clauses := make(bson.A, len(v))
+		for i, clause := range v {
+			clauses[i] = clause
+			if doc, ok := clause.(bson.M); ok {
+				coerced, err := f.coerceValues(doc)
+				if err != nil {
+					return nil, err
+				}
+				clauses[i] = coerced
+			}
+		}
+		return clauses, nil
+	}
+	return value, nil
+}
+
+// coerceCondition coerces a plain equality value, and the operands of the comparison, $in and $nin operators
+// of an operator document, recursing into $not. Regexes, embedded documents and other operators are left alone.
+// Equality with a config.AnyOf becomes $in, and $ne becomes $nin.
+func coerceCondition(field string, condition interface{}, coercer config.ValueCoercer) (interface{}, error) {
+	doc, ok := condition.(bson.M)
+	if !ok {
+		if !isPlainEquality(condition) {
+			return condition, nil
+		}
+		value, err := coerceValue(field, condition, coercer)
+		if values, ok := value.(config.AnyOf); ok {
+			return bson.M{"$in": []interface{}(values)}, err
+		}
+		return value, err
+	}
+	if !isOperatorDocument(doc) {
+		return condition, nil
+	}
+
+	result := make(bson.M, len(doc))
+	for operator, operand := range doc {
+		var err error
+		switch operator {
+		case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+			if isPlainEquality(operand) {
+				operand, err = coerceValue(field, operand, coercer)
+			}
+			if values, ok := operand.(config.AnyOf); ok {
+				switch operator {
+				case "$eq":
+					operator, operand = "$in", []interface{}(values)
+				case "$ne":
+					operator, operand = "$nin", []interface{}(values)
+				default:
+					operand = values[0]
+				}
+			}
+		case "$in", "$nin":
+			operand, err = coerceList(field, operand, coercer)
+		case "$not":
+			operand, err = coerceCondition(field, operand, coercer)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[operator] = operand
+	}
+	return result, nil
+}
+
+// coerceList coerces the plain values of an $in or $nin list, leaving regexes in it alone
+func coerceList(field string, list interface{}, coercer config.ValueCoercer) (interface{}, error) {
+	var values []interface{}
+	switch v := list.(type) {
+	case []interface{}:
+		values = v
+	case bson.A:
+		values = v
+	default:
+		return list, nil
+	}
+
+	coerced := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		if !isPlainEquality(value) {
+			coerced = append(coerced, value)
+			continue
+		}
+		value, err := coerceValue(field, value, coercer)
+		if err != nil {
+			return nil, err
+		}
+		if anyOf, ok := value.(config.AnyOf); ok {
+			coerced = append(coerced, anyOf...)
+		} else {
+			coerced = append(coerced, value)
+		}
+	}
+	if _, ok := list.(bson.A); ok {
+		return bson.A(coerced), nil
+	}
+	return coerced, nil
+}
+
+// coerceValue passes a single value through a coercer. A config.AnyOf of a single value is returned as that value.
+func coerceValue(field string, value interface{}, coercer config.ValueCoercer) (interface{}, error) {
+	coerced, err := coercer.Coerce(field, value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot coerce %s value %v: %w", field, value, err)
+	}
+	if values, ok := coerced.(config.AnyOf); ok {
+		switch len(values) {
+		case 0:
+			return nil, fmt.Errorf("cannot coerce %s value %v: the coercer returned no values", field, value)
+		case 1:
+			return values[0], nil
+		}
+	}
+	return coerced, nil
+}
+
+// isOperatorDocument reports whether every key of a condition document is an operator
+func isOperatorDocument(doc bson.M) bool {
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return len(doc) > 0
+}
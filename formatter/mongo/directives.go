@@ -0,0 +1,186 @@
+package mongo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"github.com/kyle-williams-1/bsonic/language/mql"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Intent describes which collection operation a query is meant for.
+type Intent string
+
+const (
+	// IntentFind is the default intent: a regular find
+	IntentFind Intent = "find"
+	// IntentCount marks a COUNT query, suited to CountDocuments
+	IntentCount Intent = "count"
+	// IntentDistinct marks a DISTINCT field query, suited to Distinct
+	IntentDistinct Intent = "distinct"
+)
+
+// FindSpec holds the non-filter parts of a find specification taken from the query intent and directives.
+type FindSpec struct {
+	Collection    string
+	Intent        Intent
+	DistinctField string
+	Sort          bson.D
+	Limit         int64
+	Projection    bson.M
+	// Options are the query's @ options; an @limit option is also the Limit when there is no limit directive
+	Options QueryOptions
+}
+
+// FormatFindSpec converts the query options, routing and intent prefixes and trailing directives (sort, limit, fields)
+// of a parsed query into a FindSpec.
+func (f *MongoFormatter) FormatFindSpec(ast interface{}) (*FindSpec, error) {
+	spec := &FindSpec{Intent: IntentFind}
+
+	// MQL filters carry no directives
+	if _, ok := ast.(*mql.Query); ok {
+		return spec, nil
+	}
+
+	participleQuery, ok := ast.(*lucene.ParticipleQuery)
+	if !ok {
+		return spec, fmt.Errorf("expected *lucene.ParticipleQuery AST, got %T", ast)
+	}
+
+	options, err := f.FormatQueryOptions(participleQuery)
+	if err != nil {
+		return spec, err
+	}
+	spec.Options, spec.Limit = options, options.Limit
+
+	spec.Collection = participleQuery.Collection
+	if intent := participleQuery.Intent; intent != nil {
+		if intent.Count {
+			spec.Intent = IntentCount
+		} else if intent.Distinct != nil {
+			if err := checkFieldName(*intent.Distinct); err != nil {
+				return spec, err
+			}
+			spec.Intent = IntentDistinct
+			spec.DistinctField = f.convertFieldName(*intent.Distinct)
+		}
+	}
+
+	for _, directive := range participleQuery.Directives {
+		var err error
+		switch strings.ToLower(directive.Name) {
+		case "sort":
+			spec.Sort, err = f.parseSortDirective(directive.Value)
+		case "limit":
+			spec.Limit, err = f.parseLimitDirective(directive.Value)
+		case "fields":
+			spec.Projection, err = f.parseFieldsDirective(directive.Value)
+		default:
+			err = fmt.Errorf("unknown directive: %s", directive.Name)
+		}
+		if err != nil {
+			return spec, err
+		}
+	}
+
+	return spec, nil
+}
+
+// FormatSort converts a comma-separated sort list, in the form of a sort directive value such as
+// -created_at,name, into sort keys.
+func (f *MongoFormatter) FormatSort(sort string) (bson.D, error) {
+	return f.parseSortDirective(sort)
+}
+
+// parseSortDirective parses a comma-separated sort list where a leading "-" means descending.
+// A field may only be sorted on once.
+func (f *MongoFormatter) parseSortDirective(value string) (bson.D, error) {
+	var sort bson.D
+	seen := map[string]bool{}
+	for _, field := range splitDirectiveList(value) {
+		direction := 1
+		if strings.HasPrefix(field, "-") {
+			direction = -1
+			field = field[1:]
+		} else {
+			field = strings.TrimPrefix(field, "+")
+		}
+		field = strings.TrimSpace(field)
+
+		if field == "" {
+			return nil, fmt.Errorf("invalid sort directive: %s", value)
+		}
+		if err := checkFieldName(field); err != nil {
+			return nil, err
+		}
+		key := f.convertFieldName(field)
+		if seen[key] {
+			return nil, fmt.Errorf("invalid sort directive: %s is sorted on more than once", field)
+		}
+		seen[key] = true
+		sort = append(sort, bson.E{Key: key, Value: direction})
+	}
+	return sort, nil
+}
+
+// parseLimitDirective parses a positive integer limit
+func (f *MongoFormatter) parseLimitDirective(value string) (int64, error) {
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid limit directive: %s", value)
+	}
+	return limit, nil
+}
+
+// FormatProjection converts a comma-separated field list, in the form of a fields directive value such as
+// name,email or -password, into a projection document.
+func (f *MongoFormatter) FormatProjection(fields string) (bson.M, error) {
+	return f.parseFieldsDirective(fields)
+}
+
+// parseFieldsDirective parses a comma-separated projection list where a leading "-" excludes a field.
+// Inclusions and exclusions cannot be mixed, except for excluding _id.
+func (f *MongoFormatter) parseFieldsDirective(value string) (bson.M, error) {
+	projection := bson.M{}
+	hasInclude, hasExclude := false, false
+
+	for _, field := range splitDirectiveList(value) {
+		include := 1
+		if strings.HasPrefix(field, "-") {
+			include = 0
+			field = field[1:]
+		}
+
+		if field == "" {
+			return nil, fmt.Errorf("invalid fields directive: %s", value)
+		}
+		if err := checkFieldName(field); err != nil {
+			return nil, err
+		}
+
+		field = f.convertFieldName(field)
+		if field != "_id" {
+			hasInclude = hasInclude || include == 1
+			hasExclude = hasExclude || include == 0
+		}
+		projection[field] = include
+	}
+
+	if hasInclude && hasExclude {
+		return nil, fmt.Errorf("invalid fields directive: cannot mix included and excluded fields: %s", value)
+	}
+	return projection, nil
+}
+
+// splitDirectiveList splits a comma-separated directive value, dropping empty entries
+func splitDirectiveList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
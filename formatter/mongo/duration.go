@@ -0,0 +1,58 @@
+package mongo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// WithDurationUnit sets the unit duration literals such as 30s and 1h30m are converted to, and returns the formatter.
+// With time.Millisecond, timeout:>30s becomes {"timeout": {"$gt": 30000}}. Zero, the default, leaves them as strings.
+func (f *MongoFormatter) WithDurationUnit(unit time.Duration) *MongoFormatter {
+	f.durationUnit = unit
+	return f
+}
+
+// parseDuration converts a duration literal to a number of duration units, reporting whether s is one.
+// Literals use Go duration syntax with the units ns, us, ms, s, m and h, case-insensitively.
+func (f *MongoFormatter) parseDuration(s string) (float64, bool) {
+	if f.durationUnit <= 0 {
+		return 0, false
+	}
+
+	d, err := time.ParseDuration(strings.ToLower(s))
+	if err != nil {
+		return 0, false
+	}
+	return float64(d) / float64(f.durationUnit), true
+}
+
+// isDurationRange reports whether the bounds of a range are duration literals or wildcards, with at least one duration
+func (f *MongoFormatter) isDurationRange(startStr, endStr string) bool {
+	_, startOK := f.parseDuration(startStr)
+	_, endOK := f.parseDuration(endStr)
+	return (startOK || startStr == "*") && (endOK || endStr == "*") && (startOK || endOK)
+}
+
+// parseDurationRange parses a range of duration literals, either of which may be a wildcard
+func (f *MongoFormatter) parseDurationRange(startStr, endStr string) (interface{}, error) {
+	result := bson.M{}
+	if start, ok := f.parseDuration(startStr); ok {
+		result["$gte"] = start
+	}
+	if end, ok := f.parseDuration(endStr); ok {
+		result["$lte"] = end
+	}
+	return result, nil
+}
+
+// parseDurationComparison parses a comparison against a duration literal
+func (f *MongoFormatter) parseDurationComparison(operator, value string) (interface{}, error) {
+	d, ok := f.parseDuration(value)
+	if !ok {
+		return nil, fmt.Errorf("invalid duration: %q", value)
+	}
+	return bson.M{operator: d}, nil
+}
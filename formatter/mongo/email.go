@@ -0,0 +1,27 @@
+package mongo
+
+import (
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// emailPattern converts a partial address on a field typed FieldTypeEmail to a case-insensitive regex:
+// @example.com matches addresses at that domain and john@ addresses with that local part. Addresses with
+// both parts, or with wildcards, are not converted.
+func (f *MongoFormatter) emailPattern(field, valueStr string) (bson.M, bool) {
+	fieldType, ok := f.fieldType(field)
+	if !ok || fieldType != config.FieldTypeEmail || strings.Count(valueStr, "@") != 1 || hasWildcard(valueStr) {
+		return nil, false
+	}
+
+	local, domain, _ := strings.Cut(valueStr, "@")
+	switch {
+	case local == "" && domain != "":
+		return bson.M{"$regex": "@" + f.escapeRegex(domain) + "$", "$options": "i"}, true
+	case local != "" && domain == "":
+		return bson.M{"$regex": "^" + f.escapeRegex(local) + "@", "$options": "i"}, true
+	}
+	return nil, false
+}
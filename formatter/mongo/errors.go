@@ -0,0 +1,66 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kyle-williams-1/bsonic/formatter"
+)
+
+// ErrUnsupported is matched by errors for queries the formatter cannot express with its configuration,
+// such as IN_QUERY without a subquery resolver or free text under OR with Atlas Search
+var ErrUnsupported = errors.New("unsupported query")
+
+// errNoSearchTerms is returned for unquoted free text whose every word the tokenizer drops, such as only stop
+// words. Such text matches nothing, so it is left out of the conjunctions and alternatives that hold it, and
+// rejected anywhere else rather than compiled to an empty condition matching every document.
+var errNoSearchTerms = &unsupportedError{msg: "free text has no words to search for once tokenized, such as only stop words"}
+
+// ResolverError reports a failure returned by the subquery resolver for an IN_QUERY reference
+type ResolverError struct {
+	Collection string
+	Err        error
+}
+
+func (e *ResolverError) Error() string {
+	return fmt.Sprintf("failed to resolve IN_QUERY(%s): %v", e.Collection, e.Err)
+}
+
+func (e *ResolverError) Unwrap() error {
+	return e.Err
+}
+
+// unsupportedError keeps its own message while matching ErrUnsupported
+type unsupportedError struct {
+	msg string
+	// feature names the unsupported language feature, if the error is about one
+	feature *formatter.FeatureError
+}
+
+func (e *unsupportedError) Error() string {
+	return e.msg
+}
+
+func (e *unsupportedError) Is(target error) bool {
+	return target == ErrUnsupported
+}
+
+// Unwrap returns the *formatter.FeatureError naming the unsupported feature, if any
+func (e *unsupportedError) Unwrap() error {
+	if e.feature == nil {
+		return nil
+	}
+	return e.feature
+}
+
+// unsupportedf returns an error matching ErrUnsupported with a formatted message
+func unsupportedf(format string, args ...interface{}) error {
+	return &unsupportedError{msg: fmt.Sprintf(format, args...)}
+}
+
+// unsupportedFeaturef returns an error matching ErrUnsupported and formatter.ErrUnsupportedByFormatter, wrapping
+// a *formatter.FeatureError that names the feature
+func unsupportedFeaturef(feature formatter.Feature, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	return &unsupportedError{msg: msg, feature: &formatter.FeatureError{Feature: feature, Message: msg}}
+}
@@ -0,0 +1,61 @@
+package mongo
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// hasWildcard reports whether an unquoted value contains a * that is not escaped with a backslash
+func hasWildcard(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '*':
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeValue removes the backslashes escaping characters in an unquoted value, so \* is a literal *
+// and \AND a literal AND. A trailing lone backslash is kept.
+func unescapeValue(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// wildcardRegex converts an unquoted wildcard value into a regex body, turning unescaped * into .*
+// and quoting escaped characters. It also reports whether the value starts and ends with a wildcard.
+func wildcardRegex(s string) (pattern string, leading, trailing bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		trailing = false
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			r, size := utf8.DecodeRuneInString(s[i+1:])
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			i += size
+		case c == '\\':
+			b.WriteString(`\\`)
+		case c == '*':
+			b.WriteString(".*")
+			leading = leading || i == 0
+			trailing = true
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), leading, trailing
+}
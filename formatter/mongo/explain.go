@@ -0,0 +1,115 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"github.com/kyle-williams-1/bsonic/language/mql"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Clause kinds reported by ExplainClauses
+const (
+	// ClauseField is a field:value clause
+	ClauseField = "field"
+	// ClauseFreeText is a free text clause searched across the default fields
+	ClauseFreeText = "free_text"
+)
+
+// ExplainClause maps a single input clause to the BSON fragment it produced.
+type ExplainClause struct {
+	// Kind is ClauseField or ClauseFreeText
+	Kind string
+	// Text is the clause as written in the query
+	Text string
+	// Start and End are the byte offsets of the clause in the query
+	Start int
+	End   int
+	// Negated reports whether the clause sits under an odd number of NOT operators
+	Negated bool
+	// BSON is the fragment produced for the clause, before any negation is applied
+	BSON bson.M
+}
+
+// ExplainClauses walks a parsed query and returns every field and free text clause
+// with its source span and the BSON fragment it produced, in source order.
+func (f *MongoFormatter) ExplainClauses(ast interface{}, defaultFields []string) ([]ExplainClause, error) {
+	// MQL filters have no clause structure to explain
+	if _, ok := ast.(*mql.Query); ok {
+		return nil, nil
+	}
+
+	participleQuery, ok := ast.(*lucene.ParticipleQuery)
+	if !ok {
+		return nil, fmt.Errorf("expected *lucene.ParticipleQuery AST, got %T", ast)
+	}
+
+	if participleQuery.Expression == nil {
+		return nil, nil
+	}
+
+	var clauses []ExplainClause
+	err := f.explainExpression(participleQuery.Expression, defaultFields, false, &clauses)
+	return clauses, err
+}
+
+// explainExpression collects clauses from each side of an OR expression
+func (f *MongoFormatter) explainExpression(expr *lucene.ParticipleExpression, defaultFields []string, negated bool, clauses *[]ExplainClause) error {
+	for _, andExpr := range expr.Or {
+		for _, operand := range andExpr.And {
+			if err := f.explainOperand(operand, defaultFields, negated, clauses); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// explainOperand collects clauses from an operand, flipping negation for NOT
+func (f *MongoFormatter) explainOperand(operand *lucene.ParticipleOperand, defaultFields []string, negated bool, clauses *[]ExplainClause) error {
+	if operand.Not != nil {
+		return f.explainOperand(operand.Not, defaultFields, !negated, clauses)
+	}
+
+	term := operand.Term
+	switch {
+	case term.FieldValue != nil && term.FieldValue.Nested != nil:
+		expr, err := term.FieldValue.ExpandNested()
+		if err != nil {
+			return err
+		}
+		return f.explainExpression(expr, defaultFields, negated, clauses)
+	case term.FieldValue != nil:
+		fragment, err := f.fieldValueToBSONWithContext(term.FieldValue, defaultFields, negated)
+		if err != nil {
+			return err
+		}
+		*clauses = append(*clauses, ExplainClause{
+			Kind:    ClauseField,
+			Start:   term.FieldValue.Pos.Offset,
+			End:     term.FieldValue.EndPos.Offset,
+			Negated: negated,
+			BSON:    foldValues(fragment),
+		})
+	case term.FreeText != nil:
+		fragment, err := f.freeTextToBSON(term.FreeText, defaultFields)
+		if errors.Is(err, errNoSearchTerms) {
+			// Left out of the filter, as free text without search terms is
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		*clauses = append(*clauses, ExplainClause{
+			Kind:    ClauseFreeText,
+			Start:   term.FreeText.Pos.Offset,
+			End:     term.FreeText.EndPos.Offset,
+			Negated: negated,
+			BSON:    fragment,
+		})
+	case term.Group != nil:
+		return f.explainExpression(term.Group.Expression, defaultFields, negated, clauses)
+	}
+	return nil
+}
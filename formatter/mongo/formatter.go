@@ -2,14 +2,16 @@
 package mongo
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/kyle-williams-1/bsonic/config"
 	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"github.com/kyle-williams-1/bsonic/language/mql"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
@@ -17,6 +19,30 @@ import (
 type MongoFormatter struct {
 	replaceIDWithMongoID    bool
 	autoConvertIDToObjectID bool
+	textSearch              TextSearchOptions
+	textStrategy            config.TextSearchStrategy
+	atlasSearchIndex        string
+	multiWordMode           config.MultiWordMode
+	tokenizer               func(string) []string
+	subqueryResolver        config.SubqueryResolver
+	subqueryValidator       func(bson.M) (bson.M, error)
+	ctx                     context.Context
+	resolvedSubqueries      map[string][]interface{}
+	legacyTextCompat        bool
+	unnormalizedLogic       bool
+	fieldTypes              map[string]config.FieldType
+	boolCoercion            config.BoolCoercion
+	fieldBoolCoercion       map[string]config.BoolCoercion
+	accentInsensitive       bool
+	accentExactFields       map[string]bool
+	durationUnit            time.Duration
+	currencyConverter       config.CurrencyConverter
+	decimalSeparator        string
+	thousandsSeparator      string
+	strictNumbers           bool
+	explicitEquality        bool
+	fieldCoercers           map[string]config.ValueCoercer
+	typeCoercers            map[config.FieldType]config.ValueCoercer
 }
 
 // New creates a new MongoDB BSON formatter instance with default settings.
@@ -33,34 +59,88 @@ func NewWithOptions(replaceIDWithMongoID, autoConvertIDToObjectID bool) *MongoFo
 }
 
 // Format converts a parsed query AST into a BSON document.
-// This method handles structured queries only.
+// Structured queries map to field conditions and free text is compiled to a $text search.
 func (f *MongoFormatter) Format(ast interface{}) (bson.M, error) {
+	// MQL filters are already structured and pass straight through
+	if mqlQuery, ok := ast.(*mql.Query); ok {
+		return f.finishFilter(mqlQuery.Filter)
+	}
+
 	// Type assert to the ParticipleQuery AST type from the Lucene parser
 	participleQuery, ok := ast.(*lucene.ParticipleQuery)
 	if !ok {
 		return bson.M{}, fmt.Errorf("expected *lucene.ParticipleQuery AST, got %T", ast)
 	}
 
-	if participleQuery.Expression == nil {
-		return bson.M{}, nil
-	}
-	return f.expressionToBSON(participleQuery.Expression, nil)
+	return f.formatQuery(participleQuery, nil)
 }
 
 // Format converts a parsed query AST into a BSON document.
 // This method handles both structured queries (field:value pairs) and unstructured queries (free text).
 // For unstructured queries, the free text is searched across all provided defaultFields using regex.
 func (f *MongoFormatter) FormatWithDefaults(ast interface{}, defaultFields []string) (bson.M, error) {
+	// MQL filters are already structured and pass straight through
+	if mqlQuery, ok := ast.(*mql.Query); ok {
+		return f.finishFilter(mqlQuery.Filter)
+	}
+
 	// Type assert to the ParticipleQuery AST type from the Lucene parser
 	participleQuery, ok := ast.(*lucene.ParticipleQuery)
 	if !ok {
 		return bson.M{}, fmt.Errorf("expected *lucene.ParticipleQuery AST, got %T", ast)
 	}
 
-	if participleQuery.Expression == nil {
+	return f.formatQuery(participleQuery, defaultFields)
+}
+
+// formatQuery converts a Lucene query to BSON, applying its query options
+func (f *MongoFormatter) formatQuery(q *lucene.ParticipleQuery, defaultFields []string) (bson.M, error) {
+	options, err := f.FormatQueryOptions(q)
+	if err != nil {
+		return bson.M{}, err
+	}
+	if q.Expression == nil {
 		return bson.M{}, nil
 	}
-	return f.expressionToBSON(participleQuery.Expression, defaultFields)
+
+	filter, err := f.formatExpression(q.Expression, defaultFields)
+	if err != nil || !options.CaseSensitive {
+		return filter, err
+	}
+	return caseSensitive(filter), nil
+}
+
+// formatExpression converts a top-level expression to BSON and flattens redundant $and and $or nesting,
+// so downstream filter introspection and the MongoDB query planner see minimal structure. Free text
+// ORed together, and negated free text, is merged into a single $text search.
+func (f *MongoFormatter) formatExpression(expr *lucene.ParticipleExpression, defaultFields []string) (bson.M, error) {
+	result, err := f.expressionToBSON(expr, defaultFields)
+	if err != nil {
+		return bson.M{}, err
+	}
+	if !f.unnormalizedLogic {
+		result = normalizeLogical(result)
+	}
+	filter, err := mergeTextAlternatives(foldValues(result))
+	if err != nil {
+		return bson.M{}, err
+	}
+	if filter, err = mergeTextExclusions(filter); err != nil {
+		return bson.M{}, err
+	}
+	return f.finishFilter(filter)
+}
+
+// finishFilter applies the value coercers and the output options that rewrite a whole filter
+func (f *MongoFormatter) finishFilter(filter bson.M) (bson.M, error) {
+	filter, err := f.coerceValues(filter)
+	if err != nil {
+		return bson.M{}, err
+	}
+	if f.explicitEquality {
+		return explicitEquality(filter), nil
+	}
+	return filter, nil
 }
 
 // convertFieldName converts field name from "id" to "_id" if enabled.
@@ -83,6 +163,63 @@ func (f *MongoFormatter) convertFieldName(field string) string {
 	return field
 }
 
+// FormatFieldName checks a field name written outside a query, such as in an update, and converts it
+// the way field names in filters are, such as id to _id.
+func (f *MongoFormatter) FormatFieldName(field string) (string, error) {
+	if err := checkFieldName(field); err != nil {
+		return "", err
+	}
+	return f.convertFieldName(field), nil
+}
+
+// FormatValue converts the value of a single field:value clause written outside a query, such as in an update,
+// and returns it with the converted field name. The value is converted as filter equalities are, including casts,
+// field types, ID conversion and value coercers, but is never matched accent-insensitively.
+func (f *MongoFormatter) FormatValue(fv *lucene.ParticipleFieldValue) (string, interface{}, error) {
+	if err := checkFieldName(fv.Field); err != nil {
+		return "", nil, err
+	}
+	if fv.Value == nil || fv.Nested != nil || fv.SubQuery != nil || fv.Value.TypeCheck != nil {
+		return "", nil, fmt.Errorf("%s needs a single value", fv.Field)
+	}
+
+	var field string
+	var value interface{}
+	var err error
+	if fv.Value.Cast != nil {
+		field = f.convertFieldName(fv.Field)
+		value, err = f.parseCast(fv.Value)
+	} else {
+		field, value, err = f.plainFieldValue(fv)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	coerced, err := f.coerceValues(bson.M{field: value})
+	if err != nil {
+		return "", nil, err
+	}
+	return field, coerced[field], nil
+}
+
+// checkFieldName rejects a malformed dotted path, such as a..b or .a, a field name with a part starting
+// with "$" and a field name containing NUL. Empty parts never match a document field, MongoDB reads "$" names
+// as operators, so "$where:..." would otherwise run the value as server-side JavaScript, and BSON keys end at NUL.
+func checkFieldName(field string) error {
+	if strings.ContainsRune(field, 0) {
+		return fmt.Errorf("invalid field name %q: field names cannot contain NUL", field)
+	}
+	for _, part := range strings.Split(field, ".") {
+		if part == "" {
+			return fmt.Errorf("invalid field path %s: path segments cannot be empty", field)
+		}
+		if strings.HasPrefix(part, "$") {
+			return fmt.Errorf("invalid field name %s: field names cannot start with $", field)
+		}
+	}
+	return nil
+}
+
 // isIDField checks if the field ends with "_id" (after potential conversion).
 func (f *MongoFormatter) isIDField(field string) bool {
 	return strings.HasSuffix(field, "_id")
@@ -118,24 +255,13 @@ func (f *MongoFormatter) convertToObjectID(value interface{}) (bson.ObjectID, er
 
 // parseValue parses a value string, handling wildcards, dates, and special syntax
 func (f *MongoFormatter) parseValue(valueStr string) (interface{}, error) {
-	// Check for range syntax
-	if strings.HasPrefix(valueStr, "[") && strings.HasSuffix(valueStr, "]") && strings.Contains(strings.ToUpper(valueStr), " TO ") {
-		return f.parseRange(valueStr)
+	if value, ok, err := f.parsePattern(valueStr); ok {
+		return value, err
 	}
 
-	// Check for comparison operators
-	if strings.HasPrefix(valueStr, ">=") || strings.HasPrefix(valueStr, "<=") || strings.HasPrefix(valueStr, ">") || strings.HasPrefix(valueStr, "<") {
-		return f.parseComparison(valueStr)
-	}
-
-	// Check for regex pattern
-	if strings.HasPrefix(valueStr, "/") && strings.HasSuffix(valueStr, "/") && len(valueStr) > 2 {
-		return f.parseRegex(valueStr)
-	}
-
-	// Check for wildcard pattern
-	if strings.Contains(valueStr, "*") {
-		return f.parseWildcard(valueStr)
+	// Escaped values such as AB\*12 or \AND are literal strings, like quoted values
+	if strings.Contains(valueStr, `\`) {
+		return unescapeValue(valueStr), nil
 	}
 
 	// Check for date
@@ -144,9 +270,23 @@ func (f *MongoFormatter) parseValue(valueStr string) (interface{}, error) {
 	}
 
 	// Check for number
-	if num, err := strconv.ParseFloat(valueStr, 64); err == nil {
+	num, err := f.parseNumber(valueStr)
+	if err == nil {
 		return num, nil
 	}
+	if errors.Is(err, errAmbiguousNumber) {
+		return nil, err
+	}
+
+	// Check for duration, when a duration unit is configured
+	if d, ok := f.parseDuration(valueStr); ok {
+		return d, nil
+	}
+
+	// Check for money, when a currency converter is configured
+	if amount, ok, err := f.parseMoney(valueStr); ok {
+		return amount, err
+	}
 
 	// Check for boolean
 	if valueStr == "true" || valueStr == "false" {
@@ -156,10 +296,57 @@ func (f *MongoFormatter) parseValue(valueStr string) (interface{}, error) {
 	return valueStr, nil
 }
 
+// parseFieldValue parses the string of a field value. Quoted values are literal strings: they are
+// never wildcards, ranges, comparisons or regexes, nor detected as dates, numbers or booleans.
+func (f *MongoFormatter) parseFieldValue(value *lucene.ParticipleValue, valueStr string) (interface{}, error) {
+	if value.TypeCheck != nil {
+		return parseTypeCheck(value)
+	}
+	if value.Cast != nil {
+		return f.parseCast(value)
+	}
+	if value.IsQuoted() {
+		return valueStr, nil
+	}
+	return f.parseValue(valueStr)
+}
+
+// parsePattern parses range, comparison, regex and wildcard syntax, reporting whether valueStr used any of them
+func (f *MongoFormatter) parsePattern(valueStr string) (interface{}, bool, error) {
+	// Check for range syntax
+	if strings.HasPrefix(valueStr, "[") && strings.HasSuffix(valueStr, "]") && rangeSeparator.MatchString(valueStr) {
+		value, err := f.parseRange(valueStr)
+		return value, true, err
+	}
+
+	// Check for comparison operators
+	if strings.HasPrefix(valueStr, ">=") || strings.HasPrefix(valueStr, "<=") || strings.HasPrefix(valueStr, ">") || strings.HasPrefix(valueStr, "<") {
+		value, err := f.parseComparison(valueStr)
+		return value, true, err
+	}
+
+	// Check for regex pattern
+	if strings.HasPrefix(valueStr, "/") && strings.HasSuffix(valueStr, "/") && len(valueStr) > 2 {
+		value, err := f.parseRegex(valueStr)
+		return value, true, err
+	}
+
+	// Check for wildcard pattern; an escaped \* is a literal asterisk
+	if hasWildcard(valueStr) {
+		value, err := f.parseWildcard(valueStr)
+		return value, true, err
+	}
+
+	return nil, false, nil
+}
+
+// rangeSeparator matches the TO between range bounds, which may be split across lines
+var rangeSeparator = regexp.MustCompile(`(?i)\s+TO\s+`)
+
 // parseRange parses range queries like [start TO end] for both dates and numbers
 func (f *MongoFormatter) parseRange(valueStr string) (interface{}, error) {
 	rangeStr := strings.Trim(valueStr, "[]")
-	parts := strings.Split(strings.ToUpper(rangeStr), " TO ")
+	parts := rangeSeparator.Split(strings.ToUpper(rangeStr), -1)
 	if len(parts) != 2 {
 		return nil, errors.New("invalid range format: expected [start TO end]")
 	}
@@ -167,6 +354,14 @@ func (f *MongoFormatter) parseRange(valueStr string) (interface{}, error) {
 	startStr := strings.TrimSpace(parts[0])
 	endStr := strings.TrimSpace(parts[1])
 
+	if f.isDurationRange(startStr, endStr) {
+		return f.parseDurationRange(startStr, endStr)
+	}
+
+	if f.isMoneyRange(startStr, endStr) {
+		return f.parseMoneyRange(startStr, endStr)
+	}
+
 	if f.isDateLike(startStr) || f.isDateLike(endStr) {
 		return f.parseDateRange(startStr, endStr)
 	}
@@ -181,13 +376,43 @@ func (f *MongoFormatter) parseComparison(valueStr string) (interface{}, error) {
 		return nil, err
 	}
 
-	value = strings.TrimSpace(value)
+	operand := strings.TrimSpace(value)
+	value = unquoteOperand(operand)
+
+	if amount, ok, err := f.parseMoney(value); ok {
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{operator: amount}, nil
+	}
+
+	if _, ok := f.parseDuration(value); ok {
+		return f.parseDurationComparison(operator, value)
+	}
+
+	if num, ok := parseGroupedNumber(value); ok && f.decimalSeparator == "" {
+		return bson.M{operator: num}, nil
+	}
 
+	var result interface{}
 	if f.isDateLike(value) {
-		return f.parseDateComparison(operator, value)
+		result, err = f.parseDateComparison(operator, value)
+	} else {
+		result, err = f.parseNumberComparison(operator, value)
+	}
+	if err != nil && value != operand && !errors.Is(err, errAmbiguousNumber) {
+		// A quoted operand that is not a number or date compares as a string, so name:>"m" sorts after m
+		return bson.M{operator: value}, nil
 	}
+	return result, err
+}
 
-	return f.parseNumberComparison(operator, value)
+// unquoteOperand removes the quotes around a comparison operand, so price:>"$10.50" compares against $10.50
+func unquoteOperand(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
 }
 
 // extractOperatorAndValue extracts the operator and value from a comparison string
@@ -222,16 +447,16 @@ func (f *MongoFormatter) parseDateComparison(operator, value string) (interface{
 
 // parseNumberComparison parses a number comparison
 func (f *MongoFormatter) parseNumberComparison(operator, value string) (interface{}, error) {
-	num, err := strconv.ParseFloat(value, 64)
+	num, err := f.parseNumber(value)
 	if err != nil {
-		return nil, fmt.Errorf("invalid number: %v", err)
+		return nil, err
 	}
 	return bson.M{operator: num}, nil
 }
 
-// isDateLike checks if a string looks like a date
+// isDateLike checks if a string looks like a date; numbers such as -5 and 1e-3 do not
 func (f *MongoFormatter) isDateLike(s string) bool {
-	if s == "*" {
+	if _, ok := f.parseSeparatedNumber(s); s == "*" || ok || isNumber(s) {
 		return false
 	}
 	return strings.Contains(s, "-") || strings.Contains(s, "/") ||
@@ -241,38 +466,24 @@ func (f *MongoFormatter) isDateLike(s string) bool {
 
 // parseWildcard parses a wildcard pattern and returns a regex BSON query
 func (f *MongoFormatter) parseWildcard(valueStr string) (bson.M, error) {
-	pattern := strings.ReplaceAll(valueStr, "*", ".*")
+	pattern, leading, trailing := wildcardRegex(valueStr)
 
 	// Add proper anchoring based on wildcard position
-	if f.isContainsPattern(valueStr) {
+	switch {
+	case leading && trailing:
 		// *J* - contains pattern
-	} else if f.isEndsWithPattern(valueStr) {
+	case leading:
 		// *J - ends with pattern
 		pattern = pattern + "$"
-	} else if f.isStartsWithPattern(valueStr) {
+	case trailing:
 		// J* - starts with pattern
 		pattern = "^" + pattern
-	} else {
+	default:
 		// J*K - starts and ends with specific patterns
 		pattern = "^" + pattern + "$"
 	}
 
-	return bson.M{"$regex": pattern}, nil
-}
-
-// isContainsPattern checks if the pattern is a contains pattern (*J*)
-func (f *MongoFormatter) isContainsPattern(valueStr string) bool {
-	return strings.HasPrefix(valueStr, "*") && strings.HasSuffix(valueStr, "*")
-}
-
-// isEndsWithPattern checks if the pattern is an ends with pattern (*J)
-func (f *MongoFormatter) isEndsWithPattern(valueStr string) bool {
-	return strings.HasPrefix(valueStr, "*") && !strings.HasSuffix(valueStr, "*")
-}
-
-// isStartsWithPattern checks if the pattern is a starts with pattern (J*)
-func (f *MongoFormatter) isStartsWithPattern(valueStr string) bool {
-	return !strings.HasPrefix(valueStr, "*") && strings.HasSuffix(valueStr, "*")
+	return bson.M{"$regex": f.foldAccents(pattern)}, nil
 }
 
 // parseRegex parses a regex pattern and returns a regex BSON query
@@ -389,26 +600,26 @@ func (f *MongoFormatter) validateNumberRange(startStr, endStr string) error {
 
 // parseNumberRangeWithWildcardStart parses a number range with wildcard start
 func (f *MongoFormatter) parseNumberRangeWithWildcardStart(endStr string) (interface{}, error) {
-	endNum, err := strconv.ParseFloat(endStr, 64)
+	endNum, err := f.parseNumber(endStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid end number: %v", err)
+		return nil, fmt.Errorf("invalid end number: %w", err)
 	}
 	return bson.M{"$lte": endNum}, nil
 }
 
 // parseNumberRangeWithStart parses a number range with a start value
 func (f *MongoFormatter) parseNumberRangeWithStart(startStr, endStr string) (interface{}, error) {
-	startNum, err := strconv.ParseFloat(startStr, 64)
+	startNum, err := f.parseNumber(startStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid start number: %v", err)
+		return nil, fmt.Errorf("invalid start number: %w", err)
 	}
 
 	result := bson.M{"$gte": startNum}
 
 	if endStr != "*" {
-		endNum, err := strconv.ParseFloat(endStr, 64)
+		endNum, err := f.parseNumber(endStr)
 		if err != nil {
-			return nil, fmt.Errorf("invalid end number: %v", err)
+			return nil, fmt.Errorf("invalid end number: %w", err)
 		}
 		result["$lte"] = endNum
 	}
@@ -427,13 +638,26 @@ func (f *MongoFormatter) expressionToBSON(expr *lucene.ParticipleExpression, def
 	}
 
 	var conditions []bson.M
+	matchesAll := false
 	for _, andExpr := range expr.Or {
 		result, err := f.andExpressionToBSON(andExpr, defaultFields)
+		if errors.Is(err, errNoSearchTerms) {
+			// Free text without search terms matches nothing, so it adds nothing to an alternative
+			continue
+		}
 		if err != nil {
 			return bson.M{}, err
 		}
+		// An empty branch, such as free text searched by the Atlas Search stage, matches every document
+		matchesAll = matchesAll || len(result) == 0
 		conditions = append(conditions, result)
 	}
+	if matchesAll {
+		return bson.M{}, nil
+	}
+	if len(conditions) == 0 {
+		return bson.M{}, errNoSearchTerms
+	}
 	return bson.M{"$or": conditions}, nil
 }
 
@@ -476,11 +700,14 @@ func (f *MongoFormatter) mergeField(directFields bson.M, childBSON bson.M) {
 	}
 }
 
-// buildAndResult builds the final result from directFields and conditions
+// buildAndResult builds the final result from directFields and conditions. The direct fields come first in an
+// $and, since they are the leading clauses of the expression, so the clauses keep their source order.
 func (f *MongoFormatter) buildAndResult(directFields bson.M, conditions []bson.M) bson.M {
-	if len(directFields) > 0 && len(conditions) > 0 {
-		conditions = append(conditions, directFields)
-		return bson.M{"$and": conditions}
+	if len(directFields) > 0 && len(conditions) > 0 && f.unnormalizedLogic {
+		// Output before OutputVersion3 put the direct fields last
+		return bson.M{"$and": append(conditions, directFields)}
+	} else if len(directFields) > 0 && len(conditions) > 0 {
+		return bson.M{"$and": append([]bson.M{directFields}, conditions...)}
 	} else if len(conditions) > 0 {
 		return bson.M{"$and": conditions}
 	}
@@ -496,6 +723,9 @@ func (f *MongoFormatter) operandToBSON(operand *lucene.ParticipleOperand, defaul
 func (f *MongoFormatter) operandToBSONWithContext(operand *lucene.ParticipleOperand, defaultFields []string, inNotContext bool) (bson.M, error) {
 	if operand.Not != nil {
 		childBSON, err := f.operandToBSONWithContext(operand.Not, defaultFields, true)
+		if errors.Is(err, errNoSearchTerms) {
+			return bson.M{}, unsupportedf("negated free text has no words to search for once tokenized, such as only stop words")
+		}
 		if err != nil {
 			return bson.M{}, err
 		}
@@ -505,19 +735,31 @@ func (f *MongoFormatter) operandToBSONWithContext(operand *lucene.ParticipleOper
 	return f.termToBSONWithContext(operand.Term, defaultFields, inNotContext)
 }
 
+// nestedExpression returns the expanded clauses of a nested group such as profile:{city:SF}, or nil for other
+// terms and for nested free text, which is rejected when the filter is formatted
+func nestedExpression(term *lucene.ParticipleTerm) *lucene.ParticipleExpression {
+	if term.FieldValue == nil || term.FieldValue.Nested == nil {
+		return nil
+	}
+	expr, err := term.FieldValue.ExpandNested()
+	if err != nil {
+		return nil
+	}
+	return expr
+}
+
 // termToBSONWithContext converts terms (field values, free text, groups) to BSON with negation context
 func (f *MongoFormatter) termToBSONWithContext(term *lucene.ParticipleTerm, defaultFields []string, inNotContext bool) (bson.M, error) {
+	if err := checkModifier(term); err != nil {
+		return bson.M{}, err
+	}
+
 	if term.FieldValue != nil {
 		return f.fieldValueToBSONWithContext(term.FieldValue, defaultFields, inNotContext)
 	}
 
 	if term.FreeText != nil {
-		if defaultFields == nil {
-			// Unstructured queries require default fields - this should not happen in the regular Format method
-			// Return empty BSON since this should not occur in the regular Format method
-			return bson.M{}, nil
-		}
-		return f.freeTextToBSONUnstructured(term.FreeText, defaultFields), nil
+		return f.freeTextToBSON(term.FreeText, defaultFields)
 	}
 
 	if term.Group != nil {
@@ -529,6 +771,17 @@ func (f *MongoFormatter) termToBSONWithContext(term *lucene.ParticipleTerm, defa
 
 // fieldValueToBSONWithContext converts field:value pairs to BSON with negation context
 func (f *MongoFormatter) fieldValueToBSONWithContext(fv *lucene.ParticipleFieldValue, defaultFields []string, inNotContext bool) (bson.M, error) {
+	if err := checkFieldName(fv.Field); err != nil {
+		return bson.M{}, err
+	}
+	if fv.Nested != nil {
+		expr, err := fv.ExpandNested()
+		if err != nil {
+			return bson.M{}, err
+		}
+		return f.expressionToBSON(expr, defaultFields)
+	}
+
 	// Check if this field value should be split into field:value + free text
 	if fieldValue, freeText := fv.SplitIntoFieldAndText(); fieldValue != nil {
 		// Convert field value to BSON
@@ -537,14 +790,26 @@ func (f *MongoFormatter) fieldValueToBSONWithContext(fv *lucene.ParticipleFieldV
 			return bson.M{}, err
 		}
 
-		if defaultFields == nil {
-			// Unstructured queries require default fields - this should not happen in the regular Format method
-			// Return the field BSON only since this should not occur in the regular Format method
+		// Convert free text to BSON using the text search strategy
+		freeTextBSON, err := f.freeTextToBSON(freeText, defaultFields)
+		if err != nil && !errors.Is(err, errNoSearchTerms) {
+			return bson.M{}, err
+		}
+		if len(freeTextBSON) == 0 {
 			return fieldBSON, nil
 		}
 
-		// Convert free text to BSON using default fields
-		freeTextBSON := f.freeTextToBSONUnstructured(freeText, defaultFields)
+		if f.legacyTextCompat {
+			// Before the grammar rewrite, trailing words were a $text search ANDed with the field
+			merged := bson.M{}
+			for key, value := range fieldBSON {
+				merged[key] = value
+			}
+			for key, value := range freeTextBSON {
+				merged[key] = value
+			}
+			return merged, nil
+		}
 
 		// Return as $or with field:value and free text search (default behavior for mixed queries)
 		return bson.M{
@@ -555,25 +820,76 @@ func (f *MongoFormatter) fieldValueToBSONWithContext(fv *lucene.ParticipleFieldV
 		}, nil
 	}
 
+	if fv.SubQuery != nil {
+		return f.subQueryToBSON(fv, defaultFields)
+	}
+	if fv.Value.TypeCheck != nil {
+		condition, err := parseTypeCheck(fv.Value)
+		if err != nil {
+			return bson.M{}, err
+		}
+		return bson.M{f.convertFieldName(fv.Field): condition}, nil
+	}
+	if fv.Value.Cast != nil {
+		// Casts are never coerced, converted to ObjectIDs or matched accent-insensitively
+		value, err := f.parseCast(fv.Value)
+		if err != nil {
+			return bson.M{}, err
+		}
+		return bson.M{f.convertFieldName(fv.Field): value}, nil
+	}
+
+	field, value, err := f.plainFieldValue(fv)
+	if err != nil {
+		return bson.M{}, err
+	}
+	return bson.M{field: f.accentInsensitiveValue(field, value)}, nil
+}
+
+// plainFieldValue converts a field:value clause whose value is a term, phrase, range or other
+// single value, returning the converted field name and the value before accent folding
+func (f *MongoFormatter) plainFieldValue(fv *lucene.ParticipleFieldValue) (string, interface{}, error) {
 	// Single term or other value type - handle normally
 	valueStr := f.extractValueString(fv.Value)
 
 	// Convert field name if enabled (id -> _id)
 	convertedField := f.convertFieldName(fv.Field)
 
-	value, err := f.parseValue(valueStr)
+	// Partial addresses such as email:@example.com match by domain or local part; quoted values stay literal
+	if !fv.Value.IsQuoted() {
+		if pattern, ok := f.emailPattern(convertedField, unescapeValue(valueStr)); ok {
+			return convertedField, pattern, nil
+		}
+	}
+
+	// Range and comparison bounds on a typed field take its type
+	if !fv.Value.IsQuoted() {
+		if value, ok := f.typedPattern(convertedField, valueStr); ok {
+			return convertedField, value, nil
+		}
+	}
+
+	value, err := f.parseFieldValue(fv.Value, valueStr)
+	if errors.Is(err, errCurrencyConversion) || errors.Is(err, errAmbiguousNumber) {
+		return "", nil, err
+	}
 	if err != nil {
 		value = valueStr
 	}
+	literal := valueStr
+	if !fv.Value.IsQuoted() {
+		literal = unescapeValue(valueStr)
+	}
+	value = f.coerceToFieldType(convertedField, literal, value)
 
-	// Convert value to ObjectID if this is an _id field and conversion is enabled
-	if f.isIDField(convertedField) && f.autoConvertIDToObjectID {
+	// Convert value to ObjectID if this is an _id field and conversion is enabled; quoted values stay strings
+	if f.isIDField(convertedField) && f.autoConvertIDToObjectID && !f.isStringField(convertedField) && !fv.Value.IsQuoted() {
 		// Only convert if value is a plain string (not already parsed into a complex type)
 		if strValue, ok := value.(string); ok {
 			objectID, err := f.convertToObjectID(strValue)
 			if err != nil {
 				// This should not happen with the new implementation, but handle gracefully
-				return bson.M{}, err
+				return "", nil, err
 			}
 			// If conversion succeeded (non-NilObjectID), use the ObjectID
 			if objectID != bson.NilObjectID {
@@ -584,7 +900,7 @@ func (f *MongoFormatter) fieldValueToBSONWithContext(fv *lucene.ParticipleFieldV
 		// If value was parsed into something else, keep it as-is (allow regex, wildcards, etc.)
 	}
 
-	return bson.M{convertedField: value}, nil
+	return convertedField, value, nil
 }
 
 // extractValueString extracts the string value from a ParticipleValue
@@ -611,6 +927,10 @@ func (f *MongoFormatter) extractValueString(value *lucene.ParticipleValue) strin
 	if value.Regex != nil {
 		return *value.Regex
 	}
+	if value.Cast != nil {
+		_, text, _ := value.CastValue()
+		return text
+	}
 	return ""
 }
 
@@ -627,7 +947,7 @@ func (f *MongoFormatter) freeTextToBSONUnstructured(ft *lucene.ParticipleFreeTex
 		return f.createDefaultFieldSearch(valueStr, defaultFields)
 	} else if ft.UnquotedValue != nil {
 		// Handle unquoted values - each word searches default fields with OR
-		words := ft.UnquotedValue.TextTerms
+		words := f.freeTextWords(ft.UnquotedValue)
 		return f.createMultiWordDefaultFieldSearch(words, defaultFields)
 	} else if ft.RegexValue != nil {
 		// Handle regex values - strip the leading and trailing slashes and anchor
@@ -659,7 +979,9 @@ func (f *MongoFormatter) negateBSON(condition bson.M) bson.M {
 	for k, v := range condition {
 		// Check if the value is a query operator (bson.M)
 		// If so, use $not instead of $ne (MongoDB requirement)
-		if _, isOperator := v.(bson.M); isOperator {
+		if k == "$text" {
+			result[k] = negateTextSearch(v)
+		} else if _, isOperator := v.(bson.M); isOperator {
 			result[k] = bson.M{"$not": v}
 		} else {
 			result[k] = bson.M{"$ne": v}
@@ -676,7 +998,9 @@ func (f *MongoFormatter) negateConditions(conditions []bson.M) []bson.M {
 		for k, v := range condition {
 			// Check if the value is a query operator (bson.M)
 			// If so, use $not instead of $ne (MongoDB requirement)
-			if _, isOperator := v.(bson.M); isOperator {
+			if k == "$text" {
+				negated[k] = negateTextSearch(v)
+			} else if _, isOperator := v.(bson.M); isOperator {
 				negated[k] = bson.M{"$not": v}
 			} else {
 				negated[k] = bson.M{"$ne": v}
@@ -747,12 +1071,27 @@ func (f *MongoFormatter) createDefaultFieldSearch(valueStr string, defaultFields
 }
 
 // createMultiWordDefaultFieldSearch creates a BSON query for multiple words across default fields
-// Each word is searched against all default fields, all ORed together
+// By default each word is searched against all default fields, all ORed together; the multiword mode
+// can instead require every word or the whole phrase
 func (f *MongoFormatter) createMultiWordDefaultFieldSearch(words []string, defaultFields []string) bson.M {
 	if len(defaultFields) == 0 || len(words) == 0 {
 		return bson.M{}
 	}
 
+	switch f.multiWordMode {
+	case config.MultiWordPhrase:
+		return f.createDefaultFieldSearch(strings.Join(words, " "), defaultFields)
+	case config.MultiWordAll:
+		if len(words) == 1 {
+			return f.createDefaultFieldSearch(words[0], defaultFields)
+		}
+		var conditions []bson.M
+		for _, word := range words {
+			conditions = append(conditions, f.createDefaultFieldSearch(word, defaultFields))
+		}
+		return bson.M{"$and": conditions}
+	}
+
 	var conditions []bson.M
 	for _, word := range words {
 		for _, field := range defaultFields {
@@ -801,7 +1140,7 @@ func (f *MongoFormatter) createFieldRegexSearch(field, valueStr string) bson.M {
 
 // parseValueToRegex parses a value string and returns a regex BSON query
 func (f *MongoFormatter) parseValueToRegex(valueStr string) (bson.M, error) {
-	if strings.Contains(valueStr, "*") {
+	if hasWildcard(valueStr) {
 		return f.parseWildcard(valueStr)
 	}
 
@@ -811,7 +1150,7 @@ func (f *MongoFormatter) parseValueToRegex(valueStr string) (bson.M, error) {
 	}
 
 	// For plain text, we need to escape it and make it case-insensitive with exact match
-	escapedValue := f.escapeRegex(valueStr)
+	escapedValue := f.foldAccents(f.escapeRegex(unescapeValue(valueStr)))
 	return bson.M{"$regex": "^" + escapedValue + "$", "$options": "i"}, nil
 }
 
@@ -841,16 +1180,40 @@ func (f *MongoFormatter) processAndExpressions(expressions []*lucene.ParticipleO
 	directFields := bson.M{}
 	hasComplexExpressions := false
 
+	dropped := 0
 	for _, operand := range expressions {
 		childBSON, err := f.operandToBSON(operand, defaultFields)
+		if errors.Is(err, errNoSearchTerms) {
+			// Stop words ANDed with other clauses are dropped, as the tokenizer drops them within free text
+			dropped++
+			continue
+		}
 		if err != nil {
 			return bson.M{}, nil, err
 		}
 
+		// An empty condition matches everything, so it adds nothing to a conjunction
+		if len(childBSON) == 0 {
+			continue
+		}
+
 		if f.isSimpleFieldValue(childBSON) {
+			// Comparisons on a field with an existing range narrow it instead of adding a clause
+			if !f.unnormalizedLogic {
+				merged, err := f.mergeBoundsInto(directFields, conditions, childBSON)
+				if err != nil {
+					return bson.M{}, nil, err
+				}
+				if merged {
+					continue
+				}
+			}
+
 			if f.canMergeField(directFields, childBSON, hasComplexExpressions) {
 				f.mergeField(directFields, childBSON)
 			} else {
+				// Later fields are not merged past a separate clause, so the clauses keep their source order
+				hasComplexExpressions = !f.unnormalizedLogic
 				conditions = append(conditions, childBSON)
 			}
 		} else {
@@ -859,5 +1222,8 @@ func (f *MongoFormatter) processAndExpressions(expressions []*lucene.ParticipleO
 		}
 	}
 
+	if dropped == len(expressions) {
+		return bson.M{}, nil, errNoSearchTerms
+	}
 	return directFields, conditions, nil
 }
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/kyle-williams-1/bsonic"
+	"github.com/kyle-williams-1/bsonic/config"
+	bsonic_formatter "github.com/kyle-williams-1/bsonic/formatter"
 	"github.com/kyle-williams-1/bsonic/formatter/mongo"
 	"github.com/kyle-williams-1/bsonic/language/lucene"
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -13,7 +15,7 @@ import (
 
 // TestLuceneMongoFormatterMethods tests MongoFormatter methods
 func TestLuceneMongoFormatterMethods(t *testing.T) {
-	formatter := bsonic.NewMongoFormatter()
+	formatter := bsonic_formatter.ToLegacy(bsonic.NewMongoFormatter())
 
 	// Test Format method with invalid AST type
 	t.Run("FormatInvalidAST", func(t *testing.T) {
@@ -330,7 +332,7 @@ func TestIDFieldConversion(t *testing.T) {
 
 	t.Run("FormatWithDefaults", func(t *testing.T) {
 		// Test FormatWithDefaults method
-		formatter := bsonic.NewMongoFormatter()
+		formatter := bsonic_formatter.ToLegacy(bsonic.NewMongoFormatter())
 
 		// Use parser to create a valid AST
 		parser := &lucene.Parser{}
@@ -358,7 +360,7 @@ func TestIDFieldConversion(t *testing.T) {
 
 	t.Run("FormatWithDefaultsNilExpression", func(t *testing.T) {
 		// Test FormatWithDefaults with nil expression
-		formatter := bsonic.NewMongoFormatter()
+		formatter := bsonic_formatter.ToLegacy(bsonic.NewMongoFormatter())
 
 		ast := &lucene.ParticipleQuery{
 			Expression: nil,
@@ -377,7 +379,7 @@ func TestIDFieldConversion(t *testing.T) {
 
 	t.Run("FormatWithDefaultsInvalidAST", func(t *testing.T) {
 		// Test FormatWithDefaults with invalid AST type
-		formatter := bsonic.NewMongoFormatter()
+		formatter := mongo.New()
 
 		result, err := formatter.FormatWithDefaults("invalid", []string{"name"})
 		if err == nil {
@@ -395,3 +397,103 @@ func TestIDFieldConversion(t *testing.T) {
 		}
 	})
 }
+
+// TestTextSearch tests free text compiled to $text by Format
+func TestTextSearch(t *testing.T) {
+	parser := lucene.New()
+
+	format := func(t *testing.T, formatter *mongo.MongoFormatter, query string) bson.M {
+		t.Helper()
+		ast, err := parser.Parse(query)
+		if err != nil {
+			t.Fatalf("Failed to parse query: %v", err)
+		}
+		result, err := formatter.Format(ast)
+		if err != nil {
+			t.Fatalf("Format should not return error, got: %v", err)
+		}
+		return result
+	}
+
+	t.Run("DefaultOptions", func(t *testing.T) {
+		tests := []struct {
+			query    string
+			expected bson.M
+		}{
+			{"john", bson.M{"$text": bson.M{"$search": "john"}}},
+			{"john doe", bson.M{"$text": bson.M{"$search": "john doe"}}},
+			{`"john doe"`, bson.M{"$text": bson.M{"$search": `"john doe"`}}},
+			{`"jean"~lang:fr`, bson.M{"$text": bson.M{"$search": `"jean"`, "$language": "fr"}}},
+			{"role:admin AND john", bson.M{"$and": []bson.M{{"role": "admin"}, {"$text": bson.M{"$search": "john"}}}}},
+		}
+
+		for _, test := range tests {
+			t.Run(test.query, func(t *testing.T) {
+				result := format(t, mongo.New(), test.query)
+				if !reflect.DeepEqual(result, test.expected) {
+					t.Fatalf("Expected %+v, got %+v", test.expected, result)
+				}
+			})
+		}
+	})
+
+	t.Run("ConfiguredOptions", func(t *testing.T) {
+		formatter := mongo.New().WithTextSearchOptions(mongo.TextSearchOptions{
+			Language:           "es",
+			CaseSensitive:      true,
+			DiacriticSensitive: true,
+		})
+
+		result := format(t, formatter, "cafe")
+		expected := bson.M{"$text": bson.M{"$search": "cafe", "$language": "es", "$caseSensitive": true, "$diacriticSensitive": true}}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, result)
+		}
+
+		// Inline language overrides the configured one
+		result = format(t, formatter, `"jean"~lang:fr`)
+		if result["$text"].(bson.M)["$language"] != "fr" {
+			t.Fatalf("Expected inline language fr, got %+v", result)
+		}
+	})
+
+	t.Run("ConfigWiring", func(t *testing.T) {
+		cfg := config.Default().
+			WithTextSearchStrategy(config.StrategyTextIndex).
+			WithTextLanguage("de").
+			WithTextCaseSensitive(true)
+		formatter, err := bsonic.NewFormatterWithConfig(config.FormatterMongo, cfg)
+		if err != nil {
+			t.Fatalf("NewFormatterWithConfig should not return error, got: %v", err)
+		}
+
+		ast, _ := parser.Parse("haus")
+		result, err := bsonic_formatter.ToLegacy(formatter).Format(ast)
+		if err != nil {
+			t.Fatalf("Format should not return error, got: %v", err)
+		}
+		expected := bson.M{"$text": bson.M{"$search": "haus", "$language": "de", "$caseSensitive": true}}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, result)
+		}
+	})
+
+	t.Run("RegexFreeTextRejected", func(t *testing.T) {
+		ast, _ := parser.Parse("/jo.*/")
+		if _, err := mongo.New().Format(ast); err == nil {
+			t.Fatal("Format should return error for regex free text")
+		}
+	})
+
+	t.Run("LanguageIgnoredWithDefaultFields", func(t *testing.T) {
+		ast, _ := parser.Parse(`"jean"~lang:fr`)
+		result, err := mongo.New().FormatWithDefaults(ast, []string{"name"})
+		if err != nil {
+			t.Fatalf("FormatWithDefaults should not return error, got: %v", err)
+		}
+		expected := bson.M{"name": bson.M{"$regex": "^jean$", "$options": "i"}}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, result)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package mongo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"github.com/kyle-williams-1/bsonic/language/mql"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Highlight is a field and the term or regex a query matches it with, for highlighting results in a UI.
+type Highlight struct {
+	// Field is the document field, or "" when free text is searched across every field
+	Field string
+	// Term is the literal text matched, when the clause is not a pattern
+	Term string
+	// Regex is the pattern matched, for wildcard and regex clauses
+	Regex string
+	// CaseInsensitive reports whether Term or Regex matches without regard to case
+	CaseInsensitive bool
+}
+
+// FormatHighlights extracts the field and term or regex pairs a parsed query matches, in source order.
+// Negated clauses and non-text values (numbers, dates, booleans, ranges and comparisons) are skipped.
+func (f *MongoFormatter) FormatHighlights(ast interface{}, defaultFields []string) ([]Highlight, error) {
+	// MQL filters are not broken into clauses
+	if _, ok := ast.(*mql.Query); ok {
+		return nil, nil
+	}
+
+	participleQuery, ok := ast.(*lucene.ParticipleQuery)
+	if !ok {
+		return nil, fmt.Errorf("expected *lucene.ParticipleQuery AST, got %T", ast)
+	}
+
+	if participleQuery.Expression == nil {
+		return nil, nil
+	}
+
+	var highlights []Highlight
+	f.highlightExpression(participleQuery.Expression, defaultFields, false, &highlights)
+	return highlights, nil
+}
+
+// highlightExpression collects highlights from each side of an OR expression
+func (f *MongoFormatter) highlightExpression(expr *lucene.ParticipleExpression, defaultFields []string, negated bool, highlights *[]Highlight) {
+	for _, andExpr := range expr.Or {
+		for _, operand := range andExpr.And {
+			f.highlightOperand(operand, defaultFields, negated, highlights)
+		}
+	}
+}
+
+// highlightOperand collects highlights from an operand, skipping anything under an odd number of NOT operators
+func (f *MongoFormatter) highlightOperand(operand *lucene.ParticipleOperand, defaultFields []string, negated bool, highlights *[]Highlight) {
+	if operand.Not != nil {
+		f.highlightOperand(operand.Not, defaultFields, !negated, highlights)
+		return
+	}
+
+	term := operand.Term
+	switch {
+	case term.Group != nil:
+		// A nested NOT can flip the group's clauses back to positive
+		f.highlightExpression(term.Group.Expression, defaultFields, negated, highlights)
+	case nestedExpression(term) != nil:
+		f.highlightExpression(nestedExpression(term), defaultFields, negated, highlights)
+	case negated:
+		// Negated clauses exclude documents, so there is nothing to highlight
+	case term.FieldValue != nil:
+		fieldValue, freeText := term.FieldValue.SplitIntoFieldAndText()
+		if fieldValue == nil {
+			fieldValue = term.FieldValue
+		}
+		f.highlightFieldValue(fieldValue, highlights)
+		if freeText != nil {
+			f.highlightFreeText(freeText, defaultFields, highlights)
+		}
+	case term.FreeText != nil:
+		f.highlightFreeText(term.FreeText, defaultFields, highlights)
+	}
+}
+
+// highlightFieldValue adds a highlight for a field:value clause with a text, wildcard or regex value
+func (f *MongoFormatter) highlightFieldValue(fv *lucene.ParticipleFieldValue, highlights *[]Highlight) {
+	field := f.convertFieldName(fv.Field)
+	if f.isIDField(field) || fv.SubQuery != nil {
+		return
+	}
+
+	value, err := f.parseFieldValue(fv.Value, f.extractValueString(fv.Value))
+	if err != nil {
+		return
+	}
+
+	switch v := value.(type) {
+	case string:
+		*highlights = append(*highlights, Highlight{Field: field, Term: v})
+	case bson.M:
+		if pattern, ok := v["$regex"].(string); ok {
+			options, _ := v["$options"].(string)
+			*highlights = append(*highlights, Highlight{Field: field, Regex: pattern, CaseInsensitive: strings.Contains(options, "i")})
+		}
+	}
+}
+
+// highlightFreeText adds a highlight per default field for each free text term
+func (f *MongoFormatter) highlightFreeText(ft *lucene.ParticipleFreeText, defaultFields []string, highlights *[]Highlight) {
+	var terms []Highlight
+	switch {
+	case ft.QuotedValue != nil:
+		terms = append(terms, Highlight{Term: ft.QuotedValue.Text(), CaseInsensitive: true})
+	case ft.UnquotedValue != nil && f.multiWordMode == config.MultiWordPhrase:
+		if words := f.freeTextWords(ft.UnquotedValue); len(words) > 0 {
+			terms = append(terms, Highlight{Term: strings.Join(words, " "), CaseInsensitive: true})
+		}
+	case ft.UnquotedValue != nil:
+		for _, word := range f.freeTextWords(ft.UnquotedValue) {
+			terms = append(terms, Highlight{Term: word, CaseInsensitive: true})
+		}
+	case ft.RegexValue != nil:
+		for _, regex := range f.freeTextRegexes(ft) {
+			pattern, _ := regex["$regex"].(string)
+			terms = append(terms, Highlight{Regex: pattern})
+		}
+	}
+
+	fields := defaultFields
+	if len(fields) == 0 {
+		// $text and Atlas Search without default fields match any field
+		fields = []string{""}
+	}
+	for _, field := range fields {
+		for _, term := range terms {
+			term.Field = field
+			*highlights = append(*highlights, term)
+		}
+	}
+}
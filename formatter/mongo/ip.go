@@ -0,0 +1,115 @@
+package mongo
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// parseIP converts an IP address to binary in network byte order, with IPv4 and IPv4-mapped IPv6 addresses
+// as 4 bytes and other IPv6 addresses as 16, and a CIDR prefix to a $gte/$lte range over the addresses it
+// covers. Binary values of the same length compare byte by byte, so the range matches the prefix.
+func parseIP(s string) (interface{}, bool) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return ipBinary(addr), true
+	}
+
+	prefix, ok := parsePrefix(s)
+	if !ok {
+		return nil, false
+	}
+	return bson.M{"$gte": ipBinary(prefix.Addr()), "$lte": ipBinary(lastAddr(prefix))}, true
+}
+
+// ipBinary converts an address to generic binary data, with IPv4-mapped addresses as IPv4
+func ipBinary(addr netip.Addr) bson.Binary {
+	return bson.Binary{Subtype: bson.TypeBinaryGeneric, Data: addr.Unmap().AsSlice()}
+}
+
+// parseIPNumber converts an IPv4 address to its 32-bit integer value, and an IPv4 CIDR prefix to a $gte/$lte
+// range over the values it covers. IPv6 addresses do not fit and are not converted.
+func parseIPNumber(s string) (interface{}, bool) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		if addr = addr.Unmap(); addr.Is4() {
+			return ipv4Number(addr), true
+		}
+		return nil, false
+	}
+
+	prefix, ok := parsePrefix(s)
+	if !ok || !prefix.Addr().Is4() {
+		return nil, false
+	}
+	return bson.M{"$gte": ipv4Number(prefix.Addr()), "$lte": ipv4Number(lastAddr(prefix))}, true
+}
+
+// parseIPString converts an IPv4 CIDR prefix to an anchored regex matching the dotted addresses it covers,
+// such as ^10\.1\. for 10.1.0.0/16. The octet the prefix ends in lists its values, as in
+// ^10\.(?:0|1|2|3)\. for 10.0.0.0/14. Addresses and IPv6 prefixes are not converted.
+func parseIPString(s string) (interface{}, bool) {
+	if _, err := netip.ParseAddr(s); err == nil {
+		return nil, false
+	}
+	prefix, ok := parsePrefix(s)
+	if !ok || !prefix.Addr().Is4() {
+		return nil, false
+	}
+
+	first, last := prefix.Addr().As4(), lastAddr(prefix).As4()
+	pattern := "^"
+	for i := range first {
+		if first[i] == last[i] {
+			pattern += strconv.Itoa(int(first[i]))
+		} else if first[i] == 0 && last[i] == 0xff {
+			break
+		} else {
+			values := make([]string, 0, int(last[i]-first[i])+1)
+			for value := int(first[i]); value <= int(last[i]); value++ {
+				values = append(values, strconv.Itoa(value))
+			}
+			pattern += "(?:" + strings.Join(values, "|") + ")"
+		}
+		if i == len(first)-1 {
+			pattern += "$"
+		} else {
+			pattern += `\.`
+		}
+	}
+	return bson.M{"$regex": pattern}, true
+}
+
+// parsePrefix parses a CIDR prefix with its host bits cleared, reading IPv4-mapped prefixes as IPv4
+func parsePrefix(s string) (netip.Prefix, bool) {
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	bits := prefix.Bits()
+	if prefix.Addr().Is4In6() {
+		// ::ffff:10.0.0.0/104 covers the same addresses as 10.0.0.0/8
+		if bits < 96 {
+			return netip.Prefix{}, false
+		}
+		bits -= 96
+	}
+	masked, err := prefix.Addr().Unmap().Prefix(bits)
+	return masked, err == nil
+}
+
+// lastAddr returns the last address a prefix covers, with all of its host bits set
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	last := prefix.Addr().AsSlice()
+	for i := range last {
+		last[i] |= 0xff >> min(max(prefix.Bits()-i*8, 0), 8)
+	}
+	addr, _ := netip.AddrFromSlice(last)
+	return addr
+}
+
+// ipv4Number returns the 32-bit integer value of an IPv4 address
+func ipv4Number(addr netip.Addr) int64 {
+	return int64(binary.BigEndian.Uint32(addr.AsSlice()))
+}
@@ -0,0 +1,88 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// errCurrencyConversion is wrapped by errors from the currency converter, which fail the query
+// instead of falling back to a string match
+var errCurrencyConversion = errors.New("currency conversion failed")
+
+// moneyPattern matches an amount with a currency symbol prefix, an ISO 4217 code suffix, or both,
+// such as $10.50, €5, 1,299.99 USD and 10.50usd
+var moneyPattern = regexp.MustCompile(`^([$€£¥₹])?\s*([+-]?\d[\d,_]*(?:\.\d+)?)\s*([A-Za-z]{3})?$`)
+
+// currencySymbols maps currency symbols to their ISO 4217 codes
+var currencySymbols = map[string]string{
+	"$": "USD",
+	"€": "EUR",
+	"£": "GBP",
+	"¥": "JPY",
+	"₹": "INR",
+}
+
+// WithCurrencyConverter enables money literals such as $10.50 and 10.50USD and returns the formatter.
+// The currency is stripped and the amount passed to the converter with the currency's ISO 4217 code.
+func (f *MongoFormatter) WithCurrencyConverter(converter config.CurrencyConverter) *MongoFormatter {
+	f.currencyConverter = converter
+	return f
+}
+
+// parseMoney converts a money literal to a number with the currency converter. It reports whether s is a
+// money literal; a literal the converter rejects returns an error wrapping errCurrencyConversion.
+func (f *MongoFormatter) parseMoney(s string) (float64, bool, error) {
+	if f.currencyConverter == nil {
+		return 0, false, nil
+	}
+
+	match := moneyPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil || (match[1] == "" && match[3] == "") {
+		return 0, false, nil
+	}
+
+	amount, err := strconv.ParseFloat(strings.NewReplacer(",", "", "_", "").Replace(match[2]), 64)
+	if err != nil {
+		return 0, false, nil
+	}
+
+	currency := strings.ToUpper(match[3])
+	if currency == "" {
+		currency = currencySymbols[match[1]]
+	}
+
+	converted, err := f.currencyConverter(amount, currency)
+	if err != nil {
+		return 0, true, fmt.Errorf("%w: %s: %v", errCurrencyConversion, s, err)
+	}
+	return converted, true, nil
+}
+
+// isMoneyRange reports whether the bounds of a range are money literals or wildcards, with at least one money literal
+func (f *MongoFormatter) isMoneyRange(startStr, endStr string) bool {
+	_, startOK, _ := f.parseMoney(startStr)
+	_, endOK, _ := f.parseMoney(endStr)
+	return (startOK || startStr == "*") && (endOK || endStr == "*") && (startOK || endOK)
+}
+
+// parseMoneyRange parses a range of money literals, either of which may be a wildcard
+func (f *MongoFormatter) parseMoneyRange(startStr, endStr string) (interface{}, error) {
+	result := bson.M{}
+	for _, bound := range []struct{ operator, value string }{{"$gte", startStr}, {"$lte", endStr}} {
+		if bound.value == "*" {
+			continue
+		}
+		amount, _, err := f.parseMoney(bound.value)
+		if err != nil {
+			return nil, err
+		}
+		result[bound.operator] = amount
+	}
+	return result, nil
+}
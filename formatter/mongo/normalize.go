@@ -0,0 +1,173 @@
+package mongo
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// WithLogicalNormalization sets whether filters are given minimal logical structure, flattening nested $and and $or,
+// collapsing ORed equalities into $in, merging comparisons on one field into a range and keeping clauses in source
+// order, and returns the formatter. It is enabled by default; disabling it keeps the output of OutputVersion2.
+func (f *MongoFormatter) WithLogicalNormalization(enabled bool) *MongoFormatter {
+	f.unnormalizedLogic = !enabled
+	return f
+}
+
+// normalizeLogical returns a filter with minimal logical structure: $and clauses nested directly in $and,
+// and $or clauses nested directly in $or, are flattened into their parent, an $and or $or with
+// a single clause is replaced by that clause, and an $or of plain equalities on one field becomes $in.
+// Matching is unchanged.
+func normalizeLogical(filter bson.M) bson.M {
+	return collapseEqualities(flattenLogical(filter))
+}
+
+// flattenLogical flattens nested $and and $or clauses and unwraps single-clause $and and $or
+func flattenLogical(filter bson.M) bson.M {
+	result := make(bson.M, len(filter))
+	for key, value := range filter {
+		switch v := value.(type) {
+		case []bson.M:
+			if key == "$and" || key == "$or" {
+				result[key] = flattenClauses(key, v)
+			} else {
+				result[key] = mapClauses(v, flattenLogical)
+			}
+		case bson.M:
+			result[key] = flattenLogical(v)
+		default:
+			result[key] = value
+		}
+	}
+
+	if len(result) == 1 {
+		for _, op := range []string{"$and", "$or"} {
+			if clauses, ok := result[op].([]bson.M); ok && len(clauses) == 1 {
+				return clauses[0]
+			}
+		}
+	}
+	return result
+}
+
+// flattenClauses flattens the clauses of a logical operator, splicing in the clauses of any nested use of the same operator
+func flattenClauses(op string, clauses []bson.M) []bson.M {
+	result := make([]bson.M, 0, len(clauses))
+	for _, clause := range clauses {
+		clause = flattenLogical(clause)
+		if nested, ok := clause[op].([]bson.M); ok && len(clause) == 1 {
+			result = append(result, nested...)
+			continue
+		}
+		result = append(result, clause)
+	}
+	return result
+}
+
+// collapseEqualities replaces each $or of plain equalities on one field with $in
+func collapseEqualities(filter bson.M) bson.M {
+	result := make(bson.M, len(filter))
+	for key, value := range filter {
+		switch v := value.(type) {
+		case []bson.M:
+			result[key] = mapClauses(v, collapseEqualities)
+		case bson.M:
+			result[key] = collapseEqualities(v)
+		default:
+			result[key] = value
+		}
+	}
+
+	if clauses, ok := result["$or"].([]bson.M); ok && len(result) == 1 {
+		if in, ok := equalitiesToIn(clauses); ok {
+			return in
+		}
+	}
+	return result
+}
+
+// equalitiesToIn converts clauses that are all plain equality matches on the same field,
+// as produced by f:a OR f:b OR f:c, into a single {f: {$in: [a, b, c]}} condition
+func equalitiesToIn(clauses []bson.M) (bson.M, bool) {
+	if len(clauses) < 2 {
+		return nil, false
+	}
+
+	var field string
+	values := make([]interface{}, 0, len(clauses))
+	for i, clause := range clauses {
+		if len(clause) != 1 {
+			return nil, false
+		}
+		for key, value := range clause {
+			if strings.HasPrefix(key, "$") || (i > 0 && key != field) || !isPlainEquality(value) {
+				return nil, false
+			}
+			field = key
+			values = append(values, value)
+		}
+	}
+	return bson.M{field: bson.M{"$in": values}}, true
+}
+
+// isPlainEquality reports whether a condition value matches by equality rather than being an operator document, regex or array
+func isPlainEquality(value interface{}) bool {
+	switch value.(type) {
+	case bson.M, bson.D, bson.Regex, bson.A, []interface{}:
+		return false
+	}
+	return true
+}
+
+// mapClauses applies fn to each clause in a list
+func mapClauses(clauses []bson.M, fn func(bson.M) bson.M) []bson.M {
+	result := make([]bson.M, len(clauses))
+	for i, clause := range clauses {
+		result[i] = fn(clause)
+	}
+	return result
+}
+
+// WithExplicitEquality sets whether equality conditions are written with $eq, as in {"status": {"$eq": "active"}},
+// instead of bare values, and returns the formatter.
+func (f *MongoFormatter) WithExplicitEquality(enabled bool) *MongoFormatter {
+	f.explicitEquality = enabled
+	return f
+}
+
+// explicitEquality returns a filter with every plain equality condition wrapped in $eq, descending into
+// $and, $or and $nor clauses. Operator documents, regexes and arrays are left alone, as is every other
+// operator, so matching is unchanged.
+func explicitEquality(filter bson.M) bson.M {
+	result := make(bson.M, len(filter))
+	for key, value := range filter {
+		switch {
+		case key == "$and" || key == "$or" || key == "$nor":
+			result[key] = explicitEqualityClauses(value)
+		case strings.HasPrefix(key, "$") || !isPlainEquality(value):
+			result[key] = value
+		default:
+			result[key] = bson.M{"$eq": value}
+		}
+	}
+	return result
+}
+
+// explicitEqualityClauses applies explicitEquality to the filter documents of a logical operator
+func explicitEqualityClauses(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []bson.M:
+		return mapClauses(v, explicitEquality)
+	case bson.A:
+		clauses := make(bson.A, len(v))
+		for i, clause := range v {
+			if doc, ok := clause.(bson.M); ok {
+				clauses[i] = explicitEquality(doc)
+			} else {
+				clauses[i] = clause
+			}
+		}
+		return clauses
+	}
+	return value
+}
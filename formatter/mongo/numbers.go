@@ -0,0 +1,51 @@
+package mongo
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// numberPattern matches decimal numeric literals with an optional sign, underscores between digits
+// and an exponent, such as 42, +3.5, .5, 1_000_000 and 1e6. Inf and NaN are not numbers,
+// so values like name:nan stay strings.
+var numberPattern = regexp.MustCompile(`^[+-]?(\d+(_\d+)*(\.(\d+(_\d+)*)?)?|\.\d+(_\d+)*)([eE][+-]?\d+)?$`)
+
+// radixPattern matches hexadecimal, octal and binary integer literals with an optional sign and underscores
+// between digits, such as 0xFF, 0o755, 0b1010 and -0x1_0000, as written in low-level metadata like flags
+// and permissions.
+var radixPattern = regexp.MustCompile(`^[+-]?0([xX][0-9a-fA-F]+(_[0-9a-fA-F]+)*|[oO][0-7]+(_[0-7]+)*|[bB][01]+(_[01]+)*)$`)
+
+// groupedNumberPattern matches decimal numbers with commas grouping the digits in thousands, such as 1,000
+// and -12,500.50, as comparison operands like price:>"1,000" are written
+var groupedNumberPattern = regexp.MustCompile(`^[+-]?\d{1,3}(,\d{3})+(\.\d+)?$`)
+
+// parseGroupedNumber parses a number accepted by groupedNumberPattern
+func parseGroupedNumber(s string) (float64, bool) {
+	if !groupedNumberPattern.MatchString(s) {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	return n, err == nil
+}
+
+// parseNumber parses a numeric literal accepted by numberPattern or radixPattern
+func parseNumber(s string) (float64, error) {
+	if radixPattern.MatchString(s) {
+		n, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number: %q", s)
+		}
+		return float64(n), nil
+	}
+	if !numberPattern.MatchString(s) {
+		return 0, fmt.Errorf("invalid number: %q", s)
+	}
+	return strconv.ParseFloat(strings.ReplaceAll(s, "_", ""), 64)
+}
+
+// isNumber reports whether s is a numeric literal
+func isNumber(s string) bool {
+	return numberPattern.MatchString(s) || radixPattern.MatchString(s)
+}
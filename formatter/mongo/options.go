@@ -0,0 +1,124 @@
+package mongo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// QueryOptions are the options a query sets for itself with @ prefixes, such as
+// @include_deleted @case_sensitive name:john.
+type QueryOptions struct {
+	// IncludeDeleted is set by @include_deleted, to match soft-deleted documents too
+	IncludeDeleted bool
+	// CaseSensitive is set by @case_sensitive, to match values, wildcards and free text with their case
+	CaseSensitive bool
+	// Limit is set by @limit:N; a limit directive takes precedence over it
+	Limit int64
+}
+
+// FormatQueryOptions converts the @ options at the start of a parsed query into QueryOptions.
+// It rejects unknown options, options given a value they do not take and options given twice.
+func (f *MongoFormatter) FormatQueryOptions(ast interface{}) (QueryOptions, error) {
+	var options QueryOptions
+	participleQuery, ok := ast.(*lucene.ParticipleQuery)
+	if !ok {
+		// MQL filters carry no options
+		return options, nil
+	}
+
+	seen := map[string]bool{}
+	for _, option := range participleQuery.Options {
+		name := strings.ToLower(option.Name)
+		if seen[name] {
+			return options, fmt.Errorf("query option given more than once: @%s", option.Name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "include_deleted":
+			options.IncludeDeleted, err = true, checkFlagOption(option)
+		case "case_sensitive":
+			options.CaseSensitive, err = true, checkFlagOption(option)
+		case "limit":
+			options.Limit, err = f.parseLimitDirective(option.Value)
+			if err != nil {
+				err = fmt.Errorf("invalid query option: @limit needs a positive limit, as in @limit:20")
+			}
+		default:
+			err = fmt.Errorf("unknown query option: @%s", option.Name)
+		}
+		if err != nil {
+			return options, err
+		}
+	}
+	return options, nil
+}
+
+// checkFlagOption rejects a value on an option that is only switched on
+func checkFlagOption(option *lucene.ParticipleOption) error {
+	if option.Value != "" {
+		return fmt.Errorf("invalid query option: @%s takes no value", option.Name)
+	}
+	return nil
+}
+
+// caseSensitive returns a filter with the case-insensitive option removed from every regex condition,
+// descending into logical operators, operator documents and element matches, and with a $text search
+// made case-sensitive.
+func caseSensitive(filter bson.M) bson.M {
+	result := make(bson.M, len(filter))
+	for key, value := range filter {
+		if text, ok := value.(bson.M); ok && key == "$text" {
+			search := make(bson.M, len(text)+1)
+			for k, v := range text {
+				search[k] = v
+			}
+			search["$caseSensitive"] = true
+			result[key] = search
+			continue
+		}
+		result[key] = caseSensitiveValue(value)
+	}
+	return result
+}
+
+// caseSensitiveValue applies caseSensitive to the documents within a filter value
+func caseSensitiveValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.M:
+		doc := caseSensitive(v)
+		if options, ok := doc["$options"].(string); ok {
+			if _, isRegex := doc["$regex"]; isRegex {
+				if options = strings.ReplaceAll(options, "i", ""); options == "" {
+					delete(doc, "$options")
+				} else {
+					doc["$options"] = options
+				}
+			}
+		}
+		return doc
+	case []bson.M:
+		docs := make([]bson.M, len(v))
+		for i, doc := range v {
+			docs[i] = caseSensitive(doc)
+		}
+		return docs
+	case bson.A:
+		values := make(bson.A, len(v))
+		for i, item := range v {
+			values[i] = caseSensitiveValue(item)
+		}
+		return values
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, item := range v {
+			values[i] = caseSensitiveValue(item)
+		}
+		return values
+	}
+	return value
+}
@@ -0,0 +1,138 @@
+package mongo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"github.com/kyle-williams-1/bsonic/language/mql"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ScoreField is the field added by FormatScoreStage to hold a document's relevance score
+const ScoreField = "_score"
+
+// FormatScoreStage builds an $addFields stage that scores documents by the free text of a parsed query.
+// Each default field whose value matches a free text term adds its weight to ScoreField; fields missing
+// from weights count once. Negated free text does not contribute. It returns nil when the query has no free text.
+func (f *MongoFormatter) FormatScoreStage(ast interface{}, defaultFields []string, weights map[string]int) (bson.M, error) {
+	// MQL filters have no free text
+	if _, ok := ast.(*mql.Query); ok {
+		return nil, nil
+	}
+
+	participleQuery, ok := ast.(*lucene.ParticipleQuery)
+	if !ok {
+		return nil, fmt.Errorf("expected *lucene.ParticipleQuery AST, got %T", ast)
+	}
+
+	if participleQuery.Expression == nil || len(defaultFields) == 0 {
+		return nil, nil
+	}
+
+	var freeTexts []*lucene.ParticipleFreeText
+	collectScoredFreeText(participleQuery.Expression, false, &freeTexts)
+	if len(freeTexts) == 0 {
+		return nil, nil
+	}
+
+	var scores bson.A
+	for _, field := range defaultFields {
+		weight, ok := weights[field]
+		if !ok {
+			weight = 1
+		}
+		if weight == 0 {
+			continue
+		}
+
+		// Non-string values score nothing instead of failing $regexMatch
+		input := bson.M{"$convert": bson.M{"input": "$" + field, "to": "string", "onError": "", "onNull": ""}}
+		for _, ft := range freeTexts {
+			for _, regex := range f.freeTextRegexes(ft) {
+				match := bson.M{"input": input, "regex": regex["$regex"]}
+				if options, ok := regex["$options"]; ok {
+					match["options"] = options
+				}
+				scores = append(scores, bson.M{"$cond": bson.A{bson.M{"$regexMatch": match}, weight, 0}})
+			}
+		}
+	}
+
+	if len(scores) == 0 {
+		return nil, nil
+	}
+	return bson.M{"$addFields": bson.M{ScoreField: bson.M{"$add": scores}}}, nil
+}
+
+// freeTextRegexes returns the regex documents a free text clause matches default fields with, one per term
+func (f *MongoFormatter) freeTextRegexes(ft *lucene.ParticipleFreeText) []bson.M {
+	var regexes []bson.M
+	switch {
+	case ft.QuotedValue != nil:
+		regexes = append(regexes, f.fieldRegex(ft.QuotedValue.Text()))
+	case ft.UnquotedValue != nil && f.multiWordMode == config.MultiWordPhrase:
+		if words := f.freeTextWords(ft.UnquotedValue); len(words) > 0 {
+			regexes = append(regexes, f.fieldRegex(strings.Join(words, " ")))
+		}
+	case ft.UnquotedValue != nil:
+		for _, word := range f.freeTextWords(ft.UnquotedValue) {
+			regexes = append(regexes, f.fieldRegex(word))
+		}
+	case ft.RegexValue != nil:
+		// Anchored the same way freeTextToBSONUnstructured anchors regex free text
+		pattern := (*ft.RegexValue)[1 : len(*ft.RegexValue)-1]
+		if !strings.HasPrefix(pattern, "^") {
+			pattern = "^" + pattern
+		}
+		if !strings.HasSuffix(pattern, "$") {
+			pattern = pattern + "$"
+		}
+		regexes = append(regexes, bson.M{"$regex": pattern})
+	}
+	return regexes
+}
+
+// fieldRegex returns the regex document createFieldRegexSearch would apply to a default field
+func (f *MongoFormatter) fieldRegex(valueStr string) bson.M {
+	regex, err := f.parseValueToRegex(valueStr)
+	if err != nil {
+		return bson.M{"$regex": f.escapeRegex(valueStr), "$options": "i"}
+	}
+	return regex
+}
+
+// collectScoredFreeText gathers the non-negated free text clauses of an expression, including text split off field values
+func collectScoredFreeText(expr *lucene.ParticipleExpression, negated bool, freeTexts *[]*lucene.ParticipleFreeText) {
+	for _, andExpr := range expr.Or {
+		for _, operand := range andExpr.And {
+			collectScoredOperand(operand, negated, freeTexts)
+		}
+	}
+}
+
+// collectScoredOperand gathers the non-negated free text clauses of an operand, flipping negation for NOT
+func collectScoredOperand(operand *lucene.ParticipleOperand, negated bool, freeTexts *[]*lucene.ParticipleFreeText) {
+	if operand.Not != nil {
+		collectScoredOperand(operand.Not, !negated, freeTexts)
+		return
+	}
+
+	term := operand.Term
+	switch {
+	case term.FreeText != nil:
+		if !negated {
+			*freeTexts = append(*freeTexts, term.FreeText)
+		}
+	case term.FieldValue != nil:
+		if _, freeText := term.FieldValue.SplitIntoFieldAndText(); freeText != nil && !negated {
+			*freeTexts = append(*freeTexts, freeText)
+		}
+	case term.Group != nil:
+		collectScoredFreeText(term.Group.Expression, negated, freeTexts)
+	}
+	if nested := nestedExpression(term); nested != nil {
+		collectScoredFreeText(nested, negated, freeTexts)
+	}
+}
@@ -0,0 +1,65 @@
+package mongo
+
+import (
+	"github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/formatter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Metadata keys FormatResult sets in a formatter.Result.
+const (
+	// MetadataFindSpec holds the *FindSpec of the query's routing and intent prefixes and directives
+	MetadataFindSpec = "find_spec"
+	// MetadataHighlights holds the []Highlight of the query's free text
+	MetadataHighlights = "highlights"
+)
+
+// FormatResult converts a parsed query into its filter, with the query's FindSpec and highlights as metadata.
+// With the Atlas Search strategy, free text is also compiled into a $search pre-stage; with the regex fields
+// strategy and field weights, it is also compiled into a relevance score post-stage.
+func (f *MongoFormatter) FormatResult(ast interface{}, opts formatter.Options) (*formatter.Result[bson.M], error) {
+	filter, err := f.FormatWithDefaults(ast, opts.DefaultFields)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := f.FormatFindSpec(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	highlights, err := f.FormatHighlights(ast, opts.DefaultFields)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &formatter.Result[bson.M]{
+		Filter: filter,
+		Metadata: map[string]interface{}{
+			MetadataFindSpec:   spec,
+			MetadataHighlights: highlights,
+		},
+	}
+
+	switch f.textStrategy {
+	case config.StrategyAtlasSearch:
+		stage, err := f.FormatSearchStage(ast, opts.DefaultFields)
+		if err != nil {
+			return nil, err
+		}
+		if stage != nil {
+			result.PreStages = []bson.M{stage}
+		}
+	case config.StrategyRegexFields:
+		if len(opts.FieldWeights) > 0 {
+			stage, err := f.FormatScoreStage(ast, opts.DefaultFields, opts.FieldWeights)
+			if err != nil {
+				return nil, err
+			}
+			if stage != nil {
+				result.PostStages = []bson.M{stage}
+			}
+		}
+	}
+	return result, nil
+}
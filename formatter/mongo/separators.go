@@ -0,0 +1,90 @@
+package mongo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// errAmbiguousNumber is wrapped by errors for numbers that read differently with the number separators and in
+// standard notation, which fail the query in strict mode instead of falling back to a string match
+var errAmbiguousNumber = errors.New("ambiguous number")
+
+// WithNumberSeparators sets the decimal and thousands separators numbers are written with, such as "," and "."
+// for 1.234,56, and returns the formatter. In strict mode numbers that read differently in standard notation,
+// such as 1.234, are an error. An empty decimal separator, the default, reads numbers in standard notation only.
+func (f *MongoFormatter) WithNumberSeparators(decimal, thousands string, strict bool) *MongoFormatter {
+	f.decimalSeparator = decimal
+	f.thousandsSeparator = thousands
+	f.strictNumbers = strict
+	return f
+}
+
+// parseNumber parses a number written with the number separators, or otherwise a numeric literal in standard
+// notation. A number that reads as a different value in standard notation is read with the separators, and in
+// strict mode returns an error wrapping errAmbiguousNumber.
+func (f *MongoFormatter) parseNumber(s string) (float64, error) {
+	num, ok := f.parseSeparatedNumber(s)
+	if !ok {
+		return parseNumber(s)
+	}
+	if standard, err := parseNumber(s); err == nil && standard != num && f.strictNumbers {
+		return 0, fmt.Errorf("%w: %s reads as %s with the configured separators and as %s in standard notation; write %s or %s instead",
+			errAmbiguousNumber, s, formatNumber(num, "."), formatNumber(standard, "."),
+			formatNumber(num, f.decimalSeparator), formatNumber(standard, f.decimalSeparator))
+	}
+	return num, nil
+}
+
+// parseSeparatedNumber parses a number written with the number separators, reporting whether s is one. Digits
+// before the decimal separator are either ungrouped or grouped in threes with the thousands separator.
+func (f *MongoFormatter) parseSeparatedNumber(s string) (float64, bool) {
+	if f.decimalSeparator == "" {
+		return 0, false
+	}
+
+	sign := ""
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		sign, s = s[:1], s[1:]
+	}
+	whole, fraction, hasFraction := strings.Cut(s, f.decimalSeparator)
+	if hasFraction && !isDigits(fraction) {
+		return 0, false
+	}
+
+	groups := []string{whole}
+	if f.thousandsSeparator != "" {
+		groups = strings.Split(whole, f.thousandsSeparator)
+	}
+	for i, group := range groups {
+		if !isDigits(group) || len(groups) > 1 && (i == 0 && len(group) > 3 || i > 0 && len(group) != 3) {
+			return 0, false
+		}
+	}
+
+	text := sign + strings.Join(groups, "")
+	if hasFraction {
+		text += "." + fraction
+	}
+	num, err := strconv.ParseFloat(text, 64)
+	return num, err == nil
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// formatNumber formats a number without exponent or grouping, with decimal as its decimal separator
+func formatNumber(num float64, decimal string) string {
+	return strings.Replace(strconv.FormatFloat(num, 'f', -1, 64), ".", decimal, 1)
+}
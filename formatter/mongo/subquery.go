@@ -0,0 +1,87 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/formatter"
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// WithSubqueryResolver sets the resolver that runs IN_QUERY subqueries and returns the formatter.
+func (f *MongoFormatter) WithSubqueryResolver(resolver config.SubqueryResolver) *MongoFormatter {
+	f.subqueryResolver = resolver
+	return f
+}
+
+// WithSubqueryValidator sets the check the inner filter of an IN_QUERY subquery must pass before it is
+// resolved and returns the formatter. validate returns the filter to resolve, and its errors are returned
+// as they are rather than as a *ResolverError.
+func (f *MongoFormatter) WithSubqueryValidator(validate func(filter bson.M) (bson.M, error)) *MongoFormatter {
+	f.subqueryValidator = validate
+	return f
+}
+
+// WithContext returns a copy of the formatter for formatting the queries of one request. The copy passes
+// ctx to the subquery resolver and resolves each distinct subquery once, however often it is formatted.
+func (f *MongoFormatter) WithContext(ctx context.Context) *MongoFormatter {
+	scoped := *f
+	scoped.ctx = ctx
+	scoped.resolvedSubqueries = map[string][]interface{}{}
+	return &scoped
+}
+
+// subQueryToBSON formats the inner query of field:IN_QUERY(collection WHERE ...), resolves it
+// to a list of IDs with the subquery resolver and matches the field against them with $in
+func (f *MongoFormatter) subQueryToBSON(fv *lucene.ParticipleFieldValue, defaultFields []string) (bson.M, error) {
+	if f.subqueryResolver == nil {
+		return bson.M{}, unsupportedFeaturef(formatter.FeatureSubquery, "IN_QUERY requires a subquery resolver")
+	}
+
+	filter, err := f.formatExpression(fv.SubQuery.Expression, defaultFields)
+	if err != nil {
+		return bson.M{}, err
+	}
+	if f.subqueryValidator != nil {
+		if filter, err = f.subqueryValidator(filter); err != nil {
+			return bson.M{}, err
+		}
+	}
+
+	ids, err := f.resolveSubquery(fv.SubQuery.Collection, filter)
+	if err != nil {
+		return bson.M{}, &ResolverError{Collection: fv.SubQuery.Collection, Err: err}
+	}
+	if ids == nil {
+		// $in requires an array, and no IDs must match nothing
+		ids = []interface{}{}
+	}
+
+	return bson.M{f.convertFieldName(fv.Field): bson.M{"$in": ids}}, nil
+}
+
+// resolveSubquery runs the subquery resolver, reusing the IDs of an identical subquery resolved before
+// by a formatter scoped with WithContext
+func (f *MongoFormatter) resolveSubquery(collection string, filter bson.M) ([]interface{}, error) {
+	ctx := f.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if f.resolvedSubqueries == nil {
+		return f.subqueryResolver(ctx, collection, filter)
+	}
+
+	// fmt prints maps with sorted keys, so equal filters have equal keys
+	key := fmt.Sprintf("%s\x00%v", collection, filter)
+	if ids, ok := f.resolvedSubqueries[key]; ok {
+		return ids, nil
+	}
+	ids, err := f.subqueryResolver(ctx, collection, filter)
+	if err != nil {
+		return nil, err
+	}
+	f.resolvedSubqueries[key] = ids
+	return ids, nil
+}
@@ -0,0 +1,479 @@
+package mongo
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/formatter"
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// TextSearchOptions holds the optional $text settings used when free text is compiled to a $text search.
+type TextSearchOptions struct {
+	// Language sets $language (e.g. "fr"); empty uses the text index default
+	Language string
+	// CaseSensitive sets $caseSensitive
+	CaseSensitive bool
+	// DiacriticSensitive sets $diacriticSensitive
+	DiacriticSensitive bool
+}
+
+// WithTextSearchOptions sets the $text options and returns the formatter.
+func (f *MongoFormatter) WithTextSearchOptions(opts TextSearchOptions) *MongoFormatter {
+	f.textSearch = opts
+	return f
+}
+
+// WithTextSearchStrategy sets how free text is compiled and returns the formatter.
+// Without a strategy, Format uses $text and FormatWithDefaults uses regexes across the default fields.
+func (f *MongoFormatter) WithTextSearchStrategy(strategy config.TextSearchStrategy) *MongoFormatter {
+	f.textStrategy = strategy
+	return f
+}
+
+// WithMultiWordMode sets how unquoted multiword free text is matched and returns the formatter.
+// Without a mode, any word matches.
+func (f *MongoFormatter) WithMultiWordMode(mode config.MultiWordMode) *MongoFormatter {
+	f.multiWordMode = mode
+	return f
+}
+
+// WithTextTokenizer sets the function that splits unquoted free text into search terms and returns the formatter.
+func (f *MongoFormatter) WithTextTokenizer(tokenizer func(string) []string) *MongoFormatter {
+	f.tokenizer = tokenizer
+	return f
+}
+
+// freeTextWords returns the search terms of unquoted free text, passed through the tokenizer when one is set
+func (f *MongoFormatter) freeTextWords(uv *lucene.ParticipleUnquotedValue) []string {
+	if f.tokenizer == nil {
+		return uv.TextTerms
+	}
+
+	var words []string
+	for _, word := range f.tokenizer(strings.Join(uv.TextTerms, " ")) {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// WithLegacyTextCompat sets whether free text is compiled the way it was before the grammar rewrite and returns the formatter.
+// When enabled, all free text is a $text search regardless of the strategy, and name:John Doe matches
+// name:John AND a $text search for Doe instead of name:John OR Doe across the default fields.
+func (f *MongoFormatter) WithLegacyTextCompat(enabled bool) *MongoFormatter {
+	f.legacyTextCompat = enabled
+	return f
+}
+
+// freeTextToBSON converts a ParticipleFreeText to BSON according to the text search strategy
+func (f *MongoFormatter) freeTextToBSON(ft *lucene.ParticipleFreeText, defaultFields []string) (bson.M, error) {
+	if ft.UnquotedValue != nil && (f.legacyTextCompat || f.textStrategy != config.StrategyAtlasSearch) && len(f.freeTextWords(ft.UnquotedValue)) == 0 {
+		return bson.M{}, errNoSearchTerms
+	}
+	if f.legacyTextCompat {
+		return f.freeTextToTextSearch(ft)
+	}
+
+	switch f.textStrategy {
+	case config.StrategyTextIndex:
+		return f.freeTextToTextSearch(ft)
+	case config.StrategyRegexFields:
+		if len(defaultFields) == 0 {
+			return bson.M{}, unsupportedf("the regex fields text search strategy requires default fields")
+		}
+		return f.freeTextToBSONUnstructured(ft, defaultFields), nil
+	case config.StrategyAtlasSearch:
+		// Free text is compiled into a separate $search stage by FormatSearchStage
+		return bson.M{}, nil
+	}
+
+	// No strategy: $text without default fields, regexes with them
+	if defaultFields == nil {
+		return f.freeTextToTextSearch(ft)
+	}
+	return f.freeTextToBSONUnstructured(ft, defaultFields), nil
+}
+
+// freeTextToTextSearch converts a ParticipleFreeText to a $text search.
+// Quoted values become phrases; a ~lang:xx suffix overrides the configured language.
+func (f *MongoFormatter) freeTextToTextSearch(ft *lucene.ParticipleFreeText) (bson.M, error) {
+	language := f.textSearch.Language
+
+	var search string
+	switch {
+	case ft.QuotedValue != nil:
+		search = `"` + strings.ReplaceAll(ft.QuotedValue.Text(), `"`, `\"`) + `"`
+		if code := ft.QuotedValue.LanguageCode(); code != "" {
+			language = code
+		}
+	case ft.UnquotedValue != nil:
+		search = f.textSearchTerms(f.freeTextWords(ft.UnquotedValue))
+	default:
+		return bson.M{}, unsupportedFeaturef(formatter.FeatureRegexFreeText, "regex free text cannot be used with $text search; configure default fields instead")
+	}
+
+	return bson.M{"$text": f.textSearchDocument(search, language)}, nil
+}
+
+// textSearchTerms builds a $search string for unquoted words: $text ORs bare words and ANDs quoted phrases
+func (f *MongoFormatter) textSearchTerms(words []string) string {
+	switch f.multiWordMode {
+	case config.MultiWordPhrase:
+		return `"` + strings.Join(words, " ") + `"`
+	case config.MultiWordAll:
+		quoted := make([]string, len(words))
+		for i, word := range words {
+			quoted[i] = `"` + word + `"`
+		}
+		return strings.Join(quoted, " ")
+	}
+	return strings.Join(words, " ")
+}
+
+// textSearchDocument builds the body of a $text operator, including only non-default options
+func (f *MongoFormatter) textSearchDocument(search, language string) bson.M {
+	doc := bson.M{"$search": search}
+	if language != "" {
+		doc["$language"] = language
+	}
+	if f.textSearch.CaseSensitive {
+		doc["$caseSensitive"] = true
+	}
+	if f.textSearch.DiacriticSensitive {
+		doc["$diacriticSensitive"] = true
+	}
+	return doc
+}
+
+// negateTextSearch negates the body of a $text operator, which cannot be wrapped in $not or $ne, by excluding its
+// terms with the -word and -"phrase" syntax of the $search string. Only a search for any of its words, or for a
+// single phrase, can be negated this way; other searches keep a $not, which mergeTextExclusions rejects.
+func negateTextSearch(text interface{}) bson.M {
+	doc, ok := text.(bson.M)
+	search, _ := doc["$search"].(string)
+	terms := splitTextSearch(search)
+	negatable := ok && len(terms) > 0
+	for _, term := range terms {
+		if strings.HasPrefix(term, "-") || (len(terms) > 1 && strings.HasPrefix(term, `"`)) {
+			negatable = false
+		}
+	}
+	if !negatable {
+		return bson.M{"$not": text}
+	}
+
+	excluded := make(bson.M, len(doc))
+	for key, value := range doc {
+		excluded[key] = value
+	}
+	for i, term := range terms {
+		terms[i] = "-" + term
+	}
+	excluded["$search"] = strings.Join(terms, " ")
+	return excluded
+}
+
+// splitTextSearch splits a $search string into its words and quoted phrases, each with any - exclusion prefix
+func splitTextSearch(search string) []string {
+	var terms []string
+	for i := 0; i < len(search); {
+		if search[i] == ' ' {
+			i++
+			continue
+		}
+		start := i
+		if search[i] == '-' {
+			i++
+		}
+		if i < len(search) && search[i] == '"' {
+			for i++; i < len(search) && search[i] != '"'; i++ {
+				if search[i] == '\\' {
+					i++
+				}
+			}
+			i = min(i+1, len(search))
+		} else {
+			for i < len(search) && search[i] != ' ' {
+				i++
+			}
+		}
+		terms = append(terms, search[start:i])
+	}
+	return terms
+}
+
+// textExclusion returns the $search string of a clause that only holds a $text search excluding terms, as
+// negated free text compiles to
+func textExclusion(clause bson.M) (string, bool) {
+	text, ok := clause["$text"].(bson.M)
+	if !ok || len(clause) != 1 {
+		return "", false
+	}
+	search, ok := text["$search"].(string)
+	terms := splitTextSearch(search)
+	for _, term := range terms {
+		if !strings.HasPrefix(term, "-") {
+			return "", false
+		}
+	}
+	return search, ok && len(terms) > 0
+}
+
+// textSearchFor returns the $text body of a clause searching for terms, rather than only excluding them
+func textSearchFor(clause bson.M) (bson.M, bool) {
+	text, ok := clause["$text"].(bson.M)
+	if !ok {
+		return nil, false
+	}
+	if _, negated := text["$not"]; negated {
+		return nil, false
+	}
+	_, exclusion := textExclusion(bson.M{"$text": text})
+	return text, !exclusion
+}
+
+// sameTextOptions reports whether two $text bodies share their language and sensitivity options
+func sameTextOptions(a, b bson.M) bool {
+	for _, option := range []string{"$language", "$caseSensitive", "$diacriticSensitive"} {
+		if a[option] != b[option] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeTextExclusions merges the $text searches ANDed together into one, since MongoDB allows a single $text
+// search per query: john AND NOT foo becomes {"$text": {"$search": "john -foo"}}, and john AND jane becomes
+// {"$text": {"$search": "\"john\" \"jane\""}}, whose quoted terms must all match. Searches for any of several
+// words cannot be ANDed with others, and $text can only exclude terms from a search for others, so those
+// searches, exclusions without a search, $text under OR and negations the $search syntax cannot express are
+// rejected.
+func mergeTextExclusions(filter bson.M) (bson.M, error) {
+	filter, err := mergeExclusions(filter, false)
+	if err != nil {
+		return bson.M{}, err
+	}
+	if hasTextUnderOr(filter, false) {
+		return bson.M{}, unsupportedFeaturef(formatter.FeatureFreeTextOr,
+			"free text cannot be combined with other clauses by OR when using $text search, since MongoDB allows $text under OR only when every clause uses an index; use the regex fields or Atlas Search strategy instead")
+	}
+	return filter, nil
+}
+
+// hasTextUnderOr reports whether a filter holds a $text search within an $or or $nor clause
+func hasTextUnderOr(filter bson.M, underOr bool) bool {
+	if _, ok := filter["$text"]; ok && underOr {
+		return true
+	}
+	for _, op := range []string{"$and", "$or", "$nor"} {
+		clauses, _ := filter[op].([]bson.M)
+		for _, clause := range clauses {
+			if hasTextUnderOr(clause, underOr || op != "$and") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mergeExclusions merges the text searches and exclusions of a filter document; underOr is set within $or and $nor clauses
+func mergeExclusions(filter bson.M, underOr bool) (bson.M, error) {
+	if clauses, ok := filter["$and"].([]bson.M); ok {
+		// The document's own search comes first, then the first search among its clauses
+		owner, ownerIndex, search := filter, -1, bson.M(nil)
+		if text, ok := textSearchFor(filter); ok {
+			search = text
+		} else {
+			for i, clause := range clauses {
+				if text, ok := textSearchFor(clause); ok {
+					owner, ownerIndex, search = clause, i, text
+					break
+				}
+			}
+		}
+
+		kept := make([]bson.M, 0, len(clauses))
+		for i, clause := range clauses {
+			if exclusion, ok := textExclusion(clause); ok && search != nil && sameTextOptions(search, clause["$text"].(bson.M)) {
+				search = withTextSearch(search, search["$search"].(string)+" "+exclusion)
+				continue
+			}
+			if text, ok := textSearchFor(clause); ok && len(clause) == 1 && i != ownerIndex {
+				merged, err := andTextSearches(search, text)
+				if err != nil {
+					return bson.M{}, err
+				}
+				search = merged
+				continue
+			}
+			kept = append(kept, clause)
+		}
+		if search != nil {
+			owner["$text"] = search
+		}
+
+		if len(kept) == 1 && len(filter) == 1 {
+			return mergeExclusions(kept[0], underOr)
+		}
+		for i, clause := range kept {
+			merged, err := mergeExclusions(clause, underOr)
+			if err != nil {
+				return bson.M{}, err
+			}
+			kept[i] = merged
+		}
+		filter["$and"] = kept
+	}
+
+	for _, op := range []string{"$or", "$nor"} {
+		clauses, ok := filter[op].([]bson.M)
+		if !ok {
+			continue
+		}
+		for i, clause := range clauses {
+			merged, err := mergeExclusions(clause, true)
+			if err != nil {
+				return bson.M{}, err
+			}
+			clauses[i] = merged
+		}
+	}
+
+	text, ok := filter["$text"].(bson.M)
+	if !ok {
+		return filter, nil
+	}
+	if negated, ok := text["$not"].(bson.M); ok {
+		return bson.M{}, unsupportedf("free text %s cannot be negated when using $text search; negate single words or phrases, as in -foo or -\"foo bar\"",
+			negated["$search"])
+	}
+	exclusion, ok := textExclusion(filter)
+	switch {
+	case ok && underOr:
+		return bson.M{}, unsupportedFeaturef(formatter.FeatureNegatedFreeText,
+			"free text cannot be negated under OR or together with other clauses when using $text search; $text can only exclude words from a search for other words, as in john -foo")
+	case ok:
+		return bson.M{}, unsupportedf("free text exclusion %s needs free text to search for in the same AND when using $text search, as in john -foo; $text cannot match documents without a search term",
+			exclusion)
+	}
+	return filter, nil
+}
+
+// andTextSearches combines two $text bodies ANDed together into one whose terms must all match, quoting a
+// single bare word since $text ORs bare words and ANDs phrases. Searches for any of several bare words cannot
+// be ANDed this way and are rejected.
+func andTextSearches(a, b bson.M) (bson.M, error) {
+	if !sameTextOptions(a, b) {
+		return bson.M{}, unsupportedf("free text with different languages cannot be combined with AND when using $text search")
+	}
+	terms := make([]string, 0, 2)
+	for _, text := range []bson.M{a, b} {
+		search, _ := text["$search"].(string)
+		conjunctive, ok := conjunctiveTerms(search)
+		if !ok {
+			return bson.M{}, unsupportedf("free text %s matches any of its words and cannot be combined with other free text by AND when using $text search; quote the words, as in \"foo\" \"bar\", to require all of them", search)
+		}
+		terms = append(terms, conjunctive)
+	}
+	return withTextSearch(a, strings.Join(terms, " ")), nil
+}
+
+// conjunctiveTerms rewrites a $search string so that every term must match, quoting it when it is a single bare
+// word; it reports false when the search holds several bare words, which $text ORs
+func conjunctiveTerms(search string) (string, bool) {
+	terms := splitTextSearch(search)
+	var bare []int
+	for i, term := range terms {
+		if !strings.HasPrefix(term, "-") && !strings.HasPrefix(term, `"`) {
+			bare = append(bare, i)
+		}
+	}
+	switch len(bare) {
+	case 0:
+		return search, true
+	case 1:
+		terms[bare[0]] = `"` + terms[bare[0]] + `"`
+		return strings.Join(terms, " "), true
+	}
+	return "", false
+}
+
+// withTextSearch returns a copy of a $text body with its $search string replaced
+func withTextSearch(text bson.M, search string) bson.M {
+	merged := make(bson.M, len(text))
+	for key, value := range text {
+		merged[key] = value
+	}
+	merged["$search"] = search
+	return merged
+}
+
+// mergeTextAlternatives merges the $text searches ORed together into one, since a query holds a single $text
+// search: (john OR jane) becomes {"$text": {"$search": "john jane"}}, whose bare words $text already ORs. Quoted
+// phrases must all match a $text search, so phrases ORed with other free text are rejected rather than merged.
+func mergeTextAlternatives(filter bson.M) (bson.M, error) {
+	for _, op := range []string{"$and", "$or", "$nor"} {
+		clauses, ok := filter[op].([]bson.M)
+		if !ok {
+			continue
+		}
+		merged := make([]bson.M, len(clauses))
+		for i, clause := range clauses {
+			clause, err := mergeTextAlternatives(clause)
+			if err != nil {
+				return bson.M{}, err
+			}
+			merged[i] = clause
+		}
+		filter[op] = merged
+	}
+
+	clauses, ok := filter["$or"].([]bson.M)
+	if !ok {
+		return filter, nil
+	}
+	var searches []int
+	for i, clause := range clauses {
+		if text, ok := textSearchFor(clause); ok && len(clause) == 1 {
+			searches = append(searches, i)
+			if len(searches) > 1 && !sameTextOptions(clauses[searches[0]]["$text"].(bson.M), text) {
+				return bson.M{}, unsupportedFeaturef(formatter.FeatureFreeTextOr,
+					"free text with different languages cannot be combined with OR when using $text search")
+			}
+		}
+	}
+	if len(searches) < 2 {
+		return filter, nil
+	}
+
+	words := make([]string, 0, len(searches))
+	for _, i := range searches {
+		search := clauses[i]["$text"].(bson.M)["$search"].(string)
+		if strings.Contains(search, `"`) {
+			return bson.M{}, unsupportedFeaturef(formatter.FeatureFreeTextOr,
+				"quoted phrases cannot be combined with other free text by OR when using $text search, since every phrase of a $text search must match; use the regex fields or Atlas Search strategy to match any of several phrases")
+		}
+		words = append(words, search)
+	}
+	search := make(bson.M, len(clauses[searches[0]]["$text"].(bson.M)))
+	for key, value := range clauses[searches[0]]["$text"].(bson.M) {
+		search[key] = value
+	}
+	search["$search"] = strings.Join(words, " ")
+
+	kept := []bson.M{{"$text": search}}
+	for i, clause := range clauses {
+		if !slices.Contains(searches, i) {
+			kept = append(kept, clause)
+		}
+	}
+	if len(kept) == 1 && len(filter) == 1 {
+		return kept[0], nil
+	}
+	filter["$or"] = kept
+	return filter, nil
+}
@@ -0,0 +1,189 @@
+package mongo
+
+import (
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// WithFieldTypes sets the stored type of fields, used to coerce query values, and returns the formatter.
+func (f *MongoFormatter) WithFieldTypes(types map[string]config.FieldType) *MongoFormatter {
+	f.fieldTypes = types
+	return f
+}
+
+// WithBoolCoercion sets when true and false are converted to booleans on fields not typed FieldTypeBool,
+// with per-field overrides, and returns the formatter. An empty policy converts them everywhere.
+func (f *MongoFormatter) WithBoolCoercion(policy config.BoolCoercion, perField map[string]config.BoolCoercion) *MongoFormatter {
+	f.boolCoercion = policy
+	f.fieldBoolCoercion = perField
+	return f
+}
+
+// coerceToFieldType converts a detected scalar value to the configured type of its field.
+// Patterns, ranges and comparisons are left as detected, as are values that do not convert,
+// except that detected booleans follow the boolean coercion policy; typedPattern converts
+// the bounds of ranges and comparisons.
+func (f *MongoFormatter) coerceToFieldType(field, valueStr string, value interface{}) interface{} {
+	fieldType, ok := f.fieldType(field)
+	if !ok {
+		return f.applyBoolCoercion(field, valueStr, value)
+	}
+
+	switch value.(type) {
+	case string, float64, bool, time.Time:
+	default:
+		return value
+	}
+
+	switch fieldType {
+	case config.FieldTypeString, config.FieldTypePhone:
+		return valueStr
+	case config.FieldTypeEmail:
+		return strings.ToLower(valueStr)
+	case config.FieldTypeNumber:
+		if num, err := f.parseNumber(valueStr); err == nil {
+			return num
+		}
+	case config.FieldTypeDate:
+		if date, err := f.parseDate(valueStr); err == nil {
+			return date
+		}
+	case config.FieldTypeObjectID:
+		if objectID, _ := f.convertToObjectID(valueStr); objectID != bson.NilObjectID {
+			return objectID
+		}
+	case config.FieldTypeBool:
+		if b, err := strconv.ParseBool(valueStr); err == nil {
+			return b
+		}
+	case config.FieldTypeUUID:
+		if uuid, ok := parseUUID(valueStr); ok {
+			return uuid
+		}
+	case config.FieldTypeIP:
+		if ip, ok := parseIP(valueStr); ok {
+			return ip
+		}
+	case config.FieldTypeIPNumber:
+		if ip, ok := parseIPNumber(valueStr); ok {
+			return ip
+		}
+	case config.FieldTypeIPString:
+		if ip, ok := parseIPString(valueStr); ok {
+			return ip
+		}
+		return valueStr
+	}
+	return f.applyBoolCoercion(field, valueStr, value)
+}
+
+// typedPattern converts the bounds of a range or comparison on a field typed other than a number or date, such as
+// zip:>10000 or zip:[10000 TO 20000] on a string field, to the field's type, since detection would make them
+// numbers the stored values never compare with. It reports false for other values and fields, and when a bound
+// does not convert, leaving the value to be parsed as detected.
+func (f *MongoFormatter) typedPattern(field, valueStr string) (interface{}, bool) {
+	fieldType, ok := f.fieldType(field)
+	if !ok || fieldType == config.FieldTypeNumber || fieldType == config.FieldTypeDate {
+		return nil, false
+	}
+
+	switch {
+	case strings.HasPrefix(valueStr, "[") && strings.HasSuffix(valueStr, "]") && rangeSeparator.MatchString(valueStr):
+		bounds := rangeSeparator.Split(strings.TrimSpace(valueStr[1:len(valueStr)-1]), -1)
+		if len(bounds) != 2 {
+			return nil, false
+		}
+		result := bson.M{}
+		for i, operator := range []string{"$gte", "$lte"} {
+			bound := strings.TrimSpace(bounds[i])
+			if bound == "*" {
+				continue
+			}
+			value, ok := f.typedBound(field, fieldType, unquoteOperand(bound))
+			if !ok {
+				return nil, false
+			}
+			result[operator] = value
+		}
+		return result, len(result) > 0
+	case strings.HasPrefix(valueStr, ">") || strings.HasPrefix(valueStr, "<"):
+		operator, operand, err := f.extractOperatorAndValue(valueStr)
+		if err != nil {
+			return nil, false
+		}
+		value, ok := f.typedBound(field, fieldType, unquoteOperand(strings.TrimSpace(operand)))
+		if !ok {
+			return nil, false
+		}
+		return bson.M{operator: value}, true
+	}
+	return nil, false
+}
+
+// typedBound converts a range or comparison bound to a field's type, reporting false when a field
+// typed other than text does not convert it
+func (f *MongoFormatter) typedBound(field string, fieldType config.FieldType, bound string) (interface{}, bool) {
+	value := f.coerceToFieldType(field, bound, bound)
+	if _, isText := value.(string); isText {
+		switch fieldType {
+		case config.FieldTypeString, config.FieldTypePhone, config.FieldTypeEmail, config.FieldTypeIPString:
+			return value, true
+		}
+		return nil, false
+	}
+	return value, true
+}
+
+// fieldType returns the configured type of a field, or of its path without array indexes,
+// so items.0.price takes the type configured for items.price.
+func (f *MongoFormatter) fieldType(field string) (config.FieldType, bool) {
+	if fieldType, ok := f.fieldTypes[field]; ok {
+		return fieldType, true
+	}
+	fieldType, ok := f.fieldTypes[config.SchemaPath(field)]
+	return fieldType, ok
+}
+
+// isStringField reports whether a field is typed FieldTypeString.
+func (f *MongoFormatter) isStringField(field string) bool {
+	fieldType, ok := f.fieldType(field)
+	return ok && fieldType == config.FieldTypeString
+}
+
+// parseUUID converts canonical 8-4-4-4-12 UUID text to a BSON UUID.
+func parseUUID(s string) (bson.Binary, bool) {
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return bson.Binary{}, false
+	}
+
+	data, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil {
+		return bson.Binary{}, false
+	}
+	return bson.Binary{Subtype: bson.TypeBinaryUUID, Data: data}, true
+}
+
+// applyBoolCoercion reverts a detected boolean to its text when the field's coercion policy
+// only converts booleans on fields typed FieldTypeBool
+func (f *MongoFormatter) applyBoolCoercion(field, valueStr string, value interface{}) interface{} {
+	if _, ok := value.(bool); !ok {
+		return value
+	}
+
+	policy, ok := f.fieldBoolCoercion[field]
+	if !ok {
+		policy, ok = f.fieldBoolCoercion[config.SchemaPath(field)]
+	}
+	if !ok {
+		policy = f.boolCoercion
+	}
+	if policy == config.BoolCoercionSchema {
+		return valueStr
+	}
+	return value
+}
@@ -0,0 +1,68 @@
+// Package bsonfilter holds helpers for walking the filter documents built by the formatters, shared by the
+// parser and the index advisor.
+package bsonfilter
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Clauses returns the filter documents held by a logical operator value, such as the clauses of $and or $or.
+// Values that are not arrays, and array items that are not documents, are left out.
+func Clauses(value interface{}) []bson.M {
+	switch v := value.(type) {
+	case []bson.M:
+		return v
+	case bson.A:
+		return documents(v)
+	case []interface{}:
+		return documents(v)
+	}
+	return nil
+}
+
+// LogicalClauses returns the clauses of a $and, $or or $nor operand like Clauses, but fails for an operand that
+// is not an array or holds items that are not documents, whose fields Clauses would leave out unseen.
+func LogicalClauses(operator string, value interface{}) ([]bson.M, error) {
+	if clauses, ok := value.([]bson.M); ok {
+		return clauses, nil
+	}
+	values := Values(value)
+	if values == nil {
+		return nil, fmt.Errorf("%s must be an array of filter documents", operator)
+	}
+	for _, item := range values {
+		if _, ok := item.(bson.M); !ok {
+			return nil, fmt.Errorf("%s must be an array of filter documents, got an item of type %T", operator, item)
+		}
+	}
+	return documents(values), nil
+}
+
+// IsLogical reports whether key is one of the logical operators $and, $or and $nor.
+func IsLogical(key string) bool {
+	return key == "$and" || key == "$or" || key == "$nor"
+}
+
+// documents extracts the bson.M documents from a generic array.
+func documents(values []interface{}) []bson.M {
+	var docs []bson.M
+	for _, value := range values {
+		if doc, ok := value.(bson.M); ok {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// Values returns the items of an array operand, such as the values of $in, or nil for a value that is not an array.
+func Values(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case bson.A:
+		return v
+	case []interface{}:
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package bsonfilter
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// TestClauses tests extracting the clauses of logical operator values
+func TestClauses(t *testing.T) {
+	clauses := []bson.M{{"name": "john"}, {"age": 30}}
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected []bson.M
+	}{
+		{"Documents", clauses, clauses},
+		{"BSONArray", bson.A{clauses[0], "x", clauses[1]}, clauses},
+		{"GenericArray", []interface{}{clauses[0], 5, clauses[1]}, clauses},
+		{"NotAnArray", bson.M{"name": "john"}, nil},
+		{"Missing", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Clauses(tt.value); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestLogicalClauses tests that logical operands must be arrays of documents
+func TestLogicalClauses(t *testing.T) {
+	clauses := []bson.M{{"name": "john"}, {"age": 30}}
+	if got, err := LogicalClauses("$and", bson.A{clauses[0], clauses[1]}); err != nil || !reflect.DeepEqual(got, clauses) {
+		t.Errorf("Expected %v, got %v (%v)", clauses, got, err)
+	}
+	if got, err := LogicalClauses("$or", clauses); err != nil || !reflect.DeepEqual(got, clauses) {
+		t.Errorf("Expected %v, got %v (%v)", clauses, got, err)
+	}
+	for _, value := range []interface{}{bson.M{"name": "john"}, nil, bson.A{clauses[0], "x"}} {
+		if _, err := LogicalClauses("$nor", value); err == nil {
+			t.Errorf("Expected an error for %v", value)
+		}
+	}
+}
+
+// TestValues tests extracting the items of array operands
+func TestValues(t *testing.T) {
+	if got := Values(bson.A{"a", nil}); !reflect.DeepEqual(got, []interface{}{"a", nil}) {
+		t.Errorf("Expected the array items, got %v", got)
+	}
+	if got := Values([]interface{}{1}); !reflect.DeepEqual(got, []interface{}{1}) {
+		t.Errorf("Expected the array items, got %v", got)
+	}
+	if got := Values("a"); got != nil {
+		t.Errorf("Expected nil for a value that is not an array, got %v", got)
+	}
+}
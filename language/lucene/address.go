@@ -0,0 +1,58 @@
+package lucene
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// joinAddresses rejoins IPv6 field values, such as ip:2001:db8::1 or net:2001:db8::/32, that the lexer split
+// at their colons. The tokens directly after a field's colon are joined into a single text term when together
+// they form an IP address or CIDR prefix, so other values with colons still fail as before.
+func (d *prefixLexer) joinAddresses(tokens []lexer.Token) []lexer.Token {
+	out := make([]lexer.Token, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		if i < 2 || tokens[i-1].Type != d.symbols["Colon"] || tokens[i-2].Type != d.symbols["TextTerm"] {
+			out = append(out, tokens[i])
+			continue
+		}
+
+		end, value := i, ""
+		var b strings.Builder
+		for j := i; j < len(tokens) && d.isAddressPart(tokens[j]); j++ {
+			if j > i && tokens[j].Pos.Offset != tokens[j-1].Pos.Offset+len(tokens[j-1].Value) {
+				break
+			}
+			b.WriteString(tokens[j].Value)
+			if j > i && isAddress(b.String()) {
+				end, value = j, b.String()
+			}
+		}
+		if end == i {
+			out = append(out, tokens[i])
+			continue
+		}
+		out = append(out, lexer.Token{Type: d.symbols["TextTerm"], Value: value, Pos: tokens[i].Pos})
+		i = end
+	}
+	return out
+}
+
+// isAddressPart reports whether a token can be part of an IPv6 address, whose groups may lex as times
+func (d *prefixLexer) isAddressPart(token lexer.Token) bool {
+	switch token.Type {
+	case d.symbols["TextTerm"], d.symbols["Colon"], d.symbols["TimeString"]:
+		return true
+	}
+	return false
+}
+
+// isAddress reports whether value is an IP address or CIDR prefix
+func isAddress(value string) bool {
+	if _, err := netip.ParseAddr(value); err == nil {
+		return true
+	}
+	_, err := netip.ParsePrefix(value)
+	return err == nil
+}
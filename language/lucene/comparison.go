@@ -0,0 +1,132 @@
+package lucene
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// comparisonOperators are the operators a comparison value starts with, longest first
+var comparisonOperators = []string{">=", "<=", ">", "<"}
+
+// dateTimeOperand matches the whole of a datetime, as the DateTime token does
+var dateTimeOperand = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?$`)
+
+// joinComparisons rejoins comparison values the lexer split, so created_at:>= 2024-01-01, price:> "1,000"
+// and created_at:>2024-01-01T10:00:00Z each become a single text term holding the operator and its operand.
+// An operator followed by whitespace takes the next value as its operand, and an operand split at the colons
+// of a datetime is joined back together. Comparisons are joined directly after a field's colon and inside
+// value groups such as price:(>= 10 AND <= 20).
+func (d *prefixLexer) joinComparisons(tokens []lexer.Token) []lexer.Token {
+	out := make([]lexer.Token, 0, len(tokens))
+	// Whether each open parenthesis starts a value group, or is nested in one
+	var valueGroups []bool
+	prev := -1
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch token.Type {
+		case d.symbols["LParen"]:
+			inGroup := len(valueGroups) > 0 && valueGroups[len(valueGroups)-1]
+			valueGroups = append(valueGroups, inGroup || prev >= 0 && tokens[prev].Type == d.symbols["Colon"])
+		case d.symbols["RParen"]:
+			if len(valueGroups) > 0 {
+				valueGroups = valueGroups[:len(valueGroups)-1]
+			}
+		case d.symbols["TextTerm"]:
+			inGroup := len(valueGroups) > 0 && valueGroups[len(valueGroups)-1]
+			if prev >= 0 && d.startsValue(tokens[prev], inGroup) {
+				if joined, end, ok := d.joinComparison(tokens, i); ok {
+					out = append(out, joined)
+					i, prev = end, end
+					continue
+				}
+			}
+		}
+
+		out = append(out, token)
+		if token.Type != d.symbols["Whitespace"] {
+			prev = i
+		}
+	}
+	return out
+}
+
+// startsValue reports whether a token after the preceding one is a field value: directly after a colon,
+// or at the start of an operand inside a value group
+func (d *prefixLexer) startsValue(prev lexer.Token, inValueGroup bool) bool {
+	switch prev.Type {
+	case d.symbols["Colon"]:
+		return true
+	case d.symbols["LParen"], d.symbols["AND"], d.symbols["OR"], d.symbols["NOT"]:
+		return inValueGroup
+	}
+	return false
+}
+
+// joinComparison joins the comparison starting at tokens[i] with its operand, returning the joined token
+// and the index of the last token it replaces, or false when there is nothing to join
+func (d *prefixLexer) joinComparison(tokens []lexer.Token, i int) (lexer.Token, int, bool) {
+	operator := comparisonOperator(tokens[i].Value)
+	if operator == "" {
+		return lexer.Token{}, 0, false
+	}
+
+	value, end := tokens[i].Value, i
+	if value == operator {
+		next := i + 1
+		for next < len(tokens) && tokens[next].Type == d.symbols["Whitespace"] {
+			next++
+		}
+		if next == len(tokens) || !d.isOperand(tokens[next]) {
+			return lexer.Token{}, 0, false
+		}
+		value, end = value+tokens[next].Value, next
+	}
+
+	// A datetime after an operator lexes as a text term ending at its first colon
+	text := value
+	for j := end + 1; j < len(tokens) && d.continuesDateTime(tokens[j-1], tokens[j]); j++ {
+		text += tokens[j].Value
+		if dateTimeOperand.MatchString(text[len(operator):]) {
+			value, end = text, j
+		}
+	}
+	if end == i {
+		return lexer.Token{}, 0, false
+	}
+	return lexer.Token{Type: d.symbols["TextTerm"], Value: value, Pos: tokens[i].Pos}, end, true
+}
+
+// isOperand reports whether a token can be the operand of a comparison written with a space, as in >= 10
+func (d *prefixLexer) isOperand(token lexer.Token) bool {
+	switch token.Type {
+	case d.symbols["TextTerm"]:
+		return comparisonOperator(token.Value) == ""
+	case d.symbols["String"], d.symbols["SingleString"], d.symbols["DateTime"], d.symbols["TimeString"]:
+		return true
+	}
+	return false
+}
+
+// continuesDateTime reports whether a token directly follows the previous one and can be part of a datetime
+func (d *prefixLexer) continuesDateTime(prev, token lexer.Token) bool {
+	if token.Pos.Offset != prev.Pos.Offset+len(prev.Value) {
+		return false
+	}
+	switch token.Type {
+	case d.symbols["TextTerm"], d.symbols["Colon"], d.symbols["TimeString"]:
+		return true
+	}
+	return false
+}
+
+// comparisonOperator returns the comparison operator a value starts with, or ""
+func comparisonOperator(value string) string {
+	for _, operator := range comparisonOperators {
+		if strings.HasPrefix(value, operator) {
+			return operator
+		}
+	}
+	return ""
+}
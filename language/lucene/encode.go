@@ -0,0 +1,489 @@
+package lucene
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SchemaVersion is the version of the schema queries are encoded in by MarshalJSON and MarshalProto.
+// Decoding rejects other versions, so stored ASTs are never misread after a schema change.
+const SchemaVersion = 1
+
+// Node types of the encoded schema
+const (
+	nodeOr    = "or"
+	nodeAnd   = "and"
+	nodeNot   = "not"
+	nodeGroup = "group"
+	nodeField = "field"
+	nodeText  = "text"
+	nodeRegex = "regex"
+)
+
+// Value kinds of the encoded schema
+const (
+	valueTerms        = "terms"
+	valueString       = "string"
+	valueSingleString = "single_string"
+	valueBracketed    = "bracketed"
+	valueDateTime     = "datetime"
+	valueTime         = "time"
+	valueRegex        = "regex"
+	valueType         = "type"
+	valueCast         = "cast"
+)
+
+// typeNamePattern matches a BSON type name or number in a decoded type value, as the TypeCheck token does
+var typeNamePattern = regexp.MustCompile(`^-?[A-Za-z0-9]+$`)
+
+// modifierValuePattern matches a decoded modifier, as the Modifier token does
+var modifierValuePattern = regexp.MustCompile(`^` + modifierPattern.String())
+
+// castValuePattern matches a decoded cast value, as the Cast token does
+var castValuePattern = regexp.MustCompile(`^` + castPattern + `$`)
+
+// encodedQuery is the encoded form of a query, shared by the JSON and protobuf encodings. In JSON:
+//
+//	{"version": 1, "options": [{"name": "include_deleted"}], "intent": {...}, "expression": {...},
+//	 "directives": [{"name": "limit", "value": "10"}]}
+type encodedQuery struct {
+	Version    int                `json:"version"`
+	Options    []encodedDirective `json:"options,omitempty"`
+	Collection string             `json:"collection,omitempty"`
+	Intent     *encodedIntent     `json:"intent,omitempty"`
+	Expression *encodedNode       `json:"expression,omitempty"`
+	Directives []encodedDirective `json:"directives,omitempty"`
+}
+
+// encodedIntent is a COUNT or DISTINCT field prefix
+type encodedIntent struct {
+	Count    bool   `json:"count,omitempty"`
+	Distinct string `json:"distinct,omitempty"`
+	Where    bool   `json:"where,omitempty"`
+}
+
+// encodedDirective is a trailing directive, or a query option whose value may be empty
+type encodedDirective struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+}
+
+// encodedNode is an expression node. Its type is one of:
+//
+//	or, and:  children
+//	not:      child
+//	group:    child, a parenthesized expression
+//	field:    field and either value, subquery or child, the clauses of a nested group field:{...}
+//	text:     free text terms, or a quoted value with an optional language
+//	regex:    a /pattern/ free text regex
+//
+// Group, field, text and regex nodes may have a modifier, a boost, fuzziness or proximity suffix such as ^2 or ~1.
+type encodedNode struct {
+	Type     string           `json:"type"`
+	Children []*encodedNode   `json:"children,omitempty"`
+	Child    *encodedNode     `json:"child,omitempty"`
+	Field    string           `json:"field,omitempty"`
+	Value    *encodedValue    `json:"value,omitempty"`
+	SubQuery *encodedSubQuery `json:"subquery,omitempty"`
+	Terms    []string         `json:"terms,omitempty"`
+	Quoted   *encodedValue    `json:"quoted,omitempty"`
+	Language string           `json:"language,omitempty"`
+	Pattern  string           `json:"pattern,omitempty"`
+	Modifier string           `json:"modifier,omitempty"`
+}
+
+// encodedValue is a field value or quoted free text, with the kind of token it was written as
+type encodedValue struct {
+	Kind  string   `json:"kind"`
+	Text  string   `json:"text,omitempty"`
+	Terms []string `json:"terms,omitempty"`
+}
+
+type encodedSubQuery struct {
+	Collection string       `json:"collection"`
+	Where      *encodedNode `json:"where"`
+}
+
+// encodeQuery converts a query into its encoded form
+func encodeQuery(q *ParticipleQuery) *encodedQuery {
+	out := &encodedQuery{Version: SchemaVersion, Collection: q.Collection}
+	for _, o := range q.Options {
+		out.Options = append(out.Options, encodedDirective{Name: o.Name, Value: o.Value})
+	}
+	if q.Intent != nil {
+		out.Intent = &encodedIntent{Count: q.Intent.Count, Where: q.Intent.Where}
+		if q.Intent.Distinct != nil {
+			out.Intent.Distinct = *q.Intent.Distinct
+		}
+	}
+	if q.Expression != nil {
+		out.Expression = encodeExpression(q.Expression)
+	}
+	for _, d := range q.Directives {
+		out.Directives = append(out.Directives, encodedDirective{Name: d.Name, Value: d.Value})
+	}
+	return out
+}
+
+// encodeExpression encodes an expression, leaving out OR and AND nodes with a single child
+func encodeExpression(expr *ParticipleExpression) *encodedNode {
+	if len(expr.Or) == 1 {
+		return encodeAnd(expr.Or[0])
+	}
+	node := &encodedNode{Type: nodeOr}
+	for _, andExpr := range expr.Or {
+		node.Children = append(node.Children, encodeAnd(andExpr))
+	}
+	return node
+}
+
+func encodeAnd(andExpr *ParticipleAndExpression) *encodedNode {
+	if len(andExpr.And) == 1 {
+		return encodeOperand(andExpr.And[0])
+	}
+	node := &encodedNode{Type: nodeAnd}
+	for _, operand := range andExpr.And {
+		node.Children = append(node.Children, encodeOperand(operand))
+	}
+	return node
+}
+
+func encodeOperand(operand *ParticipleOperand) *encodedNode {
+	if operand.Not != nil {
+		return &encodedNode{Type: nodeNot, Child: encodeOperand(operand.Not)}
+	}
+
+	node := encodeTerm(operand.Term)
+	if operand.Term.Modifier != nil {
+		node.Modifier = *operand.Term.Modifier
+	}
+	return node
+}
+
+func encodeTerm(term *ParticipleTerm) *encodedNode {
+	switch {
+	case term.Group != nil:
+		return &encodedNode{Type: nodeGroup, Child: encodeExpression(term.Group.Expression)}
+	case term.FieldValue != nil:
+		fv := term.FieldValue
+		node := &encodedNode{Type: nodeField, Field: fv.Field}
+		switch {
+		case fv.Nested != nil:
+			node.Child = encodeExpression(fv.Nested.Expression)
+		case fv.SubQuery != nil:
+			node.SubQuery = &encodedSubQuery{Collection: fv.SubQuery.Collection, Where: encodeExpression(fv.SubQuery.Expression)}
+		default:
+			node.Value = encodeValue(fv.Value)
+		}
+		return node
+	}
+
+	ft := term.FreeText
+	switch {
+	case ft.RegexValue != nil:
+		return &encodedNode{Type: nodeRegex, Pattern: *ft.RegexValue}
+	case ft.QuotedValue != nil:
+		qv := ft.QuotedValue
+		node := &encodedNode{Type: nodeText, Language: qv.LanguageCode()}
+		if qv.SingleString != nil {
+			node.Quoted = &encodedValue{Kind: valueSingleString, Text: *qv.SingleString}
+		} else {
+			node.Quoted = &encodedValue{Kind: valueString, Text: qv.Text()}
+		}
+		return node
+	}
+	return &encodedNode{Type: nodeText, Terms: ft.UnquotedValue.TextTerms}
+}
+
+func encodeValue(v *ParticipleValue) *encodedValue {
+	switch {
+	case v.String != nil:
+		return &encodedValue{Kind: valueString, Text: *v.String}
+	case v.SingleString != nil:
+		return &encodedValue{Kind: valueSingleString, Text: *v.SingleString}
+	case v.Bracketed != nil:
+		return &encodedValue{Kind: valueBracketed, Text: *v.Bracketed}
+	case v.DateTime != nil:
+		return &encodedValue{Kind: valueDateTime, Text: *v.DateTime}
+	case v.TimeString != nil:
+		return &encodedValue{Kind: valueTime, Text: *v.TimeString}
+	case v.Regex != nil:
+		return &encodedValue{Kind: valueRegex, Text: *v.Regex}
+	case v.TypeCheck != nil:
+		return &encodedValue{Kind: valueType, Terms: v.TypeNames()}
+	case v.Cast != nil:
+		return &encodedValue{Kind: valueCast, Text: *v.Cast}
+	}
+	return &encodedValue{Kind: valueTerms, Terms: v.TextTerms}
+}
+
+// decodeQuery converts an encoded query back into a query. It rejects unknown versions, node types
+// and value kinds, and expressions nesting deeper than MaxNestingDepth.
+func decodeQuery(in *encodedQuery) (*ParticipleQuery, error) {
+	if in.Version != SchemaVersion {
+		return nil, fmt.Errorf("unsupported encoded query version: %d", in.Version)
+	}
+
+	decoded := &ParticipleQuery{Collection: in.Collection}
+	for _, o := range in.Options {
+		if !optionNamePattern.MatchString("@" + o.Name) {
+			return nil, fmt.Errorf("invalid encoded query: invalid option name: %q", o.Name)
+		}
+		decoded.Options = append(decoded.Options, &ParticipleOption{Name: o.Name, Value: o.Value})
+	}
+	if in.Intent != nil {
+		decoded.Intent = &ParticipleIntent{Count: in.Intent.Count, Where: in.Intent.Where}
+		if in.Intent.Distinct != "" {
+			distinct := in.Intent.Distinct
+			decoded.Intent.Distinct = &distinct
+		}
+		if decoded.Intent.Count == (decoded.Intent.Distinct != nil) {
+			return nil, fmt.Errorf("invalid encoded query: intent must be either count or distinct")
+		}
+	}
+	if in.Expression != nil {
+		expr, err := decodeExpression(in.Expression, 0)
+		if err != nil {
+			return nil, err
+		}
+		decoded.Expression = expr
+	}
+	for _, d := range in.Directives {
+		if d.Name == "" || d.Value == "" {
+			return nil, fmt.Errorf("invalid encoded query: directives need a name and a value")
+		}
+		decoded.Directives = append(decoded.Directives, &ParticipleDirective{Name: d.Name, Value: d.Value})
+	}
+	if decoded.Collection != "" && decoded.Intent == nil && decoded.Expression == nil {
+		return nil, fmt.Errorf("invalid encoded query: a collection needs an intent or expression after it")
+	}
+	return decoded, nil
+}
+
+// decodeExpression decodes a node into an expression, wrapping nodes other than OR in a single branch
+func decodeExpression(node *encodedNode, depth int) (*ParticipleExpression, error) {
+	if node.Type != nodeOr {
+		andExpr, err := decodeAnd(node, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &ParticipleExpression{Or: []*ParticipleAndExpression{andExpr}}, nil
+	}
+
+	if len(node.Children) < 2 {
+		return nil, fmt.Errorf("invalid encoded query: %s node needs at least two children", node.Type)
+	}
+	expr := &ParticipleExpression{}
+	for _, child := range node.Children {
+		andExpr, err := decodeAnd(child, depth)
+		if err != nil {
+			return nil, err
+		}
+		expr.Or = append(expr.Or, andExpr)
+	}
+	return expr, nil
+}
+
+func decodeAnd(node *encodedNode, depth int) (*ParticipleAndExpression, error) {
+	if node == nil {
+		return nil, fmt.Errorf("invalid encoded query: missing node")
+	}
+	if node.Type != nodeAnd {
+		operand, err := decodeOperand(node, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &ParticipleAndExpression{And: []*ParticipleOperand{operand}}, nil
+	}
+
+	if len(node.Children) < 2 {
+		return nil, fmt.Errorf("invalid encoded query: %s node needs at least two children", node.Type)
+	}
+	andExpr := &ParticipleAndExpression{}
+	for _, child := range node.Children {
+		operand, err := decodeOperand(child, depth)
+		if err != nil {
+			return nil, err
+		}
+		andExpr.And = append(andExpr.And, operand)
+	}
+	return andExpr, nil
+}
+
+func decodeOperand(node *encodedNode, depth int) (*ParticipleOperand, error) {
+	if node == nil {
+		return nil, fmt.Errorf("invalid encoded query: missing node")
+	}
+
+	operand, err := decodeTerm(node, depth)
+	if err != nil || node.Modifier == "" {
+		return operand, err
+	}
+	if operand.Term == nil {
+		return nil, fmt.Errorf("invalid encoded query: %s node cannot have a modifier", node.Type)
+	}
+	if !modifierValuePattern.MatchString(node.Modifier) {
+		return nil, fmt.Errorf("invalid encoded query: invalid modifier %q", node.Modifier)
+	}
+	modifier := node.Modifier
+	operand.Term.Modifier = &modifier
+	return operand, nil
+}
+
+func decodeTerm(node *encodedNode, depth int) (*ParticipleOperand, error) {
+	switch node.Type {
+	case nodeNot, nodeGroup:
+		if depth+1 > MaxNestingDepth {
+			return nil, ErrNestingDepth
+		}
+		if node.Child == nil {
+			return nil, fmt.Errorf("invalid encoded query: %s node needs a child", node.Type)
+		}
+		if node.Type == nodeNot {
+			operand, err := decodeOperand(node.Child, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			return &ParticipleOperand{Not: operand}, nil
+		}
+		expr, err := decodeExpression(node.Child, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return &ParticipleOperand{Term: &ParticipleTerm{Group: &ParticipleGroup{Expression: expr}}}, nil
+	case nodeField:
+		fv, err := decodeFieldValue(node, depth)
+		if err != nil {
+			return nil, err
+		}
+		return &ParticipleOperand{Term: &ParticipleTerm{FieldValue: fv}}, nil
+	case nodeText, nodeRegex:
+		ft, err := decodeFreeText(node)
+		if err != nil {
+			return nil, err
+		}
+		return &ParticipleOperand{Term: &ParticipleTerm{FreeText: ft}}, nil
+	case nodeOr, nodeAnd:
+		// Nested OR and AND nodes must be grouped to keep the precedence they were parsed with
+		return nil, fmt.Errorf("invalid encoded query: %s node must be inside a group", node.Type)
+	}
+	return nil, fmt.Errorf("invalid encoded query: unknown node type %q", node.Type)
+}
+
+func decodeFieldValue(node *encodedNode, depth int) (*ParticipleFieldValue, error) {
+	if node.Field == "" {
+		return nil, fmt.Errorf("invalid encoded query: field node needs a field")
+	}
+	fv := &ParticipleFieldValue{Field: node.Field}
+
+	if node.SubQuery != nil {
+		if depth+1 > MaxNestingDepth {
+			return nil, ErrNestingDepth
+		}
+		if node.SubQuery.Collection == "" || node.SubQuery.Where == nil {
+			return nil, fmt.Errorf("invalid encoded query: subquery needs a collection and a where expression")
+		}
+		expr, err := decodeExpression(node.SubQuery.Where, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		fv.SubQuery = &ParticipleSubQuery{Collection: node.SubQuery.Collection, Expression: expr}
+		return fv, nil
+	}
+
+	if node.Child != nil {
+		if depth+1 > MaxNestingDepth {
+			return nil, ErrNestingDepth
+		}
+		expr, err := decodeExpression(node.Child, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		fv.Nested = &ParticipleNested{Expression: expr}
+		return fv, nil
+	}
+
+	if node.Value == nil {
+		return nil, fmt.Errorf("invalid encoded query: field node %s needs a value, subquery or child", node.Field)
+	}
+	value, err := decodeValue(node.Value)
+	if err != nil {
+		return nil, err
+	}
+	fv.Value = value
+	return fv, nil
+}
+
+func decodeValue(v *encodedValue) (*ParticipleValue, error) {
+	text := v.Text
+	switch v.Kind {
+	case valueTerms:
+		if len(v.Terms) == 0 {
+			return nil, fmt.Errorf("invalid encoded query: terms value needs at least one term")
+		}
+		return &ParticipleValue{TextTerms: v.Terms}, nil
+	case valueString:
+		return &ParticipleValue{String: &text}, nil
+	case valueSingleString:
+		return &ParticipleValue{SingleString: &text}, nil
+	case valueBracketed:
+		return &ParticipleValue{Bracketed: &text}, nil
+	case valueDateTime:
+		return &ParticipleValue{DateTime: &text}, nil
+	case valueTime:
+		return &ParticipleValue{TimeString: &text}, nil
+	case valueRegex:
+		return &ParticipleValue{Regex: &text}, nil
+	case valueType:
+		if len(v.Terms) == 0 {
+			return nil, fmt.Errorf("invalid encoded query: type value needs at least one type")
+		}
+		for _, name := range v.Terms {
+			if !typeNamePattern.MatchString(name) {
+				return nil, fmt.Errorf("invalid encoded query: invalid type name %q", name)
+			}
+		}
+		typeCheck := "TYPE(" + strings.Join(v.Terms, ", ") + ")"
+		return &ParticipleValue{TypeCheck: &typeCheck}, nil
+	case valueCast:
+		if !castValuePattern.MatchString(text) {
+			return nil, fmt.Errorf("invalid encoded query: invalid cast %q", text)
+		}
+		return &ParticipleValue{Cast: &text}, nil
+	}
+	return nil, fmt.Errorf("invalid encoded query: unknown value kind %q", v.Kind)
+}
+
+func decodeFreeText(node *encodedNode) (*ParticipleFreeText, error) {
+	if node.Type == nodeRegex {
+		if node.Pattern == "" {
+			return nil, fmt.Errorf("invalid encoded query: regex node needs a pattern")
+		}
+		pattern := node.Pattern
+		return &ParticipleFreeText{RegexValue: &pattern}, nil
+	}
+
+	if node.Quoted == nil {
+		if len(node.Terms) == 0 {
+			return nil, fmt.Errorf("invalid encoded query: text node needs terms or a quoted value")
+		}
+		return &ParticipleFreeText{UnquotedValue: &ParticipleUnquotedValue{TextTerms: node.Terms}}, nil
+	}
+
+	text := node.Quoted.Text
+	qv := &ParticipleQuotedValue{}
+	switch node.Quoted.Kind {
+	case valueString:
+		qv.String = &text
+	case valueSingleString:
+		qv.SingleString = &text
+	default:
+		return nil, fmt.Errorf("invalid encoded query: unknown quoted text kind %q", node.Quoted.Kind)
+	}
+	if node.Language != "" {
+		language := "~lang:" + node.Language
+		qv.Language = &language
+	}
+	return &ParticipleFreeText{QuotedValue: qv}, nil
+}
@@ -0,0 +1,101 @@
+package lucene
+
+import (
+	"strings"
+	"unicode"
+)
+
+// fieldKeywords are the keywords the lexer reads at the start of a term, before any text term
+var fieldKeywords = []string{"AND", "OR", "NOT", "COUNT", "DISTINCT", "WHERE", "IN_QUERY"}
+
+// EscapeField escapes a field name with backslashes so it parses back to the same name in a query,
+// such as first\ name for "first name". Line breaks cannot be escaped and are left as they are.
+func EscapeField(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if needsFieldEscape(name, i, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// needsFieldEscape reports whether the rune r at byte offset i of a field name must be escaped
+func needsFieldEscape(name string, i int, r rune) bool {
+	switch r {
+	case '\r', '\n':
+		return false
+	case '\\', ':', '(', ')', '[', ']', '"', '\'', '/', '|', '~':
+		return true
+	case '-', '+':
+		// A leading - or + would be read as a prefix operator
+		return i == 0
+	}
+	if unicode.IsSpace(r) {
+		return true
+	}
+	if i == 0 {
+		for _, keyword := range fieldKeywords {
+			if strings.HasPrefix(name, keyword) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unescapeField removes the backslashes escaping characters in a field name. A trailing lone backslash is kept.
+func unescapeField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// unescapeFields replaces the escaped field names and routing collection of a parsed query with the names they escape
+func unescapeFields(q *ParticipleQuery) {
+	q.Collection = unescapeField(q.Collection)
+	if q.Intent != nil && q.Intent.Distinct != nil {
+		distinct := unescapeField(*q.Intent.Distinct)
+		q.Intent.Distinct = &distinct
+	}
+	if q.Expression != nil {
+		unescapeExpressionFields(q.Expression)
+	}
+}
+
+func unescapeExpressionFields(expr *ParticipleExpression) {
+	for _, andExpr := range expr.Or {
+		for _, operand := range andExpr.And {
+			unescapeOperandFields(operand)
+		}
+	}
+}
+
+func unescapeOperandFields(operand *ParticipleOperand) {
+	for operand.Not != nil {
+		operand = operand.Not
+	}
+
+	switch term := operand.Term; {
+	case term.Group != nil:
+		unescapeExpressionFields(term.Group.Expression)
+	case term.FieldValue != nil:
+		term.FieldValue.Field = unescapeField(term.FieldValue.Field)
+		if term.FieldValue.Nested != nil {
+			unescapeExpressionFields(term.FieldValue.Nested.Expression)
+		}
+		if term.FieldValue.SubQuery != nil {
+			unescapeExpressionFields(term.FieldValue.SubQuery.Expression)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package lucene
+
+import "github.com/alecthomas/participle/v2/lexer"
+
+// intentKeywords turns the keywords COUNT, DISTINCT and WHERE into text terms everywhere the grammar does not
+// read them: COUNT or DISTINCT at the start of a query, after its options and routing prefix, WHERE directly
+// after COUNT or the DISTINCT field, and WHERE after the collection of IN_QUERY(collection WHERE ...). So
+// john COUNT, name:WHERE and COUNT:5 search for the words instead of failing to parse.
+func (d *prefixLexer) intentKeywords(tokens []lexer.Token) []lexer.Token {
+	keep := map[int]bool{}
+
+	start := d.nextSignificant(tokens, 0)
+	for start < len(tokens) && (d.isOption(tokens[start]) || tokens[start].Type == d.symbols["Route"]) {
+		start = d.nextSignificant(tokens, start+1)
+	}
+	if start < len(tokens) && !d.followedByColon(tokens, start) {
+		where := -1
+		switch tokens[start].Type {
+		case d.symbols["COUNT"]:
+			where = d.nextSignificant(tokens, start+1)
+		case d.symbols["DISTINCT"]:
+			field := d.nextSignificant(tokens, start+1)
+			where = d.nextSignificant(tokens, field+1)
+		}
+		if where >= 0 {
+			keep[start] = true
+			keep[where] = where < len(tokens) && tokens[where].Type == d.symbols["WHERE"]
+		}
+	}
+
+	// IN_QUERY ( collection WHERE
+	for i, token := range tokens {
+		if token.Type != d.symbols["IN_QUERY"] {
+			continue
+		}
+		where := i
+		for range 3 {
+			where = d.nextSignificant(tokens, where+1)
+		}
+		keep[where] = where < len(tokens) && tokens[where].Type == d.symbols["WHERE"]
+	}
+
+	out := make([]lexer.Token, len(tokens))
+	copy(out, tokens)
+	for i, token := range tokens {
+		switch token.Type {
+		case d.symbols["COUNT"], d.symbols["DISTINCT"], d.symbols["WHERE"]:
+			if !keep[i] {
+				out[i].Type = d.symbols["TextTerm"]
+			}
+		}
+	}
+	return out
+}
+
+// nextSignificant returns the index of the first token from i on that is not whitespace, or len(tokens)
+func (d *prefixLexer) nextSignificant(tokens []lexer.Token, i int) int {
+	for i < len(tokens) && tokens[i].Type == d.symbols["Whitespace"] {
+		i++
+	}
+	return min(i, len(tokens))
+}
+
+// followedByColon reports whether the token at i is directly followed by a colon, making it a field name
+func (d *prefixLexer) followedByColon(tokens []lexer.Token, i int) bool {
+	return i+1 < len(tokens) && tokens[i+1].Type == d.symbols["Colon"]
+}
@@ -0,0 +1,24 @@
+package lucene
+
+import "encoding/json"
+
+// MarshalJSON encodes the query in a stable JSON schema, versioned by SchemaVersion, so queries can be
+// stored pre-parsed or sent between services and formatted later. Source positions are not encoded.
+func (q *ParticipleQuery) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encodeQuery(q))
+}
+
+// UnmarshalJSON decodes a query encoded by MarshalJSON. It rejects unknown versions, node types
+// and value kinds, and expressions nesting deeper than MaxNestingDepth.
+func (q *ParticipleQuery) UnmarshalJSON(data []byte) error {
+	var in encodedQuery
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	decoded, err := decodeQuery(&in)
+	if err != nil {
+		return err
+	}
+	*q = *decoded
+	return nil
+}
@@ -0,0 +1,209 @@
+package lucene
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// LintRule names a style rule checked by Lint.
+type LintRule string
+
+const (
+	// LintRedundantParentheses flags parentheses that do not change how a query is grouped, such as (name:john)
+	// or the parentheses of a AND (b AND c)
+	LintRedundantParentheses LintRule = "redundant-parentheses"
+	// LintMixedOperators flags queries mixing the +term and -term prefix operators with AND, OR and NOT
+	LintMixedOperators LintRule = "mixed-operators"
+	// LintUnanchoredRegex flags regexes and wildcards without literal text at their start, such as /.*son/ or *son,
+	// which cannot use an index and scan every value
+	LintUnanchoredRegex LintRule = "unanchored-regex"
+	// LintDeprecatedSyntax flags the classic Lucene operators && and !, which this grammar searches as text
+	LintDeprecatedSyntax LintRule = "deprecated-syntax"
+)
+
+// deprecatedOperators maps the classic Lucene operator forms to the keywords that replace them
+var deprecatedOperators = map[string]string{"&&": "AND", "!": "NOT"}
+
+// LintWarning is a non-fatal style suggestion for a query.
+type LintWarning struct {
+	// Rule is the rule the query breaks
+	Rule LintRule
+	// Message describes the problem and how to fix it
+	Message string
+	// Start and End are the byte offsets of the offending text in the query
+	Start int
+	End   int
+}
+
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%d:%d %s: %s", w.Start, w.End, w.Rule, w.Message)
+}
+
+// Lint parses a query and returns style suggestions for it, ordered by their position. A query that does not
+// parse returns the parse error instead.
+func (p *Parser) Lint(query string) ([]LintWarning, error) {
+	ast, err := p.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	definition := queryLexer
+	if p.lowercaseOperators {
+		definition = lowercaseQueryLexer
+	}
+	tokens, err := definition.tokens(query)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{query: query}
+	if q := ast.(*ParticipleQuery); q.Expression != nil {
+		l.expression(q.Expression, true)
+	}
+	l.tokens(definition, tokens)
+	sort.SliceStable(l.warnings, func(i, j int) bool { return l.warnings[i].Start < l.warnings[j].Start })
+	return l.warnings, nil
+}
+
+// tokens lexes a query into its tokens, before the prefix operators are rewritten
+func (d *prefixLexer) tokens(query string) ([]lexer.Token, error) {
+	lex, err := d.base.LexString("", query)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []lexer.Token
+	for {
+		token, err := lex.Next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+		if token.EOF() {
+			return d.transform(tokens), nil
+		}
+	}
+}
+
+// prefixOperators returns the indexes of the tokens starting with a +term or -term prefix operator
+func (d *prefixLexer) prefixOperators(tokens []lexer.Token) map[int]bool {
+	prefixes := map[int]bool{}
+	var prevRaw, prevSignificant *lexer.Token
+	for i, token := range tokens {
+		next := lexer.Token{Type: lexer.EOF}
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+		if _, _, ok := d.splitPrefix(token, next, prevRaw, prevSignificant); ok {
+			prefixes[i] = true
+		}
+		prevRaw = &tokens[i]
+		if token.Type != d.symbols["Whitespace"] {
+			prevSignificant = &tokens[i]
+		}
+	}
+	return prefixes
+}
+
+// linter collects the warnings for a query
+type linter struct {
+	query    string
+	warnings []LintWarning
+}
+
+func (l *linter) warn(rule LintRule, start, end int, format string, args ...interface{}) {
+	l.warnings = append(l.warnings, LintWarning{Rule: rule, Message: fmt.Sprintf(format, args...), Start: start, End: end})
+}
+
+// expression checks the groups of an expression; whole is set for the query's top-level expression
+func (l *linter) expression(expr *ParticipleExpression, whole bool) {
+	for _, and := range expr.Or {
+		for _, operand := range and.And {
+			l.operand(operand, false, len(and.And), len(expr.Or), whole)
+		}
+	}
+}
+
+// operand checks an operand of an AND chain of andLen operands, within an OR of orLen chains
+func (l *linter) operand(operand *ParticipleOperand, negated bool, andLen, orLen int, whole bool) {
+	if operand.Not != nil {
+		l.operand(operand.Not, true, andLen, orLen, whole)
+		return
+	}
+	term := operand.Term
+	switch {
+	case term.Group != nil:
+		group := term.Group
+		if term.Modifier == nil && redundantGroup(group.Expression, negated, andLen, orLen, whole) {
+			text := l.query[group.Pos.Offset:group.EndPos.Offset]
+			l.warn(LintRedundantParentheses, group.Pos.Offset, group.EndPos.Offset,
+				"the parentheses of %s do not change how the query is grouped and can be removed", text)
+		}
+		l.expression(group.Expression, false)
+	case term.FieldValue != nil && term.FieldValue.Nested != nil:
+		l.expression(term.FieldValue.Nested.Expression, false)
+	case term.FieldValue != nil && term.FieldValue.SubQuery != nil:
+		l.expression(term.FieldValue.SubQuery.Expression, false)
+	}
+}
+
+// redundantGroup reports whether parentheses around inner can be removed without changing the query: they hold
+// a single operand, ANDed operands within an AND chain or the whole query, or ORed operands within an OR or
+// the whole query. A negated group of several operands needs its parentheses.
+func redundantGroup(inner *ParticipleExpression, negated bool, andLen, orLen int, whole bool) bool {
+	if len(inner.Or) == 1 && len(inner.Or[0].And) == 1 {
+		return true
+	}
+	if negated {
+		return false
+	}
+	wholeQuery := whole && andLen == 1 && orLen == 1
+	if len(inner.Or) == 1 {
+		return andLen > 1 || wholeQuery
+	}
+	return andLen == 1 && (orLen > 1 || wholeQuery)
+}
+
+// tokens checks the operators, regexes, wildcards and terms of a query
+func (l *linter) tokens(d *prefixLexer, tokens []lexer.Token) {
+	prefixes := d.prefixOperators(tokens)
+	var prefix, keyword *lexer.Token
+	for i, token := range tokens {
+		start, end := token.Pos.Offset, token.Pos.Offset+len(token.Value)
+		value := token.Value
+		if prefixes[i] {
+			if prefix == nil {
+				prefix = &tokens[i]
+			}
+			value = value[1:]
+		}
+
+		switch token.Type {
+		case d.symbols["AND"], d.symbols["OR"], d.symbols["NOT"]:
+			if keyword == nil {
+				keyword = &tokens[i]
+			}
+		case d.symbols["Regex"]:
+			if pattern := strings.Trim(value, "/"); strings.HasPrefix(pattern, ".") {
+				l.warn(LintUnanchoredRegex, start, end,
+					"the regex %s has no literal text at its start, so it cannot use an index; start it with literal text", value)
+			}
+		case d.symbols["TextTerm"]:
+			if replacement, ok := deprecatedOperators[value]; ok {
+				l.warn(LintDeprecatedSyntax, start, end, "%s is searched as text; use %s", value, replacement)
+			} else if strings.HasPrefix(value, "!") {
+				l.warn(LintDeprecatedSyntax, start, end, "the ! in %s is searched as text; use NOT", value)
+			} else if value != "*" && (strings.HasPrefix(value, "*") || strings.HasPrefix(value, "?")) {
+				l.warn(LintUnanchoredRegex, start, end,
+					"the wildcard %s has no literal text at its start, so it cannot use an index; start it with literal text", value)
+			}
+		}
+	}
+
+	if prefix != nil && keyword != nil {
+		l.warn(LintMixedOperators, prefix.Pos.Offset, prefix.Pos.Offset+1,
+			"the query mixes the %c prefix operator with %s; use either prefix operators or AND, OR and NOT",
+			prefix.Value[0], strings.ToUpper(keyword.Value))
+	}
+}
@@ -0,0 +1,49 @@
+package lucene
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// lowercaseOperators are the operator keywords read in any case when lowercase operators are enabled
+var lowercaseOperators = []string{"AND", "OR", "NOT"}
+
+// lowercaseKeywords replaces the words and, or and not, in any case, with AND, OR and NOT tokens when they stand
+// alone between whitespace and parentheses. Words joined to a colon, such as and:x or field:or, and quoted or
+// escaped words, such as "and" or \and, stay text.
+func (d *prefixLexer) lowercaseKeywords(tokens []lexer.Token) []lexer.Token {
+	if !d.lowercase {
+		return tokens
+	}
+
+	out := make([]lexer.Token, len(tokens))
+	copy(out, tokens)
+	for i, token := range tokens {
+		if token.Type != d.symbols["TextTerm"] {
+			continue
+		}
+		keyword := strings.ToUpper(token.Value)
+		if !slices.Contains(lowercaseOperators, keyword) || keyword == token.Value {
+			continue
+		}
+		if i > 0 && !d.isKeywordBoundary(tokens[i-1]) {
+			continue
+		}
+		if i+1 >= len(tokens) || !d.isKeywordBoundary(tokens[i+1]) {
+			continue
+		}
+		out[i] = lexer.Token{Type: d.symbols[keyword], Value: keyword, Pos: token.Pos}
+	}
+	return out
+}
+
+// isKeywordBoundary reports whether a token may border an operator keyword
+func (d *prefixLexer) isKeywordBoundary(token lexer.Token) bool {
+	switch token.Type {
+	case d.symbols["Whitespace"], d.symbols["LParen"], d.symbols["RParen"]:
+		return true
+	}
+	return false
+}
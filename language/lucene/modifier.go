@@ -0,0 +1,60 @@
+package lucene
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// modifierPattern matches a Lucene boost such as ^2 or ^0.5, or a fuzziness or proximity suffix such as ~, ~1 or ~0.8,
+// at the end of a token
+var modifierPattern = regexp.MustCompile(`(\^\d+(\.\d+)?|~(\d+(\.\d+)?)?)$`)
+
+// splitModifiers splits boost, fuzziness and proximity suffixes such as john^2, roam~1 and "john smith"~3 into
+// Modifier tokens after the term, phrase or group they apply to, which the lexer otherwise reads as text.
+// An escaped suffix, as in john\^2, stays part of the term.
+func (d *prefixLexer) splitModifiers(tokens []lexer.Token) []lexer.Token {
+	out := make([]lexer.Token, 0, len(tokens))
+	for i, token := range tokens {
+		if token.Type != d.symbols["TextTerm"] {
+			out = append(out, token)
+			continue
+		}
+		loc := modifierPattern.FindStringIndex(token.Value)
+		if loc == nil {
+			out = append(out, token)
+			continue
+		}
+
+		if loc[0] == 0 {
+			// A modifier on its own applies to the phrase, value or group directly before it
+			if i > 0 && d.takesModifier(tokens[i-1]) && tokens[i-1].Pos.Offset+len(tokens[i-1].Value) == token.Pos.Offset {
+				token.Type = d.symbols["Modifier"]
+			}
+			out = append(out, token)
+			continue
+		}
+		if strings.HasSuffix(token.Value[:loc[0]], `\`) {
+			out = append(out, token)
+			continue
+		}
+
+		pos := token.Pos
+		pos.Advance(token.Value[:loc[0]])
+		out = append(out,
+			lexer.Token{Type: token.Type, Value: token.Value[:loc[0]], Pos: token.Pos},
+			lexer.Token{Type: d.symbols["Modifier"], Value: token.Value[loc[0]:], Pos: pos})
+	}
+	return out
+}
+
+// takesModifier reports whether a token can be followed by a modifier written directly after it
+func (d *prefixLexer) takesModifier(token lexer.Token) bool {
+	switch token.Type {
+	case d.symbols["String"], d.symbols["SingleString"], d.symbols["Bracketed"], d.symbols["Regex"],
+		d.symbols["DateTime"], d.symbols["TimeString"], d.symbols["RParen"]:
+		return true
+	}
+	return false
+}
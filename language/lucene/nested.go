@@ -0,0 +1,150 @@
+package lucene
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// nest replaces the braces of nested groups, as in profile:{city:SF AND verified:true}, with NestedOpen and
+// NestedClose tokens. Braces are lexed as part of text terms, so the opening brace is split off the start of
+// the term after field: and closing braces off the end of terms inside the group, as in verified:true}.
+// A brace only opens a group when the group is closed and holds a field clause, so values such as x:{y} and
+// x:{ keep their braces.
+func (d *prefixLexer) nest(tokens []lexer.Token) []lexer.Token {
+	out := make([]lexer.Token, 0, len(tokens))
+	depth := 0
+	for i := range tokens {
+		token := tokens[i]
+		if d.opensNested(tokens, i) && d.closesNested(tokens, i) {
+			out = append(out, lexer.Token{Type: d.symbols["NestedOpen"], Value: "{", Pos: token.Pos})
+			depth++
+			token = d.trimPrefix(token, token.Type)
+			if token.Value == "" {
+				continue
+			}
+		}
+
+		if depth == 0 || token.Type != d.symbols["TextTerm"] {
+			out = append(out, token)
+			continue
+		}
+		closes := closingBraces(token.Value, depth)
+		value := token.Value[:len(token.Value)-closes]
+		if value != "" {
+			out = append(out, lexer.Token{Type: token.Type, Value: value, Pos: token.Pos})
+		}
+		pos := token.Pos
+		pos.Advance(value)
+		for range closes {
+			out = append(out, lexer.Token{Type: d.symbols["NestedClose"], Value: "}", Pos: pos})
+			pos.Advance("}")
+		}
+		depth -= closes
+	}
+	return out
+}
+
+// opensNested reports whether tokens[i] starts with a brace directly after a field and colon, as in profile:{city
+func (d *prefixLexer) opensNested(tokens []lexer.Token, i int) bool {
+	return i >= 2 && tokens[i].Type == d.symbols["TextTerm"] && strings.HasPrefix(tokens[i].Value, "{") &&
+		tokens[i-1].Type == d.symbols["Colon"] && tokens[i-2].Type == d.symbols["TextTerm"]
+}
+
+// closesNested reports whether the group opened at tokens[i] is closed before the directives or the end of the
+// query, with a field clause inside it
+func (d *prefixLexer) closesNested(tokens []lexer.Token, i int) bool {
+	depth, hasField := 0, false
+	for j := i; j < len(tokens); j++ {
+		token := tokens[j]
+		switch token.Type {
+		case d.symbols["Pipe"], lexer.EOF:
+			return false
+		case d.symbols["Colon"]:
+			hasField = true
+		case d.symbols["TextTerm"]:
+			value := token.Value
+			if j == i || d.opensNested(tokens, j) {
+				depth++
+				value = value[1:]
+			}
+			depth -= closingBraces(value, depth)
+			if depth == 0 {
+				return hasField
+			}
+		}
+	}
+	return false
+}
+
+// closingBraces returns how many of the braces ending a text term close open groups, at most depth.
+// A brace escaped with a backslash is part of the term.
+func closingBraces(value string, depth int) int {
+	closes := 0
+	for closes < depth && closes < len(value) && value[len(value)-1-closes] == '}' {
+		closes++
+	}
+	if closes > 0 && closes < len(value) && value[len(value)-1-closes] == '\\' {
+		closes--
+	}
+	return closes
+}
+
+// ExpandNested returns the clauses of a nested group such as profile:{city:SF AND verified:true} with every field
+// prefixed by the group's field, here profile.city:SF AND profile.verified:true. Nested groups inside it are
+// expanded too; the clauses of IN_QUERY subqueries are left alone, since they query another collection.
+// Free text has no field to prefix and is rejected.
+func (fv *ParticipleFieldValue) ExpandNested() (*ParticipleExpression, error) {
+	if fv.Nested == nil {
+		return nil, fmt.Errorf("%s is not a nested group", fv.Field)
+	}
+	return expandNestedExpression(fv.Nested.Expression, fv.Field)
+}
+
+func expandNestedExpression(expr *ParticipleExpression, prefix string) (*ParticipleExpression, error) {
+	expanded := &ParticipleExpression{}
+	for _, andExpr := range expr.Or {
+		expandedAnd := &ParticipleAndExpression{}
+		for _, operand := range andExpr.And {
+			expandedOperand, err := expandNestedOperand(operand, prefix)
+			if err != nil {
+				return nil, err
+			}
+			expandedAnd.And = append(expandedAnd.And, expandedOperand)
+		}
+		expanded.Or = append(expanded.Or, expandedAnd)
+	}
+	return expanded, nil
+}
+
+func expandNestedOperand(operand *ParticipleOperand, prefix string) (*ParticipleOperand, error) {
+	if operand.Not != nil {
+		not, err := expandNestedOperand(operand.Not, prefix)
+		if err != nil {
+			return nil, err
+		}
+		return &ParticipleOperand{Not: not}, nil
+	}
+
+	term := operand.Term
+	switch {
+	case term.Group != nil:
+		expr, err := expandNestedExpression(term.Group.Expression, prefix)
+		if err != nil {
+			return nil, err
+		}
+		return &ParticipleOperand{Term: &ParticipleTerm{Group: &ParticipleGroup{Expression: expr}, Modifier: term.Modifier}}, nil
+	case term.FieldValue != nil && term.FieldValue.Nested != nil:
+		expr, err := expandNestedExpression(term.FieldValue.Nested.Expression, prefix+"."+term.FieldValue.Field)
+		if err != nil {
+			return nil, err
+		}
+		return &ParticipleOperand{Term: &ParticipleTerm{Group: &ParticipleGroup{Expression: expr}, Modifier: term.Modifier}}, nil
+	case term.FieldValue != nil:
+		fv := *term.FieldValue
+		fv.Field = prefix + "." + fv.Field
+		return &ParticipleOperand{Term: &ParticipleTerm{FieldValue: &fv, Modifier: term.Modifier}}, nil
+	}
+	return nil, fmt.Errorf("free text cannot be nested in %s:{...}; nested clauses need a field", prefix)
+}
@@ -0,0 +1,51 @@
+package lucene
+
+import (
+	"regexp"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// optionNamePattern matches a query option such as @include_deleted, written at the start of a query
+var optionNamePattern = regexp.MustCompile(`^@[A-Za-z_][A-Za-z0-9_]*$`)
+
+// options replaces the query options at the start of a query, such as @include_deleted @limit:20, with
+// Option tokens holding their names and OptionValue tokens holding their values. A term is only read as an
+// option when it is followed by whitespace or the end of the query, so @example.com or @a(b) stay free text.
+func (d *prefixLexer) options(tokens []lexer.Token) []lexer.Token {
+	out := make([]lexer.Token, 0, len(tokens))
+	i := 0
+	for i < len(tokens) {
+		if tokens[i].Type == d.symbols["Whitespace"] {
+			out = append(out, tokens[i])
+			i++
+			continue
+		}
+		name := tokens[i]
+		if name.Type != d.symbols["TextTerm"] || !optionNamePattern.MatchString(name.Value) {
+			break
+		}
+
+		end := i + 1
+		var value *lexer.Token
+		if end+1 < len(tokens) && tokens[end].Type == d.symbols["Colon"] && tokens[end+1].Type == d.symbols["TextTerm"] {
+			value = &lexer.Token{Type: d.symbols["OptionValue"], Value: tokens[end+1].Value, Pos: tokens[end+1].Pos}
+			end += 2
+		}
+		if end < len(tokens) && tokens[end].Type != d.symbols["Whitespace"] && !tokens[end].EOF() {
+			break
+		}
+
+		out = append(out, lexer.Token{Type: d.symbols["Option"], Value: name.Value[1:], Pos: name.Pos})
+		if value != nil {
+			out = append(out, *value)
+		}
+		i = end
+	}
+	return append(out, tokens[i:]...)
+}
+
+// isOption reports whether a token is part of a query option
+func (d *prefixLexer) isOption(token lexer.Token) bool {
+	return token.Type == d.symbols["Option"] || token.Type == d.symbols["OptionValue"]
+}
@@ -2,6 +2,9 @@
 package lucene
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/alecthomas/participle/v2"
 	"github.com/alecthomas/participle/v2/lexer"
 )
@@ -10,7 +13,31 @@ import (
 
 // ParticipleQuery is the root of the Participle AST
 type ParticipleQuery struct {
-	Expression *ParticipleExpression `@@`
+	Options    []*ParticipleOption    `@@*`
+	Collection string                 `@Route?`
+	Intent     *ParticipleIntent      `@@?`
+	Expression *ParticipleExpression  `@@?`
+	Directives []*ParticipleDirective `( "|" @@ )*`
+}
+
+// ParticipleOption represents a query option such as @include_deleted or @limit:20, written at the start of a
+// query. Value is empty for options without one.
+type ParticipleOption struct {
+	Name  string `@Option`
+	Value string `@OptionValue?`
+}
+
+// ParticipleIntent represents a query prefix such as COUNT WHERE or DISTINCT field WHERE
+type ParticipleIntent struct {
+	Count    bool    `( @"COUNT":COUNT`
+	Distinct *string `| "DISTINCT":DISTINCT @TextTerm )`
+	Where    bool    `@"WHERE":WHERE?`
+}
+
+// ParticipleDirective represents trailing directives such as sort:-created_at, limit:50 or fields:name,email
+type ParticipleDirective struct {
+	Name  string `@TextTerm ":"`
+	Value string `@TextTerm`
 }
 
 // ParticipleExpression handles OR operations (lowest precedence)
@@ -23,23 +50,42 @@ type ParticipleAndExpression struct {
 	And []*ParticipleOperand `@@ ( "AND" @@ )*`
 }
 
-// ParticipleOperand handles operands that can optionally be negated (highest precedence)
+// ParticipleOperand handles operands that can optionally be negated (highest precedence); a -term prefix is lexed as NOT
 type ParticipleOperand struct {
 	Not  *ParticipleOperand `"NOT" @@`
 	Term *ParticipleTerm    `| @@`
 }
 
-// ParticipleTerm represents individual query terms
+// ParticipleTerm represents individual query terms, with an optional boost, fuzziness or proximity modifier
+// such as ^2 or ~1 for formatters that support them
 type ParticipleTerm struct {
-	FieldValue *ParticipleFieldValue `@@`
+	FieldValue *ParticipleFieldValue `( @@`
 	FreeText   *ParticipleFreeText   `| @@`
-	Group      *ParticipleGroup      `| @@`
+	Group      *ParticipleGroup      `| @@ )`
+	Modifier   *string               `@Modifier?`
 }
 
 // ParticipleFieldValue represents field:value pairs
 type ParticipleFieldValue struct {
-	Field string           `@TextTerm ":"`
-	Value *ParticipleValue `@@`
+	Pos    lexer.Position
+	EndPos lexer.Position
+
+	Field      string                `@TextTerm ":"`
+	SubQuery   *ParticipleSubQuery   `( @@`
+	Nested     *ParticipleNested     `| @@`
+	ValueGroup *ParticipleValueGroup `| @@`
+	Value      *ParticipleValue      `| @@ )`
+}
+
+// ParticipleSubQuery represents a reference to the results of another query, e.g. IN_QUERY(users WHERE role:admin)
+type ParticipleSubQuery struct {
+	Collection string                `"IN_QUERY" "(" @TextTerm`
+	Expression *ParticipleExpression `"WHERE":WHERE @@ ")"`
+}
+
+// ParticipleNested represents clauses on the fields of an embedded document, e.g. profile:{city:SF AND verified:true}
+type ParticipleNested struct {
+	Expression *ParticipleExpression `NestedOpen @@ NestedClose`
 }
 
 // SplitIntoFieldAndText splits a field value into field:value and free text if the value contains multiple text terms
@@ -70,15 +116,38 @@ func (fv *ParticipleFieldValue) SplitIntoFieldAndText() (*ParticipleFieldValue,
 
 // ParticipleFreeText represents free text search queries (quoted or unquoted text without field names)
 type ParticipleFreeText struct {
+	Pos    lexer.Position
+	EndPos lexer.Position
+
 	QuotedValue   *ParticipleQuotedValue   `@@`
 	UnquotedValue *ParticipleUnquotedValue `| @@`
 	RegexValue    *string                  `| @Regex`
 }
 
-// ParticipleQuotedValue represents quoted values for free text search
+// ParticipleQuotedValue represents quoted values for free text search, with an optional ~lang:xx text search language
 type ParticipleQuotedValue struct {
-	String       *string `@String`
-	SingleString *string `| @SingleString`
+	String       *string `( @String`
+	SingleString *string `| @SingleString )`
+	Language     *string `@TextLang?`
+}
+
+// LanguageCode returns the text search language from a ~lang:xx suffix, or "" when none was given
+func (qv *ParticipleQuotedValue) LanguageCode() string {
+	if qv.Language == nil {
+		return ""
+	}
+	return strings.TrimPrefix(*qv.Language, "~lang:")
+}
+
+// Text returns the unquoted text of the value
+func (qv *ParticipleQuotedValue) Text() string {
+	if qv.String != nil {
+		return *qv.String
+	}
+	if qv.SingleString != nil {
+		return *qv.SingleString
+	}
+	return ""
 }
 
 // ParticipleUnquotedValue represents unquoted text for free text search
@@ -95,21 +164,91 @@ type ParticipleValue struct {
 	DateTime     *string  `| @DateTime`
 	TimeString   *string  `| @TimeString`
 	Regex        *string  `| @Regex`
+	TypeCheck    *string  `| @TypeCheck`
+	Cast         *string  `| @Cast`
+}
+
+// TypeNames returns the BSON type names or numbers listed in a TYPE(...) value, or nil for other values
+func (v *ParticipleValue) TypeNames() []string {
+	if v.TypeCheck == nil {
+		return nil
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(*v.TypeCheck, "TYPE("), ")")
+	var names []string
+	for _, name := range strings.Split(inner, ",") {
+		names = append(names, strings.TrimSpace(name))
+	}
+	return names
+}
+
+// CastValue returns the type name and the value of a cast such as int(42) or str("true"), unquoted,
+// and whether the value was quoted. It returns empty strings for other values.
+func (v *ParticipleValue) CastValue() (name, value string, quoted bool) {
+	if v.Cast == nil {
+		return "", "", false
+	}
+	open := strings.Index(*v.Cast, "(")
+	name = (*v.Cast)[:open]
+	value = strings.TrimSpace((*v.Cast)[open+1 : len(*v.Cast)-1])
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		return name, unquoteCast(value), true
+	}
+	return name, value, false
+}
+
+// unquoteCast removes the quotes and backslash escapes of a quoted cast value
+func unquoteCast(value string) string {
+	var b strings.Builder
+	inner := value[1 : len(value)-1]
+	for i := 0; i < len(inner); i++ {
+		if inner[i] == '\\' && i+1 < len(inner) {
+			i++
+		}
+		b.WriteByte(inner[i])
+	}
+	return b.String()
+}
+
+// IsQuoted reports whether the value was written in single or double quotes.
+// Quoted values are literal strings: they are never wildcards, ranges or regexes,
+// nor converted to numbers, dates, booleans or ObjectIDs.
+func (v *ParticipleValue) IsQuoted() bool {
+	return v.String != nil || v.SingleString != nil
 }
 
 // ParticipleGroup represents parenthesized expressions
 type ParticipleGroup struct {
+	Pos    lexer.Position
+	EndPos lexer.Position
+
 	Expression *ParticipleExpression `"(" @@ ")"`
 }
 
+// castTypes are the type names of value casts such as int(42), which convert the value to that type
+// instead of inferring one
+var castTypes = []string{"int", "long", "double", "decimal", "str", "string", "bool", "date", "oid", "objectId", "uuid"}
+
+// castPattern matches a value cast: a cast type and a quoted or unquoted value in parentheses
+var castPattern = `(` + strings.Join(castTypes, "|") + `)\(\s*("([^"\\]|\\.)*"|'([^'\\]|\\.)*'|[^\s()"']+)\s*\)`
+
 // Lexer definition for Lucene-style queries
 var luceneLexer = lexer.MustSimple([]lexer.SimpleRule{
-	// Whitespace
-	{Name: "Whitespace", Pattern: `\s+`},
+	// Whitespace, including a backslash at the end of a line as an explicit line continuation
+	{Name: "Whitespace", Pattern: `(\s|\\\r?\n)+`},
 	// Logical operators
 	{Name: "AND", Pattern: `AND`},
 	{Name: "OR", Pattern: `OR`},
 	{Name: "NOT", Pattern: `NOT`},
+	// Intent keywords
+	{Name: "COUNT", Pattern: `COUNT\b`},
+	{Name: "DISTINCT", Pattern: `DISTINCT\b`},
+	{Name: "WHERE", Pattern: `WHERE\b`},
+	// Subquery keyword
+	{Name: "IN_QUERY", Pattern: `IN_QUERY\b`},
+	// BSON type checks such as TYPE(string) or TYPE(int, long) - must come before TextTerm
+	{Name: "TypeCheck", Pattern: `TYPE\(\s*-?[A-Za-z0-9]+(\s*,\s*-?[A-Za-z0-9]+)*\s*\)`},
+	// Value casts such as int(42), date("2023-01-15") or str(true) - must come before TextTerm
+	{Name: "Cast", Pattern: castPattern},
 	// Parentheses
 	{Name: "LParen", Pattern: `\(`},
 	{Name: "RParen", Pattern: `\)`},
@@ -117,6 +256,9 @@ var luceneLexer = lexer.MustSimple([]lexer.SimpleRule{
 	{Name: "String", Pattern: `"([^"\\]|\\.)*"`},
 	// Single quoted strings - must come before TextTerm
 	{Name: "SingleString", Pattern: `'([^'\\]|\\.)*'`},
+	// Quoted strings with a +/- prefix operator, e.g. -"john doe" - must come before TextTerm
+	{Name: "PrefixedString", Pattern: `[-+]"([^"\\]|\\.)*"`},
+	{Name: "PrefixedSingleString", Pattern: `[-+]'([^'\\]|\\.)*'`},
 	// Regex patterns - must come before Bracketed
 	{Name: "Regex", Pattern: `/([^/\\]|\\.)*/`},
 	// Date ranges and other bracketed expressions
@@ -125,29 +267,117 @@ var luceneLexer = lexer.MustSimple([]lexer.SimpleRule{
 	{Name: "DateTime", Pattern: `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})?`},
 	// Time strings with colons
 	{Name: "TimeString", Pattern: `\d{2}:\d{2}:\d{2}(\.\d+)?`},
+	// Text search language suffix for quoted free text, e.g. "jean"~lang:fr - must come before Colon
+	{Name: "TextLang", Pattern: `~lang:[A-Za-z_-]+`},
+	// Directive separator - must come before TextTerm
+	{Name: "Pipe", Pattern: `\|`},
 	// Colon separator - must come after datetime patterns
 	{Name: "Colon", Pattern: `:`},
-	// Text terms (can be field names or values) - pattern includes wildcards
-	{Name: "TextTerm", Pattern: `[^:\s\[\]()]+`},
+	// Text terms (can be field names or values) - pattern includes wildcards and backslash escapes,
+	// so \* is a literal asterisk, \AND a literal AND and \[ a literal bracket. A term starting with a URL
+	// scheme such as https:// keeps its colons, so url:https://example.com:8080/a needs no quotes
+	{Name: "TextTerm", Pattern: `[A-Za-z][A-Za-z0-9+.-]*://(\\[^\r\n]|[^\s\[\]()\\])+|(\\[^\r\n]|\\$|[^:\s\[\]()\\])+`},
 })
 
-// Parser instance using Participle
-var participleParser = participle.MustBuild[ParticipleQuery](
-	participle.Lexer(luceneLexer),
-	participle.Unquote("String", "SingleString"),
-	participle.UseLookahead(2),
-	participle.Elide("Whitespace"),
+// queryLexer applies the +term and -term prefix operators on top of the Lucene lexer
+var queryLexer = newPrefixLexer(luceneLexer)
+
+// lowercaseQueryLexer also reads the words and, or and not in any case as operators
+var lowercaseQueryLexer = &prefixLexer{base: queryLexer.base, symbols: queryLexer.symbols, lowercase: true}
+
+// Parser instances using Participle, with and without lowercase operators
+var (
+	participleParser          = buildParser(queryLexer)
+	lowercaseParticipleParser = buildParser(lowercaseQueryLexer)
 )
 
+// buildParser builds the Participle parser of Lucene queries with a lexer
+func buildParser(lex *prefixLexer) *participle.Parser[ParticipleQuery] {
+	return participle.MustBuild[ParticipleQuery](
+		participle.Lexer(lex),
+		participle.Unquote("String", "SingleString"),
+		participle.UseLookahead(2),
+		participle.Elide("Whitespace"),
+	)
+}
+
+// MaxNestingDepth is the deepest combination of parentheses and chained NOT operators a query may use
+const MaxNestingDepth = 100
+
+// ErrNestingDepth is returned for queries nesting deeper than MaxNestingDepth
+var ErrNestingDepth = fmt.Errorf("query exceeds the maximum nesting depth of %d", MaxNestingDepth)
+
 // Parser represents a Lucene-style query parser.
-type Parser struct{}
+type Parser struct {
+	lowercaseOperators bool
+}
 
 // New creates a new Lucene parser instance.
 func New() *Parser {
 	return &Parser{}
 }
 
-// Parse parses a Lucene-style query string into an AST.
+// WithLowercaseOperators sets whether the words and, or and not are read as operators in any case, not only
+// as AND, OR and NOT, and returns the parser. A lowercase operator word is searched for when quoted or escaped.
+func (p *Parser) WithLowercaseOperators(enabled bool) *Parser {
+	p.lowercaseOperators = enabled
+	return p
+}
+
+// Parse parses a Lucene-style query string into an AST. Escaped field names, such as first\ name, are unescaped.
 func (p *Parser) Parse(query string) (interface{}, error) {
-	return participleParser.ParseString("", query)
+	lex, parser := queryLexer, participleParser
+	if p.lowercaseOperators {
+		lex, parser = lowercaseQueryLexer, lowercaseParticipleParser
+	}
+	if err := checkNestingDepth(lex, query); err != nil {
+		return nil, err
+	}
+	q, err := parser.ParseString("", query)
+	if err != nil {
+		return nil, err
+	}
+	unescapeFields(q)
+	if err := expandValueGroups(q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// checkNestingDepth rejects queries whose parentheses or NOT chains nest deeper than MaxNestingDepth,
+// which would otherwise make parsing and formatting recurse without bound on untrusted input
+func checkNestingDepth(definition *prefixLexer, query string) error {
+	lex, err := definition.LexString("", query)
+	if err != nil {
+		return nil
+	}
+
+	depth, notRun := 0, 0
+	for {
+		// Lexing errors are left to the parser, which reports them with position information;
+		// the tokens before the error still count towards the depth
+		token, err := lex.Next()
+		if err != nil || token.EOF() {
+			return nil
+		}
+		if strings.TrimSpace(token.Value) == "" {
+			continue
+		}
+
+		switch {
+		case token.Value == "(", token.Type == definition.symbols["NestedOpen"]:
+			depth++
+			notRun = 0
+		case token.Value == ")", token.Type == definition.symbols["NestedClose"]:
+			depth--
+			notRun = 0
+		case token.Value == "NOT":
+			notRun++
+		default:
+			notRun = 0
+		}
+		if depth+notRun > MaxNestingDepth {
+			return ErrNestingDepth
+		}
+	}
 }
@@ -0,0 +1,191 @@
+package lucene
+
+import (
+	"io"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// prefixLexer wraps the Lucene lexer to support the +term and -term prefix operators.
+// A prefix at the start of an operand is rewritten into keyword tokens before parsing:
+// -term becomes NOT term and +term becomes term, each joined to a preceding operand with AND,
+// so role:admin -status:banned +active:true parses as role:admin AND NOT status:banned AND active:true.
+// Token positions are preserved, so errors still point at the original query.
+type prefixLexer struct {
+	base    *lexer.StatefulDefinition
+	symbols map[string]lexer.TokenType
+	// lowercase reads the words and, or and not in any case as operators
+	lowercase bool
+}
+
+func newPrefixLexer(base *lexer.StatefulDefinition) *prefixLexer {
+	// Route, nested group, modifier and option tokens are only produced by rewriting, so they get types of their own
+	symbols := map[string]lexer.TokenType{}
+	route := lexer.EOF
+	for name, tokenType := range base.Symbols() {
+		symbols[name] = tokenType
+		route = min(route, tokenType)
+	}
+	symbols["Route"] = route - 1
+	symbols["NestedOpen"] = route - 2
+	symbols["NestedClose"] = route - 3
+	symbols["Modifier"] = route - 4
+	symbols["Option"] = route - 5
+	symbols["OptionValue"] = route - 6
+	return &prefixLexer{base: base, symbols: symbols}
+}
+
+func (d *prefixLexer) Symbols() map[string]lexer.TokenType {
+	return d.symbols
+}
+
+func (d *prefixLexer) Lex(filename string, r io.Reader) (lexer.Lexer, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.LexString(filename, string(data))
+}
+
+func (d *prefixLexer) LexString(filename string, input string) (lexer.Lexer, error) {
+	lex, err := d.base.LexString(filename, input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect the tokens up to the first error, which is reported after them
+	var tokens []lexer.Token
+	for {
+		token, err := lex.Next()
+		if err != nil {
+			return &tokenLexer{tokens: d.rewrite(d.transform(tokens)), err: err}, nil
+		}
+		tokens = append(tokens, token)
+		if token.EOF() {
+			return &tokenLexer{tokens: d.rewrite(d.transform(tokens))}, nil
+		}
+	}
+}
+
+// transform applies the rewrites of the base lexer's tokens that come before the prefix operators are rewritten
+func (d *prefixLexer) transform(tokens []lexer.Token) []lexer.Token {
+	return d.nest(d.splitModifiers(d.joinComparisons(d.joinAddresses(d.intentKeywords(d.route(d.lowercaseKeywords(d.options(tokens))))))))
+}
+
+// rewrite replaces prefix operators at the start of operands with AND and NOT tokens
+func (d *prefixLexer) rewrite(tokens []lexer.Token) []lexer.Token {
+	out := make([]lexer.Token, 0, len(tokens))
+	var prevRaw, prevSignificant *lexer.Token
+
+	for i := range tokens {
+		token := tokens[i]
+		next := lexer.Token{Type: lexer.EOF}
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+
+		if prefix, operand, ok := d.splitPrefix(token, next, prevRaw, prevSignificant); ok {
+			if prevSignificant != nil && d.endsOperand(*prevSignificant) {
+				out = append(out, lexer.Token{Type: d.symbols["AND"], Value: "AND", Pos: token.Pos})
+			}
+			if prefix == '-' {
+				out = append(out, lexer.Token{Type: d.symbols["NOT"], Value: "NOT", Pos: token.Pos})
+			}
+			if operand != nil {
+				out = append(out, *operand)
+			}
+		} else {
+			out = append(out, d.restore(token))
+		}
+
+		prevRaw = &tokens[i]
+		if token.Type != d.symbols["Whitespace"] {
+			prevSignificant = &tokens[i]
+		}
+	}
+	return out
+}
+
+// splitPrefix reports whether a token starts an operand with a prefix operator, returning the operator
+// and the operand token without it, or nil when the operand is the next token, as in -(a OR b).
+// A prefix followed by a digit, dot or sign is part of a value such as -5 or +1.5, not an operator,
+// and so is any prefix directly after a colon, as in age:-5.
+func (d *prefixLexer) splitPrefix(token, next lexer.Token, prevRaw, prevSignificant *lexer.Token) (byte, *lexer.Token, bool) {
+	if prevRaw != nil && prevRaw.Type != d.symbols["Whitespace"] && prevRaw.Type != d.symbols["LParen"] &&
+		prevRaw.Type != d.symbols["NestedOpen"] {
+		return 0, nil, false
+	}
+	if prevSignificant != nil && prevSignificant.Type == d.symbols["Colon"] {
+		return 0, nil, false
+	}
+
+	switch token.Type {
+	case d.symbols["PrefixedString"]:
+		operand := d.trimPrefix(token, d.symbols["String"])
+		return token.Value[0], &operand, true
+	case d.symbols["PrefixedSingleString"]:
+		operand := d.trimPrefix(token, d.symbols["SingleString"])
+		return token.Value[0], &operand, true
+	case d.symbols["TextTerm"]:
+	default:
+		return 0, nil, false
+	}
+
+	value := token.Value
+	if value[0] != '-' && value[0] != '+' {
+		return 0, nil, false
+	}
+	if len(value) == 1 {
+		// A lone prefix applies to a following group
+		return value[0], nil, next.Type == d.symbols["LParen"]
+	}
+	switch c := value[1]; {
+	case c >= '0' && c <= '9', c == '.', c == '-', c == '+':
+		return 0, nil, false
+	}
+
+	operand := d.trimPrefix(token, token.Type)
+	return value[0], &operand, true
+}
+
+// trimPrefix returns a token without its leading prefix character, with the given type
+func (d *prefixLexer) trimPrefix(token lexer.Token, tokenType lexer.TokenType) lexer.Token {
+	pos := token.Pos
+	pos.Advance(token.Value[:1])
+	return lexer.Token{Type: tokenType, Value: token.Value[1:], Pos: pos}
+}
+
+// restore turns a prefixed string that is not an operator, such as the value in name:-"x", back into a text term
+func (d *prefixLexer) restore(token lexer.Token) lexer.Token {
+	if token.Type == d.symbols["PrefixedString"] || token.Type == d.symbols["PrefixedSingleString"] {
+		token.Type = d.symbols["TextTerm"]
+	}
+	return token
+}
+
+// endsOperand reports whether a token can end an operand, so a following prefixed operand is joined with AND
+func (d *prefixLexer) endsOperand(token lexer.Token) bool {
+	switch token.Type {
+	case d.symbols["TextTerm"], d.symbols["String"], d.symbols["SingleString"], d.symbols["PrefixedString"],
+		d.symbols["PrefixedSingleString"], d.symbols["Bracketed"], d.symbols["DateTime"], d.symbols["TimeString"],
+		d.symbols["Regex"], d.symbols["TextLang"], d.symbols["TypeCheck"], d.symbols["Cast"], d.symbols["RParen"],
+		d.symbols["NestedClose"], d.symbols["Modifier"]:
+		return true
+	}
+	return false
+}
+
+// tokenLexer replays a slice of tokens, then an error if lexing failed
+type tokenLexer struct {
+	tokens []lexer.Token
+	err    error
+}
+
+func (l *tokenLexer) Next() (lexer.Token, error) {
+	if len(l.tokens) == 0 {
+		return lexer.Token{}, l.err
+	}
+	token := l.tokens[0]
+	l.tokens = l.tokens[1:]
+	return token, nil
+}
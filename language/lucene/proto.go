@@ -0,0 +1,460 @@
+package lucene
+
+import (
+	"fmt"
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the messages in query.proto
+const (
+	protoQueryVersion    protowire.Number = 1
+	protoQueryIntent     protowire.Number = 2
+	protoQueryExpression protowire.Number = 3
+	protoQueryDirectives protowire.Number = 4
+	protoQueryCollection protowire.Number = 5
+	protoQueryOptions    protowire.Number = 6
+
+	protoIntentCount    protowire.Number = 1
+	protoIntentDistinct protowire.Number = 2
+	protoIntentWhere    protowire.Number = 3
+
+	protoDirectiveName  protowire.Number = 1
+	protoDirectiveValue protowire.Number = 2
+
+	protoNodeType     protowire.Number = 1
+	protoNodeChildren protowire.Number = 2
+	protoNodeChild    protowire.Number = 3
+	protoNodeField    protowire.Number = 4
+	protoNodeValue    protowire.Number = 5
+	protoNodeSubQuery protowire.Number = 6
+	protoNodeTerms    protowire.Number = 7
+	protoNodeQuoted   protowire.Number = 8
+	protoNodeLanguage protowire.Number = 9
+	protoNodePattern  protowire.Number = 10
+	protoNodeModifier protowire.Number = 11
+
+	protoValueKind  protowire.Number = 1
+	protoValueText  protowire.Number = 2
+	protoValueTerms protowire.Number = 3
+
+	protoSubQueryCollection protowire.Number = 1
+	protoSubQueryWhere      protowire.Number = 2
+)
+
+// protoNodeTypes and protoValueKinds map the Node.Type and Value.Kind enums of query.proto to the
+// encoded schema, indexed by enum number
+var (
+	protoNodeTypes  = []string{"", nodeOr, nodeAnd, nodeNot, nodeGroup, nodeField, nodeText, nodeRegex}
+	protoValueKinds = []string{"", valueTerms, valueString, valueSingleString, valueBracketed, valueDateTime, valueTime, valueRegex, valueType, valueCast}
+)
+
+// maxProtoNodeDepth bounds how deeply Node messages may nest before decoding gives up. Each level of
+// MaxNestingDepth takes at most three nested nodes (a group, its OR and its AND), so deeper input
+// always exceeds MaxNestingDepth.
+const maxProtoNodeDepth = 3 * (MaxNestingDepth + 1)
+
+// MarshalProto encodes the query as a bsonic.lucene.v1.Query protobuf message, defined in query.proto,
+// so services in other languages can inspect it. Source positions are not encoded.
+func (q *ParticipleQuery) MarshalProto() ([]byte, error) {
+	return appendProtoQuery(nil, encodeQuery(q)), nil
+}
+
+// UnmarshalProto decodes a bsonic.lucene.v1.Query protobuf message, such as one built by a service in
+// another language. Like UnmarshalJSON, it rejects unknown versions, node types and value kinds, and
+// expressions nesting deeper than MaxNestingDepth.
+func (q *ParticipleQuery) UnmarshalProto(data []byte) error {
+	in, err := consumeProtoQuery(data)
+	if err != nil {
+		return err
+	}
+	decoded, err := decodeQuery(in)
+	if err != nil {
+		return err
+	}
+	*q = *decoded
+	return nil
+}
+
+func appendProtoQuery(b []byte, q *encodedQuery) []byte {
+	b = appendProtoVarint(b, protoQueryVersion, uint64(q.Version))
+	if q.Intent != nil {
+		var intent []byte
+		intent = appendProtoBool(intent, protoIntentCount, q.Intent.Count)
+		intent = appendProtoString(intent, protoIntentDistinct, q.Intent.Distinct)
+		intent = appendProtoBool(intent, protoIntentWhere, q.Intent.Where)
+		b = appendProtoMessage(b, protoQueryIntent, intent)
+	}
+	if q.Expression != nil {
+		b = appendProtoMessage(b, protoQueryExpression, appendProtoNode(nil, q.Expression))
+	}
+	for _, d := range q.Directives {
+		var directive []byte
+		directive = appendProtoString(directive, protoDirectiveName, d.Name)
+		directive = appendProtoString(directive, protoDirectiveValue, d.Value)
+		b = appendProtoMessage(b, protoQueryDirectives, directive)
+	}
+	b = appendProtoString(b, protoQueryCollection, q.Collection)
+	for _, o := range q.Options {
+		var option []byte
+		option = appendProtoString(option, protoDirectiveName, o.Name)
+		option = appendProtoString(option, protoDirectiveValue, o.Value)
+		b = appendProtoMessage(b, protoQueryOptions, option)
+	}
+	return b
+}
+
+func appendProtoNode(b []byte, node *encodedNode) []byte {
+	b = appendProtoVarint(b, protoNodeType, uint64(protoEnum(protoNodeTypes, node.Type)))
+	for _, child := range node.Children {
+		b = appendProtoMessage(b, protoNodeChildren, appendProtoNode(nil, child))
+	}
+	if node.Child != nil {
+		b = appendProtoMessage(b, protoNodeChild, appendProtoNode(nil, node.Child))
+	}
+	b = appendProtoString(b, protoNodeField, node.Field)
+	if node.Value != nil {
+		b = appendProtoMessage(b, protoNodeValue, appendProtoValue(nil, node.Value))
+	}
+	if node.SubQuery != nil {
+		var subQuery []byte
+		subQuery = appendProtoString(subQuery, protoSubQueryCollection, node.SubQuery.Collection)
+		subQuery = appendProtoMessage(subQuery, protoSubQueryWhere, appendProtoNode(nil, node.SubQuery.Where))
+		b = appendProtoMessage(b, protoNodeSubQuery, subQuery)
+	}
+	b = appendProtoStrings(b, protoNodeTerms, node.Terms)
+	if node.Quoted != nil {
+		b = appendProtoMessage(b, protoNodeQuoted, appendProtoValue(nil, node.Quoted))
+	}
+	b = appendProtoString(b, protoNodeLanguage, node.Language)
+	b = appendProtoString(b, protoNodePattern, node.Pattern)
+	return appendProtoString(b, protoNodeModifier, node.Modifier)
+}
+
+func appendProtoValue(b []byte, v *encodedValue) []byte {
+	b = appendProtoVarint(b, protoValueKind, uint64(protoEnum(protoValueKinds, v.Kind)))
+	b = appendProtoString(b, protoValueText, v.Text)
+	return appendProtoStrings(b, protoValueTerms, v.Terms)
+}
+
+// protoEnum returns the enum number of name, or 0 (unspecified) when it has none
+func protoEnum(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return 0
+}
+
+// appendProtoVarint, appendProtoBool and appendProtoString leave out zero values, as proto3 does
+func appendProtoVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendProtoBool(b []byte, num protowire.Number, v bool) []byte {
+	return appendProtoVarint(b, num, protowire.EncodeBool(v))
+}
+
+func appendProtoString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendProtoStrings(b []byte, num protowire.Number, values []string) []byte {
+	for _, s := range values {
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendString(b, s)
+	}
+	return b
+}
+
+func appendProtoMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func consumeProtoQuery(b []byte) (*encodedQuery, error) {
+	q := &encodedQuery{}
+	err := consumeProtoFields(b, func(num protowire.Number, field *protoField) error {
+		switch num {
+		case protoQueryVersion:
+			v, err := field.varint()
+			q.Version = int(v)
+			return err
+		case protoQueryIntent:
+			msg, err := field.bytes()
+			if err != nil {
+				return err
+			}
+			q.Intent, err = consumeProtoIntent(msg)
+			return err
+		case protoQueryExpression:
+			msg, err := field.bytes()
+			if err != nil {
+				return err
+			}
+			q.Expression, err = consumeProtoNode(msg, 1)
+			return err
+		case protoQueryDirectives:
+			msg, err := field.bytes()
+			if err != nil {
+				return err
+			}
+			directive, err := consumeProtoDirective(msg)
+			q.Directives = append(q.Directives, directive)
+			return err
+		case protoQueryCollection:
+			var err error
+			q.Collection, err = field.string()
+			return err
+		case protoQueryOptions:
+			msg, err := field.bytes()
+			if err != nil {
+				return err
+			}
+			option, err := consumeProtoDirective(msg)
+			q.Options = append(q.Options, option)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func consumeProtoIntent(b []byte) (*encodedIntent, error) {
+	intent := &encodedIntent{}
+	err := consumeProtoFields(b, func(num protowire.Number, field *protoField) (err error) {
+		switch num {
+		case protoIntentCount:
+			intent.Count, err = field.bool()
+		case protoIntentDistinct:
+			intent.Distinct, err = field.string()
+		case protoIntentWhere:
+			intent.Where, err = field.bool()
+		}
+		return err
+	})
+	return intent, err
+}
+
+func consumeProtoDirective(b []byte) (encodedDirective, error) {
+	var directive encodedDirective
+	err := consumeProtoFields(b, func(num protowire.Number, field *protoField) (err error) {
+		switch num {
+		case protoDirectiveName:
+			directive.Name, err = field.string()
+		case protoDirectiveValue:
+			directive.Value, err = field.string()
+		}
+		return err
+	})
+	return directive, err
+}
+
+func consumeProtoNode(b []byte, depth int) (*encodedNode, error) {
+	if depth > maxProtoNodeDepth {
+		return nil, ErrNestingDepth
+	}
+
+	node := &encodedNode{}
+	err := consumeProtoFields(b, func(num protowire.Number, field *protoField) error {
+		switch num {
+		case protoNodeType:
+			v, err := field.varint()
+			node.Type = protoEnumName(protoNodeTypes, v)
+			return err
+		case protoNodeChildren, protoNodeChild:
+			msg, err := field.bytes()
+			if err != nil {
+				return err
+			}
+			child, err := consumeProtoNode(msg, depth+1)
+			if num == protoNodeChild {
+				node.Child = child
+			} else {
+				node.Children = append(node.Children, child)
+			}
+			return err
+		case protoNodeField:
+			v, err := field.string()
+			node.Field = v
+			return err
+		case protoNodeValue, protoNodeQuoted:
+			msg, err := field.bytes()
+			if err != nil {
+				return err
+			}
+			value, err := consumeProtoValue(msg)
+			if num == protoNodeQuoted {
+				node.Quoted = value
+			} else {
+				node.Value = value
+			}
+			return err
+		case protoNodeSubQuery:
+			msg, err := field.bytes()
+			if err != nil {
+				return err
+			}
+			node.SubQuery, err = consumeProtoSubQuery(msg, depth)
+			return err
+		case protoNodeTerms:
+			v, err := field.string()
+			node.Terms = append(node.Terms, v)
+			return err
+		case protoNodeLanguage:
+			v, err := field.string()
+			node.Language = v
+			return err
+		case protoNodePattern:
+			v, err := field.string()
+			node.Pattern = v
+			return err
+		case protoNodeModifier:
+			v, err := field.string()
+			node.Modifier = v
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func consumeProtoValue(b []byte) (*encodedValue, error) {
+	value := &encodedValue{}
+	err := consumeProtoFields(b, func(num protowire.Number, field *protoField) error {
+		switch num {
+		case protoValueKind:
+			v, err := field.varint()
+			value.Kind = protoEnumName(protoValueKinds, v)
+			return err
+		case protoValueText:
+			v, err := field.string()
+			value.Text = v
+			return err
+		case protoValueTerms:
+			v, err := field.string()
+			value.Terms = append(value.Terms, v)
+			return err
+		}
+		return nil
+	})
+	return value, err
+}
+
+func consumeProtoSubQuery(b []byte, depth int) (*encodedSubQuery, error) {
+	subQuery := &encodedSubQuery{}
+	err := consumeProtoFields(b, func(num protowire.Number, field *protoField) error {
+		switch num {
+		case protoSubQueryCollection:
+			v, err := field.string()
+			subQuery.Collection = v
+			return err
+		case protoSubQueryWhere:
+			msg, err := field.bytes()
+			if err != nil {
+				return err
+			}
+			subQuery.Where, err = consumeProtoNode(msg, depth+1)
+			return err
+		}
+		return nil
+	})
+	return subQuery, err
+}
+
+// protoEnumName returns the schema name of an enum number. Numbers the schema does not know,
+// including 0 (unspecified), keep their number so decoding reports them.
+func protoEnumName(names []string, v uint64) string {
+	if v > 0 && v < uint64(len(names)) {
+		return names[v]
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// protoField is the wire type and remaining input of a field whose tag was just consumed.
+// Its accessors consume the value and record how many bytes they used.
+type protoField struct {
+	num  protowire.Number
+	typ  protowire.Type
+	data []byte
+	n    int
+}
+
+func (f *protoField) varint() (uint64, error) {
+	if f.typ != protowire.VarintType {
+		return 0, f.wireTypeError()
+	}
+	v, n := protowire.ConsumeVarint(f.data)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	f.n = n
+	return v, nil
+}
+
+func (f *protoField) bool() (bool, error) {
+	v, err := f.varint()
+	return protowire.DecodeBool(v), err
+}
+
+func (f *protoField) bytes() ([]byte, error) {
+	if f.typ != protowire.BytesType {
+		return nil, f.wireTypeError()
+	}
+	v, n := protowire.ConsumeBytes(f.data)
+	if n < 0 {
+		return nil, protowire.ParseError(n)
+	}
+	f.n = n
+	return v, nil
+}
+
+func (f *protoField) string() (string, error) {
+	v, err := f.bytes()
+	return string(v), err
+}
+
+func (f *protoField) wireTypeError() error {
+	return fmt.Errorf("invalid encoded query: field %d has wire type %d", f.num, f.typ)
+}
+
+// consumeProtoFields calls fn for each field of a message. Fields fn does not consume are skipped,
+// so messages from newer schemas with added fields still decode.
+func consumeProtoFields(b []byte, fn func(num protowire.Number, field *protoField) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		field := protoField{num: num, typ: typ, data: b}
+		if err := fn(num, &field); err != nil {
+			return err
+		}
+		if field.n == 0 {
+			field.n = protowire.ConsumeFieldValue(num, typ, b)
+			if field.n < 0 {
+				return protowire.ParseError(field.n)
+			}
+		}
+		b = b[field.n:]
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package lucene
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// punctuation maps the curly quotes, full-width colons and parentheses, and non-breaking and ideographic spaces
+// that word processors and chat apps substitute when text is typed or pasted to the ASCII characters of the syntax
+var punctuation = map[rune]rune{
+	'“': '"', '”': '"', '„': '"', '‟': '"', '＂': '"',
+	'‘': '\'', '’': '\'', '‚': '\'', '‛': '\'', '＇': '\'',
+	'：': ':', '（': '(', '）': ')',
+	'\u00a0': ' ', '\u2007': ' ', '\u202f': ' ', '\u3000': ' ',
+}
+
+// NormalizePunctuation replaces curly quotes, full-width colons and parentheses and non-breaking spaces with
+// their ASCII forms, so name:“john doe” pasted from a document parses the same as name:"john doe".
+// A character escaped with a backslash, such as \“, is kept, to match it literally, and so are the characters
+// of a string quoted with ASCII quotes, such as "a：b", which is always matched as written.
+func NormalizePunctuation(query string) string {
+	if !strings.ContainsFunc(query, isPunctuation) {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query))
+	escaped := false
+	for i := 0; i < len(query); {
+		r, size := utf8.DecodeRuneInString(query[i:])
+		if (r == '"' || r == '\'') && !escaped && quoteStart(b.String()) {
+			if end := closingQuote(query, i+size, byte(r)); end >= 0 {
+				b.WriteString(query[i : end+1])
+				i = end + 1
+				continue
+			}
+		}
+
+		if ascii, ok := punctuation[r]; ok && !escaped {
+			r = ascii
+		}
+		escaped = !escaped && r == '\\'
+		b.WriteRune(r)
+		i += size
+	}
+	return b.String()
+}
+
+// isPunctuation reports whether NormalizePunctuation replaces a character
+func isPunctuation(r rune) bool {
+	_, ok := punctuation[r]
+	return ok
+}
+
+// quoteStart reports whether a quote following the normalized text before it starts a quoted string, as it does
+// at the start of a term, after a colon, parenthesis or pipe, and after a - or + prefix in those places
+func quoteStart(before string) bool {
+	r, size := utf8.DecodeLastRuneInString(before)
+	if r == '-' || r == '+' {
+		before = before[:len(before)-size]
+		r, _ = utf8.DecodeLastRuneInString(before)
+	}
+	return before == "" || unicode.IsSpace(r) || strings.ContainsRune(":()[]|", r)
+}
+
+// closingQuote returns the offset of the quote closing a quoted string whose text starts at offset start,
+// skipping quotes escaped with a backslash, or -1 when the string is never closed
+func closingQuote(query string, start int, quote byte) int {
+	for i := start; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			i++
+		case quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// QuoteValue quotes a value so it parses back to the same literal string. Characters NormalizePunctuation
+// would replace, such as curly quotes, are written as \u escapes, so the quoted value keeps them even where
+// it is spliced into a query after other text.
+func QuoteValue(value string) string {
+	quoted := strconv.Quote(value)
+	if !strings.ContainsFunc(quoted, isPunctuation) {
+		return quoted
+	}
+
+	var b strings.Builder
+	b.Grow(len(quoted) + 8)
+	for _, r := range quoted {
+		if isPunctuation(r) {
+			fmt.Fprintf(&b, `\u%04x`, r)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
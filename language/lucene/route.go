@@ -0,0 +1,45 @@
+package lucene
+
+import "github.com/alecthomas/participle/v2/lexer"
+
+// routeKeywords are the field names that name a collection in a routing prefix, as in in:orders status:pending
+var routeKeywords = []string{"in", "collection", "index"}
+
+// route replaces a routing prefix at the start of a query with a single Route token holding the collection.
+// A prefix is only read as routing when another clause follows it without an operator, as in
+// in:orders status:pending; on its own or joined with AND or OR, as in index:5 AND x:1, it is a field clause.
+func (d *prefixLexer) route(tokens []lexer.Token) []lexer.Token {
+	// The prefix may follow query options such as @include_deleted
+	start := 0
+	for start < len(tokens) && (tokens[start].Type == d.symbols["Whitespace"] || d.isOption(tokens[start])) {
+		start++
+	}
+	// The keyword, colon, collection and whitespace, then the start of the next clause
+	if start+4 >= len(tokens) {
+		return tokens
+	}
+	keyword, colon, collection, space := tokens[start], tokens[start+1], tokens[start+2], tokens[start+3]
+	if keyword.Type != d.symbols["TextTerm"] || !isRouteKeyword(keyword.Value) ||
+		colon.Type != d.symbols["Colon"] || collection.Type != d.symbols["TextTerm"] || space.Type != d.symbols["Whitespace"] {
+		return tokens
+	}
+	switch tokens[start+4].Type {
+	case d.symbols["AND"], d.symbols["OR"], d.symbols["Pipe"], d.symbols["RParen"], lexer.EOF:
+		return tokens
+	}
+
+	out := make([]lexer.Token, 0, len(tokens)-2)
+	out = append(out, tokens[:start]...)
+	out = append(out, lexer.Token{Type: d.symbols["Route"], Value: collection.Value, Pos: keyword.Pos})
+	return append(out, tokens[start+3:]...)
+}
+
+// isRouteKeyword reports whether a field name is one of the routeKeywords
+func isRouteKeyword(name string) bool {
+	for _, keyword := range routeKeywords {
+		if name == keyword {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package lucene
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Unparse converts an AST back into a query string that parses to an equivalent AST.
+// Source positions are not preserved, and whitespace is normalized to single spaces.
+func Unparse(q *ParticipleQuery) string {
+	var b strings.Builder
+
+	for _, option := range q.Options {
+		if b.Len() > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString("@" + option.Name)
+		if option.Value != "" {
+			b.WriteString(":" + option.Value)
+		}
+	}
+
+	if q.Collection != "" {
+		if b.Len() > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString("in:" + EscapeField(q.Collection))
+	}
+
+	if q.Intent != nil {
+		if b.Len() > 0 {
+			b.WriteString(" ")
+		}
+		if q.Intent.Count {
+			b.WriteString("COUNT")
+		} else if q.Intent.Distinct != nil {
+			b.WriteString("DISTINCT " + EscapeField(*q.Intent.Distinct))
+		}
+		if q.Intent.Where {
+			b.WriteString(" WHERE")
+		}
+	}
+
+	if q.Expression != nil {
+		if b.Len() > 0 {
+			b.WriteString(" ")
+		}
+		writeExpression(&b, q.Expression)
+	}
+
+	for _, directive := range q.Directives {
+		if b.Len() > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString("| " + directive.Name + ":" + directive.Value)
+	}
+
+	return b.String()
+}
+
+// writeExpression writes the OR branches of an expression
+func writeExpression(b *strings.Builder, expr *ParticipleExpression) {
+	for i, andExpr := range expr.Or {
+		if i > 0 {
+			b.WriteString(" OR ")
+		}
+		for j, operand := range andExpr.And {
+			if j > 0 {
+				b.WriteString(" AND ")
+			}
+			writeOperand(b, operand)
+		}
+	}
+}
+
+// writeOperand writes an operand with its NOT prefixes and modifier
+func writeOperand(b *strings.Builder, operand *ParticipleOperand) {
+	for operand.Not != nil {
+		b.WriteString("NOT ")
+		operand = operand.Not
+	}
+
+	term := operand.Term
+	switch {
+	case term.FieldValue != nil:
+		writeFieldValue(b, term.FieldValue)
+	case term.FreeText != nil:
+		writeFreeText(b, term.FreeText)
+	case term.Group != nil:
+		b.WriteString("(")
+		writeExpression(b, term.Group.Expression)
+		b.WriteString(")")
+	}
+	if term.Modifier != nil {
+		b.WriteString(*term.Modifier)
+	}
+}
+
+// writeFieldValue writes a field:value pair, a nested group or an IN_QUERY subquery
+func writeFieldValue(b *strings.Builder, fv *ParticipleFieldValue) {
+	b.WriteString(EscapeField(fv.Field) + ":")
+
+	if fv.Nested != nil {
+		b.WriteString("{")
+		writeExpression(b, fv.Nested.Expression)
+		b.WriteString("}")
+		return
+	}
+	if fv.SubQuery != nil {
+		b.WriteString("IN_QUERY(" + fv.SubQuery.Collection + " WHERE ")
+		writeExpression(b, fv.SubQuery.Expression)
+		b.WriteString(")")
+		return
+	}
+
+	v := fv.Value
+	switch {
+	case len(v.TextTerms) > 0:
+		b.WriteString(strings.Join(v.TextTerms, " "))
+	case v.String != nil:
+		b.WriteString(quote(*v.String, '"'))
+	case v.SingleString != nil:
+		b.WriteString(quote(*v.SingleString, '\''))
+	case v.Bracketed != nil:
+		b.WriteString(*v.Bracketed)
+	case v.DateTime != nil:
+		b.WriteString(*v.DateTime)
+	case v.TimeString != nil:
+		b.WriteString(*v.TimeString)
+	case v.Regex != nil:
+		b.WriteString(*v.Regex)
+	case v.TypeCheck != nil:
+		b.WriteString("TYPE(" + strings.Join(v.TypeNames(), ", ") + ")")
+	case v.Cast != nil:
+		b.WriteString(*v.Cast)
+	}
+}
+
+// writeFreeText writes quoted, unquoted or regex free text
+func writeFreeText(b *strings.Builder, ft *ParticipleFreeText) {
+	switch {
+	case ft.QuotedValue != nil:
+		qv := ft.QuotedValue
+		if qv.String != nil {
+			b.WriteString(quote(*qv.String, '"'))
+		} else if qv.SingleString != nil {
+			b.WriteString(quote(*qv.SingleString, '\''))
+		}
+		if qv.Language != nil {
+			b.WriteString(*qv.Language)
+		}
+	case ft.UnquotedValue != nil:
+		b.WriteString(strings.Join(ft.UnquotedValue.TextTerms, " "))
+	case ft.RegexValue != nil:
+		b.WriteString(*ft.RegexValue)
+	}
+}
+
+// quote quotes s with the given quote character, escaping it the way the lexer's Unquote reverses
+func quote(s string, q byte) string {
+	quoted := strconv.Quote(s)
+	if q == '"' {
+		return quoted
+	}
+
+	// Go only escapes double quotes; single-quoted strings must escape single quotes instead
+	inner := quoted[1 : len(quoted)-1]
+	inner = strings.ReplaceAll(inner, `\"`, `"`)
+	inner = strings.ReplaceAll(inner, `'`, `\'`)
+	return "'" + inner + "'"
+}
@@ -0,0 +1,120 @@
+package lucene
+
+import (
+	"fmt"
+
+	"github.com/alecthomas/participle/v2/lexer"
+)
+
+// ParticipleValueGroup represents values of one field combined in parentheses, e.g. price:(>=10 AND <=20)
+// or status:(active OR pending). Parse expands value groups into field clauses, so parsed queries never
+// hold them.
+type ParticipleValueGroup struct {
+	Expression *ParticipleValueExpression `"(" @@ ")"`
+}
+
+// ParticipleValueExpression handles OR operations between grouped values
+type ParticipleValueExpression struct {
+	Or []*ParticipleValueAndExpression `@@ ( "OR" @@ )*`
+}
+
+// ParticipleValueAndExpression handles AND operations between grouped values
+type ParticipleValueAndExpression struct {
+	And []*ParticipleValueOperand `@@ ( "AND" @@ )*`
+}
+
+// ParticipleValueOperand is a grouped value, a negated one, or values in further parentheses
+type ParticipleValueOperand struct {
+	Pos    lexer.Position
+	EndPos lexer.Position
+
+	Not   *ParticipleValueOperand    `"NOT" @@`
+	Group *ParticipleValueExpression `| "(" @@ ")"`
+	Value *ParticipleValue           `| @@`
+}
+
+// expandValueGroups replaces every value group in a query, as in price:(>=10 AND <=20), with a group of
+// clauses on its field, here (price:>=10 AND price:<=20), so comparisons on the same field merge into one
+// range like they do when written out
+func expandValueGroups(q *ParticipleQuery) error {
+	if q.Expression == nil {
+		return nil
+	}
+	return expandValueGroupsIn(q.Expression)
+}
+
+func expandValueGroupsIn(expr *ParticipleExpression) error {
+	for _, andExpr := range expr.Or {
+		for _, operand := range andExpr.And {
+			for operand.Not != nil {
+				operand = operand.Not
+			}
+			if err := expandValueGroupTerm(operand.Term); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func expandValueGroupTerm(term *ParticipleTerm) error {
+	switch {
+	case term.Group != nil:
+		return expandValueGroupsIn(term.Group.Expression)
+	case term.FieldValue == nil:
+		return nil
+	case term.FieldValue.Nested != nil:
+		return expandValueGroupsIn(term.FieldValue.Nested.Expression)
+	case term.FieldValue.SubQuery != nil:
+		return expandValueGroupsIn(term.FieldValue.SubQuery.Expression)
+	case term.FieldValue.ValueGroup != nil:
+		expr, err := valueGroupExpression(term.FieldValue.Field, term.FieldValue.ValueGroup.Expression)
+		if err != nil {
+			return err
+		}
+		term.FieldValue, term.Group = nil, &ParticipleGroup{Expression: expr}
+	}
+	return nil
+}
+
+// valueGroupExpression converts grouped values into clauses on the group's field
+func valueGroupExpression(field string, values *ParticipleValueExpression) (*ParticipleExpression, error) {
+	expr := &ParticipleExpression{}
+	for _, valueAnd := range values.Or {
+		andExpr := &ParticipleAndExpression{}
+		for _, value := range valueAnd.And {
+			operand, err := valueGroupOperand(field, value)
+			if err != nil {
+				return nil, err
+			}
+			andExpr.And = append(andExpr.And, operand)
+		}
+		expr.Or = append(expr.Or, andExpr)
+	}
+	return expr, nil
+}
+
+func valueGroupOperand(field string, value *ParticipleValueOperand) (*ParticipleOperand, error) {
+	switch {
+	case value.Not != nil:
+		not, err := valueGroupOperand(field, value.Not)
+		if err != nil {
+			return nil, err
+		}
+		return &ParticipleOperand{Not: not}, nil
+	case value.Group != nil:
+		expr, err := valueGroupExpression(field, value.Group)
+		if err != nil {
+			return nil, err
+		}
+		return &ParticipleOperand{Term: &ParticipleTerm{Group: &ParticipleGroup{Expression: expr}}}, nil
+	}
+
+	// Outside a group, name:john doe searches doe as free text; inside one that reading would be a surprise
+	if len(value.Value.TextTerms) > 1 {
+		return nil, fmt.Errorf("%d:%d: values in %s:(...) must be joined with AND or OR, or quoted as a phrase",
+			value.Pos.Line, value.Pos.Column, field)
+	}
+	fv := &ParticipleFieldValue{Pos: value.Pos, EndPos: value.EndPos, Field: field, Value: value.Value}
+	return &ParticipleOperand{Term: &ParticipleTerm{FieldValue: fv}}, nil
+}
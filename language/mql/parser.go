@@ -0,0 +1,90 @@
+// Package mql provides a MongoDB query language front-end that accepts raw filter documents.
+package mql
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Query is the AST produced by the MQL parser: an already-structured filter document.
+type Query struct {
+	Filter bson.M
+}
+
+// allowedOperators lists the query operators accepted in MQL input.
+// Server-side JavaScript operators such as $where, $function and $accumulator are intentionally absent.
+var allowedOperators = map[string]bool{
+	"$and": true, "$or": true, "$nor": true, "$not": true,
+	"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true,
+	"$in": true, "$nin": true, "$exists": true, "$type": true,
+	"$regex": true, "$options": true, "$elemMatch": true, "$size": true, "$all": true, "$mod": true,
+	"$text": true, "$search": true, "$language": true, "$caseSensitive": true, "$diacriticSensitive": true,
+}
+
+// ErrUnsupportedOperator is matched by errors for operators outside the allowed set
+var ErrUnsupportedOperator = errors.New("unsupported MQL operator")
+
+// Parser represents a MongoDB query language parser.
+type Parser struct{}
+
+// New creates a new MQL parser instance.
+func New() *Parser {
+	return &Parser{}
+}
+
+// Parse parses a MongoDB filter written as JSON or extended JSON into a Query.
+func (p *Parser) Parse(query string) (interface{}, error) {
+	vr, err := bson.NewExtJSONValueReader(strings.NewReader(query), false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQL filter: %v", err)
+	}
+
+	dec := bson.NewDecoder(vr)
+	dec.DefaultDocumentM()
+
+	var filter bson.M
+	if err := dec.Decode(&filter); err != nil {
+		return nil, fmt.Errorf("invalid MQL filter: %v", err)
+	}
+
+	if err := validateOperators(filter); err != nil {
+		return nil, err
+	}
+
+	return &Query{Filter: filter}, nil
+}
+
+// validateOperators walks the filter and rejects any operator outside the allowed set, any field name containing NUL
+// and any $and, $or or $nor whose operand is not an array of filter documents.
+func validateOperators(value interface{}) error {
+	switch v := value.(type) {
+	case bson.M:
+		for key, child := range v {
+			if strings.HasPrefix(key, "$") && !allowedOperators[key] {
+				return fmt.Errorf("%w: %s", ErrUnsupportedOperator, key)
+			}
+			if strings.ContainsRune(key, 0) {
+				return fmt.Errorf("invalid MQL filter: field name %q contains NUL", key)
+			}
+			if bsonfilter.IsLogical(key) {
+				if _, err := bsonfilter.LogicalClauses(key, child); err != nil {
+					return fmt.Errorf("invalid MQL filter: %w", err)
+				}
+			}
+			if err := validateOperators(child); err != nil {
+				return err
+			}
+		}
+	case bson.A:
+		for _, child := range v {
+			if err := validateOperators(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package bsonic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/config"
+)
+
+// Warning reports a clause or directive dropped from a query parsed with lenient errors, or a warning
+// the formatter returned with its result.
+type Warning struct {
+	// Clause is the dropped query text, including any NOT or prefix operator; it is empty for formatter warnings
+	Clause string
+	// Err is the error the clause failed with, or the formatter's warning
+	Err error
+}
+
+func (w Warning) String() string {
+	if w.Clause == "" {
+		return w.Err.Error()
+	}
+	return fmt.Sprintf("ignored %q: %v", w.Clause, w.Err)
+}
+
+// lenientClause is a top-level clause of a Lucene query and the operator joining it to the previous clause
+type lenientClause struct {
+	connector string
+	text      string
+}
+
+// recover handles a failed parse. With lenient errors, a syntax error is recovered from by parsing
+// the query clause by clause and dropping the clauses that fail; other errors are returned unchanged.
+func (p *Parser) recover(query string, defaultFields []string, format formatFunc, err error) (*ParseResult, error) {
+	if !p.Config.LenientErrors || p.Config.Language != config.LanguageLucene || !isRecoverable(err) {
+		return nil, err
+	}
+
+	clauses, directives := splitClauses(p.normalize(query), p.Config.LowercaseOperators)
+	var kept []lenientClause
+	var keptDirectives []string
+	var warnings []Warning
+	result := p.emptyResult()
+
+	// Add clauses one at a time, keeping each one the query still parses with
+	for _, clause := range clauses {
+		candidate := append(kept[:len(kept):len(kept)], clause)
+		parsed, err := p.parseCandidate(joinClauses(candidate, nil), defaultFields, format)
+		if err != nil {
+			if !isRecoverable(err) {
+				return nil, err
+			}
+			warnings = append(warnings, Warning{Clause: clause.text, Err: err})
+			continue
+		}
+		kept, result = candidate, parsed
+	}
+
+	for _, directive := range directives {
+		candidate := append(keptDirectives[:len(keptDirectives):len(keptDirectives)], directive)
+		parsed, err := p.parseCandidate(joinClauses(kept, candidate), defaultFields, format)
+		if err != nil {
+			if !isRecoverable(err) {
+				return nil, err
+			}
+			warnings = append(warnings, Warning{Clause: directive, Err: err})
+			continue
+		}
+		keptDirectives, result = candidate, parsed
+	}
+
+	result.Warnings = append(warnings, result.Warnings...)
+	return result, nil
+}
+
+// parseCandidate parses and formats a query built from the clauses kept so far
+func (p *Parser) parseCandidate(query string, defaultFields []string, format formatFunc) (*ParseResult, error) {
+	return guard(func() (*ParseResult, error) {
+		if strings.TrimSpace(query) == "" {
+			return p.emptyResult(), nil
+		}
+		ast, err := p.parseLanguage(query)
+		if err != nil {
+			return nil, err
+		}
+		return p.formatResult(ast, format)
+	})
+}
+
+// isRecoverable reports whether an error is confined to the clauses of a query, so dropping them can recover.
+// Disallowed fields, exceeded limits and unsupported queries are never ignored.
+func isRecoverable(err error) bool {
+	return errors.Is(classify(err), ErrSyntax)
+}
+
+// splitClauses splits a Lucene query into its top-level clauses, joined by AND, OR or a prefix operator,
+// and its directives. Operators inside parentheses, brackets and quotes do not split, so a group is one clause.
+// With lowercase operators, the words and and or split in any case.
+func splitClauses(query string, lowercaseOperators bool) ([]lenientClause, []string) {
+	var clauses []lenientClause
+	var directives []string
+	connector := ""
+	start := 0
+	depth := 0
+	var quote byte
+	inBracket := false
+
+	flush := func(end int) {
+		if text := strings.TrimSpace(query[start:end]); text != "" {
+			clauses = append(clauses, lenientClause{connector: connector, text: text})
+		}
+	}
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		wordStart := i == 0 || isSpaceByte(query[i-1])
+
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\\':
+			i++
+		case inBracket:
+			inBracket = c != ']'
+		case (c == '"' || c == '\'') && (wordStart || strings.IndexByte("(:-+", query[i-1]) >= 0):
+			quote = c
+		case c == '[':
+			inBracket = true
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth > 0 {
+				depth--
+			}
+		case depth > 0:
+		case c == '|':
+			flush(i)
+			for _, directive := range strings.Split(query[i+1:], "|") {
+				if directive = strings.TrimSpace(directive); directive != "" {
+					directives = append(directives, directive)
+				}
+			}
+			return clauses, directives
+		case wordStart && (keywordAt(query, i, "AND", lowercaseOperators) || keywordAt(query, i, "OR", lowercaseOperators)):
+			flush(i)
+			connector = "AND"
+			if c == 'O' || c == 'o' {
+				connector = "OR"
+			}
+			i += len(connector) - 1
+			start = i + 1
+		case wordStart && isPrefixOperator(query, i) && !endsWithNot(query[start:i]):
+			// role:admin -status:banned is an implicit AND, so the prefixed operand is a clause of its own
+			if strings.TrimSpace(query[start:i]) != "" {
+				flush(i)
+				connector = ""
+				start = i
+			}
+		}
+	}
+	flush(len(query))
+	return clauses, directives
+}
+
+// joinClauses rebuilds a query from clauses and directives, dropping the operator before the first clause
+func joinClauses(clauses []lenientClause, directives []string) string {
+	var b strings.Builder
+	for i, clause := range clauses {
+		if i > 0 {
+			b.WriteString(" ")
+			if clause.connector != "" {
+				b.WriteString(clause.connector + " ")
+			}
+		}
+		b.WriteString(clause.text)
+	}
+	for _, directive := range directives {
+		b.WriteString(" | " + directive)
+	}
+	return b.String()
+}
+
+// keywordAt reports whether the word at index i of query is keyword, in any case when anyCase is set
+func keywordAt(query string, i int, keyword string, anyCase bool) bool {
+	end := i + len(keyword)
+	if end > len(query) {
+		return false
+	}
+	word := query[i:end]
+	matches := word == keyword || anyCase && strings.EqualFold(word, keyword)
+	return matches && (end == len(query) || isSpaceByte(query[end]) || query[end] == '(')
+}
+
+// isPrefixOperator reports whether a + or - at index i of query is a prefix operator rather than part of a value like -5
+func isPrefixOperator(query string, i int) bool {
+	if (query[i] != '-' && query[i] != '+') || i+1 >= len(query) {
+		return false
+	}
+	next := query[i+1]
+	return !isSpaceByte(next) && strings.IndexByte("0123456789.-+", next) < 0
+}
+
+// endsWithNot reports whether text ends with a NOT operator, which applies to the operand that follows
+func endsWithNot(text string) bool {
+	fields := strings.Fields(text)
+	return len(fields) > 0 && fields[len(fields)-1] == "NOT"
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,42 @@
+package bsonic
+
+import "github.com/kyle-williams-1/bsonic/language/lucene"
+
+// LintWarning is a non-fatal style suggestion for a query, with the rule it breaks and the span it applies to.
+type LintWarning = lucene.LintWarning
+
+// LintRule names a style rule checked by Lint.
+type LintRule = lucene.LintRule
+
+const (
+	// LintRedundantParentheses flags parentheses that do not change how a query is grouped, such as (name:john)
+	LintRedundantParentheses = lucene.LintRedundantParentheses
+	// LintMixedOperators flags queries mixing the +term and -term prefix operators with AND, OR and NOT
+	LintMixedOperators = lucene.LintMixedOperators
+	// LintUnanchoredRegex flags regexes and wildcards without literal text at their start, such as /.*son/ or *son
+	LintUnanchoredRegex = lucene.LintUnanchoredRegex
+	// LintDeprecatedSyntax flags the classic Lucene operators && and !, which are searched as text
+	LintDeprecatedSyntax = lucene.LintDeprecatedSyntax
+)
+
+// Lint checks a query with the default parser; see Parser.Lint.
+func Lint(query string) ([]LintWarning, error) {
+	return New().Lint(query)
+}
+
+// Lint parses a Lucene query and returns non-fatal style suggestions for it, such as redundant parentheses,
+// mixed prefix and keyword operators, regexes that cannot use an index and deprecated syntax, for saved query
+// editors. A query that does not parse returns the parse error instead. Spans refer to the normalized query.
+func (p *Parser) Lint(query string) ([]LintWarning, error) {
+	p, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	luceneParser, ok := p.languageParser.(*lucene.Parser)
+	if !ok {
+		return nil, unsupportedf("linting needs the Lucene language")
+	}
+	return guard(func() ([]LintWarning, error) {
+		return luceneParser.Lint(p.normalize(query))
+	})
+}
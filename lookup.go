@@ -0,0 +1,154 @@
+package bsonic
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// lookupAliasPrefix prefixes the temporary fields that hold looked-up documents.
+const lookupAliasPrefix = "_lookup_"
+
+// applyForeignRefs adds a $lookup stage for every declared foreign reference used beneath
+// a dotted path in the filter or sort, and rewrites those paths onto the looked-up documents.
+func (p *Parser) applyForeignRefs(result *ParseResult) {
+	if len(p.Config.ForeignRefs) == 0 {
+		return
+	}
+
+	used := map[string]bool{}
+	_ = walkFilterFields(result.Filter, func(field string) error {
+		if ref := p.foreignRefFor(field); ref != "" {
+			used[ref] = true
+		}
+		return nil
+	})
+	for _, key := range result.Sort {
+		if ref := p.foreignRefFor(key.Key); ref != "" {
+			used[ref] = true
+		}
+	}
+	if len(used) == 0 {
+		return
+	}
+
+	refs := make([]string, 0, len(used))
+	for ref := range used {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	for _, name := range refs {
+		ref := p.Config.ForeignRefs[name]
+		localField := ref.LocalField
+		if localField == "" {
+			localField = name
+		}
+		foreignField := ref.ForeignField
+		if foreignField == "" {
+			foreignField = "_id"
+		}
+
+		result.LookupStages = append(result.LookupStages, bson.M{"$lookup": bson.M{
+			"from":         ref.From,
+			"localField":   localField,
+			"foreignField": foreignField,
+			"as":           lookupAlias(name),
+		}})
+	}
+
+	rename := func(field string) string {
+		if ref := p.foreignRefFor(field); ref != "" {
+			return lookupAlias(ref) + strings.TrimPrefix(field, ref)
+		}
+		return field
+	}
+	result.Filter = renameFilterFields(result.Filter, rename)
+	for i, key := range result.Sort {
+		result.Sort[i].Key = rename(key.Key)
+	}
+}
+
+// foreignRefFor returns the longest declared foreign reference a dotted field path goes through, or "".
+func (p *Parser) foreignRefFor(field string) string {
+	match := ""
+	for name := range p.Config.ForeignRefs {
+		if strings.HasPrefix(field, name+".") && len(name) > len(match) {
+			match = name
+		}
+	}
+	return match
+}
+
+// lookupAlias returns the temporary field holding the documents looked up for a foreign reference.
+func lookupAlias(ref string) string {
+	return lookupAliasPrefix + strings.ReplaceAll(ref, ".", "_")
+}
+
+// lookupAliases returns the temporary fields created by $lookup stages.
+func lookupAliases(stages []bson.M) []string {
+	var aliases []string
+	for _, stage := range stages {
+		if lookup, ok := stage["$lookup"].(bson.M); ok {
+			if as, ok := lookup["as"].(string); ok {
+				aliases = append(aliases, as)
+			}
+		}
+	}
+	return aliases
+}
+
+// renameFilterFields returns a copy of a filter with every field name passed through rename,
+// descending into the sub-filters of logical operators. A field renamed to one the filter already has
+// is ANDed with it rather than replacing it.
+func renameFilterFields(filter bson.M, rename func(string) string) bson.M {
+	renamed := bson.M{}
+	var collided []bson.M
+	// Keys are visited in order, so which of two colliding conditions moves to the $and is deterministic
+	for _, key := range sortedKeys(filter) {
+		value := filter[key]
+		if !strings.HasPrefix(key, "$") {
+			field := rename(key)
+			if _, ok := renamed[field]; ok {
+				collided = append(collided, bson.M{field: value})
+			} else {
+				renamed[field] = value
+			}
+			continue
+		}
+
+		switch v := value.(type) {
+		case []bson.M:
+			docs := make([]bson.M, len(v))
+			for i, doc := range v {
+				docs[i] = renameFilterFields(doc, rename)
+			}
+			renamed[key] = docs
+		case bson.A:
+			renamed[key] = bson.A(renameFilterArray(v, rename))
+		case []interface{}:
+			renamed[key] = renameFilterArray(v, rename)
+		default:
+			renamed[key] = value
+		}
+	}
+	if len(collided) > 0 {
+		renamed["$and"] = append(bsonfilter.Clauses(renamed["$and"]), collided...)
+	}
+	return renamed
+}
+
+// renameFilterArray renames the fields of the filter documents in a generic array.
+func renameFilterArray(values []interface{}, rename func(string) string) []interface{} {
+	renamed := make([]interface{}, len(values))
+	for i, value := range values {
+		if doc, ok := value.(bson.M); ok {
+			renamed[i] = renameFilterFields(doc, rename)
+		} else {
+			renamed[i] = value
+		}
+	}
+	return renamed
+}
@@ -0,0 +1,22 @@
+// Package metrics defines the instrumentation interface the parser reports parse outcomes to.
+package metrics
+
+import "time"
+
+// Error kinds reported to ParseFailed.
+const (
+	KindSyntax          = "syntax"
+	KindUnsupported     = "unsupported"
+	KindLimitExceeded   = "limit_exceeded"
+	KindDisallowedField = "disallowed_field"
+	KindResolver        = "resolver"
+)
+
+// Metrics receives the outcome of every parse, for capacity monitoring.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ParseCompleted records a successful parse with its duration and the number of clauses in the filter
+	ParseCompleted(duration time.Duration, clauses int)
+	// ParseFailed records a failed parse with its duration and error kind, one of the Kind constants
+	ParseFailed(duration time.Duration, kind string)
+}
@@ -0,0 +1,69 @@
+// Package prometheus provides a Prometheus adapter for parser metrics.
+package prometheus
+
+import (
+	"time"
+
+	"github.com/kyle-williams-1/bsonic/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics records parse outcomes as Prometheus counters and histograms:
+//
+//   - bsonic_parses_total: parses by result ("success" or "error")
+//   - bsonic_parse_errors_total: failed parses by error kind
+//   - bsonic_parse_duration_seconds: parse duration
+//   - bsonic_parse_clauses: clauses in successfully parsed filters
+type Metrics struct {
+	parses   *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration prometheus.Histogram
+	clauses  prometheus.Histogram
+}
+
+var _ metrics.Metrics = (*Metrics)(nil)
+
+// New creates the parser metrics and registers them with the registerer.
+func New(registerer prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		parses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "bsonic_parses_total",
+			Help: "Number of queries parsed, by result.",
+		}, []string{"result"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "bsonic_parse_errors_total",
+			Help: "Number of queries that failed to parse, by error kind.",
+		}, []string{"kind"}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "bsonic_parse_duration_seconds",
+			Help:    "Time taken to parse and format a query.",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}),
+		clauses: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "bsonic_parse_clauses",
+			Help:    "Number of field clauses in parsed filters.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 8),
+		}),
+	}
+
+	for _, collector := range []prometheus.Collector{m.parses, m.errors, m.duration, m.clauses} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// ParseCompleted records a successful parse.
+func (m *Metrics) ParseCompleted(duration time.Duration, clauses int) {
+	m.parses.WithLabelValues("success").Inc()
+	m.duration.Observe(duration.Seconds())
+	m.clauses.Observe(float64(clauses))
+}
+
+// ParseFailed records a failed parse.
+func (m *Metrics) ParseFailed(duration time.Duration, kind string) {
+	m.parses.WithLabelValues("error").Inc()
+	m.errors.WithLabelValues(kind).Inc()
+	m.duration.Observe(duration.Seconds())
+}
@@ -0,0 +1,40 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kyle-williams-1/bsonic/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestMetrics tests that parse outcomes are recorded in the registered collectors
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m, err := New(registry)
+	if err != nil {
+		t.Fatalf("New should not return error, got: %v", err)
+	}
+
+	m.ParseCompleted(time.Millisecond, 3)
+	m.ParseCompleted(time.Millisecond, 1)
+	m.ParseFailed(time.Millisecond, metrics.KindSyntax)
+
+	if got := testutil.ToFloat64(m.parses.WithLabelValues("success")); got != 2 {
+		t.Errorf("Expected 2 successful parses, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.parses.WithLabelValues("error")); got != 1 {
+		t.Errorf("Expected 1 failed parse, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.errors.WithLabelValues(metrics.KindSyntax)); got != 1 {
+		t.Errorf("Expected 1 syntax error, got %v", got)
+	}
+	if got := testutil.CollectAndCount(registry, "bsonic_parse_duration_seconds", "bsonic_parse_clauses"); got != 2 {
+		t.Errorf("Expected duration and clause histograms, got %d metrics", got)
+	}
+
+	if _, err := New(registry); err == nil {
+		t.Error("Expected error registering the metrics twice")
+	}
+}
@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// UsageRecorder receives the fields and operators of every successful parse, for finding the fields worth
+// indexing and the schema fields no query uses. Implementations must be safe for concurrent use.
+type UsageRecorder interface {
+	// QueryUsed records the fields and operators a parsed query uses
+	QueryUsed(usage QueryUsage)
+}
+
+// QueryUsage lists the fields and operators of a parsed query. Fields are schema paths, without array indexes.
+type QueryUsage struct {
+	// Conditions are the field conditions of the filter, including those under logical operators
+	Conditions []FieldCondition
+	// Operators lists every operator of the filter, including $and, $or and $nor, once per use
+	Operators []string
+	// Sorted lists the sort keys
+	Sorted []string
+	// Projected lists the projected fields, other than _id
+	Projected []string
+}
+
+// FieldCondition is a filter condition on a field.
+type FieldCondition struct {
+	Field string
+	// Operators are the operators of the condition, or $eq for an equality match
+	Operators []string
+}
+
+// UsageCollector is a UsageRecorder that aggregates usage in memory, for dumping with Stats.
+type UsageCollector struct {
+	mu    sync.Mutex
+	stats UsageStats
+}
+
+var _ UsageRecorder = (*UsageCollector)(nil)
+
+// UsageStats aggregates the usage of the queries a UsageCollector recorded. It encodes to JSON with stable
+// lower camel case keys.
+type UsageStats struct {
+	// Queries is the number of queries recorded
+	Queries int `json:"queries"`
+	// Fields maps each field the queries used to its usage
+	Fields map[string]FieldUsage `json:"fields"`
+	// Operators counts the uses of each operator
+	Operators map[string]int `json:"operators"`
+}
+
+// FieldUsage counts the uses of a field.
+type FieldUsage struct {
+	// Filtered is the number of filter conditions on the field
+	Filtered int `json:"filtered"`
+	// Sorted is the number of queries sorting by the field
+	Sorted int `json:"sorted"`
+	// Projected is the number of queries projecting the field
+	Projected int `json:"projected"`
+	// Operators counts the operators of the conditions on the field, with $eq for equality matches
+	Operators map[string]int `json:"operators,omitempty"`
+}
+
+// NewUsageCollector creates an empty usage collector.
+func NewUsageCollector() *UsageCollector {
+	c := &UsageCollector{}
+	c.Reset()
+	return c
+}
+
+// QueryUsed adds a query's usage to the collected stats.
+func (c *UsageCollector) QueryUsed(usage QueryUsage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Queries++
+	for _, condition := range usage.Conditions {
+		c.update(condition.Field, func(u *FieldUsage) {
+			u.Filtered++
+			if u.Operators == nil {
+				u.Operators = map[string]int{}
+			}
+			for _, operator := range condition.Operators {
+				u.Operators[operator]++
+			}
+		})
+	}
+	for _, field := range usage.Sorted {
+		c.update(field, func(u *FieldUsage) { u.Sorted++ })
+	}
+	for _, field := range usage.Projected {
+		c.update(field, func(u *FieldUsage) { u.Projected++ })
+	}
+	for _, operator := range usage.Operators {
+		c.stats.Operators[operator]++
+	}
+}
+
+// update changes the usage of a field
+func (c *UsageCollector) update(field string, fn func(u *FieldUsage)) {
+	u := c.stats.Fields[field]
+	fn(&u)
+	c.stats.Fields[field] = u
+}
+
+// Stats returns a copy of the collected stats.
+func (c *UsageCollector) Stats() UsageStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := UsageStats{
+		Queries:   c.stats.Queries,
+		Fields:    make(map[string]FieldUsage, len(c.stats.Fields)),
+		Operators: make(map[string]int, len(c.stats.Operators)),
+	}
+	for field, u := range c.stats.Fields {
+		if u.Operators != nil {
+			operators := make(map[string]int, len(u.Operators))
+			for operator, count := range u.Operators {
+				operators[operator] = count
+			}
+			u.Operators = operators
+		}
+		stats.Fields[field] = u
+	}
+	for operator, count := range c.stats.Operators {
+		stats.Operators[operator] = count
+	}
+	return stats
+}
+
+// Reset clears the collected stats, such as after dumping them.
+func (c *UsageCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats = UsageStats{Fields: map[string]FieldUsage{}, Operators: map[string]int{}}
+}
+
+// Unused returns the given fields, such as the fields of a schema, that no recorded query used, in order.
+// A field is used when a query used it or a field nested beneath it.
+func (s UsageStats) Unused(fields ...string) []string {
+	var unused []string
+	for _, field := range fields {
+		if !s.used(field) {
+			unused = append(unused, field)
+		}
+	}
+	slices.Sort(unused)
+	return unused
+}
+
+// used reports whether a recorded query used a field or a field nested beneath it
+func (s UsageStats) used(field string) bool {
+	for name := range s.Fields {
+		if name == field || strings.HasPrefix(name, field+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+// Package migrate reports how the BSON generated for a query corpus changes between output versions,
+// configs or releases, and how MongoDB's query plans change with it.
+package migrate
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic"
+	"github.com/kyle-williams-1/bsonic/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Difference is a query whose output differs between two versions.
+type Difference struct {
+	Query string
+	// From and To are the filters generated by each version, nil when that version failed
+	From bson.M
+	To   bson.M
+	// FromErr and ToErr are the errors returned by each version
+	FromErr error
+	ToErr   error
+}
+
+// QueryParser is one side of a comparison. *bsonic.Parser implements it, and so does a wrapper around
+// another bsonic release imported under a different module path.
+type QueryParser interface {
+	Parse(query string) (bson.M, error)
+}
+
+// Compare parses every query with the config pinned to each output version and returns the queries
+// whose filter or error differs, in corpus order. The config itself is not modified.
+func Compare(cfg *config.Config, from, to int, queries []string) ([]Difference, error) {
+	fromParser, err := versionedParser(cfg, from)
+	if err != nil {
+		return nil, err
+	}
+	toParser, err := versionedParser(cfg, to)
+	if err != nil {
+		return nil, err
+	}
+	return CompareParsers(fromParser, toParser, queries), nil
+}
+
+// CompareParsers parses every query with both parsers and returns the queries whose filter or error
+// differs, in corpus order. Use it to compare two configs, or a release against a candidate.
+func CompareParsers(from, to QueryParser, queries []string) []Difference {
+	var differences []Difference
+	for _, query := range queries {
+		fromFilter, fromErr := from.Parse(query)
+		toFilter, toErr := to.Parse(query)
+
+		if reflect.DeepEqual(fromFilter, toFilter) && errorText(fromErr) == errorText(toErr) {
+			continue
+		}
+		differences = append(differences, Difference{
+			Query:   query,
+			From:    fromFilter,
+			To:      toFilter,
+			FromErr: fromErr,
+			ToErr:   toErr,
+		})
+	}
+	return differences
+}
+
+// ReadCorpus reads one query per line, skipping blank lines and # comments. Golden test files
+// in the `query => expected` format are accepted; the expected output is ignored.
+func ReadCorpus(r io.Reader) ([]string, error) {
+	var queries []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		query, _, _ := strings.Cut(line, " => ")
+		queries = append(queries, strings.TrimSpace(query))
+	}
+	return queries, scanner.Err()
+}
+
+// versionedParser creates a parser from a copy of the config pinned to an output version
+func versionedParser(cfg *config.Config, version int) (*bsonic.Parser, error) {
+	pinned := *cfg
+	pinned.OutputVersion = version
+	// The legacy flag would otherwise force version 1 output on both sides
+	pinned.LegacyTextCompat = false
+	return bsonic.NewWithConfig(&pinned)
+}
+
+// errorText returns the message of an error, or "" for nil
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
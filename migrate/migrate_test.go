@@ -0,0 +1,193 @@
+package migrate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kyle-williams-1/bsonic"
+	"github.com/kyle-williams-1/bsonic/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// TestCompare tests that only queries whose output changes between versions are reported
+func TestCompare(t *testing.T) {
+	cfg := config.Default().WithDefaultFields([]string{"name"})
+	queries := []string{"name:john", "name:John Doe", "age:[18 TO 65]"}
+
+	differences, err := Compare(cfg, config.OutputVersion1, config.OutputVersion2, queries)
+	if err != nil {
+		t.Fatalf("Compare should not return error, got: %v", err)
+	}
+	if len(differences) != 1 {
+		t.Fatalf("Expected 1 difference, got %d: %+v", len(differences), differences)
+	}
+
+	diff := differences[0]
+	if diff.Query != "name:John Doe" {
+		t.Errorf("Expected difference for name:John Doe, got %s", diff.Query)
+	}
+	if diff.From["$text"] == nil {
+		t.Errorf("Expected version 1 to use $text, got %v", diff.From)
+	}
+	if _, ok := diff.To["$or"]; !ok {
+		t.Errorf("Expected version 2 to use $or, got %v", diff.To)
+	}
+	if cfg.OutputVersion != 0 {
+		t.Errorf("Expected config not to be modified, got version %d", cfg.OutputVersion)
+	}
+}
+
+// TestCompareLogicalNormalization tests that version 3 reports the queries whose logical structure it normalizes
+func TestCompareLogicalNormalization(t *testing.T) {
+	cfg := config.Default().WithDefaultFields([]string{"name"})
+	queries := []string{"name:john", "name:john OR name:jane", "age:>=18 AND age:<65"}
+
+	differences, err := Compare(cfg, config.OutputVersion2, config.OutputVersion3, queries)
+	if err != nil {
+		t.Fatalf("Compare should not return error, got: %v", err)
+	}
+	if len(differences) != 2 {
+		t.Fatalf("Expected 2 differences, got %d: %+v", len(differences), differences)
+	}
+	if !equalFilters(differences[0].To, bson.M{"name": bson.M{"$in": []interface{}{"john", "jane"}}}) {
+		t.Errorf("Unexpected version 3 filter: %v", differences[0].To)
+	}
+	if !reflect.DeepEqual(differences[1].To, bson.M{"age": bson.M{"$gte": 18.0, "$lt": 65.0}}) {
+		t.Errorf("Unexpected version 3 filter: %v", differences[1].To)
+	}
+}
+
+// TestCompareErrors tests that a query failing in only one version is reported
+func TestCompareErrors(t *testing.T) {
+	differences, err := Compare(config.Default(), config.OutputVersion1, config.OutputVersion2, []string{"john"})
+	if err != nil {
+		t.Fatalf("Compare should not return error, got: %v", err)
+	}
+	if len(differences) != 1 || differences[0].FromErr != nil || differences[0].ToErr == nil {
+		t.Fatalf("Expected version 2 alone to fail without default fields, got %+v", differences)
+	}
+	if !equalFilters(differences[0].From, bson.M{"$text": bson.M{"$search": "john"}}) {
+		t.Errorf("Unexpected version 1 filter: %v", differences[0].From)
+	}
+
+	if _, err := Compare(config.Default(), 0, 99, nil); err == nil {
+		t.Error("Expected error for an unsupported output version")
+	}
+}
+
+// TestReadCorpus tests reading plain and golden corpus files
+func TestReadCorpus(t *testing.T) {
+	corpus := "# comment\n\nname:john\nage:30 => {\"age\":30.0}\n"
+	queries, err := ReadCorpus(strings.NewReader(corpus))
+	if err != nil {
+		t.Fatalf("ReadCorpus should not return error, got: %v", err)
+	}
+	if len(queries) != 2 || queries[0] != "name:john" || queries[1] != "age:30" {
+		t.Fatalf("Unexpected queries: %q", queries)
+	}
+}
+
+// TestCompareParsers tests comparing two differently configured parsers
+func TestCompareParsers(t *testing.T) {
+	from, err := bsonic.NewWithConfig(config.Default().WithDefaultFields([]string{"name"}))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+	to, err := bsonic.NewWithConfig(config.Default().WithDefaultFields([]string{"name"}).WithMaxClauses(1))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	differences := CompareParsers(from, to, []string{"name:john", "name:john AND age:30"})
+	if len(differences) != 1 || differences[0].Query != "name:john AND age:30" {
+		t.Fatalf("Expected only the two-clause query to differ, got %+v", differences)
+	}
+	if differences[0].FromErr != nil || !errors.Is(differences[0].ToErr, bsonic.ErrLimitExceeded) {
+		t.Errorf("Expected the clause maximum to reject only the candidate, got %v and %v", differences[0].FromErr, differences[0].ToErr)
+	}
+}
+
+// TestSummarizePlan tests reading classic and slot-based engine explain output
+func TestSummarizePlan(t *testing.T) {
+	classic := bson.D{
+		{Key: "queryPlanner", Value: bson.D{{Key: "winningPlan", Value: bson.D{
+			{Key: "stage", Value: "FETCH"},
+			{Key: "inputStage", Value: bson.D{{Key: "stage", Value: "IXSCAN"}, {Key: "indexName", Value: "name_1"}}},
+		}}}},
+		{Key: "executionStats", Value: bson.D{
+			{Key: "nReturned", Value: int32(2)},
+			{Key: "totalKeysExamined", Value: int32(3)},
+			{Key: "totalDocsExamined", Value: int64(2)},
+		}},
+	}
+	plan := mustSummarize(t, classic)
+	expected := &Plan{Stages: []string{"FETCH", "IXSCAN"}, Indexes: []string{"name_1"}, KeysExamined: 3, DocsExamined: 2, Returned: 2}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, plan)
+	}
+	if plan.CollectionScan() {
+		t.Error("Expected an index scan not to be a collection scan")
+	}
+
+	sbe := bson.D{{Key: "queryPlanner", Value: bson.D{{Key: "winningPlan", Value: bson.D{{Key: "queryPlan", Value: bson.D{
+		{Key: "stage", Value: "OR"},
+		{Key: "inputStages", Value: bson.A{bson.D{{Key: "stage", Value: "COLLSCAN"}}, bson.D{{Key: "stage", Value: "COLLSCAN"}}}},
+	}}}}}}}
+	plan = mustSummarize(t, sbe)
+	if !reflect.DeepEqual(plan.Stages, []string{"OR", "COLLSCAN", "COLLSCAN"}) || !plan.CollectionScan() {
+		t.Errorf("Expected the nested query plan's stages, got %+v", plan)
+	}
+}
+
+// TestWriteReport tests that plan changes and new collection scans are marked
+func TestWriteReport(t *testing.T) {
+	results := []ShadowResult{
+		{
+			Difference: Difference{Query: "name:*son", From: bson.M{"name": "son"}, To: bson.M{"name": bson.M{"$regex": "son$"}}},
+			FromPlan:   &Plan{Stages: []string{"FETCH", "IXSCAN"}, Indexes: []string{"name_1"}, Returned: 1},
+			ToPlan:     &Plan{Stages: []string{"COLLSCAN"}, DocsExamined: 100, Returned: 4},
+		},
+		{
+			Difference: Difference{Query: "age:30", From: bson.M{"age": 30.0}, ToErr: errors.New("limit exceeded")},
+			FromPlan:   &Plan{Stages: []string{"COLLSCAN"}},
+		},
+	}
+
+	var b strings.Builder
+	if err := WriteReport(&b, results); err != nil {
+		t.Fatalf("WriteReport should not return error, got: %v", err)
+	}
+	report := b.String()
+	for _, expected := range []string{
+		"name:*son [plan changed] [new collection scan]",
+		"FETCH > IXSCAN (name_1) keys=0 docs=0 returned=1",
+		`{"name":{"$regex":"son$"}}`,
+		"age:30 [plan changed]\n",
+		"to:   error: limit exceeded",
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("Expected report to contain %q, got:\n%s", expected, report)
+		}
+	}
+}
+
+func mustSummarize(t *testing.T, output bson.D) *Plan {
+	t.Helper()
+	raw, err := bson.Marshal(output)
+	if err != nil {
+		t.Fatalf("Marshal should not return error, got: %v", err)
+	}
+	plan, err := summarizePlan(raw)
+	if err != nil {
+		t.Fatalf("summarizePlan should not return error, got: %v", err)
+	}
+	return plan
+}
+
+func equalFilters(a, b bson.M) bool {
+	x, _ := bson.Marshal(a)
+	y, _ := bson.Marshal(b)
+	return string(x) == string(y)
+}
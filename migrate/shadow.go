@@ -0,0 +1,190 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	mongodriver "go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Plan summarizes the winning plan and execution statistics MongoDB reports when explaining a filter.
+type Plan struct {
+	// Stages are the winning plan's stages from the root down, such as FETCH then IXSCAN
+	Stages []string
+	// Indexes are the names of the indexes the winning plan scans, in stage order
+	Indexes []string
+	// KeysExamined, DocsExamined and Returned are the executionStats totals
+	KeysExamined int64
+	DocsExamined int64
+	Returned     int64
+}
+
+// CollectionScan reports whether the plan reads every document instead of using an index
+func (p *Plan) CollectionScan() bool {
+	for _, stage := range p.Stages {
+		if stage == "COLLSCAN" {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the stages and statistics of the plan on one line
+func (p *Plan) String() string {
+	stages := strings.Join(p.Stages, " > ")
+	if len(p.Indexes) > 0 {
+		stages += " (" + strings.Join(p.Indexes, ", ") + ")"
+	}
+	return fmt.Sprintf("%s keys=%d docs=%d returned=%d", stages, p.KeysExamined, p.DocsExamined, p.Returned)
+}
+
+// ShadowResult is a query whose output differs between two parsers, with the plan MongoDB chose for each
+// filter. A plan is nil when its side failed to parse or MongoDB rejected the filter, as reported by the
+// plan error.
+type ShadowResult struct {
+	Difference
+	FromPlan    *Plan
+	ToPlan      *Plan
+	FromPlanErr error
+	ToPlanErr   error
+}
+
+// PlanChanged reports whether the two filters use different stages or indexes, or return a different
+// number of documents
+func (r ShadowResult) PlanChanged() bool {
+	if r.FromPlan == nil || r.ToPlan == nil {
+		return r.FromPlan != r.ToPlan || errorText(r.FromPlanErr) != errorText(r.ToPlanErr)
+	}
+	return strings.Join(r.FromPlan.Stages, ",") != strings.Join(r.ToPlan.Stages, ",") ||
+		strings.Join(r.FromPlan.Indexes, ",") != strings.Join(r.ToPlan.Indexes, ",") ||
+		r.FromPlan.Returned != r.ToPlan.Returned
+}
+
+// Shadow compares two parsers over a corpus like CompareParsers, then explains both filters of every
+// differing query against a collection with executionStats verbosity, so a parser change can be checked
+// against production data and indexes before rollout. Queries with identical output are not executed.
+// The explained queries run in full, so point it at a replica or a copy of the collection.
+func Shadow(ctx context.Context, coll *mongodriver.Collection, from, to QueryParser, queries []string) ([]ShadowResult, error) {
+	differences := CompareParsers(from, to, queries)
+	results := make([]ShadowResult, 0, len(differences))
+	for _, difference := range differences {
+		result := ShadowResult{Difference: difference}
+		if difference.FromErr == nil {
+			result.FromPlan, result.FromPlanErr = explain(ctx, coll, difference.From)
+		}
+		if difference.ToErr == nil {
+			result.ToPlan, result.ToPlanErr = explain(ctx, coll, difference.To)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// WriteReport writes each shadow result with its filters and plans, marking plan changes and new
+// collection scans, which are the regressions most likely to need an index or a query rewrite
+func WriteReport(w io.Writer, results []ShadowResult) error {
+	for _, r := range results {
+		marks := ""
+		if r.PlanChanged() {
+			marks += " [plan changed]"
+		}
+		if r.ToPlan != nil && r.ToPlan.CollectionScan() && (r.FromPlan == nil || !r.FromPlan.CollectionScan()) {
+			marks += " [new collection scan]"
+		}
+		if _, err := fmt.Fprintf(w, "%s%s\n  from: %s\n  to:   %s\n", r.Query, marks,
+			describe(r.From, r.FromErr, r.FromPlan, r.FromPlanErr), describe(r.To, r.ToErr, r.ToPlan, r.ToPlanErr)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describe returns one side of a shadow result: its filter and plan, or the error that stopped it
+func describe(filter bson.M, err error, plan *Plan, planErr error) string {
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	text := fmt.Sprintf("%v", filter)
+	if data, jsonErr := bson.MarshalExtJSON(filter, false, false); jsonErr == nil {
+		text = string(data)
+	}
+	switch {
+	case planErr != nil:
+		return text + "\n        explain error: " + planErr.Error()
+	case plan != nil:
+		return text + "\n        " + plan.String()
+	}
+	return text
+}
+
+// explain runs the explain command for a find with the filter and summarizes the result
+func explain(ctx context.Context, coll *mongodriver.Collection, filter bson.M) (*Plan, error) {
+	command := bson.D{
+		{Key: "explain", Value: bson.D{{Key: "find", Value: coll.Name()}, {Key: "filter", Value: filter}}},
+		{Key: "verbosity", Value: "executionStats"},
+	}
+	output, err := coll.Database().RunCommand(ctx, command).Raw()
+	if err != nil {
+		return nil, err
+	}
+	return summarizePlan(output)
+}
+
+// explainOutput is the part of explain output a Plan summarizes
+type explainOutput struct {
+	QueryPlanner struct {
+		WinningPlan planStage `bson:"winningPlan"`
+	} `bson:"queryPlanner"`
+	ExecutionStats struct {
+		TotalKeysExamined int64 `bson:"totalKeysExamined"`
+		TotalDocsExamined int64 `bson:"totalDocsExamined"`
+		NReturned         int64 `bson:"nReturned"`
+	} `bson:"executionStats"`
+}
+
+// planStage is a stage of a winning plan. Slot-based engine plans nest the stage tree under queryPlan.
+type planStage struct {
+	Stage       string      `bson:"stage"`
+	IndexName   string      `bson:"indexName"`
+	InputStage  *planStage  `bson:"inputStage"`
+	InputStages []planStage `bson:"inputStages"`
+	QueryPlan   *planStage  `bson:"queryPlan"`
+}
+
+// summarizePlan extracts the winning plan's stages and indexes and the execution totals from explain output
+func summarizePlan(output bson.Raw) (*Plan, error) {
+	var decoded explainOutput
+	if err := bson.Unmarshal(output, &decoded); err != nil {
+		return nil, fmt.Errorf("cannot read explain output: %w", err)
+	}
+	stats := decoded.ExecutionStats
+	plan := &Plan{KeysExamined: stats.TotalKeysExamined, DocsExamined: stats.TotalDocsExamined, Returned: stats.NReturned}
+	winning := decoded.QueryPlanner.WinningPlan
+	if winning.QueryPlan != nil {
+		winning = *winning.QueryPlan
+	}
+	plan.walk(winning)
+	return plan, nil
+}
+
+// walk appends a plan stage and its input stages, depth first
+func (p *Plan) walk(stage planStage) {
+	if stage.Stage != "" {
+		p.Stages = append(p.Stages, stage.Stage)
+	}
+	if stage.IndexName != "" {
+		p.Indexes = append(p.Indexes, stage.IndexName)
+	}
+	if stage.InputStage != nil {
+		p.walk(*stage.InputStage)
+	}
+	for _, input := range stage.InputStages {
+		p.walk(input)
+	}
+}
@@ -0,0 +1,107 @@
+package bsonic
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// KeysetSort returns the sort to use with NextPageFilter: the parsed sort keys
+// followed by an ascending _id tiebreaker when _id is not already a sort key.
+func (r *ParseResult) KeysetSort() bson.D {
+	sort := append(bson.D{}, r.Sort...)
+	for _, key := range sort {
+		if key.Key == "_id" {
+			return sort
+		}
+	}
+	return append(sort, bson.E{Key: "_id", Value: 1})
+}
+
+// NextPageFilter builds a keyset-pagination filter that matches the documents following lastDoc
+// in KeysetSort order, combined with the original filter. Results must be sorted with KeysetSort.
+//
+// For a sort of {a: 1, b: -1, _id: 1} the generated condition is
+// {$or: [{a: {$gt: a0}}, {a: a0, b: {$lt: b0}}, {a: a0, b: b0, _id: {$gt: id0}}]}.
+func (r *ParseResult) NextPageFilter(lastDoc bson.M) (bson.M, error) {
+	sort := r.KeysetSort()
+
+	values := make([]interface{}, len(sort))
+	for i, key := range sort {
+		value, ok := lookupPath(lastDoc, key.Key)
+		if !ok {
+			return nil, fmt.Errorf("last document is missing sort field: %s", key.Key)
+		}
+		values[i] = value
+	}
+
+	var clauses []bson.M
+	for i, key := range sort {
+		clause := bson.M{}
+		for j := 0; j < i; j++ {
+			clause[sort[j].Key] = values[j]
+		}
+
+		operator := "$gt"
+		if isDescending(key.Value) {
+			operator = "$lt"
+		}
+		clause[key.Key] = bson.M{operator: values[i]}
+		clauses = append(clauses, clause)
+	}
+
+	keyset := clauses[0]
+	if len(clauses) > 1 {
+		keyset = bson.M{"$or": clauses}
+	}
+
+	if len(r.Filter) == 0 {
+		return keyset, nil
+	}
+	return bson.M{"$and": []bson.M{r.Filter, keyset}}, nil
+}
+
+// isDescending reports whether a sort direction value means descending order.
+func isDescending(direction interface{}) bool {
+	switch d := direction.(type) {
+	case int:
+		return d < 0
+	case int32:
+		return d < 0
+	case int64:
+		return d < 0
+	case float64:
+		return d < 0
+	}
+	return false
+}
+
+// lookupPath resolves a dotted field path within a document.
+func lookupPath(doc bson.M, path string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, segment := range strings.Split(path, ".") {
+		switch v := current.(type) {
+		case bson.M:
+			value, ok := v[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case bson.D:
+			found := false
+			for _, elem := range v {
+				if elem.Key == segment {
+					current, found = elem.Value, true
+					break
+				}
+			}
+			if !found {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
@@ -0,0 +1,361 @@
+package bsonic
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// MaskPolicy decides what happens to the conditions of a query on fields or with operators a role may not use.
+type MaskPolicy string
+
+const (
+	// MaskReject fails the parse with a *FieldError, or an ErrUnsupported error for an operator. It is the default.
+	MaskReject MaskPolicy = "reject"
+	// MaskStrip silently drops the conditions and sort keys a role may not use, as if they were not in the query
+	MaskStrip MaskPolicy = "strip"
+)
+
+// RoleAccess lists the fields and operators the queries of a role may use.
+type RoleAccess struct {
+	// Fields lists the fields the role may filter and sort on, matched like the config's allowed fields, so fields
+	// nested beneath them and their array indexes are visible too. When empty, every field is visible.
+	Fields []string
+	// Operators lists the operators the role may use, such as $regex or $gt. The $and, $or and $nor operators
+	// combining clauses are always allowed. When empty, every operator is allowed.
+	Operators []string
+}
+
+// Permissions maps roles to the fields and operators their queries may use, so a single query endpoint can serve
+// several privilege levels. They are checked after the config's allowlist and forbidden operators, which still apply.
+type Permissions struct {
+	// Roles maps role names to their access
+	Roles map[string]RoleAccess
+	// Policy decides whether conditions a role may not use fail the parse or are stripped; the zero value rejects them
+	Policy MaskPolicy
+}
+
+// access is the combined access of the roles a query is parsed for
+type access struct {
+	// fields are the visible fields, or nil when every field is
+	fields []string
+	// operators are the allowed operators, or nil when every operator is
+	operators map[string]bool
+	strip     bool
+}
+
+// ParseWithPermissions is like ParseDetailedContext, but only lets the query use the fields and operators the given
+// roles may use. A field or operator is usable when any of the roles may use it. Projection and distinct fields the
+// roles may not see always fail the parse, since stripping them would return more than the query asked for.
+func (p *Parser) ParseWithPermissions(ctx context.Context, query string, perms *Permissions, roles ...string) (*ParseResult, error) {
+	p, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	roleAccess, err := perms.access(roles)
+	if err != nil {
+		return nil, err
+	}
+
+	scoped := &Parser{Config: p.Config, languageParser: p.languageParser, formatter: p.formatter, access: roleAccess}
+	return scoped.instrument(ctx, query, func(ctx context.Context) (*ParseResult, error) {
+		scoped := scoped.withSubqueries(ctx)
+		return guard(func() (*ParseResult, error) {
+			return scoped.parseDetailed(ctx, query, scoped.Config.DefaultFields, scoped.formatDefault)
+		})
+	})
+}
+
+// access combines the access of roles, rejecting unknown roles and an unknown policy
+func (perms *Permissions) access(roles []string) (*access, error) {
+	if perms == nil {
+		return nil, unsupportedf("no permissions given")
+	}
+	if len(roles) == 0 {
+		return nil, unsupportedf("no roles given")
+	}
+	if perms.Policy != "" && perms.Policy != MaskReject && perms.Policy != MaskStrip {
+		return nil, unsupportedf("unknown mask policy: %s", perms.Policy)
+	}
+
+	combined := &access{fields: []string{}, operators: map[string]bool{}, strip: perms.Policy == MaskStrip}
+	for _, role := range roles {
+		grant, ok := perms.Roles[role]
+		if !ok {
+			return nil, unsupportedf("unknown role: %s", role)
+		}
+		if len(grant.Fields) == 0 {
+			combined.fields = nil
+		} else if combined.fields != nil {
+			combined.fields = append(combined.fields, grant.Fields...)
+		}
+		if len(grant.Operators) == 0 {
+			combined.operators = nil
+		} else if combined.operators != nil {
+			for _, operator := range grant.Operators {
+				combined.operators[operator] = true
+			}
+		}
+	}
+	return combined, nil
+}
+
+// fieldVisible reports whether the roles may use a field
+func (a *access) fieldVisible(field string) bool {
+	return a.fields == nil || isAllowedField(field, a.fields)
+}
+
+// fieldError returns the error for a field the roles may not see, suggesting the visible fields it may be a typo of
+func (a *access) fieldError(field string) error {
+	return &FieldError{Field: field, Suggestions: suggestFields(field, a.fields)}
+}
+
+// operatorAllowed reports whether the roles may use an operator
+func (a *access) operatorAllowed(operator string) bool {
+	switch operator {
+	case "$and", "$or", "$nor":
+		return true
+	}
+	return a.operators == nil || a.operators[operator]
+}
+
+// conditionError returns the error for a condition the roles may not use, or nil when they may use it
+func (a *access) conditionError(key string, condition interface{}) error {
+	if strings.HasPrefix(key, "$") {
+		if !a.operatorAllowed(key) {
+			return unsupportedf("operator %s is not allowed", key)
+		}
+	} else if !a.fieldVisible(key) {
+		return a.fieldError(key)
+	}
+	if key == "$text" && a.fields != nil {
+		return unsupportedf("$text searches every text-indexed field, which the roles may not all see")
+	}
+
+	var forbidden string
+	walkOperators(condition, func(operator string) {
+		if forbidden == "" && !a.operatorAllowed(operator) {
+			forbidden = operator
+		}
+	})
+	if forbidden != "" {
+		return unsupportedf("operator %s is not allowed", forbidden)
+	}
+	return nil
+}
+
+// applyAccess rejects, or strips with MaskStrip, the conditions, Atlas Search clauses and sort keys of a result the
+// roles may not use. A $text search is never visible to roles limited to some fields, since it searches every
+// text-indexed field. It does nothing for a parse without permissions.
+func (p *Parser) applyAccess(result *ParseResult) error {
+	a := p.access
+	if a == nil {
+		return nil
+	}
+
+	if result.DistinctField != "" && !a.fieldVisible(result.DistinctField) {
+		return a.fieldError(result.DistinctField)
+	}
+	for field := range result.Projection {
+		if field != "_id" && !a.fieldVisible(field) {
+			return a.fieldError(field)
+		}
+	}
+
+	filter, err := a.mask(result.Filter)
+	if err != nil {
+		return err
+	}
+	result.Filter = filter
+
+	stage, err := a.maskSearchStage(result.SearchStage)
+	if err != nil {
+		return err
+	}
+	result.SearchStage = stage
+
+	var sort bson.D
+	for _, key := range result.Sort {
+		if !a.fieldVisible(key.Key) {
+			if !a.strip {
+				return a.fieldError(key.Key)
+			}
+			continue
+		}
+		sort = append(sort, key)
+	}
+	result.Sort = sort
+
+	var highlights []Highlight
+	for _, highlight := range result.Highlights {
+		if highlight.Field == "" || a.fieldVisible(highlight.Field) {
+			highlights = append(highlights, highlight)
+		}
+	}
+	result.Highlights = highlights
+	if !hasTextSearch(result.Filter) {
+		result.TextScoreProjection, result.TextScoreSort = nil, nil
+	}
+	return nil
+}
+
+// mask returns a filter without the conditions the roles may not use, or their error when they are not stripped.
+// Stripped branches of $or and $nor are dropped rather than left empty, since an empty branch would match everything.
+func (a *access) mask(filter bson.M) (bson.M, error) {
+	result := make(bson.M, len(filter))
+	for key, value := range filter {
+		switch key {
+		case "$and", "$or", "$nor":
+			var clauses []bson.M
+			for _, sub := range bsonfilter.Clauses(value) {
+				masked, err := a.mask(sub)
+				if err != nil {
+					return nil, err
+				}
+				if len(masked) > 0 {
+					clauses = append(clauses, masked)
+				}
+			}
+			if len(clauses) > 0 {
+				result[key] = clauses
+			}
+		default:
+			if err := a.conditionError(key, value); err != nil {
+				if !a.strip {
+					return nil, err
+				}
+				continue
+			}
+			result[key] = value
+		}
+	}
+	return result, nil
+}
+
+// maskSearchStage returns an Atlas Search $search stage without the clauses searching fields the roles may not see,
+// or their error when they are not stripped. Clauses searching every indexed field are never visible to roles limited
+// to some fields. It returns nil when every clause is stripped.
+func (a *access) maskSearchStage(stage bson.M) (bson.M, error) {
+	search, ok := stage["$search"].(bson.M)
+	if !ok || a.fields == nil {
+		return stage, nil
+	}
+
+	masked := bson.M{}
+	for key, value := range search {
+		if key == "index" {
+			continue
+		}
+		clause, err := a.maskSearchClause(bson.M{key: value})
+		if err != nil {
+			return nil, err
+		}
+		for operator, body := range clause {
+			masked[operator] = body
+		}
+	}
+	if len(masked) == 0 {
+		return nil, nil
+	}
+	if index, ok := search["index"]; ok {
+		masked["index"] = index
+	}
+	return bson.M{"$search": masked}, nil
+}
+
+// maskSearchClause masks the paths of a single Atlas Search operator, such as {"text": {"query": ..., "path": ...}},
+// recursing into the must, mustNot and should clauses of a compound operator. It returns nil when the clause is stripped.
+func (a *access) maskSearchClause(clause bson.M) (bson.M, error) {
+	masked := bson.M{}
+	for operator, value := range clause {
+		body, ok := value.(bson.M)
+		if !ok {
+			masked[operator] = value
+			continue
+		}
+
+		if operator == "compound" {
+			compound := bson.M{}
+			for occur, sub := range body {
+				clauses, ok := sub.([]bson.M)
+				if !ok {
+					compound[occur] = sub
+					continue
+				}
+				var kept []bson.M
+				for _, sub := range clauses {
+					maskedSub, err := a.maskSearchClause(sub)
+					if err != nil {
+						return nil, err
+					}
+					if maskedSub != nil {
+						kept = append(kept, maskedSub)
+					}
+				}
+				if len(kept) > 0 {
+					compound[occur] = kept
+				}
+			}
+			if _, ok := compound["should"]; !ok {
+				delete(compound, "minimumShouldMatch")
+			}
+			if len(compound) == 0 {
+				return nil, nil
+			}
+			masked[operator] = compound
+			continue
+		}
+
+		path, err := a.maskSearchPath(body["path"])
+		if err != nil {
+			return nil, err
+		}
+		if path == nil {
+			return nil, nil
+		}
+		maskedBody := make(bson.M, len(body))
+		for key, value := range body {
+			maskedBody[key] = value
+		}
+		maskedBody["path"] = path
+		masked[operator] = maskedBody
+	}
+	return masked, nil
+}
+
+// maskSearchPath returns the visible fields of an Atlas Search path, a field name, a list of them or a wildcard,
+// or nil when none are visible and they are stripped
+func (a *access) maskSearchPath(path interface{}) (interface{}, error) {
+	var fields []string
+	switch p := path.(type) {
+	case string:
+		fields = []string{p}
+	case []string:
+		fields = p
+	default:
+		if a.strip {
+			return nil, nil
+		}
+		return nil, unsupportedf("free text searches every indexed field, which the roles may not all see; configure default fields to search")
+	}
+
+	var visible []string
+	for _, field := range fields {
+		if !a.fieldVisible(field) {
+			if !a.strip {
+				return nil, a.fieldError(field)
+			}
+			continue
+		}
+		visible = append(visible, field)
+	}
+	switch len(visible) {
+	case 0:
+		return nil, nil
+	case 1:
+		return visible[0], nil
+	}
+	return visible, nil
+}
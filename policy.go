@@ -0,0 +1,232 @@
+package bsonic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// checkQueryLength rejects a query longer than the configured maximum before it is parsed.
+func (p *Parser) checkQueryLength(query string) error {
+	if maxLength := p.Config.MaxQueryLength; maxLength > 0 && len(query) > maxLength {
+		return &Error{Kind: ErrLimitExceeded, Err: fmt.Errorf("query is %d bytes long; the maximum is %d", len(query), maxLength)}
+	}
+	return nil
+}
+
+// checkPolicy checks a formatted result against the configured clause, limit, path depth and regex maximums,
+// the leading wildcard policy and forbidden operators.
+func (p *Parser) checkPolicy(result *ParseResult) error {
+	if maxClauses := p.Config.MaxClauses; maxClauses > 0 {
+		if count := clauseCount(result.Filter); count > maxClauses {
+			return &Error{Kind: ErrLimitExceeded, Err: fmt.Errorf("query has %d clauses; the maximum is %d", count, maxClauses)}
+		}
+	}
+	if maxLimit := p.Config.MaxLimit; maxLimit > 0 && result.Limit > maxLimit {
+		return &Error{Kind: ErrLimitExceeded, Err: fmt.Errorf("limit %d exceeds the maximum of %d", result.Limit, maxLimit)}
+	}
+	if err := p.checkPathDepth(result); err != nil {
+		return err
+	}
+	if err := p.checkRegexes(result.Filter); err != nil {
+		return err
+	}
+
+	if len(p.Config.ForbiddenOperators) == 0 {
+		return nil
+	}
+	forbidden := map[string]bool{}
+	for _, operator := range p.Config.ForbiddenOperators {
+		forbidden[operator] = true
+	}
+	var found string
+	walkOperators(result.Filter, func(operator string) {
+		if found == "" && forbidden[operator] {
+			found = operator
+		}
+	})
+	if found != "" {
+		return unsupportedf("operator %s is not allowed", found)
+	}
+	return nil
+}
+
+// checkQueryOptions rejects the @ options of a query the config does not allow. @include_deleted is also rejected
+// under the strict API policy and in parses scoped by roles, whose users must not see soft-deleted documents.
+func (p *Parser) checkQueryOptions(options QueryOptions) error {
+	var used []string
+	if options.IncludeDeleted {
+		used = append(used, config.QueryOptionIncludeDeleted)
+	}
+	if options.CaseSensitive {
+		used = append(used, config.QueryOptionCaseSensitive)
+	}
+	if options.Limit > 0 {
+		used = append(used, config.QueryOptionLimit)
+	}
+	for _, option := range used {
+		if !p.Config.QueryOptionAllowed(option) {
+			return unsupportedf("query option @%s is not allowed", option)
+		}
+	}
+	if options.IncludeDeleted && (p.Config.Policy == config.PolicyStrictAPI || p.access != nil) {
+		return unsupportedf("query option @%s is not allowed for untrusted queries", config.QueryOptionIncludeDeleted)
+	}
+	return nil
+}
+
+// checkPathDepth rejects a filter, sort, projection or distinct field with more segments than the configured maximum.
+func (p *Parser) checkPathDepth(result *ParseResult) error {
+	maxDepth := p.Config.MaxPathDepth
+	if maxDepth <= 0 {
+		return nil
+	}
+
+	check := func(field string) error {
+		if depth := strings.Count(field, ".") + 1; depth > maxDepth {
+			return &Error{Kind: ErrLimitExceeded, Err: fmt.Errorf("field path %s has %d segments; the maximum is %d", field, depth, maxDepth)}
+		}
+		return nil
+	}
+	if err := walkFilterFields(result.Filter, check); err != nil {
+		return err
+	}
+	if result.DistinctField != "" {
+		if err := check(result.DistinctField); err != nil {
+			return err
+		}
+	}
+	for _, key := range result.Sort {
+		if err := check(key.Key); err != nil {
+			return err
+		}
+	}
+	for field := range result.Projection {
+		if err := check(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRegexes rejects a filter with more regex conditions than the configured maximum, or, when leading
+// wildcards are rejected, a regex without literal text at its start. The errors suggest a cheaper query.
+func (p *Parser) checkRegexes(filter bson.M) error {
+	maxRegexes := p.Config.MaxRegexClauses
+	if maxRegexes <= 0 && !p.Config.RejectLeadingWildcards {
+		return nil
+	}
+
+	count := 0
+	var leading error
+	walkRegexes(filter, func(field, pattern string) {
+		count++
+		if leading == nil && p.Config.RejectLeadingWildcards && isLeadingWildcard(pattern) {
+			leading = unsupportedf("the pattern %q on %s starts with a wildcard, which cannot use an index; "+
+				"start it with literal text, as in john* rather than *john", pattern, field)
+		}
+	})
+	if leading != nil {
+		return leading
+	}
+	if maxRegexes > 0 && count > maxRegexes {
+		return &Error{Kind: ErrLimitExceeded, Err: fmt.Errorf("query has %d regex clauses; the maximum is %d. "+
+			"Use exact values instead of wildcards or regexes, or search fewer terms", count, maxRegexes)}
+	}
+	return nil
+}
+
+// walkRegexes calls visit with the field and pattern of every regex condition in a filter, descending into
+// logical operators and into $not, $in, $nin and $elemMatch conditions.
+func walkRegexes(filter bson.M, visit func(field, pattern string)) {
+	for key, value := range filter {
+		if strings.HasPrefix(key, "$") {
+			for _, sub := range bsonfilter.Clauses(value) {
+				walkRegexes(sub, visit)
+			}
+			continue
+		}
+		walkRegexCondition(key, value, visit)
+	}
+}
+
+// walkRegexCondition calls visit with the pattern of every regex in the condition on a field, a bson.Regex value
+// or a $regex, $not, $in or $nin operator. $elemMatch conditions are visited both as conditions on the array
+// elements, with their fields joined to the array field, and as conditions on the elements themselves.
+func walkRegexCondition(field string, value interface{}, visit func(field, pattern string)) {
+	switch v := value.(type) {
+	case bson.Regex:
+		visit(field, v.Pattern)
+	case bson.M:
+		for op, operand := range v {
+			switch op {
+			case "$regex":
+				if pattern, ok := operand.(string); ok {
+					visit(field, pattern)
+				} else {
+					walkRegexCondition(field, operand, visit)
+				}
+			case "$not":
+				walkRegexCondition(field, operand, visit)
+			case "$in", "$nin":
+				if values, ok := operand.([]interface{}); ok {
+					for _, item := range values {
+						walkRegexCondition(field, item, visit)
+					}
+				} else if values, ok := operand.(bson.A); ok {
+					for _, item := range values {
+						walkRegexCondition(field, item, visit)
+					}
+				}
+			case "$elemMatch":
+				if doc, ok := operand.(bson.M); ok {
+					walkRegexes(doc, func(sub, pattern string) { visit(field+"."+sub, pattern) })
+					walkRegexCondition(field, doc, visit)
+				}
+			}
+		}
+	}
+}
+
+// isLeadingWildcard reports whether a regex has no literal text at its start, so it cannot use index bounds
+func isLeadingWildcard(pattern string) bool {
+	return !strings.HasPrefix(pattern, "^") || strings.HasPrefix(pattern, "^.")
+}
+
+// walkOperators calls visit for every operator in a filter value, including those inside field conditions.
+// A regular expression value counts as $regex.
+func walkOperators(value interface{}, visit func(operator string)) {
+	switch v := value.(type) {
+	case bson.M:
+		for key, child := range v {
+			if strings.HasPrefix(key, "$") {
+				visit(key)
+			}
+			walkOperators(child, visit)
+		}
+	case bson.D:
+		for _, elem := range v {
+			if strings.HasPrefix(elem.Key, "$") {
+				visit(elem.Key)
+			}
+			walkOperators(elem.Value, visit)
+		}
+	case []bson.M:
+		for _, doc := range v {
+			walkOperators(doc, visit)
+		}
+	case bson.A:
+		for _, item := range v {
+			walkOperators(item, visit)
+		}
+	case []interface{}:
+		for _, item := range v {
+			walkOperators(item, visit)
+		}
+	case bson.Regex:
+		visit("$regex")
+	}
+}
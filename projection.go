@@ -0,0 +1,74 @@
+package bsonic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/formatter/mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ParseProjection parses a field list using the default parser and converts it into a projection document.
+func ParseProjection(fields string) (bson.M, error) {
+	return New().ParseProjection(fields)
+}
+
+// ParseProjection parses a comma-separated field list, such as "fields: name, email, profile.location" or
+// "-password", into a projection document, so APIs can let clients pick the fields they get back.
+// The fields: prefix is optional and a leading "-" excludes a field; inclusions and exclusions cannot be mixed,
+// except for excluding _id. Fields are checked against the allowlist and array fields and, when field types are
+// declared, must be a typed field or an object holding one. An empty list gives an empty projection.
+func (p *Parser) ParseProjection(fields string) (bson.M, error) {
+	p, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	return guard(func() (bson.M, error) {
+		return p.parseProjection(fields)
+	})
+}
+
+// parseProjection builds and validates the projection for a field list without recovering from panics.
+func (p *Parser) parseProjection(fields string) (bson.M, error) {
+	mongoFormatter, ok := p.formatter.(*mongo.MongoFormatter)
+	if !ok {
+		return nil, fmt.Errorf("formatter is not a MongoFormatter")
+	}
+
+	projection, err := mongoFormatter.FormatProjection(trimListName(fields, "fields"))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.validateResultFields(&ParseResult{Projection: projection}); err != nil {
+		return nil, err
+	}
+	if len(p.Config.FieldTypes) > 0 {
+		for field := range projection {
+			if field != "_id" && !p.isTypedPath(config.SchemaPath(field)) {
+				return nil, &FieldError{Field: field, Suggestions: suggestFields(field, p.typedFields())}
+			}
+		}
+	}
+	return projection, nil
+}
+
+// typedFields returns the fields with declared types
+func (p *Parser) typedFields() []string {
+	fields := make([]string, 0, len(p.Config.FieldTypes))
+	for field := range p.Config.FieldTypes {
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// trimListName removes the directive name a field list may be written with, such as fields: in
+// "fields: name, email", matched without regard to case.
+func trimListName(list, name string) string {
+	prefix, rest, found := strings.Cut(list, ":")
+	if found && strings.EqualFold(strings.TrimSpace(prefix), name) {
+		return rest
+	}
+	return list
+}
@@ -0,0 +1,58 @@
+package bsonic
+
+import (
+	"github.com/kyle-williams-1/bsonic/config"
+)
+
+// providerState is the parser built for the config a provider last returned.
+type providerState struct {
+	config *config.Config
+	parser *Parser
+}
+
+// NewWithProvider creates a parser that consults provider for its config on every request, so settings such as
+// the field allowlist can be updated without restarting the service. The parser is rebuilt whenever the provider
+// returns a different config; see config.NewFileProvider for a provider that reloads a file when it changes.
+func NewWithProvider(provider config.Provider) (*Parser, error) {
+	cfg := provider.Config()
+	if cfg == nil {
+		return nil, unsupportedf("config provider returned no config")
+	}
+	parser, err := NewWithConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Parser{
+		Config:         parser.Config,
+		languageParser: parser.languageParser,
+		formatter:      parser.formatter,
+		provider:       provider,
+	}
+	p.state.Store(&providerState{config: cfg, parser: parser})
+	return p, nil
+}
+
+// current returns the parser for the provider's current config, or p itself when it has no provider.
+// A config the parser cannot be built from is reported as an error for the request.
+func (p *Parser) current() (*Parser, error) {
+	if p.provider == nil {
+		return p, nil
+	}
+
+	cfg := p.provider.Config()
+	state := p.state.Load()
+	if cfg == state.config {
+		return state.parser, nil
+	}
+	if cfg == nil {
+		return nil, unsupportedf("config provider returned no config")
+	}
+
+	parser, err := NewWithConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p.state.Store(&providerState{config: cfg, parser: parser})
+	return parser, nil
+}
@@ -0,0 +1,244 @@
+package bsonic
+
+import (
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/formatter/mongo"
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Intent describes which collection operation a query is meant for, so API layers
+// can route to Find, CountDocuments or Distinct.
+type Intent = mongo.Intent
+
+const (
+	// IntentFind is the default intent: a regular find
+	IntentFind = mongo.IntentFind
+	// IntentCount is set by a COUNT prefix, e.g. "COUNT WHERE role:admin"
+	IntentCount = mongo.IntentCount
+	// IntentDistinct is set by a DISTINCT prefix, e.g. "DISTINCT email WHERE active:true"
+	IntentDistinct = mongo.IntentDistinct
+)
+
+// TextScoreField is the field TextScoreProjection holds a document's $text relevance score in.
+const TextScoreField = "score"
+
+// Highlight is a field and the term or regex a query matches it with, for highlighting results in a UI.
+type Highlight = mongo.Highlight
+
+// QueryOptions are the options a query sets for itself with @ prefixes, such as @include_deleted @case_sensitive name:john.
+type QueryOptions = mongo.QueryOptions
+
+// ParseResult is a complete find specification parsed from a single query string.
+type ParseResult struct {
+	// Collection is the collection named by an in:, collection: or index: routing prefix, e.g. "in:orders status:pending",
+	// for search boxes that target several collections. It is empty without a prefix; check it against the collections
+	// callers may search before using it.
+	Collection string
+	// Intent is the operation requested by the query prefix (find by default)
+	Intent Intent
+	// DistinctField is the field named by a DISTINCT prefix
+	DistinctField string
+	// Filter is the BSON filter document
+	Filter bson.M
+	// Sort holds the sort keys from a sort directive, in order (1 ascending, -1 descending)
+	Sort bson.D
+	// Limit is the maximum number of documents from a limit directive, or 0 for no limit
+	Limit int64
+	// Projection holds the projection document from a fields directive
+	Projection bson.M
+	// SearchStage is the Atlas Search $search stage holding the query's free text, when the Atlas Search strategy is used
+	SearchStage bson.M
+	// ScoreStage is the $addFields stage scoring free text matches, when weighted default fields are configured
+	ScoreStage bson.M
+	// TextScoreProjection is the projection fragment {"score": {"$meta": "textScore"}} and TextScoreSort the sort
+	// fragment ordering by it, when the filter has a $text search and text scores are enabled with WithTextScore
+	TextScoreProjection bson.M
+	TextScoreSort       bson.D
+	// LookupStages holds the $lookup stages joining foreign references used by the filter or sort.
+	// When set, the filter and sort refer to the looked-up documents and only work through Pipeline.
+	LookupStages []bson.M
+	// Highlights lists the field and term or regex pairs the query matches, for highlighting results
+	Highlights []Highlight
+	// Options holds the @include_deleted, @case_sensitive and @limit:N options at the start of the query, which
+	// have already been applied to the filter and limit
+	Options QueryOptions
+	// Warnings lists the clauses and directives dropped because they failed to parse, when lenient errors are enabled,
+	// the deprecated fields the query used, which match ErrDeprecatedField, and, under the ConflictWarn policy, the
+	// fields ANDed with conflicting values, which match ErrConflictingField
+	Warnings []Warning
+}
+
+// Pipeline returns the result as aggregation pipeline stages: $search (if any), then any $lookup stages,
+// $match, $sort, $project and $limit. Use it instead of Find when the result has a SearchStage or LookupStages.
+func (r *ParseResult) Pipeline() []bson.M {
+	return r.pipeline(false)
+}
+
+// RankedPipeline returns the result as aggregation pipeline stages ordered by relevance:
+// $match, then the score stage, then a $sort on the score followed by any sort directive keys.
+// Without a score stage it is the same as Pipeline.
+func (r *ParseResult) RankedPipeline() []bson.M {
+	return r.pipeline(len(r.ScoreStage) > 0)
+}
+
+// needsPipeline reports whether the result can only run as an aggregation.
+func (r *ParseResult) needsPipeline() bool {
+	return len(r.SearchStage) > 0 || len(r.LookupStages) > 0
+}
+
+// pipeline builds the aggregation stages for the result, optionally scoring and sorting by relevance.
+func (r *ParseResult) pipeline(ranked bool) []bson.M {
+	var pipeline []bson.M
+	if len(r.SearchStage) > 0 {
+		pipeline = append(pipeline, r.SearchStage)
+	}
+	pipeline = append(pipeline, r.matchStages()...)
+
+	sort := r.Sort
+	scoreField := ""
+	switch {
+	case ranked:
+		pipeline = append(pipeline, r.ScoreStage)
+		scoreField = mongo.ScoreField
+		sort = scoreSort(bson.D{{Key: mongo.ScoreField, Value: -1}}, r.Sort, mongo.ScoreField)
+	case len(r.TextScoreSort) > 0:
+		// Later stages drop the $text metadata, so the score is stored while it is available
+		pipeline = append(pipeline, bson.M{"$addFields": r.TextScoreProjection})
+		scoreField = TextScoreField
+		sort = scoreSort(r.TextScoreSort, r.Sort, TextScoreField)
+	}
+	if len(sort) > 0 {
+		pipeline = append(pipeline, bson.M{"$sort": sort})
+	}
+
+	// Looked-up documents are only needed for matching and sorting
+	if aliases := lookupAliases(r.LookupStages); len(aliases) > 0 {
+		pipeline = append(pipeline, bson.M{"$unset": aliases})
+	}
+
+	if len(r.Projection) > 0 {
+		projection := r.Projection
+		// Keep the score visible in an inclusion projection
+		if scoreField != "" && !isExclusionProjection(projection) {
+			projection = withProjection(r.Projection, bson.M{scoreField: 1})
+		}
+		pipeline = append(pipeline, bson.M{"$project": projection})
+	}
+	if r.Limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": r.Limit})
+	}
+	return pipeline
+}
+
+// matchStages returns the lookup stages of the result and the $match stage of its filter. A $text search
+// must be matched in the first stage of a pipeline, so with lookup stages it is matched on its own before
+// them, and the rest of the filter after them.
+func (r *ParseResult) matchStages() []bson.M {
+	var stages []bson.M
+	filter := r.Filter
+	if len(r.LookupStages) > 0 {
+		if text, rest, ok := splitTextSearch(filter); ok {
+			stages = append(stages, bson.M{"$match": text})
+			filter = rest
+		}
+	}
+	stages = append(stages, r.LookupStages...)
+	if len(filter) > 0 {
+		stages = append(stages, bson.M{"$match": filter})
+	}
+	return stages
+}
+
+// splitTextSearch separates the $text condition of a filter, at its top level or in its $and clauses, from
+// the rest of the filter
+func splitTextSearch(filter bson.M) (text bson.M, rest bson.M, ok bool) {
+	if search, found := filter["$text"]; found {
+		rest = bson.M{}
+		for key, value := range filter {
+			if key != "$text" {
+				rest[key] = value
+			}
+		}
+		return bson.M{"$text": search}, rest, true
+	}
+
+	clauses := bsonfilter.Clauses(filter["$and"])
+	for i, clause := range clauses {
+		text, clauseRest, found := splitTextSearch(clause)
+		if !found {
+			continue
+		}
+		remaining := append([]bson.M{}, clauses[:i]...)
+		if len(clauseRest) > 0 {
+			remaining = append(remaining, clauseRest)
+		}
+		remaining = append(remaining, clauses[i+1:]...)
+
+		rest = bson.M{}
+		for key, value := range filter {
+			if key != "$and" {
+				rest[key] = value
+			}
+		}
+		switch {
+		case len(remaining) == 1 && len(rest) == 0:
+			rest = remaining[0]
+		case len(remaining) > 0:
+			rest["$and"] = remaining
+		}
+		return text, rest, true
+	}
+	return nil, filter, false
+}
+
+// hasTextSearch reports whether a filter has a $text search, at the top level or under a logical operator
+func hasTextSearch(filter bson.M) bool {
+	for key, value := range filter {
+		if key == "$text" {
+			return true
+		}
+		if strings.HasPrefix(key, "$") {
+			for _, sub := range bsonfilter.Clauses(value) {
+				if hasTextSearch(sub) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// scoreSort returns the score sort keys followed by the sort directive keys, leaving out any on the score field
+func scoreSort(score, directive bson.D, scoreField string) bson.D {
+	sort := append(bson.D{}, score...)
+	for _, key := range directive {
+		if key.Key != scoreField {
+			sort = append(sort, key)
+		}
+	}
+	return sort
+}
+
+// withProjection returns a copy of a projection with the fields of another added
+func withProjection(projection, fields bson.M) bson.M {
+	merged := bson.M{}
+	for field, include := range projection {
+		merged[field] = include
+	}
+	for field, include := range fields {
+		merged[field] = include
+	}
+	return merged
+}
+
+// isExclusionProjection reports whether a projection only excludes fields
+func isExclusionProjection(projection bson.M) bool {
+	for field, include := range projection {
+		if field != "_id" && include == 1 {
+			return false
+		}
+	}
+	return true
+}
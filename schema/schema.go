@@ -0,0 +1,108 @@
+// Package schema derives the allowed fields and stored types of a collection, from sampled documents or Go document structs.
+package schema
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Infer samples up to sampleSize documents from a collection and infers the type of every field,
+// for use with config.WithFieldTypes.
+func Infer(ctx context.Context, coll *mongo.Collection, sampleSize int) (map[string]config.FieldType, error) {
+	cursor, err := coll.Aggregate(ctx, []bson.M{{"$sample": bson.M{"size": sampleSize}}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample documents: %v", err)
+	}
+
+	var docs []bson.M
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode sampled documents: %v", err)
+	}
+
+	return InferFromDocuments(docs), nil
+}
+
+// InferFromDocuments infers the type of every field in a set of documents, using dotted paths for
+// nested fields and element types for arrays. A field takes the type most of its values have;
+// null values and types with no query coercion, such as binary data, are ignored.
+func InferFromDocuments(docs []bson.M) map[string]config.FieldType {
+	counts := map[string]map[config.FieldType]int{}
+	for _, doc := range docs {
+		countDocument("", doc, counts)
+	}
+
+	types := map[string]config.FieldType{}
+	for field, byType := range counts {
+		candidates := make([]config.FieldType, 0, len(byType))
+		for fieldType := range byType {
+			candidates = append(candidates, fieldType)
+		}
+		// Ties go to the type name first in order, so the result is deterministic
+		sort.Slice(candidates, func(i, j int) bool {
+			if byType[candidates[i]] != byType[candidates[j]] {
+				return byType[candidates[i]] > byType[candidates[j]]
+			}
+			return candidates[i] < candidates[j]
+		})
+		types[field] = candidates[0]
+	}
+	return types
+}
+
+// countDocument counts the value types of every field in a document beneath a path prefix
+func countDocument(prefix string, doc bson.M, counts map[string]map[config.FieldType]int) {
+	for key, value := range doc {
+		countValue(prefix+key, value, counts)
+	}
+}
+
+// countValue counts the type of a value, descending into documents and arrays
+func countValue(path string, value interface{}, counts map[string]map[config.FieldType]int) {
+	switch v := value.(type) {
+	case bson.M:
+		countDocument(path+".", v, counts)
+		return
+	case bson.D:
+		for _, e := range v {
+			countValue(path+"."+e.Key, e.Value, counts)
+		}
+		return
+	case bson.A:
+		for _, element := range v {
+			countValue(path, element, counts)
+		}
+		return
+	}
+
+	fieldType, ok := typeOf(value)
+	if !ok {
+		return
+	}
+	if counts[path] == nil {
+		counts[path] = map[config.FieldType]int{}
+	}
+	counts[path][fieldType]++
+}
+
+// typeOf maps a decoded BSON value to the field type queries should coerce to
+func typeOf(value interface{}) (config.FieldType, bool) {
+	switch value.(type) {
+	case string:
+		return config.FieldTypeString, true
+	case int32, int64, float64, bson.Decimal128:
+		return config.FieldTypeNumber, true
+	case bson.DateTime, time.Time:
+		return config.FieldTypeDate, true
+	case bson.ObjectID:
+		return config.FieldTypeObjectID, true
+	case bool:
+		return config.FieldTypeBool, true
+	}
+	return "", false
+}
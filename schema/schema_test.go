@@ -0,0 +1,136 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// TestInferFromDocuments tests type inference across scalar, nested and array fields
+func TestInferFromDocuments(t *testing.T) {
+	docs := []bson.M{
+		{
+			"_id":        bson.NewObjectID(),
+			"name":       "John",
+			"zip":        "02134",
+			"age":        int32(30),
+			"active":     true,
+			"created_at": bson.NewDateTimeFromTime(time.Now()),
+			"tags":       bson.A{"admin", "staff"},
+			"profile":    bson.D{{Key: "score", Value: 9.5}},
+			"avatar":     bson.Binary{Data: []byte{1}},
+			"nickname":   nil,
+		},
+		{"age": int64(31), "zip": "10001", "profile": bson.M{"score": int32(7)}},
+		{"age": "unknown"},
+	}
+
+	expected := map[string]config.FieldType{
+		"_id":           config.FieldTypeObjectID,
+		"name":          config.FieldTypeString,
+		"zip":           config.FieldTypeString,
+		"age":           config.FieldTypeNumber,
+		"active":        config.FieldTypeBool,
+		"created_at":    config.FieldTypeDate,
+		"tags":          config.FieldTypeString,
+		"profile.score": config.FieldTypeNumber,
+	}
+
+	if types := InferFromDocuments(docs); !reflect.DeepEqual(types, expected) {
+		t.Errorf("Expected %v, got %v", expected, types)
+	}
+}
+
+// TestInferFromDocumentsTie tests that ties between types are broken deterministically
+func TestInferFromDocumentsTie(t *testing.T) {
+	docs := []bson.M{{"code": "A1"}, {"code": int32(1)}}
+
+	for i := 0; i < 10; i++ {
+		if got := InferFromDocuments(docs)["code"]; got != config.FieldTypeNumber {
+			t.Fatalf("Expected tie to resolve to number, got %s", got)
+		}
+	}
+}
+
+type testAddress struct {
+	City string `bson:"city"`
+	Zip  string `bson:"zip,omitempty"`
+}
+
+type testAudit struct {
+	CreatedAt time.Time     `bson:"created_at"`
+	UpdatedAt bson.DateTime `bson:"updated_at"`
+}
+
+type testCategory struct {
+	Name     string          `bson:"name"`
+	Parent   *testCategory   `bson:"parent"`
+	Children []*testCategory `bson:"children"`
+}
+
+type testUser struct {
+	ID        bson.ObjectID          `bson:"_id"`
+	Name      string                 `bson:"name"`
+	Age       int                    `bson:"age,omitempty"`
+	Score     *float64               `bson:"score"`
+	Active    bool                   `bson:"active"`
+	Nickname  string                 // untagged fields use the lowercased name
+	Secret    string                 `bson:"-"`
+	Address   testAddress            `bson:"address"`
+	Previous  []testAddress          `bson:"previous_addresses"`
+	Tags      []string               `bson:"tags"`
+	Avatar    []byte                 `bson:"avatar"`
+	Meta      map[string]interface{} `bson:"meta"`
+	Category  testCategory           `bson:"category"`
+	testAudit `bson:",inline"`
+	internal  string
+}
+
+// TestFromStruct tests field and type extraction from bson struct tags
+func TestFromStruct(t *testing.T) {
+	fields, err := FromStruct(&testUser{})
+	if err != nil {
+		t.Fatalf("FromStruct should not return error, got: %v", err)
+	}
+
+	expectedAllowed := []string{
+		"_id", "active", "address.city", "address.zip", "age", "avatar",
+		"category.children", "category.name", "category.parent", "created_at", "meta", "name", "nickname",
+		"previous_addresses.city", "previous_addresses.zip", "score", "tags", "updated_at",
+	}
+	if !reflect.DeepEqual(fields.Allowed, expectedAllowed) {
+		t.Errorf("Expected allowed fields %v, got %v", expectedAllowed, fields.Allowed)
+	}
+
+	expectedTypes := map[string]config.FieldType{
+		"_id":                     config.FieldTypeObjectID,
+		"name":                    config.FieldTypeString,
+		"age":                     config.FieldTypeNumber,
+		"score":                   config.FieldTypeNumber,
+		"active":                  config.FieldTypeBool,
+		"nickname":                config.FieldTypeString,
+		"address.city":            config.FieldTypeString,
+		"address.zip":             config.FieldTypeString,
+		"previous_addresses.city": config.FieldTypeString,
+		"previous_addresses.zip":  config.FieldTypeString,
+		"tags":                    config.FieldTypeString,
+		"category.name":           config.FieldTypeString,
+		"created_at":              config.FieldTypeDate,
+		"updated_at":              config.FieldTypeDate,
+	}
+	if !reflect.DeepEqual(fields.Types, expectedTypes) {
+		t.Errorf("Expected types %v, got %v", expectedTypes, fields.Types)
+	}
+}
+
+// TestFromStructRejectsNonStruct tests that only structs and pointers to structs are accepted
+func TestFromStructRejectsNonStruct(t *testing.T) {
+	for _, v := range []interface{}{nil, "user", map[string]string{}, (*int)(nil)} {
+		if _, err := FromStruct(v); err == nil {
+			t.Errorf("Expected an error for %T", v)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Fields is the queryable shape of a document struct.
+type Fields struct {
+	// Allowed lists every queryable field path, in sorted order, for use with config.WithAllowedFields
+	Allowed []string
+	// Types maps field paths to their stored type, for use with config.WithFieldTypes
+	Types map[string]config.FieldType
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	dateTimeType   = reflect.TypeOf(bson.DateTime(0))
+	objectIDType   = reflect.TypeOf(bson.ObjectID{})
+	decimal128Type = reflect.TypeOf(bson.Decimal128{})
+	binaryType     = reflect.TypeOf(bson.Binary{})
+)
+
+// FromStruct reads the bson struct tags of a document struct, such as User{} or (*User)(nil), and returns
+// its fields. Field names follow the driver's rules: the tag name, or the lowercased Go name when the tag
+// has none. Nested structs become dotted paths, slices and arrays take their element type, and inline
+// structs are flattened into their parent. Map and interface fields allow any nested path and are untyped.
+func FromStruct(v interface{}) (*Fields, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a struct, got %T", v)
+	}
+
+	fields := &Fields{Types: map[string]config.FieldType{}}
+	collectStruct(t, "", fields, map[reflect.Type]bool{})
+	sort.Strings(fields.Allowed)
+	return fields, nil
+}
+
+// collectStruct adds the exported fields of a struct type beneath a path prefix.
+// visiting holds the struct types being expanded, so recursive types are not expanded forever.
+func collectStruct(t reflect.Type, prefix string, fields *Fields, visiting map[reflect.Type]bool) {
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// Like the driver, embedded structs are encoded even when their type is unexported
+		if !field.IsExported() && !(field.Anonymous && derefType(field.Type).Kind() == reflect.Struct) {
+			continue
+		}
+
+		name, inline, skip := parseTag(field)
+		if skip {
+			continue
+		}
+
+		fieldType := derefType(field.Type)
+		if inline && fieldType.Kind() == reflect.Struct {
+			collectStruct(fieldType, prefix, fields, visiting)
+			continue
+		}
+		collectField(fieldType, prefix+name, fields, visiting)
+	}
+}
+
+// collectField adds a field path, descending into structs and taking the element type of slices and arrays.
+func collectField(t reflect.Type, path string, fields *Fields, visiting map[reflect.Type]bool) {
+	if fieldType, ok := structFieldType(t); ok {
+		fields.Allowed = append(fields.Allowed, path)
+		fields.Types[path] = fieldType
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Byte slices are stored as binary data
+			fields.Allowed = append(fields.Allowed, path)
+			return
+		}
+		collectField(derefType(t.Elem()), path, fields, visiting)
+	case reflect.Struct:
+		if t == binaryType || visiting[t] {
+			// A recursive type has no fixed depth, so any nested path is allowed
+			fields.Allowed = append(fields.Allowed, path)
+			return
+		}
+		collectStruct(t, path+".", fields, visiting)
+	default:
+		// Maps, interfaces and other values have no fixed shape, so any nested path is allowed
+		fields.Allowed = append(fields.Allowed, path)
+	}
+}
+
+// structFieldType maps a Go type to the field type queries should coerce to
+func structFieldType(t reflect.Type) (config.FieldType, bool) {
+	switch t {
+	case timeType, dateTimeType:
+		return config.FieldTypeDate, true
+	case objectIDType:
+		return config.FieldTypeObjectID, true
+	case decimal128Type:
+		return config.FieldTypeNumber, true
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return config.FieldTypeString, true
+	case reflect.Bool:
+		return config.FieldTypeBool, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return config.FieldTypeNumber, true
+	}
+	return "", false
+}
+
+// parseTag returns the stored name of a struct field and whether it is inline or skipped
+func parseTag(field reflect.StructField) (name string, inline, skip bool) {
+	tag := field.Tag.Get("bson")
+	if tag == "-" {
+		return "", false, true
+	}
+
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	for _, option := range parts[1:] {
+		if option == "inline" {
+			inline = true
+		}
+	}
+	if name == "" {
+		name = strings.ToLower(field.Name)
+	}
+	return name, inline, false
+}
+
+// derefType returns the type a chain of pointers points to
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,114 @@
+package bsonic
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// applySoftDelete returns a filter that also excludes soft-deleted documents, by requiring the configured
+// soft delete field to be null or missing, unless the filter requires a condition on the field or a path beneath
+// it that only a deleted document can meet, such as deleted_at:TYPE(date) to find deleted documents. A condition
+// on the field under $or or a negation does not count, since it would let a query match deleted documents the
+// @include_deleted option is needed for.
+func (p *Parser) applySoftDelete(filter bson.M) bson.M {
+	field := p.Config.SoftDeleteField
+	if field == "" || p.includeDeleted || p.requiresDeleted(filter) {
+		return filter
+	}
+	return andFilters(filter, bson.M{field: nil})
+}
+
+// requiresDeleted reports whether a filter has a condition on the soft delete field, or a path beneath it, that
+// every document it matches must meet, directly or in its $and clauses, and that no document with the field
+// null or missing meets
+func (p *Parser) requiresDeleted(filter bson.M) bool {
+	field := p.Config.SoftDeleteField
+	for key, value := range filter {
+		switch {
+		case key == "$and":
+			for _, clause := range bsonfilter.Clauses(value) {
+				if p.requiresDeleted(clause) {
+					return true
+				}
+			}
+		case key == field || strings.HasPrefix(key, field+"."):
+			if excludesNull(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// excludesNull reports whether a field condition can only match a field holding a value other than null
+func excludesNull(condition interface{}) bool {
+	doc, ok := condition.(bson.M)
+	if !ok {
+		// Equality with a value; a regex never matches null either
+		return condition != nil
+	}
+	for operator, operand := range doc {
+		switch operator {
+		case "$type":
+			if !matchesNullType(operand) {
+				return true
+			}
+		case "$gt", "$gte", "$lt", "$lte", "$eq":
+			if operand != nil {
+				return true
+			}
+		case "$ne":
+			if operand == nil {
+				return true
+			}
+		case "$in":
+			values := bsonfilter.Values(operand)
+			if len(values) > 0 && !slices.Contains(values, nil) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesNullType reports whether a $type operand, one type or a list of them, includes null
+func matchesNullType(operand interface{}) bool {
+	types := bsonfilter.Values(operand)
+	if types == nil {
+		types = []interface{}{operand}
+	}
+	for _, t := range types {
+		switch t {
+		case "null", int32(10), int64(10), 10, 10.0:
+			return true
+		}
+	}
+	return false
+}
+
+// ParseIncludingDeleted is like ParseDetailedContext, but matches soft-deleted documents too, as @include_deleted
+// does, without the query needing the option. It is meant for trusted callers, such as admin tools, where
+// the @include_deleted option is not allowed.
+func (p *Parser) ParseIncludingDeleted(ctx context.Context, query string) (*ParseResult, error) {
+	p, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+
+	scoped := &Parser{Config: p.Config, languageParser: p.languageParser, formatter: p.formatter, includeDeleted: true}
+	return scoped.instrument(ctx, query, func(ctx context.Context) (*ParseResult, error) {
+		scoped := scoped.withSubqueries(ctx)
+		return guard(func() (*ParseResult, error) {
+			return scoped.parseDetailed(ctx, query, scoped.Config.DefaultFields, scoped.formatDefault)
+		})
+	})
+}
+
+// emptyResult returns the result of a query without clauses, which matches every document that is not soft-deleted.
+func (p *Parser) emptyResult() *ParseResult {
+	return &ParseResult{Intent: IntentFind, Filter: p.applySoftDelete(bson.M{})}
+}
@@ -0,0 +1,45 @@
+package bsonic
+
+import (
+	"fmt"
+
+	"github.com/kyle-williams-1/bsonic/formatter/mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ParseSort parses a sort list using the default parser and converts it into sort keys.
+func ParseSort(sort string) (bson.D, error) {
+	return New().ParseSort(sort)
+}
+
+// ParseSort parses a comma-separated sort list, such as "-created_at,+name", into sort keys in order
+// (1 ascending, -1 descending), complementing the filter parser for find options taken from user input.
+// Fields sort ascending unless prefixed with "-", and the sort: prefix is optional. Fields are checked
+// against the allowlist and array fields. An empty list gives no sort keys.
+func (p *Parser) ParseSort(sort string) (bson.D, error) {
+	p, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	return guard(func() (bson.D, error) {
+		return p.parseSort(sort)
+	})
+}
+
+// parseSort builds and validates the sort keys for a sort list without recovering from panics.
+func (p *Parser) parseSort(sort string) (bson.D, error) {
+	mongoFormatter, ok := p.formatter.(*mongo.MongoFormatter)
+	if !ok {
+		return nil, fmt.Errorf("formatter is not a MongoFormatter")
+	}
+
+	keys, err := mongoFormatter.FormatSort(trimListName(sort, "sort"))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.validateResultFields(&ParseResult{Sort: keys}); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
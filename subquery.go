@@ -0,0 +1,38 @@
+package bsonic
+
+import (
+	"context"
+
+	"github.com/kyle-williams-1/bsonic/formatter/mongo"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// withSubqueries returns a copy of the parser for one parse whose IN_QUERY subqueries are resolved with ctx,
+// once each, after their inner filter passes the checks a top-level filter does. Parsers without a subquery
+// resolver are returned unchanged.
+func (p *Parser) withSubqueries(ctx context.Context) *Parser {
+	mongoFormatter, ok := p.formatter.(*mongo.MongoFormatter)
+	if !ok || p.Config.SubqueryResolver == nil {
+		return p
+	}
+
+	scoped := &Parser{Config: p.Config, languageParser: p.languageParser, access: p.access, includeDeleted: p.includeDeleted}
+	scoped.formatter = mongoFormatter.WithContext(ctx).WithSubqueryValidator(scoped.validateSubquery)
+	return scoped
+}
+
+// validateSubquery checks the inner filter of an IN_QUERY subquery against the allowed fields, access
+// rules and policies, and returns the filter to resolve, with fields masked by a strip policy left out
+func (p *Parser) validateSubquery(filter bson.M) (bson.M, error) {
+	result := &ParseResult{Intent: IntentFind, Filter: filter}
+	if err := p.validateFields(result.Filter); err != nil {
+		return nil, err
+	}
+	if err := p.applyAccess(result); err != nil {
+		return nil, err
+	}
+	if err := p.checkPolicy(result); err != nil {
+		return nil, err
+	}
+	return result.Filter, nil
+}
@@ -0,0 +1,173 @@
+package bsonic
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"github.com/kyle-williams-1/bsonic/metrics"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the parser's spans
+const tracerName = "github.com/kyle-williams-1/bsonic"
+
+// tracer returns the tracer from the configured provider, falling back to the global provider
+func (p *Parser) tracer() trace.Tracer {
+	provider := p.Config.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// instrument runs a parse under a bsonic.parse span, then logs its outcome and reports it to the configured
+// metrics with the query length, the number of clauses in the resulting filter and the duration
+func (p *Parser) instrument(ctx context.Context, query string, parse func(ctx context.Context) (*ParseResult, error)) (*ParseResult, error) {
+	ctx, span := p.tracer().Start(ctx, "bsonic.parse", trace.WithAttributes(attribute.Int("bsonic.query.length", len(query))))
+	defer span.End()
+
+	start := time.Now()
+	result, err := parse(ctx)
+	duration := time.Since(start)
+
+	span.SetAttributes(attribute.Float64("bsonic.duration_ms", float64(duration.Microseconds())/1000))
+	if err != nil {
+		p.recordSpanError(span, err)
+	} else {
+		span.SetAttributes(attribute.Int("bsonic.clause.count", clauseCount(result.Filter)))
+	}
+
+	if m := p.Config.Metrics; m != nil {
+		if err != nil {
+			m.ParseFailed(duration, errorKind(err))
+		} else {
+			m.ParseCompleted(duration, clauseCount(result.Filter))
+		}
+	}
+
+	if recorder := p.Config.UsageRecorder; recorder != nil && err == nil {
+		recorder.QueryUsed(queryUsage(result))
+	}
+
+	if logger := p.Config.Logger; logger != nil {
+		attrs := []slog.Attr{
+			slog.Int("query_length", len(query)),
+			slog.Duration("duration", duration),
+		}
+		// The query and error messages quoting it may hold personal data, so only their shape is logged by default
+		if p.Config.LogQueries {
+			attrs = append(attrs, slog.String("query", query))
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("error_kind", errorKind(err)))
+			if p.Config.LogQueries {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+			logger.LogAttrs(ctx, slog.LevelDebug, "query parse failed", attrs...)
+		} else {
+			attrs = append(attrs,
+				slog.Int("clauses", clauseCount(result.Filter)),
+				slog.String("fingerprint", result.Fingerprint()),
+				slog.String("shape", result.Shape()))
+			logger.LogAttrs(ctx, slog.LevelDebug, "query parsed", attrs...)
+		}
+	}
+
+	return result, err
+}
+
+// phase runs one phase of a parse under its own span, recording any error it returns
+func (p *Parser) phase(ctx context.Context, name string, fn func() error) error {
+	_, span := p.tracer().Start(ctx, name)
+	defer span.End()
+
+	err := fn()
+	if err != nil {
+		p.recordSpanError(span, err)
+	}
+	return err
+}
+
+// recordSpanError marks a span as failed with the error kind. Like the logs, the span only gets the error
+// message, which may quote the query, when query logging is enabled.
+func (p *Parser) recordSpanError(span trace.Span, err error) {
+	span.SetAttributes(attribute.String("bsonic.error.kind", errorKind(err)))
+	if p.Config.LogQueries {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetStatus(codes.Error, errorKind(err))
+	}
+}
+
+// clauseCount returns the number of field conditions in a filter, including those nested under logical operators
+func clauseCount(filter bson.M) int {
+	count := 0
+	_ = walkFilterFields(filter, func(string) error {
+		count++
+		return nil
+	})
+	return count
+}
+
+// queryUsage lists the fields and operators of a parse result for the usage recorder
+func queryUsage(result *ParseResult) metrics.QueryUsage {
+	var usage metrics.QueryUsage
+	filterUsage(result.Filter, &usage)
+	for _, key := range result.Sort {
+		usage.Sorted = append(usage.Sorted, config.SchemaPath(key.Key))
+	}
+	for field := range result.Projection {
+		if field != "_id" {
+			usage.Projected = append(usage.Projected, config.SchemaPath(field))
+		}
+	}
+	return usage
+}
+
+// filterUsage adds the conditions and operators of a filter to usage, descending into logical operators
+func filterUsage(filter bson.M, usage *metrics.QueryUsage) {
+	for key, value := range filter {
+		if strings.HasPrefix(key, "$") {
+			usage.Operators = append(usage.Operators, key)
+			for _, sub := range bsonfilter.Clauses(value) {
+				filterUsage(sub, usage)
+			}
+			continue
+		}
+
+		condition := metrics.FieldCondition{Field: config.SchemaPath(key)}
+		walkOperators(value, func(operator string) {
+			condition.Operators = append(condition.Operators, operator)
+		})
+		usage.Operators = append(usage.Operators, condition.Operators...)
+		if len(condition.Operators) == 0 {
+			condition.Operators = []string{"$eq"}
+		}
+		usage.Conditions = append(usage.Conditions, condition)
+	}
+}
+
+// errorKind names the category of a parse error with one of the metrics Kind constants
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrDisallowedField):
+		return metrics.KindDisallowedField
+	case errors.Is(err, ErrLimitExceeded):
+		return metrics.KindLimitExceeded
+	case errors.Is(err, ErrUnsupported):
+		return metrics.KindUnsupported
+	case errors.Is(err, ErrSyntax):
+		return metrics.KindSyntax
+	}
+	return metrics.KindResolver
+}
@@ -0,0 +1,75 @@
+package lucene_mongo_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kyle-williams-1/bsonic"
+	bsonic_config "github.com/kyle-williams-1/bsonic/config"
+)
+
+// FuzzParse checks that untrusted input never panics the parser or produces server-side JavaScript,
+// whatever the configuration.
+func FuzzParse(f *testing.F) {
+	seeds := []string{
+		"name:john",
+		"name:/",
+		"field:/",
+		"//",
+		"/",
+		`"unterminated`,
+		`'unterminated`,
+		"name:\"",
+		"(((name:john)))",
+		strings.Repeat("(", 200),
+		strings.Repeat("NOT ", 200) + "a",
+		"age:[1 TO",
+		"age:[ TO ]",
+		"age:>",
+		"created:2024-01-01T",
+		"COUNT WHERE",
+		"DISTINCT",
+		"| sort:",
+		"a | limit:-1",
+		"a | fields:-",
+		`"x"~lang:`,
+		"id:",
+		"owner_id:IN_QUERY(users WHERE",
+		"name:john doe OR (NOT smith AND age:[18 TO 65]) | sort:-age | limit:5",
+		"$where:sleep(1000)",
+		`\$function:x`,
+		"a.$where:1 | sort:$where",
+		"a\x00b:1 | fields:\x00$where",
+		"profile:{$where:1}",
+		"price:(>=10 AND <=20)",
+		"created_at:>= 2024-01-01",
+		"created_at:>2024-01-01T10:00:00Z",
+		`price:> "1,000"`,
+		`name:john^2 OR "john smith"~3`,
+		"price:((NOT 1 OR (",
+		"a:(b c) OR d:()",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	parsers := []*bsonic.Parser{
+		createParserWithDefaults([]string{"name", "bio"}),
+		bsonic.New(),
+	}
+	textIndex, _ := bsonic.NewWithConfig(bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyTextIndex))
+	atlas, _ := bsonic.NewWithConfig(bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch))
+	parsers = append(parsers, textIndex, atlas)
+
+	f.Fuzz(func(t *testing.T, query string) {
+		for _, parser := range parsers {
+			// Errors are expected for malformed input; panics are not
+			if result, err := parser.ParseDetailed(query); err == nil {
+				if operator := findJavaScriptOperator(result); operator != "" {
+					t.Fatalf("%q emitted %s", query, operator)
+				}
+			}
+			_, _ = parser.Explain(query)
+		}
+	})
+}
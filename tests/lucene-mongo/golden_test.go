@@ -0,0 +1,167 @@
+package lucene_mongo_test
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// update regenerates the expected output of every corpus case: go test ./tests/lucene-mongo/ -run TestLuceneMongoGolden -update
+var update = flag.Bool("update", false, "rewrite testdata corpus files with the current output")
+
+// goldenDefaultFields are the default fields every corpus query is parsed with
+var goldenDefaultFields = []string{"name", "description"}
+
+// goldenError is the expected output of a case that must fail to parse
+const goldenError = "ERROR"
+
+// goldenCase is one `query => expected` line of a corpus file
+type goldenCase struct {
+	line     int
+	query    string
+	expected string
+}
+
+// TestLuceneMongoGolden runs the testdata/*.txt corpus. Each non-blank line that does not start
+// with # is `query => expected`, where expected is the filter as relaxed extended JSON with sorted
+// keys, or ERROR when the query must be rejected.
+func TestLuceneMongoGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	if err != nil {
+		t.Fatalf("Failed to list corpus files: %v", err)
+	}
+	if len(files) == 0 {
+		t.Fatal("Expected corpus files in testdata")
+	}
+
+	parser := createParserWithDefaults(goldenDefaultFields)
+
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			lines, cases, err := readGoldenFile(file)
+			if err != nil {
+				t.Fatalf("Failed to read corpus: %v", err)
+			}
+
+			for _, c := range cases {
+				actual := goldenError
+				if filter, err := parser.Parse(c.query); err == nil {
+					actual, err = canonicalExtJSON(filter)
+					if err != nil {
+						t.Fatalf("%s:%d: failed to marshal %q: %v", file, c.line, c.query, err)
+					}
+				}
+
+				if *update {
+					lines[c.line-1] = c.query + " => " + actual
+					continue
+				}
+
+				expected := c.expected
+				if expected != goldenError {
+					// Normalize hand-written expectations so key order and spacing do not matter
+					var doc bson.M
+					if err := bson.UnmarshalExtJSON([]byte(expected), false, &doc); err != nil {
+						t.Fatalf("%s:%d: invalid expected JSON %q: %v", file, c.line, expected, err)
+					}
+					if expected, err = canonicalExtJSON(doc); err != nil {
+						t.Fatalf("%s:%d: failed to marshal expected JSON: %v", file, c.line, err)
+					}
+				}
+				if actual != expected {
+					t.Errorf("%s:%d: %s\n  expected: %s\n  actual:   %s", file, c.line, c.query, expected, actual)
+				}
+			}
+
+			if *update {
+				if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+					t.Fatalf("Failed to update corpus: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// readGoldenFile returns the lines of a corpus file and the cases they define
+func readGoldenFile(path string) ([]string, []goldenCase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	var cases []goldenCase
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		lines = append(lines, line)
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		query, expected, ok := strings.Cut(trimmed, " => ")
+		if !ok {
+			// A bare query is filled in by -update
+			if !*update {
+				return nil, nil, fmt.Errorf("line %d: expected `query => expected`, got %q", len(lines), line)
+			}
+			query = trimmed
+		}
+		cases = append(cases, goldenCase{line: len(lines), query: strings.TrimSpace(query), expected: strings.TrimSpace(expected)})
+	}
+	return lines, cases, scanner.Err()
+}
+
+// canonicalExtJSON marshals a filter to relaxed extended JSON with every document's keys sorted,
+// so the output is deterministic regardless of map iteration order
+func canonicalExtJSON(filter bson.M) (string, error) {
+	data, err := bson.MarshalExtJSON(canonicalValue(filter), false, false)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// canonicalValue converts documents to bson.D with sorted keys and arrays to bson.A, recursively
+func canonicalValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.M:
+		doc := make(bson.D, 0, len(v))
+		for key, child := range v {
+			doc = append(doc, bson.E{Key: key, Value: canonicalValue(child)})
+		}
+		sort.Slice(doc, func(i, j int) bool { return doc[i].Key < doc[j].Key })
+		return doc
+	case bson.D:
+		m := bson.M{}
+		for _, e := range v {
+			m[e.Key] = e.Value
+		}
+		return canonicalValue(m)
+	case []bson.M:
+		arr := make(bson.A, len(v))
+		for i, child := range v {
+			arr[i] = canonicalValue(child)
+		}
+		return arr
+	case bson.A:
+		return canonicalValue([]interface{}(v))
+	case []interface{}:
+		arr := make(bson.A, len(v))
+		for i, child := range v {
+			arr[i] = canonicalValue(child)
+		}
+		return arr
+	}
+	return value
+}
@@ -1,74 +1,53 @@
-// Package lucene_mongo_test provides test utilities for BSON comparison and testing.
+// Package lucene_mongo_test provides test utilities for inspecting parse results.
 package lucene_mongo_test
 
 import (
-	"time"
-
+	"github.com/kyle-williams-1/bsonic"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
-// CompareBSONValues compares BSON values for testing
-func CompareBSONValues(actual, expected interface{}) bool {
-	// Handle time.Time comparison
-	if actualTime, ok := actual.(time.Time); ok {
-		return compareTimeValues(actualTime, expected)
-	}
-
-	// Handle bson.M comparison
-	if actualMap, ok := actual.(bson.M); ok {
-		return compareBSONMaps(actualMap, expected)
-	}
-
-	// Handle []bson.M comparison
-	if actualArray, ok := actual.([]bson.M); ok {
-		return compareBSONArrays(actualArray, expected)
-	}
-
-	// Default comparison
-	return actual == expected
+// javaScriptOperators are the operators that run server-side JavaScript, which no parse result may contain
+var javaScriptOperators = map[string]bool{"$where": true, "$function": true, "$accumulator": true}
+
+// findJavaScriptOperator returns the first server-side JavaScript operator used as a key anywhere in a
+// parse result's filter, sort, projection or stages, or "" if there is none
+func findJavaScriptOperator(result *bsonic.ParseResult) string {
+	doc := bson.M{
+		"filter":     result.Filter,
+		"sort":       result.Sort,
+		"projection": result.Projection,
+		"search":     result.SearchStage,
+		"score":      result.ScoreStage,
+		"lookups":    result.LookupStages,
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return ""
+	}
+	return findJavaScriptKey(raw)
 }
 
-// compareTimeValues compares time.Time values
-func compareTimeValues(actualTime time.Time, expected interface{}) bool {
-	expectedTime, ok := expected.(time.Time)
-	return ok && actualTime.Equal(expectedTime)
-}
-
-// compareBSONMaps compares bson.M values
-func compareBSONMaps(actualMap bson.M, expected interface{}) bool {
-	expectedMap, ok := expected.(bson.M)
-	if !ok {
-		return false
-	}
-
-	if len(actualMap) != len(expectedMap) {
-		return false
+// findJavaScriptKey searches a raw document and the documents and arrays nested in it
+func findJavaScriptKey(raw bson.Raw) string {
+	elements, err := raw.Elements()
+	if err != nil {
+		return ""
 	}
-
-	for key, expectedValue := range expectedMap {
-		actualValue, exists := actualMap[key]
-		if !exists || !CompareBSONValues(actualValue, expectedValue) {
-			return false
+	for _, element := range elements {
+		if javaScriptOperators[element.Key()] {
+			return element.Key()
 		}
-	}
-	return true
-}
-
-// compareBSONArrays compares []bson.M values
-func compareBSONArrays(actualArray []bson.M, expected interface{}) bool {
-	expectedArray, ok := expected.([]bson.M)
-	if !ok {
-		return false
-	}
-
-	if len(actualArray) != len(expectedArray) {
-		return false
-	}
-
-	for i, expectedValue := range expectedArray {
-		if !CompareBSONValues(actualArray[i], expectedValue) {
-			return false
+		value := element.Value()
+		if nested, ok := value.DocumentOK(); ok {
+			if key := findJavaScriptKey(nested); key != "" {
+				return key
+			}
+		}
+		if nested, ok := value.ArrayOK(); ok {
+			if key := findJavaScriptKey(bson.Raw(nested)); key != "" {
+				return key
+			}
 		}
 	}
-	return true
+	return ""
 }
@@ -0,0 +1,244 @@
+package lucene_mongo_test
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/participle/v2/lexer"
+	"github.com/kyle-williams-1/bsonic"
+	bsonic_config "github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/formatter/mongo"
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// propertyIterations is the number of random ASTs each property is checked against
+const propertyIterations = 2000
+
+// astGenerator builds random Lucene ASTs from a seeded source, so failures are reproducible
+type astGenerator struct {
+	rand *rand.Rand
+}
+
+func newASTGenerator(seed uint64) *astGenerator {
+	return &astGenerator{rand: rand.New(rand.NewPCG(seed, seed))}
+}
+
+func (g *astGenerator) pick(options ...string) string {
+	return options[g.rand.IntN(len(options))]
+}
+
+func (g *astGenerator) query() *lucene.ParticipleQuery {
+	q := &lucene.ParticipleQuery{Expression: g.expression(3)}
+	if g.rand.IntN(8) == 0 {
+		q.Directives = append(q.Directives, &lucene.ParticipleDirective{Name: "limit", Value: g.pick("1", "10", "50")})
+	}
+	return q
+}
+
+func (g *astGenerator) expression(depth int) *lucene.ParticipleExpression {
+	expr := &lucene.ParticipleExpression{}
+	for i := 0; i < 1+g.rand.IntN(3); i++ {
+		and := &lucene.ParticipleAndExpression{}
+		for j := 0; j < 1+g.rand.IntN(3); j++ {
+			and.And = append(and.And, g.operand(depth))
+		}
+		expr.Or = append(expr.Or, and)
+	}
+	return expr
+}
+
+func (g *astGenerator) operand(depth int) *lucene.ParticipleOperand {
+	if g.rand.IntN(5) == 0 {
+		return &lucene.ParticipleOperand{Not: g.operand(depth)}
+	}
+
+	term := &lucene.ParticipleTerm{}
+	switch n := g.rand.IntN(6); {
+	case n == 0 && depth > 0:
+		term.Group = &lucene.ParticipleGroup{Expression: g.expression(depth - 1)}
+	case n <= 1:
+		term.FreeText = g.freeText()
+	default:
+		term.FieldValue = &lucene.ParticipleFieldValue{Field: g.field(), Value: g.value()}
+	}
+	return &lucene.ParticipleOperand{Term: term}
+}
+
+func (g *astGenerator) field() string {
+	return g.pick("name", "age", "status", "id", "user.email", "profile.address.city", "created_at", "tags")
+}
+
+func (g *astGenerator) word() string {
+	return g.pick("john", "jane", "doe", "active", "30", "19.99", "true", "-5", "jo*", "*hn", "j*n", "507f1f77bcf86cd799439011", "2023-01-15", ">=18", "<65", "*", `AB\*12`, `\AND`, `\[x\]`)
+}
+
+func (g *astGenerator) text() string {
+	return g.pick("John Doe", "", `say "hi"`, "it's", `back\slash`, "tab\there", "café", "line\nbreak", "a:b (c) [d]", "AND OR NOT")
+}
+
+func (g *astGenerator) value() *lucene.ParticipleValue {
+	switch g.rand.IntN(8) {
+	case 0:
+		s := g.text()
+		return &lucene.ParticipleValue{String: &s}
+	case 1:
+		s := g.text()
+		return &lucene.ParticipleValue{SingleString: &s}
+	case 2:
+		s := g.pick("[1 TO 10]", "[* TO 100]", "[2023-01-01 TO 2023-12-31]", "[a TO z]")
+		return &lucene.ParticipleValue{Bracketed: &s}
+	case 3:
+		s := g.pick("2023-01-15T10:30:00Z", "2023-01-15 10:30:00", "2023-01-15T10:30:00.123+02:00")
+		return &lucene.ParticipleValue{DateTime: &s}
+	case 4:
+		s := g.pick("/^jo.*n$/", "/[a-z]+/", `/a\/b/`)
+		return &lucene.ParticipleValue{Regex: &s}
+	case 5:
+		return &lucene.ParticipleValue{TextTerms: []string{g.word(), g.word()}}
+	}
+	return &lucene.ParticipleValue{TextTerms: []string{g.word()}}
+}
+
+func (g *astGenerator) freeText() *lucene.ParticipleFreeText {
+	switch g.rand.IntN(4) {
+	case 0:
+		s := g.text()
+		qv := &lucene.ParticipleQuotedValue{String: &s}
+		if g.rand.IntN(3) == 0 {
+			lang := "~lang:" + g.pick("fr", "en", "de")
+			qv.Language = &lang
+		}
+		return &lucene.ParticipleFreeText{QuotedValue: qv}
+	case 1:
+		s := g.text()
+		return &lucene.ParticipleFreeText{QuotedValue: &lucene.ParticipleQuotedValue{SingleString: &s}}
+	case 2:
+		s := g.pick("/^jo.*n$/", "/doe/")
+		return &lucene.ParticipleFreeText{RegexValue: &s}
+	}
+	terms := []string{g.word()}
+	if g.rand.IntN(2) == 0 {
+		terms = append(terms, g.word())
+	}
+	return &lucene.ParticipleFreeText{UnquotedValue: &lucene.ParticipleUnquotedValue{TextTerms: terms}}
+}
+
+// clearPositions zeroes every lexer.Position in an AST, since unparsing does not preserve source positions
+func clearPositions(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			clearPositions(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			clearPositions(v.Index(i))
+		}
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(lexer.Position{}) {
+			v.Set(reflect.Zero(v.Type()))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			clearPositions(v.Field(i))
+		}
+	}
+}
+
+// TestLuceneMongoUnparseRoundTrip tests that parsing an unparsed AST returns the same AST
+func TestLuceneMongoUnparseRoundTrip(t *testing.T) {
+	parser := lucene.New()
+
+	for seed := uint64(0); seed < propertyIterations; seed++ {
+		ast := newASTGenerator(seed).query()
+		query := lucene.Unparse(ast)
+
+		parsed, err := parser.Parse(query)
+		if err != nil {
+			t.Fatalf("seed %d: failed to parse %q: %v", seed, query, err)
+		}
+		clearPositions(reflect.ValueOf(parsed))
+
+		if !reflect.DeepEqual(parsed, ast) {
+			t.Fatalf("seed %d: round trip of %q changed the AST\n  unparsed again: %q", seed, query, lucene.Unparse(parsed.(*lucene.ParticipleQuery)))
+		}
+	}
+}
+
+// TestLuceneMongoGeneratedBSONIsValid tests that every filter formatted from a generated AST can be marshaled
+func TestLuceneMongoGeneratedBSONIsValid(t *testing.T) {
+	formatter := mongo.New()
+
+	for seed := uint64(0); seed < propertyIterations; seed++ {
+		ast := newASTGenerator(seed).query()
+
+		filter, err := formatter.FormatWithDefaults(ast, []string{"name", "description"})
+		if err != nil {
+			// Invalid values such as unparseable dates are rejected, which is fine
+			continue
+		}
+		if _, err := bson.Marshal(filter); err != nil {
+			t.Fatalf("seed %d: filter for %q cannot be marshaled: %v\n  filter: %v", seed, lucene.Unparse(ast), err, filter)
+		}
+	}
+}
+
+// renameFields sets the field of every field:value term in an expression
+func renameFields(expr *lucene.ParticipleExpression, field string) {
+	for _, and := range expr.Or {
+		for _, operand := range and.And {
+			for operand.Not != nil {
+				operand = operand.Not
+			}
+			switch {
+			case operand.Term.FieldValue != nil:
+				operand.Term.FieldValue.Field = field
+			case operand.Term.Group != nil:
+				renameFields(operand.Term.Group.Expression, field)
+			}
+		}
+	}
+}
+
+// TestLuceneMongoGeneratedBSONHasNoJavaScript tests that no generated AST, even one naming server-side
+// JavaScript operators as fields, formats to a result running JavaScript, whatever the text search strategy
+func TestLuceneMongoGeneratedBSONHasNoJavaScript(t *testing.T) {
+	configs := []*bsonic_config.Config{
+		bsonic_config.Default().WithDefaultFields([]string{"name", "description"}),
+		bsonic_config.Default().WithWeightedDefaultFields(bsonic_config.Weighted{"name": 2, "description": 1}),
+		bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyTextIndex).WithTextScore(true),
+		bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch),
+	}
+	var parsers []*bsonic.Parser
+	for _, cfg := range configs {
+		parser, err := bsonic.NewWithConfig(cfg.WithOperatorAudit(true))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		parsers = append(parsers, parser)
+	}
+
+	for seed := uint64(0); seed < propertyIterations; seed++ {
+		ast := newASTGenerator(seed).query()
+		if seed%4 == 0 {
+			renameFields(ast.Expression, []string{"$where", "$function", "a.$where"}[seed/4%3])
+		}
+
+		for _, parser := range parsers {
+			result, err := parser.FormatAST(ast)
+			if err != nil {
+				// Invalid values and queries a strategy cannot express are rejected, which is fine
+				if strings.Contains(err.Error(), "operator audit") {
+					t.Fatalf("seed %d: %q failed the operator audit: %v", seed, lucene.Unparse(ast), err)
+				}
+				continue
+			}
+			if operator := findJavaScriptOperator(result); operator != "" {
+				t.Fatalf("seed %d: %q emitted %s", seed, lucene.Unparse(ast), operator)
+			}
+		}
+	}
+}
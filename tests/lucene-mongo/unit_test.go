@@ -1,13 +1,30 @@
 package lucene_mongo_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/kyle-williams-1/bsonic"
+	"github.com/kyle-williams-1/bsonic/advisor"
+	"github.com/kyle-williams-1/bsonic/bsonutil"
 	bsonic_config "github.com/kyle-williams-1/bsonic/config"
+	"github.com/kyle-williams-1/bsonic/formatter"
+	"github.com/kyle-williams-1/bsonic/formatter/mongo"
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"github.com/kyle-williams-1/bsonic/metrics"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 // createParserWithDefaults creates a parser with default fields for testing
@@ -35,7 +52,7 @@ func TestLuceneMongoBasicParsing(t *testing.T) {
 		}
 
 		expected := bson.M{"name": "john"}
-		if !CompareBSONValues(query, expected) {
+		if !bsonutil.Equal(query, expected) {
 			t.Fatalf("Expected %+v, got %+v", expected, query)
 		}
 	})
@@ -93,7 +110,7 @@ func TestLuceneMongoBasicParsing(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -258,7 +275,7 @@ func TestLuceneMongoBasicParsing(t *testing.T) {
 			},
 		}
 
-		if !CompareBSONValues(query, expected) {
+		if !bsonutil.Equal(query, expected) {
 			t.Fatalf("Expected %+v, got %+v", expected, query)
 		}
 	})
@@ -314,7 +331,7 @@ func TestLuceneMongoBasicParsing(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -357,7 +374,7 @@ func TestLuceneMongoLogicalOperators(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -372,34 +389,19 @@ func TestLuceneMongoLogicalOperators(t *testing.T) {
 			desc     string
 		}{
 			{
-				input: "name:john OR name:jane",
-				expected: bson.M{
-					"$or": []bson.M{
-						{"name": "john"},
-						{"name": "jane"},
-					},
-				},
-				desc: "simple OR",
+				input:    "name:john OR name:jane",
+				expected: bson.M{"name": bson.M{"$in": []interface{}{"john", "jane"}}},
+				desc:     "simple OR",
 			},
 			{
-				input: "age:25 OR age:30",
-				expected: bson.M{
-					"$or": []bson.M{
-						{"age": 25.0},
-						{"age": 30.0},
-					},
-				},
-				desc: "numeric OR",
+				input:    "age:25 OR age:30",
+				expected: bson.M{"age": bson.M{"$in": []interface{}{25.0, 30.0}}},
+				desc:     "numeric OR",
 			},
 			{
-				input: "status:active OR status:pending",
-				expected: bson.M{
-					"$or": []bson.M{
-						{"status": "active"},
-						{"status": "pending"},
-					},
-				},
-				desc: "status OR",
+				input:    "status:active OR status:pending",
+				expected: bson.M{"status": bson.M{"$in": []interface{}{"active", "pending"}}},
+				desc:     "status OR",
 			},
 			{
 				input: "  name:john  OR  age:25  ",
@@ -420,7 +422,7 @@ func TestLuceneMongoLogicalOperators(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -463,7 +465,7 @@ func TestLuceneMongoLogicalOperators(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -516,7 +518,7 @@ func TestLuceneMongoLogicalOperators(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -618,7 +620,7 @@ func TestLuceneMongoLogicalOperators(t *testing.T) {
 					t.Fatalf("Parse failed for query %q: %v", test.query, err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Query: %s\nExpected: %+v\nGot: %+v", test.query, test.expected, result)
 				}
 			})
@@ -626,6 +628,106 @@ func TestLuceneMongoLogicalOperators(t *testing.T) {
 	})
 }
 
+func TestLuceneMongoLowercaseOperators(t *testing.T) {
+	cfg := bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithLowercaseOperators(true)
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected bson.M
+		desc     string
+	}{
+		{
+			input:    "name:john and age:25",
+			expected: bson.M{"name": "john", "age": 25.0},
+			desc:     "lowercase and",
+		},
+		{
+			input:    "status:active Or status:pending",
+			expected: bson.M{"status": bson.M{"$in": []interface{}{"active", "pending"}}},
+			desc:     "mixed case or",
+		},
+		{
+			input:    "status:active and not role:guest",
+			expected: bson.M{"status": "active", "role": bson.M{"$ne": "guest"}},
+			desc:     "lowercase not",
+		},
+		{
+			input:    "role:(admin or user)",
+			expected: bson.M{"role": bson.M{"$in": []interface{}{"admin", "user"}}},
+			desc:     "value group",
+		},
+		{
+			input: "(a:1 or b:2) and c:3",
+			expected: bson.M{"$and": []bson.M{
+				{"$or": []bson.M{{"a": 1.0}, {"b": 2.0}}},
+				{"c": 3.0},
+			}},
+			desc: "groups",
+		},
+		{
+			input:    `"rock and roll"`,
+			expected: bson.M{"name": bson.M{"$regex": "^rock and roll$", "$options": "i"}},
+			desc:     "quoted word",
+		},
+		{
+			input:    "and:x AND field:or",
+			expected: bson.M{"and": "x", "field": "or"},
+			desc:     "field names and values",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result, err := parser.Parse(test.input)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !bsonutil.Equal(result, test.expected) {
+				t.Fatalf("Expected %+v, got %+v", test.expected, result)
+			}
+		})
+	}
+
+	t.Run("EscapedWord", func(t *testing.T) {
+		result, err := parser.Parse(`rock \and roll`)
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		if clauses, _ := result["$or"].([]bson.M); len(clauses) != 3 {
+			t.Errorf("expected the escaped word to stay free text, got %+v", result)
+		}
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		result, err := createParserWithDefaults([]string{"name"}).Parse("john and jane")
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		if clauses, _ := result["$or"].([]bson.M); len(clauses) != 3 {
+			t.Errorf("expected and to be free text by default, got %+v", result)
+		}
+	})
+
+	t.Run("LenientErrors", func(t *testing.T) {
+		lenient, err := bsonic.NewWithConfig(cfg.WithLenientErrors(true))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		result, err := lenient.ParseDetailed("role:admin and age:[1 TO")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if result.Filter["role"] != "admin" || len(result.Warnings) != 1 || result.Warnings[0].Clause != "age:[1 TO" {
+			t.Errorf("expected the broken clause to be dropped, got %+v with warnings %v", result.Filter, result.Warnings)
+		}
+	})
+}
+
 // TestLuceneMongoDateParsing tests date parsing functionality including various formats
 func TestLuceneMongoDateParsing(t *testing.T) {
 	parser := createParserWithDefaults([]string{"name"})
@@ -698,7 +800,7 @@ func TestLuceneMongoDateParsing(t *testing.T) {
 					t.Fatalf("Expected field %s not found", field)
 				}
 
-				if !CompareBSONValues(actualValue, test.expected[field]) {
+				if !bsonutil.Equal(actualValue, test.expected[field]) {
 					t.Fatalf("Expected %s=%v, got %s=%v", field, test.expected[field], field, actualValue)
 				}
 			})
@@ -749,7 +851,7 @@ func TestLuceneMongoDateParsing(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -808,7 +910,7 @@ func TestLuceneMongoDateParsing(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -852,7 +954,7 @@ func TestLuceneMongoDateParsing(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -918,7 +1020,7 @@ func TestLuceneMongoNumberRangeAndComparison(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -977,7 +1079,7 @@ func TestLuceneMongoNumberRangeAndComparison(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -1046,7 +1148,7 @@ func TestLuceneMongoNumberRangeAndComparison(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -1069,12 +1171,7 @@ func TestLuceneMongoParenthesesAndGrouping(t *testing.T) {
 				input: "(name:john OR name:jane) AND age:25",
 				expected: bson.M{
 					"$and": []bson.M{
-						{
-							"$or": []bson.M{
-								{"name": "john"},
-								{"name": "jane"},
-							},
-						},
+						{"name": bson.M{"$in": []interface{}{"john", "jane"}}},
 						{"age": 25.0},
 					},
 				},
@@ -1109,7 +1206,7 @@ func TestLuceneMongoParenthesesAndGrouping(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -1159,7 +1256,7 @@ func TestLuceneMongoParenthesesAndGrouping(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -1179,12 +1276,7 @@ func TestLuceneMongoParenthesesAndGrouping(t *testing.T) {
 					"$or": []bson.M{
 						{
 							"$and": []bson.M{
-								{
-									"$or": []bson.M{
-										{"name": "john"},
-										{"name": "jane"},
-									},
-								},
+								{"name": bson.M{"$in": []interface{}{"john", "jane"}}},
 								{"age": 25.0},
 							},
 						},
@@ -1203,12 +1295,7 @@ func TestLuceneMongoParenthesesAndGrouping(t *testing.T) {
 								{"name": bson.M{"$regex": "^ja.*"}},
 							},
 						},
-						{
-							"$or": []bson.M{
-								{"age": 25.0},
-								{"age": 30.0},
-							},
-						},
+						{"age": bson.M{"$in": []interface{}{25.0, 30.0}}},
 					},
 				},
 				desc: "grouped wildcards and numbers",
@@ -1217,12 +1304,7 @@ func TestLuceneMongoParenthesesAndGrouping(t *testing.T) {
 				input: "created_at:[2023-01-01 TO 2023-12-31] AND (status:active OR status:pending)",
 				expected: bson.M{
 					"$and": []bson.M{
-						{
-							"$or": []bson.M{
-								{"status": "active"},
-								{"status": "pending"},
-							},
-						},
+						{"status": bson.M{"$in": []interface{}{"active", "pending"}}},
 						{
 							"created_at": bson.M{
 								"$gte": time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
@@ -1242,7 +1324,7 @@ func TestLuceneMongoParenthesesAndGrouping(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -1285,18 +1367,8 @@ func TestLuceneMongoParenthesesAndGrouping(t *testing.T) {
 					"$or": []bson.M{
 						{
 							"$and": []bson.M{
-								{
-									"$or": []bson.M{
-										{"name": "john"},
-										{"name": "jane"},
-									},
-								},
-								{
-									"$or": []bson.M{
-										{"age": 25.0},
-										{"age": 30.0},
-									},
-								},
+								{"name": bson.M{"$in": []interface{}{"john", "jane"}}},
+								{"age": bson.M{"$in": []interface{}{25.0, 30.0}}},
 							},
 						},
 						{"status": "active"},
@@ -1331,12 +1403,8 @@ func TestLuceneMongoParenthesesAndGrouping(t *testing.T) {
 								{"name": bson.M{"$regex": "^ja.*"}},
 							},
 						},
-						{
-							"$and": []bson.M{
-								{"age": 65.0},
-								{"age": 18.0},
-							},
-						},
+						{"age": 65.0},
+						{"age": 18.0},
 					},
 				},
 				desc: "wildcards with numeric values",
@@ -1350,7 +1418,7 @@ func TestLuceneMongoParenthesesAndGrouping(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -1414,7 +1482,7 @@ func TestLuceneMongoParenthesesAndGrouping(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -1486,7 +1554,7 @@ func TestLuceneMongoPatternMatching(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -1567,7 +1635,7 @@ func TestLuceneMongoRegexPatterns(t *testing.T) {
 				t.Fatalf("Parse should not return error, got: %v", err)
 			}
 
-			if !CompareBSONValues(result, test.expected) {
+			if !bsonutil.Equal(result, test.expected) {
 				t.Fatalf("Expected %+v, got %+v", test.expected, result)
 			}
 		})
@@ -1659,7 +1727,7 @@ func TestLuceneMongoErrorConditions(t *testing.T) {
 					if err != nil {
 						t.Fatalf("Unexpected error for query: %s, got: %v", test.query, err)
 					}
-					if !CompareBSONValues(result, test.expected) {
+					if !bsonutil.Equal(result, test.expected) {
 						t.Fatalf("Query: %s\nExpected: %+v\nGot: %+v", test.query, test.expected, result)
 					}
 				}
@@ -1712,7 +1780,7 @@ func TestLuceneMongoTypeConversions(t *testing.T) {
 					t.Fatalf("Parse should not return error, got: %v", err)
 				}
 
-				if !CompareBSONValues(result, test.expected) {
+				if !bsonutil.Equal(result, test.expected) {
 					t.Fatalf("Expected %+v, got %+v", test.expected, result)
 				}
 			})
@@ -1819,16 +1887,12 @@ func TestLuceneMongoFreeTextSearch(t *testing.T) {
 			expected: bson.M{
 				"$and": []bson.M{
 					{
-						"$and": []bson.M{
-							{
-								"$or": []bson.M{
-									{"active": true},
-									{"role": "admin"},
-								},
-							},
-							{"status": "verified"},
+						"$or": []bson.M{
+							{"active": true},
+							{"role": "admin"},
 						},
 					},
+					{"status": "verified"},
 					{
 						"name": bson.M{
 							"$regex":   "^John Doe$",
@@ -1866,12 +1930,8 @@ func TestLuceneMongoFreeTextSearch(t *testing.T) {
 			query: `"John Doe" AND NOT (active:false OR role:guest)`,
 			expected: bson.M{
 				"$and": []bson.M{
-					{
-						"$and": []bson.M{
-							{"active": bson.M{"$ne": false}},
-							{"role": bson.M{"$ne": "guest"}},
-						},
-					},
+					{"active": bson.M{"$ne": false}},
+					{"role": bson.M{"$ne": "guest"}},
 					{
 						"name": bson.M{
 							"$regex":   "^John Doe$",
@@ -1917,21 +1977,12 @@ func TestLuceneMongoFreeTextSearch(t *testing.T) {
 			expected: bson.M{
 				"$and": []bson.M{
 					{
-						"$and": []bson.M{
-							{
-								"$or": []bson.M{
-									{"active": true},
-									{"role": "admin"},
-								},
-							},
-							{
-								"$or": []bson.M{
-									{"department": "IT"},
-									{"department": "Engineering"},
-								},
-							},
+						"$or": []bson.M{
+							{"active": true},
+							{"role": "admin"},
 						},
 					},
+					{"department": bson.M{"$in": []interface{}{"IT", "Engineering"}}},
 					{
 						"name": bson.M{
 							"$regex":   "^John Doe$",
@@ -2121,19 +2172,15 @@ func TestLuceneMongoFreeTextSearch(t *testing.T) {
 				"$or": []bson.M{
 					{"role": "admin"},
 					{
-						"$or": []bson.M{
-							{
-								"name": bson.M{
-									"$regex":   "^software$",
-									"$options": "i",
-								},
-							},
-							{
-								"name": bson.M{
-									"$regex":   "^engineer$",
-									"$options": "i",
-								},
-							},
+						"name": bson.M{
+							"$regex":   "^software$",
+							"$options": "i",
+						},
+					},
+					{
+						"name": bson.M{
+							"$regex":   "^engineer$",
+							"$options": "i",
 						},
 					},
 				},
@@ -2148,7 +2195,7 @@ func TestLuceneMongoFreeTextSearch(t *testing.T) {
 				t.Fatalf("Parse should not return error for %s, got: %v", tt.name, err)
 			}
 
-			if !CompareBSONValues(query, tt.expected) {
+			if !bsonutil.Equal(query, tt.expected) {
 				t.Fatalf("Test %s: Expected %+v, got %+v", tt.name, tt.expected, query)
 			}
 		})
@@ -2387,7 +2434,7 @@ func TestLuceneMongoDefaultFields(t *testing.T) {
 				t.Fatalf("ParseWithDefaults should not return error for %s, got: %v", tt.name, err)
 			}
 
-			if !CompareBSONValues(query, tt.expected) {
+			if !bsonutil.Equal(query, tt.expected) {
 				t.Fatalf("Test %s: Expected %+v, got %+v", tt.name, tt.expected, query)
 			}
 		})
@@ -2488,7 +2535,7 @@ func TestLuceneMongoConfigDefaultFields(t *testing.T) {
 					t.Fatalf("Parse should not return error for %s, got: %v", tt.name, err)
 				}
 
-				if !CompareBSONValues(query, tt.expected) {
+				if !bsonutil.Equal(query, tt.expected) {
 					t.Fatalf("Test %s: Expected %+v, got %+v", tt.name, tt.expected, query)
 				}
 			}
@@ -2530,3 +2577,6040 @@ func TestIDFieldConversionConfig(t *testing.T) {
 		}
 	})
 }
+
+// TestLuceneMongoAllowedFields tests that Lucene queries are validated against the field allowlist
+func TestLuceneMongoAllowedFields(t *testing.T) {
+	cfg := bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithAllowedFields([]string{"name", "age", "user"})
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		query       string
+		expectError bool
+		desc        string
+	}{
+		{"name:john AND age:25", false, "allowed fields"},
+		{"user.profile.email:john@example.com", false, "nested allowed field"},
+		{"john", false, "free text over allowed default field"},
+		{"name:john OR password:secret", true, "disallowed field under OR"},
+		{"NOT (name:john AND secret:x)", true, "disallowed field under NOT"},
+		{"username:john", true, "field sharing an allowed prefix"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := parser.Parse(test.query)
+			if test.expectError {
+				if err == nil {
+					t.Fatalf("Expected error for query: %s", test.query)
+				}
+				if !strings.Contains(err.Error(), "field not allowed") {
+					t.Fatalf("Expected field not allowed error, got: %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error for query: %s, got: %v", test.query, err)
+			}
+		})
+	}
+}
+
+// TestLuceneMongoDirectives tests trailing sort, limit and fields directives
+func TestLuceneMongoDirectives(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	t.Run("FullFindSpecification", func(t *testing.T) {
+		result, err := parser.ParseDetailed("role:admin | sort:-created_at,name | limit:50 | fields:name,email")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+
+		if !bsonutil.Equal(result.Filter, bson.M{"role": "admin"}) {
+			t.Fatalf("Expected filter %+v, got %+v", bson.M{"role": "admin"}, result.Filter)
+		}
+
+		expectedSort := bson.D{{Key: "created_at", Value: -1}, {Key: "name", Value: 1}}
+		if len(result.Sort) != len(expectedSort) {
+			t.Fatalf("Expected sort %+v, got %+v", expectedSort, result.Sort)
+		}
+		for i, key := range expectedSort {
+			if result.Sort[i] != key {
+				t.Fatalf("Expected sort %+v, got %+v", expectedSort, result.Sort)
+			}
+		}
+
+		if result.Limit != 50 {
+			t.Fatalf("Expected limit 50, got %d", result.Limit)
+		}
+
+		expectedProjection := bson.M{"name": 1, "email": 1}
+		if !bsonutil.Equal(result.Projection, expectedProjection) {
+			t.Fatalf("Expected projection %+v, got %+v", expectedProjection, result.Projection)
+		}
+	})
+
+	t.Run("DirectivesOnly", func(t *testing.T) {
+		result, err := parser.ParseDetailed("| sort:+id | fields:-password,-_id")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+
+		if len(result.Filter) != 0 {
+			t.Fatalf("Expected empty filter, got %+v", result.Filter)
+		}
+		if len(result.Sort) != 1 || result.Sort[0] != (bson.E{Key: "_id", Value: 1}) {
+			t.Fatalf("Expected sort on _id, got %+v", result.Sort)
+		}
+		if !bsonutil.Equal(result.Projection, bson.M{"password": 0, "_id": 0}) {
+			t.Fatalf("Expected exclusion projection, got %+v", result.Projection)
+		}
+	})
+
+	t.Run("ParseReturnsFilterOnly", func(t *testing.T) {
+		result, err := parser.Parse("(name:john OR name:jane) AND age:25 | limit:10")
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+
+		expected := bson.M{"$and": []bson.M{{"name": bson.M{"$in": []interface{}{"john", "jane"}}}, {"age": 25.0}}}
+		if !bsonutil.Equal(result, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, result)
+		}
+	})
+
+	t.Run("NoDirectives", func(t *testing.T) {
+		result, err := parser.ParseDetailed("name:john")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if result.Sort != nil || result.Limit != 0 || result.Projection != nil {
+			t.Fatalf("Expected no directives, got %+v", result)
+		}
+	})
+
+	t.Run("InvalidDirectives", func(t *testing.T) {
+		tests := []struct {
+			query        string
+			errorMessage string
+		}{
+			{"name:john | limit:0", "invalid limit directive"},
+			{"name:john | limit:ten", "invalid limit directive"},
+			{"name:john | sort:-", "invalid sort directive"},
+			{"name:john | fields:name,-email", "cannot mix included and excluded fields"},
+			{"name:john | group:role", "unknown directive: group"},
+		}
+
+		for _, test := range tests {
+			t.Run(test.query, func(t *testing.T) {
+				_, err := parser.ParseDetailed(test.query)
+				if err == nil {
+					t.Fatalf("Expected error for query: %s", test.query)
+				}
+				if !strings.Contains(err.Error(), test.errorMessage) {
+					t.Fatalf("Expected error message to contain '%s', got: %v", test.errorMessage, err)
+				}
+			})
+		}
+	})
+
+	t.Run("DirectiveFieldsRespectAllowlist", func(t *testing.T) {
+		cfg := bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithAllowedFields([]string{"name"})
+		restricted, _ := bsonic.NewWithConfig(cfg)
+
+		if _, err := restricted.ParseDetailed("name:john | sort:password"); err == nil {
+			t.Fatal("Expected error for sort on disallowed field")
+		}
+		if _, err := restricted.ParseDetailed("name:john | fields:password"); err == nil {
+			t.Fatal("Expected error for projection of disallowed field")
+		}
+	})
+}
+
+// TestLuceneMongoParseProjection tests the projection parser for client-selected fields
+func TestLuceneMongoParseProjection(t *testing.T) {
+	tests := []struct {
+		name       string
+		fields     string
+		projection bson.M
+	}{
+		{"Prefixed", "fields: name, email, profile.location", bson.M{"name": 1, "email": 1, "profile.location": 1}},
+		{"Unprefixed", "name,email", bson.M{"name": 1, "email": 1}},
+		{"Exclusions", "FIELDS: -password, -_id", bson.M{"password": 0, "_id": 0}},
+		{"ID", "id, name, -_id", bson.M{"_id": 0, "name": 1}},
+		{"Empty", "  ", bson.M{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projection, err := bsonic.ParseProjection(tt.fields)
+			if err != nil {
+				t.Fatalf("ParseProjection(%q) should not return error, got: %v", tt.fields, err)
+			}
+			if !reflect.DeepEqual(projection, tt.projection) {
+				t.Errorf("ParseProjection(%q): expected %v, got %v", tt.fields, tt.projection, projection)
+			}
+		})
+	}
+
+	t.Run("MixedIncludeExclude", func(t *testing.T) {
+		_, err := bsonic.ParseProjection("fields: name, -email")
+		if err == nil || !strings.Contains(err.Error(), "cannot mix included and excluded fields") {
+			t.Errorf("Expected a mixed projection error, got %v", err)
+		}
+	})
+
+	t.Run("InvalidField", func(t *testing.T) {
+		if _, err := bsonic.ParseProjection("name, $where"); !errors.Is(err, bsonic.ErrSyntax) {
+			t.Errorf("Expected ErrSyntax, got %v", err)
+		}
+	})
+
+	t.Run("Allowlist", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithAllowedFields([]string{"name", "profile"}))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := parser.ParseProjection("name, profile.location"); err != nil {
+			t.Errorf("Expected allowed fields to pass, got %v", err)
+		}
+		if _, err := parser.ParseProjection("name, password"); !errors.Is(err, bsonic.ErrDisallowedField) {
+			t.Errorf("Expected ErrDisallowedField, got %v", err)
+		}
+	})
+
+	t.Run("Schema", func(t *testing.T) {
+		cfg := bsonic_config.Default().WithFieldTypes(map[string]bsonic_config.FieldType{
+			"name":             bsonic_config.FieldTypeString,
+			"profile.location": bsonic_config.FieldTypeString,
+		})
+		parser, err := bsonic.NewWithConfig(cfg)
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := parser.ParseProjection("name, profile.location, -_id"); err != nil {
+			t.Errorf("Expected typed fields to pass, got %v", err)
+		}
+		if _, err := parser.ParseProjection("profile"); err != nil {
+			t.Errorf("Expected an object holding a typed field to pass, got %v", err)
+		}
+		var fieldErr *bsonic.FieldError
+		if _, err := parser.ParseProjection("name, nickname"); !errors.As(err, &fieldErr) || fieldErr.Field != "nickname" {
+			t.Errorf("Expected a FieldError for nickname, got %v", err)
+		}
+	})
+}
+
+// TestLuceneMongoParseSort tests the sort parser for client-selected sort orders
+func TestLuceneMongoParseSort(t *testing.T) {
+	tests := []struct {
+		name string
+		sort string
+		keys bson.D
+	}{
+		{"Directions", "-created_at,+name", bson.D{{Key: "created_at", Value: -1}, {Key: "name", Value: 1}}},
+		{"Prefixed", "sort: -score, id", bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}},
+		{"Nested", "profile.age", bson.D{{Key: "profile.age", Value: 1}}},
+		{"SpaceAfterSign", "- created_at, + name", bson.D{{Key: "created_at", Value: -1}, {Key: "name", Value: 1}}},
+		{"Empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := bsonic.ParseSort(tt.sort)
+			if err != nil {
+				t.Fatalf("ParseSort(%q) should not return error, got: %v", tt.sort, err)
+			}
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("ParseSort(%q): expected %v, got %v", tt.sort, tt.keys, keys)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, sort := range []string{"-", "name,-", "$where", "a..b", "- ", "-name,+name", "name,name", "id,-_id"} {
+			if _, err := bsonic.ParseSort(sort); !errors.Is(err, bsonic.ErrSyntax) {
+				t.Errorf("ParseSort(%q): expected ErrSyntax, got %v", sort, err)
+			}
+		}
+	})
+
+	t.Run("Allowlist", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithAllowedFields([]string{"name", "created_at"}))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := parser.ParseSort("-created_at,name"); err != nil {
+			t.Errorf("Expected allowed fields to pass, got %v", err)
+		}
+		if _, err := parser.ParseSort("-created_at,salary"); !errors.Is(err, bsonic.ErrDisallowedField) {
+			t.Errorf("Expected ErrDisallowedField, got %v", err)
+		}
+	})
+}
+
+// TestLuceneMongoParseUpdate tests the update parser for bulk updates
+func TestLuceneMongoParseUpdate(t *testing.T) {
+	archivedAt := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	ownerID, _ := bson.ObjectIDFromHex("507f1f77bcf86cd799439011")
+	tests := []struct {
+		name   string
+		update string
+		doc    bson.M
+	}{
+		{"AllOperators", "SET status:archived, INC retry_count:1, UNSET temp_field", bson.M{
+			"$set":   bson.M{"status": "archived"},
+			"$inc":   bson.M{"retry_count": int32(1)},
+			"$unset": bson.M{"temp_field": ""},
+		}},
+		{"CarriedOperator", `SET status:archived, note:"moved, then archived", archived_at:2024-01-15`, bson.M{
+			"$set": bson.M{"status": "archived", "note": "moved, then archived", "archived_at": archivedAt},
+		}},
+		{"Values", "SET active:false, count:int(5), ratio:0.5, owner_id:507f1f77bcf86cd799439011", bson.M{
+			"$set": bson.M{"active": false, "count": int32(5), "ratio": 0.5, "owner_id": ownerID},
+		}},
+		{"Increments", "INC a:-2, b:1.5, c:5000000000, d:long(3)", bson.M{
+			"$inc": bson.M{"a": int32(-2), "b": 1.5, "c": int64(5000000000), "d": int64(3)},
+		}},
+		{"Unsets", "UNSET temp, profile.cache, owner.id", bson.M{"$unset": bson.M{"temp": "", "profile.cache": "", "owner._id": ""}}},
+		{"CurlyQuotes", "SET note:“moved, then archived”", bson.M{"$set": bson.M{"note": "moved, then archived"}}},
+		{"SiblingPaths", "SET a.b:1, a.bc:2, ab:3", bson.M{"$set": bson.M{"a.b": 1.0, "a.bc": 2.0, "ab": 3.0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := bsonic.ParseUpdate(tt.update)
+			if err != nil {
+				t.Fatalf("ParseUpdate(%q) should not return error, got: %v", tt.update, err)
+			}
+			if !reflect.DeepEqual(doc, tt.doc) {
+				t.Errorf("ParseUpdate(%q): expected %v, got %v", tt.update, tt.doc, doc)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			update string
+			err    string
+		}{
+			{"", "no fields to update"},
+			{"status:archived", "clauses must start with SET, INC or UNSET"},
+			{"SET", "SET needs a field"},
+			{"SET name:jo*", "SET needs a single value"},
+			{"SET age:[1 TO 5]", "SET needs a single field:value"},
+			{"SET name:John Doe", "SET needs a single field:value"},
+			{"SET a:1 AND b:2", "SET needs a single field:value"},
+			{"SET a:1, INC a:1", "a is updated more than once"},
+			{"SET a:1, UNSET a.b", "a.b conflicts with a"},
+			{"SET a:1, INC a.n:1", "a.n conflicts with a"},
+			{"INC a.n:1, UNSET a", "a conflicts with a.n"},
+			{"INC retry_count:many", "INC retry_count needs a number"},
+			{"UNSET $where", "field names cannot start with $"},
+			{"UNSET temp field", "field names cannot contain spaces"},
+			{"UNSET _id", "_id cannot be updated"},
+			{"SET id:507f1f77bcf86cd799439011", "_id cannot be updated"},
+		}
+		for _, tt := range tests {
+			_, err := bsonic.ParseUpdate(tt.update)
+			if !errors.Is(err, bsonic.ErrSyntax) || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseUpdate(%q): expected a syntax error containing %q, got %v", tt.update, tt.err, err)
+			}
+		}
+	})
+
+	t.Run("Allowlist", func(t *testing.T) {
+		cfg := bsonic_config.Default().
+			WithAllowedFields([]string{"status", "retry_count", "temp"}).
+			WithEnumField("status", "active", "archived")
+		parser, err := bsonic.NewWithConfig(cfg)
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := parser.ParseUpdate("SET status:archived, INC retry_count:1, UNSET temp"); err != nil {
+			t.Errorf("Expected allowed fields to pass, got %v", err)
+		}
+		for _, update := range []string{"SET role:admin", "INC balance:100", "UNSET password"} {
+			if _, err := parser.ParseUpdate(update); !errors.Is(err, bsonic.ErrDisallowedField) {
+				t.Errorf("ParseUpdate(%q): expected ErrDisallowedField, got %v", update, err)
+			}
+		}
+		var enumErr *bsonic.EnumError
+		if _, err := parser.ParseUpdate("SET status:deleted"); !errors.As(err, &enumErr) {
+			t.Errorf("Expected an EnumError, got %v", err)
+		}
+	})
+	t.Run("ConfiguredLanguage", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithLanguage(bsonic_config.LanguageMQL))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := parser.ParseUpdate("SET status:archived"); err == nil {
+			t.Error("Expected an error for an update with the MQL language configured")
+		}
+	})
+}
+
+// TestLuceneMongoKeysetPagination tests keyset-pagination filters built from parsed sort directives
+func TestLuceneMongoKeysetPagination(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+	lastID, _ := bson.ObjectIDFromHex("507f1f77bcf86cd799439011")
+
+	t.Run("SingleSortKey", func(t *testing.T) {
+		result, err := parser.ParseDetailed("role:admin | sort:-created_at")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+
+		sort := result.KeysetSort()
+		expectedSort := bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: 1}}
+		if len(sort) != 2 || sort[0] != expectedSort[0] || sort[1] != expectedSort[1] {
+			t.Fatalf("Expected keyset sort %+v, got %+v", expectedSort, sort)
+		}
+
+		createdAt := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+		filter, err := result.NextPageFilter(bson.M{"_id": lastID, "created_at": createdAt, "role": "admin"})
+		if err != nil {
+			t.Fatalf("NextPageFilter should not return error, got: %v", err)
+		}
+
+		expected := bson.M{
+			"$and": []bson.M{
+				{"role": "admin"},
+				{"$or": []bson.M{
+					{"created_at": bson.M{"$lt": createdAt}},
+					{"created_at": createdAt, "_id": bson.M{"$gt": lastID}},
+				}},
+			},
+		}
+		if !bsonutil.Equal(filter, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, filter)
+		}
+	})
+
+	t.Run("IDSortWithoutFilter", func(t *testing.T) {
+		result, err := parser.ParseDetailed("| sort:-id")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+
+		filter, err := result.NextPageFilter(bson.M{"_id": lastID})
+		if err != nil {
+			t.Fatalf("NextPageFilter should not return error, got: %v", err)
+		}
+
+		expected := bson.M{"_id": bson.M{"$lt": lastID}}
+		if !bsonutil.Equal(filter, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, filter)
+		}
+	})
+
+	t.Run("NestedSortKey", func(t *testing.T) {
+		result, err := parser.ParseDetailed("| sort:profile.score")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+
+		filter, err := result.NextPageFilter(bson.M{"_id": lastID, "profile": bson.M{"score": 42.0}})
+		if err != nil {
+			t.Fatalf("NextPageFilter should not return error, got: %v", err)
+		}
+
+		expected := bson.M{"$or": []bson.M{
+			{"profile.score": bson.M{"$gt": 42.0}},
+			{"profile.score": 42.0, "_id": bson.M{"$gt": lastID}},
+		}}
+		if !bsonutil.Equal(filter, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, filter)
+		}
+	})
+
+	t.Run("MissingSortField", func(t *testing.T) {
+		result, err := parser.ParseDetailed("role:admin | sort:created_at")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+
+		_, err = result.NextPageFilter(bson.M{"_id": lastID})
+		if err == nil || !strings.Contains(err.Error(), "missing sort field: created_at") {
+			t.Fatalf("Expected missing sort field error, got: %v", err)
+		}
+	})
+}
+
+// TestLuceneMongoIntentPrefixes tests COUNT and DISTINCT query prefixes
+func TestLuceneMongoIntentPrefixes(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	tests := []struct {
+		query         string
+		intent        bsonic.Intent
+		distinctField string
+		filter        bson.M
+		desc          string
+	}{
+		{"role:admin", bsonic.IntentFind, "", bson.M{"role": "admin"}, "no prefix"},
+		{"COUNT WHERE role:admin", bsonic.IntentCount, "", bson.M{"role": "admin"}, "count with filter"},
+		{"COUNT", bsonic.IntentCount, "", bson.M{}, "count everything"},
+		{"DISTINCT email WHERE active:true", bsonic.IntentDistinct, "email", bson.M{"active": true}, "distinct with filter"},
+		{"DISTINCT user.id", bsonic.IntentDistinct, "user._id", bson.M{}, "distinct with id conversion"},
+		{"COUNT WHERE name:john OR name:jane", bsonic.IntentCount, "", bson.M{"name": bson.M{"$in": []interface{}{"john", "jane"}}}, "count with OR"},
+		{"COUNTRY:us", bsonic.IntentFind, "", bson.M{"COUNTRY": "us"}, "keyword prefix of a field name"},
+		{"in:orders COUNT WHERE role:admin", bsonic.IntentCount, "", bson.M{"role": "admin"}, "count after a routing prefix"},
+		{"count where", bsonic.IntentFind, "", bson.M{"$or": []bson.M{
+			{"name": bson.M{"$regex": "^count$", "$options": "i"}},
+			{"name": bson.M{"$regex": "^where$", "$options": "i"}},
+		}}, "lowercase keywords as search terms"},
+		{"john COUNT", bsonic.IntentFind, "", bson.M{"$or": []bson.M{
+			{"name": bson.M{"$regex": "^john$", "$options": "i"}},
+			{"name": bson.M{"$regex": "^COUNT$", "$options": "i"}},
+		}}, "keyword after the start as a search term"},
+		{"WHERE", bsonic.IntentFind, "", bson.M{"name": bson.M{"$regex": "^WHERE$", "$options": "i"}}, "WHERE without an intent as a search term"},
+		{"status:open WHERE", bsonic.IntentFind, "", bson.M{"$or": []bson.M{
+			{"status": "open"},
+			{"name": bson.M{"$regex": "^WHERE$", "$options": "i"}},
+		}}, "WHERE after a clause as a search term"},
+		{"name:COUNT", bsonic.IntentFind, "", bson.M{"name": "COUNT"}, "keyword as a value"},
+		{"COUNT:5", bsonic.IntentFind, "", bson.M{"COUNT": 5.0}, "keyword as a field name"},
+		{"COUNT WHERE name:DISTINCT", bsonic.IntentCount, "", bson.M{"name": "DISTINCT"}, "keyword as a value after an intent"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result, err := parser.ParseDetailed(test.query)
+			if err != nil {
+				t.Fatalf("ParseDetailed should not return error, got: %v", err)
+			}
+
+			if result.Intent != test.intent {
+				t.Fatalf("Expected intent %q, got %q", test.intent, result.Intent)
+			}
+			if result.DistinctField != test.distinctField {
+				t.Fatalf("Expected distinct field %q, got %q", test.distinctField, result.DistinctField)
+			}
+			if !bsonutil.Equal(result.Filter, test.filter) {
+				t.Fatalf("Expected filter %+v, got %+v", test.filter, result.Filter)
+			}
+		})
+	}
+
+	t.Run("EmptyQueryIsFind", func(t *testing.T) {
+		result, err := parser.ParseDetailed("")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if result.Intent != bsonic.IntentFind {
+			t.Fatalf("Expected intent %q, got %q", bsonic.IntentFind, result.Intent)
+		}
+	})
+
+	t.Run("DistinctFieldRespectsAllowlist", func(t *testing.T) {
+		cfg := bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithAllowedFields([]string{"name"})
+		restricted, _ := bsonic.NewWithConfig(cfg)
+
+		if _, err := restricted.ParseDetailed("DISTINCT password WHERE name:john"); err == nil {
+			t.Fatal("Expected error for DISTINCT on disallowed field")
+		}
+	})
+}
+
+// TestLuceneMongoExplain tests the clause-to-BSON mapping returned by Explain
+func TestLuceneMongoExplain(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	t.Run("ClauseSpansAndFragments", func(t *testing.T) {
+		query := `role:admin AND NOT (status:banned OR "john doe") | limit:5`
+		explanation, err := parser.Explain(query)
+		if err != nil {
+			t.Fatalf("Explain should not return error, got: %v", err)
+		}
+
+		expectedFilter, err := parser.Parse(query)
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		if !bsonutil.Equal(explanation.Filter, expectedFilter) {
+			t.Fatalf("Expected filter %+v, got %+v", expectedFilter, explanation.Filter)
+		}
+
+		expected := []struct {
+			kind    string
+			text    string
+			negated bool
+			bson    bson.M
+		}{
+			{"field", "role:admin", false, bson.M{"role": "admin"}},
+			{"field", "status:banned", true, bson.M{"status": "banned"}},
+			{"free_text", `"john doe"`, true, bson.M{"name": bson.M{"$regex": "^john doe$", "$options": "i"}}},
+		}
+
+		if len(explanation.Clauses) != len(expected) {
+			t.Fatalf("Expected %d clauses, got %d: %+v", len(expected), len(explanation.Clauses), explanation.Clauses)
+		}
+
+		for i, exp := range expected {
+			clause := explanation.Clauses[i]
+			if clause.Kind != exp.kind || clause.Text != exp.text || clause.Negated != exp.negated {
+				t.Fatalf("Clause %d: expected %s %q negated=%v, got %s %q negated=%v", i, exp.kind, exp.text, exp.negated, clause.Kind, clause.Text, clause.Negated)
+			}
+			if query[clause.Start:clause.End] != exp.text {
+				t.Fatalf("Clause %d: span [%d:%d] does not match %q", i, clause.Start, clause.End, exp.text)
+			}
+			if !bsonutil.Equal(clause.BSON, exp.bson) {
+				t.Fatalf("Clause %d: expected BSON %+v, got %+v", i, exp.bson, clause.BSON)
+			}
+		}
+	})
+
+	t.Run("EmptyQuery", func(t *testing.T) {
+		explanation, err := parser.Explain("  ")
+		if err != nil {
+			t.Fatalf("Explain should not return error, got: %v", err)
+		}
+		if len(explanation.Filter) != 0 || len(explanation.Clauses) != 0 {
+			t.Fatalf("Expected empty explanation, got %+v", explanation)
+		}
+	})
+
+	t.Run("SyntaxError", func(t *testing.T) {
+		if _, err := parser.Explain("name:john AND"); err == nil {
+			t.Fatal("Explain should return error for invalid syntax")
+		}
+	})
+
+	t.Run("MatchesParseDetailed", func(t *testing.T) {
+		cfg := bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithAllowedFields([]string{"user.name", "role"}).
+			WithDeprecatedField("username", "user.name")
+		parser, err := bsonic.NewWithConfig(cfg)
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+
+		explanation, err := parser.Explain("username:john AND role:admin")
+		if err != nil {
+			t.Fatalf("Explain should not return error, got: %v", err)
+		}
+		result, err := parser.ParseDetailed("username:john AND role:admin")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if !bsonutil.Equal(explanation.Filter, result.Filter) {
+			t.Fatalf("Expected filter %+v, got %+v", result.Filter, explanation.Filter)
+		}
+		if !bsonutil.Equal(explanation.Clauses[0].BSON, bson.M{"user.name": "john"}) {
+			t.Errorf("Expected the fragment to use the renamed field, got %+v", explanation.Clauses[0].BSON)
+		}
+
+		if _, err := parser.Explain("password:secret"); !errors.Is(err, bsonic.ErrDisallowedField) {
+			t.Errorf("Expected ErrDisallowedField, got %v", err)
+		}
+	})
+}
+
+// TestLuceneMongoTextSearchStrategy tests that the configured text search strategy is honored by every entry point
+func TestLuceneMongoTextSearchStrategy(t *testing.T) {
+	t.Run("TextIndexWithDefaultFields", func(t *testing.T) {
+		cfg := bsonic_config.Default().WithDefaultFields([]string{"name"}).WithTextSearchStrategy(bsonic_config.StrategyTextIndex)
+		parser, err := bsonic.NewWithConfig(cfg)
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+
+		expected := bson.M{"$and": []bson.M{{"$text": bson.M{"$search": "john"}}, {"role": "admin"}}}
+		for name, parse := range map[string]func() (bson.M, error){
+			"Parse":             func() (bson.M, error) { return parser.Parse("john AND role:admin") },
+			"ParseWithDefaults": func() (bson.M, error) { return parser.ParseWithDefaults([]string{"name"}, "john AND role:admin") },
+		} {
+			result, err := parse()
+			if err != nil {
+				t.Fatalf("%s should not return error, got: %v", name, err)
+			}
+			if !bsonutil.Equal(result, expected) {
+				t.Fatalf("%s: expected %+v, got %+v", name, expected, result)
+			}
+		}
+	})
+
+	t.Run("TextIndexWithoutDefaultFields", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyTextIndex))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+
+		result, err := parser.Parse(`"john doe"`)
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		expected := bson.M{"$text": bson.M{"$search": `"john doe"`}}
+		if !bsonutil.Equal(result, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, result)
+		}
+	})
+
+	t.Run("RegexFieldsRequiresDefaultFields", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default())
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := parser.Parse("john"); err == nil {
+			t.Fatal("Parse should return error for free text without default fields")
+		}
+	})
+
+	t.Run("AtlasSearch", func(t *testing.T) {
+		cfg := bsonic_config.Default().
+			WithDefaultFields([]string{"name", "bio"}).
+			WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch).
+			WithAtlasSearchIndex("people")
+		parser, err := bsonic.NewWithConfig(cfg)
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+
+		result, err := parser.ParseDetailed(`john AND role:admin AND NOT "on leave" | limit:10`)
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+
+		if !bsonutil.Equal(result.Filter, bson.M{"role": "admin"}) {
+			t.Fatalf("Expected filter without free text, got %+v", result.Filter)
+		}
+
+		path := []string{"name", "bio"}
+		expectedStage := bson.M{"$search": bson.M{
+			"index": "people",
+			"compound": bson.M{
+				"must":    []bson.M{{"text": bson.M{"query": "john", "path": path}}},
+				"mustNot": []bson.M{{"phrase": bson.M{"query": "on leave", "path": path}}},
+			},
+		}}
+		if !reflect.DeepEqual(result.SearchStage, expectedStage) {
+			t.Fatalf("Expected search stage %+v, got %+v", expectedStage, result.SearchStage)
+		}
+
+		pipeline := result.Pipeline()
+		if len(pipeline) != 3 {
+			t.Fatalf("Expected $search, $match and $limit stages, got %+v", pipeline)
+		}
+		if _, ok := pipeline[0]["$search"]; !ok {
+			t.Fatalf("Expected $search as the first stage, got %+v", pipeline[0])
+		}
+	})
+
+	t.Run("AtlasSearchWildcardPath", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+
+		result, err := parser.ParseDetailed("laptop")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+
+		expectedStage := bson.M{"$search": bson.M{"text": bson.M{"query": "laptop", "path": bson.M{"wildcard": "*"}}}}
+		if !reflect.DeepEqual(result.SearchStage, expectedStage) {
+			t.Fatalf("Expected search stage %+v, got %+v", expectedStage, result.SearchStage)
+		}
+		if len(result.Filter) != 0 {
+			t.Fatalf("Expected empty filter, got %+v", result.Filter)
+		}
+	})
+
+	t.Run("AtlasSearchRejectsUnsupportedShapes", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+
+		for _, query := range []string{
+			"john OR role:admin",
+			"name:john doe",
+			"NOT (john AND role:admin)",
+		} {
+			if _, err := parser.ParseDetailed(query); err == nil {
+				t.Errorf("ParseDetailed(%q) should return error", query)
+			}
+		}
+	})
+
+	t.Run("AtlasSearchFreeTextOr", func(t *testing.T) {
+		cfg := bsonic_config.Default().WithDefaultFields([]string{"name"}).WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch)
+		parser, err := bsonic.NewWithConfig(cfg)
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+
+		alternatives := bson.M{"compound": bson.M{
+			"should": []bson.M{
+				{"phrase": bson.M{"query": "John Doe", "path": "name"}},
+				{"phrase": bson.M{"query": "Jane Smith", "path": "name"}},
+			},
+			"minimumShouldMatch": 1,
+		}}
+		tests := []struct {
+			query          string
+			expectedStage  bson.M
+			expectedFilter bson.M
+		}{
+			{`("John Doe" OR "Jane Smith")`, bson.M{"$search": alternatives}, bson.M{}},
+			{`(("John Doe" OR "Jane Smith")) AND role:admin`, bson.M{"$search": alternatives}, bson.M{"role": "admin"}},
+			{`NOT ("John Doe" OR "Jane Smith") AND role:admin`, bson.M{"$search": bson.M{"compound": bson.M{"mustNot": []bson.M{alternatives}}}},
+				bson.M{"role": "admin"}},
+		}
+		for _, tt := range tests {
+			result, err := parser.ParseDetailed(tt.query)
+			if err != nil {
+				t.Fatalf("ParseDetailed(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(result.SearchStage, tt.expectedStage) {
+				t.Errorf("ParseDetailed(%q): expected search stage %v, got %v", tt.query, tt.expectedStage, result.SearchStage)
+			}
+			if !reflect.DeepEqual(result.Filter, tt.expectedFilter) {
+				t.Errorf("ParseDetailed(%q): expected filter %v, got %v", tt.query, tt.expectedFilter, result.Filter)
+			}
+		}
+	})
+
+	t.Run("TextIndexFreeTextOr", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyTextIndex))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+
+		tests := []struct {
+			query    string
+			expected bson.M
+		}{
+			{"(john OR jane)", bson.M{"$text": bson.M{"$search": "john jane"}}},
+			{"((john OR jane) OR joe) AND NOT doe", bson.M{"$text": bson.M{"$search": "john jane joe -doe"}}},
+		}
+		for _, tt := range tests {
+			filter, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(filter, tt.expected) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.expected, filter)
+			}
+		}
+
+		// MongoDB only allows $text under $or when every clause uses an index
+		_, err = parser.Parse("john OR jane OR role:admin")
+		var orErr *formatter.FeatureError
+		if !errors.As(err, &orErr) || orErr.Feature != formatter.FeatureFreeTextOr {
+			t.Errorf("Expected a FeatureError for %s, got %v", formatter.FeatureFreeTextOr, err)
+		}
+
+		// Every phrase of a $text search must match, so phrases cannot be ORed within one
+		_, err = parser.Parse(`("John Doe" OR "Jane Smith")`)
+		var featureErr *formatter.FeatureError
+		if !errors.As(err, &featureErr) || featureErr.Feature != formatter.FeatureFreeTextOr {
+			t.Errorf("Expected a FeatureError for %s, got %v", formatter.FeatureFreeTextOr, err)
+		}
+	})
+
+	t.Run("RegexFieldsPhraseOr", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name"}))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		filter, err := parser.Parse(`("John Doe" OR "Jane Smith")`)
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		expected := bson.M{"$or": []bson.M{
+			{"name": bson.M{"$regex": "^John Doe$", "$options": "i"}},
+			{"name": bson.M{"$regex": "^Jane Smith$", "$options": "i"}},
+		}}
+		if !reflect.DeepEqual(filter, expected) {
+			t.Errorf("Expected a regex per phrase, got %v", filter)
+		}
+	})
+}
+
+// TestLuceneMongoWeightedDefaultFields tests relevance scoring with weighted default fields
+func TestLuceneMongoWeightedDefaultFields(t *testing.T) {
+	cfg := bsonic_config.Default().WithWeightedDefaultFields(bsonic_config.Weighted{"title": 3, "body": 1})
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	t.Run("ScoreStage", func(t *testing.T) {
+		result, err := parser.ParseDetailed("golang AND NOT draft | limit:20")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+
+		// Fields are searched in weight order
+		expectedFilter := bson.M{"$and": []bson.M{
+			{"$or": []bson.M{
+				{"title": bson.M{"$regex": "^golang$", "$options": "i"}},
+				{"body": bson.M{"$regex": "^golang$", "$options": "i"}},
+			}},
+			{"title": bson.M{"$not": bson.M{"$regex": "^draft$", "$options": "i"}}},
+			{"body": bson.M{"$not": bson.M{"$regex": "^draft$", "$options": "i"}}},
+		}}
+		if !bsonutil.Equal(result.Filter, expectedFilter) {
+			t.Fatalf("Expected filter %+v, got %+v", expectedFilter, result.Filter)
+		}
+
+		score := func(field string, weight int) bson.M {
+			return bson.M{"$cond": bson.A{
+				bson.M{"$regexMatch": bson.M{
+					"input":   bson.M{"$convert": bson.M{"input": "$" + field, "to": "string", "onError": "", "onNull": ""}},
+					"regex":   "^golang$",
+					"options": "i",
+				}},
+				weight,
+				0,
+			}}
+		}
+		// Negated free text does not contribute to the score
+		expectedStage := bson.M{"$addFields": bson.M{"_score": bson.M{"$add": bson.A{score("title", 3), score("body", 1)}}}}
+		if !reflect.DeepEqual(result.ScoreStage, expectedStage) {
+			t.Fatalf("Expected score stage %+v, got %+v", expectedStage, result.ScoreStage)
+		}
+
+		pipeline := result.RankedPipeline()
+		if len(pipeline) != 4 {
+			t.Fatalf("Expected $match, $addFields, $sort and $limit stages, got %+v", pipeline)
+		}
+		if !reflect.DeepEqual(pipeline[2], bson.M{"$sort": bson.D{{Key: "_score", Value: -1}}}) {
+			t.Fatalf("Expected sort on _score, got %+v", pipeline[2])
+		}
+	})
+
+	t.Run("NoFreeText", func(t *testing.T) {
+		result, err := parser.ParseDetailed("status:published")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if result.ScoreStage != nil {
+			t.Fatalf("Expected no score stage, got %+v", result.ScoreStage)
+		}
+		if len(result.RankedPipeline()) != 1 {
+			t.Fatalf("Expected only a $match stage, got %+v", result.RankedPipeline())
+		}
+	})
+}
+
+// TestLuceneMongoMultiWordMode tests the any, all and phrase modes for unquoted multiword free text
+func TestLuceneMongoMultiWordMode(t *testing.T) {
+	regex := func(field, pattern string) bson.M {
+		return bson.M{field: bson.M{"$regex": pattern, "$options": "i"}}
+	}
+
+	tests := []struct {
+		name     string
+		strategy bsonic_config.TextSearchStrategy
+		mode     bsonic_config.MultiWordMode
+		expected bson.M
+	}{
+		{
+			name: "AnyRegex",
+			mode: bsonic_config.MultiWordAny,
+			expected: bson.M{"$or": []bson.M{
+				regex("name", "^john$"), regex("title", "^john$"),
+				regex("name", "^doe$"), regex("title", "^doe$"),
+			}},
+		},
+		{
+			name: "AllRegex",
+			mode: bsonic_config.MultiWordAll,
+			expected: bson.M{"$and": []bson.M{
+				{"$or": []bson.M{regex("name", "^john$"), regex("title", "^john$")}},
+				{"$or": []bson.M{regex("name", "^doe$"), regex("title", "^doe$")}},
+			}},
+		},
+		{
+			name:     "PhraseRegex",
+			mode:     bsonic_config.MultiWordPhrase,
+			expected: bson.M{"$or": []bson.M{regex("name", "^john doe$"), regex("title", "^john doe$")}},
+		},
+		{
+			name:     "AllTextIndex",
+			strategy: bsonic_config.StrategyTextIndex,
+			mode:     bsonic_config.MultiWordAll,
+			expected: bson.M{"$text": bson.M{"$search": `"john" "doe"`}},
+		},
+		{
+			name:     "PhraseTextIndex",
+			strategy: bsonic_config.StrategyTextIndex,
+			mode:     bsonic_config.MultiWordPhrase,
+			expected: bson.M{"$text": bson.M{"$search": `"john doe"`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := bsonic_config.Default().WithDefaultFields([]string{"name", "title"}).WithMultiWordMode(tt.mode)
+			if tt.strategy != "" {
+				cfg = cfg.WithTextSearchStrategy(tt.strategy)
+			}
+			parser, err := bsonic.NewWithConfig(cfg)
+			if err != nil {
+				t.Fatalf("NewWithConfig should not return error, got: %v", err)
+			}
+
+			result, err := parser.Parse("john doe")
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !bsonutil.Equal(result, tt.expected) {
+				t.Fatalf("Expected %+v, got %+v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("AllAtlasSearch", func(t *testing.T) {
+		cfg := bsonic_config.Default().
+			WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch).
+			WithMultiWordMode(bsonic_config.MultiWordAll)
+		parser, err := bsonic.NewWithConfig(cfg)
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+
+		result, err := parser.ParseDetailed("john doe")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		expected := bson.M{"$search": bson.M{"text": bson.M{
+			"query": "john doe", "path": bson.M{"wildcard": "*"}, "matchCriteria": "all",
+		}}}
+		if !reflect.DeepEqual(result.SearchStage, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, result.SearchStage)
+		}
+	})
+}
+
+// TestLuceneMongoTextTokenizer tests that free text passes through the configured tokenizer
+func TestLuceneMongoTextNegation(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyTextIndex))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"PrefixOperator", "john -foo", bson.M{"$text": bson.M{"$search": "john -foo"}}},
+		{"Not", "john AND NOT foo", bson.M{"$text": bson.M{"$search": "john -foo"}}},
+		{"NegatedOr", "john AND NOT (foo OR bar)", bson.M{"$text": bson.M{"$search": "john -foo -bar"}}},
+		{"Phrase", `"big data" -"big deal"`, bson.M{"$text": bson.M{"$search": `"big data" -"big deal"`}}},
+		{"WithFields", "john AND role:admin AND NOT foo", bson.M{"$and": []bson.M{
+			{"$text": bson.M{"$search": "john -foo"}},
+			{"role": "admin"},
+		}}},
+		{"AndedFreeText", "john AND doe", bson.M{"$text": bson.M{"$search": `"john" "doe"`}}},
+		{"AndedFreeTextWithExclusion", "john AND doe AND NOT foo", bson.M{"$text": bson.M{"$search": `"john" "doe" -foo`}}},
+		{"AndedPhrase", `john AND "big data" AND role:admin`, bson.M{"$and": []bson.M{
+			{"$text": bson.M{"$search": `"john" "big data"`}},
+			{"role": "admin"},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(filter, tt.expected) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.expected, filter)
+			}
+		})
+	}
+
+	t.Run("Language", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyTextIndex).WithTextLanguage("en"))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		filter, err := parser.Parse("john -foo")
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		expected := bson.M{"$text": bson.M{"$search": "john -foo", "$language": "en"}}
+		if !reflect.DeepEqual(filter, expected) {
+			t.Errorf("Expected %v, got %v", expected, filter)
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		for _, query := range []string{"NOT foo", "-foo", "role:admin AND NOT foo", "john OR NOT foo", "NOT (foo AND bar) AND john", "NOT (NOT foo) AND john",
+			"(john OR jane) AND doe", "(john AND NOT foo) OR role:admin", "bar OR baz AND qux"} {
+			_, err := parser.Parse(query)
+			if !errors.Is(err, bsonic.ErrUnsupported) {
+				t.Errorf("Parse(%q): expected an unsupported query error, got: %v", query, err)
+			}
+		}
+
+		_, err := parser.Parse("john OR NOT foo")
+		var featureErr *formatter.FeatureError
+		if !errors.As(err, &featureErr) || featureErr.Feature != formatter.FeatureNegatedFreeText {
+			t.Errorf("Expected a FeatureError for %s, got %v", formatter.FeatureNegatedFreeText, err)
+		}
+	})
+}
+
+func TestLuceneMongoTextTokenizer(t *testing.T) {
+	stopWords := map[string]bool{"the": true, "of": true}
+	tokenizer := func(text string) []string {
+		var terms []string
+		for _, word := range strings.Fields(strings.ToLower(text)) {
+			if !stopWords[word] {
+				terms = append(terms, strings.TrimSuffix(word, "s"))
+			}
+		}
+		return terms
+	}
+
+	cfg := bsonic_config.Default().WithDefaultFields([]string{"name"}).WithTextTokenizer(tokenizer)
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{
+			name:  "StopWordsAndStemming",
+			query: "The Lord of Rings",
+			expected: bson.M{"$or": []bson.M{
+				{"name": bson.M{"$regex": "^lord$", "$options": "i"}},
+				{"name": bson.M{"$regex": "^ring$", "$options": "i"}},
+			}},
+		},
+		{
+			name:     "QuotedTextUnchanged",
+			query:    `"The Rings"`,
+			expected: bson.M{"name": bson.M{"$regex": "^The Rings$", "$options": "i"}},
+		},
+		{
+			name:     "OnlyStopWordsDropped",
+			query:    "status:active AND the",
+			expected: bson.M{"status": "active"},
+		},
+		{
+			name:     "SplitFieldValueStopWord",
+			query:    "status:active the",
+			expected: bson.M{"status": "active"},
+		},
+		{
+			name:     "OnlyStopWordsUnderOr",
+			query:    "name:john OR the",
+			expected: bson.M{"name": "john"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !bsonutil.Equal(result, tt.expected) {
+				t.Fatalf("Expected %+v, got %+v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("TextIndex", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().
+			WithTextSearchStrategy(bsonic_config.StrategyTextIndex).
+			WithTextTokenizer(tokenizer))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		for query, expected := range map[string]bson.M{
+			"name:john OR the":      {"name": "john"},
+			"status:active AND the": {"status": "active"},
+			"Rings OR of":           {"$text": bson.M{"$search": "ring"}},
+		} {
+			result, err := parser.Parse(query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", query, err)
+			}
+			if !bsonutil.Equal(result, expected) {
+				t.Errorf("Parse(%q): expected %+v, got %+v", query, expected, result)
+			}
+		}
+
+		// Free text without search terms matches nothing, so it must not become a filter matching everything
+		for _, query := range []string{"the", "the OR of", "NOT the", "status:active OR NOT the"} {
+			if _, err := parser.Parse(query); !errors.Is(err, bsonic.ErrUnsupported) {
+				t.Errorf("Parse(%q): expected an unsupported query error, got: %v", query, err)
+			}
+		}
+	})
+}
+
+// TestLuceneMongoHighlights tests the field and term or regex pairs returned for highlighting
+func TestLuceneMongoHighlights(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name", "bio"})
+
+	result, err := parser.ParseDetailed(`title:Engineer AND email:*@example.com AND age:>30 AND NOT status:banned AND "data science"`)
+	if err != nil {
+		t.Fatalf("ParseDetailed should not return error, got: %v", err)
+	}
+
+	expected := []bsonic.Highlight{
+		{Field: "title", Term: "Engineer"},
+		{Field: "email", Regex: ".*@example.com$"},
+		{Field: "name", Term: "data science", CaseInsensitive: true},
+		{Field: "bio", Term: "data science", CaseInsensitive: true},
+	}
+	if !reflect.DeepEqual(result.Highlights, expected) {
+		t.Fatalf("Expected highlights %+v, got %+v", expected, result.Highlights)
+	}
+
+	t.Run("DoubleNegationAndRegex", func(t *testing.T) {
+		result, err := parser.ParseDetailed(`NOT (NOT /jo.*/) AND id:507f1f77bcf86cd799439011`)
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+
+		expected := []bsonic.Highlight{
+			{Field: "name", Regex: "^jo.*$"},
+			{Field: "bio", Regex: "^jo.*$"},
+		}
+		if !reflect.DeepEqual(result.Highlights, expected) {
+			t.Fatalf("Expected highlights %+v, got %+v", expected, result.Highlights)
+		}
+	})
+}
+
+// TestLuceneMongoCombineQueries tests the And, Or and AndBSON query combination helpers
+func TestLuceneMongoCombineQueries(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	tests := []struct {
+		name     string
+		combine  func() (bson.M, error)
+		expected bson.M
+	}{
+		{
+			name:     "AndMergesSimpleFields",
+			combine:  func() (bson.M, error) { return parser.And("role:admin", "active:true AND team:core", "") },
+			expected: bson.M{"role": "admin", "active": true, "team": "core"},
+		},
+		{
+			name:    "AndGroupsOrQueries",
+			combine: func() (bson.M, error) { return parser.And("role:admin OR role:owner", "active:true") },
+			expected: bson.M{"$and": []bson.M{
+				{"role": bson.M{"$in": []interface{}{"admin", "owner"}}},
+				{"active": true},
+			}},
+		},
+		{
+			name:     "OrFlattens",
+			combine:  func() (bson.M, error) { return parser.Or("role:admin OR role:owner", "team:core") },
+			expected: bson.M{"$or": []bson.M{{"role": "admin"}, {"role": "owner"}, {"team": "core"}}},
+		},
+		{
+			name:     "AndBSONMerges",
+			combine:  func() (bson.M, error) { return parser.AndBSON("role:admin", bson.M{"tenant_id": "t1"}) },
+			expected: bson.M{"role": "admin", "tenant_id": "t1"},
+		},
+		{
+			name:    "AndBSONConflict",
+			combine: func() (bson.M, error) { return parser.AndBSON("role:admin", bson.M{"role": "owner"}) },
+			expected: bson.M{"$and": []bson.M{
+				{"role": "admin"},
+				{"role": "owner"},
+			}},
+		},
+		{
+			name:     "AllEmpty",
+			combine:  func() (bson.M, error) { return parser.And("", "  ") },
+			expected: bson.M{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tt.combine()
+			if err != nil {
+				t.Fatalf("combine should not return error, got: %v", err)
+			}
+			if !bsonutil.Equal(result, tt.expected) {
+				t.Fatalf("Expected %+v, got %+v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("RejectsDirectives", func(t *testing.T) {
+		if _, err := parser.And("role:admin", "active:true | limit:5"); err == nil {
+			t.Fatal("And should return error for queries with directives")
+		}
+	})
+
+	t.Run("AllowedFields", func(t *testing.T) {
+		cfg := bsonic_config.Default().WithAllowedFields([]string{"role"})
+		restricted, err := bsonic.NewWithConfig(cfg)
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := restricted.Or("role:admin", "secret:x"); err == nil {
+			t.Fatal("Or should return error for a field outside the allowlist")
+		}
+	})
+
+	t.Run("AppliesConfig", func(t *testing.T) {
+		strict, err := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name"}).WithPolicy(bsonic_config.PolicyStrictAPI))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := strict.And("name:jo*", "role:admin"); !errors.Is(err, bsonic.ErrUnsupported) {
+			t.Errorf("Expected the $regex operator to be rejected under the strict API policy, got: %v", err)
+		}
+		if _, err := strict.And(strings.Repeat("a", 600)); !errors.Is(err, bsonic.ErrLimitExceeded) {
+			t.Errorf("Expected a query over the length cap to be rejected, got: %v", err)
+		}
+
+		cfg := bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithDeprecatedField("username", "user.name").
+			WithConflictPolicy(bsonic_config.ConflictError)
+		renamed, err := bsonic.NewWithConfig(cfg)
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		filter, err := renamed.And("username:john", "role:admin")
+		if err != nil {
+			t.Fatalf("And should not return error, got: %v", err)
+		}
+		if !reflect.DeepEqual(filter, bson.M{"user.name": "john", "role": "admin"}) {
+			t.Errorf("Expected the deprecated field to be renamed, got: %v", filter)
+		}
+		if _, err := renamed.And("age:18", "age:65"); !errors.Is(err, bsonic.ErrConflictingField) {
+			t.Errorf("Expected the conflicting age values to be reported, got: %v", err)
+		}
+	})
+}
+
+// TestLuceneMongoSubquery tests IN_QUERY references resolved through the configured resolver
+func TestLuceneMongoSubquery(t *testing.T) {
+	var gotCollection string
+	var gotFilter bson.M
+	resolver := func(_ context.Context, collection string, filter bson.M) ([]interface{}, error) {
+		gotCollection, gotFilter = collection, filter
+		return []interface{}{"u1", "u2"}, nil
+	}
+
+	cfg := bsonic_config.Default().WithDefaultFields([]string{"name"}).WithSubqueryResolver(resolver)
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	result, err := parser.Parse("owner_id:IN_QUERY(users WHERE role:admin AND active:true) AND status:open")
+	if err != nil {
+		t.Fatalf("Parse should not return error, got: %v", err)
+	}
+
+	expected := bson.M{"owner_id": bson.M{"$in": []interface{}{"u1", "u2"}}, "status": "open"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, result)
+	}
+	if gotCollection != "users" {
+		t.Errorf("Expected resolver collection users, got %s", gotCollection)
+	}
+	if !bsonutil.Equal(gotFilter, bson.M{"role": "admin", "active": true}) {
+		t.Errorf("Expected resolver filter for role:admin AND active:true, got %+v", gotFilter)
+	}
+
+	t.Run("Negated", func(t *testing.T) {
+		result, err := parser.Parse("NOT owner_id:IN_QUERY(users WHERE role:admin)")
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		expected := bson.M{"owner_id": bson.M{"$not": bson.M{"$in": []interface{}{"u1", "u2"}}}}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("Expected %+v, got %+v", expected, result)
+		}
+	})
+
+	t.Run("ResolverError", func(t *testing.T) {
+		failing := bsonic_config.Default().WithSubqueryResolver(func(context.Context, string, bson.M) ([]interface{}, error) {
+			return nil, errors.New("users collection unavailable")
+		})
+		p, _ := bsonic.NewWithConfig(failing)
+		if _, err := p.Parse("owner_id:IN_QUERY(users WHERE role:admin)"); err == nil {
+			t.Fatal("Parse should return error when the resolver fails")
+		}
+	})
+
+	t.Run("NoResolver", func(t *testing.T) {
+		p := createParserWithDefaults([]string{"name"})
+		_, err := p.Parse("owner_id:IN_QUERY(users WHERE role:admin)")
+		if err == nil || !strings.Contains(err.Error(), "subquery resolver") {
+			t.Fatalf("Expected subquery resolver error, got: %v", err)
+		}
+	})
+
+	t.Run("Context", func(t *testing.T) {
+		type key struct{}
+		var got interface{}
+		p, _ := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name"}).WithSubqueryResolver(func(ctx context.Context, _ string, _ bson.M) ([]interface{}, error) {
+			got = ctx.Value(key{})
+			return nil, nil
+		}))
+		ctx := context.WithValue(context.Background(), key{}, "request")
+		if _, err := p.ParseDetailedContext(ctx, "owner_id:IN_QUERY(users WHERE role:admin)"); err != nil {
+			t.Fatalf("ParseDetailedContext should not return error, got: %v", err)
+		}
+		if got != "request" {
+			t.Errorf("Expected the resolver to get the parse context, got value %v", got)
+		}
+	})
+
+	t.Run("ResolvedOncePerParse", func(t *testing.T) {
+		calls := 0
+		p, _ := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name"}).WithSubqueryResolver(func(context.Context, string, bson.M) ([]interface{}, error) {
+			calls++
+			return []interface{}{"u1"}, nil
+		}))
+
+		if _, err := p.Parse("owner_id:IN_QUERY(users WHERE role:admin) OR editor_id:IN_QUERY(users WHERE role:admin)"); err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("Expected a repeated subquery to be resolved once, got %d calls", calls)
+		}
+
+		calls = 0
+		if _, err := p.Explain("owner_id:IN_QUERY(users WHERE role:admin) AND status:open"); err != nil {
+			t.Fatalf("Explain should not return error, got: %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("Expected Explain to resolve the subquery once, got %d calls", calls)
+		}
+
+		calls = 0
+		p.Parse("owner_id:IN_QUERY(users WHERE role:admin)")
+		p.Parse("owner_id:IN_QUERY(users WHERE role:admin)")
+		if calls != 2 {
+			t.Errorf("Expected each parse to resolve its own subqueries, got %d calls", calls)
+		}
+	})
+
+	t.Run("Validated", func(t *testing.T) {
+		resolved := 0
+		resolver := func(context.Context, string, bson.M) ([]interface{}, error) {
+			resolved++
+			return []interface{}{"u1"}, nil
+		}
+
+		restricted, _ := bsonic.NewWithConfig(bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithAllowedFields([]string{"name", "owner_id", "role"}).
+			WithSubqueryResolver(resolver))
+		if _, err := restricted.Parse("owner_id:IN_QUERY(users WHERE role:admin)"); err != nil {
+			t.Fatalf("Parse should not return error for allowed fields, got: %v", err)
+		}
+		_, err := restricted.Parse("owner_id:IN_QUERY(users WHERE password:secret)")
+		if !errors.Is(err, bsonic.ErrDisallowedField) {
+			t.Errorf("Expected %v for a disallowed field in the subquery, got %v", bsonic.ErrDisallowedField, err)
+		}
+
+		limited, _ := bsonic.NewWithConfig(bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithForbiddenOperators("$regex").
+			WithSubqueryResolver(resolver))
+		_, err = limited.Parse("owner_id:IN_QUERY(users WHERE name:jo*)")
+		if !errors.Is(err, bsonic.ErrUnsupported) {
+			t.Errorf("Expected %v for a forbidden operator in the subquery, got %v", bsonic.ErrUnsupported, err)
+		}
+
+		p, _ := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name"}).WithSubqueryResolver(resolver))
+		perms := &bsonic.Permissions{Roles: map[string]bsonic.RoleAccess{"viewer": {Fields: []string{"owner_id", "role"}}}}
+		_, err = p.ParseWithPermissions(context.Background(), "owner_id:IN_QUERY(users WHERE salary:>100)", perms, "viewer")
+		if !errors.Is(err, bsonic.ErrDisallowedField) {
+			t.Errorf("Expected %v for a hidden field in the subquery, got %v", bsonic.ErrDisallowedField, err)
+		}
+
+		if resolved != 1 {
+			t.Errorf("Expected only the valid subquery to be resolved, got %d calls", resolved)
+		}
+	})
+}
+
+// TestLuceneMongoForeignRefs tests $lookup pipelines for queries on declared foreign-reference fields
+func TestLuceneMongoForeignRefs(t *testing.T) {
+	cfg := bsonic_config.Default().
+		WithDefaultFields([]string{"title"}).
+		WithForeignRefs(map[string]bsonic_config.ForeignRef{
+			"author": {From: "users", LocalField: "author_id"},
+		})
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	result, err := parser.ParseDetailed("author.name:john AND status:published | sort:author.name | limit:10")
+	if err != nil {
+		t.Fatalf("ParseDetailed should not return error, got: %v", err)
+	}
+
+	expectedLookups := []bson.M{{"$lookup": bson.M{
+		"from":         "users",
+		"localField":   "author_id",
+		"foreignField": "_id",
+		"as":           "_lookup_author",
+	}}}
+	if !reflect.DeepEqual(result.LookupStages, expectedLookups) {
+		t.Fatalf("Expected lookup stages %+v, got %+v", expectedLookups, result.LookupStages)
+	}
+
+	expectedPipeline := []bson.M{
+		expectedLookups[0],
+		{"$match": bson.M{"_lookup_author.name": "john", "status": "published"}},
+		{"$sort": bson.D{{Key: "_lookup_author.name", Value: 1}}},
+		{"$unset": []string{"_lookup_author"}},
+		{"$limit": int64(10)},
+	}
+	if !reflect.DeepEqual(result.Pipeline(), expectedPipeline) {
+		t.Fatalf("Expected pipeline %+v, got %+v", expectedPipeline, result.Pipeline())
+	}
+
+	t.Run("NestedLogicalOperators", func(t *testing.T) {
+		result, err := parser.ParseDetailed("author.name:john OR author.name:jane")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		expected := bson.M{"_lookup_author.name": bson.M{"$in": []interface{}{"john", "jane"}}}
+		if !bsonutil.Equal(result.Filter, expected) {
+			t.Fatalf("Expected filter %+v, got %+v", expected, result.Filter)
+		}
+	})
+
+	t.Run("ReferenceFieldItself", func(t *testing.T) {
+		result, err := parser.ParseDetailed("author:abc")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if len(result.LookupStages) != 0 {
+			t.Fatalf("Expected no lookup for the reference field itself, got %+v", result.LookupStages)
+		}
+	})
+
+	t.Run("TextSearchFirst", func(t *testing.T) {
+		textParser, err := bsonic.NewWithConfig(cfg.WithTextSearchStrategy(bsonic_config.StrategyTextIndex))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+
+		result, err := textParser.ParseDetailed("author.name:john AND status:published AND mongodb")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		expected := []bson.M{
+			{"$match": bson.M{"$text": bson.M{"$search": "mongodb"}}},
+			expectedLookups[0],
+			{"$match": bson.M{"_lookup_author.name": "john", "status": "published"}},
+			{"$unset": []string{"_lookup_author"}},
+		}
+		if !reflect.DeepEqual(result.Pipeline(), expected) {
+			t.Fatalf("Expected pipeline %+v, got %+v", expected, result.Pipeline())
+		}
+	})
+}
+
+// TestLuceneMongoMalformedInput tests that malformed and hostile input never panics
+func TestLuceneMongoMalformedInput(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	// Stray slashes and quotes are treated as literal text; they must not panic
+	for _, query := range []string{"field:/", "/", "//", `name:"john`, "name:'john", `"`, "(name:john", "name:)"} {
+		t.Run(query, func(t *testing.T) {
+			_, _ = parser.ParseDetailed(query)
+		})
+	}
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"DeepParens", strings.Repeat("(", 101) + "name:john" + strings.Repeat(")", 101)},
+		{"DeepNotChain", strings.Repeat("NOT ", 101) + "john"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parser.Parse(tt.query)
+			if err == nil || !strings.Contains(err.Error(), "maximum nesting depth") {
+				t.Fatalf("Expected nesting depth error, got: %v", err)
+			}
+		})
+	}
+
+	t.Run("NestingWithinLimit", func(t *testing.T) {
+		query := strings.Repeat("(", 50) + "name:john" + strings.Repeat(")", 50)
+		if _, err := parser.Parse(query); err != nil {
+			t.Fatalf("Parse should not return error for nesting within the limit, got: %v", err)
+		}
+	})
+}
+
+// TestLuceneMongoErrorCategories tests that parse errors match exactly one error category
+func TestLuceneMongoErrorCategories(t *testing.T) {
+	restricted, _ := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithAllowedFields([]string{"name", "age"}))
+	atlas, _ := bsonic.NewWithConfig(bsonic_config.Default().
+		WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch))
+
+	categories := []error{bsonic.ErrSyntax, bsonic.ErrUnsupported, bsonic.ErrLimitExceeded, bsonic.ErrDisallowedField}
+
+	tests := []struct {
+		name   string
+		parser *bsonic.Parser
+		query  string
+		want   error
+	}{
+		{"Syntax", restricted, "name:john AND", bsonic.ErrSyntax},
+		{"InvalidDirective", restricted, "name:john | limit:abc", bsonic.ErrSyntax},
+		{"Unsupported", atlas, "john OR name:doe", bsonic.ErrUnsupported},
+		{"MissingResolver", restricted, "name:IN_QUERY(users WHERE age:30)", bsonic.ErrUnsupported},
+		{"LimitExceeded", restricted, strings.Repeat("(", 101) + "name:john" + strings.Repeat(")", 101), bsonic.ErrLimitExceeded},
+		{"DisallowedField", restricted, "email:john@example.com", bsonic.ErrDisallowedField},
+		{"DisallowedSortField", restricted, "name:john | sort:email", bsonic.ErrDisallowedField},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.parser.ParseDetailed(tt.query)
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+
+			var classified *bsonic.Error
+			if !errors.As(err, &classified) || classified.Kind != tt.want {
+				t.Fatalf("Expected %v error, got: %v", tt.want, err)
+			}
+			for _, category := range categories {
+				if category != tt.want && errors.Is(err, category) {
+					t.Fatalf("Expected error to match only %v, also matched %v", tt.want, category)
+				}
+			}
+		})
+	}
+
+	t.Run("FieldError", func(t *testing.T) {
+		_, err := restricted.Parse("email:john@example.com")
+		var fieldErr *bsonic.FieldError
+		if !errors.As(err, &fieldErr) || fieldErr.Field != "email" {
+			t.Fatalf("Expected field error for email, got: %v", err)
+		}
+	})
+
+	t.Run("ResolverError", func(t *testing.T) {
+		sentinel := errors.New("connection refused")
+		parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithSubqueryResolver(func(_ context.Context, collection string, filter bson.M) ([]interface{}, error) {
+				return nil, sentinel
+			}))
+
+		_, err := parser.Parse("author_id:IN_QUERY(users WHERE name:john)")
+		if !errors.Is(err, sentinel) {
+			t.Fatalf("Expected resolver error to be wrapped, got: %v", err)
+		}
+		if errors.Is(err, bsonic.ErrSyntax) {
+			t.Fatalf("Expected resolver error not to be classified as a syntax error, got: %v", err)
+		}
+	})
+
+	t.Run("Combine", func(t *testing.T) {
+		_, err := restricted.And("name:john", "email:john@example.com")
+		if !errors.Is(err, bsonic.ErrDisallowedField) {
+			t.Fatalf("Expected disallowed field error, got: %v", err)
+		}
+	})
+}
+
+// TestLuceneMongoTelemetry tests that parses are logged and traced with their query length, clause count and duration
+func TestLuceneMongoTelemetry(t *testing.T) {
+	var logs bytes.Buffer
+	recorder := tracetest.NewSpanRecorder()
+	parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithLogger(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})).
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+
+	t.Run("Success", func(t *testing.T) {
+		logs.Reset()
+		query := "name:john AND age:30"
+		result, err := parser.ParseDetailedContext(context.Background(), query)
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+			t.Fatalf("Expected a JSON log record, got %q: %v", logs.String(), err)
+		}
+		if record["msg"] != "query parsed" || record["clauses"] != float64(2) {
+			t.Fatalf("Unexpected log record: %v", record)
+		}
+		if record["fingerprint"] != result.Fingerprint() || record["shape"] != result.Shape() {
+			t.Fatalf("Expected the query's fingerprint and shape in log record: %v", record)
+		}
+		if strings.Contains(logs.String(), "john") {
+			t.Fatalf("Expected the query's values to be left out of the log record: %v", record)
+		}
+		if record["query_length"] != float64(len(query)) {
+			t.Fatalf("Expected query_length %d, got %v", len(query), record["query_length"])
+		}
+		if _, ok := record["duration"]; !ok {
+			t.Fatalf("Expected duration in log record: %v", record)
+		}
+
+		names := map[string]bool{}
+		for _, span := range recorder.Ended() {
+			names[span.Name()] = true
+		}
+		for _, name := range []string{"bsonic.parse", "bsonic.parse.language", "bsonic.parse.format"} {
+			if !names[name] {
+				t.Fatalf("Expected span %s, got %v", name, names)
+			}
+		}
+
+		spans := recorder.Ended()
+		root := spans[len(spans)-1]
+		attrs := map[string]interface{}{}
+		for _, attr := range root.Attributes() {
+			attrs[string(attr.Key)] = attr.Value.AsInterface()
+		}
+		if attrs["bsonic.query.length"] != int64(len(query)) || attrs["bsonic.clause.count"] != int64(2) {
+			t.Fatalf("Unexpected span attributes: %v", attrs)
+		}
+		if _, ok := attrs["bsonic.duration_ms"]; !ok {
+			t.Fatalf("Expected duration attribute, got %v", attrs)
+		}
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		logs.Reset()
+		if _, err := parser.Parse("name:john AND"); err == nil {
+			t.Fatal("Expected parse error")
+		}
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+			t.Fatalf("Expected a JSON log record, got %q: %v", logs.String(), err)
+		}
+		if record["msg"] != "query parse failed" || record["error_kind"] != "syntax" {
+			t.Fatalf("Unexpected log record: %v", record)
+		}
+		if _, ok := record["error"]; ok || strings.Contains(logs.String(), "john") {
+			t.Fatalf("Expected the query and error message to be left out of the log record: %v", record)
+		}
+
+		spans := recorder.Ended()
+		if root := spans[len(spans)-1]; root.Name() != "bsonic.parse" || root.Status().Code.String() != "Error" ||
+			root.Status().Description != "syntax" {
+			t.Fatalf("Expected failed bsonic.parse span with the error kind, got %s (%v)", root.Name(), root.Status())
+		}
+		for _, span := range spans {
+			if len(span.Events()) > 0 {
+				t.Fatalf("Expected the error message to be left out of span %s, got events %v", span.Name(), span.Events())
+			}
+		}
+	})
+
+	t.Run("QueryLogging", func(t *testing.T) {
+		var logs bytes.Buffer
+		recorder := tracetest.NewSpanRecorder()
+		parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithLogger(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})).
+			WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))).
+			WithQueryLogging(true))
+
+		if _, err := parser.Parse("name:john AND"); err == nil {
+			t.Fatal("Expected parse error")
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+			t.Fatalf("Expected a JSON log record, got %q: %v", logs.String(), err)
+		}
+		if record["query"] != "name:john AND" || record["error"] == nil {
+			t.Fatalf("Expected the query and error message in log record: %v", record)
+		}
+
+		spans := recorder.Ended()
+		root := spans[len(spans)-1]
+		if root.Status().Description != record["error"] || len(root.Events()) == 0 {
+			t.Fatalf("Expected the error message on the bsonic.parse span, got %v (%v)", root.Status(), root.Events())
+		}
+	})
+}
+
+// recordingMetrics counts the parse outcomes reported to it
+type recordingMetrics struct {
+	completed []int
+	failed    []string
+}
+
+func (m *recordingMetrics) ParseCompleted(duration time.Duration, clauses int) {
+	m.completed = append(m.completed, clauses)
+}
+
+func (m *recordingMetrics) ParseFailed(duration time.Duration, kind string) {
+	m.failed = append(m.failed, kind)
+}
+
+// TestLuceneMongoMetrics tests that parse outcomes are reported to the configured metrics
+func TestLuceneMongoMetrics(t *testing.T) {
+	recorded := &recordingMetrics{}
+	parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithAllowedFields([]string{"name", "age"}).
+		WithMetrics(recorded))
+
+	_, _ = parser.Parse("name:john AND (age:30 OR name:jane)")
+	_, _ = parser.Parse("name:john AND")
+	_, _ = parser.Parse("email:john@example.com")
+	_, _ = parser.Parse(strings.Repeat("(", 101) + "name:john" + strings.Repeat(")", 101))
+
+	if !reflect.DeepEqual(recorded.completed, []int{3}) {
+		t.Errorf("Expected one completed parse with 3 clauses, got %v", recorded.completed)
+	}
+	expected := []string{"syntax", "disallowed_field", "limit_exceeded"}
+	if !reflect.DeepEqual(recorded.failed, expected) {
+		t.Errorf("Expected failed parses %v, got %v", expected, recorded.failed)
+	}
+}
+
+func TestLuceneMongoUsageStats(t *testing.T) {
+	usage := metrics.NewUsageCollector()
+	parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithAllowedFields([]string{"name", "age", "items.price", "email"}).
+		WithUsageRecorder(usage))
+
+	_, _ = parser.Parse("name:john AND (age:[18 TO 30] OR name:jane)")
+	_, _ = parser.ParseDetailed("items.0.price:>10 | sort:-age | fields:name,age")
+	_, _ = parser.Parse("email:john@example.com AND")
+	_, _ = parser.Parse("password:secret")
+
+	stats := usage.Stats()
+	if stats.Queries != 2 {
+		t.Errorf("Expected only the 2 successful parses to be recorded, got %d", stats.Queries)
+	}
+	expected := map[string]metrics.FieldUsage{
+		"name":        {Filtered: 2, Projected: 1, Operators: map[string]int{"$eq": 2}},
+		"age":         {Filtered: 1, Sorted: 1, Projected: 1, Operators: map[string]int{"$gte": 1, "$lte": 1}},
+		"items.price": {Filtered: 1, Operators: map[string]int{"$gt": 1}},
+	}
+	if !reflect.DeepEqual(stats.Fields, expected) {
+		t.Errorf("Expected field usage %v, got %v", expected, stats.Fields)
+	}
+	expectedOperators := map[string]int{"$and": 1, "$or": 1, "$gte": 1, "$lte": 1, "$gt": 1}
+	if !reflect.DeepEqual(stats.Operators, expectedOperators) {
+		t.Errorf("Expected operator usage %v, got %v", expectedOperators, stats.Operators)
+	}
+	if unused := stats.Unused("name", "email", "items", "address"); !reflect.DeepEqual(unused, []string{"address", "email"}) {
+		t.Errorf("Expected address and email to be unused, got %v", unused)
+	}
+
+	// Stats returns a copy, and Reset clears the collector
+	stats.Fields["name"].Operators["$eq"] = 100
+	if usage.Stats().Fields["name"].Operators["$eq"] != 2 {
+		t.Error("Expected Stats to return a copy of the collected stats")
+	}
+	usage.Reset()
+	if stats := usage.Stats(); stats.Queries != 0 || len(stats.Fields) != 0 || len(stats.Operators) != 0 {
+		t.Errorf("Expected Reset to clear the stats, got %+v", stats)
+	}
+}
+
+// TestLuceneMongoLegacyTextCompat tests that legacy compatibility compiles free text to $text as before the grammar rewrite
+func TestLuceneMongoLegacyTextCompat(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *bsonic_config.Config
+		query    string
+		expected bson.M
+	}{
+		{
+			name:     "SplitFieldValue",
+			config:   bsonic_config.Default().WithLegacyTextCompat(true),
+			query:    "name:John Doe",
+			expected: bson.M{"name": "John", "$text": bson.M{"$search": "Doe"}},
+		},
+		{
+			name:     "FreeText",
+			config:   bsonic_config.Default().WithLegacyTextCompat(true),
+			query:    "engineer AND role:admin",
+			expected: bson.M{"$and": []bson.M{{"$text": bson.M{"$search": "engineer"}}, {"role": "admin"}}},
+		},
+		{
+			name:     "IgnoresDefaultFields",
+			config:   bsonic_config.Default().WithDefaultFields([]string{"name"}).WithLegacyTextCompat(true),
+			query:    "name:John Doe",
+			expected: bson.M{"name": "John", "$text": bson.M{"$search": "Doe"}},
+		},
+		{
+			name:   "Disabled",
+			config: bsonic_config.Default().WithDefaultFields([]string{"name"}),
+			query:  "name:John Doe",
+			expected: bson.M{"$or": []bson.M{
+				{"name": "John"},
+				{"name": bson.M{"$regex": "^Doe$", "$options": "i"}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := bsonic.NewWithConfig(tt.config)
+			if err != nil {
+				t.Fatalf("NewWithConfig should not return error, got: %v", err)
+			}
+
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestLuceneMongoFieldTypes tests that values are coerced to the configured field types
+func TestLuceneMongoFieldTypes(t *testing.T) {
+	parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithFieldTypes(map[string]bsonic_config.FieldType{
+			"zip":       bsonic_config.FieldTypeString,
+			"code":      bsonic_config.FieldTypeString,
+			"version":   bsonic_config.FieldTypeNumber,
+			"author":    bsonic_config.FieldTypeObjectID,
+			"published": bsonic_config.FieldTypeDate,
+			"legacy_id": bsonic_config.FieldTypeString,
+		}))
+
+	authorID, _ := bson.ObjectIDFromHex("507f1f77bcf86cd799439011")
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"StringKeepsNumber", "zip:02134", bson.M{"zip": "02134"}},
+		{"StringKeepsBool", "code:true", bson.M{"code": "true"}},
+		{"StringKeepsDate", "code:2023-01-15", bson.M{"code": "2023-01-15"}},
+		{"StringKeepsWildcard", "zip:021*", bson.M{"zip": bson.M{"$regex": "^021.*"}}},
+		{"Number", "version:2", bson.M{"version": 2.0}},
+		{"ObjectID", "author:507f1f77bcf86cd799439011", bson.M{"author": authorID}},
+		{"ObjectIDFallback", "author:john", bson.M{"author": "john"}},
+		{"Date", "published:2023-01-15", bson.M{"published": time.Date(2023, 1, 15, 0, 0, 0, 0, time.UTC)}},
+		{"StringIDField", "legacy_id:507f1f77bcf86cd799439011", bson.M{"legacy_id": "507f1f77bcf86cd799439011"}},
+		{"Untyped", "age:30", bson.M{"age": 30.0}},
+		{"StringComparison", "zip:>10000", bson.M{"zip": bson.M{"$gt": "10000"}}},
+		{"StringRange", "zip:[10000 TO 20000]", bson.M{"zip": bson.M{"$gte": "10000", "$lte": "20000"}}},
+		{"StringOpenRange", "zip:[* TO 20000]", bson.M{"zip": bson.M{"$lte": "20000"}}},
+		{"StringRangeKeepsCase", "code:[Aa TO Mm]", bson.M{"code": bson.M{"$gte": "Aa", "$lte": "Mm"}}},
+		{"ObjectIDComparison", "author:>507f1f77bcf86cd799439011", bson.M{"author": bson.M{"$gt": authorID}}},
+		{"NumberRange", "version:[1 TO 3]", bson.M{"version": bson.M{"$gte": 1.0, "$lte": 3.0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestLuceneMongoJSONSchema tests that field types loaded from a JSON schema coerce query values
+func TestLuceneMongoJSONSchema(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name"}).WithJSONSchema([]byte(`{
+		"type": "object",
+		"properties": {
+			"zip": {"type": "string"},
+			"session": {"type": "string", "format": "uuid"},
+			"updated": {"type": "string", "format": "date-time"}
+		}
+	}`)))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"String", "zip:02134", bson.M{"zip": "02134"}},
+		{"UUID", "session:550e8400-e29b-41d4-a716-446655440000", bson.M{"session": bson.Binary{
+			Subtype: bson.TypeBinaryUUID,
+			Data:    []byte{0x55, 0x0e, 0x84, 0x00, 0xe2, 0x9b, 0x41, 0xd4, 0xa7, 0x16, 0x44, 0x66, 0x55, 0x44, 0x00, 0x00},
+		}}},
+		{"UUIDFallback", "session:abc", bson.M{"session": "abc"}},
+		{"DateTime", "updated:2023-01-15", bson.M{"updated": time.Date(2023, 1, 15, 0, 0, 0, 0, time.UTC)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	_, err = bsonic.NewWithConfig(bsonic_config.Default().WithJSONSchema([]byte(`not json`)))
+	if !errors.Is(err, bsonic.ErrUnsupported) {
+		t.Errorf("Expected an ErrUnsupported error for an invalid schema, got: %v", err)
+	}
+}
+
+// TestLuceneMongoEnumFields tests that enum fields reject values outside their allowed set
+func TestLuceneMongoFieldSuggestions(t *testing.T) {
+	parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithAllowedFields([]string{"name", "created_at", "updated_at", "address", "status"}))
+
+	tests := []struct {
+		query       string
+		field       string
+		suggestions []string
+	}{
+		{"creatd_at:[2024-01-01 TO *]", "creatd_at", []string{"created_at"}},
+		{"Status:active", "Status", []string{"status"}},
+		{"adress.city:boston", "adress.city", []string{"address.city"}},
+		{"name:john | sort:updatd_at", "updatd_at", []string{"updated_at"}},
+		{"name:john AND (status:active OR nickname:jj)", "nickname", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := parser.Parse(tt.query)
+			var fieldErr *bsonic.FieldError
+			if !errors.As(err, &fieldErr) {
+				t.Fatalf("Expected a FieldError, got: %v", err)
+			}
+			if !errors.Is(err, bsonic.ErrDisallowedField) {
+				t.Errorf("Expected the error to match ErrDisallowedField, got: %v", err)
+			}
+			if fieldErr.Field != tt.field || !reflect.DeepEqual(fieldErr.Suggestions, tt.suggestions) {
+				t.Errorf("Expected field %s with suggestions %v, got %+v", tt.field, tt.suggestions, fieldErr)
+			}
+		})
+	}
+
+	t.Run("Message", func(t *testing.T) {
+		_, err := parser.Parse("creatd_at:2024-01-01")
+		if err == nil || err.Error() != `field not allowed: creatd_at (did you mean "created_at"?)` {
+			t.Errorf("Expected the error to suggest created_at, got: %v", err)
+		}
+	})
+
+	t.Run("NearestFirst", func(t *testing.T) {
+		_, err := parser.Parse("upated_at:2024-01-01")
+		var fieldErr *bsonic.FieldError
+		if !errors.As(err, &fieldErr) || !reflect.DeepEqual(fieldErr.Suggestions, []string{"updated_at", "created_at"}) {
+			t.Fatalf("Expected updated_at before created_at, got: %v", err)
+		}
+		if !strings.HasSuffix(err.Error(), `(did you mean "updated_at" or "created_at"?)`) {
+			t.Errorf("Expected both suggestions in the message, got: %v", err)
+		}
+	})
+
+	t.Run("Projection", func(t *testing.T) {
+		parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+			WithFieldTypes(map[string]bsonic_config.FieldType{"email": bsonic_config.FieldTypeString}))
+		_, err := parser.ParseProjection("emal")
+		var fieldErr *bsonic.FieldError
+		if !errors.As(err, &fieldErr) || !reflect.DeepEqual(fieldErr.Suggestions, []string{"email"}) {
+			t.Fatalf("Expected the projection error to suggest email, got: %v", err)
+		}
+	})
+
+	t.Run("Permissions", func(t *testing.T) {
+		perms := &bsonic.Permissions{Roles: map[string]bsonic.RoleAccess{"viewer": {Fields: []string{"name", "status"}}}}
+		parser, _ := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name"}))
+		_, err := parser.ParseWithPermissions(context.Background(), "statu:active", perms, "viewer")
+		var fieldErr *bsonic.FieldError
+		if !errors.As(err, &fieldErr) || !reflect.DeepEqual(fieldErr.Suggestions, []string{"status"}) {
+			t.Fatalf("Expected the permission error to suggest status, got: %v", err)
+		}
+	})
+}
+
+func TestLuceneMongoDeprecatedFields(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithAllowedFields([]string{"name", "user.name", "signup_at"}).
+		WithFieldTypes(map[string]bsonic_config.FieldType{"signup_at": bsonic_config.FieldTypeNumber}).
+		WithDeprecatedField("username", "user.name").
+		WithDeprecatedField("created", "signup_at"))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		query      string
+		expected   bson.M
+		deprecated []string
+	}{
+		{"username:john", bson.M{"user.name": "john"}, []string{"username"}},
+		{"username.first:john", bson.M{"user.name.first": "john"}, []string{"username"}},
+		{"name:john OR username:john", bson.M{"$or": []bson.M{{"name": "john"}, {"user.name": "john"}}}, []string{"username"}},
+		// The replacement's type applies, so the value is read as a number
+		{"created:1700000000", bson.M{"signup_at": 1700000000.0}, []string{"created"}},
+		{"user.name:john", bson.M{"user.name": "john"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result, err := parser.ParseDetailed(tt.query)
+			if err != nil {
+				t.Fatalf("ParseDetailed should not return error, got: %v", err)
+			}
+			if !bsonutil.Equal(result.Filter, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, result.Filter)
+			}
+
+			var deprecated []string
+			for _, warning := range result.Warnings {
+				var deprecatedErr *bsonic.DeprecatedFieldError
+				if !errors.Is(warning.Err, bsonic.ErrDeprecatedField) || !errors.As(warning.Err, &deprecatedErr) {
+					t.Fatalf("Expected only deprecated field warnings, got: %v", warning)
+				}
+				deprecated = append(deprecated, deprecatedErr.Field)
+			}
+			if !reflect.DeepEqual(deprecated, tt.deprecated) {
+				t.Errorf("Expected warnings for %v, got %v", tt.deprecated, result.Warnings)
+			}
+		})
+	}
+
+	t.Run("Directives", func(t *testing.T) {
+		result, err := parser.ParseDetailed("DISTINCT username WHERE created:[1 TO *] | sort:-created | fields:username")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if result.DistinctField != "user.name" {
+			t.Errorf("Expected the distinct field to be renamed, got %q", result.DistinctField)
+		}
+		if len(result.Sort) != 1 || result.Sort[0].Key != "signup_at" {
+			t.Errorf("Expected the sort key to be renamed, got %v", result.Sort)
+		}
+		if _, ok := result.Projection["user.name"]; !ok || len(result.Projection) != 1 {
+			t.Errorf("Expected the projection to be renamed, got %v", result.Projection)
+		}
+		if len(result.Warnings) != 2 || result.Warnings[0].String() != "field created is deprecated, use signup_at" ||
+			result.Warnings[1].String() != "field username is deprecated, use user.name" {
+			t.Errorf("Expected one warning per deprecated field, got %v", result.Warnings)
+		}
+	})
+
+	t.Run("BothNames", func(t *testing.T) {
+		result, err := parser.ParseDetailed("username:john AND user.name:jane")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		expected := bson.M{"user.name": "jane", "$and": []bson.M{{"user.name": "john"}}}
+		if !bsonutil.Equal(result.Filter, expected) {
+			t.Errorf("Expected both conditions to be kept, got %v", result.Filter)
+		}
+	})
+}
+
+func TestLuceneMongoClauseOrder(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name"}))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{
+			name:  "ComplexClauseBetweenFields",
+			query: "a:1 AND (b:2 OR c:3) AND d:4",
+			expected: bson.M{"$and": []bson.M{
+				{"a": 1.0},
+				{"$or": []bson.M{{"b": 2.0}, {"c": 3.0}}},
+				{"d": 4.0},
+			}},
+		},
+		{
+			name:     "RepeatedField",
+			query:    "age:18 AND age:65",
+			expected: bson.M{"$and": []bson.M{{"age": 18.0}, {"age": 65.0}}},
+		},
+		{
+			name:     "FieldsAfterRepeatedField",
+			query:    "a:1 AND a:2 AND b:3",
+			expected: bson.M{"$and": []bson.M{{"a": 1.0}, {"a": 2.0}, {"b": 3.0}}},
+		},
+		{
+			name:  "LeadingFieldsMerged",
+			query: "a:1 AND b:2 AND (c:3 OR d:4) AND e:5",
+			expected: bson.M{"$and": []bson.M{
+				{"a": 1.0, "b": 2.0},
+				{"$or": []bson.M{{"c": 3.0}, {"d": 4.0}}},
+				{"e": 5.0},
+			}},
+		},
+		{
+			name:     "NegatedGroup",
+			query:    "NOT (a:1 OR b:2)",
+			expected: bson.M{"$and": []bson.M{{"a": bson.M{"$ne": 1.0}}, {"b": bson.M{"$ne": 2.0}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Parse repeatedly, since a clause order taken from map iteration would vary between runs
+			for range 20 {
+				filter, err := parser.Parse(tt.query)
+				if err != nil {
+					t.Fatalf("Parse should not return error, got: %v", err)
+				}
+				if !reflect.DeepEqual(filter, tt.expected) {
+					t.Fatalf("Expected %v, got %v", tt.expected, filter)
+				}
+			}
+		})
+	}
+}
+
+func TestLuceneMongoConflictPolicy(t *testing.T) {
+	newParser := func(t *testing.T, policy bsonic_config.ConflictPolicy) *bsonic.Parser {
+		t.Helper()
+		cfg := bsonic_config.Default().WithDefaultFields([]string{"name"}).WithArrayFields("tags").WithConflictPolicy(policy)
+		parser, err := bsonic.NewWithConfig(cfg)
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		return parser
+	}
+
+	t.Run("Keep", func(t *testing.T) {
+		filter, err := newParser(t, bsonic_config.ConflictKeep).Parse("age:18 AND age:65")
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		expected := bson.M{"$and": []bson.M{{"age": 18.0}, {"age": 65.0}}}
+		if !reflect.DeepEqual(filter, expected) {
+			t.Errorf("Expected %v, got %v", expected, filter)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		parser := newParser(t, bsonic_config.ConflictError)
+		_, err := parser.Parse("name:john AND (age:18 AND status:active AND age:65)")
+		var conflictErr *bsonic.ConflictError
+		if !errors.Is(err, bsonic.ErrSyntax) || !errors.Is(err, bsonic.ErrConflictingField) || !errors.As(err, &conflictErr) {
+			t.Fatalf("Expected a conflict error, got: %v", err)
+		}
+		if conflictErr.Field != "age" || !reflect.DeepEqual(conflictErr.Values, []interface{}{18.0, 65.0}) {
+			t.Errorf("Expected the conflicting values of age, got %+v", conflictErr)
+		}
+		if err.Error() != "field age cannot equal 18 and 65 at once" {
+			t.Errorf("Unexpected error message: %v", err)
+		}
+
+		for _, query := range []string{"age:18 AND age:18", "age:18 AND age:>10", "name:john AND name:j*", "tags:a AND tags:b", "age:18 OR age:65"} {
+			if _, err := parser.Parse(query); err != nil {
+				t.Errorf("Parse(%q) should not return error, got: %v", query, err)
+			}
+		}
+	})
+
+	t.Run("LastWins", func(t *testing.T) {
+		parser := newParser(t, bsonic_config.ConflictLastWins)
+		tests := []struct {
+			query    string
+			expected bson.M
+		}{
+			{"age:18 AND age:65", bson.M{"age": 65.0}},
+			{"age:18 AND status:active AND age:65", bson.M{"$and": []bson.M{{"status": "active"}, {"age": 65.0}}}},
+			{"(age:18 AND age:65) OR role:admin", bson.M{"$or": []bson.M{{"age": 65.0}, {"role": "admin"}}}},
+			{"tags:a AND tags:b", bson.M{"$and": []bson.M{{"tags": "a"}, {"tags": "b"}}}},
+		}
+		for _, tt := range tests {
+			filter, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(filter, tt.expected) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.expected, filter)
+			}
+		}
+	})
+
+	t.Run("Warn", func(t *testing.T) {
+		result, err := newParser(t, bsonic_config.ConflictWarn).ParseDetailed("name:john AND name:jane AND age:1 AND age:2")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		expected := bson.M{"$and": []bson.M{{"name": "john"}, {"name": "jane"}, {"age": 1.0}, {"age": 2.0}}}
+		if !reflect.DeepEqual(result.Filter, expected) {
+			t.Errorf("Expected the conditions to be kept, got %v", result.Filter)
+		}
+		if len(result.Warnings) != 2 || !errors.Is(result.Warnings[0].Err, bsonic.ErrConflictingField) ||
+			result.Warnings[0].String() != `field name cannot equal "john" and "jane" at once` ||
+			result.Warnings[1].String() != "field age cannot equal 1 and 2 at once" {
+			t.Errorf("Expected a warning per conflicting field, got %v", result.Warnings)
+		}
+	})
+}
+
+func TestLuceneMongoEnumFields(t *testing.T) {
+	cfg := bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithEnumField("status", "active", "pending", "closed")
+	parser, _ := bsonic.NewWithConfig(cfg)
+
+	valid := []string{
+		"status:active",
+		"NOT status:closed",
+		"status:active OR status:pending",
+		"status:act*",
+		"name:john AND status:pending",
+		"status:/^(active|closed)$/",
+	}
+	for _, query := range valid {
+		if _, err := parser.Parse(query); err != nil {
+			t.Errorf("Expected %q to be valid, got: %v", query, err)
+		}
+	}
+
+	tests := []struct {
+		query      string
+		value      string
+		suggestion string
+	}{
+		{"status:actve", "actve", "active"},
+		{"status:Active", "Active", "active"},
+		{"NOT status:deleted", "deleted", ""},
+		{"name:john AND (status:active OR status:opn)", "opn", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := parser.Parse(tt.query)
+			var enumErr *bsonic.EnumError
+			if !errors.As(err, &enumErr) {
+				t.Fatalf("Expected an EnumError, got: %v", err)
+			}
+			if !errors.Is(err, bsonic.ErrSyntax) {
+				t.Errorf("Expected the error to match ErrSyntax, got: %v", err)
+			}
+			if enumErr.Field != "status" || enumErr.Value != tt.value || enumErr.Suggestion != tt.suggestion {
+				t.Errorf("Expected status value %q with suggestion %q, got %+v", tt.value, tt.suggestion, enumErr)
+			}
+			if !strings.Contains(err.Error(), "allowed values are active, pending, closed") {
+				t.Errorf("Expected the error to list the allowed values, got: %v", err)
+			}
+		})
+	}
+
+	t.Run("RejectWildcards", func(t *testing.T) {
+		parser, _ := bsonic.NewWithConfig(cfg.WithRejectEnumWildcards(true))
+		for _, query := range []string{"status:act*", "status:*", "NOT status:/^clo/"} {
+			_, err := parser.Parse(query)
+			var enumErr *bsonic.EnumError
+			if !errors.As(err, &enumErr) || !enumErr.Wildcard {
+				t.Errorf("Expected a wildcard EnumError for %q, got: %v", query, err)
+			}
+		}
+		if _, err := parser.Parse("name:jo* AND status:active"); err != nil {
+			t.Errorf("Expected wildcards on other fields to be allowed, got: %v", err)
+		}
+	})
+}
+
+// TestLuceneMongoBoolCoercion tests the global and per-field boolean coercion policies
+func TestLuceneMongoBoolCoercion(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      *bsonic_config.Config
+		query    string
+		expected bson.M
+	}{
+		{"AlwaysByDefault", bsonic_config.Default(), "username:true", bson.M{"username": true}},
+		{"Schema", bsonic_config.Default().WithBoolCoercion(bsonic_config.BoolCoercionSchema), "username:true", bson.M{"username": "true"}},
+		{"SchemaTypedBool", bsonic_config.Default().WithBoolCoercion(bsonic_config.BoolCoercionSchema).
+			WithFieldTypes(map[string]bsonic_config.FieldType{"active": bsonic_config.FieldTypeBool}), "active:false", bson.M{"active": false}},
+		{"SchemaTypedNumber", bsonic_config.Default().WithBoolCoercion(bsonic_config.BoolCoercionSchema).
+			WithFieldTypes(map[string]bsonic_config.FieldType{"age": bsonic_config.FieldTypeNumber}), "age:true", bson.M{"age": "true"}},
+		{"SchemaKeepsNumbers", bsonic_config.Default().WithBoolCoercion(bsonic_config.BoolCoercionSchema), "age:30", bson.M{"age": 30.0}},
+		{"FieldOverridesGlobal", bsonic_config.Default().WithBoolCoercion(bsonic_config.BoolCoercionSchema).
+			WithFieldBoolCoercion("active", bsonic_config.BoolCoercionAlways), "active:true", bson.M{"active": true}},
+		{"FieldOnly", bsonic_config.Default().WithFieldBoolCoercion("username", bsonic_config.BoolCoercionSchema),
+			"username:false AND active:false", bson.M{"username": "false", "active": false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, _ := bsonic.NewWithConfig(tt.cfg.WithDefaultFields([]string{"name"}))
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestLuceneMongoQuotedValuesStayStrings tests that quoted values are not converted, while unquoted values are
+func TestLuceneMongoQuotedValuesStayStrings(t *testing.T) {
+	parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithFieldTypes(map[string]bsonic_config.FieldType{"version": bsonic_config.FieldTypeNumber}))
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"Number", `age:"25"`, bson.M{"age": "25"}},
+		{"UnquotedNumber", `age:25`, bson.M{"age": 25.0}},
+		{"Bool", `active:'true'`, bson.M{"active": "true"}},
+		{"Date", `created_at:"2023-01-15"`, bson.M{"created_at": "2023-01-15"}},
+		{"ObjectID", `id:"507f1f77bcf86cd799439011"`, bson.M{"_id": "507f1f77bcf86cd799439011"}},
+		{"Not", `NOT age:"25"`, bson.M{"age": bson.M{"$ne": "25"}}},
+		{"TypedFieldWins", `version:"2"`, bson.M{"version": 2.0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestLuceneMongoLiteralValues tests that quoting and backslash escaping disable wildcards, ranges and operators
+func TestLuceneMongoLiteralValues(t *testing.T) {
+	parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithFieldTypes(map[string]bsonic_config.FieldType{"code": bsonic_config.FieldTypeString}))
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"QuotedAsterisk", `sku:"AB*12"`, bson.M{"sku": "AB*12"}},
+		{"EscapedAsterisk", `sku:AB\*12`, bson.M{"sku": "AB*12"}},
+		{"EscapedAsteriskInWildcard", `sku:*\*12`, bson.M{"sku": bson.M{"$regex": `.*\*12$`}}},
+		{"QuotedOperator", `name:"OR"`, bson.M{"name": "OR"}},
+		{"EscapedOperator", `name:\OR`, bson.M{"name": "OR"}},
+		{"QuotedRange", `code:"[1 TO 5]"`, bson.M{"code": "[1 TO 5]"}},
+		{"EscapedBrackets", `code:\[draft\]`, bson.M{"code": "[draft]"}},
+		{"QuotedRegex", `path:"/tmp/"`, bson.M{"path": "/tmp/"}},
+		{"QuotedComparison", `note:">5"`, bson.M{"note": ">5"}},
+		{"NotEscaped", `NOT sku:AB\*12`, bson.M{"sku": bson.M{"$ne": "AB*12"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestLuceneMongoUnicodeNormalization tests that composed and decomposed input parse to the same NFC filter
+func TestLuceneMongoUnicodeNormalization(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	composed, err := parser.Parse("name:café")
+	if err != nil {
+		t.Fatalf("Parse should not return error, got: %v", err)
+	}
+	decomposed, err := parser.Parse("name:cafe\u0301")
+	if err != nil {
+		t.Fatalf("Parse should not return error, got: %v", err)
+	}
+
+	expected := bson.M{"name": "café"}
+	if !reflect.DeepEqual(composed, expected) || !reflect.DeepEqual(decomposed, expected) {
+		t.Fatalf("Expected both forms to produce %v, got %v and %v", expected, composed, decomposed)
+	}
+}
+
+// TestLuceneMongoPunctuationNormalization tests that typographic punctuation pasted into a query parses as its ASCII form
+func TestLuceneMongoPunctuationNormalization(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"CurlyDoubleQuotes", "name:“john doe”", bson.M{"name": "john doe"}},
+		{"CurlySingleQuotes", "name:‘john doe’", bson.M{"name": "john doe"}},
+		{"Apostrophe", "name:O’Brien", bson.M{"name": "O'Brien"}},
+		{"FullWidthColon", "name：john", bson.M{"name": "john"}},
+		{"FullWidthParentheses", "（name:john OR name:jane）", bson.M{"name": bson.M{"$in": []interface{}{"john", "jane"}}}},
+		{"NonBreakingSpaces", "name:john\u00a0AND\u202frole:admin", bson.M{"name": "john", "role": "admin"}},
+		{"EscapedQuote", `name:\“john`, bson.M{"name": "“john"}},
+		{"QuotedValue", `name:"john doe"`, bson.M{"name": "john doe"}},
+		{"QuotedLiteral", "name:\"a：b\" AND role:‘x y’", bson.M{"name": "a：b", "role": "x y"}},
+		{"QuotedCurlyQuotes", `name:"“ OR role:admin OR “"`, bson.M{"name": "“ OR role:admin OR “"}},
+		{"SingleQuotedLiteral", "name:'a\u00a0b'", bson.M{"name": "a\u00a0b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("ExplainSpans", func(t *testing.T) {
+		explanation, err := parser.Explain("name:“john doe” AND role:admin")
+		if err != nil {
+			t.Fatalf("Explain should not return error, got: %v", err)
+		}
+		if len(explanation.Clauses) != 2 || explanation.Clauses[0].Text != `name:"john doe"` || explanation.Clauses[1].Text != "role:admin" {
+			t.Errorf("expected clause texts from the normalized query, got %+v", explanation.Clauses)
+		}
+	})
+
+	t.Run("MQLUnchanged", func(t *testing.T) {
+		mqlParser, err := bsonic.NewWithConfig(bsonic_config.Default().WithLanguage(bsonic_config.LanguageMQL))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		result, err := mqlParser.Parse(`{"name": "O’Brien"}`)
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		if result["name"] != "O’Brien" {
+			t.Errorf("expected MQL string values to keep their punctuation, got %v", result)
+		}
+	})
+}
+
+// TestLuceneMongoAccentInsensitive tests that accent-insensitive matching folds accented letters into character classes
+func TestLuceneMongoAccentInsensitive(t *testing.T) {
+	parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithAccentInsensitive(true))
+
+	cafe := "^[cçćĉċč][aàáâãäåāăą]f[eèéêëēĕėęě]$"
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"FieldUnaccented", "name:cafe", bson.M{"name": bson.M{"$regex": cafe}}},
+		{"FieldAccented", "name:café", bson.M{"name": bson.M{"$regex": cafe}}},
+		{"FieldDecomposed", "name:cafe\u0301", bson.M{"name": bson.M{"$regex": cafe}}},
+		{"FreeText", "café", bson.M{"name": bson.M{"$regex": cafe, "$options": "i"}}},
+		{"Wildcard", "name:caf*", bson.M{"name": bson.M{"$regex": "^[cçćĉċč][aàáâãäåāăą]f.*"}}},
+		{"Not", "NOT name:cafe", bson.M{"name": bson.M{"$not": bson.M{"$regex": cafe}}}},
+		{"EscapesPunctuation", "name:1.5", bson.M{"name": 1.5}},
+		{"NoFoldableLetters", "name:1-2", bson.M{"name": "1-2"}},
+		{"UserRegexUnchanged", "name:/^caf.$/", bson.M{"name": bson.M{"$regex": "^caf.$"}}},
+		{"OrCollapsesToIn", "name:cafe OR name:1-2", bson.M{"name": bson.M{"$in": []interface{}{bson.Regex{Pattern: cafe}, "1-2"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("EnumFieldsMatchExactly", func(t *testing.T) {
+		enumParser, err := bsonic.NewWithConfig(bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithAccentInsensitive(true).
+			WithEnumField("status", "active", "inactive"))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		var enumErr *bsonic.EnumError
+		if _, err := enumParser.Parse("status:activ"); !errors.As(err, &enumErr) {
+			t.Fatalf("Expected an EnumError, got %v", err)
+		}
+		result, err := enumParser.Parse("status:active OR status:inactive")
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		expected := bson.M{"status": bson.M{"$in": []interface{}{"active", "inactive"}}}
+		if !reflect.DeepEqual(result, expected) {
+			t.Fatalf("Expected %v, got %v", expected, result)
+		}
+	})
+
+	t.Run("UpdateValuesMatchExactly", func(t *testing.T) {
+		update, err := parser.ParseUpdate("SET name:café")
+		if err != nil {
+			t.Fatalf("ParseUpdate should not return error, got: %v", err)
+		}
+		expected := bson.M{"$set": bson.M{"name": "café"}}
+		if !reflect.DeepEqual(update, expected) {
+			t.Fatalf("Expected %v, got %v", expected, update)
+		}
+	})
+}
+
+// TestLuceneMongoNumericLiterals tests scientific notation, digit separators, signs and hexadecimal, octal and binary
+// literals in equality, comparison and range clauses
+func TestLuceneMongoNumericLiterals(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"Exponent", "views:1e6", bson.M{"views": 1e6}},
+		{"NegativeExponent", "ratio:2.5e-3", bson.M{"ratio": 0.0025}},
+		{"Underscores", "views:1_000_000", bson.M{"views": 1e6}},
+		{"PlusSign", "delta:+3.5", bson.M{"delta": 3.5}},
+		{"Comparison", "views:>=1_000", bson.M{"views": bson.M{"$gte": 1000.0}}},
+		{"NegativeComparison", "delta:>-1e-3", bson.M{"delta": bson.M{"$gt": -0.001}}},
+		{"Range", "views:[1e3 TO 1_000_000]", bson.M{"views": bson.M{"$gte": 1000.0, "$lte": 1e6}}},
+		{"NegativeRange", "delta:[-5 TO +5]", bson.M{"delta": bson.M{"$gte": -5.0, "$lte": 5.0}}},
+		{"NaNIsString", "name:nan", bson.M{"name": "nan"}},
+		{"InfIsString", "name:Inf", bson.M{"name": "Inf"}},
+		{"MisplacedUnderscore", "code:1__0", bson.M{"code": "1__0"}},
+		{"Hex", "flags:0xFF", bson.M{"flags": 255.0}},
+		{"Octal", "perm:0o755", bson.M{"perm": 493.0}},
+		{"Binary", "mask:0b1010", bson.M{"mask": 10.0}},
+		{"NegativeHex", "delta:-0x10", bson.M{"delta": -16.0}},
+		{"HexUnderscores", "flags:0x1_00", bson.M{"flags": 256.0}},
+		{"HexComparison", "flags:>=0x10", bson.M{"flags": bson.M{"$gte": 16.0}}},
+		{"RadixRange", "perm:[0o600 TO 0b111111111]", bson.M{"perm": bson.M{"$gte": 384.0, "$lte": 511.0}}},
+		{"InvalidHexIsString", "code:0xZZ", bson.M{"code": "0xZZ"}},
+		{"LeadingZeroIsDecimal", "code:0755", bson.M{"code": 755.0}},
+		{"QuotedHexIsString", `code:"0xFF"`, bson.M{"code": "0xFF"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+// TestLuceneMongoDurations tests that duration literals convert to the configured unit
+func TestLuceneMongoDurations(t *testing.T) {
+	parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithDurationUnit(time.Second))
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"Equality", "timeout:90s", bson.M{"timeout": 90.0}},
+		{"Compound", "timeout:1h30m", bson.M{"timeout": 5400.0}},
+		{"Fractional", "timeout:1.5m", bson.M{"timeout": 90.0}},
+		{"Comparison", "timeout:>30s", bson.M{"timeout": bson.M{"$gt": 30.0}}},
+		{"SubUnit", "latency:<=500ms", bson.M{"latency": bson.M{"$lte": 0.5}}},
+		{"Range", "duration:[1h TO 4h]", bson.M{"duration": bson.M{"$gte": 3600.0, "$lte": 14400.0}}},
+		{"OpenRange", "duration:[* TO 2h]", bson.M{"duration": bson.M{"$lte": 7200.0}}},
+		{"NumbersUnchanged", "age:30", bson.M{"age": 30.0}},
+		{"NotADuration", "name:5x", bson.M{"name": "5x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("Milliseconds", func(t *testing.T) {
+		parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithDurationUnit(time.Millisecond))
+		result, err := parser.Parse("timeout:>30s")
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		if expected := (bson.M{"timeout": bson.M{"$gt": 30000.0}}); !reflect.DeepEqual(result, expected) {
+			t.Fatalf("Expected %v, got %v", expected, result)
+		}
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		result, err := createParserWithDefaults([]string{"name"}).Parse("timeout:30s")
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		if expected := (bson.M{"timeout": "30s"}); !reflect.DeepEqual(result, expected) {
+			t.Fatalf("Expected %v, got %v", expected, result)
+		}
+	})
+}
+
+// TestLuceneMongoMoney tests that money literals are stripped of their currency and converted
+func TestLuceneMongoMoney(t *testing.T) {
+	rates := map[string]float64{"USD": 1, "EUR": 1.1, "GBP": 1.25}
+	var currencies []string
+	parser, _ := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithCurrencyConverter(func(amount float64, currency string) (float64, error) {
+			currencies = append(currencies, currency)
+			rate, ok := rates[currency]
+			if !ok {
+				return 0, errors.New("unknown currency " + currency)
+			}
+			return amount * rate, nil
+		}))
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+		currency string
+	}{
+		{"Symbol", "price:$10.50", bson.M{"price": 10.5}, "USD"},
+		{"QuotedComparison", `price:>"$10.50"`, bson.M{"price": bson.M{"$gt": 10.5}}, "USD"},
+		{"CodeSuffix", "price:>10EUR", bson.M{"price": bson.M{"$gt": 11.0}}, "EUR"},
+		{"LowercaseCode", "price:<=4usd", bson.M{"price": bson.M{"$lte": 4.0}}, "USD"},
+		{"ThousandsSeparator", "price:£1,000", bson.M{"price": 1250.0}, "GBP"},
+		{"Range", "price:[$5 TO $10]", bson.M{"price": bson.M{"$gte": 5.0, "$lte": 10.0}}, "USD"},
+		{"OpenRange", "price:[* TO 20EUR]", bson.M{"price": bson.M{"$lte": 22.0}}, "EUR"},
+		{"PlainNumber", "price:10.50", bson.M{"price": 10.5}, ""},
+		{"QuotedEqualityIsLiteral", `price:"$10.50"`, bson.M{"price": "$10.50"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currencies = nil
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+			if tt.currency != "" && (len(currencies) == 0 || currencies[len(currencies)-1] != tt.currency) {
+				t.Errorf("Expected the converter to receive %s, got %v", tt.currency, currencies)
+			}
+		})
+	}
+
+	if _, err := parser.Parse("price:>10JPY"); err == nil || !strings.Contains(err.Error(), "unknown currency JPY") {
+		t.Errorf("Expected the converter error to fail the query, got: %v", err)
+	}
+}
+
+func TestLuceneMongoPrefixOperators(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"ExcludeAndRequire", "role:admin -status:banned +active:true", bson.M{"role": "admin", "status": bson.M{"$ne": "banned"}, "active": true}},
+		{"AfterOperator", "role:admin AND -status:banned", bson.M{"role": "admin", "status": bson.M{"$ne": "banned"}}},
+		{"BindsTighterThanOr", "role:admin -status:banned OR role:owner", bson.M{"$or": []bson.M{
+			{"role": "admin", "status": bson.M{"$ne": "banned"}},
+			{"role": "owner"},
+		}}},
+		{"Group", "-(role:admin OR role:owner)", bson.M{"$and": []bson.M{
+			{"role": bson.M{"$ne": "admin"}},
+			{"role": bson.M{"$ne": "owner"}},
+		}}},
+		{"QuotedPhrase", `role:admin -"john doe"`, bson.M{"role": "admin", "name": bson.M{"$not": bson.M{"$regex": "^john doe$", "$options": "i"}}}},
+		{"NegativeValue", "age:-5", bson.M{"age": -5.0}},
+		{"NegativeFreeText", "-5", bson.M{"name": bson.M{"$regex": "^-5$", "$options": "i"}}},
+		{"DashInValue", "sort_key:-created_at", bson.M{"sort_key": "-created_at"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestLuceneMongoMultilineQueries(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"BetweenClauses", "name:john\nAND age:30", bson.M{"name": "john", "age": 30.0}},
+		{"WindowsLineEndings", "name:john\r\nAND age:30\r\n", bson.M{"name": "john", "age": 30.0}},
+		{"LeadingAndTrailingBlankLines", "\n\n  name:john\n\n", bson.M{"name": "john"}},
+		{"InsideParentheses", "(\n  name:john\n  OR name:jane\n)\nAND age:30", bson.M{"$and": []bson.M{
+			{"name": bson.M{"$in": []interface{}{"john", "jane"}}},
+			{"age": 30.0},
+		}}},
+		{"AfterColon", "age:\n  30", bson.M{"age": 30.0}},
+		{"InsideRange", "age:[\n  18\n  TO\n  65\n]", bson.M{"age": bson.M{"$gte": 18.0, "$lte": 65.0}}},
+		{"ExplicitContinuation", "name:john \\\nAND age:30", bson.M{"name": "john", "age": 30.0}},
+		{"ExplicitContinuationWindows", "name:john\\\r\nAND age:30", bson.M{"name": "john", "age": 30.0}},
+		{"PrefixOperatorOnNewLine", "role:admin\n-status:banned", bson.M{"role": "admin", "status": bson.M{"$ne": "banned"}}},
+		{"NewlineInQuotedValue", "note:\"line one\nline two\"", bson.M{"note": "line one\nline two"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	result, err := parser.ParseDetailed("role:admin\n| sort:-created_at\n| limit:50")
+	if err != nil {
+		t.Fatalf("ParseDetailed should not return error, got: %v", err)
+	}
+	if !reflect.DeepEqual(result.Filter, bson.M{"role": "admin"}) || result.Limit != 50 {
+		t.Errorf("Expected multiline directives to apply, got filter %v and limit %d", result.Filter, result.Limit)
+	}
+}
+
+func TestLuceneMongoFlattenLogicalOperators(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name", "description"})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"NestedAnd", "(a:1 AND b:2) AND (c:3 OR d:4) AND e:5", bson.M{"$and": []bson.M{
+			{"a": 1.0, "b": 2.0},
+			{"$or": []bson.M{{"c": 3.0}, {"d": 4.0}}},
+			{"e": 5.0},
+		}}},
+		{"NestedOr", "a:1 OR (b:2 OR (c:3 OR d:4))", bson.M{"$or": []bson.M{
+			{"a": 1.0},
+			{"b": 2.0},
+			{"c": 3.0},
+			{"d": 4.0},
+		}}},
+		{"NegatedOrInAnd", "a:1 AND a:2 AND NOT (b:1 OR b:2)", bson.M{"$and": []bson.M{
+			{"a": 2.0},
+			{"b": bson.M{"$ne": 1.0}},
+			{"b": bson.M{"$ne": 2.0}},
+			{"a": 1.0},
+		}}},
+		{"FreeTextOrInOr", "role:admin OR john", bson.M{"$or": []bson.M{
+			{"role": "admin"},
+			{"name": bson.M{"$regex": "^john$", "$options": "i"}},
+			{"description": bson.M{"$regex": "^john$", "$options": "i"}},
+		}}},
+		{"MixedOperatorsKept", "(a:1 OR b:2) AND (c:3 OR d:4)", bson.M{"$and": []bson.M{
+			{"$or": []bson.M{{"a": 1.0}, {"b": 2.0}}},
+			{"$or": []bson.M{{"c": 3.0}, {"d": 4.0}}},
+		}}},
+		{"SingleGroup", "((a:1))", bson.M{"a": 1.0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !bsonutil.Equal(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestLuceneMongoEqualityOrToIn(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"Strings", "status:active OR status:pending OR status:trial", bson.M{"status": bson.M{"$in": []interface{}{"active", "pending", "trial"}}}},
+		{"Numbers", "age:18 OR age:21", bson.M{"age": bson.M{"$in": []interface{}{18.0, 21.0}}}},
+		{"Booleans", "active:true OR active:false", bson.M{"active": bson.M{"$in": []interface{}{true, false}}}},
+		{"NestedGroups", "status:a OR (status:b OR status:c)", bson.M{"status": bson.M{"$in": []interface{}{"a", "b", "c"}}}},
+		{"InsideAnd", "role:admin AND (status:a OR status:b)", bson.M{"$and": []bson.M{
+			{"status": bson.M{"$in": []interface{}{"a", "b"}}},
+			{"role": "admin"},
+		}}},
+		{"DifferentFields", "status:a OR role:b", bson.M{"$or": []bson.M{{"status": "a"}, {"role": "b"}}}},
+		{"WildcardKeepsOr", "status:a OR status:b*", bson.M{"$or": []bson.M{
+			{"status": "a"},
+			{"status": bson.M{"$regex": "^b.*"}},
+		}}},
+		{"ComparisonKeepsOr", "age:18 OR age:>65", bson.M{"$or": []bson.M{
+			{"age": 18.0},
+			{"age": bson.M{"$gt": 65.0}},
+		}}},
+		{"MultiFieldClauseKeepsOr", "status:a OR (status:b AND role:c)", bson.M{"$or": []bson.M{
+			{"status": "a"},
+			{"status": "b", "role": "c"},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !bsonutil.Equal(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// Long OR lists collapse to a single $in
+	values := make([]string, 200)
+	clauses := make([]string, 200)
+	expected := make([]interface{}, 200)
+	for i := range values {
+		values[i] = fmt.Sprintf("sku%03d", i)
+		clauses[i] = "sku:" + values[i]
+		expected[i] = values[i]
+	}
+	result, err := parser.Parse(strings.Join(clauses, " OR "))
+	if err != nil {
+		t.Fatalf("Parse should not return error, got: %v", err)
+	}
+	if !bsonutil.Equal(result, bson.M{"sku": bson.M{"$in": expected}}) {
+		t.Errorf("Expected a single $in with 200 values, got %v", result)
+	}
+}
+
+func TestLuceneMongoRangeMerge(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"DoubleBounded", "age:>=18 AND age:<65", bson.M{"age": bson.M{"$gte": 18.0, "$lt": 65.0}}},
+		{"WithOtherFields", "name:john AND age:>=18 AND age:<65", bson.M{"name": "john", "age": bson.M{"$gte": 18.0, "$lt": 65.0}}},
+		{"TighterLowerBound", "age:>18 AND age:>21", bson.M{"age": bson.M{"$gt": 21.0}}},
+		{"ExclusiveWinsTie", "age:>=18 AND age:>18", bson.M{"age": bson.M{"$gt": 18.0}}},
+		{"NarrowsRange", "age:[18 TO 65] AND age:<30", bson.M{"age": bson.M{"$gte": 18.0, "$lt": 30.0}}},
+		{"SinglePoint", "age:>=5 AND age:<=5", bson.M{"age": bson.M{"$gte": 5.0, "$lte": 5.0}}},
+		{"Dates", "created_at:>=2024-01-01 AND created_at:<2024-02-01", bson.M{"created_at": bson.M{
+			"$gte": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			"$lt":  time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		}}},
+		{"AlongsideComplexClauses", "(a:x OR b:y) AND age:>1 AND age:<3", bson.M{"$and": []bson.M{
+			{"$or": []bson.M{{"a": "x"}, {"b": "y"}}},
+			{"age": bson.M{"$gt": 1.0, "$lt": 3.0}},
+		}}},
+		{"EqualityNotMerged", "age:18 AND age:>5", bson.M{"$and": []bson.M{
+			{"age": bson.M{"$gt": 5.0}},
+			{"age": 18.0},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !bsonutil.Equal(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	impossible := []struct {
+		query   string
+		message string
+	}{
+		{"age:>70 AND age:<65", "impossible range on field age: no value is > 70 and < 65"},
+		{"age:>5 AND age:<=5", "impossible range on field age: no value is > 5 and <= 5"},
+		{"age:[1 TO 10] AND age:>=20", "impossible range on field age: no value is >= 20 and <= 10"},
+		{"created_at:>2024-03-01 AND created_at:<2024-02-01", "impossible range on field created_at: no value is > 2024-03-01T00:00:00Z and < 2024-02-01T00:00:00Z"},
+	}
+	for _, tt := range impossible {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := parser.Parse(tt.query)
+			if err == nil || err.Error() != tt.message {
+				t.Fatalf("Expected error %q, got: %v", tt.message, err)
+			}
+			if !errors.Is(err, bsonic.ErrSyntax) {
+				t.Errorf("Expected an ErrSyntax error, got: %v", err)
+			}
+		})
+	}
+}
+
+// TestLuceneMongoOutputVersion2Logic tests that pinning OutputVersion2 keeps the logical structure it produced
+func TestLuceneMongoOutputVersion2Logic(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithOutputVersion(bsonic_config.OutputVersion2))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"NestedOrKept", "a:1 OR (b:2 OR c:3)", bson.M{"$or": []bson.M{
+			{"a": 1.0},
+			{"$or": []bson.M{{"b": 2.0}, {"c": 3.0}}},
+		}}},
+		{"NoIn", "status:active OR status:pending", bson.M{"$or": []bson.M{
+			{"status": "active"},
+			{"status": "pending"},
+		}}},
+		{"ComparisonsKept", "age:>=18 AND age:<65", bson.M{"$and": []bson.M{
+			{"age": bson.M{"$lt": 65.0}},
+			{"age": bson.M{"$gte": 18.0}},
+		}}},
+		{"DirectFieldsLast", "name:john AND (age:30 OR age:40)", bson.M{"$and": []bson.M{
+			{"$or": []bson.M{{"age": 30.0}, {"age": 40.0}}},
+			{"name": "john"},
+		}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	// Impossible ranges are only detected when comparisons merge
+	if _, err := parser.Parse("age:>70 AND age:<65"); err != nil {
+		t.Errorf("Parse should not return error, got: %v", err)
+	}
+}
+
+func TestLuceneMongoLenientErrors(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"message"}).
+		WithAllowedFields([]string{"message", "level", "host", "age", "role", "status", "active"}).
+		WithEnumField("level", "debug", "info", "warn", "error").
+		WithLenientErrors(true))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+		limit    int64
+		dropped  []string
+	}{
+		{"Valid", "level:error AND host:web1", bson.M{"level": "error", "host": "web1"}, 0, nil},
+		{"IncompleteClause", "level:error AND host:", bson.M{"level": "error"}, 0, []string{"host:"}},
+		{"UnclosedGroup", "level:error OR (host:web1 AND", bson.M{"level": "error"}, 0, []string{"(host:web1 AND"}},
+		{"StrayParenthesis", "level:error AND ) OR host:web1", bson.M{"$or": []bson.M{{"level": "error"}, {"host": "web1"}}}, 0, []string{")"}},
+		{"InvalidEnumValue", "host:web1 AND level:eror", bson.M{"host": "web1"}, 0, []string{"level:eror"}},
+		{"ImpossibleRange", "age:>70 AND age:<65", bson.M{"age": bson.M{"$gt": 70.0}}, 0, []string{"age:<65"}},
+		{"PrefixOperators", "role:admin -status: +active:true", bson.M{"role": "admin", "active": true}, 0, []string{"-status:"}},
+		{"InvalidDirective", "level:error | limit:abc | limit:20", bson.M{"level": "error"}, 20, []string{"limit:abc"}},
+		{"NothingParses", "host: AND (", bson.M{}, 0, []string{"host:", "("}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.ParseDetailed(tt.query)
+			if err != nil {
+				t.Fatalf("ParseDetailed should not return error, got: %v", err)
+			}
+			if !bsonutil.Equal(result.Filter, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, result.Filter)
+			}
+			if result.Limit != tt.limit {
+				t.Errorf("Expected limit %d, got %d", tt.limit, result.Limit)
+			}
+
+			var dropped []string
+			for _, warning := range result.Warnings {
+				dropped = append(dropped, warning.Clause)
+				if !errors.Is(warning.Err, bsonic.ErrSyntax) {
+					t.Errorf("Expected warning %s to hold an ErrSyntax error, got: %v", warning, warning.Err)
+				}
+			}
+			if !reflect.DeepEqual(dropped, tt.dropped) {
+				t.Errorf("Expected dropped clauses %q, got %q", tt.dropped, dropped)
+			}
+		})
+	}
+
+	t.Run("DisallowedFieldStillFails", func(t *testing.T) {
+		_, err := parser.Parse("level:error AND password:x")
+		if !errors.Is(err, bsonic.ErrDisallowedField) {
+			t.Fatalf("Expected ErrDisallowedField, got: %v", err)
+		}
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		strict := createParserWithDefaults([]string{"message"})
+		if _, err := strict.Parse("level:error AND host:"); !errors.Is(err, bsonic.ErrSyntax) {
+			t.Fatalf("Expected ErrSyntax, got: %v", err)
+		}
+	})
+}
+
+func TestLuceneMongoDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   string
+		after    string
+		expected []bsonic.Change
+	}{
+		{"Unchanged", "role:admin AND status:active", "role:admin AND status:active", nil},
+		{"OnlyFormatting", "role:admin   AND\n status:active", "status:active AND role:admin", nil},
+		{"ModifiedValue", "role:admin AND status:active", "role:admin AND status:inactive", []bsonic.Change{
+			{Kind: bsonic.ChangeModified, Target: bsonic.TargetClause, Field: "status", Before: "status:active", After: "status:inactive"},
+		}},
+		{"ModifiedNegation", "role:admin AND status:banned", "role:admin AND NOT status:banned", []bsonic.Change{
+			{Kind: bsonic.ChangeModified, Target: bsonic.TargetClause, Field: "status", Before: "status:banned", After: "NOT status:banned"},
+		}},
+		{"AddedClause", "role:admin", "role:admin AND age:>=18", []bsonic.Change{
+			{Kind: bsonic.ChangeAdded, Target: bsonic.TargetClause, Field: "age", After: "age:>=18"},
+		}},
+		{"RemovedFreeText", `role:admin AND "john doe"`, "role:admin", []bsonic.Change{
+			{Kind: bsonic.ChangeRemoved, Target: bsonic.TargetClause, Before: `"john doe"`},
+		}},
+		{"ChangedOperator", "role:admin AND role:owner", "role:admin OR role:owner", []bsonic.Change{
+			{Kind: bsonic.ChangeModified, Target: bsonic.TargetLogic, Before: "role:admin AND role:owner", After: "role:admin OR role:owner"},
+		}},
+		{"AddedClauseWithOr", "a:1 AND b:2", "a:1 OR b:2 OR c:3", []bsonic.Change{
+			{Kind: bsonic.ChangeAdded, Target: bsonic.TargetClause, Field: "c", After: "c:3"},
+			{Kind: bsonic.ChangeModified, Target: bsonic.TargetLogic, Before: "a:1 AND b:2", After: "a:1 OR b:2 OR c:3"},
+		}},
+		{"NegatedGroup", "a:1 AND (b:1 OR c:2)", "a:1 AND NOT (b:1 OR c:2)", []bsonic.Change{
+			{Kind: bsonic.ChangeModified, Target: bsonic.TargetLogic, Before: "a:1 AND (b:1 OR c:2)", After: "a:1 AND NOT (b:1 OR c:2)"},
+		}},
+		{"DirectivesAndIntent", "level:error | limit:10 | fields:msg", "COUNT WHERE level:error | limit:20 | sort:-ts", []bsonic.Change{
+			{Kind: bsonic.ChangeAdded, Target: bsonic.TargetIntent, After: "COUNT WHERE"},
+			{Kind: bsonic.ChangeModified, Target: bsonic.TargetDirective, Field: "limit", Before: "limit:10", After: "limit:20"},
+			{Kind: bsonic.ChangeRemoved, Target: bsonic.TargetDirective, Field: "fields", Before: "fields:msg"},
+			{Kind: bsonic.ChangeAdded, Target: bsonic.TargetDirective, Field: "sort", After: "sort:-ts"},
+		}},
+		{"FromEmpty", "", "role:admin", []bsonic.Change{
+			{Kind: bsonic.ChangeAdded, Target: bsonic.TargetClause, Field: "role", After: "role:admin"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := bsonic.Diff(tt.before, tt.after)
+			if err != nil {
+				t.Fatalf("Diff should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Fatalf("Expected %+v, got %+v", tt.expected, changes)
+			}
+		})
+	}
+
+	if _, err := bsonic.Diff("role:admin", "role:admin AND"); !errors.Is(err, bsonic.ErrSyntax) {
+		t.Errorf("Expected ErrSyntax for an invalid query, got: %v", err)
+	}
+}
+
+// astEncodingQueries cover every node type and value kind of the encoded AST schema
+var astEncodingQueries = []string{
+	"price:(>=10 AND <=20) OR status:(active OR NOT closed)",
+	"role:admin AND status:active",
+	"COUNT WHERE level:error",
+	"DISTINCT country WHERE active:true | sort:-created_at | limit:10",
+	`name:"john doe" OR name:'jane' AND NOT (age:[18 TO 65] OR age:>=90)`,
+	`-spam +"hello world"~lang:fr OR /jo.*n/`,
+	"created_at:2024-01-01T10:00:00Z AND start:10:30:00 AND email:/.*@example\\.com/",
+	"url:https://example.com:8080/a?b=c OR home:http://localhost",
+	"host:2001:db8::1 OR net:10.0.0.0/8 OR net:fe80::/10",
+	"user_id:IN_QUERY(users WHERE role:admin AND NOT banned:true)",
+	"name:john doe",
+	"in:orders COUNT WHERE status:pending",
+	"age:TYPE(int, long) AND NOT name:TYPE(string)",
+	`count:int(42) AND NOT since:date("2023-01-15") AND code:str('a \'b\'')`,
+	`profile:{address:{city:"SF"} AND NOT verified:true}`,
+	`name:john^2 OR "john smith"~3 OR (a OR b)^1.5 OR roam~`,
+}
+
+func TestLuceneMongoASTJSON(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	for _, query := range astEncodingQueries {
+		t.Run(query, func(t *testing.T) {
+			ast, err := lucene.New().Parse(query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			data, err := json.Marshal(ast)
+			if err != nil {
+				t.Fatalf("Marshal should not return error, got: %v", err)
+			}
+
+			var decoded lucene.ParticipleQuery
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal should not return error, got: %v", err)
+			}
+			if got, want := lucene.Unparse(&decoded), lucene.Unparse(ast.(*lucene.ParticipleQuery)); got != want {
+				t.Errorf("Expected round trip to give %q, got %q", want, got)
+			}
+
+			// Subqueries need a resolver, so both fail the same way
+			expected, expectedErr := parser.ParseDetailed(query)
+			result, err := parser.FormatAST(&decoded)
+			if fmt.Sprint(err) != fmt.Sprint(expectedErr) {
+				t.Fatalf("Expected FormatAST error %v, got: %v", expectedErr, err)
+			}
+			if !reflect.DeepEqual(result, expected) {
+				t.Errorf("Expected %+v, got %+v", expected, result)
+			}
+		})
+	}
+}
+
+func TestLuceneMongoASTJSONSchema(t *testing.T) {
+	ast, err := lucene.New().Parse(`COUNT WHERE role:admin AND NOT ("john doe" OR name:j*) | limit:5`)
+	if err != nil {
+		t.Fatalf("Parse should not return error, got: %v", err)
+	}
+	data, err := json.Marshal(ast)
+	if err != nil {
+		t.Fatalf("Marshal should not return error, got: %v", err)
+	}
+
+	expected := `{"version":1,"intent":{"count":true,"where":true},"expression":{"type":"and","children":[` +
+		`{"type":"field","field":"role","value":{"kind":"terms","terms":["admin"]}},` +
+		`{"type":"not","child":{"type":"group","child":{"type":"or","children":[` +
+		`{"type":"text","quoted":{"kind":"string","text":"john doe"}},` +
+		`{"type":"field","field":"name","value":{"kind":"terms","terms":["j*"]}}]}}}]},` +
+		`"directives":[{"name":"limit","value":"5"}]}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+}
+
+func TestLuceneMongoASTJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"Malformed", `{"version":1,`},
+		{"UnknownVersion", `{"version":2}`},
+		{"UnknownNodeType", `{"version":1,"expression":{"type":"xor"}}`},
+		{"UnknownValueKind", `{"version":1,"expression":{"type":"field","field":"a","value":{"kind":"blob"}}}`},
+		{"MissingValue", `{"version":1,"expression":{"type":"field","field":"a"}}`},
+		{"MissingChild", `{"version":1,"expression":{"type":"not"}}`},
+		{"SingleChild", `{"version":1,"expression":{"type":"or","children":[{"type":"text","terms":["a"]}]}}`},
+		{"UngroupedOr", `{"version":1,"expression":{"type":"and","children":[{"type":"text","terms":["a"]},` +
+			`{"type":"or","children":[{"type":"text","terms":["b"]},{"type":"text","terms":["c"]}]}]}}`},
+		{"InvalidIntent", `{"version":1,"intent":{"where":true}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded lucene.ParticipleQuery
+			if err := json.Unmarshal([]byte(tt.data), &decoded); err == nil {
+				t.Errorf("Expected error for %s", tt.data)
+			}
+		})
+	}
+
+	deep := `{"type":"text","terms":["a"]}`
+	for i := 0; i <= lucene.MaxNestingDepth; i++ {
+		deep = `{"type":"not","child":` + deep + `}`
+	}
+	var decoded lucene.ParticipleQuery
+	if err := json.Unmarshal([]byte(`{"version":1,"expression":`+deep+`}`), &decoded); !errors.Is(err, lucene.ErrNestingDepth) {
+		t.Errorf("Expected ErrNestingDepth, got: %v", err)
+	}
+}
+
+func TestLuceneMongoASTProto(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+	for _, query := range astEncodingQueries {
+		t.Run(query, func(t *testing.T) {
+			ast, err := lucene.New().Parse(query)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+			data, err := ast.(*lucene.ParticipleQuery).MarshalProto()
+			if err != nil {
+				t.Fatalf("MarshalProto should not return error, got: %v", err)
+			}
+
+			var decoded lucene.ParticipleQuery
+			if err := decoded.UnmarshalProto(data); err != nil {
+				t.Fatalf("UnmarshalProto should not return error, got: %v", err)
+			}
+			if got, want := lucene.Unparse(&decoded), lucene.Unparse(ast.(*lucene.ParticipleQuery)); got != want {
+				t.Errorf("Expected round trip to give %q, got %q", want, got)
+			}
+
+			expected, expectedErr := parser.ParseDetailed(query)
+			result, err := parser.FormatAST(&decoded)
+			if fmt.Sprint(err) != fmt.Sprint(expectedErr) {
+				t.Fatalf("Expected FormatAST error %v, got: %v", expectedErr, err)
+			}
+			if !reflect.DeepEqual(result, expected) {
+				t.Errorf("Expected %+v, got %+v", expected, result)
+			}
+		})
+	}
+}
+
+func TestLuceneMongoASTProtoWireFormat(t *testing.T) {
+	// Query{version: 1, expression: Node{type: TYPE_FIELD, field: "a", value: Value{kind: KIND_TERMS, terms: ["b"]}}}
+	encoded := []byte{0x08, 0x01, 0x1a, 0x0c, 0x08, 0x05, 0x22, 0x01, 'a', 0x2a, 0x05, 0x08, 0x01, 0x1a, 0x01, 'b'}
+
+	ast, err := lucene.New().Parse("a:b")
+	if err != nil {
+		t.Fatalf("Parse should not return error, got: %v", err)
+	}
+	data, err := ast.(*lucene.ParticipleQuery).MarshalProto()
+	if err != nil {
+		t.Fatalf("MarshalProto should not return error, got: %v", err)
+	}
+	if !bytes.Equal(data, encoded) {
+		t.Errorf("Expected % x, got % x", encoded, data)
+	}
+
+	// An unknown field 15 (a string) from a newer schema is skipped
+	var decoded lucene.ParticipleQuery
+	if err := decoded.UnmarshalProto(append(encoded, 0x7a, 0x01, 'x')); err != nil {
+		t.Fatalf("UnmarshalProto should not return error, got: %v", err)
+	}
+	if got := lucene.Unparse(&decoded); got != "a:b" {
+		t.Errorf("Expected a:b, got %q", got)
+	}
+
+	invalid := []struct {
+		name string
+		data []byte
+	}{
+		{"Truncated", encoded[:len(encoded)-1]},
+		{"UnknownVersion", []byte{0x08, 0x02}},
+		{"WrongWireType", []byte{0x08, 0x01, 0x18, 0x01}},
+		{"UnspecifiedNodeType", []byte{0x08, 0x01, 0x1a, 0x00}},
+		{"UnknownValueKind", []byte{0x08, 0x01, 0x1a, 0x09, 0x08, 0x05, 0x22, 0x01, 'a', 0x2a, 0x02, 0x08, 0x09}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			var decoded lucene.ParticipleQuery
+			if err := decoded.UnmarshalProto(tt.data); err == nil {
+				t.Errorf("Expected error for % x", tt.data)
+			}
+		})
+	}
+
+	// Node{type: TYPE_TEXT, terms: ["a"]} inside more NOT nodes than MaxNestingDepth allows
+	node := []byte{0x08, 0x06, 0x3a, 0x01, 'a'}
+	for i := 0; i <= lucene.MaxNestingDepth; i++ {
+		wrapped := protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 3)
+		wrapped = protowire.AppendTag(wrapped, 3, protowire.BytesType)
+		node = protowire.AppendBytes(wrapped, node)
+	}
+	tooDeep := protowire.AppendBytes([]byte{0x08, 0x01, 0x1a}, node)
+	if err := decoded.UnmarshalProto(tooDeep); !errors.Is(err, lucene.ErrNestingDepth) {
+		t.Errorf("Expected ErrNestingDepth, got: %v", err)
+	}
+}
+
+func TestLuceneMongoBuilder(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	moment := time.Date(2024, 1, 2, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		clause *bsonic.Clause
+		query  string
+	}{
+		{"AndEq", bsonic.Field("age").Gte(18).And(bsonic.Field("role").Eq("admin")), `age:>=18 AND role:"admin"`},
+		{"LiteralString", bsonic.Field("code").Eq("A*"), `code:"A*"`},
+		{"Types", bsonic.Field("n").Eq(-5).And(bsonic.Field("f").Eq(2.5), bsonic.Field("b").Eq(true)), "n:-5 AND f:2.5 AND b:true"},
+		{"In", bsonic.Field("status").In("active", "pending"), `status:"active" OR status:"pending"`},
+		{"DateComparison", bsonic.Field("created_at").Lt(day), "created_at:<2024-01-02"},
+		{"TimeEq", bsonic.Field("created_at").Eq(moment), "created_at:2024-01-02T10:30:00Z"},
+		{"TimeGte", bsonic.Field("created_at").Gte(moment), "created_at:[2024-01-02T10:30:00Z TO *]"},
+		{"Between", bsonic.Field("age").Between(18, 65), "age:[18 TO 65]"},
+		{"OpenBetween", bsonic.Field("age").Between(nil, 65), "age:[* TO 65]"},
+		{"Wildcard", bsonic.Field("name").Wildcard("jo*n"), "name:jo*n"},
+		{"Regex", bsonic.Field("path").Regex("/api/v[0-9]+"), `path:/\/api\/v[0-9]+/`},
+		{"NotGroup", bsonic.Not(bsonic.Field("a").Eq(1).Or(bsonic.Field("b").Eq(2))), "NOT (a:1 OR b:2)"},
+		{"OrPrecedence", bsonic.Field("a").Eq(1).And(bsonic.Field("b").Eq(2)).Or(bsonic.Field("c").Eq(3)), "a:1 AND b:2 OR c:3"},
+		{"AndGroupsOr", bsonic.Field("a").Eq(1).Or(bsonic.Field("b").Eq(2)).And(bsonic.Field("c").Eq(3)), "(a:1 OR b:2) AND c:3"},
+		{"MixedWithRaw", bsonic.Raw("name:john OR title:engineer").And(bsonic.Field("tenant").Eq("acme")), `(name:john OR title:engineer) AND tenant:"acme"`},
+		{"Text", bsonic.Text("john doe").And(bsonic.Field("active").Eq(true)), `"john doe" AND active:true`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.clause.String(); got != tt.query {
+				t.Errorf("Expected query string %q, got %q", tt.query, got)
+			}
+			expected, err := parser.ParseDetailed(tt.query)
+			if err != nil {
+				t.Fatalf("ParseDetailed should not return error, got: %v", err)
+			}
+			result, err := parser.Build(tt.clause)
+			if err != nil {
+				t.Fatalf("Build should not return error, got: %v", err)
+			}
+			if !reflect.DeepEqual(result, expected) {
+				t.Errorf("Expected %+v, got %+v", expected, result)
+			}
+		})
+	}
+
+	// Exclusive comparisons on times with a time of day have no query string form
+	result, err := parser.Build(bsonic.Field("created_at").Gt(moment))
+	if err != nil {
+		t.Fatalf("Build should not return error, got: %v", err)
+	}
+	if expected := (bson.M{"created_at": bson.M{"$gt": moment}}); !reflect.DeepEqual(result.Filter, expected) {
+		t.Errorf("Expected %v, got %v", expected, result.Filter)
+	}
+
+	invalid := []struct {
+		name   string
+		clause *bsonic.Clause
+		kind   error
+	}{
+		{"UnsupportedType", bsonic.Field("timeout").Eq(time.Second), bsonic.ErrUnsupported},
+		{"InvalidFieldName", bsonic.Field("first\nname").Eq("john"), bsonic.ErrSyntax},
+		{"InvalidWildcard", bsonic.Field("name").Wildcard("jo n*"), bsonic.ErrSyntax},
+		{"InvalidRegex", bsonic.Field("name").Regex("jo(n"), bsonic.ErrSyntax},
+		{"InvalidRaw", bsonic.Field("a").Eq(1).And(bsonic.Raw("name:")), bsonic.ErrSyntax},
+		{"RawDirectives", bsonic.Raw("name:john | limit:10"), bsonic.ErrUnsupported},
+		{"EmptyIn", bsonic.Field("status").In(), bsonic.ErrSyntax},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.clause.Err() == nil {
+				t.Fatal("Expected clause to be invalid")
+			}
+			if _, err := parser.Build(tt.clause); !errors.Is(err, tt.kind) {
+				t.Errorf("Expected %v, got: %v", tt.kind, err)
+			}
+		})
+	}
+}
+
+func TestLuceneMongoEscape(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	values := []string{
+		"admin", "admin OR role:*", `x" OR role:"y`, "*", "jo*n", "[1 TO 5]", ">=18", "/.*/", "42", "true",
+		"2024-01-01", `C:\temp\`, "it's", "line\nbreak", "café", "NOT", "(", "| limit:1",
+		"“ OR role:admin OR “", "‘ OR role:admin OR ’", "a：b", "a\u00a0b", "（x）",
+	}
+	for _, value := range values {
+		t.Run("Value "+value, func(t *testing.T) {
+			query := "role:" + bsonic.EscapeValue(value)
+			result, err := parser.Parse(query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", query, err)
+			}
+			if expected := (bson.M{"role": value}); !reflect.DeepEqual(result, expected) {
+				t.Errorf("Parse(%q): expected %v, got %v", query, expected, result)
+			}
+		})
+	}
+
+	t.Run("PunctuationEscapes", func(t *testing.T) {
+		if escaped := bsonic.EscapeValue("“x”"); escaped != `"\u201cx\u201d"` {
+			t.Errorf("expected curly quotes to be written as \\u escapes, got %s", escaped)
+		}
+		query := "name:x" + bsonic.EscapeValue("“ OR role:admin OR “")
+		result, err := parser.Parse(query)
+		if err != nil {
+			t.Fatalf("Parse(%q) should not return error, got: %v", query, err)
+		}
+		if _, ok := result["role"]; ok {
+			t.Errorf("Parse(%q): expected no role condition, got %v", query, result)
+		}
+	})
+
+	fields := []string{
+		"status", "first name", "a:b", "AND", "ANDROID", "NOTE", "COUNT", "-x", "+x", "(x)", "[x]", `"q"`, "'q'",
+		`a\b`, "|x", "/x/", "~lang:fr", "12:30:00", "2024-01-01T10:00:00Z", "x OR y", "tab\there",
+	}
+	for _, field := range fields {
+		t.Run("Field "+field, func(t *testing.T) {
+			query := bsonic.EscapeField(field) + ":active"
+			result, err := parser.Parse(query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", query, err)
+			}
+			if expected := (bson.M{field: "active"}); !reflect.DeepEqual(result, expected) {
+				t.Errorf("Parse(%q): expected %v, got %v", query, expected, result)
+			}
+		})
+	}
+
+	// Escaped field names round trip through the builder's query string form
+	clause := bsonic.Field("first name").Eq("john")
+	if got := clause.String(); got != `first\ name:"john"` {
+		t.Errorf(`Expected first\ name:"john", got %q`, got)
+	}
+}
+
+func TestLuceneMongoConfigProvider(t *testing.T) {
+	var mu sync.Mutex
+	cfg := bsonic_config.Default().WithDefaultFields([]string{"name"}).WithAllowedFields([]string{"name"})
+	provider := bsonic_config.ProviderFunc(func() *bsonic_config.Config {
+		mu.Lock()
+		defer mu.Unlock()
+		return cfg
+	})
+
+	parser, err := bsonic.NewWithProvider(provider)
+	if err != nil {
+		t.Fatalf("NewWithProvider should not return error, got: %v", err)
+	}
+	if _, err := parser.Parse("email:john@example.com"); !errors.Is(err, bsonic.ErrDisallowedField) {
+		t.Fatalf("Expected ErrDisallowedField before the update, got: %v", err)
+	}
+
+	mu.Lock()
+	cfg = bsonic_config.Default().WithDefaultFields([]string{"name"}).WithAllowedFields([]string{"name", "email"})
+	mu.Unlock()
+	result, err := parser.Parse("email:john@example.com")
+	if err != nil {
+		t.Fatalf("Expected the updated allowlist to be used, got: %v", err)
+	}
+	if expected := (bson.M{"email": "john@example.com"}); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+
+	mu.Lock()
+	cfg = bsonic_config.Default().WithOutputVersion(9)
+	mu.Unlock()
+	if _, err := parser.Parse("name:john"); !errors.Is(err, bsonic.ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for an invalid provided config, got: %v", err)
+	}
+}
+
+func TestLuceneMongoRouting(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	tests := []struct {
+		name       string
+		query      string
+		collection string
+		intent     bsonic.Intent
+		filter     bson.M
+	}{
+		{"In", "in:orders status:pending", "orders", bsonic.IntentFind, bson.M{"status": "pending"}},
+		{"Collection", "collection:orders status:pending", "orders", bsonic.IntentFind, bson.M{"status": "pending"}},
+		{"Index", "index:orders status:pending", "orders", bsonic.IntentFind, bson.M{"status": "pending"}},
+		{"LeadingWhitespace", "  in:orders status:pending", "orders", bsonic.IntentFind, bson.M{"status": "pending"}},
+		{"FreeText", "in:customers john", "customers", bsonic.IntentFind, bson.M{"name": bson.M{"$regex": "^john$", "$options": "i"}}},
+		{"PrefixOperator", "in:orders -status:cancelled", "orders", bsonic.IntentFind, bson.M{"status": bson.M{"$ne": "cancelled"}}},
+		{"Group", "in:orders (status:pending OR status:paid)", "orders", bsonic.IntentFind, bson.M{"status": bson.M{"$in": []interface{}{"pending", "paid"}}}},
+		{"Intent", "in:orders COUNT WHERE status:pending", "orders", bsonic.IntentCount, bson.M{"status": "pending"}},
+		{"Escaped", `in:sales\:orders status:pending`, "sales:orders", bsonic.IntentFind, bson.M{"status": "pending"}},
+		{"AloneIsField", "in:orders", "", bsonic.IntentFind, bson.M{"in": "orders"}},
+		{"OperatorIsField", "in:orders AND status:pending", "", bsonic.IntentFind, bson.M{"in": "orders", "status": "pending"}},
+		{"DirectiveIsField", "in:orders | limit:5", "", bsonic.IntentFind, bson.M{"in": "orders"}},
+		{"NotFirst", "status:pending AND in:orders", "", bsonic.IntentFind, bson.M{"status": "pending", "in": "orders"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.ParseDetailed(tt.query)
+			if err != nil {
+				t.Fatalf("ParseDetailed(%q) should not return error, got: %v", tt.query, err)
+			}
+			if result.Collection != tt.collection {
+				t.Errorf("Expected collection %q, got %q", tt.collection, result.Collection)
+			}
+			if result.Intent != tt.intent {
+				t.Errorf("Expected intent %q, got %q", tt.intent, result.Intent)
+			}
+			if !reflect.DeepEqual(result.Filter, tt.filter) {
+				t.Errorf("Expected filter %v, got %v", tt.filter, result.Filter)
+			}
+		})
+	}
+
+	t.Run("Unparse", func(t *testing.T) {
+		ast, err := lucene.New().Parse(`collection:sales\:orders status:pending | limit:5`)
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		if got, expected := lucene.Unparse(ast.(*lucene.ParticipleQuery)), `in:sales\:orders status:pending | limit:5`; got != expected {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("Combine", func(t *testing.T) {
+		if _, err := parser.And("in:orders status:pending", "total:>5"); !errors.Is(err, bsonic.ErrUnsupported) {
+			t.Errorf("Expected ErrUnsupported when combining a routed query, got %v", err)
+		}
+	})
+
+	t.Run("Diff", func(t *testing.T) {
+		changes, err := bsonic.Diff("in:orders status:pending", "in:invoices status:pending")
+		if err != nil {
+			t.Fatalf("Diff should not return error, got: %v", err)
+		}
+		expected := []bsonic.Change{{Kind: bsonic.ChangeModified, Target: bsonic.TargetRoute, Before: "in:orders", After: "in:invoices"}}
+		if !reflect.DeepEqual(changes, expected) {
+			t.Errorf("Expected %v, got %v", expected, changes)
+		}
+	})
+
+	t.Run("DecodeNeedsClause", func(t *testing.T) {
+		var q lucene.ParticipleQuery
+		if err := q.UnmarshalJSON([]byte(`{"version":1,"collection":"orders"}`)); err == nil {
+			t.Error("Expected an error for a collection without an intent or expression")
+		}
+	})
+}
+
+func TestLuceneMongoTextIndexSelector(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	indexes := map[string][]advisor.Index{
+		"articles": {{Name: "_id_", Keys: bson.D{{Key: "_id", Value: 1}}}, {Name: "body_text", Keys: bson.D{{Key: "title", Value: "text"}, {Key: "body", Value: "text"}}}},
+		"users":    {{Name: "_id_", Keys: bson.D{{Key: "_id", Value: 1}}}},
+	}
+	lister := func(_ context.Context, collection string) ([]advisor.Index, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[collection]++
+		if collection == "broken" {
+			return nil, errors.New("not authorized")
+		}
+		return indexes[collection], nil
+	}
+
+	cfg := bsonic_config.Default().WithDefaultFields([]string{"name", "email"})
+	selector, err := bsonic.NewTextIndexSelector(cfg, lister)
+	if err != nil {
+		t.Fatalf("NewTextIndexSelector should not return error, got: %v", err)
+	}
+	if cfg.TextSearchStrategy != bsonic_config.StrategyRegexFields {
+		t.Error("Expected the caller's config to be left unchanged")
+	}
+	ctx := context.Background()
+
+	t.Run("TextIndex", func(t *testing.T) {
+		result, err := selector.ParseDetailed(ctx, "articles", "mongodb AND status:published")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		expected := bson.M{"$and": []bson.M{{"$text": bson.M{"$search": "mongodb"}}, {"status": "published"}}}
+		if !reflect.DeepEqual(result.Filter, expected) {
+			t.Errorf("Expected %v, got %v", expected, result.Filter)
+		}
+	})
+
+	t.Run("RegexFallback", func(t *testing.T) {
+		result, err := selector.ParseDetailed(ctx, "users", "john")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		expected := bson.M{"$or": []bson.M{
+			{"name": bson.M{"$regex": "^john$", "$options": "i"}},
+			{"email": bson.M{"$regex": "^john$", "$options": "i"}},
+		}}
+		if !reflect.DeepEqual(result.Filter, expected) {
+			t.Errorf("Expected %v, got %v", expected, result.Filter)
+		}
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			if ok, err := selector.HasTextIndex(ctx, "articles"); err != nil || !ok {
+				t.Fatalf("Expected articles to have a text index, got %v, %v", ok, err)
+			}
+		}
+		if calls["articles"] != 1 {
+			t.Errorf("Expected the index list to be cached, listed %d times", calls["articles"])
+		}
+
+		selector.Invalidate("articles")
+		indexes["articles"] = indexes["users"]
+		if ok, _ := selector.HasTextIndex(ctx, "articles"); ok || calls["articles"] != 2 {
+			t.Errorf("Expected Invalidate to list the indexes again, got %v after %d listings", ok, calls["articles"])
+		}
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		expiring, err := bsonic.NewTextIndexSelector(cfg, lister, bsonic.WithIndexCacheTTL(time.Nanosecond))
+		if err != nil {
+			t.Fatalf("NewTextIndexSelector should not return error, got: %v", err)
+		}
+		before := calls["users"]
+		_, _ = expiring.HasTextIndex(ctx, "users")
+		time.Sleep(time.Millisecond)
+		_, _ = expiring.HasTextIndex(ctx, "users")
+		if calls["users"] != before+2 {
+			t.Errorf("Expected an expired entry to be listed again, listed %d times", calls["users"]-before)
+		}
+	})
+
+	t.Run("ListError", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if _, err := selector.ParseDetailed(ctx, "broken", "john"); err == nil {
+				t.Error("Expected the listing error to be returned")
+			}
+		}
+		if calls["broken"] != 2 {
+			t.Errorf("Expected listing errors not to be cached, listed %d times", calls["broken"])
+		}
+	})
+
+	t.Run("NeedsDefaultFields", func(t *testing.T) {
+		if _, err := bsonic.NewTextIndexSelector(bsonic_config.Default(), lister); !errors.Is(err, bsonic.ErrUnsupported) {
+			t.Errorf("Expected ErrUnsupported without default fields, got %v", err)
+		}
+	})
+}
+
+func TestLuceneMongoTextScore(t *testing.T) {
+	cfg := bsonic_config.Default().
+		WithTextSearchStrategy(bsonic_config.StrategyTextIndex).
+		WithTextScore(true)
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+	meta := bson.M{"$meta": "textScore"}
+
+	t.Run("Fragments", func(t *testing.T) {
+		result, err := parser.ParseDetailed("mongodb AND status:published | sort:-created_at")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if expected := (bson.M{"score": meta}); !reflect.DeepEqual(result.TextScoreProjection, expected) {
+			t.Errorf("Expected projection %v, got %v", expected, result.TextScoreProjection)
+		}
+		if expected := (bson.D{{Key: "score", Value: meta}}); !reflect.DeepEqual(result.TextScoreSort, expected) {
+			t.Errorf("Expected sort %v, got %v", expected, result.TextScoreSort)
+		}
+		if expected := (bson.D{{Key: "created_at", Value: -1}}); !reflect.DeepEqual(result.Sort, expected) {
+			t.Errorf("Expected the sort directive to be left unchanged, got %v", result.Sort)
+		}
+	})
+
+	t.Run("Pipeline", func(t *testing.T) {
+		result, err := parser.ParseDetailed("mongodb | sort:-created_at | fields:title | limit:5")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		expected := []bson.M{
+			{"$match": bson.M{"$text": bson.M{"$search": "mongodb"}}},
+			{"$addFields": bson.M{"score": meta}},
+			{"$sort": bson.D{{Key: "score", Value: meta}, {Key: "created_at", Value: -1}}},
+			{"$project": bson.M{"title": 1, "score": 1}},
+			{"$limit": int64(5)},
+		}
+		if pipeline := result.Pipeline(); !reflect.DeepEqual(pipeline, expected) {
+			t.Errorf("Expected %v, got %v", expected, pipeline)
+		}
+	})
+
+	t.Run("NoTextSearch", func(t *testing.T) {
+		result, err := parser.ParseDetailed("status:published")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if result.TextScoreProjection != nil || result.TextScoreSort != nil {
+			t.Errorf("Expected no text score fragments, got %v and %v", result.TextScoreProjection, result.TextScoreSort)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(cfg.WithTextScore(false))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		result, err := parser.ParseDetailed("mongodb")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if result.TextScoreProjection != nil || result.TextScoreSort != nil {
+			t.Errorf("Expected no text score fragments, got %v and %v", result.TextScoreProjection, result.TextScoreSort)
+		}
+	})
+
+	t.Run("LegacyTextCompat", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithLegacyTextCompat(true).WithTextScore(true))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		result, err := parser.ParseDetailed("name:John Doe")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if result.TextScoreSort == nil {
+			t.Error("Expected text score fragments for a nested $text search")
+		}
+	})
+}
+
+func TestLuceneMongoTimeBuckets(t *testing.T) {
+	cfg := bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithTimeBuckets(map[string]bsonic_config.TimeBucket{
+			"ts":          {},
+			"data.time":   {Min: "bucket.start", Max: "bucket.end"},
+			"unused_time": {},
+		})
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+	jan := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"Equality", "ts:2024-01-01", bson.M{
+			"ts":             jan,
+			"control.min.ts": bson.M{"$lte": jan},
+			"control.max.ts": bson.M{"$gte": jan},
+		}},
+		{"Range", "ts:[2024-01-01 TO 2024-02-01]", bson.M{
+			"ts":             bson.M{"$gte": jan, "$lte": feb},
+			"control.min.ts": bson.M{"$lte": feb},
+			"control.max.ts": bson.M{"$gte": jan},
+		}},
+		{"Exclusive", "ts:>2024-01-01 AND ts:<2024-02-01", bson.M{
+			"ts":             bson.M{"$gt": jan, "$lt": feb},
+			"control.min.ts": bson.M{"$lt": feb},
+			"control.max.ts": bson.M{"$gt": jan},
+		}},
+		{"CustomFields", "data.time:>=2024-01-01 AND sensor:a1", bson.M{
+			"data.time":  bson.M{"$gte": jan},
+			"bucket.end": bson.M{"$gte": jan},
+			"sensor":     "a1",
+		}},
+		{"OrBranches", "ts:>2024-02-01 OR ts:<2024-01-01", bson.M{"$or": []bson.M{
+			{"ts": bson.M{"$gt": feb}, "control.max.ts": bson.M{"$gt": feb}},
+			{"ts": bson.M{"$lt": jan}, "control.min.ts": bson.M{"$lt": jan}},
+		}}},
+		{"NegationUnchanged", "NOT ts:>2024-01-01", bson.M{"ts": bson.M{"$not": bson.M{"$gt": jan}}}},
+		{"OtherFieldsUnchanged", "created:>2024-01-01", bson.M{"created": bson.M{"$gt": jan}}},
+		{"NonTimeValueUnchanged", "ts:pending", bson.M{"ts": "pending"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("AllowedFields", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(cfg.WithAllowedFields([]string{"ts", "name"}))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := parser.Parse("ts:>2024-01-01"); err != nil {
+			t.Errorf("Expected the added bucket fields not to need allowing, got: %v", err)
+		}
+	})
+}
+
+func TestLuceneMongoPolicy(t *testing.T) {
+	strict, err := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithPolicy(bsonic_config.PolicyStrictAPI))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	t.Run("Allowed", func(t *testing.T) {
+		result, err := strict.ParseDetailed(`status:active AND name:"john" | limit:50`)
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if result.Limit != 50 {
+			t.Errorf("Expected limit 50, got %d", result.Limit)
+		}
+	})
+
+	rejected := []struct {
+		name  string
+		query string
+		kind  error
+	}{
+		{"QueryLength", "status:" + strings.Repeat("a", 600), bsonic.ErrLimitExceeded},
+		{"Clauses", strings.Repeat("a:1 AND ", 16) + "a:1", bsonic.ErrLimitExceeded},
+		{"Limit", "status:active | limit:500", bsonic.ErrLimitExceeded},
+		{"Wildcard", "name:jo*", bsonic.ErrUnsupported},
+		{"RegexFreeText", "john", bsonic.ErrUnsupported},
+		{"Regex", "email:/.*@example\\.com/", bsonic.ErrUnsupported},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := strict.Parse(tt.query)
+			if !errors.Is(err, tt.kind) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.kind, err)
+			}
+		})
+	}
+
+	t.Run("Internal", func(t *testing.T) {
+		internal, err := bsonic.NewWithConfig(bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithPolicy(bsonic_config.PolicyInternal))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		for _, tt := range rejected {
+			if _, err := internal.Parse(tt.query); err != nil {
+				t.Errorf("Parse(%q) should not return error with the internal policy, got: %v", tt.query, err)
+			}
+		}
+	})
+
+	t.Run("Analyst", func(t *testing.T) {
+		analyst, err := bsonic.NewWithConfig(bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithPolicy(bsonic_config.PolicyAnalyst))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		result, err := analyst.ParseDetailed("status:active AND name:(")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error with lenient errors, got: %v", err)
+		}
+		if len(result.Warnings) != 1 {
+			t.Errorf("Expected the broken clause to be dropped with a warning, got %v", result.Warnings)
+		}
+	})
+}
+
+func TestLuceneMongoTypeQueries(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	tests := []struct {
+		name   string
+		query  string
+		filter bson.M
+	}{
+		{"String", "name:TYPE(string)", bson.M{"name": bson.M{"$type": "string"}}},
+		{"ObjectID", "id:TYPE(objectId)", bson.M{"_id": bson.M{"$type": "objectId"}}},
+		{"CaseInsensitive", "ref:TYPE(OBJECTID)", bson.M{"ref": bson.M{"$type": "objectId"}}},
+		{"Number", "age:TYPE(16)", bson.M{"age": bson.M{"$type": int32(16)}}},
+		{"Multiple", "age:TYPE( int , long )", bson.M{"age": bson.M{"$type": bson.A{"int", "long"}}}},
+		{"Not", "NOT name:TYPE(string)", bson.M{"name": bson.M{"$not": bson.M{"$type": "string"}}}},
+		{"And", "deleted_at:TYPE(null) AND status:active", bson.M{"deleted_at": bson.M{"$type": "null"}, "status": "active"}},
+		{"PlainValue", "kind:TYPE", bson.M{"kind": "TYPE"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(result, tt.filter) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.filter, result)
+			}
+		})
+	}
+
+	t.Run("UnknownType", func(t *testing.T) {
+		for _, query := range []string{"age:TYPE(integer)", "age:TYPE(42)"} {
+			if _, err := parser.Parse(query); !errors.Is(err, bsonic.ErrSyntax) {
+				t.Errorf("Parse(%q): expected %v, got %v", query, bsonic.ErrSyntax, err)
+			}
+		}
+	})
+
+	t.Run("Unparse", func(t *testing.T) {
+		ast, err := lucene.New().Parse("age:TYPE( int ,long)")
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		if got := lucene.Unparse(ast.(*lucene.ParticipleQuery)); got != "age:TYPE(int, long)" {
+			t.Errorf("Expected %q, got %q", "age:TYPE(int, long)", got)
+		}
+	})
+}
+
+func TestLuceneMongoOperatorAudit(t *testing.T) {
+	t.Run("OperatorFieldNames", func(t *testing.T) {
+		parser := createParserWithDefaults([]string{"name"})
+		for _, query := range []string{
+			"$where:sleep(1000)",
+			`\$where:sleep(1000)`,
+			"name:john OR $function:x",
+			"profile.$where:1",
+			"NOT $where:x",
+			"status:active | sort:$where",
+			"status:active | fields:-$function",
+			"DISTINCT $where WHERE status:active",
+		} {
+			_, err := parser.Parse(query)
+			if !errors.Is(err, bsonic.ErrSyntax) {
+				t.Errorf("Parse(%q): expected %v, got %v", query, bsonic.ErrSyntax, err)
+			}
+		}
+	})
+
+	t.Run("OperatorValues", func(t *testing.T) {
+		parser := createParserWithDefaults([]string{"name"})
+		result, err := parser.Parse(`note:$where`)
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		if !reflect.DeepEqual(result, bson.M{"note": "$where"}) {
+			t.Errorf("Expected the value to stay a string, got %v", result)
+		}
+	})
+
+	configs := map[string]*bsonic_config.Config{
+		"Regex":         bsonic_config.Default().WithDefaultFields([]string{"name"}),
+		"Weighted":      bsonic_config.Default().WithWeightedDefaultFields(bsonic_config.Weighted{"title": 3, "body": 1}),
+		"TextIndex":     bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyTextIndex).WithTextScore(true),
+		"AtlasSearch":   bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch),
+		"AccentFolding": bsonic_config.Default().WithDefaultFields([]string{"name"}).WithAccentInsensitive(true),
+		"ForeignRefs": bsonic_config.Default().WithDefaultFields([]string{"name"}).
+			WithForeignRefs(map[string]bsonic_config.ForeignRef{"author": {From: "users", LocalField: "author_id"}}),
+		"TimeBuckets": bsonic_config.Default().WithDefaultFields([]string{"name"}).
+			WithTimeBuckets(map[string]bsonic_config.TimeBucket{"ts": {}}),
+	}
+	queries := []string{
+		`john AND status:active`,
+		`"john doe" OR name:jo* OR email:/.*@example\.com/`,
+		`NOT (age:[18 TO 65] OR age:>=90) AND -status:deleted`,
+		`ref:TYPE(objectId) AND tags:go | sort:-age | fields:name,age | limit:10`,
+		`author.name:john AND ts:[2024-01-01 TO 2024-02-01]`,
+		`COUNT WHERE status:active`,
+	}
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			parser, err := bsonic.NewWithConfig(cfg.WithOperatorAudit(true))
+			if err != nil {
+				t.Fatalf("NewWithConfig should not return error, got: %v", err)
+			}
+			for _, query := range queries {
+				result, err := parser.ParseDetailed(query)
+				if errors.Is(err, bsonic.ErrUnsupported) && !strings.Contains(err.Error(), "operator audit") {
+					// Atlas Search cannot express every query, which has nothing to do with the audit
+					continue
+				}
+				if err != nil {
+					t.Errorf("ParseDetailed(%q) should pass the operator audit, got: %v", query, err)
+					continue
+				}
+				if operator := findJavaScriptOperator(result); operator != "" {
+					t.Errorf("ParseDetailed(%q) emitted %s", query, operator)
+				}
+			}
+		})
+	}
+
+	t.Run("MQL", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithLanguage(bsonic_config.LanguageMQL).WithOperatorAudit(true))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := parser.Parse(`{"age": {"$gte": 18}, "tags": {"$elemMatch": {"$eq": "go"}}}`); err != nil {
+			t.Errorf("Parse should pass the operator audit, got: %v", err)
+		}
+		if _, err := parser.Parse(`{"$where": "this.age > 18"}`); !errors.Is(err, bsonic.ErrUnsupported) {
+			t.Errorf("Expected %v, got %v", bsonic.ErrUnsupported, err)
+		}
+	})
+
+	t.Run("RejectsUnapprovedOperators", func(t *testing.T) {
+		// A resolver returning documents instead of IDs stands in for a formatter bug
+		resolver := func(context.Context, string, bson.M) ([]interface{}, error) {
+			return []interface{}{bson.M{"$where": "sleep(1000)"}}, nil
+		}
+		cfg := bsonic_config.Default().WithDefaultFields([]string{"name"}).WithSubqueryResolver(resolver)
+
+		unaudited, err := bsonic.NewWithConfig(cfg)
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := unaudited.Parse("owner_id:IN_QUERY(users WHERE role:admin)"); err != nil {
+			t.Fatalf("Parse should not return error without the audit, got: %v", err)
+		}
+
+		audited, err := bsonic.NewWithConfig(cfg.WithOperatorAudit(true))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		_, err = audited.Parse("owner_id:IN_QUERY(users WHERE role:admin)")
+		if !errors.Is(err, bsonic.ErrUnsupported) || !strings.Contains(err.Error(), "$where") {
+			t.Errorf("Expected the audit to reject $where, got %v", err)
+		}
+	})
+}
+
+func TestLuceneMongoPositionalPaths(t *testing.T) {
+	schema := []byte(`{"properties": {
+		"name": {"type": "string"},
+		"items": {"type": "array", "items": {"properties": {
+			"price": {"type": "number"},
+			"sku": {"type": "string"},
+			"tags": {"type": "array", "items": {"type": "string"}}
+		}}}
+	}}`)
+	cfg := bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithJSONSchema(schema).
+		WithEnumField("items.status", "open", "shipped")
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		filter bson.M
+	}{
+		{"Comparison", "items.0.price:>100", bson.M{"items.0.price": bson.M{"$gt": 100.0}}},
+		{"Range", "items.2.price:[10 TO 20]", bson.M{"items.2.price": bson.M{"$gte": 10.0, "$lte": 20.0}}},
+		{"ElementType", "items.0.sku:123", bson.M{"items.0.sku": "123"}},
+		{"NestedArray", "items.1.tags.0:sale", bson.M{"items.1.tags.0": "sale"}},
+		{"WholeElement", "items.0:TYPE(object)", bson.M{"items.0": bson.M{"$type": "object"}}},
+		{"EnumElement", "items.3.status:open", bson.M{"items.3.status": "open"}},
+		{"LeadingZeroIsField", "items.01.sku:123", bson.M{"items.01.sku": 123.0}},
+		{"UndescribedField", "legacy.0:x", bson.M{"legacy.0": "x"}},
+		{"Unpositional", "items.sku:123", bson.M{"items.sku": "123"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(result, tt.filter) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.filter, result)
+			}
+		})
+	}
+
+	t.Run("Sort", func(t *testing.T) {
+		result, err := parser.ParseDetailed("name:john | sort:-items.0.price")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if expected := (bson.D{{Key: "items.0.price", Value: -1}}); !reflect.DeepEqual(result.Sort, expected) {
+			t.Errorf("Expected sort %v, got %v", expected, result.Sort)
+		}
+	})
+
+	t.Run("NotAnArray", func(t *testing.T) {
+		for _, query := range []string{"name.0:john", "items.0.price.1:5", "name:john | sort:name.0", "items.0.sku.2:x"} {
+			_, err := parser.Parse(query)
+			if !errors.Is(err, bsonic.ErrSyntax) || !strings.Contains(err.Error(), "is not an array field") {
+				t.Errorf("Parse(%q): expected a positional path error, got %v", query, err)
+			}
+		}
+	})
+
+	t.Run("EnumValue", func(t *testing.T) {
+		var enumErr *bsonic.EnumError
+		if _, err := parser.Parse("items.0.status:lost"); !errors.As(err, &enumErr) || enumErr.Field != "items.0.status" {
+			t.Errorf("Expected an enum error for items.0.status, got %v", err)
+		}
+	})
+
+	t.Run("AllowedFields", func(t *testing.T) {
+		allowed, err := bsonic.NewWithConfig(bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithAllowedFields([]string{"name", "items.price"}))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := allowed.Parse("items.0.price:>100"); err != nil {
+			t.Errorf("Expected items.0.price to be allowed by items.price, got: %v", err)
+		}
+		if _, err := allowed.Parse("items.0.sku:x"); !errors.Is(err, bsonic.ErrDisallowedField) {
+			t.Errorf("Expected %v, got %v", bsonic.ErrDisallowedField, err)
+		}
+	})
+}
+
+func TestLuceneMongoNestedGroups(t *testing.T) {
+	parser := createParserWithDefaults([]string{"name"})
+
+	tests := []struct {
+		name   string
+		query  string
+		filter bson.M
+	}{
+		{"And", `profile:{location:"SF" AND verified:true}`, bson.M{"profile.location": "SF", "profile.verified": true}},
+		{"Or", "profile:{ location:SF OR location:NYC }", bson.M{"profile.location": bson.M{"$in": []interface{}{"SF", "NYC"}}}},
+		{"Deep", "profile:{address:{city:SF AND zip:\\94107}}", bson.M{"profile.address.city": "SF", "profile.address.zip": "94107"}},
+		{"Group", "profile:{(a:x OR b:y) AND c:z}", bson.M{"$and": []bson.M{
+			{"$or": []bson.M{{"profile.a": "x"}, {"profile.b": "y"}}},
+			{"profile.c": "z"},
+		}}},
+		{"Not", "NOT profile:{verified:true}", bson.M{"profile.verified": bson.M{"$ne": true}}},
+		{"PrefixOperator", "profile:{-verified:true AND status:active}", bson.M{"profile.verified": bson.M{"$ne": true}, "profile.status": "active"}},
+		{"ID", "profile:{id:507f1f77bcf86cd799439011}", bson.M{"profile._id": func() bson.ObjectID {
+			id, _ := bson.ObjectIDFromHex("507f1f77bcf86cd799439011")
+			return id
+		}()}},
+		{"WithOtherClauses", "name:john AND profile:{verified:true}", bson.M{"name": "john", "profile.verified": true}},
+		{"BracesWithoutField", "code:{x}", bson.M{"code": "{x}"}},
+		{"UnclosedBrace", "code:{", bson.M{"code": "{"}},
+		{"BraceInValue", "code:foo{bar}", bson.M{"code": "foo{bar}"}},
+		{"EscapedBrace", `profile:{motto:x\}}`, bson.M{"profile.motto": "x}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(result, tt.filter) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.filter, result)
+			}
+		})
+	}
+
+	t.Run("Highlights", func(t *testing.T) {
+		result, err := parser.ParseDetailed("profile:{city:SF AND NOT state:CA}")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		expected := []bsonic.Highlight{{Field: "profile.city", Term: "SF"}}
+		if !reflect.DeepEqual(result.Highlights, expected) {
+			t.Errorf("Expected highlights %v, got %v", expected, result.Highlights)
+		}
+	})
+
+	t.Run("Unparse", func(t *testing.T) {
+		ast, err := lucene.New().Parse("profile:{ city:SF  AND address:{zip:1} }")
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		if got, want := lucene.Unparse(ast.(*lucene.ParticipleQuery)), "profile:{city:SF AND address:{zip:1}}"; got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	})
+
+	t.Run("FreeText", func(t *testing.T) {
+		_, err := parser.Parse(`profile:{city:SF AND "john"}`)
+		if !errors.Is(err, bsonic.ErrSyntax) || !strings.Contains(err.Error(), "free text cannot be nested") {
+			t.Errorf("Expected a nested free text error, got %v", err)
+		}
+	})
+
+	t.Run("AllowedFields", func(t *testing.T) {
+		allowed, err := bsonic.NewWithConfig(bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithAllowedFields([]string{"name", "profile.city"}))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := allowed.Parse("profile:{city:SF}"); err != nil {
+			t.Errorf("Expected profile.city to be allowed, got: %v", err)
+		}
+		if _, err := allowed.Parse("profile:{city:SF AND secret:x}"); !errors.Is(err, bsonic.ErrDisallowedField) {
+			t.Errorf("Expected %v, got %v", bsonic.ErrDisallowedField, err)
+		}
+	})
+}
+
+func TestLuceneMongoFieldPaths(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithMaxPathDepth(3))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	t.Run("Allowed", func(t *testing.T) {
+		result, err := parser.ParseDetailed("user.profile.city:SF AND profile:{address:{zip:94107}} | sort:a.b.c")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		expected := bson.M{"user.profile.city": "SF", "profile.address.zip": 94107.0}
+		if !reflect.DeepEqual(result.Filter, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, result.Filter)
+		}
+	})
+
+	rejected := []struct {
+		name  string
+		query string
+		kind  error
+		msg   string
+	}{
+		{"DoubleDot", "a..b:1", bsonic.ErrSyntax, "path segments cannot be empty"},
+		{"LeadingDot", ".a:1", bsonic.ErrSyntax, "path segments cannot be empty"},
+		{"TrailingDot", "a.:1", bsonic.ErrSyntax, "path segments cannot be empty"},
+		{"EscapedDot", `a\..b:1`, bsonic.ErrSyntax, "path segments cannot be empty"},
+		{"NestedLeadingDot", "a:{.b:1}", bsonic.ErrSyntax, "path segments cannot be empty"},
+		{"DollarSegment", "a.$b:1", bsonic.ErrSyntax, "cannot start with $"},
+		{"SortDoubleDot", "a:1 | sort:a..b", bsonic.ErrSyntax, "path segments cannot be empty"},
+		{"FieldsLeadingDot", "a:1 | fields:.a", bsonic.ErrSyntax, "path segments cannot be empty"},
+		{"TooDeep", "a.b.c.d:1", bsonic.ErrLimitExceeded, "has 4 segments; the maximum is 3"},
+		{"NestedTooDeep", "a:{b:{c:{d:1}}}", bsonic.ErrLimitExceeded, "has 4 segments"},
+		{"SortTooDeep", "a:1 | sort:a.b.c.d", bsonic.ErrLimitExceeded, "has 4 segments"},
+		{"FieldsTooDeep", "a:1 | fields:a.b.c.d", bsonic.ErrLimitExceeded, "has 4 segments"},
+		{"DistinctTooDeep", "DISTINCT a.b.c.d WHERE a:1", bsonic.ErrLimitExceeded, "has 4 segments"},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parser.ParseDetailed(tt.query)
+			if !errors.Is(err, tt.kind) || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("ParseDetailed(%q): expected %v containing %q, got %v", tt.query, tt.kind, tt.msg, err)
+			}
+		})
+	}
+
+	t.Run("NoMaximum", func(t *testing.T) {
+		if _, err := bsonic.ParseWithDefaults([]string{"name"}, "a.b.c.d.e.f:1"); err != nil {
+			t.Errorf("Expected deep paths without a maximum, got: %v", err)
+		}
+	})
+}
+
+func TestLuceneMongoRegexPolicies(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name", "bio"}).
+		WithMaxRegexClauses(3).
+		WithRejectLeadingWildcards(true))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	allowed := []string{
+		"name:jo* OR name:ja* OR name:ji*",
+		"name:/jo.*/ AND status:active",
+		"name:jo?n",
+		"john",
+	}
+	for _, query := range allowed {
+		if _, err := parser.Parse(query); err != nil {
+			t.Errorf("Parse(%q) should not return error, got: %v", query, err)
+		}
+	}
+
+	rejected := []struct {
+		name  string
+		query string
+		kind  error
+		msg   string
+	}{
+		{"TooManyWildcards", "name:jo* OR name:ja* OR name:ji* OR name:je*", bsonic.ErrLimitExceeded, "query has 4 regex clauses; the maximum is 3"},
+		{"FreeTextPerField", "john OR jane", bsonic.ErrLimitExceeded, "query has 4 regex clauses"},
+		{"LeadingWildcard", "name:*son", bsonic.ErrUnsupported, "starts with a wildcard"},
+		{"ContainsWildcard", "name:*so*", bsonic.ErrUnsupported, "cannot use an index"},
+		{"LeadingRegex", "name:/.*son/", bsonic.ErrUnsupported, "starts with a wildcard"},
+		{"Negated", "status:active AND NOT name:*son", bsonic.ErrUnsupported, "starts with a wildcard"},
+		{"Nested", "profile:{city:*ville}", bsonic.ErrUnsupported, "profile.city"},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parser.Parse(tt.query)
+			if !errors.Is(err, tt.kind) || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Parse(%q): expected %v containing %q, got %v", tt.query, tt.kind, tt.msg, err)
+			}
+		})
+	}
+
+	t.Run("NoPolicy", func(t *testing.T) {
+		if _, err := bsonic.ParseWithDefaults([]string{"name"}, "name:*a OR name:*b OR name:*c OR name:*d"); err != nil {
+			t.Errorf("Expected leading wildcards without a policy, got: %v", err)
+		}
+	})
+}
+
+func TestLuceneMongoURLValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"URL", "url:https://example.com/docs", bson.M{"url": "https://example.com/docs"}},
+		{"Port", "url:http://localhost:8080/health", bson.M{"url": "http://localhost:8080/health"}},
+		{"QueryString", "url:https://example.com/search?q=go", bson.M{"url": "https://example.com/search?q=go"}},
+		{"Escaped", `url:https\://example.com`, bson.M{"url": "https://example.com"}},
+		{"Email", "email:john@example.com", bson.M{"email": "john@example.com"}},
+		{"Nested", "site:{url:https://example.com}", bson.M{"site.url": "https://example.com"}},
+		{"Combined", "url:https://example.com AND status:active", bson.M{"url": "https://example.com", "status": "active"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := bsonic.ParseWithDefaults([]string{"name"}, tt.query)
+			if err != nil {
+				t.Fatalf("ParseWithDefaults(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(query, tt.expected) {
+				t.Errorf("ParseWithDefaults(%q): expected %+v, got %+v", tt.query, tt.expected, query)
+			}
+		})
+	}
+
+	t.Run("FreeText", func(t *testing.T) {
+		query, err := bsonic.ParseWithDefaults([]string{"link"}, "https://example.com")
+		if err != nil {
+			t.Fatalf("ParseWithDefaults should not return error, got: %v", err)
+		}
+		expected := bson.M{"link": bson.M{"$regex": `^https://example\.com$`, "$options": "i"}}
+		if !reflect.DeepEqual(query, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, query)
+		}
+	})
+}
+
+func TestLuceneMongoIPValues(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithFieldTypes(map[string]bsonic_config.FieldType{"ip": bsonic_config.FieldTypeIP}))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+	ip := func(data ...byte) bson.Binary {
+		return bson.Binary{Subtype: bson.TypeBinaryGeneric, Data: data}
+	}
+	ipv6 := func(prefix []byte, fill byte, last byte) bson.Binary {
+		data := bytes.Repeat([]byte{fill}, 16)
+		copy(data, prefix)
+		data[15] = last
+		return ip(data...)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"IPv4", "ip:10.1.2.3", bson.M{"ip": ip(10, 1, 2, 3)}},
+		{"Quoted", `ip:"10.1.2.3"`, bson.M{"ip": ip(10, 1, 2, 3)}},
+		{"IPv6", "ip:2001:db8::1", bson.M{"ip": ipv6([]byte{0x20, 0x01, 0x0d, 0xb8}, 0, 1)}},
+		{"Loopback", "ip:::1", bson.M{"ip": ipv6(nil, 0, 1)}},
+		{"Mapped", "ip:::ffff:10.1.2.3", bson.M{"ip": ip(10, 1, 2, 3)}},
+		{"CIDR", "ip:10.0.0.0/8", bson.M{"ip": bson.M{"$gte": ip(10, 0, 0, 0), "$lte": ip(10, 255, 255, 255)}}},
+		{"UnalignedCIDR", "ip:10.1.2.3/20", bson.M{"ip": bson.M{"$gte": ip(10, 1, 0, 0), "$lte": ip(10, 1, 15, 255)}}},
+		{"IPv6CIDR", "ip:2001:db8::/32", bson.M{"ip": bson.M{
+			"$gte": ipv6([]byte{0x20, 0x01, 0x0d, 0xb8}, 0, 0),
+			"$lte": ipv6([]byte{0x20, 0x01, 0x0d, 0xb8}, 0xff, 0xff),
+		}}},
+		{"MappedCIDR", "ip:::ffff:10.0.0.0/104", bson.M{"ip": bson.M{"$gte": ip(10, 0, 0, 0), "$lte": ip(10, 255, 255, 255)}}},
+		{"UntypedIPv6", "host:fe80::1 AND ip:10.0.0.1", bson.M{"host": "fe80::1", "ip": ip(10, 0, 0, 1)}},
+		{"UntypedCIDR", "net:10.0.0.0/8", bson.M{"net": "10.0.0.0/8"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(query, tt.expected) {
+				t.Errorf("Parse(%q): expected %+v, got %+v", tt.query, tt.expected, query)
+			}
+		})
+	}
+
+	t.Run("Unparse", func(t *testing.T) {
+		ast, err := lucene.New().Parse("host:2001:db8::1 OR net:fe80::/10")
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		query := lucene.Unparse(ast.(*lucene.ParticipleQuery))
+		filter, err := parser.Parse(query)
+		if err != nil {
+			t.Fatalf("Parse(%q) should not return error, got: %v", query, err)
+		}
+		expected := bson.M{"$or": []bson.M{{"host": "2001:db8::1"}, {"net": "fe80::/10"}}}
+		if !reflect.DeepEqual(filter, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, filter)
+		}
+	})
+
+	if _, err := parser.Parse("a:b:c"); err == nil {
+		t.Error("Expected values with colons that are not addresses to fail")
+	}
+}
+
+func TestLuceneMongoIPCIDRRanges(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithFieldTypes(map[string]bsonic_config.FieldType{
+			"src_ip": bsonic_config.FieldTypeIPNumber,
+			"dst_ip": bsonic_config.FieldTypeIPString,
+		}))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected bson.M
+	}{
+		{"NumberAddress", "src_ip:10.0.0.1", bson.M{"src_ip": int64(167772161)}},
+		{"NumberCIDR", "src_ip:10.1.0.0/16", bson.M{"src_ip": bson.M{"$gte": int64(167837696), "$lte": int64(167903231)}}},
+		{"NumberMappedCIDR", "src_ip:::ffff:10.1.0.0/112", bson.M{"src_ip": bson.M{"$gte": int64(167837696), "$lte": int64(167903231)}}},
+		{"NumberIPv6", "src_ip:2001:db8::1", bson.M{"src_ip": "2001:db8::1"}},
+		{"StringAddress", "dst_ip:10.0.0.1", bson.M{"dst_ip": "10.0.0.1"}},
+		{"StringCIDR", "dst_ip:10.1.0.0/16", bson.M{"dst_ip": bson.M{"$regex": `^10\.1\.`}}},
+		{"StringUnalignedCIDR", "dst_ip:10.0.0.0/14", bson.M{"dst_ip": bson.M{"$regex": `^10\.(?:0|1|2|3)\.`}}},
+		{"StringHostCIDR", "dst_ip:10.1.2.3/32", bson.M{"dst_ip": bson.M{"$regex": `^10\.1\.2\.3$`}}},
+		{"StringLastOctetCIDR", "dst_ip:10.1.2.4/30", bson.M{"dst_ip": bson.M{"$regex": `^10\.1\.2\.(?:4|5|6|7)$`}}},
+		{"StringIPv6CIDR", "dst_ip:2001:db8::/32", bson.M{"dst_ip": "2001:db8::/32"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(query, tt.expected) {
+				t.Errorf("Parse(%q): expected %+v, got %+v", tt.query, tt.expected, query)
+			}
+		})
+	}
+}
+
+func TestLuceneMongoValueGroups(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		filter bson.M
+	}{
+		{"Range", "price:(>=10 AND <=20)", bson.M{"price": bson.M{"$gte": 10.0, "$lte": 20.0}}},
+		{"SingleValue", "price:(>10)", bson.M{"price": bson.M{"$gt": 10.0}}},
+		{"Or", "status:(active OR pending)", bson.M{"status": bson.M{"$in": []interface{}{"active", "pending"}}}},
+		{"Not", "status:(NOT closed)", bson.M{"status": bson.M{"$ne": "closed"}}},
+		{"Ranges", "price:([1 TO 5] OR [10 TO 20])", bson.M{"$or": []bson.M{
+			{"price": bson.M{"$gte": 1.0, "$lte": 5.0}},
+			{"price": bson.M{"$gte": 10.0, "$lte": 20.0}},
+		}}},
+		{"NestedParentheses", "price:((>1 AND <3) OR 7)", bson.M{"$or": []bson.M{
+			{"price": bson.M{"$gt": 1.0, "$lt": 3.0}},
+			{"price": 7.0},
+		}}},
+		{"MergedWithClause", "price:(>=10 AND <=20) AND price:<15", bson.M{"price": bson.M{"$gte": 10.0, "$lt": 15.0}}},
+		{"QuotedAndRegex", `name:("John Doe" OR /ja.*/)`, bson.M{"$or": []bson.M{
+			{"name": "John Doe"},
+			{"name": bson.M{"$regex": "^ja.*$"}},
+		}}},
+		{"InNestedGroup", "profile:{age:(>1 AND <5)}", bson.M{"profile.age": bson.M{"$gt": 1.0, "$lt": 5.0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := bsonic.ParseWithDefaults([]string{"name"}, tt.query)
+			if err != nil {
+				t.Fatalf("ParseWithDefaults(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(filter, tt.filter) {
+				t.Errorf("Expected %+v, got %+v", tt.filter, filter)
+			}
+		})
+	}
+
+	t.Run("Unparsed", func(t *testing.T) {
+		if got := bsonic.Raw("price:(>=10 AND <=20)").String(); got != "(price:>=10 AND price:<=20)" {
+			t.Errorf("Expected the group to expand into field clauses, got %s", got)
+		}
+	})
+
+	rejected := []struct {
+		query string
+		msg   string
+	}{
+		{"tags:(a b)", "values in tags:(...) must be joined with AND or OR"},
+		{"price:()", "unexpected token"},
+		{"price:(>10 AND inner:5)", "unexpected token"},
+		{"price:(>=10 AND <=5)", "impossible range on field price"},
+	}
+	for _, tt := range rejected {
+		_, err := bsonic.ParseWithDefaults([]string{"name"}, tt.query)
+		if !errors.Is(err, bsonic.ErrSyntax) || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("ParseWithDefaults(%q): expected a syntax error containing %q, got %v", tt.query, tt.msg, err)
+		}
+	}
+}
+
+func TestLuceneMongoNumberSeparators(t *testing.T) {
+	cfg := bsonic_config.Default().WithDefaultFields([]string{"name"}).WithNumberSeparators(",", ".")
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+	strict, err := bsonic.NewWithConfig(cfg.WithStrictNumbers(true))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		filter bson.M
+	}{
+		{"Grouped", "price:1.234,56", bson.M{"price": 1234.56}},
+		{"Ungrouped", "price:1234,56", bson.M{"price": 1234.56}},
+		{"Negative", "price:-1.234.567,5", bson.M{"price": -1234567.5}},
+		{"DecimalOnly", "price:0,5", bson.M{"price": 0.5}},
+		{"StandardNotation", "price:1.5", bson.M{"price": 1.5}},
+		{"Comparison", "price:>=1.000,5", bson.M{"price": bson.M{"$gte": 1000.5}}},
+		{"QuotedComparison", `price:< "2,5"`, bson.M{"price": bson.M{"$lt": 2.5}}},
+		{"Range", "price:[1,5 TO 2.000,25]", bson.M{"price": bson.M{"$gte": 1.5, "$lte": 2000.25}}},
+		{"NotANumber", "version:1.2.3", bson.M{"version": "1.2.3"}},
+		{"Date", "created:2024-01-02", bson.M{"created": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, p := range []*bsonic.Parser{parser, strict} {
+				filter, err := p.Parse(tt.query)
+				if err != nil {
+					t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+				}
+				if !reflect.DeepEqual(filter, tt.filter) {
+					t.Errorf("Expected %+v, got %+v", tt.filter, filter)
+				}
+			}
+		})
+	}
+
+	ambiguous := []struct {
+		query  string
+		filter bson.M
+		msg    string
+	}{
+		{"price:1.234", bson.M{"price": 1234.0}, "1.234 reads as 1234 with the configured separators and as 1.234 in standard notation; write 1234 or 1,234 instead"},
+		{"price:>1.000", bson.M{"price": bson.M{"$gt": 1000.0}}, "write 1000 or 1 instead"},
+		{"price:[1.000 TO *]", bson.M{"price": bson.M{"$gte": 1000.0}}, "ambiguous number: 1.000"},
+		{"price:(>=1 AND <=1.000)", bson.M{"price": bson.M{"$gte": 1.0, "$lte": 1000.0}}, "ambiguous number: 1.000"},
+	}
+	for _, tt := range ambiguous {
+		filter, err := parser.Parse(tt.query)
+		if err != nil {
+			t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+		}
+		if !reflect.DeepEqual(filter, tt.filter) {
+			t.Errorf("Parse(%q): expected %+v, got %+v", tt.query, tt.filter, filter)
+		}
+		if _, err := strict.Parse(tt.query); !errors.Is(err, bsonic.ErrSyntax) || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("strict Parse(%q): expected a syntax error containing %q, got %v", tt.query, tt.msg, err)
+		}
+	}
+
+	t.Run("StandardByDefault", func(t *testing.T) {
+		filter, err := bsonic.ParseWithDefaults([]string{"name"}, "price:1.234")
+		if err != nil {
+			t.Fatalf("ParseWithDefaults should not return error, got: %v", err)
+		}
+		if expected := (bson.M{"price": 1.234}); !reflect.DeepEqual(filter, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, filter)
+		}
+	})
+}
+
+// TestLuceneMongoValueCoercers tests that field and type coercers normalize the values of equality,
+// comparison, $in and negated conditions, in Lucene and MQL filters alike
+func TestLuceneMongoValueCoercers(t *testing.T) {
+	upper := bsonic_config.ValueCoercerFunc(func(field string, value interface{}) (interface{}, error) {
+		if s, ok := value.(string); ok {
+			return strings.ToUpper(s), nil
+		}
+		return value, nil
+	})
+	digits := bsonic_config.ValueCoercerFunc(func(field string, value interface{}) (interface{}, error) {
+		s, ok := value.(string)
+		if !ok {
+			return value, nil
+		}
+		number := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, s)
+		if number == "" {
+			return nil, fmt.Errorf("%q has no digits", s)
+		}
+		return number, nil
+	})
+	cfg := bsonic_config.Default().WithDefaultFields([]string{"name"}).
+		WithFieldTypes(map[string]bsonic_config.FieldType{"code": bsonic_config.FieldTypeString, "phone": bsonic_config.FieldTypeString}).
+		WithCoercer("sku", upper).
+		WithCoercer("phone", digits).
+		WithTypeCoercer(bsonic_config.FieldTypeString, upper)
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		filter bson.M
+	}{
+		{"Field", "sku:abc-123", bson.M{"sku": "ABC-123"}},
+		{"FieldOverridesType", `phone:"(555) 123-4567"`, bson.M{"phone": "5551234567"}},
+		{"Type", "code:zz AND name:foo", bson.M{"code": "ZZ", "name": "foo"}},
+		{"Negated", "NOT sku:x", bson.M{"sku": bson.M{"$ne": "X"}}},
+		{"Comparison", `sku:>"m"`, bson.M{"sku": bson.M{"$gt": "M"}}},
+		{"In", "sku:(a OR b)", bson.M{"sku": bson.M{"$in": []interface{}{"A", "B"}}}},
+		{"Wildcard", "sku:ab*", bson.M{"sku": bson.M{"$regex": "^ab.*"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(filter, tt.filter) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.filter, filter)
+			}
+		})
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		_, err := parser.Parse("phone:unknown")
+		if !errors.Is(err, bsonic.ErrSyntax) || !strings.Contains(err.Error(), `cannot coerce phone value unknown: "unknown" has no digits`) {
+			t.Errorf("Expected the coercer error, got %v", err)
+		}
+	})
+
+	t.Run("MQL", func(t *testing.T) {
+		mql, err := bsonic.NewWithConfig(cfg.WithLanguage(bsonic_config.LanguageMQL))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		filter, err := mql.Parse(`{"$or": [{"sku": "abc"}, {"sku": {"$in": ["d", "e"]}}]}`)
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		expected := bson.M{"$or": bson.A{bson.M{"sku": "ABC"}, bson.M{"sku": bson.M{"$in": bson.A{"D", "E"}}}}}
+		if !reflect.DeepEqual(filter, expected) {
+			t.Errorf("Expected %v, got %v", expected, filter)
+		}
+	})
+}
+
+// TestLuceneMongoPhoneFields tests that phone fields are normalized to E.164, or to an $in of common formats
+func TestLuceneMongoPhoneFields(t *testing.T) {
+	cfg := bsonic_config.Default().WithDefaultFields([]string{"name"}).
+		WithPhoneFields(bsonic_config.PhoneOptions{CountryCode: "1"}, "phone")
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+	formats, err := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name"}).
+		WithPhoneFields(bsonic_config.PhoneOptions{CountryCode: "44", Formats: true}, "phone"))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+	ukFormats := []interface{}{"+442079460958", "442079460958", "00442079460958", "2079460958", "02079460958"}
+
+	tests := []struct {
+		name   string
+		parser *bsonic.Parser
+		query  string
+		filter bson.M
+	}{
+		{"Quoted", parser, `phone:"(555) 123-4567"`, bson.M{"phone": "+15551234567"}},
+		{"Unquoted", parser, "phone:555-123-4567", bson.M{"phone": "+15551234567"}},
+		{"Digits", parser, "phone:5551234567", bson.M{"phone": "+15551234567"}},
+		{"International", parser, "phone:+44-20-7946-0958", bson.M{"phone": "+442079460958"}},
+		{"Group", parser, "phone:(555.123.4567 OR 555.123.0000)", bson.M{"phone": bson.M{"$in": []interface{}{"+15551234567", "+15551230000"}}}},
+		{"NotAPhoneNumber", parser, "phone:unknown", bson.M{"phone": "unknown"}},
+		{"Wildcard", parser, "phone:555*", bson.M{"phone": bson.M{"$regex": "^555.*"}}},
+		{"Formats", formats, `phone:"020 7946 0958"`, bson.M{"phone": bson.M{"$in": ukFormats}}},
+		{"NegatedFormats", formats, "NOT phone:02079460958", bson.M{"phone": bson.M{"$nin": ukFormats}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := tt.parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(filter, tt.filter) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.filter, filter)
+			}
+		})
+	}
+}
+
+// TestLuceneMongoEmailFields tests domain and local part matches and lowercasing on email fields
+func TestLuceneMongoEmailFields(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name"}).WithEmailFields("email"))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		filter bson.M
+	}{
+		{"Domain", "email:@example.com", bson.M{"email": bson.M{"$regex": `@example\.com$`, "$options": "i"}}},
+		{"LocalPart", "email:john.doe+news@", bson.M{"email": bson.M{"$regex": `^john\.doe\+news@`, "$options": "i"}}},
+		{"Negated", "NOT email:@example.com", bson.M{"email": bson.M{"$not": bson.M{"$regex": `@example\.com$`, "$options": "i"}}}},
+		{"Address", "email:John@Example.com", bson.M{"email": "john@example.com"}},
+		{"Quoted", `email:"@example.com"`, bson.M{"email": "@example.com"}},
+		{"Wildcard", "email:john@*", bson.M{"email": bson.M{"$regex": "^john@.*"}}},
+		{"UntypedField", "backup:@example.com", bson.M{"backup": "@example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(filter, tt.filter) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.filter, filter)
+			}
+		})
+	}
+}
+
+// TestLuceneMongoSoftDelete tests that queries exclude soft-deleted documents unless they require a condition on the
+// soft delete field that only deleted documents meet
+func TestLuceneMongoSoftDelete(t *testing.T) {
+	cfg := bsonic_config.Default().WithDefaultFields([]string{"name"}).WithSoftDeleteField("deleted_at")
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		filter bson.M
+	}{
+		{"Empty", "", bson.M{"deleted_at": nil}},
+		{"Field", "role:admin", bson.M{"role": "admin", "deleted_at": nil}},
+		{"Or", "john OR role:admin", bson.M{
+			"$or":        []bson.M{{"name": bson.M{"$regex": "^john$", "$options": "i"}}, {"role": "admin"}},
+			"deleted_at": nil,
+		}},
+		{"Intent", "COUNT WHERE role:admin", bson.M{"role": "admin", "deleted_at": nil}},
+		{"Referenced", "deleted_at:TYPE(date)", bson.M{"deleted_at": bson.M{"$type": "date"}}},
+		{"ReferencedInAnd", "role:admin AND deleted_at:TYPE(date)", bson.M{"role": "admin", "deleted_at": bson.M{"$type": "date"}}},
+		{"ReferencedRange", "deleted_at:[2024-01-01 TO *]", bson.M{"deleted_at": bson.M{"$gte": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}},
+		{"NestedPath", "deleted_at.by:bob", bson.M{"deleted_at.by": "bob"}},
+		{"ReferencedInOr", "role:admin OR NOT deleted_at:TYPE(null)", bson.M{
+			"$or": []bson.M{
+				{"role": "admin"},
+				{"deleted_at": bson.M{"$not": bson.M{"$type": "null"}}},
+			},
+			"deleted_at": nil,
+		}},
+		{"ReferencedInOrBranch", "name:john OR deleted_at:zzz", bson.M{
+			"$or":        []bson.M{{"name": "john"}, {"deleted_at": "zzz"}},
+			"deleted_at": nil,
+		}},
+		{"ReferencedNegated", "name:john AND NOT deleted_at:zzz", bson.M{"$and": []bson.M{
+			{"name": "john", "deleted_at": bson.M{"$ne": "zzz"}},
+			{"deleted_at": nil},
+		}}},
+		{"ReferencedNull", "deleted_at:TYPE(null)", bson.M{"$and": []bson.M{
+			{"deleted_at": bson.M{"$type": "null"}},
+			{"deleted_at": nil},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(filter, tt.filter) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.filter, filter)
+			}
+		})
+	}
+
+	t.Run("And", func(t *testing.T) {
+		filter, err := parser.And("role:admin", "active:true")
+		if err != nil {
+			t.Fatalf("And should not return error, got: %v", err)
+		}
+		expected := bson.M{"role": "admin", "active": true, "deleted_at": nil}
+		if !reflect.DeepEqual(filter, expected) {
+			t.Errorf("Expected %v, got %v", expected, filter)
+		}
+	})
+
+	t.Run("Explain", func(t *testing.T) {
+		explanation, err := parser.Explain("role:admin")
+		if err != nil {
+			t.Fatalf("Explain should not return error, got: %v", err)
+		}
+		expected := bson.M{"role": "admin", "deleted_at": nil}
+		if !reflect.DeepEqual(explanation.Filter, expected) {
+			t.Errorf("Expected %v, got %v", expected, explanation.Filter)
+		}
+	})
+
+	t.Run("Lenient", func(t *testing.T) {
+		lenient, err := bsonic.NewWithConfig(cfg.WithLenientErrors(true))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		result, err := lenient.ParseDetailed("role:[a TO")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if !reflect.DeepEqual(result.Filter, bson.M{"deleted_at": nil}) {
+			t.Errorf("Expected only the soft delete condition, got %v", result.Filter)
+		}
+	})
+}
+
+func TestLuceneMongoBreadth(t *testing.T) {
+	cfg := bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithSoftDeleteField("deleted_at").
+		WithUnselectiveFields("status", "active", "tags.kind").
+		WithAllowedQueryOptions(bsonic_config.QueryOptionIncludeDeleted)
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		query   string
+		breadth bsonic.Breadth
+	}{
+		{"", bsonic.BreadthEmpty},
+		{"@include_deleted", bsonic.BreadthEmpty},
+		{"status:stale", bsonic.BreadthUnselective},
+		{"status:stale AND active:false", bsonic.BreadthUnselective},
+		{"tags.0.kind:draft", bsonic.BreadthUnselective},
+		{"deleted_at:*", bsonic.BreadthUnselective},
+		{"NOT role:admin", bsonic.BreadthUnselective},
+		{"email:*", bsonic.BreadthUnselective},
+		{"*", bsonic.BreadthUnselective},
+		{"email:/.*/", bsonic.BreadthUnselective},
+		{"email:TYPE(string)", bsonic.BreadthUnselective},
+		{"email:jo*", bsonic.BreadthSelective},
+		{"status:stale AND owner:bob", bsonic.BreadthSelective},
+		{"owner:bob OR status:stale", bsonic.BreadthUnselective},
+		{"(owner:bob AND status:stale) OR id:507f1f77bcf86cd799439011", bsonic.BreadthSelective},
+		{"john", bsonic.BreadthSelective},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			filter, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if breadth := parser.Breadth(filter); breadth != tt.breadth {
+				t.Errorf("Breadth(%v): expected %s, got %s", filter, tt.breadth, breadth)
+			}
+		})
+	}
+
+	t.Run("CheckBreadth", func(t *testing.T) {
+		if err := parser.CheckBreadth(bson.M{"owner": "bob"}, bsonic.BreadthSelective); err != nil {
+			t.Errorf("Expected a selective filter to pass, got %v", err)
+		}
+		if err := parser.CheckBreadth(bson.M{"status": "stale"}, bsonic.BreadthUnselective); err != nil {
+			t.Errorf("Expected an allowed unselective filter to pass, got %v", err)
+		}
+		if err := parser.CheckBreadth(bson.M{}, bsonic.BreadthEmpty); err != nil {
+			t.Errorf("Expected an allowed empty filter to pass, got %v", err)
+		}
+
+		err := parser.CheckBreadth(bson.M{}, bsonic.BreadthUnselective)
+		var breadthErr *bsonic.BreadthError
+		if !errors.Is(err, bsonic.ErrLimitExceeded) || !errors.As(err, &breadthErr) || breadthErr.Breadth != bsonic.BreadthEmpty {
+			t.Errorf("Expected a BreadthError for an empty filter, got %v", err)
+		}
+	})
+}
+
+func TestLuceneMongoPermissions(t *testing.T) {
+	cfg := bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithSoftDeleteField("deleted_at")
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+	perms := &bsonic.Permissions{Roles: map[string]bsonic.RoleAccess{
+		"support": {Fields: []string{"name", "email", "address"}, Operators: []string{"$in", "$regex", "$options"}},
+		"billing": {Fields: []string{"salary"}},
+		"admin":   {},
+	}}
+	strip := &bsonic.Permissions{Roles: perms.Roles, Policy: bsonic.MaskStrip}
+
+	t.Run("VisibleFields", func(t *testing.T) {
+		result, err := parser.ParseWithPermissions(context.Background(), "name:jo* AND address.city:Paris | sort:email", perms, "support")
+		if err != nil {
+			t.Fatalf("ParseWithPermissions should not return error, got: %v", err)
+		}
+		if _, ok := result.Filter["name"]; !ok || result.Filter["address.city"] != "Paris" || len(result.Filter) != 3 {
+			t.Errorf("expected both conditions and the soft delete condition, got: %v", result.Filter)
+		}
+	})
+
+	t.Run("RejectsForbiddenField", func(t *testing.T) {
+		_, err := parser.ParseWithPermissions(context.Background(), "name:john AND salary:[100000 TO *]", perms, "support")
+		var fieldErr *bsonic.FieldError
+		if !errors.As(err, &fieldErr) || fieldErr.Field != "salary" || !errors.Is(err, bsonic.ErrDisallowedField) {
+			t.Fatalf("expected a FieldError for salary, got: %v", err)
+		}
+	})
+
+	t.Run("RejectsForbiddenOperator", func(t *testing.T) {
+		_, err := parser.ParseWithPermissions(context.Background(), "address.zip:[10000 TO *]", perms, "support")
+		if !errors.Is(err, bsonic.ErrUnsupported) || !strings.Contains(err.Error(), "operator $gte is not allowed") {
+			t.Fatalf("expected the $gte operator to be rejected, got: %v", err)
+		}
+	})
+
+	t.Run("RolesCombine", func(t *testing.T) {
+		if _, err := parser.ParseWithPermissions(context.Background(), "name:john AND salary:[100000 TO *]", perms, "support", "billing"); err != nil {
+			t.Fatalf("a field visible to any role should be allowed, got: %v", err)
+		}
+		if _, err := parser.ParseWithPermissions(context.Background(), "secret:x", perms, "admin"); err != nil {
+			t.Fatalf("a role without fields should see every field, got: %v", err)
+		}
+	})
+
+	t.Run("StripsForbiddenClauses", func(t *testing.T) {
+		result, err := parser.ParseWithPermissions(context.Background(), "name:john AND (salary:[100000 TO *] OR email:john@example.com) | sort:-salary,name", strip, "support")
+		if err != nil {
+			t.Fatalf("ParseWithPermissions should not return error, got: %v", err)
+		}
+		clauses, _ := result.Filter["$and"].([]bson.M)
+		expected := []bson.M{{"$or": []bson.M{{"email": "john@example.com"}}}, {"name": "john"}}
+		if len(clauses) == 2 && clauses[0]["name"] != nil {
+			clauses = []bson.M{clauses[1], clauses[0]}
+		}
+		if !reflect.DeepEqual(clauses, expected) || len(result.Filter) != 2 {
+			t.Errorf("expected the salary condition to be stripped, got: %v", result.Filter)
+		}
+		if !reflect.DeepEqual(result.Sort, bson.D{{Key: "name", Value: 1}}) {
+			t.Errorf("expected the salary sort key to be stripped, got: %v", result.Sort)
+		}
+		for _, highlight := range result.Highlights {
+			if highlight.Field == "salary" {
+				t.Errorf("expected no highlight for the stripped salary condition, got: %v", result.Highlights)
+			}
+		}
+	})
+
+	t.Run("StripsEveryClause", func(t *testing.T) {
+		result, err := parser.ParseWithPermissions(context.Background(), "salary:[100000 TO *]", strip, "support")
+		if err != nil {
+			t.Fatalf("ParseWithPermissions should not return error, got: %v", err)
+		}
+		if !reflect.DeepEqual(result.Filter, bson.M{"deleted_at": nil}) {
+			t.Errorf("expected only the soft delete condition, got: %v", result.Filter)
+		}
+	})
+
+	t.Run("ProjectionIsNeverStripped", func(t *testing.T) {
+		_, err := parser.ParseWithPermissions(context.Background(), "name:john | fields:name,salary", strip, "support")
+		if !errors.Is(err, bsonic.ErrDisallowedField) {
+			t.Fatalf("expected the salary projection to be rejected, got: %v", err)
+		}
+	})
+
+	t.Run("MasksSearchStagePaths", func(t *testing.T) {
+		atlas, err := bsonic.NewWithConfig(bsonic_config.Default().
+			WithDefaultFields([]string{"name", "ssn"}).
+			WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		_, err = atlas.ParseWithPermissions(context.Background(), "john", perms, "support")
+		var fieldErr *bsonic.FieldError
+		if !errors.As(err, &fieldErr) || fieldErr.Field != "ssn" {
+			t.Fatalf("expected a FieldError for the ssn search path, got: %v", err)
+		}
+
+		result, err := atlas.ParseWithPermissions(context.Background(), "john", strip, "support")
+		if err != nil {
+			t.Fatalf("ParseWithPermissions should not return error, got: %v", err)
+		}
+		expected := bson.M{"$search": bson.M{"text": bson.M{"query": "john", "path": "name"}}}
+		if !reflect.DeepEqual(result.SearchStage, expected) {
+			t.Errorf("expected the ssn search path to be stripped, got: %v", result.SearchStage)
+		}
+
+		everyField, err := bsonic.NewWithConfig(bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := everyField.ParseWithPermissions(context.Background(), "john", perms, "support"); !errors.Is(err, bsonic.ErrUnsupported) {
+			t.Errorf("expected a search of every indexed field to be rejected, got: %v", err)
+		}
+		result, err = everyField.ParseWithPermissions(context.Background(), "name:john AND john", strip, "support")
+		if err != nil {
+			t.Fatalf("ParseWithPermissions should not return error, got: %v", err)
+		}
+		if result.SearchStage != nil || !reflect.DeepEqual(result.Filter, bson.M{"name": "john"}) {
+			t.Errorf("expected the wildcard search to be stripped, got: %v %v", result.SearchStage, result.Filter)
+		}
+	})
+
+	t.Run("RejectsTextSearchForFieldRoles", func(t *testing.T) {
+		text, err := bsonic.NewWithConfig(bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyTextIndex))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := text.ParseWithPermissions(context.Background(), "john", perms, "support"); !errors.Is(err, bsonic.ErrUnsupported) {
+			t.Errorf("expected $text to be rejected for a role limited to fields, got: %v", err)
+		}
+		result, err := text.ParseWithPermissions(context.Background(), "name:john AND john", strip, "support")
+		if err != nil {
+			t.Fatalf("ParseWithPermissions should not return error, got: %v", err)
+		}
+		if !reflect.DeepEqual(result.Filter, bson.M{"$and": []bson.M{{"name": "john"}}}) {
+			t.Errorf("expected the $text search to be stripped, got: %v", result.Filter)
+		}
+		if _, err := text.ParseWithPermissions(context.Background(), "john", perms, "admin"); err != nil {
+			t.Errorf("expected $text to be allowed for a role seeing every field, got: %v", err)
+		}
+	})
+
+	t.Run("InvalidRoles", func(t *testing.T) {
+		for _, roles := range [][]string{nil, {"intern"}} {
+			if _, err := parser.ParseWithPermissions(context.Background(), "name:john", perms, roles...); !errors.Is(err, bsonic.ErrUnsupported) {
+				t.Errorf("expected roles %v to be rejected, got: %v", roles, err)
+			}
+		}
+		if _, err := parser.ParseWithPermissions(context.Background(), "name:john", nil, "support"); !errors.Is(err, bsonic.ErrUnsupported) {
+			t.Errorf("expected missing permissions to be rejected, got: %v", err)
+		}
+	})
+}
+
+func TestLuceneMongoFingerprint(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name"}))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+	fingerprint := func(query string) string {
+		t.Helper()
+		hash, err := parser.Fingerprint(query)
+		if err != nil {
+			t.Fatalf("Fingerprint(%q) should not return error, got: %v", query, err)
+		}
+		return hash
+	}
+
+	same := [][2]string{
+		{"role:admin AND age:>=18 | sort:-age", "age:>=65 AND role:user | sort:-age"},
+		{"role:(admin OR user)", "role:(a OR b OR c)"},
+		{"(a:1 OR b:x) AND c:true", "c:false AND (b:y OR a:2)"},
+		{"name:jo*", "name:*smith"},
+		{"in:orders status:pending | limit:10", "in:orders  status:shipped | limit:50"},
+	}
+	for _, pair := range same {
+		if fingerprint(pair[0]) != fingerprint(pair[1]) {
+			t.Errorf("expected %q and %q to share a fingerprint", pair[0], pair[1])
+		}
+	}
+
+	different := [][2]string{
+		{"role:admin", "role:10"},
+		{"role:admin", "status:admin"},
+		{"role:admin | sort:age", "role:admin | sort:-age"},
+		{"role:admin", "role:admin | limit:10"},
+		{"role:admin", "NOT role:admin"},
+		{"in:orders role:admin", "in:users role:admin"},
+		{"role:admin", "COUNT WHERE role:admin"},
+	}
+	for _, pair := range different {
+		if fingerprint(pair[0]) == fingerprint(pair[1]) {
+			t.Errorf("expected %q and %q to have different fingerprints", pair[0], pair[1])
+		}
+	}
+
+	t.Run("Shape", func(t *testing.T) {
+		result, err := parser.ParseDetailed("role:admin AND age:>=18 | sort:-age")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		expected := `{collection:"",intent:"find",filter:{"age":{"$gte":?number},"role":?string},sort:{"age":-1}}`
+		if shape := result.Shape(); shape != expected {
+			t.Errorf("expected shape %s, got %s", expected, shape)
+		}
+		if len(result.Fingerprint()) != 64 {
+			t.Errorf("expected a hex SHA-256 fingerprint, got %q", result.Fingerprint())
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := bsonic.Fingerprint("name:(john"); !errors.Is(err, bsonic.ErrSyntax) {
+			t.Errorf("expected a syntax error, got: %v", err)
+		}
+	})
+}
+
+func TestLuceneMongoComplexity(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name", "email"}))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		query    string
+		expected bsonic.Complexity
+	}{
+		{"role:admin", bsonic.Complexity{Clauses: 1, PathDepth: 1, Cost: 2}},
+		{"name:jo* AND (address.city:Paris OR email:*@example.com)", bsonic.Complexity{
+			Clauses: 3, RegexClauses: 2, LeadingWildcards: 1, Depth: 2, PathDepth: 2, Cost: 20,
+		}},
+		{"john", bsonic.Complexity{Clauses: 2, RegexClauses: 2, Depth: 1, PathDepth: 1, Cost: 8}},
+		{"", bsonic.Complexity{Cost: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			result, err := parser.ParseDetailed(tt.query)
+			if err != nil {
+				t.Fatalf("ParseDetailed should not return error, got: %v", err)
+			}
+			if complexity := result.Complexity(); complexity != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, complexity)
+			}
+		})
+	}
+
+	t.Run("TextSearch", func(t *testing.T) {
+		textParser, err := bsonic.NewWithConfig(bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyTextIndex))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		result, err := textParser.ParseDetailed("john smith")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if complexity := result.Complexity(); !complexity.TextSearch || complexity.Cost != 6 {
+			t.Errorf("expected a text search costing 6, got %+v", complexity)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		data, err := json.Marshal(bsonic.Complexity{Clauses: 1, PathDepth: 1, Cost: 2})
+		if err != nil {
+			t.Fatalf("json.Marshal should not return error, got: %v", err)
+		}
+		expected := `{"clauses":1,"regexClauses":0,"leadingWildcards":0,"depth":0,"pathDepth":1,"textSearch":false,"lookups":0,"cost":2}`
+		if string(data) != expected {
+			t.Errorf("expected %s, got %s", expected, data)
+		}
+	})
+}
+
+func TestLuceneMongoLint(t *testing.T) {
+	tests := []struct {
+		query string
+		rules []bsonic.LintRule
+	}{
+		{"name:john AND (age:25 OR age:30)", nil},
+		{"(name:john)", []bsonic.LintRule{bsonic.LintRedundantParentheses}},
+		{"(name:john OR name:jane)", []bsonic.LintRule{bsonic.LintRedundantParentheses}},
+		{"a:1 AND (b:2 AND c:3)", []bsonic.LintRule{bsonic.LintRedundantParentheses}},
+		{"a:1 OR (b:2 OR c:3)", []bsonic.LintRule{bsonic.LintRedundantParentheses}},
+		{"NOT (a:1 AND b:2)", nil},
+		{"(a:1 OR b:2)^2", nil},
+		{"role:admin -status:banned", nil},
+		{"role:admin -status:banned AND active:true", []bsonic.LintRule{bsonic.LintMixedOperators}},
+		{"name:/.*son/", []bsonic.LintRule{bsonic.LintUnanchoredRegex}},
+		{"name:*son AND email:*", []bsonic.LintRule{bsonic.LintUnanchoredRegex}},
+		{"name:/jo.n/ AND name:jo*", nil},
+		{"john && jane", []bsonic.LintRule{bsonic.LintDeprecatedSyntax}},
+		{"(name:john) AND !active:true", []bsonic.LintRule{bsonic.LintRedundantParentheses, bsonic.LintDeprecatedSyntax}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			warnings, err := bsonic.Lint(tt.query)
+			if err != nil {
+				t.Fatalf("Lint(%q) should not return error, got: %v", tt.query, err)
+			}
+			var rules []bsonic.LintRule
+			for _, warning := range warnings {
+				rules = append(rules, warning.Rule)
+			}
+			if !reflect.DeepEqual(rules, tt.rules) {
+				t.Errorf("expected rules %v, got %v", tt.rules, warnings)
+			}
+		})
+	}
+
+	t.Run("Spans", func(t *testing.T) {
+		query := "role:admin AND (status:active)"
+		warnings, err := bsonic.Lint(query)
+		if err != nil {
+			t.Fatalf("Lint should not return error, got: %v", err)
+		}
+		if len(warnings) != 1 || query[warnings[0].Start:warnings[0].End] != "(status:active)" {
+			t.Errorf("expected a warning spanning the group, got %v", warnings)
+		}
+	})
+
+	t.Run("SyntaxError", func(t *testing.T) {
+		if _, err := bsonic.Lint("name:(john"); !errors.Is(err, bsonic.ErrSyntax) {
+			t.Errorf("expected a syntax error, got: %v", err)
+		}
+	})
+
+	t.Run("MQL", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().WithLanguage(bsonic_config.LanguageMQL))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := parser.Lint(`{"name": "john"}`); !errors.Is(err, bsonic.ErrUnsupported) {
+			t.Errorf("expected ErrUnsupported, got: %v", err)
+		}
+	})
+}
+
+func TestLuceneMongoQueryOptions(t *testing.T) {
+	cfg := bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithSoftDeleteField("deleted_at").
+		WithAllowedQueryOptions(bsonic_config.QueryOptionIncludeDeleted, bsonic_config.QueryOptionCaseSensitive, bsonic_config.QueryOptionLimit)
+	parser, err := bsonic.NewWithConfig(cfg)
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		filter  bson.M
+		limit   int64
+		options bsonic.QueryOptions
+	}{
+		{"IncludeDeleted", "@include_deleted role:admin", bson.M{"role": "admin"}, 0, bsonic.QueryOptions{IncludeDeleted: true}},
+		{"IncludeDeletedOnly", "@include_deleted", bson.M{}, 0, bsonic.QueryOptions{IncludeDeleted: true}},
+		{"CaseSensitive", "@case_sensitive john", bson.M{"name": bson.M{"$regex": "^john$"}, "deleted_at": nil}, 0,
+			bsonic.QueryOptions{CaseSensitive: true}},
+		{"CaseSensitiveNested", "@case_sensitive @include_deleted (john OR name:jo*) AND NOT role:admin", bson.M{
+			"$and": []bson.M{
+				{"$or": []bson.M{{"name": bson.M{"$regex": "^john$"}}, {"name": bson.M{"$regex": "^jo.*"}}}},
+				{"role": bson.M{"$ne": "admin"}},
+			},
+		}, 0, bsonic.QueryOptions{IncludeDeleted: true, CaseSensitive: true}},
+		{"Limit", "@limit:20 role:admin", bson.M{"role": "admin", "deleted_at": nil}, 20, bsonic.QueryOptions{Limit: 20}},
+		{"LimitDirectiveWins", "@limit:20 role:admin | limit:5", bson.M{"role": "admin", "deleted_at": nil}, 5,
+			bsonic.QueryOptions{Limit: 20}},
+		{"NotAnOption", "@example.com", bson.M{"name": bson.M{"$regex": "^@example\\.com$", "$options": "i"}, "deleted_at": nil}, 0,
+			bsonic.QueryOptions{}},
+		{"FieldValue", "contact:@example", bson.M{"contact": "@example", "deleted_at": nil}, 0, bsonic.QueryOptions{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.ParseDetailed(tt.query)
+			if err != nil {
+				t.Fatalf("ParseDetailed(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(result.Filter, tt.filter) {
+				t.Errorf("ParseDetailed(%q): expected filter %v, got %v", tt.query, tt.filter, result.Filter)
+			}
+			if result.Limit != tt.limit {
+				t.Errorf("ParseDetailed(%q): expected limit %d, got %d", tt.query, tt.limit, result.Limit)
+			}
+			if result.Options != tt.options {
+				t.Errorf("ParseDetailed(%q): expected options %+v, got %+v", tt.query, tt.options, result.Options)
+			}
+		})
+	}
+
+	t.Run("Route", func(t *testing.T) {
+		result, err := parser.ParseDetailed("@include_deleted in:orders status:pending")
+		if err != nil {
+			t.Fatalf("ParseDetailed should not return error, got: %v", err)
+		}
+		if result.Collection != "orders" || !reflect.DeepEqual(result.Filter, bson.M{"status": "pending"}) {
+			t.Errorf("Expected collection orders and filter {status: pending}, got %q and %v", result.Collection, result.Filter)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			query string
+			err   string
+		}{
+			{"@archived role:admin", "unknown query option: @archived"},
+			{"@limit role:admin", "@limit needs a positive limit"},
+			{"@limit:0 role:admin", "@limit needs a positive limit"},
+			{"@include_deleted:yes role:admin", "@include_deleted takes no value"},
+			{"@limit:5 @limit:10 role:admin", "query option given more than once: @limit"},
+		}
+		for _, tt := range tests {
+			_, err := parser.ParseDetailed(tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseDetailed(%q): expected error containing %q, got %v", tt.query, tt.err, err)
+			}
+		}
+	})
+
+	t.Run("Explain", func(t *testing.T) {
+		explanation, err := parser.Explain("@include_deleted role:admin")
+		if err != nil {
+			t.Fatalf("Explain should not return error, got: %v", err)
+		}
+		if !reflect.DeepEqual(explanation.Filter, bson.M{"role": "admin"}) {
+			t.Errorf("Expected {role: admin}, got %v", explanation.Filter)
+		}
+		if len(explanation.Clauses) != 1 || explanation.Clauses[0].Text != "role:admin" {
+			t.Errorf("Expected the role:admin clause, got %+v", explanation.Clauses)
+		}
+	})
+
+	t.Run("IncludeDeletedNotAllowed", func(t *testing.T) {
+		defaults, err := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name"}).WithSoftDeleteField("deleted_at"))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := defaults.ParseDetailed("@include_deleted role:admin"); !errors.Is(err, bsonic.ErrUnsupported) {
+			t.Errorf("Expected @include_deleted to be rejected by default, got %v", err)
+		}
+		if _, err := defaults.ParseDetailed("@case_sensitive @limit:5 role:admin"); err != nil {
+			t.Errorf("Expected the default options to be allowed, got %v", err)
+		}
+
+		strict, err := bsonic.NewWithConfig(cfg.WithPolicy(bsonic_config.PolicyStrictAPI))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		if _, err := strict.ParseDetailed("@include_deleted role:admin"); !errors.Is(err, bsonic.ErrUnsupported) {
+			t.Errorf("Expected @include_deleted to be rejected under the strict API policy, got %v", err)
+		}
+
+		perms := &bsonic.Permissions{Roles: map[string]bsonic.RoleAccess{"admin": {}}}
+		if _, err := parser.ParseWithPermissions(context.Background(), "@include_deleted role:admin", perms, "admin"); !errors.Is(err, bsonic.ErrUnsupported) {
+			t.Errorf("Expected @include_deleted to be rejected in a role-scoped parse, got %v", err)
+		}
+	})
+
+	t.Run("ParseIncludingDeleted", func(t *testing.T) {
+		defaults, err := bsonic.NewWithConfig(bsonic_config.Default().WithDefaultFields([]string{"name"}).WithSoftDeleteField("deleted_at"))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		result, err := defaults.ParseIncludingDeleted(context.Background(), "role:admin")
+		if err != nil {
+			t.Fatalf("ParseIncludingDeleted should not return error, got: %v", err)
+		}
+		if !reflect.DeepEqual(result.Filter, bson.M{"role": "admin"}) {
+			t.Errorf("Expected {role: admin}, got %v", result.Filter)
+		}
+		result, err = defaults.ParseIncludingDeleted(context.Background(), "")
+		if err != nil || len(result.Filter) != 0 {
+			t.Errorf("Expected an empty filter, got %v, %v", result, err)
+		}
+	})
+
+	t.Run("Combine", func(t *testing.T) {
+		if _, err := parser.And("@include_deleted role:admin", "active:true"); !errors.Is(err, bsonic.ErrUnsupported) {
+			t.Errorf("Expected ErrUnsupported, got %v", err)
+		}
+	})
+
+	t.Run("Encode", func(t *testing.T) {
+		query := "@include_deleted @limit:20 in:orders status:pending"
+		ast, err := lucene.New().Parse(query)
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		q := ast.(*lucene.ParticipleQuery)
+		if unparsed := lucene.Unparse(q); unparsed != query {
+			t.Errorf("Unparse: expected %q, got %q", query, unparsed)
+		}
+
+		data, err := json.Marshal(q)
+		if err != nil {
+			t.Fatalf("MarshalJSON should not return error, got: %v", err)
+		}
+		var decoded lucene.ParticipleQuery
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("UnmarshalJSON should not return error, got: %v", err)
+		}
+		if unparsed := lucene.Unparse(&decoded); unparsed != query {
+			t.Errorf("JSON round trip: expected %q, got %q", query, unparsed)
+		}
+
+		data, err = q.MarshalProto()
+		if err != nil {
+			t.Fatalf("MarshalProto should not return error, got: %v", err)
+		}
+		decoded = lucene.ParticipleQuery{}
+		if err := decoded.UnmarshalProto(data); err != nil {
+			t.Fatalf("UnmarshalProto should not return error, got: %v", err)
+		}
+		if unparsed := lucene.Unparse(&decoded); unparsed != query {
+			t.Errorf("Proto round trip: expected %q, got %q", query, unparsed)
+		}
+	})
+
+	t.Run("Diff", func(t *testing.T) {
+		changes, err := bsonic.Diff("@limit:5 role:admin", "@include_deleted @limit:10 role:admin")
+		if err != nil {
+			t.Fatalf("Diff should not return error, got: %v", err)
+		}
+		expected := []bsonic.Change{
+			{Kind: bsonic.ChangeModified, Target: bsonic.TargetOption, Field: "limit", Before: "@limit:5", After: "@limit:10"},
+			{Kind: bsonic.ChangeAdded, Target: bsonic.TargetOption, Field: "include_deleted", After: "@include_deleted"},
+		}
+		if !reflect.DeepEqual(changes, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, changes)
+		}
+	})
+}
+
+func TestLuceneMongoComparisonOperands(t *testing.T) {
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	dateTime := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	operators := map[string]string{">": "$gt", ">=": "$gte", "<": "$lt", "<=": "$lte"}
+
+	for op, operator := range operators {
+		tests := []struct {
+			name   string
+			query  string
+			filter bson.M
+		}{
+			{"Spaced", "price:" + op + " 10", bson.M{"price": bson.M{operator: 10.0}}},
+			{"SpacedDate", "created_at:" + op + " 2024-01-01", bson.M{"created_at": bson.M{operator: date}}},
+			{"DateTime", "created_at:" + op + "2024-01-01T10:00:00Z", bson.M{"created_at": bson.M{operator: dateTime}}},
+			{"SpacedDateTime", "created_at:" + op + " 2024-01-01T10:00:00Z", bson.M{"created_at": bson.M{operator: dateTime}}},
+			{"QuotedGroupedNumber", `price:` + op + `"1,000"`, bson.M{"price": bson.M{operator: 1000.0}}},
+			{"SpacedQuotedGroupedNumber", `price:` + op + ` "1,000.50"`, bson.M{"price": bson.M{operator: 1000.5}}},
+			{"GroupedNumber", "price:" + op + "12,500", bson.M{"price": bson.M{operator: 12500.0}}},
+			{"SingleQuoted", "price:" + op + " '5'", bson.M{"price": bson.M{operator: 5.0}}},
+			{"QuotedString", `name:` + op + ` "John Doe"`, bson.M{"name": bson.M{operator: "John Doe"}}},
+			{"InValueGroup", "price:(" + op + " 10 OR 1)", bson.M{"$or": []bson.M{
+				{"price": bson.M{operator: 10.0}},
+				{"price": 1.0},
+			}}},
+			{"InNestedGroup", "profile:{age:" + op + " 5}", bson.M{"profile.age": bson.M{operator: 5.0}}},
+		}
+		for _, tt := range tests {
+			t.Run(op+"/"+tt.name, func(t *testing.T) {
+				filter, err := bsonic.ParseWithDefaults([]string{"name"}, tt.query)
+				if err != nil {
+					t.Fatalf("ParseWithDefaults(%q) should not return error, got: %v", tt.query, err)
+				}
+				if !reflect.DeepEqual(filter, tt.filter) {
+					t.Errorf("Expected %+v, got %+v", tt.filter, filter)
+				}
+			})
+		}
+	}
+
+	t.Run("SpacedRange", func(t *testing.T) {
+		filter, err := bsonic.ParseWithDefaults([]string{"name"}, "price:>= 10 AND price:<= 20 AND status:active")
+		if err != nil {
+			t.Fatalf("ParseWithDefaults should not return error, got: %v", err)
+		}
+		expected := bson.M{"price": bson.M{"$gte": 10.0, "$lte": 20.0}, "status": "active"}
+		if !reflect.DeepEqual(filter, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, filter)
+		}
+	})
+
+	t.Run("DateTimeOffset", func(t *testing.T) {
+		filter, err := bsonic.ParseWithDefaults([]string{"name"}, "created_at:<=2024-01-01T15:30:00+05:30")
+		if err != nil {
+			t.Fatalf("ParseWithDefaults should not return error, got: %v", err)
+		}
+		got, ok := filter["created_at"].(bson.M)["$lte"].(time.Time)
+		if !ok || !got.Equal(dateTime) {
+			t.Errorf("Expected $lte %v, got %+v", dateTime, filter)
+		}
+	})
+
+	t.Run("BareOperator", func(t *testing.T) {
+		// An operator without an operand is not joined with the next clause
+		filter, err := bsonic.ParseWithDefaults([]string{"name"}, "price:> AND status:active")
+		if err != nil {
+			t.Fatalf("ParseWithDefaults should not return error, got: %v", err)
+		}
+		expected := bson.M{"price": ">", "status": "active"}
+		if !reflect.DeepEqual(filter, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, filter)
+		}
+	})
+}
+
+func TestLuceneMongoUnsupportedFeatures(t *testing.T) {
+	rejected := []struct {
+		query   string
+		feature formatter.Feature
+		msg     string
+	}{
+		{"name:john^2", formatter.FeatureBoost, "boost ^2 is not supported"},
+		{"john^1.5", formatter.FeatureBoost, "boost ^1.5 is not supported"},
+		{`name:"john doe"^2`, formatter.FeatureBoost, "boost ^2"},
+		{"(a OR b)^2", formatter.FeatureBoost, "boost ^2"},
+		{"tags:(a OR b)^2", formatter.FeatureBoost, "boost ^2"},
+		{"profile:{city:SF}^2", formatter.FeatureBoost, "boost ^2"},
+		{"status:active AND NOT name:john^2", formatter.FeatureBoost, "boost ^2"},
+		{"name:roam~", formatter.FeatureFuzzy, "fuzzy search ~ is not supported"},
+		{"roam~1", formatter.FeatureFuzzy, "fuzzy search ~1"},
+		{`"john smith"~3`, formatter.FeatureProximity, "phrase proximity ~3 is not supported"},
+		{`name:"john smith"~3`, formatter.FeatureProximity, "phrase proximity ~3"},
+		{"owner:IN_QUERY(users WHERE role:admin)", formatter.FeatureSubquery, "IN_QUERY requires a subquery resolver"},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := bsonic.ParseWithDefaults([]string{"name"}, tt.query)
+			if !errors.Is(err, bsonic.ErrUnsupported) || !errors.Is(err, bsonic.ErrUnsupportedByFormatter) {
+				t.Fatalf("Expected an unsupported feature error, got %v", err)
+			}
+			var featureErr *formatter.FeatureError
+			if !errors.As(err, &featureErr) || featureErr.Feature != tt.feature {
+				t.Fatalf("Expected a FeatureError for %s, got %#v", tt.feature, featureErr)
+			}
+			if !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("Expected the error to contain %q, got %v", tt.msg, err)
+			}
+		})
+	}
+
+	// Escaped suffixes and characters inside a value are literal text
+	for query, expected := range map[string]bson.M{
+		`name:john\^2`: {"name": "john^2"},
+		"name:x^y":     {"name": "x^y"},
+		"name:a~b":     {"name": "a~b"},
+	} {
+		filter, err := bsonic.ParseWithDefaults([]string{"name"}, query)
+		if err != nil {
+			t.Fatalf("ParseWithDefaults(%q) should not return error, got: %v", query, err)
+		}
+		if !reflect.DeepEqual(filter, expected) {
+			t.Errorf("ParseWithDefaults(%q): expected %+v, got %+v", query, expected, filter)
+		}
+	}
+
+	t.Run("Atlas", func(t *testing.T) {
+		parser, err := bsonic.NewWithConfig(bsonic_config.Default().
+			WithDefaultFields([]string{"name"}).
+			WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		_, err = parser.ParseDetailed("john OR status:active")
+		var featureErr *formatter.FeatureError
+		if !errors.As(err, &featureErr) || featureErr.Feature != formatter.FeatureFreeTextOr {
+			t.Errorf("Expected a FeatureError for %s, got %v", formatter.FeatureFreeTextOr, err)
+		}
+	})
+}
+
+func TestLuceneMongoCapabilities(t *testing.T) {
+	resolver := func(_ context.Context, collection string, filter bson.M) ([]interface{}, error) { return nil, nil }
+	tests := []struct {
+		name        string
+		config      *bsonic_config.Config
+		unsupported []formatter.Feature
+	}{
+		{"Default", bsonic_config.Default().WithDefaultFields([]string{"name"}), []formatter.Feature{
+			formatter.FeatureBoost, formatter.FeatureFuzzy, formatter.FeatureProximity, formatter.FeatureSubquery,
+		}},
+		{"SubqueryResolver", bsonic_config.Default().WithDefaultFields([]string{"name"}).WithSubqueryResolver(resolver), []formatter.Feature{
+			formatter.FeatureBoost, formatter.FeatureFuzzy, formatter.FeatureProximity,
+		}},
+		{"TextIndex", bsonic_config.Default().WithTextSearchStrategy(bsonic_config.StrategyTextIndex), []formatter.Feature{
+			formatter.FeatureBoost, formatter.FeatureFuzzy, formatter.FeatureProximity, formatter.FeatureSubquery,
+			formatter.FeatureRegexFreeText, formatter.FeatureNegatedFreeText,
+		}},
+		{"AtlasSearch", bsonic_config.Default().WithDefaultFields([]string{"name"}).WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch), []formatter.Feature{
+			formatter.FeatureBoost, formatter.FeatureFuzzy, formatter.FeatureProximity, formatter.FeatureSubquery,
+			formatter.FeatureFreeTextOr, formatter.FeatureNegatedFreeText, formatter.FeatureMultiWordValues,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := bsonic.NewWithConfig(tt.config)
+			if err != nil {
+				t.Fatalf("NewWithConfig should not return error, got: %v", err)
+			}
+			capabilities, err := parser.Capabilities()
+			if err != nil {
+				t.Fatalf("Capabilities should not return error, got: %v", err)
+			}
+			if len(capabilities) != len(formatter.Features()) {
+				t.Errorf("Expected every feature to be reported, got %v", capabilities)
+			}
+			var unsupported []formatter.Feature
+			for _, feature := range formatter.Features() {
+				if !capabilities.Supports(feature) {
+					unsupported = append(unsupported, feature)
+				}
+			}
+			if !reflect.DeepEqual(unsupported, tt.unsupported) {
+				t.Errorf("Expected %v to be unsupported, got %v", tt.unsupported, unsupported)
+			}
+		})
+	}
+}
+
+// TestLuceneMongoFormatResult tests the filter, stages and metadata of formatter results and the adapters
+// between the result and bare filter interfaces
+func TestLuceneMongoFormatResult(t *testing.T) {
+	ast, err := lucene.New().Parse("role:admin AND john | sort:name | limit:5")
+	if err != nil {
+		t.Fatalf("Parse should not return error, got: %v", err)
+	}
+	filter := bson.M{"role": "admin", "name": bson.M{"$regex": "^john$", "$options": "i"}}
+
+	t.Run("Metadata", func(t *testing.T) {
+		result, err := mongo.New().FormatResult(ast, formatter.Options{DefaultFields: []string{"name"}})
+		if err != nil {
+			t.Fatalf("FormatResult should not return error, got: %v", err)
+		}
+		if !reflect.DeepEqual(result.Filter, filter) {
+			t.Errorf("Expected filter %v, got %v", filter, result.Filter)
+		}
+		if len(result.PreStages) != 0 || len(result.PostStages) != 0 || len(result.Warnings) != 0 {
+			t.Errorf("Expected no stages or warnings, got %+v", result)
+		}
+		spec, ok := result.Metadata[mongo.MetadataFindSpec].(*mongo.FindSpec)
+		if !ok || spec.Limit != 5 || !reflect.DeepEqual(spec.Sort, bson.D{{Key: "name", Value: 1}}) {
+			t.Errorf("Expected the find spec in the metadata, got %+v", result.Metadata[mongo.MetadataFindSpec])
+		}
+		highlights, ok := result.Metadata[mongo.MetadataHighlights].([]mongo.Highlight)
+		if !ok || len(highlights) == 0 {
+			t.Errorf("Expected highlights in the metadata, got %+v", result.Metadata[mongo.MetadataHighlights])
+		}
+	})
+
+	t.Run("Stages", func(t *testing.T) {
+		atlas := mongo.New().WithTextSearchStrategy(bsonic_config.StrategyAtlasSearch)
+		result, err := atlas.FormatResult(ast, formatter.Options{DefaultFields: []string{"name"}})
+		if err != nil {
+			t.Fatalf("FormatResult should not return error, got: %v", err)
+		}
+		if len(result.PreStages) != 1 || result.PreStages[0]["$search"] == nil {
+			t.Errorf("Expected a $search pre-stage, got %v", result.PreStages)
+		}
+
+		weighted := mongo.New().WithTextSearchStrategy(bsonic_config.StrategyRegexFields)
+		result, err = weighted.FormatResult(ast, formatter.Options{DefaultFields: []string{"name"}, FieldWeights: map[string]int{"name": 2}})
+		if err != nil {
+			t.Fatalf("FormatResult should not return error, got: %v", err)
+		}
+		if len(result.PostStages) != 1 || result.PostStages[0]["$addFields"] == nil {
+			t.Errorf("Expected an $addFields post-stage, got %v", result.PostStages)
+		}
+	})
+
+	t.Run("Adapters", func(t *testing.T) {
+		legacy := formatter.ToLegacy[bson.M](mongo.New())
+		got, err := legacy.FormatWithDefaults(ast, []string{"name"})
+		if err != nil {
+			t.Fatalf("FormatWithDefaults should not return error, got: %v", err)
+		}
+		if !reflect.DeepEqual(got, filter) {
+			t.Errorf("Expected filter %v, got %v", filter, got)
+		}
+
+		adapted := formatter.FromLegacy(legacy)
+		result, err := adapted.FormatResult(ast, formatter.Options{DefaultFields: []string{"name"}})
+		if err != nil {
+			t.Fatalf("FormatResult should not return error, got: %v", err)
+		}
+		if !reflect.DeepEqual(result.Filter, filter) || result.Metadata != nil {
+			t.Errorf("Expected only the filter %v, got %+v", filter, result)
+		}
+		if len(adapted.Capabilities()) != 0 {
+			t.Errorf("Expected no capabilities without a Capabilities method, got %v", adapted.Capabilities())
+		}
+		if !formatter.FromLegacy[bson.M](mongo.New()).Capabilities().Supports(formatter.FeatureFreeTextOr) {
+			t.Error("Expected the adapter to report the capabilities of the adapted formatter")
+		}
+	})
+}
+
+func TestLuceneMongoValueCasts(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithFieldTypes(map[string]bsonic_config.FieldType{"zip": bsonic_config.FieldTypeString}))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+	objectID, _ := bson.ObjectIDFromHex("507f1f77bcf86cd799439011")
+	decimal, _ := bson.ParseDecimal128("1.10")
+
+	tests := []struct {
+		name   string
+		query  string
+		filter bson.M
+	}{
+		{"Int", "count:int(42)", bson.M{"count": int32(42)}},
+		{"Long", "size:long(9000000000)", bson.M{"size": int64(9000000000)}},
+		{"Double", "ratio:double(0.5)", bson.M{"ratio": 0.5}},
+		{"Decimal", "price:decimal(1.10)", bson.M{"price": decimal}},
+		{"Date", `created:date("2023-01-15")`, bson.M{"created": time.Date(2023, 1, 15, 0, 0, 0, 0, time.UTC)}},
+		{"ObjectID", `author:oid("507f1f77bcf86cd799439011")`, bson.M{"author": objectID}},
+		{"ObjectIDAlias", "author:objectId(507f1f77bcf86cd799439011)", bson.M{"author": objectID}},
+		{"String", "flag:str(true)", bson.M{"flag": "true"}},
+		{"StringID", "id:str(507f1f77bcf86cd799439011)", bson.M{"_id": "507f1f77bcf86cd799439011"}},
+		{"QuotedString", `title:string("AND \"more\"")`, bson.M{"title": `AND "more"`}},
+		{"Bool", "active:bool(false)", bson.M{"active": false}},
+		{"UUID", "session:uuid(550e8400-e29b-41d4-a716-446655440000)", bson.M{"session": bson.Binary{
+			Subtype: bson.TypeBinaryUUID,
+			Data:    []byte{0x55, 0x0e, 0x84, 0x00, 0xe2, 0x9b, 0x41, 0xd4, 0xa7, 0x16, 0x44, 0x66, 0x55, 0x44, 0x00, 0x00},
+		}}},
+		{"OverridesFieldType", "zip:int(02134)", bson.M{"zip": int32(2134)}},
+		{"Not", "NOT count:int(0)", bson.M{"count": bson.M{"$ne": int32(0)}}},
+		{"PrefixOperator", "status:active -count:int(0)", bson.M{"status": "active", "count": bson.M{"$ne": int32(0)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(result, tt.filter) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.filter, result)
+			}
+		})
+	}
+
+	t.Run("InvalidValue", func(t *testing.T) {
+		for _, query := range []string{"count:int(abc)", "count:int(3000000000)", "active:bool(yes)", "author:oid(123)", `created:date("soon")`} {
+			if _, err := parser.Parse(query); !errors.Is(err, bsonic.ErrSyntax) || !strings.Contains(err.Error(), "cannot cast") {
+				t.Errorf("Parse(%q): expected a cast error, got %v", query, err)
+			}
+		}
+	})
+
+	t.Run("InvalidEncodedModifier", func(t *testing.T) {
+		var decoded lucene.ParticipleQuery
+		err := json.Unmarshal([]byte(`{"version":1,"expression":{"type":"field","field":"n","value":{"kind":"terms","terms":["a"]},"modifier":"^x"}}`), &decoded)
+		if err == nil || !strings.Contains(err.Error(), "invalid modifier") {
+			t.Errorf("Expected an invalid modifier error, got %v", err)
+		}
+	})
+
+	t.Run("InvalidEncodedCast", func(t *testing.T) {
+		var decoded lucene.ParticipleQuery
+		err := json.Unmarshal([]byte(`{"version":1,"expression":{"type":"field","field":"n","value":{"kind":"cast","text":"float(1)"}}}`), &decoded)
+		if err == nil || !strings.Contains(err.Error(), "invalid cast") {
+			t.Errorf("Expected an invalid cast error, got %v", err)
+		}
+	})
+}
+
+func TestLuceneMongoExplicitEquality(t *testing.T) {
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithExplicitEquality(true).
+		WithEnumField("status", "active", "banned"))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		filter bson.M
+	}{
+		{"Equality", "status:active", bson.M{"status": bson.M{"$eq": "active"}}},
+		{"And", "status:active AND age:>5", bson.M{"status": bson.M{"$eq": "active"}, "age": bson.M{"$gt": 5.0}}},
+		{"Or", "status:active OR role:admin", bson.M{"$or": []bson.M{
+			{"status": bson.M{"$eq": "active"}},
+			{"role": bson.M{"$eq": "admin"}},
+		}}},
+		{"Not", "NOT role:admin", bson.M{"role": bson.M{"$ne": "admin"}}},
+		{"In", "role:admin OR role:owner", bson.M{"role": bson.M{"$in": []interface{}{"admin", "owner"}}}},
+		{"Regex", "john", bson.M{"name": bson.M{"$regex": "^john$", "$options": "i"}}},
+		{"Type", "deleted_at:TYPE(null)", bson.M{"deleted_at": bson.M{"$type": "null"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(result, tt.filter) {
+				t.Errorf("Parse(%q): expected %v, got %v", tt.query, tt.filter, result)
+			}
+		})
+	}
+
+	t.Run("EnumValidation", func(t *testing.T) {
+		if _, err := parser.Parse("status:bogus"); err == nil {
+			t.Error("Expected enum values to be validated with explicit equality")
+		}
+	})
+
+	t.Run("MQL", func(t *testing.T) {
+		mqlParser, err := bsonic.NewWithConfig(bsonic_config.Default().
+			WithLanguage(bsonic_config.LanguageMQL).
+			WithExplicitEquality(true))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		result, err := mqlParser.Parse(`{"a": "x", "$or": [{"b": "y"}, {"c": {"$gt": 2}}]}`)
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+		expected := bson.M{"a": bson.M{"$eq": "x"}, "$or": bson.A{
+			bson.M{"b": bson.M{"$eq": "y"}},
+			bson.M{"c": bson.M{"$gt": int32(2)}},
+		}}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected %v, got %v", expected, result)
+		}
+	})
+}
+
+func TestLuceneMongoFieldNameSafety(t *testing.T) {
+	resolved := 0
+	parser, err := bsonic.NewWithConfig(bsonic_config.Default().
+		WithDefaultFields([]string{"name"}).
+		WithSubqueryResolver(func(context.Context, string, bson.M) ([]interface{}, error) {
+			resolved++
+			return []interface{}{"x"}, nil
+		}))
+	if err != nil {
+		t.Fatalf("NewWithConfig should not return error, got: %v", err)
+	}
+
+	t.Run("Rejected", func(t *testing.T) {
+		for _, query := range []string{
+			"$where:1",
+			"$expr:1",
+			"$or:x",
+			"+$where:1",
+			"-$where:1",
+			"($where:1)",
+			"status:active AND ($where:1 OR name:x)",
+			"$where:{a:1}",
+			"profile:{$where:1}",
+			"profile:{address:{$function:x}}",
+			"author:IN_QUERY(users WHERE $where:1)",
+			"a\x00b:1",
+			"\x00$where:1",
+			"status:active | sort:a\x00b",
+			"status:active | fields:\x00",
+			"DISTINCT a\x00b WHERE status:active",
+		} {
+			result, err := parser.ParseDetailed(query)
+			if !errors.Is(err, bsonic.ErrSyntax) {
+				t.Errorf("Parse(%q): expected %v, got %v (filter %v)", query, bsonic.ErrSyntax, err, result)
+			}
+		}
+		if resolved != 0 {
+			t.Errorf("Expected subqueries naming operators to be rejected before they are resolved, got %d calls", resolved)
+		}
+	})
+
+	t.Run("TopLevelKeys", func(t *testing.T) {
+		for _, query := range []string{
+			"name:$where",
+			`name:"$where:1"`,
+			"where:1 OR function:x",
+			"a$where:1",
+			"john $where",
+			"note:{x}",
+		} {
+			result, err := parser.Parse(query)
+			if err != nil {
+				t.Fatalf("Parse(%q) should not return error, got: %v", query, err)
+			}
+			for key := range result {
+				if strings.HasPrefix(key, "$") && key != "$and" && key != "$or" && key != "$nor" {
+					t.Errorf("Parse(%q) emitted the top-level operator %s: %v", query, key, result)
+				}
+			}
+		}
+	})
+
+	t.Run("MQL", func(t *testing.T) {
+		mqlParser, err := bsonic.NewWithConfig(bsonic_config.Default().WithLanguage(bsonic_config.LanguageMQL))
+		if err != nil {
+			t.Fatalf("NewWithConfig should not return error, got: %v", err)
+		}
+		for _, query := range []string{`{"$where": "sleep(1000)"}`, `{"a": {"$function": {}}}`, `{"a\u0000b": 1}`} {
+			if _, err := mqlParser.Parse(query); err == nil {
+				t.Errorf("Parse(%q) should return an error", query)
+			}
+		}
+	})
+}
@@ -0,0 +1,30 @@
+package mql_mongo_test
+
+import (
+	"strings"
+	"testing"
+)
+
+// FuzzParse checks that untrusted MQL input never panics the parser.
+func FuzzParse(f *testing.F) {
+	seeds := []string{
+		`{"name": "john"}`,
+		`{"$or": [{"a": 1}, {"b": {"$in": [1, 2]}}]}`,
+		`{"a": {"$numberLong": "x"}}`,
+		`{"$where": "1"}`,
+		`{`,
+		`[]`,
+		`"x"`,
+		strings.Repeat(`{"$and": [`, 50) + `{}` + strings.Repeat(`]}`, 50),
+		strings.Repeat(`[`, 200),
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	parser := createMQLParser([]string{"name", "a"})
+	f.Fuzz(func(t *testing.T, query string) {
+		// Errors are expected for malformed input; panics are not
+		_, _ = parser.ParseDetailed(query)
+	})
+}
@@ -0,0 +1,176 @@
+package mql_mongo_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kyle-williams-1/bsonic"
+	bsonic_config "github.com/kyle-williams-1/bsonic/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// createMQLParser creates a parser for the MQL language with an optional field allowlist
+func createMQLParser(allowedFields []string) *bsonic.Parser {
+	cfg := bsonic_config.Default().
+		WithLanguage(bsonic_config.LanguageMQL).
+		WithAllowedFields(allowedFields)
+	parser, _ := bsonic.NewWithConfig(cfg)
+	return parser
+}
+
+// TestMQLMongoPassThrough tests that MQL filters are passed through unchanged
+func TestMQLMongoPassThrough(t *testing.T) {
+	parser := createMQLParser(nil)
+
+	tests := []struct {
+		input    string
+		expected bson.M
+		desc     string
+	}{
+		{`{"name": "john"}`, bson.M{"name": "john"}, "simple equality"},
+		{`{"age": {"$gte": 18, "$lt": 65}}`, bson.M{"age": bson.M{"$gte": int32(18), "$lt": int32(65)}}, "comparison operators"},
+		{
+			`{"$or": [{"name": "john"}, {"role": {"$in": ["admin", "owner"]}}]}`,
+			bson.M{"$or": bson.A{bson.M{"name": "john"}, bson.M{"role": bson.M{"$in": bson.A{"admin", "owner"}}}}},
+			"logical operator with $in",
+		},
+		{`{"count": {"$numberLong": "42"}}`, bson.M{"count": int64(42)}, "extended JSON number"},
+		{`{}`, bson.M{}, "empty filter"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			result, err := parser.Parse(test.input)
+			if err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+
+			if !reflect.DeepEqual(result, test.expected) {
+				t.Fatalf("Expected %+v, got %+v", test.expected, result)
+			}
+		})
+	}
+
+	t.Run("ExtendedJSONObjectID", func(t *testing.T) {
+		result, err := parser.Parse(`{"_id": {"$oid": "507f1f77bcf86cd799439011"}}`)
+		if err != nil {
+			t.Fatalf("Parse should not return error, got: %v", err)
+		}
+
+		expected, _ := bson.ObjectIDFromHex("507f1f77bcf86cd799439011")
+		if result["_id"] != expected {
+			t.Fatalf("Expected ObjectID %v, got %T: %+v", expected, result["_id"], result["_id"])
+		}
+	})
+}
+
+// TestMQLMongoErrorConditions tests rejection of malformed filters and disallowed operators
+func TestMQLMongoErrorConditions(t *testing.T) {
+	parser := createMQLParser(nil)
+
+	tests := []struct {
+		input        string
+		errorMessage string
+		desc         string
+	}{
+		{`{"name": `, "invalid MQL filter", "truncated JSON"},
+		{`name:john`, "invalid MQL filter", "lucene syntax"},
+		{`{"$where": "this.a > 1"}`, "unsupported MQL operator: $where", "top-level $where"},
+		{`{"$or": [{"a": 1}, {"$where": "sleep(100)"}]}`, "unsupported MQL operator: $where", "nested $where"},
+		{`{"a": {"$function": {"body": "", "args": [], "lang": "js"}}}`, "unsupported MQL operator: $function", "$function operator"},
+		{`{"$expr": {"$eq": ["$a", "$b"]}}`, "unsupported MQL operator: $expr", "$expr operator"},
+		{`{"$and": {"name": "john"}}`, "$and must be an array of filter documents", "$and with a document operand"},
+		{`{"$or": [{"name": "john"}, "secret"]}`, "$or must be an array of filter documents", "$or with a string item"},
+		{`{"$nor": [[{"name": "john"}]]}`, "$nor must be an array of filter documents", "$nor with a nested array"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := parser.Parse(test.input)
+			if err == nil {
+				t.Fatalf("Expected error for '%s', got none", test.input)
+			}
+			if !strings.Contains(err.Error(), test.errorMessage) {
+				t.Fatalf("Expected error message to contain '%s', got: %v", test.errorMessage, err)
+			}
+		})
+	}
+}
+
+// TestMQLMongoAllowedFields tests that MQL filters are validated against the field allowlist
+func TestMQLMongoAllowedFields(t *testing.T) {
+	parser := createMQLParser([]string{"name", "profile"})
+
+	allowed := []string{
+		`{"name": "john"}`,
+		`{"profile.location": "SF"}`,
+		`{"$or": [{"name": "john"}, {"profile": {"$exists": true}}]}`,
+	}
+	for _, input := range allowed {
+		t.Run("Allowed "+input, func(t *testing.T) {
+			if _, err := parser.Parse(input); err != nil {
+				t.Fatalf("Parse should not return error, got: %v", err)
+			}
+		})
+	}
+
+	rejected := []string{
+		`{"password": "x"}`,
+		`{"profileX": 1}`,
+		`{"$and": [{"name": "john"}, {"$nor": [{"secret": 1}]}]}`,
+	}
+	for _, input := range rejected {
+		t.Run("Rejected "+input, func(t *testing.T) {
+			_, err := parser.Parse(input)
+			if err == nil {
+				t.Fatalf("Expected error for '%s', got none", input)
+			}
+			if !strings.Contains(err.Error(), "field not allowed") {
+				t.Fatalf("Expected field not allowed error, got: %v", err)
+			}
+		})
+	}
+
+	// Logical operands that are not arrays of documents would hide their fields from the allowlist
+	malformed := []string{
+		`{"$and": {"secret": 1}}`,
+		`{"$or": [{"name": "john"}, [{"secret": 1}]]}`,
+	}
+	for _, input := range malformed {
+		t.Run("Malformed "+input, func(t *testing.T) {
+			_, err := parser.Parse(input)
+			if !errors.Is(err, bsonic.ErrSyntax) {
+				t.Fatalf("Expected a syntax error, got: %v", err)
+			}
+		})
+	}
+
+	// $text searches fields outside the allowlist
+	_, err := parser.Parse(`{"$text": {"$search": "john"}}`)
+	if !errors.Is(err, bsonic.ErrDisallowedField) || !strings.Contains(err.Error(), "$text") {
+		t.Fatalf("Expected $text to be rejected as a disallowed field, got: %v", err)
+	}
+}
+
+// TestMQLMongoCombineQueries tests that MQL filters are combined as documents
+func TestMQLMongoCombineQueries(t *testing.T) {
+	parser := createMQLParser(nil)
+
+	result, err := parser.And(`{"role": "admin"}`, `{"active": true}`)
+	if err != nil {
+		t.Fatalf("And should not return error, got: %v", err)
+	}
+	if expected := (bson.M{"role": "admin", "active": true}); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, result)
+	}
+
+	result, err = parser.Or(`{"role": "admin"}`, `{"role": "owner"}`)
+	if err != nil {
+		t.Fatalf("Or should not return error, got: %v", err)
+	}
+	if expected := (bson.M{"$or": []bson.M{{"role": "admin"}, {"role": "owner"}}}); !reflect.DeepEqual(result, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, result)
+	}
+}
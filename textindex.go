@@ -0,0 +1,135 @@
+package bsonic
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kyle-williams-1/bsonic/advisor"
+	"github.com/kyle-williams-1/bsonic/config"
+	mongodriver "go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// DefaultIndexCacheTTL is how long a TextIndexSelector trusts a collection's index list before listing it again.
+const DefaultIndexCacheTTL = time.Minute
+
+// IndexLister lists the indexes of a collection by name.
+type IndexLister func(ctx context.Context, collection string) ([]advisor.Index, error)
+
+// DatabaseIndexes returns an IndexLister that lists the indexes of the collections in a live database.
+func DatabaseIndexes(db *mongodriver.Database) IndexLister {
+	return func(ctx context.Context, collection string) ([]advisor.Index, error) {
+		return advisor.ListIndexes(ctx, db.Collection(collection))
+	}
+}
+
+// TextIndexOption configures a TextIndexSelector.
+type TextIndexOption func(*TextIndexSelector)
+
+// WithIndexCacheTTL sets how long index lists are cached. A non-positive TTL caches them until Invalidate is called.
+func WithIndexCacheTTL(ttl time.Duration) TextIndexOption {
+	return func(s *TextIndexSelector) {
+		s.ttl = ttl
+	}
+}
+
+// textIndexEntry is the cached text index check for a collection.
+type textIndexEntry struct {
+	hasTextIndex bool
+	expires      time.Time
+}
+
+// TextIndexSelector picks how free text is compiled per collection: a $text search when the collection has a
+// text index, and regexes across the default fields otherwise, so the same code suits deployments with and
+// without text indexes. Index lists are cached per collection; it is safe for concurrent use.
+type TextIndexSelector struct {
+	indexes IndexLister
+	ttl     time.Duration
+	text    *Parser
+	regex   *Parser
+
+	mu    sync.Mutex
+	cache map[string]textIndexEntry
+}
+
+// NewTextIndexSelector creates a selector from a config with default fields, which the regex fallback searches.
+// The config's text search strategy is replaced by StrategyTextIndex or StrategyRegexFields per collection.
+func NewTextIndexSelector(cfg *config.Config, indexes IndexLister, opts ...TextIndexOption) (*TextIndexSelector, error) {
+	if len(cfg.DefaultFields) == 0 {
+		return nil, unsupportedf("text index fallback needs default fields to search without a text index")
+	}
+
+	// Copies of a frozen snapshot leave the caller's config untouched
+	base := cfg.Freeze()
+	text, err := NewWithConfig(base.WithTextSearchStrategy(config.StrategyTextIndex))
+	if err != nil {
+		return nil, err
+	}
+	regex, err := NewWithConfig(base.WithTextSearchStrategy(config.StrategyRegexFields))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &TextIndexSelector{
+		indexes: indexes,
+		ttl:     DefaultIndexCacheTTL,
+		text:    text,
+		regex:   regex,
+		cache:   map[string]textIndexEntry{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
+}
+
+// HasTextIndex reports whether a collection has a text index, listing its indexes when the cached answer
+// is missing or expired. Listing errors are returned and not cached.
+func (s *TextIndexSelector) HasTextIndex(ctx context.Context, collection string) (bool, error) {
+	s.mu.Lock()
+	entry, ok := s.cache[collection]
+	s.mu.Unlock()
+	if ok && (s.ttl <= 0 || time.Now().Before(entry.expires)) {
+		return entry.hasTextIndex, nil
+	}
+
+	indexes, err := s.indexes(ctx, collection)
+	if err != nil {
+		return false, err
+	}
+	entry = textIndexEntry{hasTextIndex: advisor.TextIndex(indexes) != "", expires: time.Now().Add(s.ttl)}
+
+	s.mu.Lock()
+	s.cache[collection] = entry
+	s.mu.Unlock()
+	return entry.hasTextIndex, nil
+}
+
+// Invalidate drops the cached index check for a collection, such as after creating or dropping its text index.
+func (s *TextIndexSelector) Invalidate(collection string) {
+	s.mu.Lock()
+	delete(s.cache, collection)
+	s.mu.Unlock()
+}
+
+// Parser returns the parser for a collection: one compiling free text to $text when it has a text index,
+// and to regexes across the default fields otherwise.
+func (s *TextIndexSelector) Parser(ctx context.Context, collection string) (*Parser, error) {
+	hasTextIndex, err := s.HasTextIndex(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	if hasTextIndex {
+		return s.text, nil
+	}
+	return s.regex, nil
+}
+
+// ParseDetailed parses a query for a collection with the parser Parser picks for it.
+func (s *TextIndexSelector) ParseDetailed(ctx context.Context, collection, query string) (*ParseResult, error) {
+	parser, err := s.Parser(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	return parser.ParseDetailedContext(ctx, query)
+}
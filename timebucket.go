@@ -0,0 +1,83 @@
+package bsonic
+
+import (
+	"strings"
+	"time"
+
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// expandTimeBuckets adds bucket boundary conditions next to the clauses on bucketed time fields, so a
+// time-series collection only scans the buckets whose time range can hold a match. Only clauses that must
+// hold for a document to match are expanded: those at the top level or under $and and $or, not negations.
+func (p *Parser) expandTimeBuckets(filter bson.M) {
+	if len(p.Config.TimeBuckets) == 0 {
+		return
+	}
+
+	// Collect the keys first, since the conditions are added to the document being walked
+	keys := make([]string, 0, len(filter))
+	for key := range filter {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		switch {
+		case key == "$and" || key == "$or":
+			for _, sub := range bsonfilter.Clauses(filter[key]) {
+				p.expandTimeBuckets(sub)
+			}
+		case !strings.HasPrefix(key, "$"):
+			bucket, ok := p.Config.TimeBuckets[key]
+			if !ok {
+				continue
+			}
+			minField, maxField := bucket.Min, bucket.Max
+			if minField == "" {
+				minField = "control.min." + key
+			}
+			if maxField == "" {
+				maxField = "control.max." + key
+			}
+
+			minCond, maxCond := bucketConditions(filter[key])
+			if _, exists := filter[minField]; len(minCond) > 0 && !exists {
+				filter[minField] = minCond
+			}
+			if _, exists := filter[maxField]; len(maxCond) > 0 && !exists {
+				filter[maxField] = maxCond
+			}
+		}
+	}
+}
+
+// bucketConditions returns the conditions on a bucket's earliest and latest times implied by a time field
+// condition: a bucket can only hold a time after a lower bound if its latest time is after it, and
+// only a time before an upper bound if its earliest time is before it.
+func bucketConditions(value interface{}) (minCond, maxCond bson.M) {
+	minCond, maxCond = bson.M{}, bson.M{}
+	if t, ok := value.(time.Time); ok {
+		minCond["$lte"], maxCond["$gte"] = t, t
+		return minCond, maxCond
+	}
+
+	ops, ok := value.(bson.M)
+	if !ok {
+		return nil, nil
+	}
+	for op, operand := range ops {
+		t, ok := operand.(time.Time)
+		if !ok {
+			continue
+		}
+		switch op {
+		case "$eq":
+			minCond["$lte"], maxCond["$gte"] = t, t
+		case "$gt", "$gte":
+			maxCond[op] = t
+		case "$lt", "$lte":
+			minCond[op] = t
+		}
+	}
+	return minCond, maxCond
+}
@@ -0,0 +1,252 @@
+package bsonic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/kyle-williams-1/bsonic/formatter/mongo"
+	"github.com/kyle-williams-1/bsonic/language/lucene"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Update operators, as written at the start of an update clause
+const (
+	updateSet   = "SET"
+	updateInc   = "INC"
+	updateUnset = "UNSET"
+)
+
+// ParseUpdate parses an update expression using the default parser and converts it into an update document.
+func ParseUpdate(update string) (bson.M, error) {
+	return New().ParseUpdate(update)
+}
+
+// ParseUpdate parses a constrained update expression, such as "SET status:archived, INC retry_count:1, UNSET temp_field",
+// into an update document with $set, $inc and $unset operators, so admin tooling can express bulk updates in the
+// query syntax. Clauses are separated by commas and start with SET, INC or UNSET, which carries over to the clauses
+// after it, as in "SET status:archived, archived_by:admin".
+//
+// SET values are converted as in filters, including field types, value coercers and casts, so numbers are
+// doubles unless cast with int(5) or long(5); wildcards, ranges, regexes and other values that do not match a
+// single value are rejected. INC values must be numbers, and whole numbers are 32-bit or 64-bit integers.
+// The expression is normalized and parsed like a Lucene query with the parser's config. Fields are checked against
+// the allowlist, array fields and enum fields, and may only be updated once, together with the paths inside them, so "SET a:1, UNSET a.b" is rejected;
+// _id and field names with spaces are rejected.
+func (p *Parser) ParseUpdate(update string) (bson.M, error) {
+	p, err := p.current()
+	if err != nil {
+		return nil, err
+	}
+	return guard(func() (bson.M, error) {
+		return p.parseUpdate(update)
+	})
+}
+
+// parseUpdate builds and validates the update document for an update expression without recovering from panics.
+func (p *Parser) parseUpdate(update string) (bson.M, error) {
+	mongoFormatter, ok := p.formatter.(*mongo.MongoFormatter)
+	if !ok {
+		return nil, fmt.Errorf("formatter is not a MongoFormatter")
+	}
+
+	result := bson.M{}
+	var updated []string
+	operator := ""
+	// Normalized first, so commas inside curly quotes do not split clauses
+	for _, clause := range splitUpdateClauses(p.normalize(update)) {
+		if keyword, rest, found := cutSpace(clause); isUpdateOperator(keyword) {
+			if !found {
+				return nil, fmt.Errorf("invalid update: %s needs a field", keyword)
+			}
+			operator, clause = keyword, rest
+		}
+
+		var field string
+		var value interface{}
+		var err error
+		switch operator {
+		case updateSet, updateInc:
+			field, value, err = p.parseUpdateAssignment(mongoFormatter, operator, clause)
+		case updateUnset:
+			field, err = mongoFormatter.FormatFieldName(clause)
+			if err == nil {
+				err = checkUpdateField(field)
+			}
+			if err == nil {
+				err = p.validateField(field)
+			}
+			value = ""
+		default:
+			return nil, fmt.Errorf("invalid update: clauses must start with SET, INC or UNSET: %s", clause)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// MongoDB rejects updates to a field and a path inside it, such as a and a.b, as conflicting
+		for _, earlier := range updated {
+			if field == earlier {
+				return nil, fmt.Errorf("invalid update: %s is updated more than once", field)
+			}
+			if strings.HasPrefix(field, earlier+".") || strings.HasPrefix(earlier, field+".") {
+				return nil, fmt.Errorf("invalid update: %s conflicts with %s", field, earlier)
+			}
+		}
+		updated = append(updated, field)
+
+		key := "$" + strings.ToLower(operator)
+		doc, _ := result[key].(bson.M)
+		if doc == nil {
+			doc = bson.M{}
+			result[key] = doc
+		}
+		doc[field] = value
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("invalid update: no fields to update")
+	}
+	return result, nil
+}
+
+// parseUpdateAssignment converts a field:value clause of SET or INC into its field and value
+func (p *Parser) parseUpdateAssignment(mongoFormatter *mongo.MongoFormatter, operator, clause string) (string, interface{}, error) {
+	ast, err := p.parseLanguage(clause)
+	if err != nil {
+		return "", nil, err
+	}
+	query, ok := ast.(*lucene.ParticipleQuery)
+	if !ok {
+		return "", nil, fmt.Errorf("invalid update: update expressions are written in the lucene language, not %s", p.Config.Language)
+	}
+	fieldValue := updateFieldValue(query)
+	if fieldValue == nil {
+		return "", nil, fmt.Errorf("invalid update: %s needs a single field:value, got %s", operator, clause)
+	}
+
+	field, value, err := mongoFormatter.FormatValue(fieldValue)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := checkUpdateField(field); err != nil {
+		return "", nil, err
+	}
+	if err := p.validateFields(bson.M{field: value}); err != nil {
+		return "", nil, err
+	}
+	switch value.(type) {
+	case bson.M, bson.D, bson.A, []interface{}, bson.Regex:
+		return "", nil, fmt.Errorf("invalid update: %s needs a single value, got %s", operator, clause)
+	}
+
+	if operator == updateInc {
+		value, err = incrementValue(fieldValue, value)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return field, value, nil
+}
+
+// checkUpdateField rejects a field an update may not change: a name with whitespace, such as UNSET a b, which
+// is a mistake rather than a field, and _id, which MongoDB never lets an update change
+func checkUpdateField(field string) error {
+	if strings.IndexFunc(field, unicode.IsSpace) >= 0 {
+		return fmt.Errorf("invalid update: field names cannot contain spaces: %q", field)
+	}
+	if field == "_id" {
+		return fmt.Errorf("invalid update: _id cannot be updated")
+	}
+	return nil
+}
+
+// updateFieldValue returns the field:value clause a query consists of, or nil when it is anything else,
+// such as free text, several clauses or a value with a boost or fuzziness modifier
+func updateFieldValue(q *lucene.ParticipleQuery) *lucene.ParticipleFieldValue {
+	if len(q.Options) > 0 || q.Collection != "" || q.Intent != nil || len(q.Directives) > 0 || q.Expression == nil ||
+		len(q.Expression.Or) != 1 || len(q.Expression.Or[0].And) != 1 {
+		return nil
+	}
+	term := q.Expression.Or[0].And[0].Term
+	if term == nil || term.FieldValue == nil || term.FieldValue.Value == nil || term.Modifier != nil {
+		return nil
+	}
+	if value := term.FieldValue.Value; len(value.TextTerms) > 1 || value.TypeCheck != nil || value.Regex != nil || value.Bracketed != nil {
+		return nil
+	}
+	return term.FieldValue
+}
+
+// incrementValue checks that an INC value is a number, converting a whole number written without a cast
+// to a 32-bit or 64-bit integer so incrementing an integer field keeps its type
+func incrementValue(fieldValue *lucene.ParticipleFieldValue, value interface{}) (interface{}, error) {
+	switch value.(type) {
+	case float64:
+		if terms := fieldValue.Value.TextTerms; len(terms) == 1 {
+			if n, err := strconv.ParseInt(strings.TrimPrefix(terms[0], "+"), 10, 64); err == nil {
+				if int64(int32(n)) == n {
+					return int32(n), nil
+				}
+				return n, nil
+			}
+		}
+		return value, nil
+	case int32, int64, bson.Decimal128:
+		return value, nil
+	}
+	return nil, fmt.Errorf("invalid update: INC %s needs a number, got %v", fieldValue.Field, value)
+}
+
+// cutSpace slices s around its first whitespace, returning the text before and the trimmed text after it,
+// and whether there was any text after it
+func cutSpace(s string) (before, after string, found bool) {
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return s, "", false
+	}
+	after = strings.TrimSpace(s[i:])
+	return s[:i], after, after != ""
+}
+
+// isUpdateOperator reports whether a word is an update operator keyword
+func isUpdateOperator(word string) bool {
+	return word == updateSet || word == updateInc || word == updateUnset
+}
+
+// splitUpdateClauses splits an update expression at the commas between its clauses, trimming each one.
+// Commas inside quotes, brackets and parentheses, or escaped with a backslash, do not split.
+func splitUpdateClauses(update string) []string {
+	var clauses []string
+	start, depth := 0, 0
+	var quote byte
+	for i := 0; i < len(update); i++ {
+		c := update[i]
+		switch {
+		case c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case (c == ')' || c == ']') && depth > 0:
+			depth--
+		case c == ',' && depth == 0:
+			clauses = append(clauses, strings.TrimSpace(update[start:i]))
+			start = i + 1
+		}
+	}
+	clauses = append(clauses, strings.TrimSpace(update[start:]))
+
+	nonEmpty := clauses[:0]
+	for _, clause := range clauses {
+		if clause != "" {
+			nonEmpty = append(nonEmpty, clause)
+		}
+	}
+	return nonEmpty
+}
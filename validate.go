@@ -0,0 +1,310 @@
+package bsonic
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kyle-williams-1/bsonic/config"
+
+	"github.com/kyle-williams-1/bsonic/internal/bsonfilter"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// validateFields checks every field referenced by a filter against the configured allowlist and array fields,
+// and the values of enum fields against their allowed values.
+// Validation runs on the formatted BSON, so it applies the same way regardless of input language.
+func (p *Parser) validateFields(filter bson.M) error {
+	if err := p.validateEnums(filter); err != nil {
+		return err
+	}
+	if len(p.Config.AllowedFields) == 0 && len(p.Config.ArrayFields) == 0 {
+		return nil
+	}
+	// $text searches every field of the text index, which the allowlist cannot check
+	if len(p.Config.AllowedFields) > 0 && hasTextSearch(filter) {
+		return &FieldError{Field: "$text"}
+	}
+
+	return walkFilterFields(filter, p.validateField)
+}
+
+// validateField checks a field against the configured allowlist and array fields.
+func (p *Parser) validateField(field string) error {
+	if len(p.Config.AllowedFields) > 0 && !isAllowedField(field, p.Config.AllowedFields) {
+		return &FieldError{Field: field, Suggestions: suggestFields(field, p.Config.AllowedFields)}
+	}
+	return p.validateArrayPath(field)
+}
+
+// isAllowedField reports whether field matches an allowed field or is nested beneath one,
+// with or without its array indexes, so items.0.price is allowed when items.price is.
+func isAllowedField(field string, allowedFields []string) bool {
+	schemaPath := config.SchemaPath(field)
+	for _, allowed := range allowedFields {
+		if field == allowed || strings.HasPrefix(field, allowed+".") ||
+			schemaPath == allowed || strings.HasPrefix(schemaPath, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// validateArrayPath rejects a path with an array index after a typed field, or an object with typed fields,
+// that is not a declared array field, such as name.0 when name is a string. Fields the types do not describe
+// are left alone, and paths are not checked until array fields are declared.
+func (p *Parser) validateArrayPath(field string) error {
+	if len(p.Config.ArrayFields) == 0 {
+		return nil
+	}
+
+	parts := strings.Split(field, ".")
+	for i := 1; i < len(parts); i++ {
+		if !config.IsArrayIndex(parts[i]) {
+			continue
+		}
+		indexed := strings.Join(parts[:i], ".")
+		schemaPath := config.SchemaPath(indexed)
+		if !slices.Contains(p.Config.ArrayFields, schemaPath) && p.isTypedPath(schemaPath) {
+			return fmt.Errorf("invalid positional path %s: %s is not an array field", field, indexed)
+		}
+	}
+	return nil
+}
+
+// walkFilterFields calls visit for every field name in a filter document,
+// descending into the sub-filters of logical operators such as $and, $or and $nor. A logical operator
+// whose operand is not an array of documents is an error, since its fields could not be visited.
+func walkFilterFields(filter bson.M, visit func(field string) error) error {
+	for key, value := range filter {
+		if !strings.HasPrefix(key, "$") {
+			if err := visit(key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		clauses := bsonfilter.Clauses(value)
+		if bsonfilter.IsLogical(key) {
+			var err error
+			if clauses, err = bsonfilter.LogicalClauses(key, value); err != nil {
+				return err
+			}
+		}
+		for _, sub := range clauses {
+			if err := walkFilterFields(sub, visit); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isTypedPath reports whether a path is a typed field or an object holding one.
+func (p *Parser) isTypedPath(path string) bool {
+	for field := range p.Config.FieldTypes {
+		if field == path || strings.HasPrefix(field, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// validateResultFields checks the sort and projection fields of a parse result against the configured allowlist
+// and array fields.
+func (p *Parser) validateResultFields(result *ParseResult) error {
+	if len(p.Config.AllowedFields) == 0 && len(p.Config.ArrayFields) == 0 {
+		return nil
+	}
+
+	if result.DistinctField != "" {
+		if err := p.validateField(result.DistinctField); err != nil {
+			return err
+		}
+	}
+	for _, key := range result.Sort {
+		if err := p.validateField(key.Key); err != nil {
+			return err
+		}
+	}
+	for field := range result.Projection {
+		if field == "_id" {
+			continue
+		}
+		if err := p.validateField(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateEnums checks the values compared against enum fields, descending into logical operators.
+func (p *Parser) validateEnums(filter bson.M) error {
+	if len(p.Config.EnumFields) == 0 {
+		return nil
+	}
+
+	for key, value := range filter {
+		if strings.HasPrefix(key, "$") {
+			for _, sub := range bsonfilter.Clauses(value) {
+				if err := p.validateEnums(sub); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		allowed, ok := p.Config.EnumFields[key]
+		if !ok {
+			allowed, ok = p.Config.EnumFields[config.SchemaPath(key)]
+		}
+		if ok {
+			if err := p.validateEnumValue(key, allowed, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateEnumValue checks a field's value, or the values of its equality and membership operators.
+// Range, existence and other operators are left alone.
+func (p *Parser) validateEnumValue(field string, allowed []string, value interface{}) error {
+	switch v := value.(type) {
+	case bson.M:
+		for op, operand := range v {
+			switch op {
+			case "$eq", "$ne":
+				if err := p.validateEnumValue(field, allowed, operand); err != nil {
+					return err
+				}
+			case "$in", "$nin":
+				for _, element := range enumElements(operand) {
+					if err := p.validateEnumValue(field, allowed, element); err != nil {
+						return err
+					}
+				}
+			case "$not":
+				if err := p.validateEnumValue(field, allowed, operand); err != nil {
+					return err
+				}
+			case "$regex":
+				if p.Config.RejectEnumWildcards {
+					return &EnumError{Field: field, Value: fmt.Sprint(operand), Allowed: allowed, Wildcard: true}
+				}
+			}
+		}
+		return nil
+	case bson.Regex:
+		if p.Config.RejectEnumWildcards {
+			return &EnumError{Field: field, Value: v.Pattern, Allowed: allowed, Wildcard: true}
+		}
+		return nil
+	case nil:
+		return nil
+	}
+
+	str := fmt.Sprint(value)
+	for _, candidate := range allowed {
+		if str == candidate {
+			return nil
+		}
+	}
+	return &EnumError{Field: field, Value: str, Allowed: allowed, Suggestion: closestValue(str, allowed)}
+}
+
+// enumElements returns the elements of an $in or $nin array.
+func enumElements(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case bson.A:
+		return v
+	case []interface{}:
+		return v
+	case []string:
+		elements := make([]interface{}, len(v))
+		for i, s := range v {
+			elements[i] = s
+		}
+		return elements
+	}
+	return []interface{}{value}
+}
+
+// closestValue returns the allowed value with the smallest edit distance to value,
+// or "" when none is within a third of its length, which is unlikely to be a typo.
+func closestValue(value string, allowed []string) string {
+	best, bestDistance := "", len(value)/3+1
+	for _, candidate := range allowed {
+		if d := editDistance(strings.ToLower(value), strings.ToLower(candidate)); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// maxFieldSuggestions caps the number of fields a FieldError suggests
+const maxFieldSuggestions = 3
+
+// suggestFields returns the known fields closest to a rejected field, nearest first, keeping those within a third
+// of their length like closestValue. A field nested beneath a misspelled known field is compared by its leading
+// segments, so adress.city suggests address.city when address is known.
+func suggestFields(field string, known []string) []string {
+	parts := strings.Split(field, ".")
+	distances := map[string]int{}
+	for _, candidate := range known {
+		segments := strings.Count(candidate, ".") + 1
+		if segments > len(parts) {
+			continue
+		}
+		compared := strings.Join(parts[:segments], ".")
+		suggestion := strings.Join(append([]string{candidate}, parts[segments:]...), ".")
+		d := editDistance(strings.ToLower(compared), strings.ToLower(candidate))
+		if d >= len(compared)/3+1 || suggestion == field {
+			continue
+		}
+		if previous, ok := distances[suggestion]; !ok || d < previous {
+			distances[suggestion] = d
+		}
+	}
+
+	suggestions := make([]string, 0, len(distances))
+	for suggestion := range distances {
+		suggestions = append(suggestions, suggestion)
+	}
+	slices.SortFunc(suggestions, func(a, b string) int {
+		if distances[a] != distances[b] {
+			return distances[a] - distances[b]
+		}
+		return strings.Compare(a, b)
+	})
+	if len(suggestions) > maxFieldSuggestions {
+		suggestions = suggestions[:maxFieldSuggestions]
+	}
+	if len(suggestions) == 0 {
+		return nil
+	}
+	return suggestions
+}
+
+// editDistance returns the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr := make([]int, len(rb)+1)
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev = curr
+	}
+	return prev[len(rb)]
+}